@@ -0,0 +1,39 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PullRequestRef is a push to refs/for/<target-branch>[/<topic-branch>]
+type PullRequestRef struct {
+	Target string
+	Topic  string
+}
+
+// ParsePullRequestRef parses an AGit flow ref, refs/for/<target-branch>/<topic-branch> or refs/for/<target-branch>.
+// Branch names may contain slashes, so isBranch is asked for every prefix of the remainder, the longest existing
+// branch becomes the target and the rest the topic. If isBranch is nil the whole remainder is the target.
+func ParsePullRequestRef(refName string, isBranch func(name string) bool) (*PullRequestRef, error) {
+	if !strings.HasPrefix(refName, PullRequestPrefix) {
+		return nil, fmt.Errorf("not an AGit ref: %s", refName)
+	}
+	rest := refName[len(PullRequestPrefix):]
+	if rest == "" {
+		return nil, fmt.Errorf("AGit ref without target branch: %s", refName)
+	}
+	if isBranch == nil || isBranch(rest) {
+		return &PullRequestRef{Target: rest}, nil
+	}
+
+	for i := strings.LastIndexByte(rest, '/'); i > 0; i = strings.LastIndexByte(rest[:i], '/') {
+		if isBranch(rest[:i]) {
+			return &PullRequestRef{Target: rest[:i], Topic: rest[i+1:]}, nil
+		}
+	}
+	return nil, fmt.Errorf("target branch of %s does not exist", refName)
+}
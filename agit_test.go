@@ -0,0 +1,88 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePullRequestRef(t *testing.T) {
+	branches := map[string]bool{"main": true, "release/v1": true}
+	isBranch := func(name string) bool { return branches[name] }
+
+	cases := map[string]PullRequestRef{
+		"refs/for/main":             {Target: "main"},
+		"refs/for/main/feature":     {Target: "main", Topic: "feature"},
+		"refs/for/main/feature/sub": {Target: "main", Topic: "feature/sub"},
+		"refs/for/release/v1/fix":   {Target: "release/v1", Topic: "fix"},
+		"refs/for/release/v1":       {Target: "release/v1"},
+	}
+	for ref, expected := range cases {
+		pr, err := ParsePullRequestRef(ref, isBranch)
+		if assert.NoError(t, err, ref) {
+			assert.Equal(t, expected, *pr, ref)
+		}
+	}
+
+	pr, err := ParsePullRequestRef("refs/for/release/v1/fix", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "release/v1/fix", pr.Target)
+
+	for _, ref := range []string{"refs/heads/main", "refs/for/", "refs/for/missing/topic"} {
+		_, err := ParsePullRequestRef(ref, isBranch)
+		assert.Error(t, err, ref)
+	}
+}
+
+func TestProcReceive(t *testing.T) {
+	oldOID := strings.Repeat("0", 40)
+	newOID := "feaf4ba6bc635fec442f46ddd4512416ec43c2c2"
+
+	in := new(bytes.Buffer)
+	assert.NoError(t, writePktLine(in, "version=1\x00push-options atomic"))
+	assert.NoError(t, writeFlushPkt(in))
+	assert.NoError(t, writePktLine(in, oldOID+" "+newOID+" refs/for/main/feature"))
+	assert.NoError(t, writePktLine(in, oldOID+" "+newOID+" refs/for/missing"))
+	assert.NoError(t, writeFlushPkt(in))
+	assert.NoError(t, writePktLine(in, "title=Add feature"))
+	assert.NoError(t, writeFlushPkt(in))
+
+	out := new(bytes.Buffer)
+	p := NewProcReceive(in, out)
+	assert.NoError(t, p.Negotiate("push-options"))
+	assert.True(t, p.HasCapability("push-options"))
+	assert.False(t, p.HasCapability("atomic"))
+
+	commands, err := p.ReadCommands()
+	assert.NoError(t, err)
+	assert.Equal(t, []*ProcReceiveCommand{
+		{OldOID: oldOID, NewOID: newOID, RefName: "refs/for/main/feature"},
+		{OldOID: oldOID, NewOID: newOID, RefName: "refs/for/missing"},
+	}, commands)
+
+	opts, err := p.ReadPushOptions()
+	assert.NoError(t, err)
+	assert.Equal(t, "Add feature", opts.Title())
+
+	assert.NoError(t, p.WriteResults([]*ProcReceiveResult{
+		{RefName: "refs/for/main/feature", ReportRef: "refs/pull/1/head", OldOID: oldOID, NewOID: newOID},
+		{RefName: "refs/for/missing", Reason: "target branch does not exist"},
+	}))
+
+	assert.Equal(t, "001bversion=1\x00push-options\n0000"+
+		"001dok refs/for/main/feature\n"+
+		"0024option refname refs/pull/1/head\n"+
+		"003coption old-oid "+oldOID+"\n"+
+		"003coption new-oid "+newOID+"\n"+
+		"0035ng refs/for/missing target branch does not exist\n"+
+		"0000", out.String())
+
+	assert.Error(t, NewProcReceive(strings.NewReader("0015version=2\x00atomic\n0000"), out).Negotiate())
+	assert.Error(t, NewProcReceive(strings.NewReader("zzzz"), out).Negotiate())
+}
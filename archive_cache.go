@@ -0,0 +1,266 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/enverbisevac/gitlib/util"
+)
+
+// ArchiveCacheOptions configures an ArchiveCache
+type ArchiveCacheOptions struct {
+	// Dir is the directory the archives are stored in, archives already stored there are reused
+	Dir string
+	// TTL evicts archives generated longer ago, they are kept until the size limit is reached if it is 0
+	TTL time.Duration
+	// MaxSize evicts the least recently used archives once the archives take more bytes, 0 is unlimited
+	MaxSize int64
+	// Timeout limits a generation, which isn't canceled with the requests waiting for it. The default command timeout is used if it is 0
+	Timeout time.Duration
+}
+
+type archiveCacheEntry struct {
+	path     string
+	size     int64
+	created  time.Time
+	lastUsed time.Time
+}
+
+// archiveCall is an archive being generated, concurrent requests for it wait for done
+type archiveCall struct {
+	done chan struct{}
+	err  error
+}
+
+// ArchiveCache stores generated archives on disk, so repeated requests for the archive of a commit
+// don't run git archive again. Concurrent requests for the same archive wait for a single generation.
+type ArchiveCache struct {
+	opts ArchiveCacheOptions
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*archiveCacheEntry
+	calls   map[string]*archiveCall
+}
+
+// NewArchiveCache creates an archive cache storing the archives in opts.Dir
+func NewArchiveCache(opts ArchiveCacheOptions) (*ArchiveCache, error) {
+	if err := os.MkdirAll(opts.Dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	c := &ArchiveCache{
+		opts:    opts,
+		now:     time.Now,
+		entries: make(map[string]*archiveCacheEntry),
+		calls:   make(map[string]*archiveCall),
+	}
+
+	files, err := os.ReadDir(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		path := filepath.Join(opts.Dir, file.Name())
+		if strings.HasSuffix(file.Name(), ".tmp") {
+			// left behind by an interrupted generation
+			_ = util.Remove(path)
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			return nil, err
+		}
+		c.entries[file.Name()] = &archiveCacheEntry{path: path, size: info.Size(), created: info.ModTime(), lastUsed: info.ModTime()}
+	}
+	c.Evict()
+	return c, nil
+}
+
+// archiveCacheKey is the file name of the archive of the commit of the repository
+func archiveCacheKey(repoPath, commitID string, opts ArchiveOptions) string {
+	h := sha256.New()
+	_, _ = io.WriteString(h, strings.Join(append([]string{repoPath, commitID, opts.Format.String(), strconv.FormatBool(opts.UsePrefix)}, opts.Paths...), "\x00"))
+	return hex.EncodeToString(h.Sum(nil)) + "." + opts.Format.String()
+}
+
+// WriteArchive writes the archive of the tree of commitID to target, like Repository.CreateArchiveWithOptions.
+// The archive is generated on the first request and served from the cache afterwards.
+// A failed generation is reported to all requests waiting for it and retried by the next request.
+func (c *ArchiveCache) WriteArchive(ctx context.Context, repo *Repository, commitID string, target io.Writer, opts ArchiveOptions) error {
+	// branch and tag names move, the cache is keyed by the commit they point to
+	id, err := repo.resolveCommitID(commitID)
+	if err != nil {
+		return err
+	}
+	f, err := c.open(ctx, archiveCacheKey(repo.Path, id, opts), func(ctx context.Context, w io.Writer) error {
+		return repo.CreateArchiveWithOptions(ctx, id, w, opts)
+	})
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(target, f)
+	return err
+}
+
+// open opens the cached archive of the key, generating it if it isn't cached yet.
+// The generation runs with the values of ctx but isn't canceled with it, a request only stops waiting once its ctx is done.
+func (c *ArchiveCache) open(ctx context.Context, key string, generate func(ctx context.Context, w io.Writer) error) (*os.File, error) {
+	generated := false
+	for {
+		c.mu.Lock()
+		if entry, ok := c.entries[key]; ok {
+			if c.expired(entry) {
+				c.removeLocked(key)
+			} else if f, err := os.Open(entry.path); err == nil {
+				entry.lastUsed = c.now()
+				if generated {
+					// evict after opening, the archive is still served if it alone exceeds the size limit
+					c.evictLocked()
+				}
+				c.mu.Unlock()
+				return f, nil
+			} else {
+				// removed behind the back of the cache
+				delete(c.entries, key)
+			}
+		}
+		call, ok := c.calls[key]
+		if !ok {
+			call = &archiveCall{done: make(chan struct{})}
+			c.calls[key] = call
+			go c.generate(detachedContext{ctx}, key, call, generate)
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if call.err != nil {
+			return nil, call.err
+		}
+		generated = true
+	}
+}
+
+// generate runs the generation of the call with its own timeout and reports the result to the waiting requests
+func (c *ArchiveCache) generate(ctx context.Context, key string, call *archiveCall, generate func(ctx context.Context, w io.Writer) error) {
+	timeout := c.opts.Timeout
+	if timeout <= 0 {
+		timeout = defaultCommandExecutionTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := c.store(ctx, key, generate)
+	c.mu.Lock()
+	delete(c.calls, key)
+	c.mu.Unlock()
+	call.err = err
+	close(call.done)
+}
+
+// store writes the archive of the key into the cache
+func (c *ArchiveCache) store(ctx context.Context, key string, generate func(ctx context.Context, w io.Writer) error) error {
+	tmp, err := os.CreateTemp(c.opts.Dir, "archive-*.tmp")
+	if err != nil {
+		return err
+	}
+	err = generate(ctx, tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = util.Remove(tmp.Name())
+		return err
+	}
+
+	path := filepath.Join(c.opts.Dir, key)
+	if err := util.Rename(tmp.Name(), path); err != nil {
+		_ = util.Remove(tmp.Name())
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	c.entries[key] = &archiveCacheEntry{path: path, size: info.Size(), created: now, lastUsed: now}
+	return nil
+}
+
+// detachedContext keeps the values of a context without its cancellation and deadline
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+func (c *ArchiveCache) expired(entry *archiveCacheEntry) bool {
+	return c.opts.TTL > 0 && c.now().Sub(entry.created) > c.opts.TTL
+}
+
+func (c *ArchiveCache) removeLocked(key string) {
+	_ = util.Remove(c.entries[key].path)
+	delete(c.entries, key)
+}
+
+// Evict removes the expired archives and the least recently used archives exceeding the size limit
+func (c *ArchiveCache) Evict() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.evictLocked()
+}
+
+func (c *ArchiveCache) evictLocked() {
+	var size int64
+	keys := make([]string, 0, len(c.entries))
+	for key, entry := range c.entries {
+		if c.expired(entry) {
+			c.removeLocked(key)
+			continue
+		}
+		size += entry.size
+		keys = append(keys, key)
+	}
+	if c.opts.MaxSize <= 0 || size <= c.opts.MaxSize {
+		return
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return c.entries[keys[i]].lastUsed.Before(c.entries[keys[j]].lastUsed)
+	})
+	for _, key := range keys {
+		if size <= c.opts.MaxSize {
+			break
+		}
+		size -= c.entries[key].size
+		c.removeLocked(key)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchiveCache_WriteArchive(t *testing.T) {
+	repo, err := openRepositoryWithDefaultContext(filepath.Join(testReposDir, "repo1_bare"))
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	dir := t.TempDir()
+	cache, err := NewArchiveCache(ArchiveCacheOptions{Dir: dir})
+	assert.NoError(t, err)
+
+	opts := ArchiveOptions{Format: TARGZ, Paths: []string{"foo"}}
+	var expected bytes.Buffer
+	assert.NoError(t, repo.CreateArchiveWithOptions(DefaultContext, "feaf4ba6bc635fec442f46ddd4512416ec43c2c2", &expected, opts))
+
+	// the branch and the commit it points to share the archive
+	for _, rev := range []string{"master", "feaf4ba6bc635fec442f46ddd4512416ec43c2c2"} {
+		var archive bytes.Buffer
+		assert.NoError(t, cache.WriteArchive(DefaultContext, repo, rev, &archive, opts))
+		assert.Equal(t, expected.Bytes(), archive.Bytes())
+	}
+	files, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	var archive bytes.Buffer
+	assert.NoError(t, cache.WriteArchive(DefaultContext, repo, "master", &archive, ArchiveOptions{Format: ZIP}))
+	files, err = os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	// a new cache reuses the stored archives
+	cache, err = NewArchiveCache(ArchiveCacheOptions{Dir: dir})
+	assert.NoError(t, err)
+	assert.Len(t, cache.entries, 2)
+
+	assert.True(t, IsErrNotExist(cache.WriteArchive(DefaultContext, repo, "missing", io.Discard, opts)))
+}
+
+func TestArchiveCache_open(t *testing.T) {
+	cache, err := NewArchiveCache(ArchiveCacheOptions{Dir: t.TempDir(), TTL: time.Hour, MaxSize: 15})
+	assert.NoError(t, err)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	var generated int32
+	generate := func(content string) func(ctx context.Context, w io.Writer) error {
+		return func(ctx context.Context, w io.Writer) error {
+			atomic.AddInt32(&generated, 1)
+			time.Sleep(10 * time.Millisecond)
+			_, err := io.WriteString(w, content)
+			return err
+		}
+	}
+	read := func(key, content string) string {
+		f, err := cache.open(DefaultContext, key, generate(content))
+		if !assert.NoError(t, err) {
+			return ""
+		}
+		defer f.Close()
+		data, err := io.ReadAll(f)
+		assert.NoError(t, err)
+		return string(data)
+	}
+
+	// concurrent requests share a single generation
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Equal(t, "aaaaaaaaaa", read("a", "aaaaaaaaaa"))
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, 1, atomic.LoadInt32(&generated))
+
+	// b exceeds the size limit together with a, which is evicted as least recently used
+	now = now.Add(time.Minute)
+	assert.Equal(t, "bbbbbbbbbb", read("b", "bbbbbbbbbb"))
+	assert.EqualValues(t, 2, atomic.LoadInt32(&generated))
+	assert.NotContains(t, cache.entries, "a")
+	assert.Equal(t, "bbbbbbbbbb", read("b", "changed"))
+	assert.EqualValues(t, 2, atomic.LoadInt32(&generated))
+
+	now = now.Add(2 * time.Hour)
+	assert.Equal(t, "changed", read("b", "changed"))
+	assert.EqualValues(t, 3, atomic.LoadInt32(&generated))
+
+	// a request giving up doesn't cancel the generation others wait for
+	started, release := make(chan struct{}), make(chan struct{})
+	ctx, cancel := context.WithCancel(DefaultContext)
+	go func() {
+		<-started
+		cancel()
+	}()
+	_, err = cache.open(ctx, "d", func(ctx context.Context, w io.Writer) error {
+		close(started)
+		<-release
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		_, err := io.WriteString(w, "d")
+		return err
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	close(release)
+	assert.Equal(t, "d", read("d", "other"))
+
+	// a failed generation is not cached
+	_, err = cache.open(DefaultContext, "c", func(ctx context.Context, w io.Writer) error { return os.ErrPermission })
+	assert.ErrorIs(t, err, os.ErrPermission)
+	assert.Equal(t, "c", read("c", "c"))
+	files, err := os.ReadDir(cache.opts.Dir)
+	assert.NoError(t, err)
+	for _, file := range files {
+		assert.False(t, strings.HasSuffix(file.Name(), ".tmp"))
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"sync"
+	"time"
+)
+
+// CommandEvent describes a git command that ran, it is passed to the functions registered with OnCommand
+type CommandEvent struct {
+	// Name is the git executable
+	Name string
+	// Args are the arguments without the global ones, credentials in urls are removed
+	Args []string
+	// Dir is the directory the command ran in, usually the repository path
+	Dir      string
+	Duration time.Duration
+	// ExitCode is the exit status of git, -1 if it didn't exit, e.g. failed to start or was killed
+	ExitCode int
+	// StderrSize is the number of bytes git wrote to stderr
+	StderrSize int64
+	// Err is the error Command.Run returns
+	Err error
+}
+
+// eventHooks are the functions registered to receive events of type E
+type eventHooks[E any] struct {
+	sync.RWMutex
+	lastID int
+	fns    []hook[E]
+}
+
+type hook[E any] struct {
+	id int
+	fn func(E)
+}
+
+func (h *eventHooks[E]) add(fn func(E)) (unregister func()) {
+	h.Lock()
+	defer h.Unlock()
+	h.lastID++
+	id := h.lastID
+	h.fns = append(h.fns, hook[E]{id: id, fn: fn})
+
+	return func() {
+		h.Lock()
+		defer h.Unlock()
+		for i, hook := range h.fns {
+			if hook.id == id {
+				// copy so notify can range over the slice it got without the lock
+				h.fns = append(h.fns[:i:i], h.fns[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func (h *eventHooks[E]) has() bool {
+	h.RLock()
+	defer h.RUnlock()
+	return len(h.fns) > 0
+}
+
+func (h *eventHooks[E]) notify(event E) {
+	h.RLock()
+	fns := h.fns
+	h.RUnlock()
+	for _, hook := range fns {
+		hook.fn(event)
+	}
+}
+
+var commandHooks eventHooks[CommandEvent]
+
+// OnCommand registers fn to receive every git command run, e.g. to keep an audit trail of repository mutations.
+// fn is called synchronously once a command finished, the returned function unregisters it.
+func OnCommand(fn func(CommandEvent)) (unregister func()) {
+	return commandHooks.add(fn)
+}
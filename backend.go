@@ -0,0 +1,98 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import "fmt"
+
+// Backend is the implementation an operation runs with.
+// Every function reading or writing the repository in-process belongs to one of the Operation values below,
+// so BackendCLI runs the whole package with the git binary, except the functions taking go-git types like
+// GetLastCommitForPaths and CommitNodeIndex. The functions not listed always run git,
+// so BackendGoGit and BackendGit2Go don't make the package usable without the git binary.
+type Backend string
+
+const (
+	// BackendDefault runs an operation with its default implementation,
+	// which may fall back to another backend, e.g. gogit falls back to git for sha256 repositories
+	BackendDefault Backend = ""
+	// BackendCLI runs the git binary
+	BackendCLI Backend = "cli"
+	// BackendGoGit reads the repository in-process with go-git
+	BackendGoGit Backend = "gogit"
+	// BackendGit2Go uses libgit2
+	BackendGit2Go Backend = "git2go"
+)
+
+// ParseBackend parses the name of a backend as used in the settings, an empty name is BackendDefault
+func ParseBackend(name string) (Backend, error) {
+	switch backend := Backend(name); backend {
+	case BackendDefault, BackendCLI, BackendGoGit, BackendGit2Go:
+		return backend, nil
+	}
+	return BackendDefault, fmt.Errorf("unknown git backend %q", name)
+}
+
+// Operation is an operation implemented by more than one backend
+type Operation string
+
+const (
+	// OperationFilesChanged lists or counts the files changed between two commits, supports gogit and cli
+	OperationFilesChanged Operation = "files_changed"
+	// OperationMergeBase finds the merge base of two commits, supports git2go, gogit and cli
+	OperationMergeBase Operation = "merge_base"
+	// OperationRevParse resolves a revision to the full id of the object, supports git2go and cli
+	OperationRevParse Operation = "rev_parse"
+	// OperationIndex reads trees to and writes trees from the index, supports git2go and cli
+	OperationIndex Operation = "index"
+	// OperationCommitTree creates commits from trees, supports git2go and cli
+	OperationCommitTree Operation = "commit_tree"
+	// OperationReferences reads and writes references, e.g. GetRefCommitID, IsBranchExist, GetTags, WalkReferences,
+	// GetRefsFiltered, IsEmpty, SetReference, SetDefaultBranch, CreateTag and CreateAnnotatedTag, supports gogit and cli.
+	// Tags signed by a Signer are always created with gogit as git can't use it.
+	OperationReferences Operation = "references"
+	// OperationObjects reads and writes objects, e.g. IsCommitExist, IsObjectExist, GetTag, GetTagNameBySHA,
+	// LsFiles, HashObject and FindLFSFile, supports gogit and cli
+	OperationObjects Operation = "objects"
+	// OperationHistory finds the last commits of paths for GetCommitsInfo, CacheCommit, GetNote and
+	// the LastCommitCache, gogit walks the commit graph and cli runs git log, supports gogit and cli
+	OperationHistory Operation = "history"
+	// OperationConfig writes the configuration with CreateBranch and AddRemote, supports gogit and cli
+	OperationConfig Operation = "config"
+)
+
+// backendFor returns the backend selected for the operation by Git.Backends or else Git.Backend.
+// BackendDefault is returned if the selected backend doesn't implement the operation.
+func backendFor(op Operation, supported ...Backend) Backend {
+	backend, ok := Git.Backends[op]
+	if !ok {
+		backend = Git.Backend
+	}
+	for _, s := range supported {
+		if s == backend {
+			return backend
+		}
+	}
+	return BackendDefault
+}
+
+// backendFor returns the backend selected for the operation like backendFor, but always BackendCLI
+// for repositories which gogit and libgit2 can't read, both only support the sha1 object format
+func (repo *Repository) backendFor(op Operation, supported ...Backend) Backend {
+	if repo.ObjectFormat() != Sha1ObjectFormat {
+		return BackendCLI
+	}
+	return backendFor(op, supported...)
+}
+
+// useGit2Go is useGit2Go for an operation of the repository, which must be readable by libgit2
+func (repo *Repository) useGit2Go(op Operation) bool {
+	return repo.ObjectFormat() == Sha1ObjectFormat && useGit2Go(op)
+}
+
+// useGit2Go reports whether an operation implemented by git2go and cli runs with libgit2,
+// its default unless BackendCLI is selected or the package is built with the nogit2go tag
+func useGit2Go(op Operation) bool {
+	return hasGit2Go && backendFor(op, BackendGit2Go, BackendCLI) != BackendCLI
+}
@@ -0,0 +1,213 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func setBackends(t *testing.T, backend Backend, backends map[Operation]Backend) {
+	oldBackend, oldBackends := Git.Backend, Git.Backends
+	Git.Backend, Git.Backends = backend, backends
+	t.Cleanup(func() {
+		Git.Backend, Git.Backends = oldBackend, oldBackends
+	})
+}
+
+func TestParseBackend(t *testing.T) {
+	backend, err := ParseBackend("cli")
+	assert.NoError(t, err)
+	assert.Equal(t, BackendCLI, backend)
+
+	backend, err = ParseBackend("")
+	assert.NoError(t, err)
+	assert.Equal(t, BackendDefault, backend)
+
+	_, err = ParseBackend("jgit")
+	assert.Error(t, err)
+}
+
+func TestBackendFor(t *testing.T) {
+	setBackends(t, BackendCLI, map[Operation]Backend{OperationMergeBase: BackendGoGit})
+	assert.Equal(t, BackendGoGit, backendFor(OperationMergeBase, BackendGit2Go, BackendGoGit, BackendCLI))
+	assert.Equal(t, BackendCLI, backendFor(OperationFilesChanged, BackendGoGit, BackendCLI))
+
+	// an unsupported backend uses the default implementation
+	setBackends(t, BackendGit2Go, nil)
+	assert.Equal(t, BackendDefault, backendFor(OperationFilesChanged, BackendGoGit, BackendCLI))
+}
+
+func TestRepository_BackendSelection(t *testing.T) {
+	repo, err := openRepositoryWithDefaultContext(filepath.Join(testReposDir, "repo1_bare"))
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	for _, backend := range []Backend{BackendCLI, BackendGoGit} {
+		t.Run(string(backend), func(t *testing.T) {
+			setBackends(t, backend, nil)
+
+			base, err := repo.GetMergeBase("", "master", "branch2")
+			assert.NoError(t, err)
+			assert.Equal(t, "8d92fc957a4d7cfd98bc375f0b7bb189a0d6c9f2", base)
+
+			files, err := repo.getFilesChanged("8006ff9adbf0cb94da7dad9e537e53817f9fa5c0", "feaf4ba6bc635fec442f46ddd4512416ec43c2c2")
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"foo/broken_link", "foo/link_short", "foo/outside_repo"}, files)
+
+			count, err := repo.FilesCountBetween("branch2", "master")
+			assert.NoError(t, err)
+			assert.Equal(t, 5, count)
+		})
+	}
+}
+
+func TestRepository_ReferencesBackendSelection(t *testing.T) {
+	for _, backend := range []Backend{BackendCLI, BackendGoGit} {
+		t.Run(string(backend), func(t *testing.T) {
+			setBackends(t, BackendDefault, map[Operation]Backend{OperationReferences: backend, OperationConfig: backend})
+
+			clonedPath, err := cloneRepo(t, filepath.Join(testReposDir, "repo1_bare"))
+			assert.NoError(t, err)
+			repo, err := openRepositoryWithDefaultContext(clonedPath)
+			assert.NoError(t, err)
+			defer repo.Close()
+
+			const commitID = "95bb4d39648ee7e325106df01a621c530863a653"
+			assert.NoError(t, repo.SetReference("refs/heads/selected", commitID))
+			id, err := repo.GetRefCommitID("refs/heads/selected")
+			assert.NoError(t, err)
+			assert.Equal(t, commitID, id)
+			assert.NoError(t, repo.RemoveReference("refs/heads/selected"))
+			assert.False(t, repo.IsReferenceExist("refs/heads/selected"))
+
+			assert.NoError(t, repo.CreateTag("selected", commitID))
+			id, err = repo.GetRefCommitID(TagPrefix + "selected")
+			assert.NoError(t, err)
+			assert.Equal(t, commitID, id)
+			assert.Error(t, repo.CreateTag("selected", commitID))
+
+			assert.NoError(t, repo.SetDefaultBranch("default"))
+			id, err = repo.GetRefCommitID("refs/heads/default")
+			assert.NoError(t, err)
+			assert.Equal(t, "feaf4ba6bc635fec442f46ddd4512416ec43c2c2", id)
+
+			assert.NoError(t, repo.CreateBranch("tracking", "refs/heads/master"))
+			assert.ErrorIs(t, repo.CreateBranch("tracking", "refs/heads/master"), gogit.ErrBranchExists)
+			assert.Equal(t, "refs/heads/master", repo.signingConfig("branch.tracking.merge"))
+			assert.NoError(t, repo.AddRemote("upstream", "https://example.com/repo.git", false))
+			assert.Equal(t, "https://example.com/repo.git", repo.signingConfig("remote.upstream.url"))
+		})
+	}
+}
+
+func TestRepository_ReadersBackendSelection(t *testing.T) {
+	repo, err := openRepositoryWithDefaultContext(filepath.Join(testReposDir, "repo1_bare"))
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	for _, backend := range []Backend{BackendCLI, BackendGoGit} {
+		t.Run(string(backend), func(t *testing.T) {
+			setBackends(t, backend, nil)
+
+			id, err := repo.GetRefCommitID("refs/heads/master")
+			assert.NoError(t, err)
+			assert.Equal(t, "feaf4ba6bc635fec442f46ddd4512416ec43c2c2", id)
+			_, err = repo.GetRefCommitID("refs/heads/master/sub")
+			assert.True(t, IsErrNotExist(err))
+			assert.True(t, repo.IsBranchExist("master"))
+			assert.False(t, repo.IsBranchExist("mast"))
+			assert.True(t, repo.IsTagExist("test"))
+			assert.True(t, repo.IsCommitExist("feaf4ba6bc635fec442f46ddd4512416ec43c2c2"))
+			assert.False(t, repo.IsCommitExist("3ad28a9149a2864384548f3d17ed7f38014c9e8a"))
+			assert.True(t, repo.IsObjectExist("branch1"))
+
+			empty, err := repo.IsEmpty()
+			assert.NoError(t, err)
+			assert.False(t, empty)
+
+			tags, err := repo.GetTags(0, 0)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"test"}, tags)
+			name, err := repo.GetTagNameBySHA("3ad28a9149a2864384548f3d17ed7f38014c9e8a")
+			assert.NoError(t, err)
+			assert.Equal(t, "test", name)
+			tag, err := repo.GetTag("test")
+			assert.NoError(t, err)
+			assert.Equal(t, "3ad28a9149a2864384548f3d17ed7f38014c9e8a", tag.ID.String())
+			assert.Equal(t, "37991dec2c8e592043f47155ce4808d4580f9123", tag.Object.String())
+			assert.Equal(t, "tag", tag.Type)
+
+			var names []string
+			count, err := repo.WalkReferences(ObjectBranch, 1, 1, func(_, name string) error {
+				names = append(names, name)
+				return nil
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, 2, count)
+			assert.Equal(t, []string{"refs/heads/branch2"}, names)
+			refs, err := repo.GetRefsBySha("feaf4ba6bc635fec442f46ddd4512416ec43c2c2", BranchPrefix)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"refs/heads/master"}, refs)
+
+			files, err := repo.LsFiles("file1.txt", "missing.txt")
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"file1.txt"}, files)
+		})
+	}
+}
+
+func TestRepository_IndexAndCommitTreeWithGit(t *testing.T) {
+	setBackends(t, BackendCLI, nil)
+
+	clonedPath, err := cloneRepo(t, filepath.Join(testReposDir, "repo1_bare"))
+	assert.NoError(t, err)
+	repo, err := openRepositoryWithDefaultContext(clonedPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	assert.NoError(t, repo.ReadTreeToIndex("master", ""))
+	blobID, err := repo.HashObject(strings.NewReader("new file\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, repo.AddObjectToIndex("100644", blobID, "dir/new.txt"))
+	assert.NoError(t, repo.RemoveFilesFromIndex("file1.txt"))
+	tree, err := repo.WriteTree()
+	assert.NoError(t, err)
+
+	sig := &Signature{Name: "Tester", Email: "tester@example.com", When: time.Now()}
+	id, err := repo.CommitTree(sig, sig, tree, CommitTreeOpts{
+		Parents:   []string{"master"},
+		Message:   "add new file",
+		Ref:       "refs/heads/master",
+		NoGPGSign: true,
+	})
+	assert.NoError(t, err)
+	head, err := repo.GetRefCommitID("refs/heads/master")
+	assert.NoError(t, err)
+	assert.Equal(t, id.String(), head)
+
+	files, err := repo.LsTree("master", "dir/new.txt", "file1.txt", "file2.txt")
+	assert.NoError(t, err)
+	assert.Contains(t, files, "dir/new.txt")
+	assert.Contains(t, files, "file2.txt")
+	assert.NotContains(t, files, "file1.txt")
+}
+
+func TestRepository_GetMergeBaseUnrelated(t *testing.T) {
+	repo, err := openRepositoryWithDefaultContext(filepath.Join(testReposDir, "repo1_bare"))
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	for _, backend := range []Backend{BackendCLI, BackendGoGit} {
+		setBackends(t, backend, nil)
+		_, err := repo.GetMergeBase("", "master", "refs/notes/commits")
+		assert.ErrorIs(t, err, ErrNoMergeBase, backend)
+	}
+}
@@ -12,6 +12,9 @@ import (
 	"os"
 	"os/exec"
 	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/enverbisevac/gitlib/process"
 )
@@ -32,7 +35,8 @@ type BlameReader struct {
 	finished process.FinishedFunc // Tells the process manager we're finished and it can remove the associated process from the process table
 }
 
-var shaLineRegex = regexp.MustCompile("^([a-z0-9]{40})")
+// shaLineRegex matches the sha256 or sha1 id at the start of a line
+var shaLineRegex = regexp.MustCompile("^([a-z0-9]{64}|[a-z0-9]{40})")
 
 // NextPart returns next part of blame (sequential code lines with the same commit)
 func (r *BlameReader) NextPart() (*BlamePart, error) {
@@ -148,3 +152,144 @@ func createBlameReader(ctx context.Context, dir string, command ...string) (*Bla
 		finished: finished,
 	}, nil
 }
+
+// BlameCommit represents the commit information reported by git blame
+type BlameCommit struct {
+	ID        ObjectID
+	Author    *Signature
+	Committer *Signature
+	Summary   string
+	// PreviousID and PreviousPath point to the parent commit and file name the lines came from,
+	// they are empty for boundary commits
+	PreviousID   string
+	PreviousPath string
+	Boundary     bool
+}
+
+// BlameHunk represents continuous lines of the final file last changed by the same commit
+type BlameHunk struct {
+	Commit   *BlameCommit
+	Filename string
+	// StartLine is the first line of the hunk in the final file,
+	// OrigStartLine the first line in the file of the blamed commit
+	StartLine     int
+	OrigStartLine int
+	Lines         []string
+}
+
+// parseBlamePorcelain reads the output of `git blame --porcelain` and calls fn for every hunk once it is complete
+func parseBlamePorcelain(rd *bufio.Reader, objectFormat ObjectFormat, fn func(*BlameHunk) error) error {
+	commits := make(map[string]*BlameCommit)
+	var (
+		commit *BlameCommit
+		hunk   *BlameHunk
+	)
+
+	for {
+		line, err := rd.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if len(line) == 0 && err == io.EOF {
+			break
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		if len(line) > 0 && line[0] == '\t' {
+			if hunk == nil {
+				return fmt.Errorf("unexpected blame content line: %s", line)
+			}
+			hunk.Lines = append(hunk.Lines, line[1:])
+		} else if key, value, _ := strings.Cut(line, " "); len(key) == objectFormat.FullLength() && objectFormat.IsValid(key) {
+			// <sha> <orig line> <final line> [<lines in group>]
+			fields := strings.Fields(value)
+			if len(fields) < 2 {
+				return fmt.Errorf("invalid blame header: %s", line)
+			}
+			origLine, err1 := strconv.Atoi(fields[0])
+			finalLine, err2 := strconv.Atoi(fields[1])
+			if err1 != nil || err2 != nil {
+				return fmt.Errorf("invalid blame header: %s", line)
+			}
+
+			commit = commits[key]
+			if commit == nil {
+				id, err := objectFormat.NewIDFromString(key)
+				if err != nil {
+					return err
+				}
+				commit = &BlameCommit{ID: id}
+				commits[key] = commit
+			}
+
+			// git splits the lines of a commit into several groups, join them while they are continuous
+			if hunk != nil && hunk.Commit == commit && hunk.StartLine+len(hunk.Lines) == finalLine {
+				continue
+			}
+			if hunk != nil {
+				if err := fn(hunk); err != nil {
+					return err
+				}
+			}
+			hunk = &BlameHunk{
+				Commit:        commit,
+				StartLine:     finalLine,
+				OrigStartLine: origLine,
+			}
+		} else if commit != nil {
+			parseBlameHeaderLine(commit, hunk, key, value)
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	if hunk != nil {
+		return fn(hunk)
+	}
+	return nil
+}
+
+// parseBlameHeaderLine fills the commit and hunk with the information of a porcelain "key value" line
+func parseBlameHeaderLine(commit *BlameCommit, hunk *BlameHunk, key, value string) {
+	switch key {
+	case "author", "committer":
+		sig := &Signature{Name: value}
+		if key == "author" {
+			commit.Author = sig
+		} else {
+			commit.Committer = sig
+		}
+	case "author-mail", "committer-mail", "author-time", "committer-time", "author-tz", "committer-tz":
+		who, field, _ := strings.Cut(key, "-")
+		sig := commit.Author
+		if who == "committer" {
+			sig = commit.Committer
+		}
+		if sig == nil {
+			return
+		}
+		switch field {
+		case "mail":
+			sig.Email = strings.TrimSuffix(strings.TrimPrefix(value, "<"), ">")
+		case "time":
+			seconds, _ := strconv.ParseInt(value, 10, 64)
+			sig.When = time.Unix(seconds, 0)
+		case "tz":
+			if tz, err := time.Parse("-0700", value); err == nil {
+				sig.When = sig.When.In(tz.Location())
+			}
+		}
+	case "summary":
+		commit.Summary = value
+	case "previous":
+		commit.PreviousID, commit.PreviousPath, _ = strings.Cut(value, " ")
+	case "boundary":
+		commit.Boundary = true
+	case "filename":
+		if hunk != nil && hunk.Filename == "" {
+			hunk.Filename = value
+		}
+	}
+}
@@ -5,8 +5,11 @@
 package git
 
 import (
+	"bufio"
 	"context"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -142,3 +145,90 @@ func TestReadingBlameOutput(t *testing.T) {
 		assert.Equal(t, part, actualPart)
 	}
 }
+
+func TestParseBlamePorcelain(t *testing.T) {
+	var hunks []*BlameHunk
+	err := parseBlamePorcelain(bufio.NewReader(strings.NewReader(exampleBlame)), Sha1ObjectFormat, func(hunk *BlameHunk) error {
+		hunks = append(hunks, hunk)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, hunks, 4)
+
+	hunk := hunks[0]
+	assert.Equal(t, "4b92a6c2df28054ad766bc262f308db9f6066596", hunk.Commit.ID.String())
+	assert.Equal(t, "gogs.go", hunk.Filename)
+	assert.Equal(t, 1, hunk.StartLine)
+	assert.Equal(t, 1, hunk.OrigStartLine)
+	assert.Equal(t, []string{"// Copyright 2014 The Gogs Authors. All rights reserved."}, hunk.Lines)
+	assert.Equal(t, "Unknown", hunk.Commit.Author.Name)
+	assert.Equal(t, "joe2010xtmf@163.com", hunk.Commit.Author.Email)
+	assert.Equal(t, int64(1392833071), hunk.Commit.Author.When.Unix())
+	_, offset := hunk.Commit.Author.When.Zone()
+	assert.Equal(t, -5*60*60, offset)
+	assert.Equal(t, "Add code of delete user", hunk.Commit.Summary)
+	assert.Equal(t, "be0ba9ea88aff8a658d0495d36accf944b74888d", hunk.Commit.PreviousID)
+	assert.Equal(t, "gogs.go", hunk.Commit.PreviousPath)
+
+	// the two groups of the same commit are joined and share the commit information
+	hunk = hunks[2]
+	assert.Same(t, hunks[0].Commit, hunk.Commit)
+	assert.Equal(t, 3, hunk.StartLine)
+	assert.Equal(t, 2, hunk.OrigStartLine)
+	assert.Len(t, hunk.Lines, 3)
+
+	hunk = hunks[3]
+	assert.Equal(t, "Sandro Santilli", hunk.Commit.Committer.Name)
+	assert.Equal(t, 6, hunk.StartLine)
+	assert.Equal(t, []string{
+		"// Gitea (git with a cup of tea) is a painless self-hosted Git Service.",
+		"package main // import \"code.gitea.io/gitea\"",
+	}, hunk.Lines)
+}
+
+func TestParseBlamePorcelainSha256(t *testing.T) {
+	const id = "8d0e1ba1b71a4e0a5e4a1ab1c0e58bf41a2b82fd7afc6a2d5e4b63b5a1e8f6c9"
+	blame := id + ` 1 1 1
+author Tester
+author-mail <tester@example.com>
+author-time 1392833071
+author-tz +0000
+committer Tester
+committer-mail <tester@example.com>
+committer-time 1392833071
+committer-tz +0000
+summary Initial commit
+boundary
+filename README.md
+	# README
+`
+	var hunks []*BlameHunk
+	err := parseBlamePorcelain(bufio.NewReader(strings.NewReader(blame)), Sha256ObjectFormat, func(hunk *BlameHunk) error {
+		hunks = append(hunks, hunk)
+		return nil
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, hunks, 1) {
+		assert.Equal(t, id, hunks[0].Commit.ID.String())
+		assert.Equal(t, []string{"# README"}, hunks[0].Lines)
+	}
+}
+
+func TestRepository_Blame(t *testing.T) {
+	bareRepo1Path := filepath.Join(testReposDir, "repo1_bare")
+	bareRepo1, err := openRepositoryWithDefaultContext(bareRepo1Path)
+	assert.NoError(t, err)
+	defer bareRepo1.Close()
+
+	hunks, err := bareRepo1.Blame(DefaultContext, "master", "file1.txt", BlameOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, hunks, 1)
+	assert.Equal(t, "95bb4d39648ee7e325106df01a621c530863a653", hunks[0].Commit.ID.String())
+	assert.True(t, hunks[0].Commit.Boundary)
+	assert.Equal(t, "Add file1.txt", hunks[0].Commit.Summary)
+	assert.Equal(t, int64(1513750509), hunks[0].Commit.Author.When.Unix())
+	assert.Equal(t, []string{"file1"}, hunks[0].Lines)
+
+	_, err = bareRepo1.Blame(DefaultContext, "master", "does-not-exist.txt", BlameOptions{})
+	assert.Error(t, err)
+}
@@ -12,26 +12,60 @@ import (
 
 	"github.com/enverbisevac/gitlib/typesniffer"
 	"github.com/enverbisevac/gitlib/util"
-	"github.com/go-git/go-git/v5/plumbing"
 )
 
+// blobInMemorySize is the size below which DataAsync reads a blob into memory and releases the process at once
+const blobInMemorySize = 4096
+
 // Blob represents a Git object.
 type Blob struct {
-	ID SHA1
+	ID ObjectID
 
-	obj  plumbing.EncodedObject
+	repo *Repository
+	size int64
 	name string
 }
 
-// DataAsync gets a ReadCloser for the contents of a blob without reading it all.
-// Calling the Close function on the result will discard all unread output.
+// DataAsync gets a ReadCloser for the contents of a blob without reading it all, the content is streamed
+// by a cat-file --batch process of the repository. The process is returned to the pool as soon as the content
+// has been read, small blobs are read into memory right away. Calling the Close function on the result
+// discards all unread output and has to be done before the next object is read in the same goroutine.
 func (b *Blob) DataAsync() (io.ReadCloser, error) {
-	return b.obj.Reader()
+	wr, rd, cancel, err := b.repo.CatFileBatch(b.repo.catFile.ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := wr.Write([]byte(b.ID.String() + "\n")); err != nil {
+		stopOnReadError(wr, err)
+		cancel()
+		return nil, err
+	}
+	_, _, size, err := ReadBatchLine(rd)
+	if err != nil {
+		stopOnReadError(wr, err)
+		cancel()
+		return nil, err
+	}
+
+	if size < blobInMemorySize {
+		bs, err := io.ReadAll(io.LimitReader(rd, size))
+		if err == nil {
+			// the content is followed by a LF
+			_, err = rd.Discard(1)
+		}
+		stopOnReadError(wr, err)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(bytes.NewReader(bs)), nil
+	}
+	return &blobReader{wr: wr, rd: rd, n: size, cancel: cancel}, nil
 }
 
 // Size returns the uncompressed size of the blob
 func (b *Blob) Size() int64 {
-	return b.obj.Size()
+	return b.size
 }
 
 // Name returns name of the tree entry this blob object was created from (or empty string)
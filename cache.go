@@ -1,13 +1,16 @@
 package git
 
 import (
-	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/enverbisevac/gitlib/log"
 )
 
 // Cache represents a caching interface
 type Cache interface {
-	// Put puts value into cache with key and expire time.
-	Put(key string, val any, timeout int64) error
+	// Put puts value into cache with key, it expires after timeout, never if timeout is not positive.
+	Put(key string, val any, timeout time.Duration) error
 	// Get gets cached value by given key.
 	Get(key string) any
 	// IsExist checks if key exists
@@ -15,6 +18,15 @@ type Cache interface {
 	Delete(key string) error
 }
 
+// CacheSchemaVersion is part of the cache keys, it is increased when the shape of cached values changes
+// so that values cached by an older version are not read
+const CacheSchemaVersion = 1
+
+// CacheKey returns key namespaced by CacheService.Cache.Prefix and CacheSchemaVersion
+func CacheKey(key string) string {
+	return CacheService.Cache.Prefix + "v" + strconv.Itoa(CacheSchemaVersion) + ":" + key
+}
+
 var lcache Cache
 
 func Initialize(c Cache) {
@@ -26,37 +38,48 @@ func GetCache() Cache {
 	return lcache
 }
 
-// Get returns the key value from cache with callback when no key exists in cache
+// Get returns the key value from cache with callback when no key exists in cache.
+// The value is stored with the key namespaced by CacheKey by a TypedCache, so that it is returned
+// with its type from remote caches. A cached value which can't be decoded is removed and treated as a miss.
 func Get[T any](key string, getFunc func() (T, error)) (T, error) {
-	var (
-		empty T
-	)
-
 	if lcache == nil || CacheService.Cache.TTL == 0 {
 		return getFunc()
 	}
 
-	if !lcache.IsExist(key) {
-		value, err := getFunc()
-		if err != nil {
-			return value, err
-		}
-		err = lcache.Put(key, value, CacheService.Cache.TTL.Milliseconds())
-		if err != nil {
-			return empty, err
-		}
+	key = CacheKey(key)
+	c := NewTypedCache[T](lcache, nil)
+	start := time.Now()
+	value, ok, err := c.Get(key)
+	notifyCache(CacheValues, CacheGet, start, ok, err)
+	if ok {
+		return value, nil
+	}
+	if err != nil {
+		log.Error("Unable to read cached value %s, it is replaced: %v", key, err)
+		start = time.Now()
+		err = lcache.Delete(key)
+		notifyCache(CacheValues, CacheDelete, start, false, err)
+	}
+	value, err = getFunc()
+	if err != nil {
+		return value, err
 	}
-	value := lcache.Get(key)
-	if v, ok := value.(T); ok {
-		return v, nil
+	start = time.Now()
+	err = c.Put(key, value, CacheService.Cache.TTL)
+	notifyCache(CacheValues, CachePut, start, false, err)
+	if err != nil {
+		var empty T
+		return empty, err
 	}
-	return empty, fmt.Errorf("unsupported cached value type: %v", value)
+	return value, nil
 }
 
-// Remove key from cache
+// Remove key, which is namespaced by CacheKey, from cache
 func Remove(key string) {
 	if lcache == nil {
 		return
 	}
-	_ = lcache.Delete(key)
+	start := time.Now()
+	err := lcache.Delete(CacheKey(key))
+	notifyCache(CacheValues, CacheDelete, start, false, err)
 }
@@ -0,0 +1,85 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package cache holds what the remote implementations of the git.Cache interface share.
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// ErrUnsupportedValue is returned when encoding a value of a type a remote cache can't store
+var ErrUnsupportedValue = errors.New("unsupported cache value")
+
+// value types, the first byte of an encoded value
+const (
+	typeString  = 's'
+	typeBytes   = 'y'
+	typeInt     = 'i'
+	typeInt64   = 'I'
+	typeUint64  = 'U'
+	typeBool    = 'b'
+	typeFloat64 = 'f'
+)
+
+// Encode serializes a cached value, like a commit ID or a count, so that Decode returns it with the same type.
+// Strings, byte slices, int, int64, uint64, bool and float64 values are supported.
+func Encode(val any) ([]byte, error) {
+	switch v := val.(type) {
+	case string:
+		return append([]byte{typeString}, v...), nil
+	case []byte:
+		return append([]byte{typeBytes}, v...), nil
+	case int:
+		return strconv.AppendInt([]byte{typeInt}, int64(v), 10), nil
+	case int64:
+		return strconv.AppendInt([]byte{typeInt64}, v, 10), nil
+	case uint64:
+		return strconv.AppendUint([]byte{typeUint64}, v, 10), nil
+	case bool:
+		return strconv.AppendBool([]byte{typeBool}, v), nil
+	case float64:
+		return strconv.AppendUint([]byte{typeFloat64}, math.Float64bits(v), 16), nil
+	}
+	return nil, fmt.Errorf("%w: %T", ErrUnsupportedValue, val)
+}
+
+// Supported reports whether Encode can serialize val
+func Supported(val any) bool {
+	switch val.(type) {
+	case string, []byte, int, int64, uint64, bool, float64:
+		return true
+	}
+	return false
+}
+
+// Decode deserializes a value serialized by Encode
+func Decode(data []byte) (any, error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty cache value")
+	}
+	payload := string(data[1:])
+	switch data[0] {
+	case typeString:
+		return payload, nil
+	case typeBytes:
+		return []byte(payload), nil
+	case typeInt:
+		v, err := strconv.ParseInt(payload, 10, strconv.IntSize)
+		return int(v), err
+	case typeInt64:
+		return strconv.ParseInt(payload, 10, 64)
+	case typeUint64:
+		return strconv.ParseUint(payload, 10, 64)
+	case typeBool:
+		return strconv.ParseBool(payload)
+	case typeFloat64:
+		bits, err := strconv.ParseUint(payload, 16, 64)
+		return math.Float64frombits(bits), err
+	}
+	return nil, fmt.Errorf("unknown cache value type %q", data[0])
+}
@@ -0,0 +1,35 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	for _, val := range []any{
+		"feaf4ba6bc635fec442f46ddd4512416ec43c2c2",
+		"",
+		[]byte("raw"),
+		42,
+		int64(-7),
+		uint64(1 << 63),
+		true,
+		1.5,
+	} {
+		data, err := Encode(val)
+		assert.NoError(t, err)
+		decoded, err := Decode(data)
+		assert.NoError(t, err)
+		assert.Equal(t, val, decoded)
+	}
+
+	_, err := Encode(struct{}{})
+	assert.ErrorIs(t, err, ErrUnsupportedValue)
+	_, err = Decode([]byte("x1"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,159 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package memcache implements the git.Cache interface with memcached, so that several nodes share the cached
+// last commits and commit counts.
+package memcache
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/enverbisevac/gitlib/cache"
+)
+
+// maxRelativeExpiration is the longest expiration memcached accepts in seconds, longer ones are unix timestamps
+const maxRelativeExpiration = 30 * 24 * 60 * 60
+
+// ErrMalformedKey is returned for keys memcached doesn't accept, longer than 250 bytes or with spaces or control characters
+var ErrMalformedKey = memcache.ErrMalformedKey
+
+// Options configures a Cache
+type Options struct {
+	// Addrs are the host:port of the servers, the keys are distributed among them
+	Addrs []string
+	// Prefix is prepended to every key, so that several applications can share the servers
+	Prefix string
+	// PoolSize is the maximum number of idle connections per server, 10 if zero
+	PoolSize int
+	// DialTimeout limits connecting to a server, 5s if zero. The connection is limited by Timeout as well.
+	DialTimeout time.Duration
+	// Timeout limits every operation, 3s if zero
+	Timeout time.Duration
+}
+
+// Cache stores the values in memcached, a failing server is treated as a cache miss by Get and IsExist
+type Cache struct {
+	prefix string
+	client *memcache.Client
+}
+
+// New creates a cache, connections are opened when needed
+func New(opts Options) (*Cache, error) {
+	if len(opts.Addrs) == 0 {
+		return nil, errors.New("no memcache servers")
+	}
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = 10
+	}
+	if opts.DialTimeout <= 0 {
+		opts.DialTimeout = 5 * time.Second
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 3 * time.Second
+	}
+	client := memcache.New(opts.Addrs...)
+	client.MaxIdleConns = opts.PoolSize
+	client.Timeout = opts.Timeout
+	client.DialContext = (&net.Dialer{Timeout: opts.DialTimeout}).DialContext
+	return &Cache{prefix: opts.Prefix, client: client}, nil
+}
+
+// key returns the key stored in memcached, GetMulti of the client fails for all keys if one of them is malformed
+func (c *Cache) key(key string) (string, error) {
+	key = c.prefix + key
+	if len(key) > 250 {
+		return "", ErrMalformedKey
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return "", ErrMalformedKey
+		}
+	}
+	return key, nil
+}
+
+// Put stores val, which has to be supported by cache.Encode, for timeout rounded up to seconds,
+// forever if timeout is not positive
+func (c *Cache) Put(key string, val any, timeout time.Duration) error {
+	key, err := c.key(key)
+	if err != nil {
+		return err
+	}
+	data, err := cache.Encode(val)
+	if err != nil {
+		return err
+	}
+	var expiration int64
+	if timeout > 0 {
+		expiration = int64((timeout + time.Second - 1) / time.Second)
+	}
+	if expiration > maxRelativeExpiration {
+		expiration += time.Now().Unix()
+	}
+	return c.client.Set(&memcache.Item{Key: key, Value: data, Expiration: int32(expiration)})
+}
+
+// Get returns the value stored for key, nil if there is none
+func (c *Cache) Get(key string) any {
+	return c.GetMulti(key)[0]
+}
+
+// GetMulti returns the values stored for keys with a single round trip per server, nil for the keys without a value.
+// A value which can't be decoded is a miss as well.
+func (c *Cache) GetMulti(keys ...string) []any {
+	values := make([]any, len(keys))
+	indexes := make(map[string][]int, len(keys))
+	validKeys := make([]string, 0, len(keys))
+	for i, key := range keys {
+		key, err := c.key(key)
+		if err != nil {
+			continue
+		}
+		if _, ok := indexes[key]; !ok {
+			validKeys = append(validKeys, key)
+		}
+		indexes[key] = append(indexes[key], i)
+	}
+	if len(validKeys) == 0 {
+		return values
+	}
+
+	// the items of the servers which replied are returned together with the error of a failing one
+	items, _ := c.client.GetMulti(validKeys)
+	for key, item := range items {
+		value, err := cache.Decode(item.Value)
+		if err != nil {
+			continue
+		}
+		for _, i := range indexes[key] {
+			values[i] = value
+		}
+	}
+	return values
+}
+
+// IsExist reports whether there is a value stored for key
+func (c *Cache) IsExist(key string) bool {
+	return c.Get(key) != nil
+}
+
+// Delete removes the value stored for key
+func (c *Cache) Delete(key string) error {
+	key, err := c.key(key)
+	if err != nil {
+		return err
+	}
+	if err := c.client.Delete(key); err != nil && !errors.Is(err, memcache.ErrCacheMiss) {
+		return err
+	}
+	return nil
+}
+
+// Close closes the connections to the servers
+func (c *Cache) Close() error {
+	return c.client.Close()
+}
@@ -0,0 +1,158 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package memcache
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeServer understands the few commands the cache sends
+type fakeServer struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	values   map[string][]byte
+	exptimes map[string]int64
+	conns    int
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	s := &fakeServer{listener: listener, values: map[string][]byte{}, exptimes: map[string]int64{}}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns++
+			s.mu.Unlock()
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r, w := bufio.NewReader(conn), bufio.NewWriter(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		s.mu.Lock()
+		switch fields[0] {
+		case "set":
+			size, _ := strconv.Atoi(fields[4])
+			data := make([]byte, size+2)
+			if _, err := io.ReadFull(r, data); err != nil {
+				s.mu.Unlock()
+				return
+			}
+			s.values[fields[1]] = data[:size]
+			s.exptimes[fields[1]], _ = strconv.ParseInt(fields[3], 10, 64)
+			w.WriteString("STORED\r\n")
+		case "get", "gets":
+			for _, key := range fields[1:] {
+				if value, ok := s.values[key]; ok {
+					w.WriteString("VALUE " + key + " 0 " + strconv.Itoa(len(value)) + "\r\n" + string(value) + "\r\n")
+				}
+			}
+			w.WriteString("END\r\n")
+		case "delete":
+			if _, ok := s.values[fields[1]]; ok {
+				delete(s.values, fields[1])
+				w.WriteString("DELETED\r\n")
+			} else {
+				w.WriteString("NOT_FOUND\r\n")
+			}
+		default:
+			w.WriteString("ERROR\r\n")
+		}
+		s.mu.Unlock()
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	server1, server2 := newFakeServer(t), newFakeServer(t)
+	c, err := New(Options{Addrs: []string{server1.listener.Addr().String(), server2.listener.Addr().String()}, Prefix: "gitlib:"})
+	assert.NoError(t, err)
+	defer c.Close()
+
+	assert.Nil(t, c.Get("missing"))
+	assert.False(t, c.IsExist("missing"))
+
+	keys := []string{"commit", "count", "a", "b", "c", "d"}
+	for i, key := range keys {
+		assert.NoError(t, c.Put(key, int64(i), time.Minute))
+	}
+	assert.NoError(t, c.Put("commit", "feaf4ba6bc635fec442f46ddd4512416ec43c2c2", 0))
+	assert.True(t, c.IsExist("commit"))
+	assert.Equal(t, "feaf4ba6bc635fec442f46ddd4512416ec43c2c2", c.Get("commit"))
+	assert.Equal(t, []any{"feaf4ba6bc635fec442f46ddd4512416ec43c2c2", int64(1), nil, int64(1)}, c.GetMulti("commit", "count", "missing", "count"))
+
+	assert.NoError(t, c.Delete("commit"))
+	assert.NoError(t, c.Delete("commit"))
+	assert.Nil(t, c.Get("commit"))
+
+	assert.ErrorIs(t, c.Put("with space", "value", 0), ErrMalformedKey)
+	assert.ErrorIs(t, c.Put(strings.Repeat("k", 250), "value", 0), ErrMalformedKey)
+	assert.Error(t, c.Put("unsupported", struct{}{}, 0))
+
+	// an expiration beyond 30 days is sent as unix timestamp
+	assert.NoError(t, c.Put("count", int64(1), 60*24*time.Hour))
+
+	// a value written by something else is a miss
+	for _, server := range []*fakeServer{server1, server2} {
+		server.mu.Lock()
+		server.values["gitlib:broken"] = []byte("xbroken")
+		server.mu.Unlock()
+	}
+	assert.Nil(t, c.Get("broken"))
+	assert.Equal(t, []any{nil, int64(1)}, c.GetMulti("broken", "count"))
+	for _, server := range []*fakeServer{server1, server2} {
+		server.mu.Lock()
+		delete(server.values, "gitlib:broken")
+		server.mu.Unlock()
+	}
+
+	server1.mu.Lock()
+	defer server1.mu.Unlock()
+	server2.mu.Lock()
+	defer server2.mu.Unlock()
+	// the keys are prefixed and distributed among the servers, which reuse a connection each
+	assert.NotEmpty(t, server1.values)
+	assert.NotEmpty(t, server2.values)
+	assert.Equal(t, len(keys)-1, len(server1.values)+len(server2.values))
+	assert.Equal(t, 1, server1.conns)
+	assert.Equal(t, 1, server2.conns)
+	exptime, ok := server1.exptimes["gitlib:count"]
+	if !ok {
+		exptime = server2.exptimes["gitlib:count"]
+	}
+	assert.Greater(t, exptime, time.Now().Unix())
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(Options{})
+	assert.Error(t, err)
+}
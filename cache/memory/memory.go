@@ -0,0 +1,121 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package memory implements the git.Cache interface in-process, for deployments without a shared cache:
+//
+//	git.Initialize(memory.New(10000))
+package memory
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// DefaultSize is the number of entries of a cache created with a size of zero
+const DefaultSize = 10000
+
+type entry struct {
+	key     string
+	val     any
+	expires time.Time
+}
+
+// Cache is a size bounded cache, once full the least recently used entry is evicted. It is safe for concurrent use.
+type Cache struct {
+	size int
+	now  func() time.Time
+
+	mu    sync.Mutex
+	order *list.List
+	items map[string]*list.Element
+}
+
+// New creates a cache holding up to size entries, DefaultSize if size is not positive
+func New(size int) *Cache {
+	if size <= 0 {
+		size = DefaultSize
+	}
+	return &Cache{
+		size:  size,
+		now:   time.Now,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// Put stores val for timeout, until it is evicted if timeout is not positive
+func (c *Cache) Put(key string, val any, timeout time.Duration) error {
+	var expires time.Time
+	if timeout > 0 {
+		expires = c.now().Add(timeout)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.items[key]; ok {
+		element.Value = &entry{key: key, val: val, expires: expires}
+		c.order.MoveToFront(element)
+		return nil
+	}
+	c.items[key] = c.order.PushFront(&entry{key: key, val: val, expires: expires})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+	return nil
+}
+
+// Get returns the value stored for key, nil if there is none or it expired
+func (c *Cache) Get(key string) any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element := c.get(key)
+	if element == nil {
+		return nil
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*entry).val
+}
+
+// IsExist reports whether there is a value stored for key which didn't expire
+func (c *Cache) IsExist(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.get(key) != nil
+}
+
+// Delete removes the value stored for key
+func (c *Cache) Delete(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.items[key]; ok {
+		c.remove(element)
+	}
+	return nil
+}
+
+// Len returns the number of entries, including expired ones which were not accessed since
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// get returns the element of key, an expired element is removed. c.mu must be held.
+func (c *Cache) get(key string) *list.Element {
+	element, ok := c.items[key]
+	if !ok {
+		return nil
+	}
+	if expires := element.Value.(*entry).expires; !expires.IsZero() && !c.now().Before(expires) {
+		c.remove(element)
+		return nil
+	}
+	return element
+}
+
+func (c *Cache) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.items, element.Value.(*entry).key)
+}
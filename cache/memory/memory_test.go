@@ -0,0 +1,57 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	c := New(2)
+
+	assert.Nil(t, c.Get("missing"))
+	assert.False(t, c.IsExist("missing"))
+
+	assert.NoError(t, c.Put("commit", "feaf4ba6bc635fec442f46ddd4512416ec43c2c2", 0))
+	assert.NoError(t, c.Put("count", int64(6), 0))
+	assert.Equal(t, "feaf4ba6bc635fec442f46ddd4512416ec43c2c2", c.Get("commit"))
+
+	// count is the least recently used entry
+	assert.NoError(t, c.Put("other", true, 0))
+	assert.Equal(t, 2, c.Len())
+	assert.False(t, c.IsExist("count"))
+	assert.True(t, c.IsExist("commit"))
+	assert.Equal(t, true, c.Get("other"))
+
+	// overwriting doesn't evict
+	assert.NoError(t, c.Put("commit", "8006ff9adbf0cb94da7dad9e537e53817f9fa5c0", 0))
+	assert.Equal(t, 2, c.Len())
+	assert.Equal(t, "8006ff9adbf0cb94da7dad9e537e53817f9fa5c0", c.Get("commit"))
+
+	assert.NoError(t, c.Delete("commit"))
+	assert.NoError(t, c.Delete("commit"))
+	assert.Nil(t, c.Get("commit"))
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestCacheTTL(t *testing.T) {
+	now := time.Now()
+	c := New(0)
+	c.now = func() time.Time { return now }
+
+	assert.NoError(t, c.Put("short", "value", time.Minute))
+	assert.NoError(t, c.Put("forever", "value", 0))
+	now = now.Add(59 * time.Second)
+	assert.True(t, c.IsExist("short"))
+
+	now = now.Add(time.Second)
+	assert.False(t, c.IsExist("short"))
+	assert.Nil(t, c.Get("short"))
+	assert.Equal(t, "value", c.Get("forever"))
+	assert.Equal(t, 1, c.Len())
+}
@@ -0,0 +1,117 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package redis implements the git.Cache interface with Redis, so that several nodes share the cached
+// last commits and commit counts.
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/enverbisevac/gitlib/cache"
+	"github.com/redis/go-redis/v9"
+)
+
+// Options configures a Cache
+type Options struct {
+	// Addr is the host:port of the server
+	Addr     string
+	Password string
+	DB       int
+	// Prefix is prepended to every key, so that several applications can share a database
+	Prefix string
+	// PoolSize is the maximum number of connections, 10 if zero
+	PoolSize int
+	// DialTimeout limits connecting to the server, 5s if zero
+	DialTimeout time.Duration
+	// Timeout limits reading and writing every operation, 3s if zero
+	Timeout time.Duration
+}
+
+// Cache stores the values in Redis, a failing server is treated as a cache miss by Get and IsExist
+type Cache struct {
+	prefix string
+	client *redis.Client
+}
+
+// New creates a cache, connections are opened when needed
+func New(opts Options) *Cache {
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = 10
+	}
+	return &Cache{
+		prefix: opts.Prefix,
+		client: redis.NewClient(&redis.Options{
+			Addr:         opts.Addr,
+			Password:     opts.Password,
+			DB:           opts.DB,
+			PoolSize:     opts.PoolSize,
+			DialTimeout:  opts.DialTimeout,
+			ReadTimeout:  opts.Timeout,
+			WriteTimeout: opts.Timeout,
+		}),
+	}
+}
+
+// Put stores val, which has to be supported by cache.Encode, for timeout, forever if timeout is not positive
+func (c *Cache) Put(key string, val any, timeout time.Duration) error {
+	data, err := cache.Encode(val)
+	if err != nil {
+		return err
+	}
+	if timeout < 0 {
+		timeout = 0
+	}
+	return c.client.Set(context.Background(), c.prefix+key, data, timeout).Err()
+}
+
+// Get returns the value stored for key, nil if there is none
+func (c *Cache) Get(key string) any {
+	return c.GetMulti(key)[0]
+}
+
+// GetMulti returns the values stored for keys with a single MGET, nil for the keys without a value.
+// A value which can't be decoded is a miss as well.
+func (c *Cache) GetMulti(keys ...string) []any {
+	values := make([]any, len(keys))
+	if len(keys) == 0 {
+		return values
+	}
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = c.prefix + key
+	}
+	replies, err := c.client.MGet(context.Background(), prefixed...).Result()
+	if err != nil {
+		return values
+	}
+	for i, reply := range replies {
+		data, ok := reply.(string)
+		if !ok {
+			continue
+		}
+		value, err := cache.Decode([]byte(data))
+		if err != nil {
+			continue
+		}
+		values[i] = value
+	}
+	return values
+}
+
+// IsExist reports whether Get returns a value for key, a value which can't be decoded doesn't exist
+func (c *Cache) IsExist(key string) bool {
+	return c.Get(key) != nil
+}
+
+// Delete removes the value stored for key
+func (c *Cache) Delete(key string) error {
+	return c.client.Del(context.Background(), c.prefix+key).Err()
+}
+
+// Close closes the connections to the server
+func (c *Cache) Close() error {
+	return c.client.Close()
+}
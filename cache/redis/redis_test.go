@@ -0,0 +1,210 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeServer understands the few commands the cache sends
+type fakeServer struct {
+	listener net.Listener
+	password string
+
+	mu       sync.Mutex
+	values   map[string]string
+	expires  map[string]time.Time
+	conns    int
+	commands [][]string
+}
+
+func newFakeServer(t *testing.T, password string) *fakeServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	s := &fakeServer{listener: listener, password: password, values: map[string]string{}, expires: map[string]time.Time{}}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns++
+			s.mu.Unlock()
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r, w := bufio.NewReader(conn), bufio.NewWriter(conn)
+	authenticated := s.password == ""
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.commands = append(s.commands, args)
+		switch cmd := strings.ToUpper(args[0]); {
+		case cmd == "AUTH":
+			authenticated = args[1] == s.password
+			if authenticated {
+				w.WriteString("+OK\r\n")
+			} else {
+				w.WriteString("-WRONGPASS invalid password\r\n")
+			}
+		case !authenticated:
+			w.WriteString("-NOAUTH Authentication required.\r\n")
+		case cmd == "SELECT":
+			w.WriteString("+OK\r\n")
+		case cmd == "SET":
+			s.values[args[1]] = args[2]
+			delete(s.expires, args[1])
+			if len(args) == 5 {
+				seconds, _ := strconv.Atoi(args[4])
+				if strings.ToUpper(args[3]) == "PX" {
+					seconds /= 1000
+				}
+				s.expires[args[1]] = time.Now().Add(time.Duration(seconds) * time.Second)
+			}
+			w.WriteString("+OK\r\n")
+		case cmd == "GET":
+			s.writeValue(w, args[1])
+		case cmd == "MGET":
+			w.WriteString("*" + strconv.Itoa(len(args)-1) + "\r\n")
+			for _, key := range args[1:] {
+				s.writeValue(w, key)
+			}
+		case cmd == "DEL":
+			delete(s.values, args[1])
+			w.WriteString(":1\r\n")
+		default:
+			w.WriteString("-ERR unknown command\r\n")
+		}
+		s.mu.Unlock()
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// readCommand reads a command sent as RESP array of bulk strings
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("unexpected command: %q", line)
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, count)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "$") {
+			return nil, errors.New("expected bulk string")
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:size])
+	}
+	return args, nil
+}
+
+func (s *fakeServer) writeValue(w *bufio.Writer, key string) {
+	if value, ok := s.get(key); ok {
+		w.WriteString("$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n")
+	} else {
+		w.WriteString("$-1\r\n")
+	}
+}
+
+func (s *fakeServer) get(key string) (string, bool) {
+	if expires, ok := s.expires[key]; ok && time.Now().After(expires) {
+		delete(s.values, key)
+	}
+	value, ok := s.values[key]
+	return value, ok
+}
+
+func TestCache(t *testing.T) {
+	server := newFakeServer(t, "secret")
+	c := New(Options{Addr: server.listener.Addr().String(), Password: "secret", DB: 2, Prefix: "gitlib:"})
+	defer c.Close()
+
+	assert.Nil(t, c.Get("missing"))
+	assert.False(t, c.IsExist("missing"))
+
+	assert.NoError(t, c.Put("commit", "feaf4ba6bc635fec442f46ddd4512416ec43c2c2", time.Minute))
+	assert.NoError(t, c.Put("count", int64(6), 0))
+	assert.True(t, c.IsExist("commit"))
+	assert.Equal(t, "feaf4ba6bc635fec442f46ddd4512416ec43c2c2", c.Get("commit"))
+	assert.Equal(t, int64(6), c.Get("count"))
+	assert.Equal(t, []any{"feaf4ba6bc635fec442f46ddd4512416ec43c2c2", nil, int64(6)}, c.GetMulti("commit", "missing", "count"))
+
+	assert.NoError(t, c.Delete("commit"))
+	assert.Nil(t, c.Get("commit"))
+	assert.Error(t, c.Put("unsupported", struct{}{}, 0))
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	// the keys are prefixed and the connection is reused
+	assert.Contains(t, server.values, "gitlib:count")
+	assert.Equal(t, 1, server.conns)
+	assert.Contains(t, server.commands, []string{"auth", "secret"})
+	assert.Contains(t, server.commands, []string{"select", "2"})
+	assert.Contains(t, server.commands, []string{"set", "gitlib:commit", "sfeaf4ba6bc635fec442f46ddd4512416ec43c2c2", "ex", "60"})
+}
+
+func TestCacheUndecodableValue(t *testing.T) {
+	server := newFakeServer(t, "")
+	c := New(Options{Addr: server.listener.Addr().String()})
+	defer c.Close()
+
+	// a value written by something else is a miss, the other values are still returned
+	server.mu.Lock()
+	server.values["broken"] = "xbroken"
+	server.mu.Unlock()
+	assert.NoError(t, c.Put("count", int64(6), 0))
+	assert.Nil(t, c.Get("broken"))
+	assert.False(t, c.IsExist("broken"))
+	assert.Equal(t, []any{nil, int64(6)}, c.GetMulti("broken", "count"))
+}
+
+func TestCacheAuthFailure(t *testing.T) {
+	server := newFakeServer(t, "secret")
+	c := New(Options{Addr: server.listener.Addr().String(), Password: "wrong"})
+	defer c.Close()
+
+	assert.Error(t, c.Put("key", "value", 0))
+	assert.Nil(t, c.Get("key"))
+}
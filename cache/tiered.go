@@ -0,0 +1,98 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import "time"
+
+const defaultLocalTTL = time.Minute
+
+// Cache is the interface of git.Cache, the caches of the subpackages implement it
+type Cache interface {
+	Put(key string, val any, timeout time.Duration) error
+	Get(key string) any
+	IsExist(key string) bool
+	Delete(key string) error
+}
+
+// TieredOptions configures a Tiered cache
+type TieredOptions struct {
+	// LocalTTL limits how long a value is kept locally, as other nodes may change it remotely, a minute if zero
+	LocalTTL time.Duration
+	// NegativeTTL is how long a miss of the remote cache is kept locally, misses are not kept if zero
+	NegativeTTL time.Duration
+}
+
+// missing is kept locally for a key the remote cache has no value for
+type missing struct{}
+
+// Tiered layers a local cache, usually a small memory.Cache, in front of a remote cache.
+// Reads which miss locally read through to the remote cache and keep its value locally,
+// writes go to both caches.
+type Tiered struct {
+	local  Cache
+	remote Cache
+	opts   TieredOptions
+}
+
+// NewTiered creates a cache keeping the values of remote in local
+func NewTiered(local, remote Cache, opts TieredOptions) *Tiered {
+	if opts.LocalTTL <= 0 {
+		opts.LocalTTL = defaultLocalTTL
+	}
+	return &Tiered{local: local, remote: remote, opts: opts}
+}
+
+// Put stores val remotely and locally
+func (t *Tiered) Put(key string, val any, timeout time.Duration) error {
+	if err := t.remote.Put(key, val, timeout); err != nil {
+		// the local value would be outdated
+		_ = t.local.Delete(key)
+		return err
+	}
+	return t.local.Put(key, val, t.localTimeout(timeout))
+}
+
+// Get returns the local value of key, or else the remote value which is kept locally
+func (t *Tiered) Get(key string) any {
+	if val := t.local.Get(key); val != nil {
+		if _, ok := val.(missing); ok {
+			return nil
+		}
+		return val
+	}
+
+	val := t.remote.Get(key)
+	if val != nil {
+		_ = t.local.Put(key, val, t.opts.LocalTTL)
+	} else if t.opts.NegativeTTL > 0 {
+		_ = t.local.Put(key, missing{}, t.opts.NegativeTTL)
+	}
+	return val
+}
+
+// IsExist reports whether there is a value stored for key locally, or else remotely
+func (t *Tiered) IsExist(key string) bool {
+	if val := t.local.Get(key); val != nil {
+		_, ok := val.(missing)
+		return !ok
+	}
+	return t.remote.IsExist(key)
+}
+
+// Delete removes the value of key remotely and locally
+func (t *Tiered) Delete(key string) error {
+	localErr := t.local.Delete(key)
+	if err := t.remote.Delete(key); err != nil {
+		return err
+	}
+	return localErr
+}
+
+func (t *Tiered) localTimeout(timeout time.Duration) time.Duration {
+	if timeout > 0 && timeout < t.opts.LocalTTL {
+		return timeout
+	}
+	return t.opts.LocalTTL
+}
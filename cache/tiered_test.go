@@ -0,0 +1,68 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/enverbisevac/gitlib/cache/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingCache counts the reads of a cache and fails writes if err is set
+type countingCache struct {
+	Cache
+	gets int
+	err  error
+}
+
+func (c *countingCache) Get(key string) any {
+	c.gets++
+	return c.Cache.Get(key)
+}
+
+func (c *countingCache) Put(key string, val any, timeout time.Duration) error {
+	if c.err != nil {
+		return c.err
+	}
+	return c.Cache.Put(key, val, timeout)
+}
+
+func TestTiered(t *testing.T) {
+	local, remote := memory.New(10), &countingCache{Cache: memory.New(10)}
+	c := NewTiered(local, remote, TieredOptions{NegativeTTL: 10 * time.Second})
+
+	// write-through
+	assert.NoError(t, c.Put("commit", "feaf4ba6bc635fec442f46ddd4512416ec43c2c2", 0))
+	assert.Equal(t, "feaf4ba6bc635fec442f46ddd4512416ec43c2c2", local.Get("commit"))
+	assert.Equal(t, "feaf4ba6bc635fec442f46ddd4512416ec43c2c2", remote.Cache.Get("commit"))
+	assert.Equal(t, "feaf4ba6bc635fec442f46ddd4512416ec43c2c2", c.Get("commit"))
+	assert.Equal(t, 0, remote.gets)
+
+	// read-through
+	assert.NoError(t, remote.Put("count", int64(6), 0))
+	assert.Equal(t, int64(6), c.Get("count"))
+	assert.Equal(t, int64(6), c.Get("count"))
+	assert.Equal(t, 1, remote.gets)
+	assert.Equal(t, int64(6), local.Get("count"))
+
+	// negative caching
+	assert.Nil(t, c.Get("missing"))
+	assert.Nil(t, c.Get("missing"))
+	assert.False(t, c.IsExist("missing"))
+	assert.Equal(t, 2, remote.gets)
+
+	assert.NoError(t, c.Delete("commit"))
+	assert.False(t, c.IsExist("commit"))
+	assert.Nil(t, remote.Cache.Get("commit"))
+
+	// a failed remote write drops the local value
+	remote.err = errors.New("unavailable")
+	assert.Error(t, c.Put("count", int64(7), 0))
+	assert.Nil(t, local.Get("count"))
+	assert.Equal(t, int64(6), c.Get("count"))
+}
@@ -0,0 +1,106 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// names of the caches in CacheEvent
+const (
+	// CacheValues are the values cached with Get
+	CacheValues = "values"
+	// CacheLastCommit are the last commits of entries cached by LastCommitCache
+	CacheLastCommit = "last_commit"
+)
+
+// CacheOp is the operation of a CacheEvent
+type CacheOp string
+
+// cache operations
+const (
+	CacheGet    CacheOp = "get"
+	CachePut    CacheOp = "put"
+	CacheDelete CacheOp = "delete"
+)
+
+// CacheEvent describes an operation on a cache, it is passed to the functions registered with OnCache
+type CacheEvent struct {
+	// Cache is the name of the cache, CacheValues or CacheLastCommit
+	Cache string
+	Op    CacheOp
+	// Hit reports whether a get found a value
+	Hit bool
+	// Duration is the time the cache took, without computing a missing value
+	Duration time.Duration
+	Err      error
+}
+
+var cacheHooks eventHooks[CacheEvent]
+
+// OnCache registers fn to receive every operation on the caches, e.g. to export hit ratios.
+// fn is called synchronously, the returned function unregisters it.
+func OnCache(fn func(CacheEvent)) (unregister func()) {
+	return cacheHooks.add(fn)
+}
+
+func notifyCache(cache string, op CacheOp, start time.Time, hit bool, err error) {
+	if !cacheHooks.has() {
+		return
+	}
+	cacheHooks.notify(CacheEvent{
+		Cache:    cache,
+		Op:       op,
+		Hit:      hit,
+		Duration: time.Since(start),
+		Err:      err,
+	})
+}
+
+// CacheStats counts the cache events it records, it is safe for concurrent use:
+//
+//	var stats git.CacheStats
+//	git.OnCache(stats.Record)
+type CacheStats struct {
+	hits     atomic.Int64
+	misses   atomic.Int64
+	errors   atomic.Int64
+	duration atomic.Int64
+}
+
+// Record counts event, a failed get is counted as error and not as miss
+func (s *CacheStats) Record(event CacheEvent) {
+	s.duration.Add(int64(event.Duration))
+	switch {
+	case event.Err != nil:
+		s.errors.Add(1)
+	case event.Op != CacheGet:
+	case event.Hit:
+		s.hits.Add(1)
+	default:
+		s.misses.Add(1)
+	}
+}
+
+// Hits returns the number of gets which found a value
+func (s *CacheStats) Hits() int64 {
+	return s.hits.Load()
+}
+
+// Misses returns the number of gets which found no value
+func (s *CacheStats) Misses() int64 {
+	return s.misses.Load()
+}
+
+// Errors returns the number of failed operations
+func (s *CacheStats) Errors() int64 {
+	return s.errors.Load()
+}
+
+// Duration returns the total time of all operations
+func (s *CacheStats) Duration() time.Duration {
+	return time.Duration(s.duration.Load())
+}
@@ -0,0 +1,281 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/enverbisevac/gitlib/cache"
+	"github.com/enverbisevac/gitlib/cache/memcache"
+	"github.com/enverbisevac/gitlib/cache/memory"
+	"github.com/enverbisevac/gitlib/cache/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	_ Cache = (*memory.Cache)(nil)
+	_ Cache = (*redis.Cache)(nil)
+	_ Cache = (*memcache.Cache)(nil)
+	_ Cache = (*cache.Tiered)(nil)
+)
+
+func TestGetWithMemoryCache(t *testing.T) {
+	oldCache, oldTTL := GetCache(), CacheService.Cache.TTL
+	Initialize(memory.New(0))
+	CacheService.Cache.TTL = time.Hour
+	defer func() {
+		Initialize(oldCache)
+		CacheService.Cache.TTL = oldTTL
+	}()
+
+	calls := 0
+	count := func() (int64, error) {
+		calls++
+		return 6, nil
+	}
+	for i := 0; i < 2; i++ {
+		value, err := Get("commits_count", count)
+		assert.NoError(t, err)
+		assert.EqualValues(t, 6, value)
+	}
+	assert.Equal(t, 1, calls)
+
+	Remove("commits_count")
+	_, err := Get("commits_count", count)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+}
+
+// encodingCache stores values serialized like the remote caches do
+type encodingCache struct {
+	*memory.Cache
+}
+
+func (c encodingCache) Put(key string, val any, timeout time.Duration) error {
+	data, err := cache.Encode(val)
+	if err != nil {
+		return err
+	}
+	return c.Cache.Put(key, data, timeout)
+}
+
+func (c encodingCache) Get(key string) any {
+	data, ok := c.Cache.Get(key).([]byte)
+	if !ok {
+		return nil
+	}
+	val, _ := cache.Decode(data)
+	return val
+}
+
+type cachedCommit struct {
+	ID      string
+	Parents []string
+}
+
+func TestTypedCache(t *testing.T) {
+	commit := cachedCommit{ID: "feaf4ba6bc635fec442f46ddd4512416ec43c2c2", Parents: []string{"2839944139e0de9737a044f78b0e4b40d53a014e"}}
+	for name, codec := range map[string]Codec[cachedCommit]{"json": JSONCodec[cachedCommit]{}, "gob": GobCodec[cachedCommit]{}} {
+		t.Run(name, func(t *testing.T) {
+			c := NewTypedCache(Cache(encodingCache{memory.New(0)}), codec)
+
+			_, ok, err := c.Get("commit")
+			assert.NoError(t, err)
+			assert.False(t, ok)
+
+			assert.NoError(t, c.Put("commit", commit, 0))
+			assert.True(t, c.IsExist("commit"))
+			value, ok, err := c.Get("commit")
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, commit, value)
+
+			assert.NoError(t, c.Delete("commit"))
+			assert.False(t, c.IsExist("commit"))
+		})
+	}
+
+	// values stored without serialization are returned as is
+	c := NewTypedCache[string](memory.New(0), nil)
+	assert.NoError(t, c.cache.Put("commit", commit.ID, 0))
+	value, ok, err := c.Get("commit")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, commit.ID, value)
+
+	assert.NoError(t, c.cache.Put("commit", 6, 0))
+	_, _, err = c.Get("commit")
+	assert.Error(t, err)
+}
+
+func TestGetWithRemoteCache(t *testing.T) {
+	oldCache, oldTTL := GetCache(), CacheService.Cache.TTL
+	Initialize(encodingCache{memory.New(0)})
+	CacheService.Cache.TTL = time.Hour
+	defer func() {
+		Initialize(oldCache)
+		CacheService.Cache.TTL = oldTTL
+	}()
+
+	calls := 0
+	getCommit := func() (cachedCommit, error) {
+		calls++
+		return cachedCommit{ID: "feaf4ba6bc635fec442f46ddd4512416ec43c2c2"}, nil
+	}
+	for i := 0; i < 2; i++ {
+		value, err := Get("commit", getCommit)
+		assert.NoError(t, err)
+		assert.Equal(t, "feaf4ba6bc635fec442f46ddd4512416ec43c2c2", value.ID)
+	}
+	assert.Equal(t, 1, calls)
+}
+
+func TestGetUndecodableValue(t *testing.T) {
+	oldCache, oldTTL := GetCache(), CacheService.Cache.TTL
+	c := encodingCache{memory.New(0)}
+	Initialize(c)
+	CacheService.Cache.TTL = time.Hour
+	defer func() {
+		Initialize(oldCache)
+		CacheService.Cache.TTL = oldTTL
+	}()
+
+	// a value cached in another shape is replaced by the one of getFunc
+	assert.NoError(t, c.Put(CacheKey("commit"), []byte("not json"), 0))
+	calls := 0
+	getCommit := func() (cachedCommit, error) {
+		calls++
+		return cachedCommit{ID: "feaf4ba6bc635fec442f46ddd4512416ec43c2c2"}, nil
+	}
+	for i := 0; i < 2; i++ {
+		value, err := Get("commit", getCommit)
+		assert.NoError(t, err)
+		assert.Equal(t, "feaf4ba6bc635fec442f46ddd4512416ec43c2c2", value.ID)
+	}
+	assert.Equal(t, 1, calls)
+}
+
+func TestTypedCacheNativeValues(t *testing.T) {
+	// values the remote caches store themselves are encoded once
+	mem := memory.New(0)
+	c := NewTypedCache[int64](encodingCache{mem}, nil)
+	assert.NoError(t, c.Put("commits_count", 6, 0))
+	data, _ := mem.Get("commits_count").([]byte)
+	assert.Equal(t, "I6", string(data))
+	value, ok, err := c.Get("commits_count")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.EqualValues(t, 6, value)
+}
+
+func TestOnCache(t *testing.T) {
+	oldCache, oldTTL, oldLastCommit := GetCache(), CacheService.Cache.TTL, CacheService.LastCommit
+	Initialize(memory.New(0))
+	CacheService.Cache.TTL = time.Hour
+	CacheService.LastCommit.Enabled, CacheService.LastCommit.CommitsCount = true, 0
+	defer func() {
+		Initialize(oldCache)
+		CacheService.Cache.TTL = oldTTL
+		CacheService.LastCommit = oldLastCommit
+	}()
+
+	var (
+		stats  CacheStats
+		events []CacheEvent
+	)
+	defer OnCache(stats.Record)()
+	unregister := OnCache(func(event CacheEvent) {
+		events = append(events, event)
+	})
+	defer unregister()
+
+	count := func() (int64, error) { return 6, nil }
+	for i := 0; i < 2; i++ {
+		_, err := Get("commits_count", count)
+		assert.NoError(t, err)
+	}
+	Remove("commits_count")
+	if assert.Len(t, events, 4) {
+		assert.Equal(t, CacheValues, events[0].Cache)
+		assert.Equal(t, CacheGet, events[0].Op)
+		assert.False(t, events[0].Hit)
+		assert.Equal(t, CachePut, events[1].Op)
+		assert.True(t, events[2].Hit)
+		assert.Equal(t, CacheDelete, events[3].Op)
+	}
+	assert.EqualValues(t, 1, stats.Hits())
+	assert.EqualValues(t, 1, stats.Misses())
+	assert.EqualValues(t, 0, stats.Errors())
+
+	repo, err := openRepositoryWithDefaultContext(filepath.Join(testReposDir, "repo1_bare"))
+	assert.NoError(t, err)
+	defer repo.Close()
+	lcc := NewLastCommitCache(0, repo.Path, repo, GetCache())
+	for i := 0; i < 2; i++ {
+		commit, err := lcc.GetCommitByPath("feaf4ba6bc635fec442f46ddd4512416ec43c2c2", "file1.txt")
+		assert.NoError(t, err)
+		assert.NotNil(t, commit)
+	}
+	events = events[4:]
+	if assert.Len(t, events, 3) {
+		for _, event := range events {
+			assert.Equal(t, CacheLastCommit, event.Cache)
+		}
+		assert.Equal(t, []CacheOp{CacheGet, CachePut, CacheGet}, []CacheOp{events[0].Op, events[1].Op, events[2].Op})
+		assert.False(t, events[0].Hit)
+		assert.True(t, events[2].Hit)
+	}
+	assert.EqualValues(t, 2, stats.Hits())
+	assert.EqualValues(t, 2, stats.Misses())
+
+	unregister()
+	stats.Record(CacheEvent{Op: CachePut, Err: errors.New("unavailable")})
+	assert.EqualValues(t, 1, stats.Errors())
+	_, err = Get("commits_count", count)
+	assert.NoError(t, err)
+	assert.Len(t, events, 3)
+}
+
+func TestCacheKey(t *testing.T) {
+	oldCache, oldTTL, oldPrefix := GetCache(), CacheService.Cache.TTL, CacheService.Cache.Prefix
+	c := memory.New(0)
+	Initialize(c)
+	CacheService.Cache.TTL = time.Hour
+	defer func() {
+		Initialize(oldCache)
+		CacheService.Cache.TTL = oldTTL
+		CacheService.Cache.Prefix = oldPrefix
+	}()
+
+	assert.Equal(t, "v1:commits_count", CacheKey("commits_count"))
+	assert.Equal(t, "v1:last_commit:", getCacheKey("repo", "master", "file1.txt")[:len("v1:last_commit:")])
+
+	CacheService.Cache.Prefix = "app1:"
+	assert.Equal(t, "app1:v1:commits_count", CacheKey("commits_count"))
+	assert.Equal(t, "app1:v1:last_commit:", getCacheKey("repo", "master", "file1.txt")[:len("app1:v1:last_commit:")])
+
+	count := func() (int64, error) { return 6, nil }
+	_, err := Get("commits_count", count)
+	assert.NoError(t, err)
+	assert.True(t, c.IsExist("app1:v1:commits_count"))
+	assert.False(t, c.IsExist("commits_count"))
+
+	// another application sharing the cache doesn't read the value
+	CacheService.Cache.Prefix = "app2:"
+	calls := 0
+	_, err = Get("commits_count", func() (int64, error) {
+		calls++
+		return 7, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls)
+
+	Remove("commits_count")
+	assert.False(t, c.IsExist("app2:v1:commits_count"))
+	assert.True(t, c.IsExist("app1:v1:commits_count"))
+}
@@ -0,0 +1,113 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/enverbisevac/gitlib/cache"
+)
+
+// Codec serializes the values of a TypedCache
+type Codec[T any] interface {
+	Marshal(val T) ([]byte, error)
+	Unmarshal(data []byte) (T, error)
+}
+
+// JSONCodec serializes values as JSON, only the exported fields of structs are kept
+type JSONCodec[T any] struct{}
+
+// Marshal returns the JSON encoding of val
+func (JSONCodec[T]) Marshal(val T) ([]byte, error) {
+	return json.Marshal(val)
+}
+
+// Unmarshal decodes a value encoded by Marshal
+func (JSONCodec[T]) Unmarshal(data []byte) (T, error) {
+	var val T
+	err := json.Unmarshal(data, &val)
+	return val, err
+}
+
+// GobCodec serializes values with encoding/gob, interface values must be registered with gob.Register
+type GobCodec[T any] struct{}
+
+// Marshal returns the gob encoding of val
+func (GobCodec[T]) Marshal(val T) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(val); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes a value encoded by Marshal
+func (GobCodec[T]) Unmarshal(data []byte) (T, error) {
+	var val T
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&val)
+	return val, err
+}
+
+// TypedCache stores values of type T in a Cache serialized by a codec,
+// so that they survive the round-trip through a remote cache.
+// Values of the types the remote caches store themselves, see cache.Encode, are not serialized twice:
+// they are stored as is and the codec is only used for the other types.
+type TypedCache[T any] struct {
+	cache Cache
+	codec Codec[T]
+}
+
+// NewTypedCache creates a TypedCache, values are serialized as JSON if codec is nil
+func NewTypedCache[T any](cache Cache, codec Codec[T]) *TypedCache[T] {
+	if codec == nil {
+		codec = JSONCodec[T]{}
+	}
+	return &TypedCache[T]{cache: cache, codec: codec}
+}
+
+// Put serializes val and stores it with key for timeout
+func (c *TypedCache[T]) Put(key string, val T, timeout time.Duration) error {
+	if cache.Supported(val) {
+		return c.cache.Put(key, val, timeout)
+	}
+	data, err := c.codec.Marshal(val)
+	if err != nil {
+		return fmt.Errorf("unable to encode cached value %s: %w", key, err)
+	}
+	return c.cache.Put(key, data, timeout)
+}
+
+// Get returns the value stored with key, ok is false if there is none.
+// A value of type T which was stored without serialization is returned as is.
+func (c *TypedCache[T]) Get(key string) (val T, ok bool, err error) {
+	switch v := c.cache.Get(key).(type) {
+	case nil:
+		return val, false, nil
+	case T:
+		return v, true, nil
+	case []byte:
+		val, err = c.codec.Unmarshal(v)
+		if err != nil {
+			return val, false, fmt.Errorf("unable to decode cached value %s: %w", key, err)
+		}
+		return val, true, nil
+	default:
+		return val, false, fmt.Errorf("unsupported cached value type: %T", v)
+	}
+}
+
+// IsExist reports whether there is a value stored with key
+func (c *TypedCache[T]) IsExist(key string) bool {
+	return c.cache.IsExist(key)
+}
+
+// Delete removes the value stored with key
+func (c *TypedCache[T]) Delete(key string) error {
+	return c.cache.Delete(key)
+}
@@ -0,0 +1,273 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// readObject reads the object id into memory with a pooled cat-file --batch process.
+// Like reads from the object storage, object reads are not canceled with the context of a view of the repository.
+func (repo *Repository) readObject(id ObjectID) (_ plumbing.EncodedObject, err error) {
+	wr, rd, cancel, err := repo.CatFileBatch(repo.catFile.ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		stopOnReadError(wr, err)
+		cancel()
+	}()
+
+	if _, err := wr.Write([]byte(id.String() + "\n")); err != nil {
+		return nil, err
+	}
+	_, typ, size, err := ReadBatchLine(rd)
+	if err != nil {
+		return nil, err
+	}
+	objType, err := plumbing.ParseObjectType(typ)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := &plumbing.MemoryObject{}
+	obj.SetType(objType)
+	if _, err := io.CopyN(obj, rd, size); err != nil {
+		return nil, err
+	}
+	// the content is followed by a LF
+	if _, err := rd.Discard(1); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// statObject returns the type and size of the object id read with a pooled cat-file --batch-check process
+func (repo *Repository) statObject(id ObjectID) (_ string, _ int64, err error) {
+	wr, rd, cancel, err := repo.CatFileBatchCheck(repo.catFile.ctx)
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() {
+		stopOnReadError(wr, err)
+		cancel()
+	}()
+
+	if _, err := wr.Write([]byte(id.String() + "\n")); err != nil {
+		return "", 0, err
+	}
+	_, typ, size, err := ReadBatchLine(rd)
+	return typ, size, err
+}
+
+// statBlobs returns the sizes of the blobs of entries by their ids read with a single pooled cat-file --batch-check process.
+// The ids are written while the replies are read, so a large tree costs no round trip per entry.
+func (repo *Repository) statBlobs(entries []TreeEntry) (_ map[string]int64, err error) {
+	ids := make([]string, 0, len(entries))
+	for i := range entries {
+		if !entries[i].IsDir() && !entries[i].IsSubModule() {
+			ids = append(ids, entries[i].ID.String())
+		}
+	}
+	sizes := make(map[string]int64, len(ids))
+	if len(ids) == 0 {
+		return sizes, nil
+	}
+
+	wr, rd, cancel, err := repo.CatFileBatchCheck(repo.catFile.ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		stopOnReadError(wr, err)
+		cancel()
+	}()
+
+	// a failed write leaves the process without input, so the reads below fail too
+	go func() {
+		for _, id := range ids {
+			if _, err := wr.Write([]byte(id + "\n")); err != nil {
+				return
+			}
+		}
+	}()
+	for _, id := range ids {
+		_, _, size, err := ReadBatchLine(rd)
+		if IsErrNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		sizes[id] = size
+	}
+	return sizes, nil
+}
+
+// stopOnReadError closes the writer of a pooled process if err left output which can't be skipped,
+// so that the process is stopped instead of being returned to the pool. The reply for a missing object is read completely.
+func stopOnReadError(wr WriteCloserError, err error) {
+	if err != nil && !IsErrNotExist(err) {
+		_ = wr.CloseWithError(err)
+	}
+}
+
+// readCommitObject reads the commit id, or the commit the tag id points to together with the tag
+func (repo *Repository) readCommitObject(id ObjectID) (*object.Commit, *object.Tag, error) {
+	obj, err := repo.readObject(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var tag *object.Tag
+	if obj.Type() == plumbing.TagObject {
+		if tag, err = object.DecodeTag(repo.gogit.Storer, obj); err != nil {
+			return nil, nil, err
+		}
+		// if the target is missing the repository is broken
+		if obj, err = repo.readObject(tag.Target); err != nil {
+			return nil, nil, err
+		}
+	}
+	if obj.Type() != plumbing.CommitObject {
+		return nil, nil, ErrNotExist{ID: id.String()}
+	}
+	commit, err := object.DecodeCommit(repo.gogit.Storer, obj)
+	return commit, tag, err
+}
+
+// readCommit reads the commit id, or the commit the tag id points to with the message, tagger and signature
+// of the tag like readCommitObject. The objects are decoded without gogit, which only decodes sha1 objects.
+func (repo *Repository) readCommit(id ObjectID) (*Commit, error) {
+	obj, err := repo.readObject(id)
+	if err != nil {
+		return nil, err
+	}
+
+	commitID := id
+	var tag *Tag
+	if obj.Type() == plumbing.TagObject {
+		data, err := readEncodedObject(obj)
+		if err != nil {
+			return nil, err
+		}
+		if tag, err = parseTagData(data); err != nil {
+			return nil, err
+		}
+		// if the target is missing the repository is broken
+		commitID = tag.Object
+		if obj, err = repo.readObject(commitID); err != nil {
+			return nil, err
+		}
+	}
+	if obj.Type() != plumbing.CommitObject {
+		return nil, ErrNotExist{ID: id.String()}
+	}
+	rd, err := obj.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer rd.Close()
+	commit, err := CommitFromReader(repo, commitID, rd)
+	if err != nil {
+		return nil, err
+	}
+	if tag != nil {
+		commit.CommitMessage = strings.TrimSpace(tag.Message)
+		commit.Author = tag.Tagger
+		commit.Signature = tag.Signature
+	}
+	return commit, nil
+}
+
+// readEncodedObject returns the content of an object read by readObject
+func readEncodedObject(obj plumbing.EncodedObject) ([]byte, error) {
+	rd, err := obj.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer rd.Close()
+	return io.ReadAll(rd)
+}
+
+// readTreeEntries reads the tree id and decodes its entries with the object format of the repository
+func (repo *Repository) readTreeEntries(id ObjectID) ([]TreeEntry, error) {
+	obj, err := repo.readObject(id)
+	if err != nil {
+		return nil, err
+	}
+	if obj.Type() != plumbing.TreeObject {
+		return nil, ErrNotExist{ID: id.String()}
+	}
+	data, err := readEncodedObject(obj)
+	if err != nil {
+		return nil, err
+	}
+	return parseTreeObject(repo.ObjectFormat(), data)
+}
+
+// blobReader reads the content of a blob from a cat-file --batch process,
+// which it returns to the pool once the content has been read or when closed
+type blobReader struct {
+	wr     WriteCloserError
+	rd     *bufio.Reader
+	n      int64
+	err    error
+	cancel func()
+	closed bool
+}
+
+func (b *blobReader) Read(p []byte) (n int, err error) {
+	if b.n <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > b.n {
+		p = p[0:b.n]
+	}
+	n, err = b.rd.Read(p)
+	b.n -= int64(n)
+	if err != nil {
+		b.err = err
+		return n, err
+	}
+	if b.n == 0 {
+		return n, b.release()
+	}
+	return n, nil
+}
+
+// Close discards the unread content and returns the process to the pool
+func (b *blobReader) Close() error {
+	if b.closed {
+		return errors.New("blob reader is already closed")
+	}
+	b.closed = true
+	return b.release()
+}
+
+// release discards the unread content and returns the process to the pool, if it hasn't been returned yet
+func (b *blobReader) release() error {
+	if b.cancel == nil {
+		return nil
+	}
+	defer func() {
+		b.cancel()
+		b.cancel = nil
+	}()
+	if b.err != nil {
+		stopOnReadError(b.wr, b.err)
+		return nil
+	}
+	// the content is followed by a LF
+	_, err := b.rd.Discard(int(b.n) + 1)
+	b.n = 0
+	stopOnReadError(b.wr, err)
+	return err
+}
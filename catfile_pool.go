@@ -0,0 +1,211 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/enverbisevac/gitlib/process"
+)
+
+const (
+	defaultCatFileBatchMaxIdle     = 4
+	defaultCatFileBatchIdleTimeout = time.Minute
+)
+
+// ErrCatFileBatchPoolClosed is returned by CatFileBatchPool.Get once the pool has been closed
+var ErrCatFileBatchPoolClosed = errors.New("cat-file batch pool is closed")
+
+type catFileBatch struct {
+	writer    WriteCloserError
+	reader    *bufio.Reader
+	cancel    func()
+	lifecycle *process.Lifecycle
+	// closed is set once the caller closed the writer, the process is stopped when it is returned
+	closed atomic.Bool
+}
+
+// catFileBatchWriter marks the process as closed when it is closed by the caller
+type catFileBatchWriter struct {
+	WriteCloserError
+	batch *catFileBatch
+}
+
+func (w *catFileBatchWriter) Close() error {
+	w.batch.closed.Store(true)
+	return w.WriteCloserError.Close()
+}
+
+func (w *catFileBatchWriter) CloseWithError(err error) error {
+	w.batch.closed.Store(true)
+	return w.WriteCloserError.CloseWithError(err)
+}
+
+// CatFileBatchPool keeps `git cat-file --batch` or `--batch-check` processes of a repository running,
+// so that many objects can be read without starting a process per object.
+// Idle processes are stopped after Git.CatFileBatch.IdleTimeout and recycled after Git.CatFileBatch.MaxLifetime.
+type CatFileBatchPool struct {
+	ctx       context.Context
+	repoPath  string
+	check     bool
+	maxIdle   int
+	lifecycle process.LifecycleOptions
+
+	mu     sync.Mutex
+	idle   []*catFileBatch
+	valid  bool
+	closed bool
+}
+
+// NewCatFileBatchPool creates a pool of cat-file --batch processes, or --batch-check processes if check is set.
+// The processes run in ctx and not in the context of the caller checking them out, once ctx is done
+// idle processes are stopped and checked out processes are stopped when they are returned.
+func NewCatFileBatchPool(ctx context.Context, repoPath string, check bool) *CatFileBatchPool {
+	p := &CatFileBatchPool{
+		ctx:      ctx,
+		repoPath: repoPath,
+		check:    check,
+		maxIdle:  Git.CatFileBatch.MaxIdle,
+		lifecycle: process.LifecycleOptions{
+			IdleTimeout: Git.CatFileBatch.IdleTimeout,
+			MaxLifetime: Git.CatFileBatch.MaxLifetime,
+		},
+	}
+	if p.maxIdle <= 0 {
+		p.maxIdle = defaultCatFileBatchMaxIdle
+	}
+	if p.lifecycle.IdleTimeout <= 0 {
+		p.lifecycle.IdleTimeout = defaultCatFileBatchIdleTimeout
+	}
+	return p
+}
+
+// Get checks out a process, a new one is started if there is no idle process.
+// The returned cancel function must be called once done and returns the process to the pool,
+// all output of the requested objects has to be read before. If ctx is done before, the process is stopped.
+// A caller which can't read the output, e.g. after a failed read, closes the writer and the process is stopped instead.
+func (p *CatFileBatchPool) Get(ctx context.Context) (WriteCloserError, *bufio.Reader, func(), error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, nil, nil, ErrCatFileBatchPoolClosed
+	}
+	var batch *catFileBatch
+	for n := len(p.idle); n > 0 && batch == nil; n = len(p.idle) {
+		batch = p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		if !batch.lifecycle.Acquire() {
+			// expired while waiting for the lock
+			batch = nil
+		}
+	}
+	valid := p.valid
+	p.mu.Unlock()
+
+	if batch == nil {
+		if !valid {
+			if err := EnsureValidGitRepository(ctx, p.repoPath); err != nil {
+				return nil, nil, nil, err
+			}
+			p.mu.Lock()
+			p.valid = true
+			p.mu.Unlock()
+		}
+		batch = p.start()
+		if !batch.lifecycle.Acquire() {
+			return nil, nil, nil, fmt.Errorf("unable to start cat-file batch: %w", p.ctx.Err())
+		}
+	}
+
+	var once sync.Once
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			once.Do(batch.lifecycle.Stop)
+		case <-done:
+		}
+	}()
+	cancel := func() {
+		once.Do(func() {
+			close(done)
+			p.put(batch)
+		})
+	}
+	return &catFileBatchWriter{WriteCloserError: batch.writer, batch: batch}, batch.reader, cancel, nil
+}
+
+func (p *CatFileBatchPool) start() *catFileBatch {
+	batch := &catFileBatch{}
+	if p.check {
+		batch.writer, batch.reader, batch.cancel = CatFileBatchCheckReader(p.ctx, p.repoPath)
+	} else {
+		batch.writer, batch.reader, batch.cancel = CatFileBatchReader(p.ctx, p.repoPath)
+	}
+	batch.lifecycle = process.NewLifecycle(p.ctx, p.lifecycle, func() {
+		p.remove(batch)
+		batch.cancel()
+	})
+	return batch
+}
+
+func (p *CatFileBatchPool) put(batch *catFileBatch) {
+	select {
+	case <-batch.lifecycle.Stopped():
+		// stopped because the context of the caller is done
+		return
+	default:
+	}
+
+	p.mu.Lock()
+	// best effort check for unread output which would be returned to the next caller
+	if p.closed || p.ctx.Err() != nil || len(p.idle) >= p.maxIdle || batch.closed.Load() || batch.reader.Buffered() > 0 {
+		p.mu.Unlock()
+		batch.lifecycle.Stop()
+		return
+	}
+	p.idle = append(p.idle, batch)
+	p.mu.Unlock()
+	// outside of the lock, the process is removed from the idle ones if it expired
+	batch.lifecycle.Release()
+}
+
+// remove removes a stopped process from the idle ones
+func (p *CatFileBatchPool) remove(batch *catFileBatch) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, idle := range p.idle {
+		if idle == batch {
+			p.idle = append(p.idle[:i], p.idle[i+1:]...)
+			return
+		}
+	}
+}
+
+// Idle returns the number of idle processes
+func (p *CatFileBatchPool) Idle() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.idle)
+}
+
+// Close stops all idle processes, processes which are checked out are stopped when they are returned
+func (p *CatFileBatchPool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	p.mu.Unlock()
+
+	for _, batch := range idle {
+		batch.lifecycle.Stop()
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository_CatFileBatch(t *testing.T) {
+	bareRepo1Path := filepath.Join(testReposDir, "repo1_bare")
+	bareRepo1, err := openRepositoryWithDefaultContext(bareRepo1Path)
+	assert.NoError(t, err)
+	defer bareRepo1.Close()
+
+	const commitID = "95bb4d39648ee7e325106df01a621c530863a653"
+
+	wr, rd, cancel, err := bareRepo1.CatFileBatch(DefaultContext)
+	assert.NoError(t, err)
+	_, err = wr.Write([]byte(commitID + "\n"))
+	assert.NoError(t, err)
+	sha, typ, size, err := ReadBatchLine(rd)
+	assert.NoError(t, err)
+	assert.Equal(t, commitID, string(sha))
+	assert.Equal(t, "commit", typ)
+	commit, err := CommitFromReader(bareRepo1, MustIDFromString(commitID), io.LimitReader(rd, size))
+	assert.NoError(t, err)
+	assert.Equal(t, "Add file1.txt", commit.Summary())
+	_, err = rd.Discard(1)
+	assert.NoError(t, err)
+	cancel()
+	assert.Equal(t, 1, bareRepo1.catFile.batch.Idle())
+
+	// the idle process is reused
+	wr2, rd2, cancel, err := bareRepo1.CatFileBatch(DefaultContext)
+	assert.NoError(t, err)
+	assert.Same(t, rd, rd2)
+	assert.Equal(t, 0, bareRepo1.catFile.batch.Idle())
+	_, err = wr2.Write([]byte("feaf4ba6bc635fec442f46ddd4512416ec43c2c2\n"))
+	assert.NoError(t, err)
+	_, typ, size, err = ReadBatchLine(rd2)
+	assert.NoError(t, err)
+	assert.Equal(t, "commit", typ)
+	_, err = rd2.Discard(int(size) + 1)
+	assert.NoError(t, err)
+	cancel()
+	// calling cancel twice must not return the process twice
+	cancel()
+	assert.Equal(t, 1, bareRepo1.catFile.batch.Idle())
+}
+
+func TestRepository_CatFileBatchCheck(t *testing.T) {
+	bareRepo1Path := filepath.Join(testReposDir, "repo1_bare")
+	bareRepo1, err := openRepositoryWithDefaultContext(bareRepo1Path)
+	assert.NoError(t, err)
+
+	ctx, ctxCancel := context.WithCancel(DefaultContext)
+	wr, rd, cancel, err := bareRepo1.CatFileBatchCheck(ctx)
+	assert.NoError(t, err)
+	_, err = wr.Write([]byte("e2129701f1a4d54dc44f03c93bca0a2aec7c5449\n"))
+	assert.NoError(t, err)
+	_, typ, size, err := ReadBatchLine(rd)
+	assert.NoError(t, err)
+	assert.Equal(t, "blob", typ)
+	assert.EqualValues(t, 6, size)
+
+	// the process is stopped instead of being returned when the context is done
+	ctxCancel()
+	_, err = rd.ReadByte()
+	assert.Error(t, err)
+	cancel()
+	assert.Equal(t, 0, bareRepo1.catFile.batchCheck.Idle())
+
+	assert.NoError(t, bareRepo1.Close())
+	_, _, _, err = bareRepo1.CatFileBatchCheck(DefaultContext)
+	assert.ErrorIs(t, err, ErrCatFileBatchPoolClosed)
+}
+
+func TestCatFileBatchPool_ClosedWriter(t *testing.T) {
+	pool := NewCatFileBatchPool(DefaultContext, filepath.Join(testReposDir, "repo1_bare"), false)
+	defer pool.Close()
+
+	wr, rd, cancel, err := pool.Get(DefaultContext)
+	assert.NoError(t, err)
+	_, err = wr.Write([]byte("e2129701f1a4d54dc44f03c93bca0a2aec7c5449\n"))
+	assert.NoError(t, err)
+	_, _, _, err = ReadBatchLine(rd)
+	assert.NoError(t, err)
+	// the content is left unread, the process is stopped instead of being returned
+	assert.NoError(t, wr.Close())
+	cancel()
+	assert.Equal(t, 0, pool.Idle())
+
+	_, rd2, cancel, err := pool.Get(DefaultContext)
+	assert.NoError(t, err)
+	assert.NotSame(t, rd, rd2)
+	cancel()
+}
+
+func TestCatFileBatchPool_IdleTimeout(t *testing.T) {
+	defer func(timeout time.Duration) {
+		Git.CatFileBatch.IdleTimeout = timeout
+	}(Git.CatFileBatch.IdleTimeout)
+	Git.CatFileBatch.IdleTimeout = 50 * time.Millisecond
+
+	pool := NewCatFileBatchPool(DefaultContext, filepath.Join(testReposDir, "repo1_bare"), true)
+	defer pool.Close()
+
+	_, _, cancel, err := pool.Get(DefaultContext)
+	assert.NoError(t, err)
+	cancel()
+	assert.Equal(t, 1, pool.Idle())
+	assert.Eventually(t, func() bool { return pool.Idle() == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestCatFileBatchPool_MaxLifetime(t *testing.T) {
+	defer func(lifetime time.Duration) {
+		Git.CatFileBatch.MaxLifetime = lifetime
+	}(Git.CatFileBatch.MaxLifetime)
+	Git.CatFileBatch.MaxLifetime = 50 * time.Millisecond
+
+	pool := NewCatFileBatchPool(DefaultContext, filepath.Join(testReposDir, "repo1_bare"), true)
+	defer pool.Close()
+
+	_, rd, cancel, err := pool.Get(DefaultContext)
+	assert.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+	// the expired process isn't returned to the pool
+	cancel()
+	assert.Equal(t, 0, pool.Idle())
+
+	_, rd2, cancel, err := pool.Get(DefaultContext)
+	assert.NoError(t, err)
+	assert.NotSame(t, rd, rd2)
+	cancel()
+}
+
+func TestCatFileBatchPool_ContextDone(t *testing.T) {
+	ctx, ctxCancel := context.WithCancel(DefaultContext)
+	pool := NewCatFileBatchPool(ctx, filepath.Join(testReposDir, "repo1_bare"), true)
+	defer pool.Close()
+
+	_, _, cancel, err := pool.Get(DefaultContext)
+	assert.NoError(t, err)
+	cancel()
+	assert.Equal(t, 1, pool.Idle())
+
+	// idle processes are stopped once the context of the pool is done
+	ctxCancel()
+	assert.Eventually(t, func() bool { return pool.Idle() == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestRepository_ReadObjectsWithCatFileBatch(t *testing.T) {
+	bareRepo1, err := openRepositoryWithDefaultContext(filepath.Join(testReposDir, "repo1_bare"))
+	assert.NoError(t, err)
+	defer bareRepo1.Close()
+
+	// the objects are read with the processes of the pools, which are returned once done
+	commit, err := bareRepo1.GetCommit("feaf4ba6bc635fec442f46ddd4512416ec43c2c2")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, bareRepo1.catFile.batch.Idle())
+	entry, err := commit.GetTreeEntryByPath("file1.txt")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 6, entry.Size())
+	assert.Equal(t, 1, bareRepo1.catFile.batchCheck.Idle())
+
+	blob, err := bareRepo1.GetBlob(entry.ID.String())
+	assert.NoError(t, err)
+	assert.EqualValues(t, 6, blob.Size())
+	// small blobs are read into memory, the process is returned right away
+	r, err := blob.DataAsync()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, bareRepo1.catFile.batch.Idle())
+	content, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "file1\n", string(content))
+	assert.NoError(t, r.Close())
+	assert.Equal(t, 1, bareRepo1.catFile.batch.Idle())
+
+	// an unread blob is discarded when closed
+	r, err = blob.DataAsync()
+	assert.NoError(t, err)
+	assert.NoError(t, r.Close())
+	assert.Equal(t, 1, bareRepo1.catFile.batch.Idle())
+
+	tree, err := bareRepo1.GetTree("feaf4ba6bc635fec442f46ddd4512416ec43c2c2")
+	assert.NoError(t, err)
+	assert.Equal(t, commit.Tree.ID, tree.ID)
+	entries, err := tree.ListEntries()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+
+	_, err = bareRepo1.GetCommit(entry.ID.String())
+	assert.True(t, IsErrNotExist(err))
+	_, err = bareRepo1.GetBlob("0000000000000000000000000000000000000001")
+	assert.True(t, IsErrNotExist(err))
+}
+
+func TestBlob_DataAsyncReleasesProcessWhenRead(t *testing.T) {
+	repo, err := InitRepository(DefaultContext, t.TempDir(), InitWithBare(true))
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	data := strings.Repeat("large blob\n", 1000)
+	id, err := repo.HashObject(strings.NewReader(data))
+	assert.NoError(t, err)
+	blob, err := repo.GetBlob(id.String())
+	assert.NoError(t, err)
+
+	// the process streams a large blob until its content has been read, without waiting for Close
+	r, err := blob.DataAsync()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, repo.catFile.batch.Idle())
+	content, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, data, string(content))
+	assert.Equal(t, 1, repo.catFile.batch.Idle())
+	assert.NoError(t, r.Close())
+	assert.Error(t, r.Close())
+	assert.Equal(t, 1, repo.catFile.batch.Idle())
+}
+
+func TestTreeEntry_SizeWithCatFileBatchCheck(t *testing.T) {
+	bareRepo1, err := openRepositoryWithDefaultContext(filepath.Join(testReposDir, "repo1_bare"))
+	assert.NoError(t, err)
+	defer bareRepo1.Close()
+
+	tree, err := bareRepo1.GetTree("feaf4ba6bc635fec442f46ddd4512416ec43c2c2")
+	assert.NoError(t, err)
+	entries, err := tree.ListEntries()
+	assert.NoError(t, err)
+
+	// the sizes of the blobs are read together, directories have no size
+	sizes := map[string]int64{}
+	for _, entry := range entries {
+		sizes[entry.Name()] = entry.Size()
+		assert.Equal(t, 1, bareRepo1.catFile.batchCheck.Idle())
+	}
+	assert.Len(t, tree.sizes, 2)
+	assert.EqualValues(t, 6, sizes["file1.txt"])
+}
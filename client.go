@@ -0,0 +1,161 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/enverbisevac/gitlib/log"
+)
+
+// Client holds the settings git commands run with, so one process can e.g. use differently configured git binaries.
+// Commands created within a context of the client, like those of the repositories opened by Client.OpenRepository,
+// use its settings instead of the package level ones, an empty field falls back to the package level setting.
+// The package level functions keep using the package level settings.
+type Client struct {
+	// ExecutablePath is the git binary, GitExecutable if empty
+	ExecutablePath string
+	// GlobalArgs are added before the arguments of every command, e.g. "-c", "protocol.version=2"
+	GlobalArgs []CmdArg
+	// Timeout is the timeout of the commands run without one
+	Timeout time.Duration
+	// Cache is the last commit cache of the repositories, the cache passed to Initialize if nil
+	Cache Cache
+	// Logger logs the commands run, the logger set with log.SetLogger if nil
+	Logger log.Logger
+	// Tracer traces the commands run, the tracer set with SetTracer if nil
+	Tracer Tracer
+	// DryRun makes mutating operations only log what they would do, Git.DryRun enables it for every client.
+	// Writes of objects and of temporary indexes, which don't change what the refs point to, are not skipped.
+	DryRun bool
+	// GPGProgram and SSHProgram are used to sign instead of the gpg.program and gpg.ssh.program config
+	GPGProgram string
+	SSHProgram string
+	// Signer signs the commits and tags created with signing enabled but without a signer of their own,
+	// e.g. with a key kept in a KMS, instead of the programs of the signing format
+	Signer Signer
+}
+
+var clientContextKey = &contextKey{"client"}
+
+// NewClient creates a client running the git binary at executablePath, a name is looked up in PATH
+func NewClient(executablePath string) (*Client, error) {
+	absPath, err := exec.LookPath(executablePath)
+	if err != nil {
+		return nil, fmt.Errorf("git not found: %w", err)
+	}
+	return &Client{ExecutablePath: absPath}, nil
+}
+
+// clientFromContext returns the client of the context, nil means the package level settings
+func clientFromContext(ctx context.Context) *Client {
+	if ctx == nil {
+		return nil
+	}
+	client, _ := ctx.Value(clientContextKey).(*Client)
+	return client
+}
+
+// WithContext returns a context the commands created within run with the settings of the client
+func (c *Client) WithContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, clientContextKey, c)
+}
+
+// NewCommand is NewCommand with the settings of the client
+func (c *Client) NewCommand(ctx context.Context, args ...CmdArg) *Command {
+	return NewCommand(c.WithContext(ctx), args...)
+}
+
+// OpenRepository opens the repository at the given path, its commands run with the settings of the client
+func (c *Client) OpenRepository(ctx context.Context, repoPath string, opts ...OpenRepositoryOption) (*Repository, error) {
+	return OpenRepository(c.WithContext(ctx), repoPath, opts...)
+}
+
+func (c *Client) executable() string {
+	if c == nil || c.ExecutablePath == "" {
+		return GitExecutable
+	}
+	return c.ExecutablePath
+}
+
+func (c *Client) globalArgs() []CmdArg {
+	if c == nil || c.GlobalArgs == nil {
+		return globalCommandArgs
+	}
+	return c.GlobalArgs
+}
+
+func (c *Client) timeout() time.Duration {
+	if c == nil || c.Timeout <= 0 {
+		return defaultCommandExecutionTimeout
+	}
+	return c.Timeout
+}
+
+func (c *Client) cache() Cache {
+	if c == nil || c.Cache == nil {
+		return GetCache()
+	}
+	return c.Cache
+}
+
+func (c *Client) tracer() Tracer {
+	if c == nil || c.Tracer == nil {
+		return tracer
+	}
+	return c.Tracer
+}
+
+func (c *Client) signer() Signer {
+	if c == nil {
+		return nil
+	}
+	return c.Signer
+}
+
+// signingProgram returns the program the client signs in format with, empty if it has none
+func (c *Client) signingProgram(format string) string {
+	switch {
+	case c == nil:
+		return ""
+	case format == SigningFormatSSH:
+		return c.SSHProgram
+	default:
+		return c.GPGProgram
+	}
+}
+
+func (c *Client) dryRun() bool {
+	return Git.DryRun || c != nil && c.DryRun
+}
+
+// skipDryRun reports whether a mutating operation is skipped because of a dry run, logging what it would do
+func skipDryRun(ctx context.Context, format string, args ...any) bool {
+	client := clientFromContext(ctx)
+	if !client.dryRun() {
+		return false
+	}
+	client.logInfo("dry run, skipped: "+format, args...)
+	return true
+}
+
+func (c *Client) logInfo(format string, args ...any) {
+	if c == nil || c.Logger == nil {
+		log.Info(format, args...)
+		return
+	}
+	c.Logger.Info(format, args...)
+}
+
+func (c *Client) logError(format string, args ...any) {
+	if c == nil || c.Logger == nil {
+		log.Error(format, args...)
+		return
+	}
+	c.Logger.Error(format, args...)
+}
@@ -0,0 +1,153 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingLogger struct {
+	mu    sync.Mutex
+	infos []string
+}
+
+func (l *recordingLogger) Info(format string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.infos = append(l.infos, fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) Error(format string, args ...any) {}
+
+func TestClient_OpenRepository(t *testing.T) {
+	logger := &recordingLogger{}
+	client, err := NewClient("git")
+	assert.NoError(t, err)
+	client.GlobalArgs = []CmdArg{"-c", "user.name=Client Tester"}
+	client.Logger = logger
+
+	repo, err := client.OpenRepository(DefaultContext, filepath.Join(testReposDir, "repo1_bare"))
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	stdout, _, err := NewCommand(repo.Ctx, "config", "user.name").RunStdString(&RunOpts{Dir: repo.Path})
+	assert.NoError(t, err)
+	assert.Equal(t, "Client Tester", strings.TrimSpace(stdout))
+	if assert.Len(t, logger.infos, 1) {
+		assert.Contains(t, logger.infos[0], "config user.name")
+	}
+
+	// the package level settings are unchanged
+	stdout, _, err = NewCommand(DefaultContext, "config", "user.name").RunStdString(nil)
+	assert.NoError(t, err)
+	assert.NotEqual(t, "Client Tester", strings.TrimSpace(stdout))
+	assert.Len(t, logger.infos, 1)
+}
+
+func TestClient_ExecutablePath(t *testing.T) {
+	_, err := NewClient(filepath.Join(t.TempDir(), "no-git"))
+	assert.Error(t, err)
+
+	client := &Client{ExecutablePath: filepath.Join(t.TempDir(), "no-git")}
+	_, _, err = client.NewCommand(DefaultContext, "version").RunStdString(nil)
+	assert.Error(t, err)
+}
+
+func TestClient_DryRun(t *testing.T) {
+	remotePath := filepath.Join(t.TempDir(), "remote.git")
+	remote, err := InitRepository(DefaultContext, remotePath, InitWithBare(true))
+	assert.NoError(t, err)
+	defer remote.Close()
+	clonedPath, err := cloneRepo(t, filepath.Join(testReposDir, "repo1_bare"))
+	assert.NoError(t, err)
+	_, _, err = NewCommand(DefaultContext, "branch", "branch1", "origin/branch1").RunStdString(&RunOpts{Dir: clonedPath})
+	assert.NoError(t, err)
+
+	logger := &recordingLogger{}
+	client := &Client{DryRun: true, Logger: logger}
+	repo, err := client.OpenRepository(DefaultContext, clonedPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	const master = "feaf4ba6bc635fec442f46ddd4512416ec43c2c2"
+	assert.NoError(t, repo.Push(repo.Ctx, master, PushOptions{Remote: remotePath, Branch: "master"}))
+	assert.NoError(t, repo.DeleteBranch("branch1", DeleteBranchOptions{Force: true}))
+	assert.NoError(t, repo.CreateTag("dry-run", master))
+	assert.NoError(t, repo.UpdateRefs([]RefUpdate{{Action: RefActionCreate, Name: "refs/heads/dry-run", NewValue: master}}))
+	// used by cherry-pick, merge, rebase, amend and CommitTree
+	assert.NoError(t, repo.updateRef(BranchPrefix+"master", "37991dec2c8e592043f47155ce4808d4580f9123", master, "test"))
+	assert.Len(t, logger.infos, 5)
+	for _, info := range logger.infos {
+		assert.True(t, strings.HasPrefix(info, "dry run, skipped: "), info)
+	}
+
+	assert.True(t, repo.IsBranchExist("branch1"))
+	assert.False(t, repo.IsTagExist("dry-run"))
+	assert.False(t, repo.IsBranchExist("dry-run"))
+	assert.False(t, remote.IsBranchExist("master"))
+	headID, err := repo.GetBranchCommitID("master")
+	assert.NoError(t, err)
+	assert.Equal(t, master, headID)
+
+	// notes, remotes, the default branch, the working tree and maintenance are skipped too
+	realRepo, err := openRepositoryWithDefaultContext(clonedPath)
+	assert.NoError(t, err)
+	defer realRepo.Close()
+	assert.NoError(t, realRepo.SetNote(master, []byte("kept"), NoteOptions{Committer: &Signature{Name: "Test", Email: "test@example.com", When: time.Now()}}))
+	logger.infos = nil
+	assert.NoError(t, repo.SetNote(master, []byte("dry run"), NoteOptions{}))
+	assert.NoError(t, repo.RemoveNote(master, NoteOptions{}))
+	assert.NoError(t, repo.SetDefaultBranch("dry-run-default"))
+	assert.NoError(t, repo.AddRemote("dry-run", remotePath, true))
+	assert.NoError(t, repo.RemoveRemote("origin"))
+	assert.NoError(t, repo.SparseCheckoutSet([]string{"dir"}))
+	assert.NoError(t, repo.SubmoduleUpdate(SubmoduleUpdateOptions{Init: true}))
+	assert.NoError(t, WriteCommitGraph(repo.Ctx, clonedPath))
+	assert.NoError(t, Fetch(repo.Ctx, clonedPath, FetchOptions{Remote: remotePath, Refspecs: []string{"+refs/heads/*:refs/dry-run/*"}}))
+	assert.NoError(t, CommitChangesContext(repo.Ctx, clonedPath, nil, CommitChangesOptions{AllowEmpty: true, Message: "dry run"}))
+	assert.Len(t, logger.infos, 10)
+	for _, info := range logger.infos {
+		assert.True(t, strings.HasPrefix(info, "dry run, skipped: "), info)
+	}
+	note, err := realRepo.GetNote(master, NoteOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "kept\n", string(note.Message))
+	assert.False(t, realRepo.IsBranchExist("dry-run-default"))
+	remotes, _, err := NewCommand(DefaultContext, "remote").RunStdString(&RunOpts{Dir: clonedPath})
+	assert.NoError(t, err)
+	assert.Equal(t, "origin\n", remotes)
+	_, err = os.Stat(filepath.Join(clonedPath, ".git", "info", "sparse-checkout"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(clonedPath, ".git", "objects", "info", "commit-graph"))
+	assert.True(t, os.IsNotExist(err))
+
+	// the package level switch applies to every repository
+	Git.DryRun = true
+	defer func() {
+		Git.DryRun = false
+	}()
+	plainRepo, err := openRepositoryWithDefaultContext(clonedPath)
+	assert.NoError(t, err)
+	defer plainRepo.Close()
+	assert.NoError(t, plainRepo.DeleteTag("no-such-tag"))
+
+	assert.NoError(t, os.WriteFile(filepath.Join(clonedPath, "dry-run.txt"), []byte("dry run\n"), 0o644))
+	assert.NoError(t, AddChanges(clonedPath, true))
+	assert.NoError(t, CommitChanges(clonedPath, CommitChangesOptions{
+		Committer: &Signature{Name: "Test", Email: "test@example.com", When: time.Now()},
+		Message:   "dry run",
+	}))
+	headID, err = plainRepo.GetBranchCommitID("master")
+	assert.NoError(t, err)
+	assert.Equal(t, master, headID)
+}
@@ -17,7 +17,6 @@ import (
 	"time"
 	"unsafe"
 
-	"github.com/enverbisevac/gitlib/log"
 	"github.com/enverbisevac/gitlib/process"
 	"github.com/enverbisevac/gitlib/util"
 )
@@ -41,6 +40,7 @@ type Command struct {
 	desc             string
 	globalArgsLength int
 	brokenArgs       []string
+	client           *Client
 }
 
 type CmdArg string
@@ -54,20 +54,24 @@ func (c *Command) String() string {
 
 // NewCommand creates and returns a new Git Command based on given command and arguments.
 // Each argument should be safe to be trusted. User-provided arguments should be passed to AddDynamicArguments instead.
+// The executable and global arguments are those of the Client of ctx if there is one.
 func NewCommand(ctx context.Context, args ...CmdArg) *Command {
-	// Make an explicit copy of globalCommandArgs, otherwise append might overwrite it
-	cargs := make([]string, 0, len(globalCommandArgs)+len(args))
-	for _, arg := range globalCommandArgs {
+	client := clientFromContext(ctx)
+	globalArgs := client.globalArgs()
+	// Make an explicit copy of globalArgs, otherwise append might overwrite it
+	cargs := make([]string, 0, len(globalArgs)+len(args))
+	for _, arg := range globalArgs {
 		cargs = append(cargs, string(arg))
 	}
 	for _, arg := range args {
 		cargs = append(cargs, string(arg))
 	}
 	return &Command{
-		name:             GitExecutable,
+		name:             client.executable(),
 		args:             cargs,
 		parentContext:    ctx,
-		globalArgsLength: len(globalCommandArgs),
+		globalArgsLength: len(globalArgs),
+		client:           client,
 	}
 }
 
@@ -84,10 +88,12 @@ func NewCommandContextNoGlobals(ctx context.Context, args ...CmdArg) *Command {
 	for _, arg := range args {
 		cargs = append(cargs, string(arg))
 	}
+	client := clientFromContext(ctx)
 	return &Command{
-		name:          GitExecutable,
+		name:          client.executable(),
 		args:          cargs,
 		parentContext: ctx,
+		client:        client,
 	}
 }
 
@@ -174,6 +180,31 @@ type RunOpts struct {
 	Stdout, Stderr    io.Writer
 	Stdin             io.Reader
 	PipelineFunc      func(context.Context, context.CancelFunc) error
+	// Retry reruns the command while it fails on a lock file held by another process, it is ignored with a PipelineFunc
+	Retry *RetryPolicy
+}
+
+// RetryPolicy retries commands failing because a lock file like index.lock or packed-refs.lock exists.
+// Stdin is read into memory to be replayed, and the stderr of an attempt is only written once it isn't retried.
+// A command failing on a lock file does so before it writes to stdout.
+type RetryPolicy struct {
+	// Attempts is the maximum number of runs, the command isn't retried if less than 2
+	Attempts int
+	// Backoff is the wait before the first retry, it is doubled for every further retry
+	Backoff time.Duration
+}
+
+func (p *RetryPolicy) retries() bool {
+	return p != nil && p.Attempts > 1
+}
+
+// lockRetry returns Git.LockRetry for the commands updating refs or the index, nil if it doesn't retry
+func lockRetry() *RetryPolicy {
+	if !Git.LockRetry.retries() {
+		return nil
+	}
+	policy := Git.LockRetry
+	return &policy
 }
 
 func commonBaseEnvs() ([]string, error) {
@@ -221,39 +252,100 @@ var ErrBrokenCommand = errors.New("git command is broken")
 // Run runs the command with the RunOpts
 func (c *Command) Run(opts *RunOpts) error {
 	if len(c.brokenArgs) != 0 {
-		log.Error("git command is broken: %s, broken args: %s", c.String(), strings.Join(c.brokenArgs, " "))
+		c.client.logError("git command is broken: %s, broken args: %s", c.String(), strings.Join(c.brokenArgs, " "))
 		return ErrBrokenCommand
 	}
 	if opts == nil {
 		opts = &RunOpts{}
 	}
 	if opts.Timeout <= 0 {
-		opts.Timeout = defaultCommandExecutionTimeout
+		opts.Timeout = c.client.timeout()
+	}
+	if opts.Retry.retries() && opts.PipelineFunc == nil {
+		return c.runWithRetry(opts)
+	}
+	return c.run(opts)
+}
+
+// runWithRetry runs the command until it doesn't fail on lock contention or opts.Retry.Attempts are used up
+func (c *Command) runWithRetry(opts *RunOpts) error {
+	var stdin []byte
+	if opts.Stdin != nil {
+		var err error
+		if stdin, err = io.ReadAll(opts.Stdin); err != nil {
+			return err
+		}
+	}
+
+	backoff := opts.Retry.Backoff
+	for attempt := 1; ; attempt++ {
+		attemptOpts := *opts
+		if opts.Stdin != nil {
+			attemptOpts.Stdin = bytes.NewReader(stdin)
+		}
+		stderr := &bytes.Buffer{}
+		attemptOpts.Stderr = stderr
+
+		err := c.run(&attemptOpts)
+		retry := err != nil && attempt < opts.Retry.Attempts && errors.Is(err, ErrLockedRef)
+		if retry {
+			c.client.logInfo("%v: retrying in %v, attempt %d failed on a lock file: %v", c, backoff, attempt, err)
+			select {
+			case <-time.After(backoff):
+				backoff *= 2
+				continue
+			case <-c.parentContext.Done():
+			}
+		}
+		if opts.Stderr != nil {
+			if _, writeErr := opts.Stderr.Write(stderr.Bytes()); writeErr != nil && err == nil {
+				err = writeErr
+			}
+		}
+		return err
 	}
+}
 
+func (c *Command) run(opts *RunOpts) (err error) {
 	if len(opts.Dir) == 0 {
-		log.Info("%s", c)
+		c.client.logInfo("%s", c)
 	} else {
-		log.Info("%s: %v", opts.Dir, c)
+		c.client.logInfo("%s: %v", opts.Dir, c)
 	}
 
+	cmdArgs := c.sanitizedArgs()
 	desc := c.desc
 	if desc == "" {
-		args := c.args[c.globalArgsLength:]
-		var argSensitiveURLIndexes []int
-		for i, arg := range c.args {
-			if strings.Contains(arg, "://") && strings.Contains(arg, "@") {
-				argSensitiveURLIndexes = append(argSensitiveURLIndexes, i)
-			}
-		}
-		if len(argSensitiveURLIndexes) > 0 {
-			args = make([]string, len(c.args))
-			copy(args, c.args)
-			for _, urlArgIndex := range argSensitiveURLIndexes {
-				args[urlArgIndex] = util.SanitizeCredentialURLs(args[urlArgIndex])
+		desc = fmt.Sprintf("%s %s [repo_path: %s]", c.name, strings.Join(cmdArgs, " "), opts.Dir)
+	}
+
+	var cmd *exec.Cmd
+	var span CommandSpan
+	stderr := &outputSample{w: opts.Stderr}
+	parentContext := c.parentContext
+	if tracer := c.client.tracer(); tracer != nil {
+		parentContext, span = tracer.StartCommand(parentContext, CommandTrace{
+			Command: c.name + " " + strings.Join(cmdArgs, " "),
+			Dir:     opts.Dir,
+		})
+	}
+	if span != nil || commandHooks.has() {
+		start := time.Now()
+		defer func() {
+			duration, code := time.Since(start), exitCode(cmd)
+			if span != nil {
+				span.End(CommandResult{Duration: duration, ExitCode: code, Err: err})
 			}
-		}
-		desc = fmt.Sprintf("%s %s [repo_path: %s]", c.name, strings.Join(args, " "), opts.Dir)
+			commandHooks.notify(CommandEvent{
+				Name:       c.name,
+				Args:       cmdArgs,
+				Dir:        opts.Dir,
+				Duration:   duration,
+				ExitCode:   code,
+				StderrSize: stderr.size,
+				Err:        err,
+			})
+		}()
 	}
 
 	var ctx context.Context
@@ -261,13 +353,13 @@ func (c *Command) Run(opts *RunOpts) error {
 	var finished context.CancelFunc
 
 	if opts.UseContextTimeout {
-		ctx, cancel, finished = process.GetManager().AddContext(c.parentContext, desc)
+		ctx, cancel, finished = process.GetManager().AddContext(parentContext, desc)
 	} else {
-		ctx, cancel, finished = process.GetManager().AddContextTimeout(c.parentContext, opts.Timeout, desc)
+		ctx, cancel, finished = process.GetManager().AddContextTimeout(parentContext, opts.Timeout, desc)
 	}
 	defer finished()
 
-	cmd := exec.CommandContext(ctx, c.name, c.args...)
+	cmd = exec.CommandContext(ctx, c.name, c.args...)
 	if opts.Env == nil {
 		cmd.Env = os.Environ()
 	} else {
@@ -281,8 +373,14 @@ func (c *Command) Run(opts *RunOpts) error {
 	}
 	cmd.Env = append(cmd.Env, args...)
 	cmd.Dir = opts.Dir
+	// the start and the end of the output are kept to classify failures
+	var stdout *outputSample
 	cmd.Stdout = opts.Stdout
-	cmd.Stderr = opts.Stderr
+	if c.classifiesStdout() {
+		stdout = &outputSample{w: opts.Stdout}
+		cmd.Stdout = stdout
+	}
+	cmd.Stderr = stderr
 	cmd.Stdin = opts.Stdin
 	if err := cmd.Start(); err != nil {
 		return err
@@ -298,17 +396,188 @@ func (c *Command) Run(opts *RunOpts) error {
 	}
 
 	if err := cmd.Wait(); err != nil && ctx.Err() != context.DeadlineExceeded {
-		return err
+		if ctx.Err() == context.Canceled {
+			// killed because the context was canceled
+			return &classifiedError{err: err, kind: context.Canceled}
+		}
+		return c.classifyError(err, stdout.String(), stderr.String())
 	}
 
 	return ctx.Err()
 }
 
+// sanitizedArgs returns the arguments without the global ones, credentials in urls are removed
+func (c *Command) sanitizedArgs() []string {
+	args := c.args[c.globalArgsLength:]
+	sanitized := false
+	for i, arg := range args {
+		if strings.Contains(arg, "://") && strings.Contains(arg, "@") {
+			if !sanitized {
+				args = append([]string(nil), args...)
+				sanitized = true
+			}
+			args[i] = util.SanitizeCredentialURLs(arg)
+		}
+	}
+	return args
+}
+
+// exitCode returns the exit status of cmd, -1 if it didn't start or exit
+func exitCode(cmd *exec.Cmd) int {
+	if cmd == nil || cmd.ProcessState == nil {
+		return -1
+	}
+	return cmd.ProcessState.ExitCode()
+}
+
+// outputSampleSize is the amount of the start and of the end of the output of a command kept to classify its failure,
+// git prints some messages after a listing of arbitrary length, e.g. commit after the status of the files
+const outputSampleSize = 4096
+
+// outputSample writes to w, if set, keeps the first and the last outputSampleSize bytes and counts the bytes written
+type outputSample struct {
+	w      io.Writer
+	prefix []byte
+	suffix []byte
+	size   int64
+}
+
+func (p *outputSample) Write(b []byte) (int, error) {
+	p.size += int64(len(b))
+	rest := b
+	if n := outputSampleSize - len(p.prefix); n > 0 {
+		if n > len(rest) {
+			n = len(rest)
+		}
+		p.prefix = append(p.prefix, rest[:n]...)
+		rest = rest[n:]
+	}
+	if len(rest) > 0 {
+		p.suffix = append(p.suffix, rest...)
+		if extra := len(p.suffix) - outputSampleSize; extra > 0 {
+			p.suffix = append(p.suffix[:0], p.suffix[extra:]...)
+		}
+	}
+	if p.w == nil {
+		return len(b), nil
+	}
+	return p.w.Write(b)
+}
+
+func (p *outputSample) String() string {
+	if p == nil {
+		return ""
+	}
+	if len(p.suffix) == 0 {
+		return string(p.prefix)
+	}
+	// the output in between is dropped, the newline keeps a message from being matched across the gap
+	return string(p.prefix) + "\n" + string(p.suffix)
+}
+
+// errorRules map failures of git commands to the typed errors, a rule matches if all of its set fields match
+var errorRules = []struct {
+	subcommand string
+	exitCode   int
+	output     string
+	// stdout matches the output in stdout instead of stderr, it must be limited to a subcommand
+	stdout bool
+	err    error
+}{
+	{output: "no merge base", err: ErrNoMergeBase},
+	{output: ".lock': File exists", err: ErrLockedRef},
+	{subcommand: "commit", exitCode: 1, output: "nothing to commit", stdout: true, err: ErrNothingToCommit},
+	{subcommand: "commit", exitCode: 1, output: "nothing added to commit", stdout: true, err: ErrNothingToCommit},
+	{subcommand: "commit", exitCode: 1, output: "no changes added to commit", stdout: true, err: ErrNothingToCommit},
+	{output: "unknown revision", err: ErrUnknownRevision},
+	{output: "bad revision", err: ErrUnknownRevision},
+	{output: "Needed a single revision", err: ErrUnknownRevision},
+	{output: "Not a valid object name", err: ErrUnknownRevision},
+}
+
+// classifiedError is a failure of a git command matching one of the errorRules,
+// errors.Is reports the typed error while the message and the unwrapped error are unchanged
+type classifiedError struct {
+	err  error
+	kind error
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Unwrap() error {
+	return e.err
+}
+
+func (e *classifiedError) Is(target error) bool {
+	return target == e.kind
+}
+
+// subcommand returns the git subcommand, skipping the global arguments and options like -c
+func (c *Command) subcommand() string {
+	for i := c.globalArgsLength; i < len(c.args); i++ {
+		switch arg := c.args[i]; {
+		case arg == "-c" || arg == "-C":
+			i++
+		case !strings.HasPrefix(arg, "-"):
+			return arg
+		}
+	}
+	return ""
+}
+
+// classifiesStdout reports whether a failure of the command is classified by its stdout
+func (c *Command) classifiesStdout() bool {
+	for _, rule := range errorRules {
+		if rule.stdout && rule.subcommand == c.subcommand() {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Command) classifyError(err error, stdout, stderr string) error {
+	exitCode := 0
+	var exitError *exec.ExitError
+	if errors.As(err, &exitError) {
+		exitCode = exitError.ExitCode()
+	}
+	for _, rule := range errorRules {
+		if rule.subcommand != "" && rule.subcommand != c.subcommand() {
+			continue
+		}
+		if rule.exitCode != 0 && rule.exitCode != exitCode {
+			continue
+		}
+		output := stderr
+		if rule.stdout {
+			output = stdout
+		}
+		if strings.Contains(output, rule.output) {
+			return &classifiedError{err: err, kind: rule.err}
+		}
+	}
+	return err
+}
+
 type RunStdError interface {
 	error
 	Unwrap() error
 	Stderr() string
 	IsExitCode(code int) bool
+	// Class returns the typed error the failure is classified as, e.g. ErrUnknownRevision, or nil
+	Class() error
+	// Message returns the fatal or error messages of git without their prefix
+	Message() string
+	// RemoteMessages returns the lines the remote sent, without the "remote: " prefix
+	RemoteMessages() []string
+	// Hints returns the hint lines of git, without the "hint: " prefix
+	Hints() []string
+	// IsTimeout reports whether the command was killed because it exceeded its timeout
+	IsTimeout() bool
+	// IsCanceled reports whether the command was killed because its context was canceled
+	IsCanceled() bool
 }
 
 type runStdError struct {
@@ -341,6 +610,50 @@ func (r *runStdError) IsExitCode(code int) bool {
 	return false
 }
 
+func (r *runStdError) Class() error {
+	var classified *classifiedError
+	if errors.As(r.err, &classified) && classified.kind != context.Canceled {
+		return classified.kind
+	}
+	return nil
+}
+
+// stderrLines returns the stderr lines starting with one of the prefixes, with the prefix removed
+func (r *runStdError) stderrLines(prefixes ...string) []string {
+	var lines []string
+	// progress is overwritten with carriage returns
+	for _, line := range strings.FieldsFunc(r.stderr, func(c rune) bool { return c == '\n' || c == '\r' }) {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(line, prefix) {
+				// the remote clears the rest of the line of its progress messages
+				lines = append(lines, strings.TrimRight(strings.TrimSuffix(line[len(prefix):], "\x1b[K"), " "))
+				break
+			}
+		}
+	}
+	return lines
+}
+
+func (r *runStdError) Message() string {
+	return strings.Join(r.stderrLines("fatal: ", "error: "), "\n")
+}
+
+func (r *runStdError) RemoteMessages() []string {
+	return r.stderrLines("remote: ")
+}
+
+func (r *runStdError) Hints() []string {
+	return r.stderrLines("hint: ")
+}
+
+func (r *runStdError) IsTimeout() bool {
+	return errors.Is(r.err, context.DeadlineExceeded)
+}
+
+func (r *runStdError) IsCanceled() bool {
+	return errors.Is(r.err, context.Canceled)
+}
+
 func bytesToString(b []byte) string {
 	return *(*string)(unsafe.Pointer(&b)) // that's what Golang's strings.Builder.String() does (go/src/strings/builder.go)
 }
@@ -379,6 +692,94 @@ func (c *Command) RunStdBytes(opts *RunOpts) (stdout, stderr []byte, runErr RunS
 	return stdoutBuf.Bytes(), stderr, nil
 }
 
+// RunWithStdoutReader starts the command and returns its stdout to be read while it runs, opts.Stdout and opts.Stderr must be nil.
+// Once the output is read, a failed command returns its error, with its stderr, instead of io.EOF.
+// The reader must be closed, which kills the command if its output is not read completely and waits for it to exit.
+func (c *Command) RunWithStdoutReader(opts *RunOpts) (io.ReadCloser, error) {
+	if opts == nil {
+		opts = &RunOpts{}
+	}
+	if opts.Stdout != nil || opts.Stderr != nil {
+		panic("stdout and stderr field must be nil when using RunWithStdoutReader")
+	}
+	runOpts := *opts
+	pipeReader, pipeWriter := io.Pipe()
+	stderr := &bytes.Buffer{}
+	runOpts.Stdout, runOpts.Stderr = pipeWriter, stderr
+
+	reader := &commandStdoutReader{PipeReader: pipeReader, done: make(chan struct{})}
+	go func() {
+		defer close(reader.done)
+		if err := c.Run(&runOpts); err != nil {
+			_ = pipeWriter.CloseWithError(ConcatenateError(err, stderr.String()))
+			return
+		}
+		_ = pipeWriter.Close()
+	}()
+	return reader, nil
+}
+
+type commandStdoutReader struct {
+	*io.PipeReader
+	done chan struct{}
+}
+
+func (r *commandStdoutReader) Close() error {
+	err := r.PipeReader.Close()
+	<-r.done
+	return err
+}
+
+// RunWithStdinWriter starts the command and returns its stdin to be written while it runs, opts.Stdin and opts.Stderr must be nil.
+// Closing the writer ends the input and waits for the command to exit, it returns the error of the command with its stderr.
+func (c *Command) RunWithStdinWriter(opts *RunOpts) (io.WriteCloser, error) {
+	if opts == nil {
+		opts = &RunOpts{}
+	}
+	if opts.Stdin != nil || opts.Stderr != nil {
+		panic("stdin and stderr field must be nil when using RunWithStdinWriter")
+	}
+	runOpts := *opts
+	// an os.Pipe as io.Pipe would block exec.Cmd.Wait until the writer is closed
+	pipeReader, pipeWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr := &bytes.Buffer{}
+	runOpts.Stdin, runOpts.Stderr = pipeReader, stderr
+	pipelineFunc := opts.PipelineFunc
+	runOpts.PipelineFunc = func(ctx context.Context, cancel context.CancelFunc) error {
+		// the command has its own copy of the read end
+		_ = pipeReader.Close()
+		if pipelineFunc != nil {
+			return pipelineFunc(ctx, cancel)
+		}
+		return nil
+	}
+
+	writer := &commandStdinWriter{File: pipeWriter, done: make(chan struct{})}
+	go func() {
+		defer close(writer.done)
+		if err := c.Run(&runOpts); err != nil {
+			writer.err = ConcatenateError(err, stderr.String())
+		}
+		_ = pipeReader.Close()
+	}()
+	return writer, nil
+}
+
+type commandStdinWriter struct {
+	*os.File
+	done chan struct{}
+	err  error
+}
+
+func (w *commandStdinWriter) Close() error {
+	_ = w.File.Close()
+	<-w.done
+	return w.err
+}
+
 // AllowLFSFiltersArgs return globalCommandArgs with lfs filter, it should only be used for tests
 func AllowLFSFiltersArgs() []CmdArg {
 	// Now here we should explicitly allow lfs filters to run
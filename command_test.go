@@ -5,8 +5,14 @@
 package git
 
 import (
+	"bytes"
 	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -42,3 +48,187 @@ func TestRunWithContextStd(t *testing.T) {
 	assert.Empty(t, stderr)
 	assert.Contains(t, stdout, "git version")
 }
+
+func TestCommandErrorClassification(t *testing.T) {
+	bareRepo1Path := filepath.Join(testReposDir, "repo1_bare")
+
+	_, _, runErr := NewCommand(DefaultContext, "rev-parse", "--verify").AddDynamicArguments("no-such-branch").RunStdString(&RunOpts{Dir: bareRepo1Path})
+	assert.ErrorIs(t, runErr, ErrUnknownRevision)
+	assert.True(t, runErr.IsExitCode(128))
+
+	// the notes have an unrelated history
+	stderr := new(bytes.Buffer)
+	err := NewCommand(DefaultContext, "diff", "--name-only").AddDynamicArguments("master...refs/notes/commits").
+		Run(&RunOpts{Dir: bareRepo1Path, Stderr: stderr})
+	assert.ErrorIs(t, err, ErrNoMergeBase)
+	assert.NotErrorIs(t, err, ErrUnknownRevision)
+	assert.Contains(t, stderr.String(), "no merge base")
+
+	clonedPath, err := cloneRepo(t, bareRepo1Path)
+	assert.NoError(t, err)
+	_, _, err = NewCommand(DefaultContext, "-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "-m", "nothing").RunStdString(&RunOpts{Dir: clonedPath})
+	assert.ErrorIs(t, err, ErrNothingToCommit)
+
+	// only unstaged changes
+	assert.NoError(t, os.WriteFile(filepath.Join(clonedPath, "file1.txt"), []byte("changed\n"), 0o644))
+	_, _, err = NewCommand(DefaultContext, "-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "-m", "unstaged").RunStdString(&RunOpts{Dir: clonedPath})
+	assert.ErrorIs(t, err, ErrNothingToCommit)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(clonedPath, ".git", "refs", "heads", "master.lock"), nil, 0o644))
+	_, _, err = NewCommand(DefaultContext, "update-ref", "refs/heads/master", "HEAD~1").RunStdString(&RunOpts{Dir: clonedPath})
+	assert.ErrorIs(t, err, ErrLockedRef)
+}
+
+func TestRunStdErrorFields(t *testing.T) {
+	bareRepo1Path := filepath.Join(testReposDir, "repo1_bare")
+	remotePath := filepath.Join(t.TempDir(), "remote.git")
+	_, _, err := NewCommand(DefaultContext, "clone", "--bare").AddDynamicArguments(bareRepo1Path, remotePath).RunStdString(nil)
+	assert.NoError(t, err)
+	hook := "#!/bin/sh\necho 'branch is protected' >&2\nexit 1\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(remotePath, "hooks", "pre-receive"), []byte(hook), 0o755))
+
+	_, _, runErr := NewCommand(DefaultContext, "push").AddDynamicArguments(remotePath, "branch1:refs/heads/new").RunStdString(&RunOpts{Dir: bareRepo1Path})
+	if assert.Error(t, runErr) {
+		assert.Equal(t, []string{"branch is protected"}, runErr.RemoteMessages())
+		assert.Contains(t, runErr.Message(), "failed to push some refs")
+		assert.False(t, runErr.IsTimeout())
+		assert.False(t, runErr.IsCanceled())
+		assert.NoError(t, runErr.Class())
+	}
+
+	// a non fast-forward push is rejected with hints before running the hook
+	_, _, runErr = NewCommand(DefaultContext, "push").AddDynamicArguments(remotePath, "branch1:refs/heads/master").RunStdString(&RunOpts{Dir: bareRepo1Path})
+	if assert.Error(t, runErr) {
+		assert.Empty(t, runErr.RemoteMessages())
+		assert.NotEmpty(t, runErr.Hints())
+	}
+
+	_, _, runErr = NewCommand(DefaultContext, "rev-parse", "--verify").AddDynamicArguments("no-such-branch").RunStdString(&RunOpts{Dir: bareRepo1Path})
+	if assert.Error(t, runErr) {
+		assert.Equal(t, ErrUnknownRevision, runErr.Class())
+		assert.Equal(t, "Needed a single revision", runErr.Message())
+	}
+
+	// cat-file waits for input until it is killed
+	stdin, stdinWriter, pipeErr := os.Pipe()
+	assert.NoError(t, pipeErr)
+	defer stdin.Close()
+	defer stdinWriter.Close()
+	_, _, runErr = NewCommand(DefaultContext, "cat-file", "--batch").RunStdString(&RunOpts{Dir: bareRepo1Path, Stdin: stdin, Timeout: 100 * time.Millisecond})
+	if assert.Error(t, runErr) {
+		assert.True(t, runErr.IsTimeout())
+		assert.False(t, runErr.IsCanceled())
+	}
+
+	ctx, cancel := context.WithCancel(DefaultContext)
+	time.AfterFunc(100*time.Millisecond, cancel)
+	_, _, runErr = NewCommand(ctx, "cat-file", "--batch").RunStdString(&RunOpts{Dir: bareRepo1Path, Stdin: stdin})
+	if assert.Error(t, runErr) {
+		assert.True(t, runErr.IsCanceled())
+		assert.False(t, runErr.IsTimeout())
+		assert.NoError(t, runErr.Class())
+	}
+}
+
+func TestRunRetryOnLockContention(t *testing.T) {
+	clonedPath, err := cloneRepo(t, filepath.Join(testReposDir, "repo1_bare"))
+	assert.NoError(t, err)
+	lockPath := filepath.Join(clonedPath, ".git", "refs", "heads", "locked.lock")
+	updateRef := func(retry *RetryPolicy) error {
+		_, _, err := NewCommand(context.Background(), "update-ref", "refs/heads/locked", "feaf4ba6bc635fec442f46ddd4512416ec43c2c2").
+			RunStdString(&RunOpts{Dir: clonedPath, Retry: retry})
+		return err
+	}
+
+	assert.NoError(t, os.WriteFile(lockPath, nil, 0o644))
+	err = updateRef(nil)
+	assert.ErrorIs(t, err, ErrLockedRef)
+	err = updateRef(&RetryPolicy{Attempts: 2, Backoff: 10 * time.Millisecond})
+	assert.ErrorIs(t, err, ErrLockedRef)
+
+	// the lock is released while the command is retried
+	time.AfterFunc(100*time.Millisecond, func() {
+		_ = os.Remove(lockPath)
+	})
+	assert.NoError(t, updateRef(&RetryPolicy{Attempts: 10, Backoff: 20 * time.Millisecond}))
+
+	// a ref not having the expected value isn't retried
+	start := time.Now()
+	_, _, err = NewCommand(context.Background(), "update-ref", "refs/heads/locked", "feaf4ba6bc635fec442f46ddd4512416ec43c2c2", "2839944139e0de9737a044f78b0e4b40d53a014e").
+		RunStdString(&RunOpts{Dir: clonedPath, Retry: &RetryPolicy{Attempts: 5, Backoff: time.Second}})
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrLockedRef)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestRepository_UpdateRefsLockRetry(t *testing.T) {
+	oldRetry := Git.LockRetry
+	Git.LockRetry = RetryPolicy{Attempts: 10, Backoff: 20 * time.Millisecond}
+	defer func() {
+		Git.LockRetry = oldRetry
+	}()
+
+	clonedPath, err := cloneRepo(t, filepath.Join(testReposDir, "repo1_bare"))
+	assert.NoError(t, err)
+	repo, err := openRepositoryWithDefaultContext(clonedPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	lockPath := filepath.Join(clonedPath, ".git", "refs", "heads", "retried.lock")
+	assert.NoError(t, os.WriteFile(lockPath, nil, 0o644))
+	time.AfterFunc(100*time.Millisecond, func() {
+		_ = os.Remove(lockPath)
+	})
+	assert.NoError(t, repo.UpdateRefs([]RefUpdate{{
+		Action:   RefActionCreate,
+		Name:     "refs/heads/retried",
+		NewValue: "feaf4ba6bc635fec442f46ddd4512416ec43c2c2",
+	}}))
+	id, err := repo.GetRefCommitID("refs/heads/retried")
+	assert.NoError(t, err)
+	assert.Equal(t, "feaf4ba6bc635fec442f46ddd4512416ec43c2c2", id)
+}
+
+func TestRunWithStdoutReader(t *testing.T) {
+	repoPath := filepath.Join(testReposDir, "repo1_bare")
+
+	stdout, err := NewCommand(context.Background(), "rev-list", "master").RunWithStdoutReader(&RunOpts{Dir: repoPath})
+	assert.NoError(t, err)
+	output, err := io.ReadAll(stdout)
+	assert.NoError(t, err)
+	assert.NoError(t, stdout.Close())
+	assert.Len(t, strings.Fields(string(output)), 6)
+
+	// the error of the command is returned once the output is read
+	stdout, err = NewCommand(context.Background(), "rev-list", "no-such-branch").RunWithStdoutReader(&RunOpts{Dir: repoPath})
+	assert.NoError(t, err)
+	_, err = io.ReadAll(stdout)
+	assert.ErrorIs(t, err, ErrUnknownRevision)
+	assert.Contains(t, err.Error(), "no-such-branch")
+	assert.NoError(t, stdout.Close())
+
+	// closing early stops the command
+	stdout, err = NewCommand(context.Background(), "rev-list", "--objects", "--all").RunWithStdoutReader(&RunOpts{Dir: repoPath})
+	assert.NoError(t, err)
+	_, err = stdout.Read(make([]byte, 1))
+	assert.NoError(t, err)
+	assert.NoError(t, stdout.Close())
+}
+
+func TestRunWithStdinWriter(t *testing.T) {
+	stdout := new(bytes.Buffer)
+	stdin, err := NewCommand(context.Background(), "hash-object", "--stdin").RunWithStdinWriter(&RunOpts{Stdout: stdout})
+	assert.NoError(t, err)
+	_, err = io.WriteString(stdin, "hello\n")
+	assert.NoError(t, err)
+	assert.NoError(t, stdin.Close())
+	assert.Equal(t, "ce013625030ba8dba906f756967f9e9ca394464a\n", stdout.String())
+
+	// closing returns the error of the command with its stderr
+	stdin, err = NewCommand(context.Background(), "hash-object", "--stdin", "-t", "no-such-type").RunWithStdinWriter(nil)
+	assert.NoError(t, err)
+	_, _ = io.WriteString(stdin, "hello\n")
+	err = stdin.Close()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no-such-type")
+}
@@ -7,38 +7,96 @@ package git
 
 import (
 	"bufio"
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
 	"strconv"
 	"strings"
 
 	"github.com/enverbisevac/gitlib/log"
 	"github.com/enverbisevac/gitlib/util"
-	cgobject "github.com/go-git/go-git/v5/plumbing/object/commitgraph"
 )
 
 // Commit represents a git commit.
 type Commit struct {
 	Branch string // Branch this commit belongs to
 	Tree
-	ID            SHA1 // The ID of this commit object
+	ID            ObjectID // The ID of this commit object
 	Author        *Signature
 	Committer     *Signature
 	CommitMessage string
 	Signature     *CommitGPGSignature
 
-	Parents        []SHA1 // SHA1 strings
-	submoduleCache *ObjectCache
+	Parents []ObjectID // The IDs of the parent commits
+	// ExtraHeaders are the headers following the committer, like encoding and mergetag, in their order
+	ExtraHeaders []CommitHeader
+	// rawAuthor and rawCommitter are the values of the author and committer headers as read, only kept if
+	// encoding Author or Committer doesn't give the same bytes, as SignaturePayload must reproduce them exactly
+	rawAuthor, rawCommitter string
+	submoduleCache          *ObjectCache
+}
+
+// CommitHeader is a header of a commit object other than tree, parent, author, committer and the signature
+type CommitHeader struct {
+	Name string
+	// Value spans multiple lines for headers like mergetag, without the space the continuation lines start with
+	Value string
 }
 
 // CommitGPGSignature represents a git commit signature part.
 type CommitGPGSignature struct {
 	Signature string
-	Payload   string // TODO check if can be reconstruct from the rest of commit information to not have duplicate data
+	// Payload is the data which was signed, the object without its signature. It is set for tags,
+	// commits read from git leave it empty and reconstruct it with Commit.SignaturePayload instead.
+	Payload string
+}
+
+// SignaturePayload returns the data the signature of the commit was made over, the commit object without its signature.
+// Unless the signature holds it, it is reconstructed from the tree, parents, author, committer, extra headers
+// and message, with the author and committer as read if they are not canonically encoded.
+func (c *Commit) SignaturePayload() string {
+	if c.Signature != nil && c.Signature.Payload != "" {
+		return c.Signature.Payload
+	}
+
+	var w strings.Builder
+	fmt.Fprintf(&w, "tree %s\n", c.Tree.ID)
+	for _, parent := range c.Parents {
+		fmt.Fprintf(&w, "parent %s\n", parent)
+	}
+	for _, header := range []struct {
+		name      string
+		signature *Signature
+		raw       string
+	}{{"author", c.Author, c.rawAuthor}, {"committer", c.Committer, c.rawCommitter}} {
+		switch {
+		case header.raw != "":
+			w.WriteString(header.name + " " + header.raw)
+		case header.signature != nil:
+			w.WriteString(header.name + " ")
+			_ = header.signature.Encode(&w)
+		default:
+			continue
+		}
+		w.WriteByte('\n')
+	}
+	for _, header := range c.ExtraHeaders {
+		w.WriteString(header.Name + " " + strings.ReplaceAll(header.Value, "\n", "\n ") + "\n")
+	}
+	w.WriteByte('\n')
+	w.WriteString(c.CommitMessage)
+	return w.String()
+}
+
+// signature returns the signature of the commit with its payload, nil if it is unsigned
+func (c *Commit) signature() *CommitGPGSignature {
+	if c.Signature == nil {
+		return nil
+	}
+	return &CommitGPGSignature{Signature: c.Signature.Signature, Payload: c.SignaturePayload()}
 }
 
 // Message returns the commit message. Same as retrieving CommitMessage directly.
@@ -53,9 +111,9 @@ func (c *Commit) Summary() string {
 
 // ParentID returns oid of n-th parent (0-based index).
 // It returns nil if no such parent exists.
-func (c *Commit) ParentID(n int) (SHA1, error) {
+func (c *Commit) ParentID(n int) (ObjectID, error) {
 	if n >= len(c.Parents) {
-		return SHA1{}, ErrNotExist{"", ""}
+		return nil, ErrNotExist{"", ""}
 	}
 	return c.Parents[n], nil
 }
@@ -92,17 +150,29 @@ func (c *Commit) CacheCommit(ctx context.Context) error {
 	if c.repo.LastCommitCache == nil {
 		return nil
 	}
+	if c.repo.backendFor(OperationHistory, BackendGoGit, BackendCLI) == BackendCLI {
+		return c.recursiveCache(&c.Tree, "", 1, func(treePath string, entryPaths []string) (map[string]*Commit, error) {
+			return c.repo.LastCommitCache.GetLastCommitsForPaths(c.ID.String(), treePath, entryPaths)
+		})
+	}
+	hash, err := gogitHash(c.ID)
+	if err != nil {
+		return err
+	}
 	commitNodeIndex, _ := c.repo.CommitNodeIndex()
 
-	index, err := commitNodeIndex.Get(c.ID)
+	index, err := commitNodeIndex.Get(hash)
 	if err != nil {
 		return err
 	}
 
-	return c.recursiveCache(ctx, index, &c.Tree, "", 1)
+	return c.recursiveCache(&c.Tree, "", 1, func(treePath string, entryPaths []string) (map[string]*Commit, error) {
+		return GetLastCommitForPaths(ctx, c.repo.LastCommitCache, index, treePath, entryPaths)
+	})
 }
 
-func (c *Commit) recursiveCache(ctx context.Context, index cgobject.CommitNode, tree *Tree, treePath string, level int) error {
+// recursiveCache caches the last commits of the entries of tree found by lastCommits and of the subtrees up to level
+func (c *Commit) recursiveCache(tree *Tree, treePath string, level int, lastCommits func(treePath string, entryPaths []string) (map[string]*Commit, error)) error {
 	if level == 0 {
 		return nil
 	}
@@ -119,7 +189,7 @@ func (c *Commit) recursiveCache(ctx context.Context, index cgobject.CommitNode,
 		entryMap[entry.Name()] = entry
 	}
 
-	commits, err := GetLastCommitForPaths(ctx, c.repo.LastCommitCache, index, treePath, entryPaths)
+	commits, err := lastCommits(treePath, entryPaths)
 	if err != nil {
 		return err
 	}
@@ -130,7 +200,7 @@ func (c *Commit) recursiveCache(ctx context.Context, index cgobject.CommitNode,
 			if err != nil {
 				return err
 			}
-			if err := c.recursiveCache(ctx, index, subTree, entry, level-1); err != nil {
+			if err := c.recursiveCache(subTree, entry, level-1, lastCommits); err != nil {
 				return err
 			}
 		}
@@ -145,7 +215,11 @@ func AddChanges(repoPath string, all bool, files ...string) error {
 }
 
 // AddChangesWithArgs marks local changes to be ready for commit.
+// It has no context, only Git.DryRun skips it.
 func AddChangesWithArgs(repoPath string, globalArgs []CmdArg, all bool, files ...string) error {
+	if skipDryRun(DefaultContext, "add changes %v (all: %t) [repo_path: %s]", files, all, repoPath) {
+		return nil
+	}
 	cmd := NewCommandNoGlobals(append(globalArgs, "add")...)
 	if all {
 		cmd.AddArguments("--all")
@@ -160,6 +234,17 @@ type CommitChangesOptions struct {
 	Committer *Signature
 	Author    *Signature
 	Message   string
+	// AllowEmpty creates the commit even if nothing changed
+	AllowEmpty bool
+	// Orphan is the name of a new branch, which gets the commit without parents, like git checkout --orphan
+	Orphan string
+	// Sign signs the commit with KeyID or user.signingkey, otherwise commit.gpgsign decides
+	Sign  bool
+	KeyID string
+	// SigningFormat is SigningFormatOpenPGP or SigningFormatSSH, gpg.format is used if empty
+	SigningFormat string
+	// Signer signs the commit instead of the program configured for the SigningFormat, it implies Sign
+	Signer Signer
 }
 
 // CommitChanges commits local changes with given committer, author and message.
@@ -172,27 +257,130 @@ func CommitChanges(repoPath string, opts CommitChangesOptions) error {
 
 // CommitChangesWithArgs commits local changes with given committer, author and message.
 // If author is nil, it will be the same as committer.
+// It has no context, only Git.DryRun skips it, see CommitChangesContext.
 func CommitChangesWithArgs(repoPath string, args []CmdArg, opts CommitChangesOptions) error {
-	cmd := NewCommandNoGlobals(args...)
-	if opts.Committer != nil {
-		cmd.AddArguments("-c", CmdArg("user.name="+opts.Committer.Name), "-c", CmdArg("user.email="+opts.Committer.Email))
+	return CommitChangesContext(DefaultContext, repoPath, args, opts)
+}
+
+// CommitChangesContext commits local changes like CommitChangesWithArgs, the commands run with ctx
+// and the client of ctx, e.g. its dry run.
+func CommitChangesContext(ctx context.Context, repoPath string, args []CmdArg, opts CommitChangesOptions) error {
+	// this includes switching to the orphan branch and signing HEAD
+	if skipDryRun(ctx, "commit changes %q (orphan: %s) [repo_path: %s]", strings.SplitN(opts.Message, "\n", 2)[0], opts.Orphan, repoPath) {
+		return nil
+	}
+	committed := false
+	if opts.Orphan != "" {
+		restoreHead, err := switchToOrphanBranch(ctx, repoPath, args, opts.Orphan)
+		if err != nil {
+			return err
+		}
+		// HEAD is switched back unless the commit was created on the orphan branch
+		defer func() {
+			if !committed {
+				restoreHead()
+			}
+		}()
+	}
+
+	cmd := NewCommandContextNoGlobals(ctx, args...)
+	if opts.SigningFormat != "" {
+		cmd.AddArguments("-c").AddDynamicArguments("gpg.format=" + opts.SigningFormat)
 	}
 	cmd.AddArguments("commit")
 
 	if opts.Author == nil {
 		opts.Author = opts.Committer
 	}
-	if opts.Author != nil {
-		cmd.AddArguments(CmdArg(fmt.Sprintf("--author='%s <%s>'", opts.Author.Name, opts.Author.Email)))
+	if opts.AllowEmpty {
+		cmd.AddArguments("--allow-empty")
+	}
+	switch {
+	case opts.Signer != nil:
+		// the signer signs the unsigned commit afterwards
+		cmd.AddArguments("--no-gpg-sign")
+	case opts.Sign:
+		cmd.AddArguments(CmdArg("-S" + opts.KeyID))
 	}
 	cmd.AddArguments("-m").AddDynamicArguments(opts.Message)
 
-	_, _, err := cmd.RunStdString(&RunOpts{Dir: repoPath})
-	// No stderr but exit status 1 means nothing to commit.
-	if err != nil && err.Error() == "exit status 1" {
+	var env []string
+	if opts.Author != nil || opts.Committer != nil {
+		env = append(os.Environ(), SignatureEnv(opts.Author, opts.Committer)...)
+	}
+	_, _, err := cmd.RunStdString(&RunOpts{Dir: repoPath, Env: env})
+	if errors.Is(err, ErrNothingToCommit) {
 		return nil
 	}
-	return err
+	if err != nil {
+		return err
+	}
+	committed = true
+	if opts.Signer == nil {
+		return nil
+	}
+	return signHead(ctx, repoPath, args, opts.Signer, opts.Message)
+}
+
+// switchToOrphanBranch points HEAD to the new branch orphan without creating it, like git checkout --orphan.
+// The returned function points HEAD back to the previous branch, or to the previous commit if HEAD was detached.
+func switchToOrphanBranch(ctx context.Context, repoPath string, args []CmdArg, orphan string) (func(), error) {
+	branch := BranchPrefix + orphan
+	if _, _, err := NewCommandContextNoGlobals(ctx, args...).AddArguments("show-ref", "--verify", "--quiet").AddDynamicArguments(branch).
+		RunStdString(&RunOpts{Dir: repoPath}); err == nil {
+		return nil, fmt.Errorf("unable to create orphan branch: %s already exists", orphan)
+	}
+
+	previous, _, err := NewCommandContextNoGlobals(ctx, args...).AddArguments("symbolic-ref", "-q", "HEAD").RunStdString(&RunOpts{Dir: repoPath})
+	detached := err != nil
+	if detached {
+		var stderr string
+		if previous, stderr, err = NewCommandContextNoGlobals(ctx, args...).AddArguments("rev-parse", "--verify", "HEAD").RunStdString(&RunOpts{Dir: repoPath}); err != nil {
+			return nil, fmt.Errorf("unable to read HEAD: %w", ConcatenateError(err, stderr))
+		}
+	}
+	previous = strings.TrimSpace(previous)
+
+	if _, stderr, err := NewCommandContextNoGlobals(ctx, args...).AddArguments("symbolic-ref", "HEAD").AddDynamicArguments(branch).
+		RunStdString(&RunOpts{Dir: repoPath}); err != nil {
+		return nil, fmt.Errorf("unable to switch to orphan branch %s: %w", orphan, ConcatenateError(err, stderr))
+	}
+
+	return func() {
+		// HEAD is restored even if ctx is done
+		cmd := NewCommandNoGlobals(args...)
+		if detached {
+			cmd.AddArguments("update-ref", "--no-deref", "HEAD").AddDynamicArguments(previous)
+		} else {
+			cmd.AddArguments("symbolic-ref", "HEAD").AddDynamicArguments(previous)
+		}
+		if _, stderr, err := cmd.RunStdString(&RunOpts{Dir: repoPath}); err != nil {
+			log.Error("Unable to restore HEAD of %s to %s: %v", repoPath, previous, ConcatenateError(err, stderr))
+		}
+	}, nil
+}
+
+// signHead replaces the commit of HEAD with a copy signed by signer
+func signHead(ctx context.Context, repoPath string, args []CmdArg, signer Signer, message string) error {
+	stdout, stderr, runErr := NewCommandContextNoGlobals(ctx, args...).AddArguments("rev-parse", "--verify", "HEAD").RunStdString(&RunOpts{Dir: repoPath})
+	if runErr != nil {
+		return ConcatenateError(runErr, stderr)
+	}
+	oldID := strings.TrimSpace(stdout)
+	id, err := NewObjectIDFromString(oldID)
+	if err != nil {
+		return err
+	}
+	signedID, err := signCommit(ctx, repoPath, id, signer)
+	if err != nil {
+		return err
+	}
+	if _, stderr, err := NewCommandContextNoGlobals(ctx, args...).AddArguments("update-ref", "-m").
+		AddDynamicArguments("commit (signed): "+strings.SplitN(message, "\n", 2)[0], "HEAD", signedID.String(), oldID).
+		RunStdString(&RunOpts{Dir: repoPath}); err != nil {
+		return fmt.Errorf("unable to update HEAD to the signed commit: %w", ConcatenateError(err, stderr))
+	}
+	return nil
 }
 
 // AllCommitsCount returns count of all commits in repository
@@ -235,6 +423,13 @@ func CommitsCount(ctx context.Context, repoPath string, revision ...string) (int
 	return CommitsCountFiles(ctx, repoPath, revision, []string{})
 }
 
+// WithContext returns a copy of the commit whose methods run their commands within ctx, see Repository.WithContext
+func (c *Commit) WithContext(ctx context.Context) *Commit {
+	commit := *c
+	commit.repo = c.repo.WithContext(ctx)
+	return &commit
+}
+
 // CommitsCount returns number of total commits of until current revision.
 func (c *Commit) CommitsCount() (int64, error) {
 	return CommitsCount(c.repo.Ctx, c.repo.Path, c.ID.String())
@@ -251,7 +446,7 @@ func (c *Commit) CommitsBefore() ([]*Commit, error) {
 }
 
 // HasPreviousCommit returns true if a given commitHash is contained in commit's parents
-func (c *Commit) HasPreviousCommit(commitHash SHA1) (bool, error) {
+func (c *Commit) HasPreviousCommit(commitHash ObjectID) (bool, error) {
 	this := c.ID.String()
 	that := commitHash.String()
 
@@ -292,6 +487,17 @@ type SearchCommitsOptions struct {
 	Authors, Committers []string
 	After, Before       string
 	All                 bool
+	// DiffContains finds commits changing the number of occurrences of the string (git log -S)
+	DiffContains string
+	// DiffMatchesRegex finds commits whose diff adds or removes lines matching the regex (git log -G)
+	DiffMatchesRegex string
+	// RegexKeywords matches keywords, authors and committers as extended regexes instead of basic ones
+	RegexKeywords bool
+	// FixedStrings matches keywords, authors and committers as fixed strings, unless RegexKeywords is set
+	FixedStrings bool
+	// Page is 1-based, PageSize defaults to 100
+	Page     int
+	PageSize int
 }
 
 // NewSearchCommitsOptions construct a SearchCommitsOption from a space-delimited search string
@@ -325,8 +531,9 @@ func NewSearchCommitsOptions(searchString string, forAllRefs bool) SearchCommits
 	}
 }
 
-// SearchCommits returns the commits match the keyword before current revision
-func (c *Commit) SearchCommits(opts SearchCommitsOptions) ([]*Commit, error) {
+// SearchCommits returns the requested page of the commits match the keyword before current revision,
+// and the total count of matching commits
+func (c *Commit) SearchCommits(opts SearchCommitsOptions) ([]*Commit, int, error) {
 	return c.repo.searchCommits(c.ID, opts)
 }
 
@@ -335,6 +542,12 @@ func (c *Commit) GetFilesChangedSinceCommit(pastCommit string) ([]string, error)
 	return c.repo.getFilesChanged(pastCommit, c.ID.String())
 }
 
+// GetFileStatusSinceCommit returns the status of the files changed between pastCommit and current revision,
+// see Repository.GetFileStatusBetween for the options
+func (c *Commit) GetFileStatusSinceCommit(pastCommit string, opts FileStatusOptions) (*CommitFileStatus, error) {
+	return c.repo.GetFileStatusBetween(pastCommit, c.ID.String(), opts)
+}
+
 // FileChangedSinceCommit Returns true if the file given has changed since the the past commit
 // YOU MUST ENSURE THAT pastCommit is a valid commit ID.
 func (c *Commit) FileChangedSinceCommit(filename, pastCommit string) (bool, error) {
@@ -400,25 +613,13 @@ func (c *Commit) GetSubModules() (*ObjectCache, error) {
 	}
 
 	defer rd.Close()
-	scanner := bufio.NewScanner(rd)
+	modules, err := ParseGitModules(rd)
+	if err != nil {
+		return nil, err
+	}
 	c.submoduleCache = newObjectCache()
-	var ismodule bool
-	var path string
-	for scanner.Scan() {
-		if strings.HasPrefix(scanner.Text(), "[submodule") {
-			ismodule = true
-			continue
-		}
-		if ismodule {
-			fields := strings.Split(scanner.Text(), "=")
-			k := strings.TrimSpace(fields[0])
-			if k == "path" {
-				path = strings.TrimSpace(fields[1])
-			} else if k == "url" {
-				c.submoduleCache.Set(path, &SubModule{path, strings.TrimSpace(fields[1])})
-				ismodule = false
-			}
-		}
+	for path, module := range modules {
+		c.submoduleCache.Set(path, module)
 	}
 
 	return c.submoduleCache, nil
@@ -491,43 +692,91 @@ type CommitFileStatus struct {
 	Added    []string
 	Removed  []string
 	Modified []string
+	// Renamed and Copied are only detected if requested with RenameDetection
+	Renamed []FileRename
+	Copied  []FileRename
+}
+
+// FileRename represents a file renamed or copied from OldPath to Path
+type FileRename struct {
+	OldPath string
+	Path    string
+	// Similarity of both files in percent
+	Similarity int
+}
+
+// RenameDetection configures the detection of renamed and copied files
+type RenameDetection struct {
+	// Renames detects renamed files like -M
+	Renames bool
+	// Copies detects copied and renamed files like -C
+	Copies bool
+	// Threshold is the minimum similarity in percent of a rename or copy, git uses 50 if it is 0
+	Threshold int
+}
+
+func (d RenameDetection) args() []CmdArg {
+	threshold := ""
+	if d.Threshold > 0 {
+		threshold = strconv.Itoa(d.Threshold) + "%"
+	}
+	switch {
+	case d.Copies:
+		return []CmdArg{CmdArg("-C" + threshold)}
+	case d.Renames:
+		return []CmdArg{CmdArg("-M" + threshold)}
+	default:
+		return []CmdArg{"--no-renames"}
+	}
 }
 
 // NewCommitFileStatus creates a CommitFileStatus
 func NewCommitFileStatus() *CommitFileStatus {
 	return &CommitFileStatus{
-		[]string{}, []string{}, []string{},
+		Added:    []string{},
+		Removed:  []string{},
+		Modified: []string{},
+		Renamed:  []FileRename{},
+		Copied:   []FileRename{},
 	}
 }
 
-func parseCommitFileStatus(fileStatus *CommitFileStatus, stdout io.Reader) {
+// parseCommitFileStatus parses the output of git log --name-status -z, it returns the error of reading stdout
+func parseCommitFileStatus(fileStatus *CommitFileStatus, stdout io.Reader) error {
 	rd := bufio.NewReader(stdout)
 	peek, err := rd.Peek(1)
 	if err != nil {
 		if err != io.EOF {
-			log.Error("Unexpected error whilst reading from git log --name-status. Error: %v", err)
+			return err
 		}
-		return
+		return nil
 	}
 	if peek[0] == '\n' || peek[0] == '\x00' {
 		_, _ = rd.Discard(1)
 	}
-	for {
-		modifier, err := rd.ReadSlice('\x00')
-		if err != nil {
-			if err != io.EOF {
-				log.Error("Unexpected error whilst reading from git log --name-status. Error: %v", err)
-			}
-			return
-		}
+	var readErr error
+	readPath := func() (string, bool) {
 		file, err := rd.ReadString('\x00')
 		if err != nil {
 			if err != io.EOF {
-				log.Error("Unexpected error whilst reading from git log --name-status. Error: %v", err)
+				readErr = err
 			}
-			return
+			return "", false
+		}
+		return file[:len(file)-1], true
+	}
+	for {
+		modifier, ok := readPath()
+		if !ok {
+			return readErr
+		}
+		if modifier == "" {
+			continue
+		}
+		file, ok := readPath()
+		if !ok {
+			return readErr
 		}
-		file = file[:len(file)-1]
 		switch modifier[0] {
 		case 'A':
 			fileStatus.Added = append(fileStatus.Added, file)
@@ -535,32 +784,42 @@ func parseCommitFileStatus(fileStatus *CommitFileStatus, stdout io.Reader) {
 			fileStatus.Removed = append(fileStatus.Removed, file)
 		case 'M':
 			fileStatus.Modified = append(fileStatus.Modified, file)
+		case 'R', 'C':
+			// R<similarity> NUL <old path> NUL <new path>
+			newFile, ok := readPath()
+			if !ok {
+				return readErr
+			}
+			similarity, _ := strconv.Atoi(modifier[1:])
+			rename := FileRename{OldPath: file, Path: newFile, Similarity: similarity}
+			if modifier[0] == 'R' {
+				fileStatus.Renamed = append(fileStatus.Renamed, rename)
+			} else {
+				fileStatus.Copied = append(fileStatus.Copied, rename)
+			}
 		}
 	}
 }
 
 // GetCommitFileStatus returns file status of commit in given repository.
 func GetCommitFileStatus(ctx context.Context, repoPath, commitID string) (*CommitFileStatus, error) {
-	stdout, w := io.Pipe()
-	done := make(chan struct{})
-	fileStatus := NewCommitFileStatus()
-	go func() {
-		parseCommitFileStatus(fileStatus, stdout)
-		close(done)
-	}()
-
-	stderr := new(bytes.Buffer)
-	err := NewCommand(ctx, "log", "--name-status", "-c", "--pretty=format:", "--parents", "--no-renames", "-z", "-1").AddDynamicArguments(commitID).Run(&RunOpts{
-		Dir:    repoPath,
-		Stdout: w,
-		Stderr: stderr,
-	})
-	w.Close() // Close writer to exit parsing goroutine
+	return GetCommitFileStatusWithRenames(ctx, repoPath, commitID, RenameDetection{})
+}
+
+// GetCommitFileStatusWithRenames returns file status of commit in given repository,
+// detecting renamed and copied files as configured.
+func GetCommitFileStatusWithRenames(ctx context.Context, repoPath, commitID string, detection RenameDetection) (*CommitFileStatus, error) {
+	stdout, err := NewCommand(ctx, "log", "--name-status", "-c", "--pretty=format:", "--parents").AddArguments(detection.args()...).
+		AddArguments("-z", "-1").AddDynamicArguments(commitID).RunWithStdoutReader(&RunOpts{Dir: repoPath})
 	if err != nil {
-		return nil, ConcatenateError(err, stderr.String())
+		return nil, err
 	}
+	defer stdout.Close()
 
-	<-done
+	fileStatus := NewCommitFileStatus()
+	if err := parseCommitFileStatus(fileStatus, stdout); err != nil {
+		return nil, err
+	}
 	return fileStatus, nil
 }
 
@@ -6,9 +6,7 @@ package git
 
 import (
 	"context"
-	"fmt"
 	"path"
-	"strings"
 
 	"github.com/emirpasic/gods/trees/binaryheap"
 	"github.com/go-git/go-git/v5/plumbing"
@@ -32,35 +30,12 @@ func (tes Entries) GetCommitsInfo(ctx context.Context, commit *Commit, treePath
 		entryPaths[i+1] = entry.Name()
 	}
 
-	commitNodeIndex, commitGraphFile := commit.repo.CommitNodeIndex()
-	if commitGraphFile != nil {
-		defer commitGraphFile.Close()
-	}
-
-	c, err := commitNodeIndex.Get(commit.ID)
-	if err != nil {
-		return nil, nil, err
-	}
-
 	var revs map[string]*Commit
-	if commit.repo.LastCommitCache != nil {
-		var unHitPaths []string
-		revs, unHitPaths, err = getLastCommitForPathsByCache(commit.ID.String(), treePath, entryPaths, commit.repo.LastCommitCache)
-		if err != nil {
-			return nil, nil, err
-		}
-		if len(unHitPaths) > 0 {
-			revs2, err := GetLastCommitForPaths(ctx, commit.repo.LastCommitCache, c, treePath, unHitPaths)
-			if err != nil {
-				return nil, nil, err
-			}
-
-			for k, v := range revs2 {
-				revs[k] = v
-			}
-		}
+	var err error
+	if commit.repo.backendFor(OperationHistory, BackendGoGit, BackendCLI) == BackendCLI {
+		revs, err = getLastCommitsForPaths(commit.repo, commit.repo.LastCommitCache, commit.ID.String(), treePath, entryPaths)
 	} else {
-		revs, err = GetLastCommitForPaths(ctx, nil, c, treePath, entryPaths)
+		revs, err = getLastCommitsForPathsWithGoGit(ctx, commit, treePath, entryPaths)
 	}
 	if err != nil {
 		return nil, nil, err
@@ -111,6 +86,45 @@ func (tes Entries) GetCommitsInfo(ctx context.Context, commit *Commit, treePath
 	return commitsInfo, treeCommit, nil
 }
 
+// getLastCommitsForPathsWithGoGit gets the last commits of the entries of treePath in commit walking the commit graph with gogit
+func getLastCommitsForPathsWithGoGit(ctx context.Context, commit *Commit, treePath string, entryPaths []string) (map[string]*Commit, error) {
+	hash, err := gogitHash(commit.ID)
+	if err != nil {
+		return nil, err
+	}
+	commitNodeIndex, commitGraphFile := commit.repo.CommitNodeIndex()
+	if commitGraphFile != nil {
+		defer commitGraphFile.Close()
+	}
+
+	c, err := commitNodeIndex.Get(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	var revs map[string]*Commit
+	if commit.repo.LastCommitCache != nil {
+		var unHitPaths []string
+		revs, unHitPaths, err = getLastCommitForPathsByCache(commit.ID.String(), treePath, entryPaths, commit.repo.LastCommitCache)
+		if err != nil {
+			return nil, err
+		}
+		if len(unHitPaths) > 0 {
+			revs2, err := GetLastCommitForPaths(ctx, commit.repo.LastCommitCache, c, treePath, unHitPaths)
+			if err != nil {
+				return nil, err
+			}
+
+			for k, v := range revs2 {
+				revs[k] = v
+			}
+		}
+	} else {
+		revs, err = GetLastCommitForPaths(ctx, nil, c, treePath, entryPaths)
+	}
+	return revs, err
+}
+
 type commitAndPaths struct {
 	commit cgobject.CommitNode
 	// Paths that are still on the branch represented by commit
@@ -311,57 +325,22 @@ heaploop:
 	return result, nil
 }
 
-func convertPGPSignature(c *object.Commit) *CommitGPGSignature {
-	if c.PGPSignature == "" {
-		return nil
-	}
-
-	var w strings.Builder
-	var err error
-
-	if _, err = fmt.Fprintf(&w, "tree %s\n", c.TreeHash.String()); err != nil {
-		return nil
-	}
-
+func convertCommit(c *object.Commit) *Commit {
+	var parents []ObjectID
 	for _, parent := range c.ParentHashes {
-		if _, err = fmt.Fprintf(&w, "parent %s\n", parent.String()); err != nil {
-			return nil
-		}
-	}
-
-	if _, err = fmt.Fprint(&w, "author "); err != nil {
-		return nil
-	}
-
-	if err = c.Author.Encode(&w); err != nil {
-		return nil
-	}
-
-	if _, err = fmt.Fprint(&w, "\ncommitter "); err != nil {
-		return nil
+		parents = append(parents, parent)
 	}
-
-	if err = c.Committer.Encode(&w); err != nil {
-		return nil
-	}
-
-	if _, err = fmt.Fprintf(&w, "\n\n%s", c.Message); err != nil {
-		return nil
-	}
-
-	return &CommitGPGSignature{
-		Signature: c.PGPSignature,
-		Payload:   w.String(),
-	}
-}
-
-func convertCommit(c *object.Commit) *Commit {
-	return &Commit{
+	commit := &Commit{
+		Tree:          *NewTree(nil, c.TreeHash),
 		ID:            c.Hash,
 		CommitMessage: c.Message,
 		Committer:     &c.Committer,
 		Author:        &c.Author,
-		Signature:     convertPGPSignature(c),
-		Parents:       c.ParentHashes,
+		Parents:       parents,
+	}
+	// the payload is reconstructed by SignaturePayload
+	if c.PGPSignature != "" {
+		commit.Signature = &CommitGPGSignature{Signature: c.PGPSignature}
 	}
+	return commit
 }
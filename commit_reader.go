@@ -7,6 +7,7 @@ package git
 import (
 	"bufio"
 	"bytes"
+	"fmt"
 	"io"
 	"strings"
 )
@@ -15,18 +16,20 @@ import (
 // We need this to interpret commits from cat-file or cat-file --batch
 //
 // If used as part of a cat-file --batch stream you need to limit the reader to the correct size
-func CommitFromReader(gitRepo *Repository, sha SHA1, reader io.Reader) (*Commit, error) {
+func CommitFromReader(gitRepo *Repository, sha ObjectID, reader io.Reader) (*Commit, error) {
 	commit := &Commit{
 		ID:        sha,
 		Author:    &Signature{},
 		Committer: &Signature{},
 	}
 
-	payloadSB := new(strings.Builder)
 	signatureSB := new(strings.Builder)
 	messageSB := new(strings.Builder)
 	message := false
 	pgpsig := false
+	tree := false
+	// extra is the index of the extra header being read, whose value may continue on the next lines
+	extra := -1
 
 	bufReader, ok := reader.(*bufio.Reader)
 	if !ok {
@@ -41,7 +44,6 @@ readLoop:
 				if message {
 					_, _ = messageSB.Write(line)
 				}
-				_, _ = payloadSB.Write(line)
 				break readLoop
 			}
 			return nil, err
@@ -54,13 +56,19 @@ readLoop:
 				pgpsig = false
 			}
 		}
+		if extra >= 0 {
+			if !message && len(line) > 0 && line[0] == ' ' {
+				commit.ExtraHeaders[extra].Value += "\n" + string(bytes.TrimSuffix(line[1:], []byte{'\n'}))
+				continue
+			}
+			extra = -1
+		}
 
 		if !message {
 			// This is probably not correct but is copied from go-gits interpretation...
 			trimmed := bytes.TrimSpace(line)
 			if len(trimmed) == 0 {
 				message = true
-				_, _ = payloadSB.Write(line)
 				continue
 			}
 
@@ -72,37 +80,57 @@ readLoop:
 
 			switch string(split[0]) {
 			case "tree":
-				commit.Tree = *NewTree(gitRepo, MustIDFromString(string(data)))
-				_, _ = payloadSB.Write(line)
+				id, err := NewObjectIDFromString(string(data))
+				if err != nil {
+					return nil, fmt.Errorf("invalid tree of commit %s: %w", sha, err)
+				}
+				commit.Tree = *NewTree(gitRepo, id)
+				tree = true
 			case "parent":
-				commit.Parents = append(commit.Parents, MustIDFromString(string(data)))
-				_, _ = payloadSB.Write(line)
+				id, err := NewObjectIDFromString(string(data))
+				if err != nil {
+					return nil, fmt.Errorf("invalid parent of commit %s: %w", sha, err)
+				}
+				commit.Parents = append(commit.Parents, id)
 			case "author":
 				commit.Author = &Signature{}
 				commit.Author.Decode(data)
-				_, _ = payloadSB.Write(line)
+				commit.rawAuthor = nonCanonicalIdentity(line, commit.Author)
 			case "committer":
 				commit.Committer = &Signature{}
 				commit.Committer.Decode(data)
-				_, _ = payloadSB.Write(line)
-			case "gpgsig":
+				commit.rawCommitter = nonCanonicalIdentity(line, commit.Committer)
+			case "gpgsig", "gpgsig-sha256":
 				_, _ = signatureSB.Write(data)
 				_ = signatureSB.WriteByte('\n')
 				pgpsig = true
+			default:
+				// headers precede the tree only if the reader was not limited to the object, e.g. the cat-file --batch line
+				if tree {
+					name, value, _ := bytes.Cut(bytes.TrimSuffix(line, []byte{'\n'}), []byte{' '})
+					commit.ExtraHeaders = append(commit.ExtraHeaders, CommitHeader{Name: string(name), Value: string(value)})
+					extra = len(commit.ExtraHeaders) - 1
+				}
 			}
 		} else {
 			_, _ = messageSB.Write(line)
-			_, _ = payloadSB.Write(line)
 		}
 	}
 	commit.CommitMessage = messageSB.String()
-	commit.Signature = &CommitGPGSignature{
-		Signature: signatureSB.String(),
-		Payload:   payloadSB.String(),
-	}
-	if len(commit.Signature.Signature) == 0 {
-		commit.Signature = nil
+	if signatureSB.Len() > 0 {
+		commit.Signature = &CommitGPGSignature{Signature: signatureSB.String()}
 	}
 
 	return commit, nil
 }
+
+// nonCanonicalIdentity returns the value of the author or committer header line if encoding the decoded sig
+// gives other bytes, e.g. for a -0000 timezone or a doubled space, and else an empty string
+func nonCanonicalIdentity(line []byte, sig *Signature) string {
+	_, raw, _ := bytes.Cut(bytes.TrimSuffix(line, []byte{'\n'}), []byte{' '})
+	var w strings.Builder
+	if err := sig.Encode(&w); err == nil && w.String() == string(raw) {
+		return ""
+	}
+	return string(raw)
+}
@@ -5,9 +5,12 @@
 package git
 
 import (
+	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -79,16 +82,63 @@ parent 37991dec2c8e592043f47155ce4808d4580f9123
 author silverwind <me@silverwind.io> 1563741793 +0200
 committer silverwind <me@silverwind.io> 1563741793 +0200
 
-empty commit`, commitFromReader.Signature.Payload)
+empty commit`, commitFromReader.SignaturePayload())
+	assert.Empty(t, commitFromReader.Signature.Payload)
 	assert.EqualValues(t, "silverwind <me@silverwind.io>", commitFromReader.Author.String())
 
 	commitFromReader2, err := CommitFromReader(gitRepo, sha, strings.NewReader(commitString+"\n\n"))
 	assert.NoError(t, err)
 	commitFromReader.CommitMessage += "\n\n"
-	commitFromReader.Signature.Payload += "\n\n"
 	assert.EqualValues(t, commitFromReader, commitFromReader2)
 }
 
+func TestCommitSignaturePayload(t *testing.T) {
+	payload := `tree f1a6cb52b2d16773290cefe49ad0684b50a4f930
+parent 37991dec2c8e592043f47155ce4808d4580f9123
+parent 2839944139e0de9737a044f78b0e4b40d53a014e
+author silverwind <me@silverwind.io> 1563741793 +0200
+committer Committer <committer@example.com> 1563741800 -0130
+encoding ISO-8859-1
+mergetag object 2839944139e0de9737a044f78b0e4b40d53a014e
+ type commit
+ tag v1.0
+ tagger silverwind <me@silverwind.io> 1563741700 +0200
+ ` + `
+ merged tag
+`
+	signed := payload + `gpgsig -----BEGIN SSH SIGNATURE-----
+ U1NIU0lH
+ -----END SSH SIGNATURE-----
+
+merge v1.0
+
+with a body
+`
+	commit, err := CommitFromReader(nil, MustIDFromString("feaf4ba6bc635fec442f46ddd4512416ec43c2c2"), strings.NewReader(signed))
+	assert.NoError(t, err)
+	assert.Equal(t, []CommitHeader{
+		{Name: "encoding", Value: "ISO-8859-1"},
+		{Name: "mergetag", Value: "object 2839944139e0de9737a044f78b0e4b40d53a014e\ntype commit\ntag v1.0\ntagger silverwind <me@silverwind.io> 1563741700 +0200\n\nmerged tag"},
+	}, commit.ExtraHeaders)
+	assert.Equal(t, "-----BEGIN SSH SIGNATURE-----\nU1NIU0lH\n-----END SSH SIGNATURE-----\n", commit.Signature.Signature)
+	// the payload is reconstructed instead of stored
+	assert.Empty(t, commit.Signature.Payload)
+	assert.Equal(t, payload+"\nmerge v1.0\n\nwith a body\n", commit.SignaturePayload())
+
+	// identities which do not round-trip through Signature are kept as read
+	payload = `tree f1a6cb52b2d16773290cefe49ad0684b50a4f930
+author A U Thor  <a@example.com> 1563741793 -0000
+committer A U Thor <a@example.com> 1563741793 -0000
+
+message
+`
+	commit, err = CommitFromReader(nil, MustIDFromString("feaf4ba6bc635fec442f46ddd4512416ec43c2c2"), strings.NewReader(strings.Replace(payload,
+		"\n\n", "\ngpgsig -----BEGIN SSH SIGNATURE-----\n U1NIU0lH\n -----END SSH SIGNATURE-----\n\n", 1)))
+	assert.NoError(t, err)
+	assert.Equal(t, "A U Thor  <a@example.com> 1563741793 -0000", commit.rawAuthor)
+	assert.Equal(t, payload, commit.SignaturePayload())
+}
+
 func TestHasPreviousCommit(t *testing.T) {
 	bareRepo1Path := filepath.Join(testReposDir, "repo1_bare")
 
@@ -115,6 +165,85 @@ func TestHasPreviousCommit(t *testing.T) {
 	assert.False(t, selfNot)
 }
 
+func TestCommitSearchCommitsPickaxe(t *testing.T) {
+	bareRepo1Path := filepath.Join(testReposDir, "repo1_bare")
+
+	repo, err := openRepositoryWithDefaultContext(bareRepo1Path)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	commit, err := repo.GetCommit("2839944139e0de9737a044f78b0e4b40d989a9e3")
+	assert.NoError(t, err)
+
+	commits, _, err := commit.SearchCommits(SearchCommitsOptions{DiffContains: "branch1"})
+	assert.NoError(t, err)
+	if assert.Len(t, commits, 1) {
+		assert.Equal(t, "9c9aef8dd84e02bc7ec12641deb4c930a7c30185", commits[0].ID.String())
+	}
+
+	commits, _, err = commit.SearchCommits(SearchCommitsOptions{DiffMatchesRegex: "^file1"})
+	assert.NoError(t, err)
+	if assert.Len(t, commits, 2) {
+		assert.Equal(t, "2839944139e0de9737a044f78b0e4b40d989a9e3", commits[0].ID.String())
+		assert.Equal(t, "95bb4d39648ee7e325106df01a621c530863a653", commits[1].ID.String())
+	}
+
+	commits, _, err = commit.SearchCommits(SearchCommitsOptions{DiffContains: "not in any diff"})
+	assert.NoError(t, err)
+	assert.Empty(t, commits)
+}
+
+func TestCommitSearchCommitsPaging(t *testing.T) {
+	bareRepo1Path := filepath.Join(testReposDir, "repo1_bare")
+
+	repo, err := openRepositoryWithDefaultContext(bareRepo1Path)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	commit, err := repo.GetCommit("2839944139e0de9737a044f78b0e4b40d989a9e3")
+	assert.NoError(t, err)
+
+	// "Edit file1.txt", "Add branch1.txt" and "Add file1.txt"
+	commits, total, err := commit.SearchCommits(SearchCommitsOptions{Keywords: []string{".txt"}, Page: 2, PageSize: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, total)
+	if assert.Len(t, commits, 1) {
+		assert.Equal(t, "95bb4d39648ee7e325106df01a621c530863a653", commits[0].ID.String())
+	}
+
+	// the keyword is a basic regex by default
+	_, total, err = commit.SearchCommits(SearchCommitsOptions{Keywords: []string{"^add"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, total)
+	_, total, err = commit.SearchCommits(SearchCommitsOptions{Keywords: []string{"^add"}, FixedStrings: true})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, total)
+
+	commits, total, err = commit.SearchCommits(SearchCommitsOptions{Keywords: []string{"^add (file|other)"}, RegexKeywords: true})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, total)
+	if assert.Len(t, commits, 1) {
+		assert.Equal(t, "95bb4d39648ee7e325106df01a621c530863a653", commits[0].ID.String())
+	}
+
+	commits, total, err = commit.SearchCommits(SearchCommitsOptions{Keywords: []string{".txt"}, Page: 3, PageSize: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, total)
+	assert.Empty(t, commits)
+
+	// a commit id keyword finds the commit after the ones matching the message, unless it is one of them
+	commits, total, err = commit.SearchCommits(SearchCommitsOptions{Keywords: []string{".txt", "feaf4ba6"}, Page: 2, PageSize: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, total)
+	if assert.Len(t, commits, 2) {
+		assert.Equal(t, "95bb4d39648ee7e325106df01a621c530863a653", commits[0].ID.String())
+		assert.Equal(t, "feaf4ba6bc635fec442f46ddd4512416ec43c2c2", commits[1].ID.String())
+	}
+	_, total, err = commit.SearchCommits(SearchCommitsOptions{Keywords: []string{".txt", "9c9aef8d"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, total)
+}
+
 func TestParseCommitFileStatus(t *testing.T) {
 	type testcase struct {
 		output   string
@@ -219,3 +348,171 @@ func TestParseCommitFileStatus(t *testing.T) {
 		assert.Equal(t, kase.modified, fileStatus.Modified)
 	}
 }
+
+func TestCommitChangesEmptyAndOrphan(t *testing.T) {
+	repoPath := t.TempDir()
+	repo, err := InitRepository(DefaultContext, repoPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	committer := &Signature{Name: "Test", Email: "test@example.com"}
+	assert.NoError(t, os.WriteFile(filepath.Join(repoPath, "README.md"), []byte("readme\n"), 0o644))
+	assert.NoError(t, AddChanges(repoPath, true))
+	assert.NoError(t, CommitChanges(repoPath, CommitChangesOptions{Committer: committer, Message: "initial"}))
+
+	// nothing to commit is silently ignored without AllowEmpty
+	assert.NoError(t, CommitChanges(repoPath, CommitChangesOptions{Committer: committer, Message: "nothing"}))
+	count, err := CommitsCount(DefaultContext, repoPath, "refs/heads/main")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, count)
+
+	assert.NoError(t, CommitChanges(repoPath, CommitChangesOptions{Committer: committer, Message: "empty", AllowEmpty: true}))
+	count, err = CommitsCount(DefaultContext, repoPath, "refs/heads/main")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, count)
+
+	assert.NoError(t, CommitChanges(repoPath, CommitChangesOptions{Committer: committer, Message: "orphan", Orphan: "marker"}))
+	count, err = CommitsCount(DefaultContext, repoPath, "refs/heads/marker")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, count)
+	count, err = CommitsCount(DefaultContext, repoPath, "refs/heads/main")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, count)
+
+	assert.Error(t, CommitChanges(repoPath, CommitChangesOptions{Committer: committer, Message: "orphan", Orphan: "main"}))
+
+	// HEAD stays on the current branch if the orphan commit fails, git refuses an empty message
+	assert.Error(t, CommitChanges(repoPath, CommitChangesOptions{Committer: committer, Message: "", Orphan: "broken"}))
+	head, _, err := NewCommand(DefaultContext, "symbolic-ref", "HEAD").RunStdString(&RunOpts{Dir: repoPath})
+	assert.NoError(t, err)
+	assert.Equal(t, "refs/heads/marker\n", head)
+}
+
+func TestCommitChangesNothingToCommitAfterLongStatus(t *testing.T) {
+	repoPath := t.TempDir()
+	repo, err := InitRepository(DefaultContext, repoPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	committer := &Signature{Name: "Test", Email: "test@example.com"}
+	assert.NoError(t, os.WriteFile(filepath.Join(repoPath, "README.md"), []byte("readme\n"), 0o644))
+	assert.NoError(t, AddChanges(repoPath, true))
+	assert.NoError(t, CommitChanges(repoPath, CommitChangesOptions{Committer: committer, Message: "initial"}))
+
+	// git lists the untracked files before "nothing added to commit", far beyond the start of the output
+	for i := 0; i < 300; i++ {
+		assert.NoError(t, os.WriteFile(filepath.Join(repoPath, fmt.Sprintf("untracked-file-%03d.txt", i)), nil, 0o644))
+	}
+	assert.NoError(t, CommitChanges(repoPath, CommitChangesOptions{Committer: committer, Message: "nothing"}))
+
+	// and the modified files before "no changes added to commit"
+	assert.NoError(t, os.WriteFile(filepath.Join(repoPath, "README.md"), []byte("changed\n"), 0o644))
+	assert.NoError(t, CommitChanges(repoPath, CommitChangesOptions{Committer: committer, Message: "unstaged"}))
+
+	count, err := CommitsCount(DefaultContext, repoPath, "refs/heads/main")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, count)
+}
+
+func TestParseCommitFileStatusRenames(t *testing.T) {
+	fileStatus := NewCommitFileStatus()
+	parseCommitFileStatus(fileStatus, strings.NewReader("R086\x00old.go\x00new.go\x00C100\x00a.txt\x00b.txt\x00M\x00c.txt\x00"))
+	assert.Equal(t, []FileRename{{OldPath: "old.go", Path: "new.go", Similarity: 86}}, fileStatus.Renamed)
+	assert.Equal(t, []FileRename{{OldPath: "a.txt", Path: "b.txt", Similarity: 100}}, fileStatus.Copied)
+	assert.Equal(t, []string{"c.txt"}, fileStatus.Modified)
+}
+
+func TestGetCommitFileStatusWithRenames(t *testing.T) {
+	repoPath := t.TempDir()
+	repo, err := InitRepository(DefaultContext, repoPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	committer := &Signature{Name: "Test", Email: "test@example.com"}
+	content, kept := strings.Repeat("some line\n", 20), strings.Repeat("other line\n", 20)
+	assert.NoError(t, os.WriteFile(filepath.Join(repoPath, "a.txt"), []byte(content), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(repoPath, "kept.txt"), []byte(kept), 0o644))
+	assert.NoError(t, AddChanges(repoPath, false, "a.txt", "kept.txt"))
+	assert.NoError(t, CommitChanges(repoPath, CommitChangesOptions{Committer: committer, Message: "initial"}))
+	first, err := repo.GetRefCommitID("HEAD")
+	assert.NoError(t, err)
+
+	// rename a.txt with a change and copy kept.txt before changing it
+	assert.NoError(t, os.Rename(filepath.Join(repoPath, "a.txt"), filepath.Join(repoPath, "b.txt")))
+	assert.NoError(t, os.WriteFile(filepath.Join(repoPath, "b.txt"), []byte(content+"another line\n"), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(repoPath, "c.txt"), []byte(kept), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(repoPath, "kept.txt"), []byte(kept+"another line\n"), 0o644))
+	assert.NoError(t, AddChanges(repoPath, false, "a.txt", "b.txt", "c.txt", "kept.txt"))
+	assert.NoError(t, CommitChanges(repoPath, CommitChangesOptions{Committer: committer, Message: "rename"}))
+	second, err := repo.GetRefCommitID("HEAD")
+	assert.NoError(t, err)
+
+	fileStatus, err := GetCommitFileStatus(DefaultContext, repoPath, second)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b.txt", "c.txt"}, fileStatus.Added)
+	assert.Equal(t, []string{"a.txt"}, fileStatus.Removed)
+	assert.Empty(t, fileStatus.Renamed)
+
+	fileStatus, err = GetCommitFileStatusWithRenames(DefaultContext, repoPath, second, RenameDetection{Renames: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c.txt"}, fileStatus.Added)
+	assert.Empty(t, fileStatus.Removed)
+	assert.Equal(t, []string{"kept.txt"}, fileStatus.Modified)
+	if assert.Len(t, fileStatus.Renamed, 1) {
+		assert.Equal(t, "a.txt", fileStatus.Renamed[0].OldPath)
+		assert.Equal(t, "b.txt", fileStatus.Renamed[0].Path)
+		assert.Less(t, fileStatus.Renamed[0].Similarity, 100)
+	}
+	assert.Empty(t, fileStatus.Copied)
+
+	fileStatus, err = repo.GetFileStatusBetween(first, second, FileStatusOptions{RenameDetection: RenameDetection{Copies: true}})
+	assert.NoError(t, err)
+	assert.Empty(t, fileStatus.Added)
+	assert.Equal(t, []FileRename{{OldPath: "kept.txt", Path: "c.txt", Similarity: 100}}, fileStatus.Copied)
+	assert.Len(t, fileStatus.Renamed, 1)
+
+	fileStatus, err = repo.GetFileStatusBetween(first, second, FileStatusOptions{RenameDetection: RenameDetection{Renames: true, Threshold: 100}})
+	assert.NoError(t, err)
+	assert.Empty(t, fileStatus.Renamed)
+	assert.Equal(t, []string{"b.txt", "c.txt"}, fileStatus.Added)
+
+	count, err := repo.FilesCountBetweenWithOptions(first, second, FileStatusOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, count)
+	count, err = repo.FilesCountBetweenWithOptions(first, second, FileStatusOptions{RenameDetection: RenameDetection{Renames: true}})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	commit, err := repo.GetCommit(second)
+	assert.NoError(t, err)
+	fileStatus, err = commit.GetFileStatusSinceCommit(first, FileStatusOptions{RenameDetection: RenameDetection{Renames: true}})
+	assert.NoError(t, err)
+	assert.Len(t, fileStatus.Renamed, 1)
+
+	// the diff detects renames as configured too
+	out := new(strings.Builder)
+	assert.NoError(t, repo.WriteDiff(first, second, out, DiffOptions{RenameDetection: &RenameDetection{Renames: true}}))
+	assert.Contains(t, out.String(), "rename from a.txt\nrename to b.txt\n")
+	out.Reset()
+	assert.NoError(t, repo.GetFileDiff(first, second, "b.txt", out, DiffOptions{RenameDetection: &RenameDetection{}}))
+	assert.Contains(t, out.String(), "new file mode")
+	assert.NotContains(t, out.String(), "rename from")
+}
+
+func TestCommitChangesSignatures(t *testing.T) {
+	repoPath := t.TempDir()
+	repo, err := InitRepository(DefaultContext, repoPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	author := &Signature{Name: "Some Author", Email: "author@example.com", When: time.Unix(1378823654, 0).In(time.FixedZone("", 2*60*60))}
+	committer := &Signature{Name: "Some Committer", Email: "committer@example.com", When: time.Unix(1378827254, 0).In(time.FixedZone("", -(5*60+30)*60))}
+	assert.NoError(t, os.WriteFile(filepath.Join(repoPath, "README.md"), []byte("readme\n"), 0o644))
+	assert.NoError(t, AddChanges(repoPath, true))
+	assert.NoError(t, CommitChanges(repoPath, CommitChangesOptions{Author: author, Committer: committer, Message: "initial"}))
+
+	stdout, _, err := NewCommand(DefaultContext, "cat-file", "-p", "HEAD").RunStdString(&RunOpts{Dir: repoPath})
+	assert.NoError(t, err)
+	assert.Contains(t, stdout, "\nauthor Some Author <author@example.com> 1378823654 +0200\n")
+	assert.Contains(t, stdout, "\ncommitter Some Committer <committer@example.com> 1378827254 -0530\n")
+}
@@ -0,0 +1,96 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ConventionalCommit is the metadata of a commit message following https://www.conventionalcommits.org
+type ConventionalCommit struct {
+	// Type is the lower case type, e.g. feat or fix
+	Type  string
+	Scope string
+	// Breaking is set by a "!" after the type or scope, or by a BREAKING CHANGE footer
+	Breaking bool
+	// BreakingChange is the description of the BREAKING CHANGE footer
+	BreakingChange string
+	Description    string
+}
+
+var conventionalCommitHeader = regexp.MustCompile(`^([A-Za-z]+)(?:\(([^()]*)\))?(!)?: (.+)$`)
+
+// ParseConventionalCommit parses the message as conventional commit, it returns nil if the message
+// does not follow the specification.
+func ParseConventionalCommit(message string) *ConventionalCommit {
+	header, body, _ := strings.Cut(strings.TrimSpace(message), "\n")
+	matches := conventionalCommitHeader.FindStringSubmatch(strings.TrimSpace(header))
+	if matches == nil {
+		return nil
+	}
+	cc := &ConventionalCommit{
+		Type:        strings.ToLower(matches[1]),
+		Scope:       strings.TrimSpace(matches[2]),
+		Breaking:    matches[3] == "!",
+		Description: strings.TrimSpace(matches[4]),
+	}
+	for _, line := range strings.Split(body, "\n") {
+		for _, token := range []string{"BREAKING CHANGE:", "BREAKING-CHANGE:"} {
+			if description := strings.TrimPrefix(line, token); description != line {
+				cc.Breaking = true
+				cc.BreakingChange = strings.TrimSpace(description)
+			}
+		}
+	}
+	return cc
+}
+
+// ConventionalCommit parses the commit message as conventional commit,
+// it returns nil if the message does not follow the specification.
+func (c *Commit) ConventionalCommit() *ConventionalCommit {
+	return ParseConventionalCommit(c.CommitMessage)
+}
+
+// Changelog groups the commits of a range by their conventional commit type
+type Changelog struct {
+	// Breaking are the commits with breaking changes, they are also part of their type group
+	Breaking []*Commit
+	// Groups maps the conventional commit types to their commits, newest first
+	Groups map[string][]*Commit
+	// Other are the commits not following the conventional commits specification
+	Other []*Commit
+}
+
+// GetChangelog groups the commits reachable from head but not from base by their conventional commit type.
+// Merge commits are skipped. An empty base groups all commits reachable from head.
+func (repo *Repository) GetChangelog(base, head string) (*Changelog, error) {
+	revision := head
+	if base != "" {
+		revision = base + ".." + head
+	}
+	iter, err := repo.Log(LogRevisions(revision), LogNoMerges())
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	changelog := &Changelog{Groups: make(map[string][]*Commit)}
+	for commit := iter.Next(); commit != nil; commit = iter.Next() {
+		cc := commit.ConventionalCommit()
+		if cc == nil {
+			changelog.Other = append(changelog.Other, commit)
+			continue
+		}
+		if cc.Breaking {
+			changelog.Breaking = append(changelog.Breaking, commit)
+		}
+		changelog.Groups[cc.Type] = append(changelog.Groups[cc.Type], commit)
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return changelog, nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConventionalCommit(t *testing.T) {
+	assert.Equal(t, &ConventionalCommit{Type: "feat", Scope: "api", Description: "add endpoint"},
+		ParseConventionalCommit("feat(api): add endpoint\n\nsome body\n"))
+	assert.Equal(t, &ConventionalCommit{Type: "fix", Breaking: true, Description: "drop option"},
+		ParseConventionalCommit("Fix!: drop option"))
+	assert.Equal(t, &ConventionalCommit{Type: "refactor", Breaking: true, BreakingChange: "config moved", Description: "move config"},
+		ParseConventionalCommit("refactor: move config\n\nBody\n\nBREAKING CHANGE: config moved\nReviewed-by: A"))
+	assert.Nil(t, ParseConventionalCommit("Add file1.txt"))
+	assert.Nil(t, ParseConventionalCommit("feat:missing space"))
+}
+
+func TestRepository_GetChangelog(t *testing.T) {
+	repoPath := filepath.Join(t.TempDir(), "repo.git")
+	assert.NoError(t, Clone(DefaultContext, filepath.Join(testReposDir, "repo1_bare"), repoPath, CloneRepoOptions{Bare: true}))
+	repo, err := openRepositoryWithDefaultContext(repoPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	sig := &Signature{Name: "Author", Email: "author@example.com", When: time.Now()}
+	parent := "feaf4ba6bc635fec442f46ddd4512416ec43c2c2"
+	var ids []string
+	for _, message := range []string{"feat: first feature", "Update readme", "fix(core)!: breaking fix", "feat(ui): second feature"} {
+		id, err := repo.commitTreeID(sig, sig, "f1a6cb52b2d16773290cefe49ad0684b50a4f930", CommitTreeOpts{Parents: []string{parent}, Message: message, NoGPGSign: true})
+		assert.NoError(t, err)
+		parent = id.String()
+		ids = append(ids, parent)
+	}
+
+	changelog, err := repo.GetChangelog("feaf4ba6bc635fec442f46ddd4512416ec43c2c2", parent)
+	assert.NoError(t, err)
+	groupIDs := func(commits []*Commit) (result []string) {
+		for _, commit := range commits {
+			result = append(result, commit.ID.String())
+		}
+		return result
+	}
+	assert.Equal(t, []string{ids[3], ids[0]}, groupIDs(changelog.Groups["feat"]))
+	assert.Equal(t, []string{ids[2]}, groupIDs(changelog.Groups["fix"]))
+	assert.Equal(t, []string{ids[2]}, groupIDs(changelog.Breaking))
+	assert.Equal(t, []string{ids[1]}, groupIDs(changelog.Other))
+}
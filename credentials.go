@@ -0,0 +1,99 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/enverbisevac/gitlib/util"
+)
+
+// Credentials authenticate Clone, Fetch and Push against the remote without embedding them in its url.
+// The secrets are passed to git through its environment, they never appear in the arguments or logs of the command.
+type Credentials struct {
+	// Token is sent as bearer token in the Authorization header of http requests, needs git >= 2.31
+	Token string
+	// Username and Password answer the http credential prompts of git through a temporary GIT_ASKPASS helper
+	Username string
+	Password string
+	// SSHKeyPath is the private key used for ssh remotes
+	SSHKeyPath string
+	// KnownHostsPath is the known_hosts file the host key of ssh remotes is strictly checked against
+	KnownHostsPath string
+}
+
+// the askpass helper reads the answers from its environment, so the secrets are never written to disk
+const askpassScript = `#!/bin/sh
+case "$1" in
+[Uu]sername*) printf '%s\n' "$GITLIB_ASKPASS_USERNAME" ;;
+*) printf '%s\n' "$GITLIB_ASKPASS_PASSWORD" ;;
+esac
+`
+
+// env returns base with the environment variables passing the credentials to git,
+// cleanup removes the askpass helper and must be called once the command finished.
+func (c *Credentials) env(base []string) (envs []string, cleanup func(), err error) {
+	cleanup = func() {}
+	envs = base
+	if c == nil {
+		return envs, cleanup, nil
+	}
+
+	var configs [][2]string
+	if c.Token != "" {
+		configs = append(configs, [2]string{"http.extraHeader", "Authorization: Bearer " + c.Token})
+	}
+	if c.Username != "" || c.Password != "" {
+		tmpDir, err := os.MkdirTemp("", "gitlib-askpass")
+		if err != nil {
+			return nil, cleanup, err
+		}
+		cleanup = func() {
+			_ = util.RemoveAll(tmpDir)
+		}
+		askpass := filepath.Join(tmpDir, "askpass.sh")
+		if err := os.WriteFile(askpass, []byte(askpassScript), 0o700); err != nil {
+			cleanup()
+			return nil, func() {}, err
+		}
+		envs = append(envs,
+			"GIT_ASKPASS="+askpass,
+			"GITLIB_ASKPASS_USERNAME="+c.Username,
+			"GITLIB_ASKPASS_PASSWORD="+c.Password,
+		)
+	}
+	if c.SSHKeyPath != "" || c.KnownHostsPath != "" {
+		sshCommand := "ssh -o BatchMode=yes"
+		if c.SSHKeyPath != "" {
+			sshCommand += " -o IdentitiesOnly=yes -i " + util.ShellEscape(c.SSHKeyPath)
+		}
+		if c.KnownHostsPath != "" {
+			sshCommand += " -o StrictHostKeyChecking=yes -o UserKnownHostsFile=" + util.ShellEscape(c.KnownHostsPath)
+		}
+		envs = append(envs, "GIT_SSH_COMMAND="+sshCommand)
+	}
+
+	// config from the environment instead of -c, which would show the token in the arguments of the process.
+	// It's numbered after the config already passed in base, the last GIT_CONFIG_COUNT is used like by exec.
+	if len(configs) > 0 {
+		offset := 0
+		for _, env := range base {
+			if strings.HasPrefix(env, "GIT_CONFIG_COUNT=") {
+				offset, _ = strconv.Atoi(strings.TrimPrefix(env, "GIT_CONFIG_COUNT="))
+			}
+		}
+		envs = append(envs, "GIT_CONFIG_COUNT="+strconv.Itoa(offset+len(configs)))
+		for i, config := range configs {
+			envs = append(envs,
+				"GIT_CONFIG_KEY_"+strconv.Itoa(offset+i)+"="+config[0],
+				"GIT_CONFIG_VALUE_"+strconv.Itoa(offset+i)+"="+config[1],
+			)
+		}
+	}
+	return envs, cleanup, nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCredentials(t *testing.T) {
+	var mu sync.Mutex
+	var authorizations []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		mu.Unlock()
+		if r.Header.Get("Authorization") == "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="git"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	lastAuthorization := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(authorizations) == 0 {
+			return ""
+		}
+		return authorizations[len(authorizations)-1]
+	}
+
+	repoPath := t.TempDir()
+	repo, err := InitRepository(DefaultContext, repoPath, InitWithBare(true))
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	err = Fetch(DefaultContext, repoPath, FetchOptions{Remote: server.URL + "/repo.git", Credentials: &Credentials{Token: "secret-token"}})
+	assert.Error(t, err)
+	assert.Equal(t, "Bearer secret-token", lastAuthorization())
+	assert.NotContains(t, err.Error(), "secret-token")
+
+	// base64 of user:password
+	err = Fetch(DefaultContext, repoPath, FetchOptions{Remote: server.URL + "/repo.git", Credentials: &Credentials{Username: "user", Password: "password"}})
+	assert.Error(t, err)
+	assert.Equal(t, "Basic dXNlcjpwYXNzd29yZA==", lastAuthorization())
+
+	err = Clone(DefaultContext, server.URL+"/repo.git", filepath.Join(t.TempDir(), "clone"), CloneRepoOptions{Credentials: &Credentials{Token: "clone-token"}})
+	assert.Error(t, err)
+	assert.Equal(t, "Bearer clone-token", lastAuthorization())
+
+	err = repo.Push(DefaultContext, "", PushOptions{Remote: server.URL + "/repo.git", Refspecs: []string{"refs/heads/*"}, Credentials: &Credentials{Token: "push-token"}})
+	assert.Error(t, err)
+	assert.Equal(t, "Bearer push-token", lastAuthorization())
+}
+
+func TestCredentials_env(t *testing.T) {
+	envs, cleanup, err := (*Credentials)(nil).env(nil)
+	assert.NoError(t, err)
+	cleanup()
+	assert.Empty(t, envs)
+
+	envs, cleanup, err = (&Credentials{SSHKeyPath: "/keys/id ed25519", KnownHostsPath: "/keys/known_hosts"}).env(nil)
+	assert.NoError(t, err)
+	cleanup()
+	assert.Equal(t, []string{`GIT_SSH_COMMAND=ssh -o BatchMode=yes -o IdentitiesOnly=yes -i "/keys/id ed25519" -o StrictHostKeyChecking=yes -o UserKnownHostsFile=/keys/known_hosts`}, envs)
+
+	// the config is numbered after the one of the caller
+	envs, cleanup, err = (&Credentials{Token: "token"}).env([]string{"GIT_CONFIG_COUNT=1", "GIT_CONFIG_KEY_0=core.quotePath", "GIT_CONFIG_VALUE_0=false"})
+	assert.NoError(t, err)
+	cleanup()
+	assert.Equal(t, []string{
+		"GIT_CONFIG_COUNT=1", "GIT_CONFIG_KEY_0=core.quotePath", "GIT_CONFIG_VALUE_0=false",
+		"GIT_CONFIG_COUNT=2", "GIT_CONFIG_KEY_1=http.extraHeader", "GIT_CONFIG_VALUE_1=Authorization: Bearer token",
+	}, envs)
+
+	envs, cleanup, err = (&Credentials{Username: "user", Password: "password"}).env(nil)
+	assert.NoError(t, err)
+	var askpass string
+	for _, env := range envs {
+		if strings.HasPrefix(env, "GIT_ASKPASS=") {
+			askpass = strings.TrimPrefix(env, "GIT_ASKPASS=")
+		}
+	}
+	content, err := os.ReadFile(askpass)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(content), "password")
+	cleanup()
+	_, err = os.Stat(askpass)
+	assert.True(t, os.IsNotExist(err))
+}
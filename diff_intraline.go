@@ -0,0 +1,143 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxIntralineTokens limits the tokens compared per pair of lines, longer lines are not refined
+const maxIntralineTokens = 500
+
+// DiffSegment is a part of the content of a changed line
+type DiffSegment struct {
+	Content string
+	// Changed is set if the segment does not exist in the paired line
+	Changed bool
+}
+
+// RefineIntraline pairs the deleted lines of every hunk with the added lines following them and splits
+// the content of both into segments, marking the words which changed. Unpaired lines get no segments.
+func (d *Diff) RefineIntraline() {
+	for _, file := range d.Files {
+		for _, hunk := range file.Hunks {
+			hunk.refineIntraline()
+		}
+	}
+}
+
+func (h *DiffHunk) refineIntraline() {
+	for i := 0; i < len(h.Lines); {
+		if h.Lines[i].Type != DiffLineDel {
+			i++
+			continue
+		}
+		delStart := i
+		for i < len(h.Lines) && h.Lines[i].Type == DiffLineDel {
+			i++
+		}
+		addStart := i
+		for i < len(h.Lines) && h.Lines[i].Type == DiffLineAdd {
+			i++
+		}
+		for j := 0; delStart+j < addStart && addStart+j < i; j++ {
+			del, add := h.Lines[delStart+j], h.Lines[addStart+j]
+			del.Segments, add.Segments = diffSegments(del.Content, add.Content)
+		}
+	}
+}
+
+// diffSegments compares the words of both lines and returns their segments,
+// or nil if the lines are too long to compare
+func diffSegments(oldContent, newContent string) (oldSegments, newSegments []DiffSegment) {
+	oldTokens, newTokens := splitDiffTokens(oldContent), splitDiffTokens(newContent)
+	if len(oldTokens) > maxIntralineTokens || len(newTokens) > maxIntralineTokens {
+		return nil, nil
+	}
+
+	// lengths[i][j] is the length of the longest common subsequence of oldTokens[i:] and newTokens[j:]
+	lengths := make([][]int, len(oldTokens)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(newTokens)+1)
+	}
+	for i := len(oldTokens) - 1; i >= 0; i-- {
+		for j := len(newTokens) - 1; j >= 0; j-- {
+			if oldTokens[i] == newTokens[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else if lengths[i+1][j] >= lengths[i][j+1] {
+				lengths[i][j] = lengths[i+1][j]
+			} else {
+				lengths[i][j] = lengths[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(oldTokens) || j < len(newTokens) {
+		switch {
+		case i < len(oldTokens) && j < len(newTokens) && oldTokens[i] == newTokens[j]:
+			oldSegments = appendDiffSegment(oldSegments, oldTokens[i], false)
+			newSegments = appendDiffSegment(newSegments, newTokens[j], false)
+			i++
+			j++
+		case j >= len(newTokens) || (i < len(oldTokens) && lengths[i+1][j] >= lengths[i][j+1]):
+			oldSegments = appendDiffSegment(oldSegments, oldTokens[i], true)
+			i++
+		default:
+			newSegments = appendDiffSegment(newSegments, newTokens[j], true)
+			j++
+		}
+	}
+	return mergeDiffSegments(oldSegments), mergeDiffSegments(newSegments)
+}
+
+// mergeDiffSegments joins changed segments only separated by whitespace, which is more readable than
+// the whitespace the longest common subsequence happened to match
+func mergeDiffSegments(segments []DiffSegment) []DiffSegment {
+	merged := segments[:0]
+	for i, segment := range segments {
+		if !segment.Changed && i > 0 && i < len(segments)-1 && strings.TrimSpace(segment.Content) == "" {
+			segment.Changed = true
+		}
+		merged = appendDiffSegment(merged, segment.Content, segment.Changed)
+	}
+	return merged
+}
+
+// appendDiffSegment appends the token to the last segment if it has the same state
+func appendDiffSegment(segments []DiffSegment, token string, changed bool) []DiffSegment {
+	if len(segments) > 0 && segments[len(segments)-1].Changed == changed {
+		segments[len(segments)-1].Content += token
+		return segments
+	}
+	return append(segments, DiffSegment{Content: token, Changed: changed})
+}
+
+// splitDiffTokens splits the content into words, runs of whitespace and single other characters
+func splitDiffTokens(content string) []string {
+	var tokens []string
+	for len(content) > 0 {
+		r, size := utf8.DecodeRuneInString(content)
+		if isDiffWordRune(r) || unicode.IsSpace(r) {
+			word := isDiffWordRune(r)
+			for size < len(content) {
+				next, n := utf8.DecodeRuneInString(content[size:])
+				if isDiffWordRune(next) != word || (!word && !unicode.IsSpace(next)) {
+					break
+				}
+				size += n
+			}
+		}
+		tokens = append(tokens, content[:size])
+		content = content[size:]
+	}
+	return tokens
+}
+
+func isDiffWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,74 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitDiffTokens(t *testing.T) {
+	assert.Equal(t, []string{"foo", "(", "bar_1", ",", "  ", "čaj", ")"}, splitDiffTokens("foo(bar_1,  čaj)"))
+	assert.Empty(t, splitDiffTokens(""))
+}
+
+func TestDiffRefineIntraline(t *testing.T) {
+	diff, err := ParseDiff(strings.NewReader(`diff --git a/main.go b/main.go
+index 4b825dc..b14df64 100644
+--- a/main.go
++++ b/main.go
+@@ -1,4 +1,4 @@
+ package main
+-func hello(name string) {
+-	println("Hello " + name)
++func hello(name, greeting string) {
++	println(greeting + name)
++	return
+ }
+`), ParseDiffOptions{})
+	assert.NoError(t, err)
+	diff.RefineIntraline()
+
+	lines := diff.Files[0].Hunks[0].Lines
+	assert.Nil(t, lines[0].Segments)
+	assert.Equal(t, []DiffSegment{
+		{Content: "func hello(name"},
+		{Content: ", greeting ", Changed: true},
+		{Content: "string) {"},
+	}, lines[3].Segments)
+	assert.Equal(t, []DiffSegment{{Content: "func hello(name string) {"}}, lines[1].Segments)
+	assert.Equal(t, []DiffSegment{
+		{Content: "\tprintln("},
+		{Content: "\"Hello \"", Changed: true},
+		{Content: " + name)"},
+	}, lines[2].Segments)
+	assert.Equal(t, []DiffSegment{
+		{Content: "\tprintln("},
+		{Content: "greeting", Changed: true},
+		{Content: " + name)"},
+	}, lines[4].Segments)
+	// the added line has no deleted line to pair with
+	assert.Nil(t, lines[5].Segments)
+	assert.Nil(t, lines[6].Segments)
+}
+
+func TestRepository_GetDiffIntraline(t *testing.T) {
+	bareRepo1Path := filepath.Join(testReposDir, "repo1_bare")
+	bareRepo1, err := openRepositoryWithDefaultContext(bareRepo1Path)
+	assert.NoError(t, err)
+	defer bareRepo1.Close()
+
+	diff, err := bareRepo1.GetParsedDiff("", "2839944139e0de9737a044f78b0e4b40d989a9e3", DiffOptions{Intraline: true})
+	assert.NoError(t, err)
+	lines := diff.Files[0].Hunks[0].Lines
+	if assert.Len(t, lines, 2) {
+		assert.Equal(t, DiffLineDel, lines[0].Type)
+		assert.NotEmpty(t, lines[0].Segments)
+		assert.NotEmpty(t, lines[1].Segments)
+	}
+}
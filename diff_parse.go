@@ -0,0 +1,324 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// DiffLineType represents the type of a line in a diff hunk.
+type DiffLineType uint8
+
+// DiffLineType possible values.
+const (
+	DiffLinePlain DiffLineType = iota + 1
+	DiffLineAdd
+	DiffLineDel
+)
+
+// DiffLine represents a single line of a diff hunk.
+// OldLineNum and NewLineNum are 0 when the line does not exist on that side.
+type DiffLine struct {
+	Type       DiffLineType
+	Content    string
+	OldLineNum int
+	NewLineNum int
+	// NoEOL is set when the line is followed by "\ No newline at end of file"
+	NoEOL bool
+	// Segments split the content of changed lines into the changed and unchanged words, see Diff.RefineIntraline
+	Segments []DiffSegment
+}
+
+// DiffHunk represents a hunk of a file diff started by a "@@ -a,b +c,d @@" header.
+type DiffHunk struct {
+	Header   string
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Lines    []*DiffLine
+}
+
+// DiffFileType represents the kind of change made to a file.
+type DiffFileType uint8
+
+// DiffFileType possible values.
+const (
+	DiffFileAdd DiffFileType = iota + 1
+	DiffFileChange
+	DiffFileDel
+	DiffFileRename
+	DiffFileCopy
+)
+
+// DiffFile represents a single file of a diff.
+type DiffFile struct {
+	Name         string
+	OldName      string
+	OldMode      string
+	Mode         string
+	OldID        string
+	NewID        string
+	Type         DiffFileType
+	IsBinary     bool
+	Similarity   int
+	Addition     int
+	Deletion     int
+	Hunks        []*DiffHunk
+	IsIncomplete bool
+	// Submodule is set if the file is a gitlink entry, the hunk of such a file only holds the "Subproject commit" lines
+	Submodule *SubmoduleChange
+}
+
+// Diff represents a parsed unified diff.
+type Diff struct {
+	Files         []*DiffFile
+	TotalAddition int
+	TotalDeletion int
+	IsIncomplete  bool
+}
+
+// ParseDiffOptions limits how much of a diff will be parsed.
+// A zero value means no limit.
+type ParseDiffOptions struct {
+	MaxFiles int
+	MaxLines int
+}
+
+// ParseDiff parses the output of `git diff -p` from the reader.
+// Parsing stops once one of the limits in opts is reached and the result is marked as incomplete,
+// the remaining input is left unread.
+func ParseDiff(r io.Reader, opts ParseDiffOptions) (*Diff, error) {
+	rd, ok := r.(*bufio.Reader)
+	if !ok {
+		rd = bufio.NewReader(r)
+	}
+
+	diff := &Diff{}
+	var (
+		file      *DiffFile
+		hunk      *DiffHunk
+		oldLine   int
+		newLine   int
+		lineCount int
+	)
+
+	for {
+		line, err := rd.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if len(line) == 0 && err == io.EOF {
+			break
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case strings.HasPrefix(line, cmdDiffHead):
+			if opts.MaxFiles > 0 && len(diff.Files) >= opts.MaxFiles {
+				diff.IsIncomplete = true
+				return diff, nil
+			}
+			oldName, newName, perr := parseDiffGitHeader(line[len(cmdDiffHead):])
+			if perr != nil {
+				return nil, perr
+			}
+			file = &DiffFile{
+				Name:    newName,
+				OldName: oldName,
+				Type:    DiffFileChange,
+			}
+			hunk = nil
+			diff.Files = append(diff.Files, file)
+		case file == nil:
+			// ignore anything before the first file header
+		case hunk != nil && len(line) > 0 && (line[0] == ' ' || line[0] == '+' || line[0] == '-' || line[0] == '\\'):
+			if line[0] == '\\' {
+				// "\ No newline at end of file" applies to the previous line
+				if len(hunk.Lines) > 0 {
+					hunk.Lines[len(hunk.Lines)-1].NoEOL = true
+				}
+				break
+			}
+			if opts.MaxLines > 0 && lineCount >= opts.MaxLines {
+				file.IsIncomplete = true
+				diff.IsIncomplete = true
+				return diff, nil
+			}
+			lineCount++
+			switch line[0] {
+			case ' ':
+				hunk.Lines = append(hunk.Lines, &DiffLine{Type: DiffLinePlain, Content: line[1:], OldLineNum: oldLine, NewLineNum: newLine})
+				oldLine++
+				newLine++
+			case '+':
+				if file.Submodule != nil {
+					file.Submodule.NewCommitID = parseSubprojectCommit(line[1:])
+				}
+				hunk.Lines = append(hunk.Lines, &DiffLine{Type: DiffLineAdd, Content: line[1:], NewLineNum: newLine})
+				newLine++
+				file.Addition++
+				diff.TotalAddition++
+			case '-':
+				if file.Submodule != nil {
+					file.Submodule.OldCommitID = parseSubprojectCommit(line[1:])
+				}
+				hunk.Lines = append(hunk.Lines, &DiffLine{Type: DiffLineDel, Content: line[1:], OldLineNum: oldLine})
+				oldLine++
+				file.Deletion++
+				diff.TotalDeletion++
+			}
+		case strings.HasPrefix(line, "@@"):
+			var herr error
+			hunk, herr = parseDiffHunkHeader(line)
+			if herr != nil {
+				return nil, herr
+			}
+			oldLine, newLine = hunk.OldStart, hunk.NewStart
+			file.Hunks = append(file.Hunks, hunk)
+		default:
+			parseDiffFileHeaderLine(file, line)
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+	return diff, nil
+}
+
+// parseDiffFileHeaderLine fills the file with the information of an extended header line
+func parseDiffFileHeaderLine(file *DiffFile, line string) {
+	switch {
+	case strings.HasPrefix(line, "new file mode "):
+		file.Type = DiffFileAdd
+		file.Mode = line[len("new file mode "):]
+	case strings.HasPrefix(line, "deleted file mode "):
+		file.Type = DiffFileDel
+		file.OldMode = line[len("deleted file mode "):]
+	case strings.HasPrefix(line, "old mode "):
+		file.OldMode = line[len("old mode "):]
+	case strings.HasPrefix(line, "new mode "):
+		file.Mode = line[len("new mode "):]
+	case strings.HasPrefix(line, "rename from "):
+		file.Type = DiffFileRename
+		file.OldName = unquoteDiffName(line[len("rename from "):])
+	case strings.HasPrefix(line, "rename to "):
+		file.Type = DiffFileRename
+		file.Name = unquoteDiffName(line[len("rename to "):])
+	case strings.HasPrefix(line, "copy from "):
+		file.Type = DiffFileCopy
+		file.OldName = unquoteDiffName(line[len("copy from "):])
+	case strings.HasPrefix(line, "copy to "):
+		file.Type = DiffFileCopy
+		file.Name = unquoteDiffName(line[len("copy to "):])
+	case strings.HasPrefix(line, "similarity index "):
+		file.Similarity, _ = strconv.Atoi(strings.TrimSuffix(line[len("similarity index "):], "%"))
+	case strings.HasPrefix(line, "index "):
+		// index <old>..<new> [<mode>]
+		fields := strings.Fields(line[len("index "):])
+		if len(fields) == 0 {
+			return
+		}
+		if ids := strings.SplitN(fields[0], "..", 2); len(ids) == 2 {
+			file.OldID, file.NewID = ids[0], ids[1]
+		}
+		if len(fields) > 1 {
+			file.OldMode, file.Mode = fields[1], fields[1]
+		}
+	case strings.HasPrefix(line, "Binary files ") || line == "GIT binary patch":
+		file.IsBinary = true
+	}
+	if file.Submodule == nil && (ToEntryMode(file.OldMode) == EntryModeCommit || ToEntryMode(file.Mode) == EntryModeCommit) {
+		file.Submodule = &SubmoduleChange{Path: file.Name}
+	}
+}
+
+// parseSubprojectCommit returns the commit ID of a "Subproject commit <id>" line of a gitlink diff,
+// without the "-dirty" suffix of a modified submodule worktree
+func parseSubprojectCommit(content string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(content, "Subproject commit "), "-dirty")
+}
+
+// parseDiffHunkHeader parses a "@@ -a,b +c,d @@ section" hunk header
+func parseDiffHunkHeader(line string) (*DiffHunk, error) {
+	submatches := hunkRegex.FindStringSubmatch(line)
+	if submatches == nil {
+		return nil, fmt.Errorf("invalid hunk header: %s", line)
+	}
+	hunk := &DiffHunk{
+		Header:   line,
+		OldLines: 1,
+		NewLines: 1,
+	}
+	hunk.OldStart, _ = strconv.Atoi(submatches[hunkRegex.SubexpIndex("beginOld")])
+	hunk.NewStart, _ = strconv.Atoi(submatches[hunkRegex.SubexpIndex("beginNew")])
+	if v := submatches[hunkRegex.SubexpIndex("endOld")]; v != "" {
+		hunk.OldLines, _ = strconv.Atoi(v)
+	}
+	if v := submatches[hunkRegex.SubexpIndex("endNew")]; v != "" {
+		hunk.NewLines, _ = strconv.Atoi(v)
+	}
+	return hunk, nil
+}
+
+// parseDiffGitHeader parses the "a/<old> b/<new>" part of a "diff --git" line
+func parseDiffGitHeader(header string) (oldName, newName string, err error) {
+	if strings.HasPrefix(header, `"`) {
+		end := closingQuoteIndex(header)
+		if end < 0 {
+			return "", "", fmt.Errorf("invalid diff header: %s", header)
+		}
+		oldName = unquoteDiffName(header[:end+1])
+		header = strings.TrimPrefix(header[end+1:], " ")
+		newName = unquoteDiffName(header)
+	} else if strings.HasSuffix(header, `"`) {
+		idx := strings.LastIndex(header, ` "`)
+		if idx < 0 {
+			return "", "", fmt.Errorf("invalid diff header: %s", header)
+		}
+		oldName = header[:idx]
+		newName = unquoteDiffName(header[idx+1:])
+	} else {
+		// names are not quoted so they can contain spaces, for the common case of
+		// equal names the header can be split in half, otherwise look for " b/"
+		if half := len(header) / 2; len(header)%2 == 1 && header[half] == ' ' && header[2:half] == header[half+3:] {
+			oldName, newName = header[:half], header[half+1:]
+		} else if idx := strings.Index(header, " b/"); idx >= 0 {
+			oldName, newName = header[:idx], header[idx+1:]
+		} else {
+			return "", "", fmt.Errorf("invalid diff header: %s", header)
+		}
+	}
+	return strings.TrimPrefix(oldName, "a/"), strings.TrimPrefix(newName, "b/"), nil
+}
+
+// closingQuoteIndex returns the index of the quote that closes the quoted string at the start of s
+func closingQuoteIndex(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// unquoteDiffName unquotes a C-style quoted file name as written by git when core.quotePath applies
+func unquoteDiffName(name string) string {
+	if len(name) < 2 || name[0] != '"' || name[len(name)-1] != '"' {
+		return name
+	}
+	if unquoted, err := strconv.Unquote(name); err == nil {
+		return unquoted
+	}
+	return name
+}
@@ -0,0 +1,286 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const parseDiffExample = `diff --git a/README.md b/README.md
+index 4b825dc..b14df64 100644
+--- a/README.md
++++ b/README.md
+@@ -1,3 +1,4 @@
+ # title
+-old line
++new line
++another line
+ footer
+\ No newline at end of file
+diff --git "a/with space.txt" "b/with space.txt"
+new file mode 100644
+index 0000000..b14df64
+--- /dev/null
++++ "b/with space.txt"
+@@ -0,0 +1 @@
++Hi
+diff --git a/old.txt b/new.txt
+similarity index 90%
+rename from old.txt
+rename to new.txt
+diff --git a/image.png b/image.png
+deleted file mode 100644
+index b14df64..0000000
+Binary files a/image.png and /dev/null differ
+`
+
+func TestParseDiff(t *testing.T) {
+	diff, err := ParseDiff(strings.NewReader(parseDiffExample), ParseDiffOptions{})
+	assert.NoError(t, err)
+	assert.False(t, diff.IsIncomplete)
+	assert.Len(t, diff.Files, 4)
+	assert.Equal(t, 3, diff.TotalAddition)
+	assert.Equal(t, 1, diff.TotalDeletion)
+
+	file := diff.Files[0]
+	assert.Equal(t, "README.md", file.Name)
+	assert.Equal(t, DiffFileChange, file.Type)
+	assert.Equal(t, "4b825dc", file.OldID)
+	assert.Equal(t, "b14df64", file.NewID)
+	assert.Len(t, file.Hunks, 1)
+	hunk := file.Hunks[0]
+	assert.Equal(t, 1, hunk.OldStart)
+	assert.Equal(t, 3, hunk.OldLines)
+	assert.Equal(t, 1, hunk.NewStart)
+	assert.Equal(t, 4, hunk.NewLines)
+	assert.Equal(t, []*DiffLine{
+		{Type: DiffLinePlain, Content: "# title", OldLineNum: 1, NewLineNum: 1},
+		{Type: DiffLineDel, Content: "old line", OldLineNum: 2},
+		{Type: DiffLineAdd, Content: "new line", NewLineNum: 2},
+		{Type: DiffLineAdd, Content: "another line", NewLineNum: 3},
+		{Type: DiffLinePlain, Content: "footer", OldLineNum: 3, NewLineNum: 4, NoEOL: true},
+	}, hunk.Lines)
+
+	file = diff.Files[1]
+	assert.Equal(t, "with space.txt", file.Name)
+	assert.Equal(t, DiffFileAdd, file.Type)
+	assert.Equal(t, "100644", file.Mode)
+	assert.Equal(t, 1, file.Addition)
+
+	file = diff.Files[2]
+	assert.Equal(t, DiffFileRename, file.Type)
+	assert.Equal(t, "old.txt", file.OldName)
+	assert.Equal(t, "new.txt", file.Name)
+	assert.Equal(t, 90, file.Similarity)
+
+	file = diff.Files[3]
+	assert.Equal(t, DiffFileDel, file.Type)
+	assert.True(t, file.IsBinary)
+	assert.Empty(t, file.Hunks)
+}
+
+func TestParseDiffLimits(t *testing.T) {
+	diff, err := ParseDiff(strings.NewReader(parseDiffExample), ParseDiffOptions{MaxFiles: 2})
+	assert.NoError(t, err)
+	assert.True(t, diff.IsIncomplete)
+	assert.Len(t, diff.Files, 2)
+
+	diff, err = ParseDiff(strings.NewReader(parseDiffExample), ParseDiffOptions{MaxLines: 2})
+	assert.NoError(t, err)
+	assert.True(t, diff.IsIncomplete)
+	assert.Len(t, diff.Files, 1)
+	assert.True(t, diff.Files[0].IsIncomplete)
+	assert.Len(t, diff.Files[0].Hunks[0].Lines, 2)
+}
+
+func TestParseDiffGitHeader(t *testing.T) {
+	tests := []struct {
+		header  string
+		oldName string
+		newName string
+	}{
+		{"a/foo b/foo", "foo", "foo"},
+		{"a/foo bar b/foo bar", "foo bar", "foo bar"},
+		{"a/foo b/bar", "foo", "bar"},
+		{`"a/\303\244.txt" "b/\303\244.txt"`, "ä.txt", "ä.txt"},
+		{`a/foo "b/b\"ar"`, "foo", `b"ar`},
+	}
+	for _, test := range tests {
+		oldName, newName, err := parseDiffGitHeader(test.header)
+		assert.NoError(t, err)
+		assert.Equal(t, test.oldName, oldName, test.header)
+		assert.Equal(t, test.newName, newName, test.header)
+	}
+}
+
+func TestRepository_GetParsedDiff(t *testing.T) {
+	bareRepo1Path := filepath.Join(testReposDir, "repo1_bare")
+	bareRepo1, err := openRepositoryWithDefaultContext(bareRepo1Path)
+	assert.NoError(t, err)
+	defer bareRepo1.Close()
+
+	diff, err := bareRepo1.GetParsedDiff("8d92fc957a4d7cfd98bc375f0b7bb189a0d6c9f2", "37991dec2c8e592043f47155ce4808d4580f9123", DiffOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, diff.Files, 5)
+	assert.Equal(t, 5, diff.TotalAddition)
+	assert.Equal(t, "foo/bar/link_to_hello", diff.Files[0].Name)
+	assert.Equal(t, DiffFileAdd, diff.Files[0].Type)
+	assert.Equal(t, "120000", diff.Files[0].Mode)
+
+	diff, err = bareRepo1.GetParsedDiff("", "95bb4d39648ee7e325106df01a621c530863a653", DiffOptions{MaxFiles: 1})
+	assert.NoError(t, err)
+	assert.Len(t, diff.Files, 1)
+	assert.Equal(t, "file1.txt", diff.Files[0].Name)
+}
+
+func TestRepository_GetDiffBinary(t *testing.T) {
+	repoPath := t.TempDir()
+	repo, err := InitRepository(DefaultContext, repoPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	committer := &Signature{Name: "Test", Email: "test@example.com"}
+	assert.NoError(t, os.WriteFile(filepath.Join(repoPath, ".gitattributes"), []byte("*.dat binary\n"), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(repoPath, "README.md"), []byte("readme\n"), 0o644))
+	assert.NoError(t, AddChanges(repoPath, false, ".gitattributes", "README.md"))
+	assert.NoError(t, CommitChanges(repoPath, CommitChangesOptions{Committer: committer, Message: "initial"}))
+	base, err := repo.GetRefCommitID("HEAD")
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(repoPath, "image.png"), []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(repoPath, "data.dat"), []byte("text marked as binary\n"), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(repoPath, "README.md"), []byte("readme\nchanged\n"), 0o644))
+	assert.NoError(t, AddChanges(repoPath, false, "image.png", "data.dat", "README.md"))
+	assert.NoError(t, CommitChanges(repoPath, CommitChangesOptions{Committer: committer, Message: "binary"}))
+	head, err := repo.GetRefCommitID("HEAD")
+	assert.NoError(t, err)
+
+	files, err := repo.GetBinaryChangedFiles("", head)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"data.dat", "image.png"}, files)
+	files, err = repo.GetBinaryChangedFiles(base, head, "README.md")
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+
+	for _, binary := range []bool{false, true} {
+		diff, err := repo.GetParsedDiff(base, head, DiffOptions{Binary: binary})
+		assert.NoError(t, err)
+		if assert.Len(t, diff.Files, 3) {
+			assert.Equal(t, "README.md", diff.Files[0].Name)
+			assert.False(t, diff.Files[0].IsBinary)
+			assert.Len(t, diff.Files[0].Hunks, 1)
+			assert.True(t, diff.Files[1].IsBinary)
+			assert.Empty(t, diff.Files[1].Hunks)
+			assert.True(t, diff.Files[2].IsBinary)
+		}
+	}
+
+	// only the binary patch can be applied
+	patch := new(bytes.Buffer)
+	assert.NoError(t, repo.WriteDiff(base, head, patch, DiffOptions{}))
+	assert.Contains(t, patch.String(), "Binary files /dev/null and b/image.png differ")
+	assert.Error(t, repo.CheckPatchApplies(base, patch))
+
+	patch.Reset()
+	assert.NoError(t, repo.WriteDiff(base, head, patch, DiffOptions{Binary: true}))
+	assert.Contains(t, patch.String(), "GIT binary patch")
+	assert.NoError(t, repo.CheckPatchApplies(base, patch))
+}
+
+func TestRepository_GetFileDiff(t *testing.T) {
+	repoPath := t.TempDir()
+	repo, err := InitRepository(DefaultContext, repoPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	committer := &Signature{Name: "Test", Email: "test@example.com"}
+	assert.NoError(t, os.WriteFile(filepath.Join(repoPath, "a.txt"), []byte("1\n2\n3\n4\n5\n6\n7\n8\n"), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(repoPath, "b.txt"), []byte("b\n"), 0o644))
+	assert.NoError(t, AddChanges(repoPath, false, "a.txt", "b.txt"))
+	assert.NoError(t, CommitChanges(repoPath, CommitChangesOptions{Committer: committer, Message: "initial"}))
+
+	assert.NoError(t, os.WriteFile(filepath.Join(repoPath, "a.txt"), []byte("1  \n2\n3\n4\n5\n6\n7\neight\n"), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(repoPath, "b.txt"), []byte("changed\n"), 0o644))
+	assert.NoError(t, AddChanges(repoPath, false, "a.txt", "b.txt"))
+	assert.NoError(t, CommitChanges(repoPath, CommitChangesOptions{Committer: committer, Message: "change"}))
+
+	out := new(strings.Builder)
+	assert.NoError(t, repo.GetFileDiff("", "HEAD", "a.txt", out, DiffOptions{Paths: []string{"b.txt"}}))
+	assert.Contains(t, out.String(), "diff --git a/a.txt b/a.txt")
+	assert.NotContains(t, out.String(), "b.txt")
+	assert.Contains(t, out.String(), "-1\n+1  \n")
+	assert.Contains(t, out.String(), "+eight\n")
+
+	out.Reset()
+	assert.NoError(t, repo.GetFileDiff("", "HEAD", "a.txt", out, DiffOptions{WhitespaceOptions: WhitespaceOptions{IgnoreWhitespaceAtEOL: true}, ContextLines: 1}))
+	assert.NotContains(t, out.String(), "+1  ")
+	assert.Contains(t, out.String(), "@@ -7,2 +7,2 @@\n 7\n-8\n+eight\n")
+
+	out.Reset()
+	assert.NoError(t, repo.GetFileDiff("", "HEAD", "unknown.txt", out, DiffOptions{}))
+	assert.Empty(t, out.String())
+
+	assert.Error(t, repo.GetFileDiff("", "unknown", "a.txt", out, DiffOptions{}))
+}
+
+func TestRepository_DiffWhitespaceOptions(t *testing.T) {
+	repoPath := t.TempDir()
+	repo, err := InitRepository(DefaultContext, repoPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	committer := &Signature{Name: "Test", Email: "test@example.com"}
+	write := func(files map[string]string) string {
+		for name, content := range files {
+			assert.NoError(t, os.WriteFile(filepath.Join(repoPath, name), []byte(content), 0o644))
+		}
+		assert.NoError(t, AddChanges(repoPath, false, "spaces.txt", "blank.txt", "code.txt"))
+		assert.NoError(t, CommitChanges(repoPath, CommitChangesOptions{Committer: committer, Message: "commit"}))
+		id, err := repo.GetRefCommitID("HEAD")
+		assert.NoError(t, err)
+		return id
+	}
+	base := write(map[string]string{"spaces.txt": "a b\n", "blank.txt": "a\nb\n", "code.txt": "x\n"})
+	head := write(map[string]string{"spaces.txt": "a  b \n", "blank.txt": "a\n\nb\n", "code.txt": "y\n"})
+
+	for _, c := range []struct {
+		opts  WhitespaceOptions
+		files []string
+	}{
+		{WhitespaceOptions{}, []string{"blank.txt", "code.txt", "spaces.txt"}},
+		{WhitespaceOptions{IgnoreWhitespace: true}, []string{"blank.txt", "code.txt"}},
+		{WhitespaceOptions{IgnoreWhitespaceChange: true}, []string{"blank.txt", "code.txt"}},
+		{WhitespaceOptions{IgnoreWhitespaceAtEOL: true}, []string{"blank.txt", "code.txt", "spaces.txt"}},
+		{WhitespaceOptions{IgnoreWhitespace: true, IgnoreBlankLines: true}, []string{"code.txt"}},
+	} {
+		diff, err := repo.GetParsedDiff(base, head, DiffOptions{WhitespaceOptions: c.opts})
+		assert.NoError(t, err)
+		var names []string
+		for _, file := range diff.Files {
+			if len(file.Hunks) > 0 {
+				names = append(names, file.Name)
+			}
+		}
+		assert.Equal(t, c.files, names, "%+v", c.opts)
+
+		stats, err := repo.DiffStats(base, head, DiffStatsOptions{DirectComparison: true, WhitespaceOptions: c.opts})
+		assert.NoError(t, err)
+		assert.Equal(t, len(c.files), stats.NumFiles, "%+v", c.opts)
+
+		fileStatus, err := repo.GetFileStatusBetween(base, head, FileStatusOptions{WhitespaceOptions: c.opts})
+		assert.NoError(t, err)
+		assert.Equal(t, c.files, fileStatus.Modified, "%+v", c.opts)
+
+		count, err := repo.FilesCountBetweenWithOptions(base, head, FileStatusOptions{WhitespaceOptions: c.opts})
+		assert.NoError(t, err)
+		assert.Equal(t, len(c.files), count, "%+v", c.opts)
+	}
+}
@@ -5,6 +5,7 @@
 package git
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -186,3 +187,161 @@ func IsErrMoreThanOne(err error) bool {
 func (err *ErrMoreThanOne) Error() string {
 	return fmt.Sprintf("ErrMoreThanOne Error: %v: %s\n%s", err.Err, err.StdErr, err.StdOut)
 }
+
+// ErrAuthenticationFailed represents an error if the remote rejected or asked for credentials
+type ErrAuthenticationFailed struct {
+	Remote string
+	StdErr string
+	Err    error
+}
+
+// IsErrAuthenticationFailed checks if an error is a ErrAuthenticationFailed
+func IsErrAuthenticationFailed(err error) bool {
+	var target *ErrAuthenticationFailed
+	return errors.As(err, &target)
+}
+
+func (err *ErrAuthenticationFailed) Error() string {
+	return fmt.Sprintf("authentication failed for remote %s: %v: %s", err.Remote, err.Err, err.StdErr)
+}
+
+// Unwrap unwraps the underlying error
+func (err *ErrAuthenticationFailed) Unwrap() error {
+	return err.Err
+}
+
+// ErrRemoteNotFound represents an error if the remote repository or a requested remote ref does not exist
+type ErrRemoteNotFound struct {
+	Remote string
+	StdErr string
+	Err    error
+}
+
+// IsErrRemoteNotFound checks if an error is a ErrRemoteNotFound
+func IsErrRemoteNotFound(err error) bool {
+	var target *ErrRemoteNotFound
+	return errors.As(err, &target)
+}
+
+func (err *ErrRemoteNotFound) Error() string {
+	return fmt.Sprintf("remote %s not found: %v: %s", err.Remote, err.Err, err.StdErr)
+}
+
+// Is reports the error as util.ErrNotExist
+func (err *ErrRemoteNotFound) Is(target error) bool {
+	return target == util.ErrNotExist
+}
+
+// Unwrap unwraps the underlying error
+func (err *ErrRemoteNotFound) Unwrap() error {
+	return err.Err
+}
+
+// ErrFetchRejected represents an error if refs were not updated by a fetch because the update is not a fast-forward
+type ErrFetchRejected struct {
+	// Refs are the local refs which were not updated
+	Refs   []string
+	StdErr string
+	Err    error
+}
+
+// IsErrFetchRejected checks if an error is a ErrFetchRejected
+func IsErrFetchRejected(err error) bool {
+	var target *ErrFetchRejected
+	return errors.As(err, &target)
+}
+
+func (err *ErrFetchRejected) Error() string {
+	return fmt.Sprintf("fetch rejected non-fast-forward update of %s: %v", strings.Join(err.Refs, ", "), err.Err)
+}
+
+// Unwrap unwraps the underlying error
+func (err *ErrFetchRejected) Unwrap() error {
+	return err.Err
+}
+
+// ErrCherryPickConflict represents an error if a commit can not be cherry-picked cleanly
+type ErrCherryPickConflict struct {
+	CommitID  string
+	Onto      string
+	Conflicts []*MergeTreeConflict
+}
+
+// IsErrCherryPickConflict checks if an error is a ErrCherryPickConflict
+func IsErrCherryPickConflict(err error) bool {
+	var target *ErrCherryPickConflict
+	return errors.As(err, &target)
+}
+
+func (err *ErrCherryPickConflict) Error() string {
+	paths := make([]string, 0, len(err.Conflicts))
+	for _, conflict := range err.Conflicts {
+		paths = append(paths, conflict.Path)
+	}
+	return fmt.Sprintf("cherry-pick of %s onto %s conflicts in %s", err.CommitID, err.Onto, strings.Join(paths, ", "))
+}
+
+// ErrMergeConflict represents an error if head can not be merged into base cleanly
+type ErrMergeConflict struct {
+	Base      string
+	Head      string
+	Conflicts []*MergeTreeConflict
+}
+
+// IsErrMergeConflict checks if an error is a ErrMergeConflict
+func IsErrMergeConflict(err error) bool {
+	var target *ErrMergeConflict
+	return errors.As(err, &target)
+}
+
+func (err *ErrMergeConflict) Error() string {
+	paths := make([]string, 0, len(err.Conflicts))
+	for _, conflict := range err.Conflicts {
+		paths = append(paths, conflict.Path)
+	}
+	return fmt.Sprintf("merge of %s into %s conflicts in %s", err.Head, err.Base, strings.Join(paths, ", "))
+}
+
+// ErrPatchDoesNotApply represents an error if a patch does not apply to a tree
+type ErrPatchDoesNotApply struct {
+	Failures []*PatchApplyFailure
+	StdErr   string
+}
+
+// IsErrPatchDoesNotApply checks if an error is a ErrPatchDoesNotApply
+func IsErrPatchDoesNotApply(err error) bool {
+	var target *ErrPatchDoesNotApply
+	return errors.As(err, &target)
+}
+
+func (err *ErrPatchDoesNotApply) Error() string {
+	return fmt.Sprintf("patch does not apply: %s", strings.TrimSpace(err.StdErr))
+}
+
+// ErrRefUpdateConflict represents an error if a reference of a transaction does not have the expected old value
+type ErrRefUpdateConflict struct {
+	Ref    string
+	StdErr string
+}
+
+// IsErrRefUpdateConflict checks if an error is a ErrRefUpdateConflict
+func IsErrRefUpdateConflict(err error) bool {
+	var target *ErrRefUpdateConflict
+	return errors.As(err, &target)
+}
+
+func (err *ErrRefUpdateConflict) Error() string {
+	return fmt.Sprintf("unable to update %s: %s", err.Ref, strings.TrimSpace(err.StdErr))
+}
+
+// The errors failures of git commands are classified as by the command runner, check them with errors.Is
+var (
+	// ErrNoMergeBase is returned if two revisions compared by their merge base have unrelated histories
+	ErrNoMergeBase = errors.New("no merge base")
+	// ErrUnknownRevision is returned if a revision or object name can't be resolved
+	ErrUnknownRevision = errors.New("unknown revision")
+	// ErrNothingToCommit is returned by git commit if there are no changes to commit
+	ErrNothingToCommit = errors.New("nothing to commit")
+	// ErrLockedRef is returned if a ref can't be locked because another process holds its lock file
+	ErrLockedRef = errors.New("ref is locked")
+)
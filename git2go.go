@@ -0,0 +1,228 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build !nogit2go
+
+package git
+
+import (
+	"fmt"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	git2go "github.com/libgit2/git2go/v34"
+)
+
+// hasGit2Go is true as libgit2 is linked in, the operations supporting it run it unless their backend is BackendCLI
+const hasGit2Go = true
+
+type libgit2Repository = git2go.Repository
+
+func openLibgit2Repository(repoPath string) (*libgit2Repository, error) {
+	return git2go.OpenRepository(repoPath)
+}
+
+func (repo *Repository) getFullCommitIDWithGit2Go(ref string) (string, error) {
+	revspec, err := repo.git2go.RevparseSingle(ref)
+	if err != nil {
+		return "", fmt.Errorf("failed to get full commit id: %w", err)
+	}
+
+	return revspec.Id().String(), nil
+}
+
+func (repo *Repository) getMergeBaseWithGit2Go(base, head string) (string, error) {
+	baseOid, err := git2go.NewOid(base)
+	if err != nil {
+		return "", err
+	}
+	headOid, err := git2go.NewOid(head)
+	if err != nil {
+		return "", err
+	}
+	commit, err := repo.git2go.MergeBase(baseOid, headOid)
+	if err != nil {
+		return "", err
+	}
+
+	return commit.String(), nil
+}
+
+func (repo *Repository) readTreeToIndexWithGit2Go(id ObjectID, indexFilename string) error {
+	var (
+		index *git2go.Index
+		err   error
+	)
+
+	if indexFilename != "" {
+		index, err = git2go.OpenIndex(indexFilename)
+	} else {
+		index, err = git2go.NewIndex()
+	}
+	if err != nil {
+		return err
+	}
+
+	oid, err := git2go.NewOid(id.String())
+	if err != nil {
+		return err
+	}
+
+	ref, err := repo.git2go.LookupCommit(oid)
+	if err != nil {
+		return err
+	}
+
+	obj, err := ref.Peel(git2go.ObjectTree)
+	if err != nil {
+		return err
+	}
+
+	tree, err := obj.AsTree()
+	if err != nil {
+		return err
+	}
+
+	err = index.ReadTree(tree)
+	if err != nil {
+		return err
+	}
+
+	err = index.Write()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo *Repository) removeFilesFromIndexWithGit2Go(filenames ...string) error {
+	ndx, err := repo.git2go.Index()
+	if err != nil {
+		return err
+	}
+
+	for _, file := range filenames {
+		if file != "" {
+			err = ndx.RemoveByPath(file)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (repo *Repository) addObjectToIndexWithGit2Go(object ObjectID, filename string) error {
+	ndx, err := repo.git2go.Index()
+	if err != nil {
+		return err
+	}
+
+	oid, err := git2go.NewOid(object.String())
+	if err != nil {
+		return err
+	}
+
+	err = ndx.Add(&git2go.IndexEntry{
+		Mode: git2go.FilemodeBlob,
+		Id:   oid,
+		Path: filename,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to add object to index at %s in repo %s: %w", object, repo.Path, err)
+	}
+
+	return nil
+}
+
+func (repo *Repository) writeTreeWithGit2Go() (*Tree, error) {
+	ndx, err := repo.git2go.Index()
+	if err != nil {
+		return nil, err
+	}
+	oid, err := ndx.WriteTree()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewTree(repo, plumbing.NewHash(oid.String())), nil
+}
+
+// commitTreeWithGit2Go creates the commit and updates ref to it, the parents are resolved already
+func (repo *Repository) commitTreeWithGit2Go(ref string, author, committer *Signature, tree *Tree, parentIDs []string, opts CommitTreeOpts) (ObjectID, error) {
+	oid, err := git2go.NewOid(tree.ID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := repo.git2go.LookupTree(oid)
+	if err != nil {
+		return nil, err
+	}
+
+	parents := make([]*git2go.Commit, 0, len(parentIDs))
+	for _, parentID := range parentIDs {
+		parentOid, err := git2go.NewOid(parentID)
+		if err != nil {
+			return nil, err
+		}
+		parent, err := repo.git2go.LookupCommit(parentOid)
+		if err != nil {
+			return nil, fmt.Errorf("unable to lookup parent %s: %w", parentID, err)
+		}
+		parents = append(parents, parent)
+	}
+
+	authorSig := &git2go.Signature{
+		Name:  author.Name,
+		Email: author.Email,
+		When:  author.When,
+	}
+	committerSig := &git2go.Signature{
+		Name:  committer.Name,
+		Email: committer.Email,
+		When:  committer.When,
+	}
+
+	if !opts.sign() {
+		// in a dry run the commit is created without updating ref
+		if skipDryRun(repo.Ctx, "update %s to the new commit [repo_path: %s]", ref, repo.Path) {
+			ref = ""
+		}
+		oid, err = repo.git2go.CreateCommit(ref, authorSig, committerSig, opts.Message, t, parents...)
+		if err != nil {
+			return nil, err
+		}
+		return NewIDFromString(oid.String())
+	}
+
+	signer := repo.injectedSigner(opts.Signer)
+	if signer == nil {
+		if signer, err = repo.Signer(opts.SigningFormat, opts.KeyID); err != nil {
+			return nil, err
+		}
+	}
+	buffer, err := repo.git2go.CreateCommitBuffer(authorSig, committerSig, git2go.MessageEncodingUTF8, opts.Message, t, parents...)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := signer(buffer)
+	if err != nil {
+		return nil, err
+	}
+	oid, err = repo.git2go.CreateCommitWithSignature(string(buffer), signature, signatureHeader(repo.ObjectFormat()))
+	if err != nil {
+		return nil, err
+	}
+	sha1, err := NewIDFromString(oid.String())
+	if err != nil {
+		return nil, err
+	}
+
+	// CreateCommitWithSignature does not update any reference
+	if err := repo.updateCommitRef(ref, sha1, parentIDs, opts.Message); err != nil {
+		return nil, err
+	}
+	return sha1, nil
+}
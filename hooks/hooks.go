@@ -0,0 +1,292 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package hooks manages the server side hooks of bare repositories.
+//
+// Every hook is installed as a dispatcher script at hooks/<name> which runs
+// the executable scripts found in hooks/<name>.d/, so several scripts can
+// handle the same hook. A hook which existed before is kept as the script
+// hooks/<name>.d/<name>.orig.
+package hooks
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/enverbisevac/gitlib/util"
+)
+
+// Names is the list of server hooks which can be managed.
+var Names = []string{
+	"pre-receive",
+	"update",
+	"post-receive",
+	"proc-receive",
+}
+
+var (
+	// ErrInvalidName occurs if a hook is not one of Names or a script name is not a plain file name
+	ErrInvalidName = errors.New("not a valid hook name")
+
+	// ErrNotExecutable occurs if a hook or script file is not executable
+	ErrNotExecutable = errors.New("hook is not executable")
+
+	// ErrExists occurs if a hook which isn't a dispatcher can't be kept because its script already exists
+	ErrExists = errors.New("hook script already exists")
+)
+
+// IsValidName returns true if name is one of the managed server hooks.
+func IsValidName(name string) bool {
+	for _, n := range Names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Script is a single script in the hooks/<name>.d directory.
+type Script struct {
+	Name       string
+	Path       string
+	Executable bool
+}
+
+// Hook represents a server hook and its scripts.
+type Hook struct {
+	Name string
+	// Path of the dispatcher script hooks/<name>
+	Path string
+	// Installed is true if the dispatcher script exists
+	Installed  bool
+	Executable bool
+	Scripts    []*Script
+}
+
+// Dir returns the hooks directory of the bare repository.
+func Dir(repoPath string) string {
+	return filepath.Join(repoPath, "hooks")
+}
+
+func scriptPath(repoPath, name, script string) (string, error) {
+	if !IsValidName(name) {
+		return "", fmt.Errorf("%w: %s", ErrInvalidName, name)
+	}
+	if script == "" || script == "." || script == ".." || strings.ContainsAny(script, `/\`) {
+		return "", fmt.Errorf("%w: %s", ErrInvalidName, script)
+	}
+	return filepath.Join(Dir(repoPath), name+".d", script), nil
+}
+
+func isExecutable(info os.FileInfo) bool {
+	return info.Mode().IsRegular() && info.Mode().Perm()&0o111 != 0
+}
+
+// Get returns the hook with the given name and its scripts.
+func Get(repoPath, name string) (*Hook, error) {
+	if !IsValidName(name) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidName, name)
+	}
+	h := &Hook{
+		Name: name,
+		Path: filepath.Join(Dir(repoPath), name),
+	}
+	info, err := os.Stat(h.Path)
+	if err == nil {
+		h.Installed = true
+		h.Executable = isExecutable(info)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(filepath.Join(Dir(repoPath), name+".d"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return h, nil
+		}
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasSuffix(entry.Name(), ".sample") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		h.Scripts = append(h.Scripts, &Script{
+			Name:       entry.Name(),
+			Path:       filepath.Join(Dir(repoPath), name+".d", entry.Name()),
+			Executable: isExecutable(info),
+		})
+	}
+	sort.Slice(h.Scripts, func(i, j int) bool {
+		return h.Scripts[i].Name < h.Scripts[j].Name
+	})
+	return h, nil
+}
+
+// List returns all server hooks of the repository.
+func List(repoPath string) ([]*Hook, error) {
+	isDir, err := util.IsDir(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	if !isDir {
+		return nil, fmt.Errorf("repository path does not exist: %s", repoPath)
+	}
+
+	hooks := make([]*Hook, 0, len(Names))
+	for _, name := range Names {
+		h, err := Get(repoPath, name)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, h)
+	}
+	return hooks, nil
+}
+
+// ReadScript returns the content of the script hooks/<name>.d/<script>.
+func ReadScript(repoPath, name, script string) ([]byte, error) {
+	p, err := scriptPath(repoPath, name, script)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(p)
+}
+
+// WriteScript creates or updates the script hooks/<name>.d/<script> and installs the dispatcher of the hook.
+// Carriage returns are removed from the content, otherwise the shebang line breaks.
+func WriteScript(repoPath, name, script string, content []byte) error {
+	p, err := scriptPath(repoPath, name, script)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+		return err
+	}
+	if err := installDispatcher(repoPath, name); err != nil {
+		return err
+	}
+	return writeExecutable(p, []byte(strings.ReplaceAll(string(content), "\r", "")))
+}
+
+// installDispatcher writes the dispatcher as hooks/<name>, a hook which isn't a dispatcher is moved to hooks/<name>.d/<name>.orig before
+func installDispatcher(repoPath, name string) error {
+	hookPath := filepath.Join(Dir(repoPath), name)
+	content, err := os.ReadFile(hookPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// dispatchers of earlier versions are replaced
+	if err == nil && !strings.Contains(string(content), dispatcherMarker) {
+		origPath := filepath.Join(Dir(repoPath), name+".d", name+".orig")
+		if _, err := os.Lstat(origPath); err == nil {
+			return fmt.Errorf("%w: %s", ErrExists, origPath)
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+		if err := util.Rename(hookPath, origPath); err != nil {
+			return err
+		}
+	}
+	return writeExecutable(hookPath, []byte(dispatcher(name)))
+}
+
+// RemoveScript deletes the script hooks/<name>.d/<script>.
+// The dispatcher is kept, it does nothing without scripts, except the one of proc-receive which fails.
+func RemoveScript(repoPath, name, script string) error {
+	p, err := scriptPath(repoPath, name, script)
+	if err != nil {
+		return err
+	}
+	return util.Remove(p)
+}
+
+// Install writes the given templates, a map of hook name to script content, as hooks/<name>.d/<name>.
+func Install(repoPath string, templates map[string]string) error {
+	for name, content := range templates {
+		if err := WriteScript(repoPath, name, name, []byte(content)); err != nil {
+			return fmt.Errorf("unable to install %s hook: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Validate checks that the installed dispatchers and all their scripts are executable.
+func Validate(repoPath string) error {
+	hooks, err := List(repoPath)
+	if err != nil {
+		return err
+	}
+	for _, h := range hooks {
+		if h.Installed && !h.Executable {
+			return fmt.Errorf("%w: %s", ErrNotExecutable, h.Path)
+		}
+		for _, s := range h.Scripts {
+			if !s.Executable {
+				return fmt.Errorf("%w: %s", ErrNotExecutable, s.Path)
+			}
+		}
+	}
+	return nil
+}
+
+// writeExecutable writes the file and makes sure it is executable even if it already existed.
+func writeExecutable(p string, content []byte) error {
+	if err := os.WriteFile(p, content, 0o755); err != nil {
+		return err
+	}
+	return os.Chmod(p, 0o755)
+}
+
+// dispatcherMarker is the line which identifies a dispatcher script
+const dispatcherMarker = "# AUTO GENERATED, DO NOT MODIFY"
+
+// dispatcher returns the script installed as hooks/<name>, it runs the scripts of hooks/<name>.d in order
+func dispatcher(name string) string {
+	switch name {
+	case "update":
+		return `#!/usr/bin/env bash
+# AUTO GENERATED, DO NOT MODIFY
+GIT_DIR=${GIT_DIR:-$(dirname "$0")/..}
+for hook in "${GIT_DIR}"/hooks/update.d/*; do
+  test -x "${hook}" && test -f "${hook}" || continue
+  "${hook}" "$1" "$2" "$3" || exit $?
+done
+`
+	case "proc-receive":
+		// proc-receive talks to git over stdin and stdout, only one script can handle it.
+		// git waits for its answer, so it fails without a script instead of doing nothing.
+		return `#!/usr/bin/env bash
+# AUTO GENERATED, DO NOT MODIFY
+GIT_DIR=${GIT_DIR:-$(dirname "$0")/..}
+for hook in "${GIT_DIR}"/hooks/proc-receive.d/*; do
+  test -x "${hook}" && test -f "${hook}" || continue
+  exec "${hook}"
+done
+echo "proc-receive: no executable script in ${GIT_DIR}/hooks/proc-receive.d" >&2
+exit 1
+`
+	}
+	return `#!/usr/bin/env bash
+# AUTO GENERATED, DO NOT MODIFY
+data=$(cat)
+exitcodes=""
+GIT_DIR=${GIT_DIR:-$(dirname "$0")/..}
+for hook in "${GIT_DIR}"/hooks/` + name + `.d/*; do
+  test -x "${hook}" && test -f "${hook}" || continue
+  echo "${data}" | "${hook}"
+  exitcodes="${exitcodes} $?"
+done
+for i in ${exitcodes}; do
+  [ "${i}" -eq 0 ] || exit "${i}"
+done
+`
+}
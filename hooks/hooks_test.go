@@ -0,0 +1,90 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package hooks
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHooks(t *testing.T) {
+	repoPath := t.TempDir()
+
+	hooks, err := List(repoPath)
+	assert.NoError(t, err)
+	assert.Len(t, hooks, len(Names))
+	for _, h := range hooks {
+		assert.False(t, h.Installed)
+		assert.Empty(t, h.Scripts)
+	}
+
+	assert.NoError(t, Install(repoPath, map[string]string{"pre-receive": "#!/bin/sh\r\nexit 0\r\n"}))
+	assert.NoError(t, WriteScript(repoPath, "pre-receive", "audit", []byte("#!/bin/sh\nexit 1\n")))
+
+	h, err := Get(repoPath, "pre-receive")
+	assert.NoError(t, err)
+	assert.True(t, h.Installed)
+	assert.True(t, h.Executable)
+	if assert.Len(t, h.Scripts, 2) {
+		assert.Equal(t, "audit", h.Scripts[0].Name)
+		assert.Equal(t, "pre-receive", h.Scripts[1].Name)
+		assert.True(t, h.Scripts[1].Executable)
+	}
+
+	content, err := ReadScript(repoPath, "pre-receive", "pre-receive")
+	assert.NoError(t, err)
+	assert.Equal(t, "#!/bin/sh\nexit 0\n", string(content))
+	assert.NoError(t, Validate(repoPath))
+
+	assert.NoError(t, os.Chmod(filepath.Join(repoPath, "hooks", "pre-receive.d", "audit"), 0o644))
+	assert.ErrorIs(t, Validate(repoPath), ErrNotExecutable)
+	// updating a script makes it executable again
+	assert.NoError(t, WriteScript(repoPath, "pre-receive", "audit", []byte("#!/bin/sh\nexit 0\n")))
+	assert.NoError(t, Validate(repoPath))
+
+	assert.NoError(t, RemoveScript(repoPath, "pre-receive", "audit"))
+	assert.NoError(t, RemoveScript(repoPath, "pre-receive", "audit"))
+	h, err = Get(repoPath, "pre-receive")
+	assert.NoError(t, err)
+	assert.Len(t, h.Scripts, 1)
+
+	// an existing hook is kept as a script
+	assert.NoError(t, os.WriteFile(filepath.Join(repoPath, "hooks", "update"), []byte("#!/bin/sh\nexit 0\n"), 0o755))
+	assert.NoError(t, WriteScript(repoPath, "update", "check", []byte("#!/bin/sh\nexit 0\n")))
+	content, err = ReadScript(repoPath, "update", "update.orig")
+	assert.NoError(t, err)
+	assert.Equal(t, "#!/bin/sh\nexit 0\n", string(content))
+	content, err = os.ReadFile(filepath.Join(repoPath, "hooks", "update"))
+	assert.NoError(t, err)
+	assert.Equal(t, dispatcher("update"), string(content))
+	// the dispatcher is only rewritten
+	assert.NoError(t, WriteScript(repoPath, "update", "check", []byte("#!/bin/sh\nexit 1\n")))
+	h, err = Get(repoPath, "update")
+	assert.NoError(t, err)
+	assert.Len(t, h.Scripts, 2)
+	assert.NoError(t, os.WriteFile(filepath.Join(repoPath, "hooks", "update"), []byte("#!/bin/sh\nexit 1\n"), 0o755))
+	assert.ErrorIs(t, WriteScript(repoPath, "update", "check", nil), ErrExists)
+
+	// git waits for the answer of proc-receive, it fails without a script
+	assert.NoError(t, WriteScript(repoPath, "proc-receive", "agit", []byte("#!/bin/sh\nexit 0\n")))
+	assert.NoError(t, RemoveScript(repoPath, "proc-receive", "agit"))
+	cmd := exec.Command(filepath.Join(repoPath, "hooks", "proc-receive"))
+	cmd.Env = append(os.Environ(), "GIT_DIR="+repoPath)
+	output, err := cmd.CombinedOutput()
+	assert.Error(t, err)
+	assert.Contains(t, string(output), "no executable script")
+
+	_, err = Get(repoPath, "pre-commit")
+	assert.ErrorIs(t, err, ErrInvalidName)
+	assert.ErrorIs(t, WriteScript(repoPath, "update", "../update", nil), ErrInvalidName)
+	_, err = ReadScript(repoPath, "update", "missing")
+	assert.True(t, os.IsNotExist(err))
+	_, err = List(filepath.Join(repoPath, "missing"))
+	assert.Error(t, err)
+}
@@ -6,28 +6,44 @@ package git
 
 import (
 	"crypto/sha256"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/enverbisevac/gitlib/cache"
+	"github.com/enverbisevac/gitlib/cache/memory"
 	"github.com/enverbisevac/gitlib/log"
 )
 
+// ErrLastCommitCacheDisabled is returned by the methods of a nil LastCommitCache which can't do without it
+var ErrLastCommitCacheDisabled = errors.New("last commit cache is disabled")
+
+// lastCommitLocalSize is the number of commit IDs, and of commits, a LastCommitCache keeps in memory
+const lastCommitLocalSize = 1000
+
 func getCacheKey(repoPath, commitID, entryPath string) string {
 	hashBytes := sha256.Sum256([]byte(fmt.Sprintf("%s:%s:%s", repoPath, commitID, entryPath)))
-	return fmt.Sprintf("last_commit:%x", hashBytes)
+	return CacheKey(fmt.Sprintf("last_commit:%x", hashBytes))
+}
+
+// lastCommitCacheTTL returns how long last commit IDs are cached, it's read for every ID so that it can be changed
+func lastCommitCacheTTL() time.Duration {
+	return CacheService.LastCommit.TTL
 }
 
-// LastCommitCache represents a cache to store last commit
+// LastCommitCache represents a cache to store last commit.
+// The last commit IDs are kept in memory in front of the configured cache, the commits read for them in memory only.
 type LastCommitCache struct {
-	repoPath    string
-	ttl         func() int64
-	repo        *Repository
-	commitCache map[string]*Commit
-	cache       Cache
+	repoPath string
+	ttl      func() time.Duration
+	repo     *Repository
+	commits  *memory.Cache
+	cache    Cache
 }
 
 // NewLastCommitCache creates a new last commit cache for repo
-func NewLastCommitCache(count int64, repoPath string, gitRepo *Repository, cache Cache) *LastCommitCache {
-	if cache == nil {
+func NewLastCommitCache(count int64, repoPath string, gitRepo *Repository, remote Cache) *LastCommitCache {
+	if remote == nil {
 		return nil
 	}
 	if !CacheService.LastCommit.Enabled || count < CacheService.LastCommit.CommitsCount {
@@ -37,8 +53,9 @@ func NewLastCommitCache(count int64, repoPath string, gitRepo *Repository, cache
 	return &LastCommitCache{
 		repoPath: repoPath,
 		repo:     gitRepo,
-		ttl:      LastCommitCacheTTLSeconds,
-		cache:    cache,
+		ttl:      lastCommitCacheTTL,
+		commits:  memory.New(lastCommitLocalSize),
+		cache:    cache.NewTiered(memory.New(lastCommitLocalSize), remote, cache.TieredOptions{}),
 	}
 }
 
@@ -48,7 +65,10 @@ func (c *LastCommitCache) Put(ref, entryPath, commitID string) error {
 		return nil
 	}
 	log.Info("LastCommitCache save: [%s:%s:%s]", ref, entryPath, commitID)
-	return c.cache.Put(getCacheKey(c.repoPath, ref, entryPath), commitID, c.ttl())
+	start := time.Now()
+	err := c.cache.Put(getCacheKey(c.repoPath, ref, entryPath), commitID, c.ttl())
+	notifyCache(CacheLastCommit, CachePut, start, false, err)
+	return err
 }
 
 // Get gets the last commit information by commit id and entry path
@@ -57,50 +77,131 @@ func (c *LastCommitCache) Get(ref, entryPath string) (*Commit, error) {
 		return nil, nil
 	}
 
+	start := time.Now()
 	commitID, ok := c.cache.Get(getCacheKey(c.repoPath, ref, entryPath)).(string)
+	notifyCache(CacheLastCommit, CacheGet, start, ok && commitID != "", nil)
 	if !ok || commitID == "" {
 		return nil, nil
 	}
 
 	log.Info("LastCommitCache hit level 1: [%s:%s:%s]", ref, entryPath, commitID)
-	if c.commitCache != nil {
-		if commit, ok := c.commitCache[commitID]; ok {
+	if c.commits != nil {
+		if commit, ok := c.commits.Get(commitID).(*Commit); ok {
 			log.Info("LastCommitCache hit level 2: [%s:%s:%s]", ref, entryPath, commitID)
 			return commit, nil
 		}
 	}
+	return c.getCommit(c.repo, commitID)
+}
 
-	commit, err := c.repo.GetCommit(commitID)
+// getCommit reads the commit commitID of repo and keeps it for the following lookups, c may be nil
+func (c *LastCommitCache) getCommit(repo *Repository, commitID string) (*Commit, error) {
+	if c != nil && c.commits != nil {
+		if commit, ok := c.commits.Get(commitID).(*Commit); ok {
+			return commit, nil
+		}
+	}
+	commit, err := repo.GetCommit(commitID)
 	if err != nil {
 		return nil, err
 	}
-	if c.commitCache == nil {
-		c.commitCache = make(map[string]*Commit)
+	if c != nil && c.commits != nil {
+		_ = c.commits.Put(commitID, commit, 0)
 	}
-	c.commitCache[commitID] = commit
 	return commit, nil
 }
 
 // GetCommitByPath gets the last commit for the entry in the provided commit
 func (c *LastCommitCache) GetCommitByPath(commitID, entryPath string) (*Commit, error) {
-	sha1, err := NewIDFromString(commitID)
+	id, err := NewObjectIDFromString(commitID)
 	if err != nil {
 		return nil, err
 	}
 
-	lastCommit, err := c.Get(sha1.String(), entryPath)
+	lastCommit, err := c.Get(id.String(), entryPath)
 	if err != nil || lastCommit != nil {
 		return lastCommit, err
 	}
 
-	lastCommit, err = c.repo.getCommitByPathWithID(sha1, entryPath)
+	lastCommit, err = c.repo.getCommitByPathWithID(id, entryPath)
 	if err != nil {
 		return nil, err
 	}
 
+	if c.commits != nil {
+		_ = c.commits.Put(lastCommit.ID.String(), lastCommit, 0)
+	}
 	if err := c.Put(commitID, entryPath, lastCommit.ID.String()); err != nil {
 		log.Error("Unable to cache %s as the last commit for %q in %s %s. Error %v", lastCommit.ID.String(), entryPath, commitID, c.repoPath, err)
 	}
 
 	return lastCommit, nil
 }
+
+// GetLastCommitsForPaths gets the last commits of the entries of the directory treePath in ref, keyed by entry name.
+// The last commits which are not cached are found by walking the commit-graph of the repository, or by a single
+// git log --name-status walk if it has none, instead of a walk per entry, and are cached.
+// An entry is missing from the result if the walk exceeded the deadline of the context.
+// NewLastCommitCache returns nil if caching is disabled, ErrLastCommitCacheDisabled is returned for a nil cache then,
+// Repository.GetLastCommitsForPaths walks uncached instead.
+func (c *LastCommitCache) GetLastCommitsForPaths(ref, treePath string, entries []string) (map[string]*Commit, error) {
+	if c == nil {
+		return nil, ErrLastCommitCacheDisabled
+	}
+	return getLastCommitsForPaths(c.repo, c, ref, treePath, entries)
+}
+
+// GetLastCommitsForPaths gets the last commits of the entries of the directory treePath in ref, keyed by entry name,
+// like LastCommitCache.GetLastCommitsForPaths. They are cached in LastCommitCache, if it is enabled.
+func (repo *Repository) GetLastCommitsForPaths(ref, treePath string, entries []string) (map[string]*Commit, error) {
+	return getLastCommitsForPaths(repo, repo.LastCommitCache, ref, treePath, entries)
+}
+
+// getLastCommitsForPaths gets the last commits of the entries of treePath in ref of repo, cache may be nil
+func getLastCommitsForPaths(repo *Repository, cache *LastCommitCache, ref, treePath string, entries []string) (map[string]*Commit, error) {
+	commit, err := repo.GetCommit(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	results, unHitPaths, err := getLastCommitForPathsByCache(commit.ID.String(), treePath, entries, cache)
+	if err != nil || len(unHitPaths) == 0 {
+		return results, err
+	}
+
+	// the commit graph is read by gogit, git log is used for the objects gogit can't read
+	if hash, err := gogitHash(commit.ID); err == nil && repo.backendFor(OperationHistory, BackendGoGit, BackendCLI) != BackendCLI {
+		commitNodeIndex, commitGraphFile := repo.CommitNodeIndex()
+		if commitGraphFile != nil {
+			defer commitGraphFile.Close()
+
+			node, err := commitNodeIndex.Get(hash)
+			if err != nil {
+				return nil, err
+			}
+			revs, err := GetLastCommitForPaths(repo.Ctx, cache, node, treePath, unHitPaths)
+			if err != nil {
+				return nil, err
+			}
+			for entry, rev := range revs {
+				rev.repo = repo
+				results[entry] = rev
+			}
+			return results, nil
+		}
+	}
+
+	commitIDs, err := walkGitLog(repo.Ctx, repo, cache, commit, treePath, unHitPaths...)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range unHitPaths {
+		if commitIDs[entry] == "" {
+			continue
+		}
+		if results[entry], err = cache.getCommit(repo, commitIDs[entry]); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
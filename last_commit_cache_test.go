@@ -0,0 +1,144 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"path"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/enverbisevac/gitlib/cache/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLastCommitCache_GetLastCommitsForPaths(t *testing.T) {
+	oldLastCommit := CacheService.LastCommit
+	CacheService.LastCommit.Enabled, CacheService.LastCommit.CommitsCount = true, 0
+	defer func() {
+		CacheService.LastCommit = oldLastCommit
+	}()
+
+	t.Run("log", func(t *testing.T) {
+		// the walk restarts from the last commit found, a few times at most, but doesn't run git log per entry
+		testGetLastCommitsForPaths(t, filepath.Join(testReposDir, "repo1_bare"), func(logs, logsPerEntry int64) {
+			assert.Positive(t, logs)
+			assert.Zero(t, logsPerEntry)
+		})
+	})
+
+	t.Run("commit-graph", func(t *testing.T) {
+		repoPath := t.TempDir()
+		assert.NoError(t, Clone(DefaultContext, filepath.Join(testReposDir, "repo1_bare"), repoPath, CloneRepoOptions{Bare: true}))
+		// the objects of the clone are loose, which the commit-graph is only written for with --reachable
+		_, _, err := NewCommand(DefaultContext, "commit-graph", "write", "--reachable").RunStdString(&RunOpts{Dir: repoPath})
+		assert.NoError(t, err)
+		testGetLastCommitsForPaths(t, repoPath, func(logs, logsPerEntry int64) {
+			assert.Zero(t, logs)
+		})
+	})
+}
+
+func testGetLastCommitsForPaths(t *testing.T, repoPath string, checkLogs func(logs, logsPerEntry int64)) {
+	repo, err := openRepositoryWithDefaultContext(repoPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	// the commands run concurrently, also those of other tests, which are not counted
+	var logs, logsPerEntry atomic.Int64
+	defer OnCommand(func(event CommandEvent) {
+		if event.Dir != repo.Path || len(event.Args) < 2 || event.Args[0] != "log" {
+			return
+		}
+		logs.Add(1)
+		if event.Args[1] == "-1" {
+			logsPerEntry.Add(1)
+		}
+	})()
+
+	lcc := NewLastCommitCache(0, repo.Path, repo, memory.New(0))
+	for _, tc := range []struct {
+		treePath string
+		entries  []string
+	}{
+		{"", []string{"file1.txt", "file2.txt", "foo"}},
+		{"foo", []string{"bar", "broken_link", "nar"}},
+	} {
+		logs.Store(0)
+		logsPerEntry.Store(0)
+		commits, err := lcc.GetLastCommitsForPaths("master", tc.treePath, tc.entries)
+		assert.NoError(t, err)
+		checkLogs(logs.Load(), logsPerEntry.Load())
+		assert.Len(t, commits, len(tc.entries))
+		for _, entry := range tc.entries {
+			expected, err := repo.getCommitByPathWithID(MustIDFromString("feaf4ba6bc635fec442f46ddd4512416ec43c2c2"), path.Join(tc.treePath, entry))
+			assert.NoError(t, err)
+			if assert.NotNil(t, commits[entry], entry) {
+				assert.Equal(t, expected.ID, commits[entry].ID, entry)
+			}
+		}
+
+		// cached
+		logs.Store(0)
+		cached, err := lcc.GetLastCommitsForPaths("master", tc.treePath, tc.entries)
+		assert.NoError(t, err)
+		assert.Zero(t, logs.Load())
+		assert.Len(t, cached, len(tc.entries))
+		for entry, commit := range commits {
+			assert.Equal(t, commit.ID, cached[entry].ID, entry)
+		}
+	}
+}
+
+func TestLastCommitCache_Concurrent(t *testing.T) {
+	oldLastCommit := CacheService.LastCommit
+	CacheService.LastCommit.Enabled, CacheService.LastCommit.CommitsCount = true, 0
+	defer func() {
+		CacheService.LastCommit = oldLastCommit
+	}()
+
+	repo, err := openRepositoryWithDefaultContext(filepath.Join(testReposDir, "repo1_bare"))
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	remote := memory.New(0)
+	lcc := NewLastCommitCache(0, repo.Path, repo, remote)
+	expected, err := lcc.GetCommitByPath("feaf4ba6bc635fec442f46ddd4512416ec43c2c2", "file1.txt")
+	assert.NoError(t, err)
+	assert.True(t, remote.IsExist(getCacheKey(repo.Path, "feaf4ba6bc635fec442f46ddd4512416ec43c2c2", "file1.txt")))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			commit, err := lcc.Get("feaf4ba6bc635fec442f46ddd4512416ec43c2c2", "file1.txt")
+			assert.NoError(t, err)
+			// the commit read for the cached ID is shared
+			assert.Same(t, expected, commit)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestLastCommitCache_GetLastCommitsForPathsDisabled(t *testing.T) {
+	repo, err := openRepositoryWithDefaultContext(filepath.Join(testReposDir, "repo1_bare"))
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	var lcc *LastCommitCache
+	_, err = lcc.GetLastCommitsForPaths("master", "", []string{"file1.txt"})
+	assert.ErrorIs(t, err, ErrLastCommitCacheDisabled)
+
+	// without a cache the commits are found by an uncached walk
+	assert.Nil(t, repo.LastCommitCache)
+	commits, err := repo.GetLastCommitsForPaths("master", "", []string{"file1.txt", "file2.txt", "foo"})
+	assert.NoError(t, err)
+	assert.Len(t, commits, 3)
+	if assert.NotNil(t, commits["file1.txt"]) {
+		assert.Equal(t, "95bb4d39648ee7e325106df01a621c530863a653", commits["file1.txt"].ID.String())
+	}
+}
@@ -26,6 +26,8 @@ type LFSResult struct {
 	ParentHashes   []SHA1
 	BranchName     string
 	FullCommitName string
+	// parents are the ids of the parents, ParentHashes stays empty in sha256 repositories
+	parents []string
 }
 
 type lfsResultSlice []*LFSResult
@@ -35,53 +37,24 @@ func (a lfsResultSlice) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a lfsResultSlice) Less(i, j int) bool { return a[j].When.After(a[i].When) }
 
 // FindLFSFile finds commits that contain a provided pointer file hash
-func FindLFSFile(repo *Repository, hash SHA1) ([]*LFSResult, error) {
+func FindLFSFile(repo *Repository, hash ObjectID) ([]*LFSResult, error) {
 	resultsMap := map[string]*LFSResult{}
 	results := make([]*LFSResult, 0)
 
 	basePath := repo.Path
 
-	commitsIter, err := repo.gogit.Log(&gogit.LogOptions{
-		Order: gogit.LogOrderCommitterTime,
-		All:   true,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to get GoGit CommitsIter. Error: %w", err)
-	}
-
-	err = commitsIter.ForEach(func(gitCommit *object.Commit) error {
-		tree, err := gitCommit.Tree()
-		if err != nil {
-			return err
-		}
-		treeWalker := object.NewTreeWalker(tree, true, nil)
-		defer treeWalker.Close()
-		for {
-			name, entry, err := treeWalker.Next()
-			if err == io.EOF {
-				break
-			}
-			if entry.Hash == hash {
-				result := LFSResult{
-					Name:         name,
-					SHA:          gitCommit.Hash.String(),
-					Summary:      strings.Split(strings.TrimSpace(gitCommit.Message), "\n")[0],
-					When:         gitCommit.Author.When,
-					ParentHashes: gitCommit.ParentHashes,
-				}
-				resultsMap[gitCommit.Hash.String()+":"+name] = &result
-			}
+	if repo.backendFor(OperationObjects, BackendGoGit, BackendCLI) == BackendCLI {
+		if err := findLFSFileWithGit(repo, hash, resultsMap); err != nil {
+			return nil, err
 		}
-		return nil
-	})
-	if err != nil && err != io.EOF {
-		return nil, fmt.Errorf("failure in CommitIter.ForEach: %w", err)
+	} else if err := findLFSFileWithGoGit(repo, hash, resultsMap); err != nil {
+		return nil, err
 	}
 
 	for _, result := range resultsMap {
 		hasParent := false
-		for _, parentHash := range result.ParentHashes {
-			if _, hasParent = resultsMap[parentHash.String()+":"+result.Name]; hasParent {
+		for _, parent := range result.parents {
+			if _, hasParent = resultsMap[parent+":"+result.Name]; hasParent {
 				break
 			}
 		}
@@ -129,6 +102,7 @@ func FindLFSFile(repo *Repository, hash SHA1) ([]*LFSResult, error) {
 				i += n
 			}
 			n := 0
+			var err error
 			for n < 1 {
 				n, err = shasToNameWriter.Write([]byte{'\n'})
 				if err != nil {
@@ -153,3 +127,96 @@ func FindLFSFile(repo *Repository, hash SHA1) ([]*LFSResult, error) {
 
 	return results, nil
 }
+
+// findLFSFileWithGoGit adds the paths of the blob hash in all commits to resultsMap walking the trees with gogit
+func findLFSFileWithGoGit(repo *Repository, hash ObjectID, resultsMap map[string]*LFSResult) error {
+	commitsIter, err := repo.gogit.Log(&gogit.LogOptions{
+		Order: gogit.LogOrderCommitterTime,
+		All:   true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get GoGit CommitsIter. Error: %w", err)
+	}
+
+	err = commitsIter.ForEach(func(gitCommit *object.Commit) error {
+		tree, err := gitCommit.Tree()
+		if err != nil {
+			return err
+		}
+		treeWalker := object.NewTreeWalker(tree, true, nil)
+		defer treeWalker.Close()
+		for {
+			name, entry, err := treeWalker.Next()
+			if err == io.EOF {
+				break
+			}
+			if entry.Hash == hash {
+				parents := make([]string, 0, len(gitCommit.ParentHashes))
+				for _, parent := range gitCommit.ParentHashes {
+					parents = append(parents, parent.String())
+				}
+				result := LFSResult{
+					Name:         name,
+					SHA:          gitCommit.Hash.String(),
+					Summary:      strings.Split(strings.TrimSpace(gitCommit.Message), "\n")[0],
+					When:         gitCommit.Author.When,
+					ParentHashes: gitCommit.ParentHashes,
+					parents:      parents,
+				}
+				resultsMap[gitCommit.Hash.String()+":"+name] = &result
+			}
+		}
+		return nil
+	})
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("failure in CommitIter.ForEach: %w", err)
+	}
+	return nil
+}
+
+// findLFSFileWithGit adds the paths of the blob hash in all commits to resultsMap listing the trees with git ls-tree
+func findLFSFileWithGit(repo *Repository, hash ObjectID, resultsMap map[string]*LFSResult) error {
+	stdout, stderr, err := NewCommand(repo.Ctx, "log", "--all", "-z", "--format=%H%n%P%n%aI%n%B").RunStdString(&RunOpts{Dir: repo.Path})
+	if err != nil {
+		return fmt.Errorf("unable to list the commits: %w", ConcatenateError(err, stderr))
+	}
+	for _, record := range strings.Split(stdout, "\x00") {
+		fields := strings.SplitN(record, "\n", 4)
+		if len(fields) != 4 {
+			continue
+		}
+		commitID, message := fields[0], fields[3]
+		when, err := time.Parse(time.RFC3339, fields[2])
+		if err != nil {
+			return err
+		}
+		parents := strings.Fields(fields[1])
+		var parentHashes []SHA1
+		if repo.ObjectFormat() == Sha1ObjectFormat {
+			for _, parent := range parents {
+				parentHashes = append(parentHashes, MustIDFromString(parent))
+			}
+		}
+
+		entries, stderr, err := NewCommand(repo.Ctx, "ls-tree", "-r", "-z", "--full-tree").AddDynamicArguments(commitID).RunStdString(&RunOpts{Dir: repo.Path})
+		if err != nil {
+			return fmt.Errorf("unable to list the tree of %s: %w", commitID, ConcatenateError(err, stderr))
+		}
+		for _, entry := range strings.Split(entries, "\x00") {
+			// <mode> SP <type> SP <object> TAB <file>
+			info, name, ok := strings.Cut(entry, "\t")
+			if !ok || !strings.HasSuffix(info, " "+hash.String()) {
+				continue
+			}
+			resultsMap[commitID+":"+name] = &LFSResult{
+				Name:         name,
+				SHA:          commitID,
+				Summary:      strings.Split(strings.TrimSpace(message), "\n")[0],
+				When:         when,
+				ParentHashes: parentHashes,
+				parents:      parents,
+			}
+		}
+	}
+	return nil
+}
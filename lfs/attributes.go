@@ -0,0 +1,101 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package lfs
+
+import (
+	"bufio"
+	"bytes"
+	"path"
+	"strings"
+
+	git "github.com/enverbisevac/gitlib"
+	"github.com/gobwas/glob"
+)
+
+type attributeRule struct {
+	pattern glob.Glob
+	// basename is set for patterns without a slash, they match the name at any depth
+	basename bool
+	tracked  bool
+}
+
+// Attributes holds the rules of a .gitattributes file which set or unset the lfs filter
+type Attributes struct {
+	rules []attributeRule
+}
+
+// ParseAttributes parses the content of a .gitattributes file.
+// Only lines changing the "filter" attribute are kept, invalid patterns are ignored like git does.
+func ParseAttributes(content []byte) *Attributes {
+	attrs := &Attributes{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		pattern := fields[0]
+		var tracked, found bool
+		for _, attr := range fields[1:] {
+			switch {
+			case attr == "filter=lfs":
+				tracked, found = true, true
+			case attr == "-filter" || attr == "!filter" || strings.HasPrefix(attr, "filter="):
+				tracked, found = false, true
+			}
+		}
+		if !found {
+			continue
+		}
+
+		if strings.HasSuffix(pattern, "/") {
+			// patterns matching directories do not apply to the files in them
+			continue
+		}
+		rule := attributeRule{tracked: tracked}
+		if !strings.Contains(pattern, "/") {
+			rule.basename = true
+		} else {
+			pattern = strings.TrimPrefix(pattern, "/")
+		}
+		g, err := glob.Compile(pattern, '/')
+		if err != nil {
+			continue
+		}
+		rule.pattern = g
+		attrs.rules = append(attrs.rules, rule)
+	}
+	return attrs
+}
+
+// IsTracked returns true if the path, relative to the repository root, is stored in LFS.
+// Later rules take precedence over earlier ones.
+func (a *Attributes) IsTracked(name string) bool {
+	for i := len(a.rules) - 1; i >= 0; i-- {
+		rule := a.rules[i]
+		target := name
+		if rule.basename {
+			target = path.Base(name)
+		}
+		if rule.pattern.Match(target) {
+			return rule.tracked
+		}
+	}
+	return false
+}
+
+// ReadAttributes reads the .gitattributes file at the root of the commit.
+// Empty attributes are returned if the commit has no such file.
+func ReadAttributes(commit *git.Commit) (*Attributes, error) {
+	content, err := commit.GetFileContent(".gitattributes", 0)
+	if err != nil {
+		if git.IsErrNotExist(err) {
+			return &Attributes{}, nil
+		}
+		return nil, err
+	}
+	return ParseAttributes([]byte(content)), nil
+}
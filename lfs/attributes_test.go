@@ -0,0 +1,37 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package lfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAttributes_IsTracked(t *testing.T) {
+	attrs := ParseAttributes([]byte(`# comment
+*.bin filter=lfs diff=lfs merge=lfs -text
+/assets/*.png filter=lfs
+assets/small.png -filter
+docs/ filter=lfs
+*.txt text
+`))
+
+	cases := map[string]bool{
+		"file.bin":           true,
+		"deep/dir/file.bin":  true,
+		"assets/logo.png":    true,
+		"assets/small.png":   false,
+		"other/assets/a.png": false,
+		"assets/sub/a.png":   false,
+		"docs/readme.md":     false,
+		"readme.txt":         false,
+	}
+	for name, tracked := range cases {
+		assert.Equal(t, tracked, attrs.IsTracked(name), name)
+	}
+
+	assert.False(t, ParseAttributes(nil).IsTracked("file.bin"))
+}
@@ -0,0 +1,185 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package lfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	git "github.com/enverbisevac/gitlib"
+)
+
+// MediaType contains the media type for LFS server requests
+const MediaType = "application/vnd.git-lfs+json"
+
+// BatchRequest contains multiple requests processed in one batch operation.
+// https://github.com/git-lfs/git-lfs/blob/main/docs/api/batch.md#requests
+type BatchRequest struct {
+	Operation string     `json:"operation"`
+	Transfers []string   `json:"transfers,omitempty"`
+	Ref       *Reference `json:"ref,omitempty"`
+	Objects   []Pointer  `json:"objects"`
+}
+
+// Reference contains a git reference.
+// https://github.com/git-lfs/git-lfs/blob/main/docs/api/batch.md#ref-property
+type Reference struct {
+	Name string `json:"name"`
+}
+
+// BatchResponse contains multiple object metadata Representation structures
+// for use with the batch API.
+// https://github.com/git-lfs/git-lfs/blob/main/docs/api/batch.md#successful-responses
+type BatchResponse struct {
+	Transfer string            `json:"transfer,omitempty"`
+	Objects  []*ObjectResponse `json:"objects"`
+}
+
+// ObjectResponse is object metadata as seen by clients of the LFS server.
+type ObjectResponse struct {
+	Pointer
+	Actions map[string]*Link `json:"actions,omitempty"`
+	Error   *ObjectError     `json:"error,omitempty"`
+}
+
+// Link provides a structure with information about how to access a object.
+type Link struct {
+	Href      string            `json:"href"`
+	Header    map[string]string `json:"header,omitempty"`
+	ExpiresAt *time.Time        `json:"expires_at,omitempty"`
+}
+
+// ObjectError defines the JSON structure returned to the client in case of an error.
+type ObjectError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// ErrorResponse describes the error to the client.
+type ErrorResponse struct {
+	Message          string `json:"message"`
+	DocumentationURL string `json:"documentation_url,omitempty"`
+	RequestID        string `json:"request_id,omitempty"`
+}
+
+// Client talks to an LFS server using the batch API
+type Client struct {
+	endpoint string
+	client   *http.Client
+}
+
+// NewClient creates a client for the LFS server at endpoint, e.g. "https://example.com/owner/repo.git/info/lfs".
+// If httpClient is nil a client using the configured proxy is used.
+func NewClient(endpoint string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{
+			Transport: &http.Transport{
+				Proxy: git.GetProxy(),
+			},
+		}
+	}
+	return &Client{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		client:   httpClient,
+	}
+}
+
+// Batch requests the actions for the objects, operation is either "download" or "upload".
+// ref is optional and sent to the server to check permissions.
+func (c *Client) Batch(ctx context.Context, operation string, objects []Pointer, ref string) (*BatchResponse, error) {
+	request := &BatchRequest{
+		Operation: operation,
+		Transfers: []string{"basic"},
+		Objects:   objects,
+	}
+	if ref != "" {
+		request.Ref = &Reference{Name: ref}
+	}
+
+	payload := new(bytes.Buffer)
+	if err := json.NewEncoder(payload).Encode(request); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint+"/objects/batch", payload)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", MediaType)
+	req.Header.Set("Accept", MediaType)
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("lfs batch request failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, handleErrorResponse(res)
+	}
+
+	response := &BatchResponse{}
+	if err := json.NewDecoder(res.Body).Decode(response); err != nil {
+		return nil, fmt.Errorf("unable to decode lfs batch response: %w", err)
+	}
+	if response.Transfer == "" {
+		response.Transfer = "basic"
+	}
+	return response, nil
+}
+
+// Download returns the content behind the "download" action of a batch response
+func (c *Client) Download(ctx context.Context, link *Link) (io.ReadCloser, error) {
+	res, err := c.performAction(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// Upload sends the content to the "upload" action of a batch response
+func (c *Client) Upload(ctx context.Context, link *Link, content io.Reader) error {
+	res, err := c.performAction(ctx, http.MethodPut, link, content)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+func (c *Client) performAction(ctx context.Context, method string, link *Link, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, link.Href, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range link.Header {
+		req.Header.Set(key, value)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("lfs %s request failed: %w", method, err)
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		return nil, handleErrorResponse(res)
+	}
+	return res, nil
+}
+
+func handleErrorResponse(res *http.Response) error {
+	var er ErrorResponse
+	if err := json.NewDecoder(res.Body).Decode(&er); err != nil || er.Message == "" {
+		return fmt.Errorf("unexpected lfs server response: %s", res.Status)
+	}
+	return fmt.Errorf("lfs server error %d: %s", res.StatusCode, er.Message)
+}
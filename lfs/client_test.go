@@ -0,0 +1,69 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package lfs
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_Batch(t *testing.T) {
+	p, _ := GeneratePointer(strings.NewReader("Gitea"))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repo.git/info/lfs/objects/batch":
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.Equal(t, MediaType, r.Header.Get("Content-Type"))
+			var req BatchRequest
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			if req.Operation != "download" {
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte(`{"message":"write access denied"}`))
+				return
+			}
+			assert.Equal(t, "refs/heads/main", req.Ref.Name)
+			w.Header().Set("Content-Type", MediaType)
+			_ = json.NewEncoder(w).Encode(&BatchResponse{Objects: []*ObjectResponse{{
+				Pointer: req.Objects[0],
+				Actions: map[string]*Link{"download": {Href: "http://" + r.Host + "/objects/" + req.Objects[0].Oid, Header: map[string]string{"X-Token": "secret"}}},
+			}}})
+		case "/objects/" + p.Oid:
+			assert.Equal(t, "secret", r.Header.Get("X-Token"))
+			_, _ = w.Write([]byte("Gitea"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL+"/repo.git/info/lfs/", server.Client())
+
+	res, err := client.Batch(context.Background(), "download", []Pointer{p}, "refs/heads/main")
+	assert.NoError(t, err)
+	assert.Equal(t, "basic", res.Transfer)
+	assert.Len(t, res.Objects, 1)
+	assert.Equal(t, p, res.Objects[0].Pointer)
+
+	rc, err := client.Download(context.Background(), res.Objects[0].Actions["download"])
+	assert.NoError(t, err)
+	content, err := io.ReadAll(rc)
+	assert.NoError(t, err)
+	assert.NoError(t, rc.Close())
+	assert.Equal(t, "Gitea", string(content))
+
+	_, err = client.Batch(context.Background(), "upload", []Pointer{p}, "")
+	assert.ErrorContains(t, err, "write access denied")
+
+	_, err = client.Download(context.Background(), &Link{Href: server.URL + "/missing"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,92 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package lfs
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	git "github.com/enverbisevac/gitlib"
+)
+
+// PointerBlob associates a Git blob with a Pointer
+type PointerBlob struct {
+	Hash string
+	Path string
+	Pointer
+}
+
+// SearchPointerBlobs returns the LFS pointers in blobs which are reachable from newCommitID but not from oldCommitID.
+// An empty or zero oldCommitID searches all blobs reachable from newCommitID, e.g. for a newly pushed branch.
+func SearchPointerBlobs(ctx context.Context, repo *git.Repository, oldCommitID, newCommitID string) ([]PointerBlob, error) {
+	cmd := git.NewCommand(ctx, "rev-list", "--objects").AddDynamicArguments(newCommitID)
+	if oldCommitID != "" && oldCommitID != repo.ObjectFormat().EmptyObjectID().String() {
+		cmd.AddDynamicArguments("^" + oldCommitID)
+	}
+
+	checkWriter, checkReader, checkCancel, err := repo.CatFileBatchCheck(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer checkCancel()
+	batchWriter, batchReader, batchCancel, err := repo.CatFileBatch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer batchCancel()
+
+	// the objects are read while they are listed
+	stdoutReader, err := cmd.RunWithStdoutReader(&git.RunOpts{Dir: repo.Path})
+	if err != nil {
+		return nil, err
+	}
+	defer stdoutReader.Close()
+
+	var pointers []PointerBlob
+	scanner := bufio.NewScanner(stdoutReader)
+	for scanner.Scan() {
+		// <sha> [<path>], commits and trees without path are filtered by cat-file
+		sha, name, _ := strings.Cut(scanner.Text(), " ")
+		if sha == "" {
+			continue
+		}
+
+		if _, err := checkWriter.Write([]byte(sha + "\n")); err != nil {
+			return nil, err
+		}
+		_, typ, size, err := git.ReadBatchLine(checkReader)
+		if err != nil {
+			return nil, err
+		}
+		if typ != "blob" || size >= blobSizeCutoff {
+			continue
+		}
+
+		if _, err := batchWriter.Write([]byte(sha + "\n")); err != nil {
+			return nil, err
+		}
+		_, _, size, err = git.ReadBatchLine(batchReader)
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+1)
+		if _, err := io.ReadFull(batchReader, buf); err != nil {
+			return nil, err
+		}
+
+		pointer, err := ReadPointerFromBuffer(buf[:size])
+		if err != nil {
+			continue
+		}
+		pointers = append(pointers, PointerBlob{Hash: sha, Path: name, Pointer: pointer})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to list objects between %s and %s: %w", oldCommitID, newCommitID, err)
+	}
+	return pointers, nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package lfs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	git "github.com/enverbisevac/gitlib"
+	"github.com/enverbisevac/gitlib/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func testRun(m *testing.M) error {
+	gitHomePath, err := os.MkdirTemp(os.TempDir(), "git-home")
+	if err != nil {
+		return fmt.Errorf("unable to create temp dir: %w", err)
+	}
+	defer func() {
+		_ = util.RemoveAll(gitHomePath)
+	}()
+	git.Git.HomePath = gitHomePath
+
+	if err = git.InitFull(context.Background()); err != nil {
+		return fmt.Errorf("failed to call Init: %w", err)
+	}
+
+	exitCode := m.Run()
+	if exitCode != 0 {
+		return fmt.Errorf("run test failed, ExitCode=%d", exitCode)
+	}
+	return nil
+}
+
+func TestMain(m *testing.M) {
+	if err := testRun(m); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Test failed: %v", err)
+		os.Exit(1)
+	}
+}
+
+func TestSearchPointerBlobs(t *testing.T) {
+	ctx := git.DefaultContext
+	dir := t.TempDir()
+	run := func(cmd *git.Command) string {
+		stdout, _, err := cmd.RunStdString(&git.RunOpts{Dir: dir})
+		assert.NoError(t, err)
+		return strings.TrimSpace(stdout)
+	}
+	commit := func(name, content string) string {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+		run(git.NewCommand(ctx, "add", "--all"))
+		run(git.NewCommand(ctx, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-m", "commit"))
+		return run(git.NewCommand(ctx, "rev-parse", "HEAD"))
+	}
+	run(git.NewCommand(ctx, "init"))
+
+	first, _ := GeneratePointer(strings.NewReader("first"))
+	second, _ := GeneratePointer(strings.NewReader("second"))
+	c1 := commit("a.bin", first.StringContent())
+	commit("readme.md", "not a pointer")
+	c3 := commit("dir/b.bin", second.StringContent())
+
+	repo, err := git.OpenRepository(ctx, dir)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	blobs, err := SearchPointerBlobs(ctx, repo, "", c3)
+	assert.NoError(t, err)
+	assert.Len(t, blobs, 2)
+
+	blobs, err = SearchPointerBlobs(ctx, repo, c1, c3)
+	assert.NoError(t, err)
+	if assert.Len(t, blobs, 1) {
+		assert.Equal(t, "dir/b.bin", blobs[0].Path)
+		assert.Equal(t, second, blobs[0].Pointer)
+		assert.Len(t, blobs[0].Hash, 40)
+	}
+
+	_, err = SearchPointerBlobs(ctx, repo, "", "0123456789012345678901234567890123456789")
+	assert.Error(t, err)
+}
@@ -0,0 +1,44 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package lfs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadPointer(t *testing.T) {
+	p, err := GeneratePointer(strings.NewReader("Gitea"))
+	assert.NoError(t, err)
+	assert.Equal(t, "94cb57646c54a297c9807697e80a30946f79a4b82cb079d2606847825b1812cc", p.Oid)
+	assert.EqualValues(t, 5, p.Size)
+	assert.True(t, p.IsValid())
+	assert.Equal(t, "94/cb/57646c54a297c9807697e80a30946f79a4b82cb079d2606847825b1812cc", p.RelativePath())
+
+	read, err := ReadPointer(strings.NewReader(p.StringContent()))
+	assert.NoError(t, err)
+	assert.Equal(t, p, read)
+
+	cases := []struct {
+		content string
+		err     error
+	}{
+		{"", ErrMissingPrefix},
+		{"version https://git-lfs.github.com/spec/v1", ErrInvalidStructure},
+		{"version https://git-lfs.github.com/spec/v1\noid sha256:abc\nsize 5\n", ErrInvalidOIDFormat},
+		{"version https://git-lfs.github.com/spec/v1\noid sha256:94CB57646C54A297C9807697E80A30946F79A4B82CB079D2606847825B1812CC\nsize 5\n", ErrInvalidOIDFormat},
+		{"version https://git-lfs.github.com/spec/v1\noid sha256:94cb57646c54a297c9807697e80a30946f79a4b82cb079d2606847825b1812cc\nsize -1\n", ErrInvalidStructure},
+	}
+	for _, c := range cases {
+		_, err := ReadPointerFromBuffer([]byte(c.content))
+		assert.ErrorIs(t, err, c.err, c.content)
+	}
+	_, err = ReadPointerFromBuffer([]byte("version https://git-lfs.github.com/spec/v1\noid sha256:94cb57646c54a297c9807697e80a30946f79a4b82cb079d2606847825b1812cc\nsize x\n"))
+	assert.Error(t, err)
+
+	assert.False(t, Pointer{Oid: "abc", Size: 1}.IsValid())
+}
@@ -140,8 +140,8 @@ func (g *LogNameStatusRepoParser) Next(treepath string, paths2ids map[string]int
 	}
 
 	// Our "line" must look like: <commitid> SP (<parent> SP) * NUL
-	ret.CommitID = string(g.next[0:40])
-	parents := string(g.next[41:])
+	commitID, parents, _ := strings.Cut(string(g.next), " ")
+	ret.CommitID = commitID
 	if g.buffull {
 		more, err := g.rd.ReadString('\x00')
 		if err != nil {
@@ -287,6 +287,11 @@ func (g *LogNameStatusRepoParser) Close() {
 
 // WalkGitLog walks the git log --name-status for the head commit in the provided treepath and files
 func WalkGitLog(ctx context.Context, repo *Repository, head *Commit, treepath string, paths ...string) (map[string]string, error) {
+	return walkGitLog(ctx, repo, repo.LastCommitCache, head, treepath, paths...)
+}
+
+// walkGitLog walks the git log like WalkGitLog and puts the last commits found into cache
+func walkGitLog(ctx context.Context, repo *Repository, cache *LastCommitCache, head *Commit, treepath string, paths ...string) (map[string]string, error) {
 	headRef := head.ID.String()
 
 	tree, err := head.SubTree(treepath)
@@ -379,14 +384,14 @@ heaploop:
 				changed[i] = false
 				if results[i] == "" {
 					results[i] = current.CommitID
-					if err := repo.LastCommitCache.Put(headRef, path.Join(treepath, paths[i]), current.CommitID); err != nil {
+					if err := cache.Put(headRef, path.Join(treepath, paths[i]), current.CommitID); err != nil {
 						return nil, err
 					}
 					delete(path2idx, paths[i])
 					remaining--
 					if results[0] == "" {
 						results[0] = current.CommitID
-						if err := repo.LastCommitCache.Put(headRef, treepath, current.CommitID); err != nil {
+						if err := cache.Put(headRef, treepath, current.CommitID); err != nil {
 							return nil, err
 						}
 						delete(path2idx, "")
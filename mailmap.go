@@ -0,0 +1,140 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type mailmapIdentity struct {
+	name  string
+	email string
+}
+
+type mailmapEntry struct {
+	mailmapIdentity
+	// byName holds the identities for a commit name and email pair, keyed by the lower case name
+	byName map[string]*mailmapIdentity
+}
+
+// Mailmap maps the names and emails of commits to canonical identities like git log --use-mailmap
+type Mailmap struct {
+	// entries are keyed by the lower case commit email
+	entries map[string]*mailmapEntry
+}
+
+// ParseMailmap parses the content of a .mailmap file, which maps identities with lines like
+//
+//	Proper Name <commit@email>
+//	<proper@email> <commit@email>
+//	Proper Name <proper@email> <commit@email>
+//	Proper Name <proper@email> Commit Name <commit@email>
+func ParseMailmap(r io.Reader) (*Mailmap, error) {
+	m := &Mailmap{entries: make(map[string]*mailmapEntry)}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		properName, properEmail, rest, ok := cutMailmapIdentity(line)
+		if !ok {
+			continue
+		}
+		commitName, commitEmail, _, ok := cutMailmapIdentity(rest)
+		if !ok {
+			// Proper Name <commit@email>
+			commitName, commitEmail, properEmail = "", properEmail, ""
+		}
+		m.add(properName, properEmail, commitName, commitEmail)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read mailmap: %w", err)
+	}
+	return m, nil
+}
+
+// cutMailmapIdentity cuts "Name <email>" from the start of s and returns the remainder after it
+func cutMailmapIdentity(s string) (name, email, rest string, ok bool) {
+	start := strings.IndexByte(s, '<')
+	end := strings.IndexByte(s, '>')
+	if start < 0 || end < start {
+		return "", "", "", false
+	}
+	return strings.TrimSpace(s[:start]), s[start+1 : end], s[end+1:], true
+}
+
+func (m *Mailmap) add(properName, properEmail, commitName, commitEmail string) {
+	entry, ok := m.entries[strings.ToLower(commitEmail)]
+	if !ok {
+		entry = &mailmapEntry{byName: make(map[string]*mailmapIdentity)}
+		m.entries[strings.ToLower(commitEmail)] = entry
+	}
+
+	identity := &entry.mailmapIdentity
+	if commitName != "" {
+		if identity, ok = entry.byName[strings.ToLower(commitName)]; !ok {
+			identity = &mailmapIdentity{}
+			entry.byName[strings.ToLower(commitName)] = identity
+		}
+	}
+	// later lines for the same identity only override the given parts
+	if properName != "" {
+		identity.name = properName
+	}
+	if properEmail != "" {
+		identity.email = properEmail
+	}
+}
+
+// ResolveSignature returns the signature with the canonical name and email of its identity.
+// The signature is returned unchanged if the mailmap has no entry for it.
+func (m *Mailmap) ResolveSignature(sig *Signature) *Signature {
+	if m == nil || sig == nil {
+		return sig
+	}
+	entry, ok := m.entries[strings.ToLower(sig.Email)]
+	if !ok {
+		return sig
+	}
+	identity := &entry.mailmapIdentity
+	if byName, ok := entry.byName[strings.ToLower(sig.Name)]; ok {
+		identity = byName
+	}
+
+	resolved := &Signature{Name: sig.Name, Email: sig.Email, When: sig.When}
+	if identity.name != "" {
+		resolved.Name = identity.name
+	}
+	if identity.email != "" {
+		resolved.Email = identity.email
+	}
+	return resolved
+}
+
+// GetMailmap returns the mailmap of the .mailmap file at the given commit,
+// it is empty if the commit has no .mailmap file.
+func (repo *Repository) GetMailmap(commitID string) (*Mailmap, error) {
+	id, err := repo.resolveCommitID(commitID)
+	if err != nil {
+		return nil, err
+	}
+	// rev-parse exits with 1 if the commit has no .mailmap
+	blobID, stderr, runErr := NewCommand(repo.Ctx, "rev-parse", "--verify", "--quiet", "--end-of-options").AddDynamicArguments(id + ":.mailmap").RunStdString(&RunOpts{Dir: repo.Path})
+	if runErr != nil {
+		if runErr.IsExitCode(1) {
+			return &Mailmap{entries: make(map[string]*mailmapEntry)}, nil
+		}
+		return nil, fmt.Errorf("unable to find .mailmap of %s: %w", commitID, ConcatenateError(runErr, stderr))
+	}
+	stdout, stderr, runErr := NewCommand(repo.Ctx, "cat-file", "blob").AddDynamicArguments(strings.TrimSpace(blobID)).RunStdString(&RunOpts{Dir: repo.Path})
+	if runErr != nil {
+		return nil, fmt.Errorf("unable to read .mailmap of %s: %w", commitID, ConcatenateError(runErr, stderr))
+	}
+	return ParseMailmap(strings.NewReader(stdout))
+}
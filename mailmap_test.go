@@ -0,0 +1,97 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMailmap(t *testing.T) {
+	m, err := ParseMailmap(strings.NewReader(`# comment
+Proper Name <jane@example.com>
+<jane@example.org> <Jane@Example.com>
+Joe Developer <joe@example.com> <joe@old.example.com>
+Other Joe <other@example.com> Joe <joe@old.example.com> # trailing comment
+invalid line
+`))
+	assert.NoError(t, err)
+
+	when := time.Unix(1700000000, 0)
+	for _, c := range []struct {
+		name, email         string
+		wantName, wantEmail string
+	}{
+		{"Jane", "jane@example.com", "Proper Name", "jane@example.org"},
+		{"Joe D", "joe@old.example.com", "Joe Developer", "joe@example.com"},
+		{"joe", "JOE@old.example.com", "Other Joe", "other@example.com"},
+		{"Unknown", "unknown@example.com", "Unknown", "unknown@example.com"},
+	} {
+		sig := m.ResolveSignature(&Signature{Name: c.name, Email: c.email, When: when})
+		assert.Equal(t, c.wantName, sig.Name, c.email)
+		assert.Equal(t, c.wantEmail, sig.Email, c.email)
+		assert.Equal(t, when, sig.When)
+	}
+
+	var empty *Mailmap
+	sig := &Signature{Name: "Jane", Email: "jane@example.com"}
+	assert.Same(t, sig, empty.ResolveSignature(sig))
+}
+
+func TestRepository_GetMailmap(t *testing.T) {
+	clonedPath, err := cloneRepo(t, filepath.Join(testReposDir, "repo1_bare"))
+	assert.NoError(t, err)
+	repo, err := openRepositoryWithDefaultContext(clonedPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	m, err := repo.GetMailmap("HEAD")
+	assert.NoError(t, err)
+	assert.Equal(t, "Tris Forster", m.ResolveSignature(&Signature{Name: "Tris Forster", Email: "tris.git@shoddynet.org"}).Name)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(clonedPath, ".mailmap"), []byte("Tris <tris@example.com> <tris.git@shoddynet.org>\n"), 0o644))
+	assert.NoError(t, AddChanges(clonedPath, true))
+	assert.NoError(t, CommitChanges(clonedPath, CommitChangesOptions{
+		Committer: &Signature{Name: "Committer", Email: "committer@example.com", When: time.Now()},
+		Author:    &Signature{Name: "Author", Email: "author@example.com", When: time.Now()},
+		Message:   "Add mailmap",
+	}))
+
+	m, err = repo.GetMailmap("HEAD")
+	assert.NoError(t, err)
+
+	iter, err := repo.Log(LogRevisions("37991dec2c8e592043f47155ce4808d4580f9123"), LogMaxCount(1), LogMailmap(m))
+	assert.NoError(t, err)
+	defer iter.Close()
+	commit := iter.Next()
+	if assert.NotNil(t, commit) {
+		assert.Equal(t, "Tris", commit.Author.Name)
+		assert.Equal(t, "tris@example.com", commit.Committer.Email)
+	}
+
+	_, err = repo.GetMailmap("unknown")
+	assert.True(t, IsErrNotExist(err))
+}
+
+func TestRepository_BlameMailmap(t *testing.T) {
+	bareRepo1, err := openRepositoryWithDefaultContext(filepath.Join(testReposDir, "repo1_bare"))
+	assert.NoError(t, err)
+	defer bareRepo1.Close()
+
+	m, err := ParseMailmap(strings.NewReader("Tris <tris@example.com> <tris.git@shoddynet.org>\n"))
+	assert.NoError(t, err)
+
+	hunks, err := bareRepo1.Blame(DefaultContext, "37991dec2c8e592043f47155ce4808d4580f9123", "foo/nar/hello", BlameOptions{Mailmap: m})
+	assert.NoError(t, err)
+	if assert.NotEmpty(t, hunks) {
+		assert.Equal(t, "Tris", hunks[0].Commit.Author.Name)
+		assert.Equal(t, "tris@example.com", hunks[0].Commit.Committer.Email)
+	}
+}
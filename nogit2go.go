@@ -0,0 +1,52 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build nogit2go
+
+package git
+
+import "errors"
+
+// hasGit2Go is false when built with the nogit2go tag, the operations then always run the git binary
+const hasGit2Go = false
+
+var errNoGit2Go = errors.New("libgit2 is not available, built with the nogit2go tag")
+
+type libgit2Repository struct{}
+
+func (*libgit2Repository) Free() {}
+
+func openLibgit2Repository(string) (*libgit2Repository, error) {
+	return nil, nil
+}
+
+// the libgit2 implementations are never selected by useGit2Go, they only satisfy the callers
+
+func (repo *Repository) getFullCommitIDWithGit2Go(string) (string, error) {
+	return "", errNoGit2Go
+}
+
+func (repo *Repository) getMergeBaseWithGit2Go(string, string) (string, error) {
+	return "", errNoGit2Go
+}
+
+func (repo *Repository) readTreeToIndexWithGit2Go(ObjectID, string) error {
+	return errNoGit2Go
+}
+
+func (repo *Repository) removeFilesFromIndexWithGit2Go(...string) error {
+	return errNoGit2Go
+}
+
+func (repo *Repository) addObjectToIndexWithGit2Go(ObjectID, string) error {
+	return errNoGit2Go
+}
+
+func (repo *Repository) writeTreeWithGit2Go() (*Tree, error) {
+	return nil, errNoGit2Go
+}
+
+func (repo *Repository) commitTreeWithGit2Go(string, *Signature, *Signature, *Tree, []string, CommitTreeOpts) (ObjectID, error) {
+	return nil, errNoGit2Go
+}
@@ -9,13 +9,15 @@ import (
 	"io"
 
 	"github.com/enverbisevac/gitlib/log"
-	"github.com/go-git/go-git/v5/plumbing/object"
 )
 
 // NotesRef is the git ref where Gitea will look for git-notes data.
 // The value ("refs/notes/commits") is the default ref used by git-notes.
 const NotesRef = "refs/notes/commits"
 
+// NotesPrefix is the prefix of all git-notes refs.
+const NotesPrefix = "refs/notes/"
+
 // Note stores information about a note created using git-notes.
 type Note struct {
 	Message []byte
@@ -25,43 +27,53 @@ type Note struct {
 // GetNote retrieves the git-notes data for a given commit.
 // FIXME: Add LastCommitCache support
 func GetNote(ctx context.Context, repo *Repository, commitID string, note *Note) error {
+	return getNote(ctx, repo, NotesRef, commitID, note)
+}
+
+func getNote(ctx context.Context, repo *Repository, notesRef, commitID string, note *Note) error {
 	log.Info("Searching for git note corresponding to the commit %q in the repository %q", commitID, repo.Path)
-	notes, err := repo.GetCommit(NotesRef)
+	notes, err := repo.GetCommit(notesRef)
 	if err != nil {
 		if IsErrNotExist(err) {
 			return err
 		}
-		log.Error("Unable to get commit from ref %q. Error: %v", NotesRef, err)
+		log.Error("Unable to get commit from ref %q. Error: %v", notesRef, err)
 		return err
 	}
 
 	remainingCommitID := commitID
 	path := ""
-	currentTree := notes.Tree.gogitTree
-	log.Info("Found tree with ID %q while searching for git note corresponding to the commit %q", currentTree.Entries[0].Name, commitID)
-	var file *object.File
+	currentTree := &notes.Tree
+	log.Info("Found tree with ID %q while searching for git note corresponding to the commit %q", currentTree.ID, commitID)
+	var entry *TreeEntry
 	for len(remainingCommitID) > 2 {
-		file, err = currentTree.File(remainingCommitID)
-		if err == nil {
+		entry, err = currentTree.GetTreeEntryByPath(remainingCommitID)
+		if err == nil && !entry.IsDir() {
 			path += remainingCommitID
 			break
 		}
-		if err == object.ErrFileNotFound {
-			currentTree, err = currentTree.Tree(remainingCommitID[0:2])
+		if err == nil || IsErrNotExist(err) {
+			currentTree, err = currentTree.SubTree(remainingCommitID[0:2])
 			path += remainingCommitID[0:2] + "/"
 			remainingCommitID = remainingCommitID[2:]
 		}
 		if err != nil {
-			if err == object.ErrDirectoryNotFound {
+			if IsErrNotExist(err) {
 				return ErrNotExist{ID: remainingCommitID, RelPath: path}
 			}
 			log.Error("Unable to find git note corresponding to the commit %q. Error: %v", commitID, err)
 			return err
 		}
 	}
+	if entry == nil || entry.IsDir() {
+		return ErrNotExist{ID: remainingCommitID, RelPath: path}
+	}
 
-	blob := file.Blob
-	dataRc, err := blob.Reader()
+	blob := entry.Blob()
+	if blob == nil {
+		return ErrNotExist{ID: entry.ID.String(), RelPath: path}
+	}
+	dataRc, err := blob.DataAsync()
 	if err != nil {
 		log.Error("Unable to read blob with ID %q. Error: %v", blob.ID, err)
 		return err
@@ -75,12 +87,22 @@ func GetNote(ctx context.Context, repo *Repository, commitID string, note *Note)
 	}
 	note.Message = d
 
+	// the commit graph is read by gogit, git log is used for the objects gogit can't read
+	hash, err := gogitHash(notes.ID)
+	if err != nil || repo.backendFor(OperationHistory, BackendGoGit, BackendCLI) == BackendCLI {
+		if note.Commit, err = repo.getCommitByPathWithID(notes.ID, path); err != nil {
+			log.Error("Unable to get the commit for the path %q. Error: %v", path, err)
+			return err
+		}
+		return nil
+	}
+
 	commitNodeIndex, commitGraphFile := repo.CommitNodeIndex()
 	if commitGraphFile != nil {
 		defer commitGraphFile.Close()
 	}
 
-	commitNode, err := commitNodeIndex.Get(notes.ID)
+	commitNode, err := commitNodeIndex.Get(hash)
 	if err != nil {
 		return err
 	}
@@ -51,3 +51,46 @@ func TestGetNonExistentNotes(t *testing.T) {
 	assert.Error(t, err)
 	assert.IsType(t, ErrNotExist{}, err)
 }
+
+func TestRepository_Notes(t *testing.T) {
+	bareRepo1Path := filepath.Join(testReposDir, "repo1_bare")
+	clonedPath, err := cloneRepo(t, bareRepo1Path)
+	assert.NoError(t, err)
+	repo, err := openRepositoryWithDefaultContext(clonedPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	const commitID = "95bb4d39648ee7e325106df01a621c530863a653"
+	opts := NoteOptions{Ref: "ci", Committer: &Signature{Name: "CI", Email: "ci@example.com"}}
+
+	_, err = repo.ListNotes(opts)
+	assert.True(t, IsErrNotExist(err))
+
+	assert.NoError(t, repo.SetNote(commitID, []byte("build: passed\n"), opts))
+	note, err := repo.GetNote(commitID, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("build: passed\n"), note.Message)
+	assert.Equal(t, "CI", note.Commit.Author.Name)
+
+	// an existing note is replaced
+	assert.NoError(t, repo.SetNote(commitID, []byte("build: failed\n"), opts))
+	note, err = repo.GetNote(commitID, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("build: failed\n"), note.Message)
+
+	entries, err := repo.ListNotes(opts)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, commitID, entries[0].CommitID.String())
+
+	refs, err := repo.ListNotesRefs()
+	assert.NoError(t, err)
+	assert.Contains(t, refs, "refs/notes/ci")
+
+	assert.NoError(t, repo.RemoveNote(commitID, opts))
+	err = repo.RemoveNote(commitID, opts)
+	assert.True(t, IsErrNotExist(err))
+	entries, err = repo.ListNotes(opts)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,187 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// ObjectID is the ID of a git object, either a SHA1 or a Sha256Hash
+type ObjectID interface {
+	String() string
+	IsZero() bool
+}
+
+// Sha256Hash is the ID of an object in a repository using the sha256 object format
+type Sha256Hash [32]byte
+
+// String returns the hex representation of the ID
+func (h Sha256Hash) String() string {
+	return hex.EncodeToString(h[:])
+}
+
+// IsZero returns true if the ID is the zero ID
+func (h Sha256Hash) IsZero() bool {
+	return h == Sha256Hash{}
+}
+
+// ObjectFormat represents the hash algorithm used by a repository for its object IDs
+type ObjectFormat interface {
+	// Name returns the name as used by `git init --object-format`
+	Name() string
+	// FullLength returns the length of the hex representation of an ID
+	FullLength() int
+	EmptyObjectID() ObjectID
+	EmptyTree() ObjectID
+	// IsValid returns true if the input is a full hex ID of this format
+	IsValid(input string) bool
+	NewIDFromString(s string) (ObjectID, error)
+	// NewID creates an ID from its raw bytes, as stored in tree objects
+	NewID(b []byte) (ObjectID, error)
+	// ComputeBlobHash computes the ID of a blob with the given content
+	ComputeBlobHash(content []byte) ObjectID
+}
+
+type sha1ObjectFormat struct{}
+
+func (sha1ObjectFormat) Name() string            { return "sha1" }
+func (sha1ObjectFormat) FullLength() int         { return 40 }
+func (sha1ObjectFormat) EmptyObjectID() ObjectID { return SHA1{} }
+func (sha1ObjectFormat) EmptyTree() ObjectID     { return plumbing.NewHash(EmptyTreeSHA) }
+
+func (f sha1ObjectFormat) IsValid(input string) bool {
+	return len(input) == f.FullLength() && isLowerHex(input)
+}
+
+func (sha1ObjectFormat) NewIDFromString(s string) (ObjectID, error) {
+	return NewIDFromString(s)
+}
+
+func (sha1ObjectFormat) NewID(b []byte) (ObjectID, error) {
+	return NewID(b)
+}
+
+func (sha1ObjectFormat) ComputeBlobHash(content []byte) ObjectID {
+	return ComputeBlobHash(content)
+}
+
+type sha256ObjectFormat struct{}
+
+func (sha256ObjectFormat) Name() string            { return "sha256" }
+func (sha256ObjectFormat) FullLength() int         { return 64 }
+func (sha256ObjectFormat) EmptyObjectID() ObjectID { return Sha256Hash{} }
+
+func (f sha256ObjectFormat) EmptyTree() ObjectID {
+	id, _ := f.NewIDFromString(EmptyTreeSHA256)
+	return id
+}
+
+func (f sha256ObjectFormat) IsValid(input string) bool {
+	return len(input) == f.FullLength() && isLowerHex(input)
+}
+
+func (f sha256ObjectFormat) NewIDFromString(s string) (ObjectID, error) {
+	var id Sha256Hash
+	s = strings.TrimSpace(s)
+	if len(s) != f.FullLength() {
+		return id, fmt.Errorf("Length must be %d: %s", f.FullLength(), s)
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return id, err
+	}
+	copy(id[:], b)
+	return id, nil
+}
+
+func (sha256ObjectFormat) NewID(b []byte) (ObjectID, error) {
+	var id Sha256Hash
+	if len(b) != len(id) {
+		return id, fmt.Errorf("Length must be %d: %v", len(id), b)
+	}
+	copy(id[:], b)
+	return id, nil
+}
+
+func (sha256ObjectFormat) ComputeBlobHash(content []byte) ObjectID {
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "blob %d\x00", len(content))
+	_, _ = h.Write(content)
+	var id Sha256Hash
+	copy(id[:], h.Sum(nil))
+	return id
+}
+
+// EmptyTreeSHA256 is the ID of an empty tree in a sha256 repository
+const EmptyTreeSHA256 = "6ef19b41225c5369f1c104d45d8d85efa9b057b53b14b4b9b939dd74decc5321"
+
+// The supported object formats
+var (
+	Sha1ObjectFormat   ObjectFormat = sha1ObjectFormat{}
+	Sha256ObjectFormat ObjectFormat = sha256ObjectFormat{}
+)
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if (s[i] < '0' || s[i] > '9') && (s[i] < 'a' || s[i] > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// gogitHash returns the ID as hash of gogit, which can only read the objects of sha1 repositories
+func gogitHash(id ObjectID) (plumbing.Hash, error) {
+	hash, ok := id.(SHA1)
+	if !ok {
+		return plumbing.ZeroHash, fmt.Errorf("unable to read object %v in-process, only sha1 objects are supported", id)
+	}
+	return hash, nil
+}
+
+// ObjectFormatFromName returns the object format with the given name, sha1 for an empty name
+func ObjectFormatFromName(name string) (ObjectFormat, error) {
+	switch strings.ToLower(name) {
+	case "", "sha1":
+		return Sha1ObjectFormat, nil
+	case "sha256":
+		return Sha256ObjectFormat, nil
+	}
+	return nil, fmt.Errorf("unsupported object format: %s", name)
+}
+
+// NewObjectIDFromString creates an ID from its full hex representation, the object format is chosen by its length
+func NewObjectIDFromString(s string) (ObjectID, error) {
+	s = strings.TrimSpace(s)
+	format, err := ObjectFormatFromID(s)
+	if err != nil {
+		return nil, err
+	}
+	return format.NewIDFromString(s)
+}
+
+// MustObjectIDFromString creates an ID of the object format from its full hex representation, it panics on invalid input
+func MustObjectIDFromString(format ObjectFormat, s string) ObjectID {
+	id, err := format.NewIDFromString(s)
+	if err != nil {
+		panic(err)
+	}
+	return id
+}
+
+// ObjectFormatFromID returns the object format of a full hex ID
+func ObjectFormatFromID(id string) (ObjectFormat, error) {
+	for _, format := range []ObjectFormat{Sha1ObjectFormat, Sha256ObjectFormat} {
+		if format.IsValid(id) {
+			return format, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid object id: %s", id)
+}
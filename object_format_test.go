@@ -0,0 +1,51 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObjectFormat(t *testing.T) {
+	format, err := ObjectFormatFromName("")
+	assert.NoError(t, err)
+	assert.Equal(t, Sha1ObjectFormat, format)
+	format, err = ObjectFormatFromName("SHA256")
+	assert.NoError(t, err)
+	assert.Equal(t, Sha256ObjectFormat, format)
+	_, err = ObjectFormatFromName("md5")
+	assert.Error(t, err)
+
+	format, err = ObjectFormatFromID(EmptyTreeSHA)
+	assert.NoError(t, err)
+	assert.Equal(t, Sha1ObjectFormat, format)
+	format, err = ObjectFormatFromID(EmptyTreeSHA256)
+	assert.NoError(t, err)
+	assert.Equal(t, Sha256ObjectFormat, format)
+	_, err = ObjectFormatFromID("abc")
+	assert.Error(t, err)
+
+	assert.True(t, Sha1ObjectFormat.EmptyObjectID().IsZero())
+	assert.True(t, Sha256ObjectFormat.EmptyObjectID().IsZero())
+	assert.Equal(t, EmptyTreeSHA, Sha1ObjectFormat.EmptyTree().String())
+	assert.Equal(t, EmptyTreeSHA256, Sha256ObjectFormat.EmptyTree().String())
+}
+
+func TestSha256ObjectFormat(t *testing.T) {
+	id, err := Sha256ObjectFormat.NewIDFromString("a4e13f7dfd8345eae550125113b9d9bcd4b0f781037c02afb133fd98f5f973ae")
+	assert.NoError(t, err)
+	assert.False(t, id.IsZero())
+	assert.Equal(t, id, Sha256ObjectFormat.ComputeBlobHash([]byte("hi")))
+
+	_, err = Sha256ObjectFormat.NewIDFromString(EmptyTreeSHA)
+	assert.Error(t, err)
+	assert.False(t, Sha256ObjectFormat.IsValid(EmptyTreeSHA))
+	assert.False(t, Sha256ObjectFormat.IsValid("6EF19B41225C5369F1C104D45D8D85EFA9B057B53B14B4B9B939DD74DECC5321"))
+
+	assert.Equal(t, Sha256ObjectFormat.EmptyTree(), MustObjectIDFromString(Sha256ObjectFormat, EmptyTreeSHA256))
+	assert.Panics(t, func() { MustObjectIDFromString(Sha1ObjectFormat, EmptyTreeSHA256) })
+}
@@ -14,6 +14,37 @@ import (
 	"github.com/go-git/go-git/v5/plumbing/object"
 )
 
+// parseTreeObject decodes the entries of a tree object, each one is "<mode> SP <name> NUL <raw id>"
+// with an id of the length of the object format
+func parseTreeObject(objectFormat ObjectFormat, data []byte) ([]TreeEntry, error) {
+	idLength := objectFormat.FullLength() / 2
+	var entries []TreeEntry
+	for len(data) > 0 {
+		mode, rest, ok := bytes.Cut(data, []byte{' '})
+		if !ok {
+			return nil, fmt.Errorf("invalid tree object: missing mode")
+		}
+		name, rest, ok := bytes.Cut(rest, []byte{0})
+		if !ok || len(rest) < idLength {
+			return nil, fmt.Errorf("invalid tree object: truncated entry %q", name)
+		}
+		fileMode, err := filemode.New(string(mode))
+		if err != nil {
+			return nil, fmt.Errorf("invalid tree object: %w", err)
+		}
+		id, err := objectFormat.NewID(rest[:idLength])
+		if err != nil {
+			return nil, fmt.Errorf("invalid tree object: %w", err)
+		}
+		entries = append(entries, TreeEntry{
+			ID:    id,
+			entry: &object.TreeEntry{Name: string(name), Mode: fileMode},
+		})
+		data = rest[idLength:]
+	}
+	return entries, nil
+}
+
 // ParseTreeEntries parses the output of a `git ls-tree -l` command.
 func ParseTreeEntries(data []byte) ([]*TreeEntry, error) {
 	return parseTreeEntries(data, nil)
@@ -49,18 +80,23 @@ func parseTreeEntries(data []byte, ptree *Tree) ([]*TreeEntry, error) {
 			return nil, fmt.Errorf("unknown type: %v", string(data[pos:pos+6]))
 		}
 
-		if pos+40 > len(data) {
+		// the length of the sha depends on the object format
+		end := pos + bytes.IndexByte(data[pos:], ' ')
+		if end < pos {
 			return nil, fmt.Errorf("Invalid ls-tree output: %s", string(data))
 		}
-		id, err := NewIDFromString(string(data[pos : pos+40]))
+		id, err := NewObjectIDFromString(string(data[pos:end]))
 		if err != nil {
 			return nil, fmt.Errorf("Invalid ls-tree output: %w", err)
 		}
 		entry.ID = id
-		entry.entry.Hash = id
-		pos += 41 // skip over sha and trailing space
+		if hash, ok := id.(SHA1); ok {
+			// gogit can only refer to the objects of sha1 repositories
+			entry.entry.Hash = hash
+		}
+		pos = end + 1 // skip over sha and trailing space
 
-		end := pos + bytes.IndexByte(data[pos:], '\t')
+		end = pos + bytes.IndexByte(data[pos:], '\t')
 		if end < pos {
 			return nil, fmt.Errorf("Invalid ls-tree -l output: %s", string(data))
 		}
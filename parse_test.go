@@ -61,6 +61,19 @@ func TestParseTreeEntries(t *testing.T) {
 				},
 			},
 		},
+		{
+			Input: "040000 tree " + EmptyTreeSHA256 + "       -\texample\n",
+			Expected: []*TreeEntry{
+				{
+					ID:    MustObjectIDFromString(Sha256ObjectFormat, EmptyTreeSHA256),
+					sized: true,
+					entry: &object.TreeEntry{
+						Name: "example",
+						Mode: filemode.Dir,
+					},
+				},
+			},
+		},
 	}
 
 	for _, testCase := range testCases {
@@ -0,0 +1,206 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// readPktLine reads a pkt-line, a nil slice without error is a flush packet
+func readPktLine(rd *bufio.Reader) ([]byte, error) {
+	lengthBytes := make([]byte, 4)
+	if _, err := io.ReadFull(rd, lengthBytes); err != nil {
+		return nil, err
+	}
+	length, err := strconv.ParseUint(string(lengthBytes), 16, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pkt-line length %q: %w", lengthBytes, err)
+	}
+	if length == 0 {
+		return nil, nil
+	}
+	if length < 4 {
+		return nil, fmt.Errorf("invalid pkt-line length %q", lengthBytes)
+	}
+	data := make([]byte, length-4)
+	if _, err := io.ReadFull(rd, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// writePktLine writes data as a pkt-line terminated by a line feed
+func writePktLine(w io.Writer, data string) error {
+	_, err := fmt.Fprintf(w, "%04x%s\n", len(data)+5, data)
+	return err
+}
+
+func writeFlushPkt(w io.Writer) error {
+	_, err := w.Write([]byte("0000"))
+	return err
+}
+
+// ProcReceiveCommand is a ref update git passes to the proc-receive hook
+type ProcReceiveCommand struct {
+	OldOID  string
+	NewOID  string
+	RefName string
+}
+
+// ProcReceiveResult is the report of the proc-receive hook for a command.
+// RefName is the ref of the command, the other ref and ids tell git what was really updated,
+// e.g. refs/pull/1/head for refs/for/main.
+type ProcReceiveResult struct {
+	RefName string
+	// Reason is sent as "ng" status if set
+	Reason string
+
+	ReportRef   string
+	OldOID      string
+	NewOID      string
+	ForcedPush  bool
+	FallThrough bool
+}
+
+// ProcReceive implements the server side of the proc-receive hook protocol,
+// see https://git-scm.com/docs/githooks#proc-receive
+type ProcReceive struct {
+	rd           *bufio.Reader
+	w            io.Writer
+	capabilities map[string]bool
+}
+
+// NewProcReceive creates a ProcReceive reading from git on in and replying on out, usually stdin and stdout of the hook
+func NewProcReceive(in io.Reader, out io.Writer) *ProcReceive {
+	return &ProcReceive{
+		rd:           bufio.NewReader(in),
+		w:            out,
+		capabilities: map[string]bool{},
+	}
+}
+
+// Negotiate reads the version and capabilities sent by git and answers with version 1 and the capabilities
+// which are supported by both sides, e.g. "push-options" or "atomic".
+func (p *ProcReceive) Negotiate(capabilities ...string) error {
+	var offered []string
+	for {
+		line, err := readPktLine(p.rd)
+		if err != nil {
+			return fmt.Errorf("unable to read proc-receive version: %w", err)
+		}
+		if line == nil {
+			break
+		}
+		version, caps, _ := strings.Cut(strings.TrimSuffix(string(line), "\n"), "\x00")
+		if version != "version=1" {
+			return fmt.Errorf("unsupported proc-receive version: %s", version)
+		}
+		offered = append(offered, strings.Fields(caps)...)
+	}
+
+	var accepted []string
+	for _, c := range capabilities {
+		for _, o := range offered {
+			if c == o {
+				p.capabilities[c] = true
+				accepted = append(accepted, c)
+				break
+			}
+		}
+	}
+
+	if err := writePktLine(p.w, "version=1\x00"+strings.Join(accepted, " ")); err != nil {
+		return err
+	}
+	return writeFlushPkt(p.w)
+}
+
+// HasCapability returns true if the capability was negotiated
+func (p *ProcReceive) HasCapability(capability string) bool {
+	return p.capabilities[capability]
+}
+
+// ReadCommands reads the ref updates sent by git
+func (p *ProcReceive) ReadCommands() ([]*ProcReceiveCommand, error) {
+	var commands []*ProcReceiveCommand
+	for {
+		line, err := readPktLine(p.rd)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read proc-receive commands: %w", err)
+		}
+		if line == nil {
+			return commands, nil
+		}
+		fields := strings.Fields(string(line))
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid proc-receive command: %q", line)
+		}
+		commands = append(commands, &ProcReceiveCommand{OldOID: fields[0], NewOID: fields[1], RefName: fields[2]})
+	}
+}
+
+// ReadPushOptions reads the push options which git sends after the commands if "push-options" was negotiated
+func (p *ProcReceive) ReadPushOptions() (ReceivePushOptions, error) {
+	if !p.HasCapability("push-options") {
+		return ReceivePushOptions{}, nil
+	}
+	var options []string
+	for {
+		line, err := readPktLine(p.rd)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read proc-receive push options: %w", err)
+		}
+		if line == nil {
+			return ParsePushOptions(options), nil
+		}
+		options = append(options, strings.TrimSuffix(string(line), "\n"))
+	}
+}
+
+// WriteResults reports the results of the commands back to git
+func (p *ProcReceive) WriteResults(results []*ProcReceiveResult) error {
+	for _, result := range results {
+		if result.Reason != "" {
+			if err := writePktLine(p.w, "ng "+result.RefName+" "+result.Reason); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := writePktLine(p.w, "ok "+result.RefName); err != nil {
+			return err
+		}
+		if result.FallThrough {
+			if err := writePktLine(p.w, "option fall-through"); err != nil {
+				return err
+			}
+			continue
+		}
+		if result.ReportRef != "" {
+			if err := writePktLine(p.w, "option refname "+result.ReportRef); err != nil {
+				return err
+			}
+		}
+		if result.OldOID != "" {
+			if err := writePktLine(p.w, "option old-oid "+result.OldOID); err != nil {
+				return err
+			}
+		}
+		if result.NewOID != "" {
+			if err := writePktLine(p.w, "option new-oid "+result.NewOID); err != nil {
+				return err
+			}
+		}
+		if result.ForcedPush {
+			if err := writePktLine(p.w, "option forced-update"); err != nil {
+				return err
+			}
+		}
+	}
+	return writeFlushPkt(p.w)
+}
@@ -0,0 +1,178 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package process
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// LifecycleOptions limits how long a long running helper process, e.g. a git cat-file --batch, is kept
+type LifecycleOptions struct {
+	// IdleTimeout stops the process once it was not used for this long, no limit if zero
+	IdleTimeout time.Duration
+	// MaxLifetime stops the process once it ran this long and is not in use, so it is recycled, no limit if zero
+	MaxLifetime time.Duration
+}
+
+// Lifecycle tracks the use of a long running process and stops it once it expired.
+// Once the context is done the process is shut down gracefully: it can't be acquired anymore
+// and is stopped as soon as it is not in use.
+type Lifecycle struct {
+	opts LifecycleOptions
+	stop func()
+
+	mu       sync.Mutex
+	start    time.Time
+	lastUsed time.Time
+	inUse    int
+	draining bool
+	stopped  bool
+	timer    *time.Timer
+	done     chan struct{}
+}
+
+// NewLifecycle starts tracking a process which is not in use yet, stop is called once to stop it
+func NewLifecycle(ctx context.Context, opts LifecycleOptions, stop func()) *Lifecycle {
+	now := time.Now()
+	l := &Lifecycle{
+		opts:     opts,
+		stop:     stop,
+		start:    now,
+		lastUsed: now,
+		done:     make(chan struct{}),
+	}
+	l.mu.Lock()
+	l.schedule(now)
+	l.mu.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			l.drain()
+		case <-l.done:
+		}
+	}()
+	return l
+}
+
+// Acquire marks the process as in use, it returns false if the process is stopped or shutting down and must not be used
+func (l *Lifecycle) Acquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.stopped || l.draining {
+		return false
+	}
+	l.inUse++
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	return true
+}
+
+// Release marks the process as not in use anymore, it is stopped if it expired or is shutting down
+func (l *Lifecycle) Release() {
+	l.mu.Lock()
+	if l.stopped {
+		l.mu.Unlock()
+		return
+	}
+	if l.inUse > 0 {
+		l.inUse--
+	}
+	now := time.Now()
+	l.lastUsed = now
+	if l.inUse == 0 && (l.draining || l.expired(now)) {
+		l.mu.Unlock()
+		l.Stop()
+		return
+	}
+	if l.inUse == 0 {
+		l.schedule(now)
+	}
+	l.mu.Unlock()
+}
+
+// Stop stops the process, whether it is in use or not. Calling it again does nothing.
+func (l *Lifecycle) Stop() {
+	l.mu.Lock()
+	if l.stopped {
+		l.mu.Unlock()
+		return
+	}
+	l.stopped = true
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	close(l.done)
+	l.mu.Unlock()
+
+	l.stop()
+}
+
+// Stopped returns a channel which is closed once the process is stopped
+func (l *Lifecycle) Stopped() <-chan struct{} {
+	return l.done
+}
+
+func (l *Lifecycle) drain() {
+	l.mu.Lock()
+	l.draining = true
+	inUse := l.inUse
+	l.mu.Unlock()
+	if inUse == 0 {
+		l.Stop()
+	}
+}
+
+// check stops the process if it expired while not in use, otherwise it waits for the next deadline
+func (l *Lifecycle) check() {
+	l.mu.Lock()
+	if l.stopped || l.inUse > 0 {
+		l.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	if l.expired(now) {
+		l.mu.Unlock()
+		l.Stop()
+		return
+	}
+	l.schedule(now)
+	l.mu.Unlock()
+}
+
+// deadline returns when the process expires if it isn't used anymore, false if it never expires. l.mu must be held.
+func (l *Lifecycle) deadline() (time.Time, bool) {
+	var deadline time.Time
+	if l.opts.IdleTimeout > 0 {
+		deadline = l.lastUsed.Add(l.opts.IdleTimeout)
+	}
+	if l.opts.MaxLifetime > 0 {
+		if end := l.start.Add(l.opts.MaxLifetime); deadline.IsZero() || end.Before(deadline) {
+			deadline = end
+		}
+	}
+	return deadline, !deadline.IsZero()
+}
+
+func (l *Lifecycle) expired(now time.Time) bool {
+	deadline, ok := l.deadline()
+	return ok && !now.Before(deadline)
+}
+
+// schedule arms the timer for the next deadline. l.mu must be held.
+func (l *Lifecycle) schedule(now time.Time) {
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	if deadline, ok := l.deadline(); ok {
+		l.timer = time.AfterFunc(deadline.Sub(now), l.check)
+	}
+}
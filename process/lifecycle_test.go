@@ -0,0 +1,69 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package process
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLifecycle_IdleTimeout(t *testing.T) {
+	var stops int32
+	l := NewLifecycle(context.Background(), LifecycleOptions{IdleTimeout: 50 * time.Millisecond}, func() {
+		atomic.AddInt32(&stops, 1)
+	})
+
+	// a process in use doesn't expire
+	assert.True(t, l.Acquire())
+	time.Sleep(100 * time.Millisecond)
+	assert.EqualValues(t, 0, atomic.LoadInt32(&stops))
+
+	l.Release()
+	select {
+	case <-l.Stopped():
+	case <-time.After(time.Second):
+		t.Fatal("idle process was not stopped")
+	}
+	assert.EqualValues(t, 1, atomic.LoadInt32(&stops))
+	assert.False(t, l.Acquire())
+
+	l.Stop()
+	assert.EqualValues(t, 1, atomic.LoadInt32(&stops))
+}
+
+func TestLifecycle_MaxLifetime(t *testing.T) {
+	var stops int32
+	l := NewLifecycle(context.Background(), LifecycleOptions{IdleTimeout: time.Hour, MaxLifetime: 50 * time.Millisecond}, func() {
+		atomic.AddInt32(&stops, 1)
+	})
+
+	assert.True(t, l.Acquire())
+	time.Sleep(100 * time.Millisecond)
+	assert.EqualValues(t, 0, atomic.LoadInt32(&stops))
+	// the expired process is recycled once it is released
+	l.Release()
+	assert.EqualValues(t, 1, atomic.LoadInt32(&stops))
+	assert.False(t, l.Acquire())
+}
+
+func TestLifecycle_ContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var stops int32
+	l := NewLifecycle(ctx, LifecycleOptions{}, func() {
+		atomic.AddInt32(&stops, 1)
+	})
+
+	assert.True(t, l.Acquire())
+	cancel()
+	// the process in use is stopped once it is released, and can't be acquired meanwhile
+	assert.Eventually(t, func() bool { return !l.Acquire() }, time.Second, 10*time.Millisecond)
+	assert.EqualValues(t, 0, atomic.LoadInt32(&stops))
+	l.Release()
+	assert.EqualValues(t, 1, atomic.LoadInt32(&stops))
+}
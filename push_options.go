@@ -0,0 +1,90 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Well known push options, e.g. git push -o topic=feature origin HEAD:refs/for/main
+const (
+	// AGit flow options
+	PushOptionTopic       = "topic"
+	PushOptionTitle       = "title"
+	PushOptionDescription = "description"
+	PushOptionForcePush   = "force-push"
+
+	// PushOptionSkipCI asks the server to not run CI for the pushed commits
+	PushOptionSkipCI = "ci.skip"
+	// PushOptionMergeOnPush asks the server to merge the pull request of the pushed branch
+	PushOptionMergeOnPush = "merge-on-push"
+)
+
+// ReceivePushOptions holds the push options sent by the client, git push -o key=value.
+// Options without a value are set to "true".
+type ReceivePushOptions map[string]string
+
+// ParsePushOptions parses push options in key=value form.
+func ParsePushOptions(options []string) ReceivePushOptions {
+	opts := make(ReceivePushOptions, len(options))
+	for _, option := range options {
+		key, value, found := strings.Cut(option, "=")
+		if !found {
+			value = "true"
+		}
+		opts[key] = value
+	}
+	return opts
+}
+
+// ReadPushOptionsFromEnv reads the push options git passes to pre-receive and post-receive hooks
+// in the GIT_PUSH_OPTION_COUNT and GIT_PUSH_OPTION_<n> variables.
+func ReadPushOptionsFromEnv() ReceivePushOptions {
+	count, _ := strconv.Atoi(os.Getenv("GIT_PUSH_OPTION_COUNT"))
+	options := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		options = append(options, os.Getenv(fmt.Sprintf("GIT_PUSH_OPTION_%d", i)))
+	}
+	return ParsePushOptions(options)
+}
+
+// Topic returns the topic push option
+func (opts ReceivePushOptions) Topic() string {
+	return opts[PushOptionTopic]
+}
+
+// Title returns the title push option
+func (opts ReceivePushOptions) Title() string {
+	return opts[PushOptionTitle]
+}
+
+// Description returns the description push option
+func (opts ReceivePushOptions) Description() string {
+	return opts[PushOptionDescription]
+}
+
+// Bool returns true if the option is set to a true value like "true", "1" or no value at all
+func (opts ReceivePushOptions) Bool(key string) bool {
+	value, _ := strconv.ParseBool(opts[key])
+	return value
+}
+
+// ForcePush returns true if the force-push option is set
+func (opts ReceivePushOptions) ForcePush() bool {
+	return opts.Bool(PushOptionForcePush)
+}
+
+// SkipCI returns true if the ci.skip option is set
+func (opts ReceivePushOptions) SkipCI() bool {
+	return opts.Bool(PushOptionSkipCI)
+}
+
+// MergeOnPush returns true if the merge-on-push option is set
+func (opts ReceivePushOptions) MergeOnPush() bool {
+	return opts.Bool(PushOptionMergeOnPush)
+}
@@ -0,0 +1,31 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadPushOptionsFromEnv(t *testing.T) {
+	t.Setenv("GIT_PUSH_OPTION_COUNT", "4")
+	t.Setenv("GIT_PUSH_OPTION_0", "topic=feature")
+	t.Setenv("GIT_PUSH_OPTION_1", "title=a=b")
+	t.Setenv("GIT_PUSH_OPTION_2", "force-push")
+	t.Setenv("GIT_PUSH_OPTION_3", "ci.skip=1")
+
+	opts := ReadPushOptionsFromEnv()
+	assert.Equal(t, "feature", opts.Topic())
+	assert.Equal(t, "a=b", opts.Title())
+	assert.Empty(t, opts.Description())
+	assert.True(t, opts.ForcePush())
+	assert.True(t, opts.SkipCI())
+	assert.False(t, opts.MergeOnPush())
+	assert.False(t, ParsePushOptions([]string{"force-push=false"}).ForcePush())
+
+	t.Setenv("GIT_PUSH_OPTION_COUNT", "")
+	assert.Empty(t, ReadPushOptionsFromEnv())
+}
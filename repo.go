@@ -17,28 +17,43 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/enverbisevac/gitlib/hooks"
 	"github.com/enverbisevac/gitlib/util"
 	"github.com/go-git/go-billy/v5"
 	"github.com/go-git/go-billy/v5/osfs"
 	gogit "github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/cache"
 	"github.com/go-git/go-git/v5/storage/filesystem"
-	git2go "github.com/libgit2/git2go/v34"
 )
 
 // GPGSettings represents the default GPG settings for this repository
 type GPGSettings struct {
-	Sign             bool
-	KeyID            string
-	Email            string
-	Name             string
-	PublicKeyContent string
+	Sign bool
+	// Format is the gpg.format, SigningFormatOpenPGP or SigningFormatSSH
+	Format string
+	// Program is the gpg.program, or the gpg.ssh.program for ssh keys, empty for the default
+	Program string
+	// KeyID is the user.signingkey git signs with, the one of the most specific config level
+	KeyID string
+	Email string
+	Name  string
+
+	ctx       context.Context
+	publicKey *publicKey
+}
+
+// publicKey is the public key of GPGSettings, loaded once and shared by copies of the settings
+type publicKey struct {
+	once    sync.Once
+	content string
+	err     error
 }
 
 const prettyLogFormat = `--pretty=format:%H`
@@ -77,6 +92,8 @@ type InitRepositoryConfig struct {
 	bare          bool
 	defaultBranch string
 	description   string
+	objectFormat  string
+	hooks         map[string]string
 }
 
 type InitRepositoryFunc func(c *InitRepositoryConfig)
@@ -103,6 +120,22 @@ func InitWithDescription(value string) InitRepositoryFunc {
 	}
 }
 
+// InitWithObjectFormat sets the object format ("sha1" or "sha256") of the new repository.
+// Repositories using sha256 are created by the git binary and need git >= 2.29.
+func InitWithObjectFormat(value string) InitRepositoryFunc {
+	return func(c *InitRepositoryConfig) {
+		c.objectFormat = value
+	}
+}
+
+// InitWithHooks installs the hook templates, a map of server hook name to script content,
+// into the new repository using the hooks package layout.
+func InitWithHooks(templates map[string]string) InitRepositoryFunc {
+	return func(c *InitRepositoryConfig) {
+		c.hooks = templates
+	}
+}
+
 type InitRepositoryOption interface {
 	Apply(c *InitRepositoryConfig)
 }
@@ -133,6 +166,15 @@ func InitRepository(ctx context.Context, repoPath string, opts ...InitRepository
 		c.defaultBranch = "refs/heads/" + c.defaultBranch
 	}
 
+	objectFormat, err := ObjectFormatFromName(c.objectFormat)
+	if err != nil {
+		return nil, err
+	}
+	if objectFormat != Sha1ObjectFormat {
+		// gogit is only able to create sha1 repositories
+		return initRepositoryWithGit(ctx, repoPath, objectFormat, c)
+	}
+
 	// gogit
 	repo, err := gogit.InitWithOptions(s, wt, gogit.InitOptions{
 		DefaultBranch: plumbing.ReferenceName(c.defaultBranch),
@@ -142,7 +184,7 @@ func InitRepository(ctx context.Context, repoPath string, opts ...InitRepository
 	}
 
 	//libgit2
-	git2gorepo, err := git2go.OpenRepository(repoPath)
+	git2gorepo, err := openLibgit2Repository(repoPath)
 	if err != nil {
 		return nil, err
 	}
@@ -156,18 +198,70 @@ func InitRepository(ctx context.Context, repoPath string, opts ...InitRepository
 		log.Printf("error writing description file for repository '%s'", repoPath)
 	}
 
+	gitDir := repoPath
+	if !c.bare {
+		gitDir = filepath.Join(repoPath, gogit.GitDirName)
+	}
+	if err := hooks.Install(gitDir, c.hooks); err != nil {
+		return nil, err
+	}
+
 	return &Repository{
-		Path:     repoPath,
-		gogit:    repo,
-		git2go:   git2gorepo,
-		storage:  s,
-		tagCache: newObjectCache(),
-		Ctx:      ctx,
+		Path:         repoPath,
+		gogit:        repo,
+		git2go:       git2gorepo,
+		storage:      s,
+		objectFormat: Sha1ObjectFormat,
+		tagCache:     newObjectCache(),
+		Ctx:          ctx,
+		catFile:      &repositoryCatFile{ctx: ctx},
 	}, nil
 }
 
+func initRepositoryWithGit(ctx context.Context, repoPath string, objectFormat ObjectFormat, c InitRepositoryConfig) (*Repository, error) {
+	if err := CheckGitVersionAtLeast("2.29"); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(repoPath, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	cmd := NewCommand(ctx, "init").AddOptionFormat("--object-format=%s", objectFormat.Name())
+	if c.bare {
+		cmd.AddArguments("--bare")
+	}
+	if _, stderr, err := cmd.RunStdString(&RunOpts{Dir: repoPath}); err != nil {
+		return nil, ConcatenateError(err, stderr)
+	}
+	if _, stderr, err := NewCommand(ctx, "symbolic-ref", "HEAD").AddDynamicArguments(c.defaultBranch).RunStdString(&RunOpts{Dir: repoPath}); err != nil {
+		return nil, ConcatenateError(err, stderr)
+	}
+
+	gitDir := repoPath
+	if !c.bare {
+		gitDir = filepath.Join(repoPath, gogit.GitDirName)
+	}
+	if err := os.WriteFile(filepath.Join(gitDir, "description"), []byte(c.description), 0o644); err != nil {
+		log.Printf("error writing description file for repository '%s'", repoPath)
+	}
+	if err := hooks.Install(gitDir, c.hooks); err != nil {
+		return nil, err
+	}
+
+	return OpenRepository(ctx, repoPath)
+}
+
 // IsEmpty Check if repository is empty.
 func (repo *Repository) IsEmpty() (bool, error) {
+	if repo.backendFor(OperationReferences, BackendGoGit, BackendCLI) == BackendCLI {
+		if _, err := repo.showRef("HEAD"); err != nil {
+			if IsErrNotExist(err) {
+				return true, nil
+			}
+			return false, err
+		}
+		return false, nil
+	}
 	_, err := repo.gogit.Head()
 	if err != nil {
 		if errors.Is(err, plumbing.ErrReferenceNotFound) {
@@ -191,6 +285,13 @@ type CloneRepoOptions struct {
 	Depth         int
 	Filter        string
 	SkipTLSVerify bool
+	// ShallowSince and ShallowExclude create a shallow clone with the history after a date or without the history of the given refs
+	ShallowSince   time.Time
+	ShallowExclude []string
+	// Sparse starts with a sparse checkout of the files in the root directory only, see SparseCheckoutSet
+	Sparse bool
+	// Credentials authenticate against the remote
+	Credentials *Credentials
 }
 
 // Clone clones original repository to target path.
@@ -227,9 +328,13 @@ func CloneWithArgs(ctx context.Context, args []CmdArg, from, to string, opts Clo
 	if opts.Depth > 0 {
 		cmd.AddArguments("--depth").AddDynamicArguments(strconv.Itoa(opts.Depth))
 	}
+	addShallowArguments(cmd, opts.ShallowSince, opts.ShallowExclude)
 	if opts.Filter != "" {
 		cmd.AddArguments("--filter").AddDynamicArguments(opts.Filter)
 	}
+	if opts.Sparse {
+		cmd.AddArguments("--sparse")
+	}
 	if len(opts.Branch) > 0 {
 		cmd.AddArguments("-b").AddDynamicArguments(opts.Branch)
 	}
@@ -252,6 +357,11 @@ func CloneWithArgs(ctx context.Context, args []CmdArg, from, to string, opts Clo
 			envs = append(envs, fmt.Sprintf("https_proxy=%s", GetProxyURL()))
 		}
 	}
+	envs, cleanup, err := opts.Credentials.env(envs)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
 
 	stderr := new(bytes.Buffer)
 	if err = cmd.Run(&RunOpts{
@@ -276,23 +386,125 @@ func CloneWithArgs(ctx context.Context, args []CmdArg, from, to string, opts Clo
 
 // PushOptions options when push to remote
 type PushOptions struct {
-	Remote  string
-	Branch  string
-	Force   bool
-	Mirror  bool
-	Env     []string
-	Timeout time.Duration
+	// Remote is the name or URL of the remote, origin if empty
+	Remote string
+	Branch string
+	// Refspecs are pushed in addition to the commit pushed to Branch
+	Refspecs []string
+	Force    bool
+	// ForceWithLease maps remote refs to their expected current commit, the push of a ref is only
+	// forced if the remote ref still has this value. An empty value expects the ref to not exist.
+	ForceWithLease map[string]string
+	// Atomic updates either all refs on the remote or none of them
+	Atomic bool
+	// PushOptions are sent to the hooks of the remote as push options, usually in key=value form
+	PushOptions []string
+	Mirror      bool
+	// Tags are pushed to the tags of the same name on the remote
+	Tags []string
+	// DeleteTags are deleted on the remote
+	DeleteTags []string
+	// TagsMode pushes all tags or the tags pointing into the pushed history in addition
+	TagsMode PushTagsMode
+	// Credentials authenticate against the remote
+	Credentials *Credentials
+	Env         []string
+	Timeout     time.Duration
 }
 
+// PushTagsMode controls which tags are pushed in addition to the refspecs
+type PushTagsMode int
+
+const (
+	// PushTagsNone only pushes the tags given as refspecs
+	PushTagsNone PushTagsMode = iota
+	// PushTagsFollow pushes the annotated tags pointing into the pushed history, git push --follow-tags
+	PushTagsFollow
+	// PushTagsAll pushes all tags, git push --tags
+	PushTagsAll
+)
+
+// Push pushes commitHash to the branch opt.Branch and opt.Refspecs of the remote.
+// A push which is not a fast-forward or has a stale lease returns ErrPushOutOfDate,
+// a push declined by a hook of the remote returns ErrPushRejected.
 func (repo *Repository) Push(ctx context.Context, commitHash string, opt PushOptions) error {
-	branch := strings.TrimSpace(commitHash) + ":" + BranchPrefix + strings.TrimSpace(opt.Branch)
-	return repo.gogit.PushContext(ctx, &gogit.PushOptions{
-		RemoteName: opt.Remote,
-		Force:      opt.Force,
-		RefSpecs: []config.RefSpec{
-			config.RefSpec(branch),
-		},
+	if opt.Remote == "" {
+		opt.Remote = "origin"
+	}
+	cmd := NewCommand(ctx, "push")
+	if opt.Force {
+		cmd.AddArguments("-f")
+	}
+	leaseRefs := make([]string, 0, len(opt.ForceWithLease))
+	for ref := range opt.ForceWithLease {
+		leaseRefs = append(leaseRefs, ref)
+	}
+	sort.Strings(leaseRefs)
+	for _, ref := range leaseRefs {
+		cmd.AddOptionFormat("--force-with-lease=%s:%s", ref, opt.ForceWithLease[ref])
+	}
+	if opt.Atomic {
+		cmd.AddArguments("--atomic")
+	}
+	if opt.Mirror {
+		cmd.AddArguments("--mirror")
+	}
+	switch opt.TagsMode {
+	case PushTagsFollow:
+		cmd.AddArguments("--follow-tags")
+	case PushTagsAll:
+		cmd.AddArguments("--tags")
+	}
+	for _, option := range opt.PushOptions {
+		cmd.AddArguments("-o").AddDynamicArguments(option)
+	}
+
+	refspecs := []string{opt.Remote}
+	if opt.Branch != "" {
+		refspecs = append(refspecs, strings.TrimSpace(commitHash)+":"+BranchPrefix+strings.TrimSpace(opt.Branch))
+	}
+	for _, tag := range opt.Tags {
+		refspecs = append(refspecs, TagPrefix+tag+":"+TagPrefix+tag)
+	}
+	for _, tag := range opt.DeleteTags {
+		refspecs = append(refspecs, ":"+TagPrefix+tag)
+	}
+	cmd.AddDashesAndList(append(refspecs, opt.Refspecs...)...)
+	desc := fmt.Sprintf("push %s to %s (force: %t, atomic: %t, mirror: %t)", strings.Join(append(refspecs[1:], opt.Refspecs...), " "), util.SanitizeCredentialURLs(opt.Remote), opt.Force, opt.Atomic, opt.Mirror)
+	cmd.SetDescription(desc)
+	if skipDryRun(ctx, "%s [repo_path: %s]", desc, repo.Path) {
+		return nil
+	}
+
+	envs, cleanup, err := opt.Credentials.env(append(os.Environ(), opt.Env...))
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	err = cmd.Run(&RunOpts{
+		Env:     envs,
+		Timeout: opt.Timeout,
+		Dir:     repo.Path,
+		Stdout:  stdout,
+		Stderr:  stderr,
 	})
+	if err != nil {
+		outStr, errStr := stdout.String(), stderr.String()
+		if strings.Contains(errStr, "non-fast-forward") || strings.Contains(errStr, "(stale info)") || strings.Contains(errStr, "(fetch first)") {
+			return &ErrPushOutOfDate{StdOut: outStr, StdErr: errStr, Err: err}
+		} else if strings.Contains(errStr, "! [remote rejected]") {
+			err := &ErrPushRejected{StdOut: outStr, StdErr: errStr, Err: err}
+			err.GenerateMessage()
+			return err
+		} else if strings.Contains(errStr, "matches more than one") {
+			return &ErrMoreThanOne{StdOut: outStr, StdErr: errStr, Err: err}
+		}
+		return fmt.Errorf("push failed: %w", ConcatenateError(err, errStr))
+	}
+	return nil
 }
 
 // GetLatestCommitTime returns time for latest commit in repository (across all branches)
@@ -343,7 +555,125 @@ func GetDivergingCommits(ctx context.Context, repoPath, baseBranch, targetBranch
 	return DivergeObject{ahead, behind}, nil
 }
 
-// CreateBundle create bundle content to the target path
+// GetDivergingCommitsForBranches returns the number of commits each of the branches is ahead or behind baseBranch,
+// keyed by branch name. With git >= 2.41 all branches are compared in a single git for-each-ref,
+// older versions fall back to one git rev-list per branch.
+func GetDivergingCommitsForBranches(ctx context.Context, repoPath, baseBranch string, branches []string) (map[string]DivergeObject, error) {
+	if len(branches) == 0 {
+		return map[string]DivergeObject{}, nil
+	}
+	if CheckGitVersionAtLeast("2.41") != nil {
+		return getDivergingCommitsByRevList(ctx, repoPath, baseBranch, branches)
+	}
+
+	cmd := NewCommand(ctx, "for-each-ref").AddOptionFormat("--format=%%(refname) %%(ahead-behind:%s)", baseBranch)
+	for _, branch := range branches {
+		cmd.AddDynamicArguments(BranchPrefix + branch)
+	}
+	stdout, stderr, err := cmd.RunStdString(&RunOpts{Dir: repoPath})
+	if err != nil {
+		return nil, fmt.Errorf("unable to compare branches with %s: %w", baseBranch, ConcatenateError(err, stderr))
+	}
+
+	wanted := make(map[string]bool, len(branches))
+	for _, branch := range branches {
+		wanted[branch] = true
+	}
+	result := make(map[string]DivergeObject, len(branches))
+	for _, line := range strings.Split(strings.TrimSpace(stdout), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		// the patterns also match refs below the branches, e.g. refs/heads/feature/x for feature
+		branch := strings.TrimPrefix(fields[0], BranchPrefix)
+		if !wanted[branch] {
+			continue
+		}
+		diverge, err := parseDivergeCounts(fields[1], fields[2])
+		if err != nil {
+			return nil, err
+		}
+		result[branch] = diverge
+	}
+	for _, branch := range branches {
+		if _, ok := result[branch]; !ok {
+			return nil, ErrNotExist{ID: branch}
+		}
+	}
+	return result, nil
+}
+
+func getDivergingCommitsByRevList(ctx context.Context, repoPath, baseBranch string, branches []string) (map[string]DivergeObject, error) {
+	result := make(map[string]DivergeObject, len(branches))
+	for _, branch := range branches {
+		// $(git rev-list --left-right --count feature...master) commits ahead and behind of master
+		stdout, stderr, runErr := NewCommand(ctx, "rev-list", "--left-right", "--count").
+			AddDynamicArguments(BranchPrefix + branch + "..." + baseBranch).RunStdString(&RunOpts{Dir: repoPath})
+		if runErr != nil {
+			if errors.Is(runErr, ErrUnknownRevision) {
+				return nil, ErrNotExist{ID: branch}
+			}
+			return nil, fmt.Errorf("unable to compare %s with %s: %w", branch, baseBranch, ConcatenateError(runErr, stderr))
+		}
+		fields := strings.Fields(stdout)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid rev-list output: %s", stdout)
+		}
+		diverge, err := parseDivergeCounts(fields[0], fields[1])
+		if err != nil {
+			return nil, err
+		}
+		result[branch] = diverge
+	}
+	return result, nil
+}
+
+func parseDivergeCounts(ahead, behind string) (diverge DivergeObject, err error) {
+	if diverge.Ahead, err = strconv.Atoi(ahead); err != nil {
+		return DivergeObject{}, fmt.Errorf("invalid ahead count %q: %w", ahead, err)
+	}
+	if diverge.Behind, err = strconv.Atoi(behind); err != nil {
+		return DivergeObject{}, fmt.Errorf("invalid behind count %q: %w", behind, err)
+	}
+	return diverge, nil
+}
+
+// BundleOptions options for CreateBundleWithOptions
+type BundleOptions struct {
+	// Revisions are the refs whose history is included like "refs/heads/main" or "v1.0", and ranges like "v1.0..main".
+	// Only refs are recorded in the bundle, a plain commit ID adds history but no ref.
+	Revisions []string
+	// All includes all refs
+	All bool
+	// Basis are the revisions the receiver already has, their history is excluded and becomes a prerequisite of the bundle
+	Basis []string
+}
+
+// CreateBundleWithOptions writes a bundle of the refs of the repository to out.
+// With a basis the bundle is incremental and can only be unbundled into a repository having the basis.
+func (repo *Repository) CreateBundleWithOptions(ctx context.Context, out io.Writer, opts BundleOptions) error {
+	if len(opts.Revisions) == 0 && !opts.All {
+		return errors.New("no revisions given for the bundle")
+	}
+	cmd := NewCommand(ctx, "bundle", "create", "-")
+	if opts.All {
+		cmd.AddArguments("--all")
+	}
+	cmd.AddDynamicArguments(opts.Revisions...)
+	for _, basis := range opts.Basis {
+		cmd.AddDynamicArguments("^" + basis)
+	}
+
+	stderr := new(strings.Builder)
+	if err := cmd.Run(&RunOpts{Dir: repo.Path, Stdout: out, Stderr: stderr}); err != nil {
+		return fmt.Errorf("unable to create bundle: %w", ConcatenateError(err, stderr.String()))
+	}
+	return nil
+}
+
+// CreateBundle create bundle content to the target path.
+// The bundle contains the history of commit as branch "bundle", see CreateBundleWithOptions to bundle refs of the repository.
 func (repo *Repository) CreateBundle(ctx context.Context, commit string, out io.Writer) error {
 	tmp, err := os.MkdirTemp(os.TempDir(), "gitlib-bundle")
 	if err != nil {
@@ -0,0 +1,77 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AmendCommitOptions describes what to change of the commit, empty fields keep the original values
+type AmendCommitOptions struct {
+	Message string
+	Author  *Signature
+	// TreeID replaces the tree of the commit
+	TreeID string
+	// Committer of the rewritten commit, the original committer with the current time is used if nil
+	Committer *Signature
+	// Sign signs the rewritten commit with SigningKey or the configured user.signingkey,
+	// the signature of the original commit is always dropped as it does not match anymore
+	Sign       bool
+	SigningKey string
+}
+
+// AmendCommit replaces the commit ref points to with a commit with the same parents but changed
+// message, author and/or tree. If ref is a full reference name starting with "refs/" it is updated
+// to the new commit, otherwise only the new commit is created.
+func (repo *Repository) AmendCommit(ref string, opts AmendCommitOptions) (ObjectID, error) {
+	oldID, err := repo.resolveCommitID(ref)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := repo.GetCommit(oldID)
+	if err != nil {
+		return nil, err
+	}
+
+	message := opts.Message
+	if message == "" {
+		message = commit.CommitMessage
+	}
+	author := opts.Author
+	if author == nil {
+		author = commit.Author
+	}
+	committer := opts.Committer
+	if committer == nil {
+		committer = &Signature{Name: commit.Committer.Name, Email: commit.Committer.Email}
+	}
+	treeID := opts.TreeID
+	if treeID == "" {
+		treeID = commit.Tree.ID.String()
+	}
+
+	parents := make([]string, 0, len(commit.Parents))
+	for _, parent := range commit.Parents {
+		parents = append(parents, parent.String())
+	}
+
+	newID, err := repo.commitTreeID(author, committer, treeID, CommitTreeOpts{
+		Parents:    parents,
+		Message:    message,
+		KeyID:      opts.SigningKey,
+		AlwaysSign: opts.Sign,
+		NoGPGSign:  !opts.Sign,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to amend commit %s: %w", oldID, err)
+	}
+	if strings.HasPrefix(ref, "refs/") {
+		if err := repo.updateRef(ref, newID.String(), oldID, "amend: "+commit.Summary()); err != nil {
+			return nil, err
+		}
+	}
+	return newID, nil
+}
@@ -0,0 +1,52 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository_AmendCommit(t *testing.T) {
+	repoPath := filepath.Join(t.TempDir(), "repo.git")
+	assert.NoError(t, Clone(DefaultContext, filepath.Join(testReposDir, "repo1_bare"), repoPath, CloneRepoOptions{Bare: true}))
+	repo, err := openRepositoryWithDefaultContext(repoPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	original, err := repo.GetCommit("2839944139e0de9737a044f78b0e4b40d989a9e3")
+	assert.NoError(t, err)
+
+	id, err := repo.AmendCommit("refs/heads/branch1", AmendCommitOptions{Message: "Edit file1.txt again"})
+	assert.NoError(t, err)
+	commit, err := repo.GetCommit(id.String())
+	assert.NoError(t, err)
+	assert.Equal(t, "Edit file1.txt again\n", commit.CommitMessage)
+	assert.Equal(t, original.Parents, commit.Parents)
+	assert.Equal(t, original.Tree.ID, commit.Tree.ID)
+	assert.Equal(t, original.Author.Name, commit.Author.Name)
+	assert.Equal(t, original.Author.When.Unix(), commit.Author.When.Unix())
+	assert.Equal(t, original.Committer.Name, commit.Committer.Name)
+	stdout, _, err := NewCommand(DefaultContext, "rev-parse", "refs/heads/branch1").RunStdString(&RunOpts{Dir: repoPath})
+	assert.NoError(t, err)
+	assert.Equal(t, id.String(), strings.TrimSpace(stdout))
+
+	// a commit id only creates the new commit
+	author := &Signature{Name: "Other", Email: "other@example.com"}
+	id, err = repo.AmendCommit(id.String(), AmendCommitOptions{Author: author, TreeID: "f1a6cb52b2d16773290cefe49ad0684b50a4f930"})
+	assert.NoError(t, err)
+	commit, err = repo.GetCommit(id.String())
+	assert.NoError(t, err)
+	assert.Equal(t, "Edit file1.txt again\n", commit.CommitMessage)
+	assert.Equal(t, "Other", commit.Author.Name)
+	assert.Equal(t, "f1a6cb52b2d16773290cefe49ad0684b50a4f930", commit.Tree.ID.String())
+	assert.Equal(t, original.Parents, commit.Parents)
+
+	_, err = repo.AmendCommit("refs/heads/unknown", AmendCommitOptions{Message: "unknown"})
+	assert.True(t, IsErrNotExist(err))
+}
@@ -38,18 +38,35 @@ func (a ArchiveType) String() string {
 	return "unknown"
 }
 
+// ArchiveOptions options for CreateArchiveWithOptions
+type ArchiveOptions struct {
+	Format ArchiveType
+	// UsePrefix puts the files into a directory named like the repository
+	UsePrefix bool
+	// Paths limits the archive to the given paths
+	Paths []string
+}
+
 // CreateArchive create archive content to the target path
 func (repo *Repository) CreateArchive(ctx context.Context, format ArchiveType, target io.Writer, usePrefix bool, commitID string) error {
-	if format.String() == "unknown" {
-		return fmt.Errorf("unknown format: %v", format)
+	return repo.CreateArchiveWithOptions(ctx, commitID, target, ArchiveOptions{Format: format, UsePrefix: usePrefix})
+}
+
+// CreateArchiveWithOptions writes an archive of the tree of commitID to target
+func (repo *Repository) CreateArchiveWithOptions(ctx context.Context, commitID string, target io.Writer, opts ArchiveOptions) error {
+	if opts.Format.String() == "unknown" {
+		return fmt.Errorf("unknown format: %v", opts.Format)
 	}
 
 	cmd := NewCommand(ctx, "archive")
-	if usePrefix {
+	if opts.UsePrefix {
 		cmd.AddArguments(CmdArg("--prefix=" + filepath.Base(strings.TrimSuffix(repo.Path, ".git")) + "/"))
 	}
-	cmd.AddArguments(CmdArg("--format=" + format.String()))
+	cmd.AddArguments(CmdArg("--format=" + opts.Format.String()))
 	cmd.AddDynamicArguments(commitID)
+	if len(opts.Paths) > 0 {
+		cmd.AddDashesAndList(opts.Paths...)
+	}
 
 	var stderr strings.Builder
 	err := cmd.Run(&RunOpts{
@@ -7,15 +7,21 @@ package git
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/enverbisevac/gitlib/log"
+	"github.com/enverbisevac/gitlib/process"
 )
 
+const defaultCheckAttributeIdleTimeout = time.Minute
+
 // CheckAttributeOpts represents the possible options to CheckAttribute
 type CheckAttributeOpts struct {
 	CachedOnly    bool
@@ -95,6 +101,33 @@ func (repo *Repository) CheckAttribute(opts CheckAttributeOpts) (map[string]map[
 	return name2attribute2info, nil
 }
 
+// Attributes are the git attributes of a path, mapping the name of each checked attribute to
+// "set", "unset", "unspecified" or the value assigned to it
+type Attributes map[string]string
+
+// IsSet returns true if the attribute is set or has the value true
+func (a Attributes) IsSet(name string) bool {
+	return a[name] == "set" || a[name] == "true"
+}
+
+// IsUnset returns true if the attribute is unset or has the value false
+func (a Attributes) IsUnset(name string) bool {
+	return a[name] == "unset" || a[name] == "false"
+}
+
+// Value returns the value assigned to the attribute, it is empty if the attribute has no value
+func (a Attributes) Value(name string) string {
+	switch value := a[name]; value {
+	case "set", "unset", "unspecified":
+		return ""
+	default:
+		return value
+	}
+}
+
+// LinguistAttributes are the attributes used by GetLanguageStats
+var LinguistAttributes = []CmdArg{"linguist-vendored", "linguist-generated", "linguist-language", "gitlab-language"}
+
 // CheckAttributeReader provides a reader for check-attribute content that can be long running
 type CheckAttributeReader struct {
 	// params
@@ -102,6 +135,8 @@ type CheckAttributeReader struct {
 	Repo       *Repository
 	IndexFile  string
 	WorkTree   string
+	// Source reads the attribute files from the tree-ish instead of the index or worktree, needs git >= 2.40
+	Source string
 
 	stdinReader io.ReadCloser
 	stdinWriter *os.File
@@ -110,13 +145,111 @@ type CheckAttributeReader struct {
 	env         []string
 	ctx         context.Context
 	cancel      context.CancelFunc
+
+	// set if the reader is started by NewCheckAttributeReader
+	done      chan struct{}
+	cleanup   func()
+	closeOnce sync.Once
+	closed    bool
+	// repoCtx is the context git is restarted in once the lifecycle stopped it
+	repoCtx   context.Context
+	lifecycle *process.Lifecycle
+}
+
+// NewCheckAttributeReader starts a long running git check-attr reading the attribute files of the commit,
+// checking the given attributes or LinguistAttributes if none are given.
+// The attribute files are read only once per reader, so a reader should be reused for all paths of a commit.
+// The reader must be closed to stop git and remove its temporary files. git is stopped once it was idle for
+// Git.CheckAttribute.IdleTimeout or ran for Git.CheckAttribute.MaxLifetime, and restarted when the reader is used again.
+func (repo *Repository) NewCheckAttributeReader(commitID string, attributes ...CmdArg) (*CheckAttributeReader, error) {
+	if len(attributes) == 0 {
+		attributes = LinguistAttributes
+	}
+	checker := &CheckAttributeReader{
+		Attributes: attributes,
+		Repo:       repo,
+		repoCtx:    repo.Ctx,
+	}
+	if CheckGitVersionAtLeast("2.40") == nil {
+		checker.Source = commitID
+	} else {
+		indexFilename, worktree, deleteTemporaryFile, err := repo.ReadTreeToTemporaryIndex(commitID)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read tree of %s: %w", commitID, err)
+		}
+		checker.IndexFile = indexFilename
+		checker.WorkTree = worktree
+		checker.cleanup = deleteTemporaryFile
+	}
+
+	if err := checker.start(); err != nil {
+		if checker.cleanup != nil {
+			checker.cleanup()
+		}
+		return nil, err
+	}
+	return checker, nil
+}
+
+// start runs git check-attr in the background with a lifecycle stopping it once it expired
+func (c *CheckAttributeReader) start() error {
+	c.env = nil
+	if err := c.Init(c.repoCtx); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	c.done = done
+	go func() {
+		defer close(done)
+		if err := c.Run(); err != nil {
+			log.Error("Unable to check attributes in %s. Error: %v", c.Repo.Path, err)
+		}
+	}()
+
+	opts := process.LifecycleOptions{
+		IdleTimeout: Git.CheckAttribute.IdleTimeout,
+		MaxLifetime: Git.CheckAttribute.MaxLifetime,
+	}
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = defaultCheckAttributeIdleTimeout
+	}
+	c.lifecycle = process.NewLifecycle(c.repoCtx, opts, c.cancel)
+	return nil
+}
+
+// acquire marks git as in use, restarting it if the lifecycle stopped it
+func (c *CheckAttributeReader) acquire() error {
+	if c.lifecycle == nil || c.lifecycle.Acquire() {
+		return nil
+	}
+	if c.closed {
+		return errors.New("check attribute reader is closed")
+	}
+	if err := c.repoCtx.Err(); err != nil {
+		return err
+	}
+
+	// wait for the stopped git to exit before starting a new one
+	_ = c.stdinWriter.Close()
+	for range c.stdOut.ReadAttribute() {
+	}
+	<-c.done
+	if err := c.start(); err != nil {
+		return err
+	}
+	if !c.lifecycle.Acquire() {
+		return fmt.Errorf("unable to restart git check-attr: %w", c.repoCtx.Err())
+	}
+	return nil
 }
 
 // Init initializes the CheckAttributeReader
 func (c *CheckAttributeReader) Init(ctx context.Context) error {
 	cmdArgs := []CmdArg{"check-attr", "--stdin", "-z"}
 
-	if len(c.IndexFile) > 0 {
+	if len(c.Source) > 0 {
+		cmdArgs = append(cmdArgs, CmdArg("--source="+c.Source))
+	} else if len(c.IndexFile) > 0 {
 		cmdArgs = append(cmdArgs, "--cached")
 		c.env = append(c.env, "GIT_INDEX_FILE="+c.IndexFile)
 	}
@@ -181,13 +314,20 @@ func (c *CheckAttributeReader) Run() error {
 }
 
 // CheckPath check attr for given path
-func (c *CheckAttributeReader) CheckPath(path string) (rs map[string]string, err error) {
+func (c *CheckAttributeReader) CheckPath(path string) (rs Attributes, err error) {
 	defer func() {
 		if err != nil && err != c.ctx.Err() {
 			log.Error("Unexpected error when checking path %s in %s. Error: %v", path, c.Repo.Path, err)
 		}
 	}()
 
+	if err = c.acquire(); err != nil {
+		return nil, err
+	}
+	if c.lifecycle != nil {
+		defer c.lifecycle.Release()
+	}
+
 	select {
 	case <-c.ctx.Done():
 		return nil, c.ctx.Err()
@@ -199,12 +339,15 @@ func (c *CheckAttributeReader) CheckPath(path string) (rs map[string]string, err
 		return nil, err
 	}
 
-	rs = make(map[string]string)
+	rs = make(Attributes)
 	for range c.Attributes {
 		select {
 		case attr, ok := <-c.stdOut.ReadAttribute():
 			if !ok {
-				return nil, c.ctx.Err()
+				if err := c.ctx.Err(); err != nil {
+					return nil, err
+				}
+				return nil, errors.New("git check-attr exited unexpectedly")
 			}
 			rs[attr.Attribute] = attr.Value
 		case <-c.ctx.Done():
@@ -214,10 +357,31 @@ func (c *CheckAttributeReader) CheckPath(path string) (rs map[string]string, err
 	return rs, nil
 }
 
-// Close close pip after use
+// Close close pip after use. If the reader was started by NewCheckAttributeReader,
+// Close also waits for git to exit and removes the temporary files.
 func (c *CheckAttributeReader) Close() error {
-	c.cancel()
-	err := c.stdinWriter.Close()
+	var err error
+	c.closeOnce.Do(func() {
+		c.closed = true
+		if c.lifecycle != nil {
+			c.lifecycle.Stop()
+		}
+		if c.cancel != nil {
+			c.cancel()
+		}
+		if c.stdinWriter != nil {
+			err = c.stdinWriter.Close()
+		}
+		if c.done != nil && c.stdOut != nil {
+			// drain unread attributes so the output of git can be copied until it exits
+			for range c.stdOut.ReadAttribute() {
+			}
+			<-c.done
+		}
+		if c.cleanup != nil {
+			c.cleanup()
+		}
+	})
 	return err
 }
 
@@ -385,36 +549,15 @@ func (wr *lineSeparatedAttributeWriter) Close() error {
 	return nil
 }
 
-// Create a check attribute reader for the current repository and provided commit ID
+// CheckAttributeReader creates a check attribute reader for LinguistAttributes of the provided commit ID,
+// the reader is nil if it can not be started. The returned function closes the reader.
 func (repo *Repository) CheckAttributeReader(commitID string) (*CheckAttributeReader, context.CancelFunc) {
-	indexFilename, worktree, deleteTemporaryFile, err := repo.ReadTreeToTemporaryIndex(commitID)
+	checker, err := repo.NewCheckAttributeReader(commitID)
 	if err != nil {
-		return nil, func() {}
-	}
-
-	checker := &CheckAttributeReader{
-		Attributes: []CmdArg{"linguist-vendored", "linguist-generated", "linguist-language", "gitlab-language"},
-		Repo:       repo,
-		IndexFile:  indexFilename,
-		WorkTree:   worktree,
-	}
-	ctx, cancel := context.WithCancel(repo.Ctx)
-	if err := checker.Init(ctx); err != nil {
 		log.Error("Unable to open checker for %s. Error: %v", commitID, err)
-	} else {
-		go func() {
-			err := checker.Run()
-			if err != nil && err != ctx.Err() {
-				log.Error("Unable to open checker for %s. Error: %v", commitID, err)
-			}
-			cancel()
-		}()
+		return nil, func() {}
 	}
-	deferable := func() {
+	return checker, func() {
 		_ = checker.Close()
-		cancel()
-		deleteTemporaryFile()
 	}
-
-	return checker, deferable
 }
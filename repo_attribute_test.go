@@ -5,6 +5,7 @@
 package git
 
 import (
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -157,3 +158,71 @@ func Test_lineSeparatedAttributeWriter_ReadAttribute(t *testing.T) {
 	assert.Equal(t, "attribute", attr.Attribute)
 	assert.Equal(t, "value", attr.Value)
 }
+
+func TestRepository_NewCheckAttributeReader(t *testing.T) {
+	repo, err := openRepositoryWithDefaultContext(filepath.Join(testReposDir, "language_stats_repo"))
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	checker, err := repo.NewCheckAttributeReader("8fee858da5796dfb37704761701bb8e800ad9ef3")
+	assert.NoError(t, err)
+
+	attrs, err := checker.CheckPath("main.vendor.java")
+	assert.NoError(t, err)
+	assert.True(t, attrs.IsSet("linguist-vendored"))
+	assert.False(t, attrs.IsSet("linguist-generated"))
+	assert.Equal(t, "unspecified", attrs["linguist-generated"])
+
+	attrs, err = checker.CheckPath("i-am-a-python.p")
+	assert.NoError(t, err)
+	assert.Equal(t, "Python", attrs.Value("linguist-language"))
+	assert.Empty(t, attrs.Value("linguist-vendored"))
+
+	// closing with pending output must not block
+	_, err = checker.stdinWriter.Write([]byte("java-hello/main.java\x00"))
+	assert.NoError(t, err)
+	assert.NoError(t, checker.Close())
+	assert.NoError(t, checker.Close())
+
+	_, err = checker.CheckPath("python-hello/hello.py")
+	assert.Error(t, err)
+
+	_, err = repo.NewCheckAttributeReader("0000000000000000000000000000000000000001")
+	assert.Error(t, err)
+}
+
+func TestCheckAttributeReader_IdleTimeout(t *testing.T) {
+	oldCheckAttribute := Git.CheckAttribute
+	Git.CheckAttribute.IdleTimeout = 50 * time.Millisecond
+	defer func() {
+		Git.CheckAttribute = oldCheckAttribute
+	}()
+
+	repo, err := openRepositoryWithDefaultContext(filepath.Join(testReposDir, "repo1_bare"))
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	checker, err := repo.NewCheckAttributeReader("feaf4ba6bc635fec442f46ddd4512416ec43c2c2")
+	assert.NoError(t, err)
+	defer checker.Close()
+
+	attrs, err := checker.CheckPath("file1.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "unspecified", attrs["linguist-vendored"])
+
+	// the idle git is stopped and restarted when the reader is used again
+	lifecycle := checker.lifecycle
+	select {
+	case <-lifecycle.Stopped():
+	case <-time.After(5 * time.Second):
+		assert.FailNow(t, "idle git check-attr was not stopped")
+	}
+	attrs, err = checker.CheckPath("file2.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "unspecified", attrs["linguist-vendored"])
+	assert.NotSame(t, lifecycle, checker.lifecycle)
+
+	assert.NoError(t, checker.Close())
+	_, err = checker.CheckPath("file1.txt")
+	assert.Error(t, err)
+}
@@ -5,17 +5,19 @@
 package git
 
 import (
+	"bufio"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"path/filepath"
+	"sync"
 
 	"github.com/enverbisevac/gitlib/log"
 	"github.com/go-git/go-billy/v5/osfs"
 	gogit "github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing/cache"
 	"github.com/go-git/go-git/v5/storage/filesystem"
-	git2go "github.com/libgit2/git2go/v34"
 )
 
 // contextKey is a value for use with context.WithValue.
@@ -61,18 +63,39 @@ func RepositoryFromContextOrOpen(ctx context.Context, path string) (*Repository,
 type Repository struct {
 	// initialy work with gogit
 	gogit *gogit.Repository
-	// if gogit doesnt have implementation use git2go
-	git2go *git2go.Repository
+	// if gogit doesnt have implementation use git2go, nil when built with the nogit2go tag
+	git2go *libgit2Repository
 
 	Path string
 
-	storage     *filesystem.Storage
-	gpgSettings *GPGSettings
+	storage      *filesystem.Storage
+	objectFormat ObjectFormat
+	gpgSettings  *GPGSettings
 
 	Ctx context.Context
 
 	tagCache        *ObjectCache
 	LastCommitCache *LastCommitCache
+
+	// shared with the views created by WithContext
+	catFile *repositoryCatFile
+}
+
+// repositoryCatFile holds the cat-file processes of a repository, they run within the context the repository was opened with
+type repositoryCatFile struct {
+	ctx        context.Context
+	mu         sync.Mutex
+	batch      *CatFileBatchPool
+	batchCheck *CatFileBatchPool
+}
+
+// WithContext returns a view of the repository whose commands, and those of the commits, trees and blobs read from it,
+// run within ctx, e.g. to apply the deadline of a request. The view shares the storage and cat-file processes of repo,
+// it must not be closed and must not be used once repo is closed.
+func (repo *Repository) WithContext(ctx context.Context) *Repository {
+	view := *repo
+	view.Ctx = ctx
+	return &view
 }
 
 // openRepositoryWithDefaultContext opens the repository at the given path with DefaultContext.
@@ -80,8 +103,72 @@ func openRepositoryWithDefaultContext(repoPath string) (*Repository, error) {
 	return OpenRepository(DefaultContext, repoPath)
 }
 
+type OpenRepositoryConfig struct {
+	objectCacheSize      cache.FileSize
+	largeObjectThreshold *int64
+	keepDescriptors      bool
+	bare                 *bool
+	lastCommitCache      *LastCommitCache
+}
+
+type OpenRepositoryFunc func(c *OpenRepositoryConfig)
+
+func (f OpenRepositoryFunc) Apply(c *OpenRepositoryConfig) {
+	f(c)
+}
+
+// OpenWithObjectCacheSize sets the size in bytes of the cache of the objects read by gogit
+func OpenWithObjectCacheSize(size int64) OpenRepositoryFunc {
+	return func(c *OpenRepositoryConfig) {
+		c.objectCacheSize = cache.FileSize(size)
+	}
+}
+
+// OpenWithLargeObjectThreshold overrides Git.LargeObjectThreshold, larger objects are streamed instead of read to memory
+func OpenWithLargeObjectThreshold(value int64) OpenRepositoryFunc {
+	return func(c *OpenRepositoryConfig) {
+		c.largeObjectThreshold = &value
+	}
+}
+
+// OpenWithKeepDescriptors keeps the packfiles open until the repository is closed, enabled by default.
+// Disabling it reopens them for every read, which saves file descriptors of rarely used repositories.
+func OpenWithKeepDescriptors(value bool) OpenRepositoryFunc {
+	return func(c *OpenRepositoryConfig) {
+		c.keepDescriptors = value
+	}
+}
+
+// OpenWithBare opens the path as git directory if true, or the .git directory inside it if false,
+// instead of checking whether the path contains a .git directory.
+func OpenWithBare(value bool) OpenRepositoryFunc {
+	return func(c *OpenRepositoryConfig) {
+		c.bare = &value
+	}
+}
+
+// OpenWithLastCommitCache attaches the cache as LastCommitCache of the repository,
+// a cache without repository is bound to the opened one.
+func OpenWithLastCommitCache(value *LastCommitCache) OpenRepositoryFunc {
+	return func(c *OpenRepositoryConfig) {
+		c.lastCommitCache = value
+	}
+}
+
+type OpenRepositoryOption interface {
+	Apply(c *OpenRepositoryConfig)
+}
+
 // OpenRepository opens the repository at the given path within the context.Context
-func OpenRepository(ctx context.Context, repoPath string) (*Repository, error) {
+func OpenRepository(ctx context.Context, repoPath string, opts ...OpenRepositoryOption) (*Repository, error) {
+	c := OpenRepositoryConfig{
+		objectCacheSize: cache.DefaultMaxSize,
+		keepDescriptors: true,
+	}
+	for _, opt := range opts {
+		opt.Apply(&c)
+	}
+
 	repoPath, err := filepath.Abs(repoPath)
 	if err != nil {
 		return nil, err
@@ -90,42 +177,79 @@ func OpenRepository(ctx context.Context, repoPath string) (*Repository, error) {
 	}
 
 	fs := osfs.New(repoPath)
-	_, err = fs.Stat(".git")
-	if err == nil {
+	bare := c.bare != nil && *c.bare
+	if c.bare == nil {
+		_, err = fs.Stat(".git")
+		bare = err != nil
+	}
+	if !bare {
+		if _, err := fs.Stat(".git"); err != nil {
+			return nil, fmt.Errorf("unable to open repository %s: %w", repoPath, err)
+		}
 		fs, err = fs.Chroot(".git")
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	largeObjectThreshold := Git.LargeObjectThreshold
+	if c.largeObjectThreshold != nil {
+		largeObjectThreshold = *c.largeObjectThreshold
+	}
+
 	// gogit
 	storage := filesystem.NewStorageWithOptions(
 		fs,
-		cache.NewObjectLRUDefault(),
+		cache.NewObjectLRU(c.objectCacheSize),
 		filesystem.Options{
-			KeepDescriptors:      true,
-			LargeObjectThreshold: Git.LargeObjectThreshold,
+			KeepDescriptors:      c.keepDescriptors,
+			LargeObjectThreshold: largeObjectThreshold,
 		},
 	)
+	cfg, err := storage.Config()
+	if err != nil {
+		return nil, err
+	}
+	objectFormat, err := ObjectFormatFromName(cfg.Raw.Section("extensions").Option("objectformat"))
+	if err != nil {
+		return nil, err
+	}
+
 	gogitrepo, err := gogit.Open(storage, fs)
 	if err != nil {
 		return nil, err
 	}
 
 	//libgit2
-	git2gorepo, err := git2go.OpenRepository(repoPath)
+	git2gorepo, err := openLibgit2Repository(repoPath)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Repository{
-		Path:     repoPath,
-		gogit:    gogitrepo,
-		git2go:   git2gorepo,
-		storage:  storage,
-		tagCache: newObjectCache(),
-		Ctx:      ctx,
-	}, nil
+	repo := &Repository{
+		Path:            repoPath,
+		gogit:           gogitrepo,
+		git2go:          git2gorepo,
+		storage:         storage,
+		objectFormat:    objectFormat,
+		tagCache:        newObjectCache(),
+		Ctx:             ctx,
+		LastCommitCache: c.lastCommitCache,
+		catFile:         &repositoryCatFile{ctx: ctx},
+	}
+	if c.lastCommitCache != nil && c.lastCommitCache.repo == nil {
+		c.lastCommitCache.repo = repo
+	}
+	return repo, nil
+}
+
+// ObjectFormat returns the object format of the repository as set by extensions.objectFormat.
+// The objects of sha256 repositories are read with cat-file and written with the git binary, as gogit only supports sha1.
+func (repo *Repository) ObjectFormat() ObjectFormat {
+	if repo.objectFormat == nil {
+		return Sha1ObjectFormat
+	}
+	return repo.objectFormat
 }
 
 // Close this repository, in particular close the underlying gogitStorage if this is not nil
@@ -136,8 +260,40 @@ func (repo *Repository) Close() (err error) {
 	if err := repo.storage.Close(); err != nil {
 		log.Error("Error closing storage: %v", err)
 	}
+	repo.catFile.mu.Lock()
+	if repo.catFile.batch != nil {
+		repo.catFile.batch.Close()
+	}
+	if repo.catFile.batchCheck != nil {
+		repo.catFile.batchCheck.Close()
+	}
+	repo.catFile.mu.Unlock()
 	repo.LastCommitCache = nil
 	repo.tagCache = nil
 	repo.git2go.Free()
 	return
 }
+
+// CatFileBatch checks out a `git cat-file --batch` process of the repository.
+// The process is kept running for later calls once the returned cancel function is called.
+func (repo *Repository) CatFileBatch(ctx context.Context) (WriteCloserError, *bufio.Reader, func(), error) {
+	repo.catFile.mu.Lock()
+	if repo.catFile.batch == nil {
+		repo.catFile.batch = NewCatFileBatchPool(repo.catFile.ctx, repo.Path, false)
+	}
+	pool := repo.catFile.batch
+	repo.catFile.mu.Unlock()
+	return pool.Get(ctx)
+}
+
+// CatFileBatchCheck checks out a `git cat-file --batch-check` process of the repository.
+// The process is kept running for later calls once the returned cancel function is called.
+func (repo *Repository) CatFileBatchCheck(ctx context.Context) (WriteCloserError, *bufio.Reader, func(), error) {
+	repo.catFile.mu.Lock()
+	if repo.catFile.batchCheck == nil {
+		repo.catFile.batchCheck = NewCatFileBatchPool(repo.catFile.ctx, repo.Path, true)
+	}
+	pool := repo.catFile.batchCheck
+	repo.catFile.mu.Unlock()
+	return pool.Get(ctx)
+}
@@ -4,7 +4,13 @@
 
 package git
 
-import "fmt"
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
 
 // FileBlame return the Blame object of file
 func (repo *Repository) FileBlame(revision, path, file string) ([]byte, error) {
@@ -21,8 +27,76 @@ func (repo *Repository) LineBlame(revision, path, file string, line uint) (*Comm
 	if err != nil {
 		return nil, err
 	}
-	if len(res) < 40 {
+	// the first line starts with the commit id
+	id, _, _ := strings.Cut(res, " ")
+	if !repo.ObjectFormat().IsValid(id) {
 		return nil, fmt.Errorf("invalid result of blame: %s", res)
 	}
-	return repo.GetCommit(res[:40])
+	return repo.GetCommit(id)
+}
+
+// BlameOptions represents the possible options to Blame
+type BlameOptions struct {
+	// StartLine and EndLine limit the blame to a range of lines, 0 means unbounded
+	StartLine int
+	EndLine   int
+	// IgnoreWhitespace ignores whitespace changes when looking for the commit which changed a line
+	IgnoreWhitespace bool
+	// Mailmap maps the authors and committers of the commits to their canonical identities
+	Mailmap *Mailmap
+}
+
+// Blame returns the blame hunks of the file at the given revision.
+// The output of git blame is parsed while it is being read so large files are not buffered in memory twice.
+func (repo *Repository) Blame(ctx context.Context, rev, file string, opts BlameOptions) ([]*BlameHunk, error) {
+	cmd := NewCommand(ctx, "blame", "--porcelain")
+	if opts.IgnoreWhitespace {
+		cmd.AddArguments("-w")
+	}
+	if opts.StartLine > 0 || opts.EndLine > 0 {
+		start, end := opts.StartLine, ""
+		if start <= 0 {
+			start = 1
+		}
+		if opts.EndLine > 0 {
+			end = fmt.Sprint(opts.EndLine)
+		}
+		cmd.AddArguments(CmdArg(fmt.Sprintf("-L%d,%s", start, end)))
+	}
+	cmd.AddDynamicArguments(rev).AddDashesAndList(file)
+
+	stdoutReader, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = stdoutReader.Close()
+		_ = stdoutWriter.Close()
+	}()
+
+	var hunks []*BlameHunk
+	mapped := make(map[*BlameCommit]bool)
+	stderr := new(strings.Builder)
+	err = cmd.Run(&RunOpts{
+		Dir:    repo.Path,
+		Stdout: stdoutWriter,
+		Stderr: stderr,
+		PipelineFunc: func(ctx context.Context, cancel context.CancelFunc) error {
+			_ = stdoutWriter.Close()
+			return parseBlamePorcelain(bufio.NewReader(stdoutReader), repo.ObjectFormat(), func(hunk *BlameHunk) error {
+				// hunks of the same commit share the BlameCommit
+				if opts.Mailmap != nil && !mapped[hunk.Commit] {
+					hunk.Commit.Author = opts.Mailmap.ResolveSignature(hunk.Commit.Author)
+					hunk.Commit.Committer = opts.Mailmap.ResolveSignature(hunk.Commit.Committer)
+					mapped[hunk.Commit] = true
+				}
+				hunks = append(hunks, hunk)
+				return nil
+			})
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to blame %s at %s: %w", file, rev, ConcatenateError(err, stderr.String()))
+	}
+	return hunks, nil
 }
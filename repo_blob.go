@@ -4,23 +4,24 @@
 
 package git
 
-import "github.com/go-git/go-git/v5/plumbing"
-
-func (repo *Repository) getBlob(id SHA1) (*Blob, error) {
-	encodedObj, err := repo.gogit.Storer.EncodedObject(plumbing.AnyObject, id)
-	if err != nil {
+func (repo *Repository) getBlob(id ObjectID) (*Blob, error) {
+	_, size, err := repo.statObject(id)
+	if IsErrNotExist(err) {
 		return nil, ErrNotExist{id.String(), ""}
+	} else if err != nil {
+		return nil, err
 	}
 
 	return &Blob{
-		ID:  id,
-		obj: encodedObj,
+		ID:   id,
+		repo: repo,
+		size: size,
 	}, nil
 }
 
 // GetBlob finds the blob object in the repository.
 func (repo *Repository) GetBlob(idStr string) (*Blob, error) {
-	id, err := NewIDFromString(idStr)
+	id, err := repo.ObjectFormat().NewIDFromString(idStr)
 	if err != nil {
 		return nil, err
 	}
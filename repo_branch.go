@@ -9,8 +9,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/enverbisevac/gitlib/foreachref"
+	"github.com/enverbisevac/gitlib/util"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
@@ -30,10 +35,41 @@ const PullRequestPrefix = "refs/for/"
 type Branch struct {
 	Name string
 	Path string
+	// Commit is the tip of the branch, it is only set by ListBranches with WithCommit
+	Commit *BranchCommit
 
 	gitRepo *Repository
 }
 
+// BranchCommit contains the details of the tip commit of a branch
+type BranchCommit struct {
+	ID        ObjectID
+	Author    *Signature
+	Committer *Signature
+	Summary   string
+}
+
+// Sort orders of ListBranches and GetSortedBranchNames
+const (
+	BranchSortName     = "refname"
+	BranchSortNameDesc = "-refname"
+	// BranchSortCommitterDate sorts the most recently committed branches first
+	BranchSortCommitterDate = "-committerdate"
+)
+
+// ListBranchesOptions options for listing branches with ListBranches
+type ListBranchesOptions struct {
+	// Skip and Limit paginate the sorted branches, a zero Limit returns all remaining branches
+	Skip  int
+	Limit int
+	// Sort is BranchSortName (default), BranchSortCommitterDate or any other for-each-ref sort key
+	Sort string
+	// Patterns only lists branches whose name matches one of the globs, e.g. "release/*"
+	Patterns []string
+	// WithCommit loads the tip commit of each branch
+	WithCommit bool
+}
+
 // GetHEADBranch returns corresponding branch of HEAD.
 func (repo *Repository) GetHEADBranch() (*Branch, error) {
 	if repo == nil {
@@ -58,6 +94,16 @@ func (repo *Repository) GetHEADBranch() (*Branch, error) {
 
 // SetDefaultBranch sets default branch of repository.
 func (repo *Repository) SetDefaultBranch(name string) error {
+	if skipDryRun(repo.Ctx, "set default branch %s [repo_path: %s]", name, repo.Path) {
+		return nil
+	}
+	if repo.backendFor(OperationReferences, BackendGoGit, BackendCLI) == BackendCLI {
+		if _, stderr, err := NewCommand(repo.Ctx, "update-ref").AddDynamicArguments(BranchPrefix+name, "HEAD").
+			RunStdString(&RunOpts{Dir: repo.Path, Retry: lockRetry()}); err != nil {
+			return fmt.Errorf("unable to set default branch %s: %w", name, ConcatenateError(err, stderr))
+		}
+		return nil
+	}
 	headRef, err := repo.gogit.Head()
 	if err != nil {
 		return err
@@ -107,21 +153,148 @@ func GetBranchesByPath(ctx context.Context, path string, skip, limit int) ([]*Br
 
 // GetBranches returns a slice of *git.Branch
 func (repo *Repository) GetBranches(skip, limit int) ([]*Branch, int, error) {
-	brs, countAll, err := repo.GetBranchNames(skip, limit)
+	return repo.ListBranches(ListBranchesOptions{Skip: skip, Limit: limit})
+}
+
+// ListBranches returns the branches matching opts and the total count of matching branches,
+// reading all requested details with a single git for-each-ref.
+func (repo *Repository) ListBranches(opts ListBranchesOptions) ([]*Branch, int, error) {
+	var branches []*Branch
+	count := 0
+	err := repo.walkBranches(opts.Sort, opts.Patterns, opts.WithCommit, func(branch *Branch) error {
+		count++
+		if count > opts.Skip && (opts.Limit == 0 || count <= opts.Skip+opts.Limit) {
+			branches = append(branches, branch)
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, 0, err
 	}
+	return branches, count, nil
+}
 
-	branches := make([]*Branch, len(brs))
-	for i := range brs {
-		branches[i] = &Branch{
+// IterateBranches calls fn for each branch matching the glob pattern, e.g. "release/*", in the
+// order of their names while streaming them from git. An empty pattern matches all branches.
+// Iteration stops at the first error returned by fn, which is returned by IterateBranches.
+func (repo *Repository) IterateBranches(pattern string, fn func(Branch) error) error {
+	var patterns []string
+	if pattern != "" {
+		patterns = []string{pattern}
+	}
+	return repo.walkBranches(BranchSortName, patterns, false, func(branch *Branch) error {
+		return fn(*branch)
+	})
+}
+
+// GetMergedBranches returns the names of the branches whose tip is reachable from target,
+// i.e. which are fully merged into target. A branch named target itself is not returned.
+func (repo *Repository) GetMergedBranches(target string) ([]string, error) {
+	stdout, stderr, err := NewCommand(repo.Ctx, "for-each-ref", "--format=%(refname)").
+		AddOptionFormat("--merged=%s", target).AddDynamicArguments(BranchPrefix).RunStdString(&RunOpts{Dir: repo.Path})
+	if err != nil {
+		if strings.Contains(stderr, "malformed object name") {
+			return nil, ErrNotExist{ID: target}
+		}
+		return nil, fmt.Errorf("unable to get branches merged into %s: %w", target, ConcatenateError(err, stderr))
+	}
+
+	var branches []string
+	for _, ref := range strings.Split(strings.TrimSpace(stdout), "\n") {
+		name := strings.TrimPrefix(ref, BranchPrefix)
+		if ref == "" || name == target || ref == target {
+			continue
+		}
+		branches = append(branches, name)
+	}
+	return branches, nil
+}
+
+var errStopWalkBranches = errors.New("stop walking branches")
+
+// GetStaleBranches returns the branches whose tip was committed before the given time, oldest first.
+// The tip commits of the returned branches are loaded.
+func (repo *Repository) GetStaleBranches(before time.Time) ([]*Branch, error) {
+	var branches []*Branch
+	err := repo.walkBranches("committerdate", nil, true, func(branch *Branch) error {
+		if !branch.Commit.Committer.When.Before(before) {
+			return errStopWalkBranches
+		}
+		branches = append(branches, branch)
+		return nil
+	})
+	if err != nil && err != errStopWalkBranches {
+		return nil, err
+	}
+	return branches, nil
+}
+
+// walkBranches streams the branches matching the patterns sorted by sortKey from git for-each-ref
+func (repo *Repository) walkBranches(sortKey string, patterns []string, withCommit bool, fn func(*Branch) error) error {
+	fields := []string{"refname"}
+	if withCommit {
+		fields = append(fields, "objectname", "author", "committer", "contents:subject")
+	}
+	forEachRefFmt := foreachref.NewFormat(fields...)
+
+	if sortKey == "" {
+		sortKey = BranchSortName
+	}
+	cmd := NewCommand(repo.Ctx, "for-each-ref", CmdArg("--format="+forEachRefFmt.Flag())).AddOptionFormat("--sort=%s", sortKey)
+	if len(patterns) == 0 {
+		cmd.AddDynamicArguments(BranchPrefix)
+	}
+	for _, pattern := range patterns {
+		cmd.AddDynamicArguments(BranchPrefix + pattern)
+	}
+
+	stdoutReader, err := cmd.RunWithStdoutReader(&RunOpts{Dir: repo.Path})
+	if err != nil {
+		return err
+	}
+	defer stdoutReader.Close()
+
+	parser := forEachRefFmt.Parser(stdoutReader)
+	for {
+		ref := parser.Next()
+		if ref == nil {
+			break
+		}
+
+		branch := &Branch{
+			Name:    strings.TrimPrefix(ref["refname"], BranchPrefix),
 			Path:    repo.Path,
-			Name:    brs[i],
 			gitRepo: repo,
 		}
+		if withCommit {
+			commit, err := parseBranchCommit(ref)
+			if err != nil {
+				return fmt.Errorf("unable to parse branch %s: %w", ref["refname"], err)
+			}
+			branch.Commit = commit
+		}
+		if err := fn(branch); err != nil {
+			return err
+		}
+	}
+	if err := parser.Err(); err != nil {
+		return fmt.Errorf("unable to list branches: %w", err)
 	}
+	return nil
+}
 
-	return branches, countAll, nil
+func parseBranchCommit(ref map[string]string) (commit *BranchCommit, err error) {
+	commit = &BranchCommit{Summary: ref["contents:subject"]}
+	if commit.ID, err = NewObjectIDFromString(ref["objectname"]); err != nil {
+		return nil, err
+	}
+	if commit.Author, err = newSignatureFromCommitline([]byte(ref["author"])); err != nil {
+		return nil, fmt.Errorf("parse author: %w", err)
+	}
+	if commit.Committer, err = newSignatureFromCommitline([]byte(ref["committer"])); err != nil {
+		return nil, fmt.Errorf("parse committer: %w", err)
+	}
+	return commit, nil
 }
 
 // DeleteBranchOptions Option(s) for delete branch
@@ -131,6 +304,9 @@ type DeleteBranchOptions struct {
 
 // DeleteBranch delete a branch by name on repository.
 func (repo *Repository) DeleteBranch(name string, opts DeleteBranchOptions) error {
+	if skipDryRun(repo.Ctx, "delete branch %s (force: %t) [repo_path: %s]", name, opts.Force, repo.Path) {
+		return nil
+	}
 	cmd := NewCommand(repo.Ctx, "branch")
 
 	if opts.Force {
@@ -147,6 +323,20 @@ func (repo *Repository) DeleteBranch(name string, opts DeleteBranchOptions) erro
 
 // CreateBranch create a new branch
 func (repo *Repository) CreateBranch(branch, oldbranchOrCommit string) error {
+	if skipDryRun(repo.Ctx, "create branch %s from %s [repo_path: %s]", branch, oldbranchOrCommit, repo.Path) {
+		return nil
+	}
+	if repo.backendFor(OperationConfig, BackendGoGit, BackendCLI) == BackendCLI {
+		key := "branch." + branch + ".merge"
+		if _, _, err := NewCommand(repo.Ctx, "config", "--get-regexp").AddDynamicArguments("^" + regexp.QuoteMeta("branch."+branch+".")).
+			RunStdString(&RunOpts{Dir: repo.Path}); err == nil {
+			return git.ErrBranchExists
+		}
+		if _, stderr, err := NewCommand(repo.Ctx, "config").AddDynamicArguments(key, oldbranchOrCommit).RunStdString(&RunOpts{Dir: repo.Path}); err != nil {
+			return fmt.Errorf("unable to create branch %s: %w", branch, ConcatenateError(err, stderr))
+		}
+		return nil
+	}
 	return repo.gogit.CreateBranch(&config.Branch{
 		Name:  branch,
 		Merge: plumbing.ReferenceName(oldbranchOrCommit),
@@ -155,6 +345,19 @@ func (repo *Repository) CreateBranch(branch, oldbranchOrCommit string) error {
 
 // AddRemote adds a new remote to repository.
 func (repo *Repository) AddRemote(name, url string, fetch bool) error {
+	if skipDryRun(repo.Ctx, "add remote %s %s (fetch: %t) [repo_path: %s]", name, util.SanitizeCredentialURLs(url), fetch, repo.Path) {
+		return nil
+	}
+	if repo.backendFor(OperationConfig, BackendGoGit, BackendCLI) == BackendCLI {
+		cmd := NewCommand(repo.Ctx, "remote", "add")
+		if fetch {
+			cmd.AddArguments("-f")
+		}
+		if _, stderr, err := cmd.AddDashesAndList(name, url).RunStdString(&RunOpts{Dir: repo.Path}); err != nil {
+			return fmt.Errorf("unable to add remote %s: %w", name, util.SanitizeErrorCredentialURLs(ConcatenateError(err, stderr)))
+		}
+		return nil
+	}
 	r, err := repo.gogit.CreateRemote(&config.RemoteConfig{
 		Name: name,
 		URLs: []string{url},
@@ -172,6 +375,9 @@ func (repo *Repository) AddRemote(name, url string, fetch bool) error {
 
 // RemoveRemote removes a remote from repository.
 func (repo *Repository) RemoveRemote(name string) error {
+	if skipDryRun(repo.Ctx, "remove remote %s [repo_path: %s]", name, repo.Path) {
+		return nil
+	}
 	_, _, err := NewCommand(repo.Ctx, "remote", "rm").AddDynamicArguments(name).RunStdString(&RunOpts{Dir: repo.Path})
 	return err
 }
@@ -183,16 +389,94 @@ func (branch *Branch) GetCommit() (*Commit, error) {
 
 // RenameBranch rename a branch
 func (repo *Repository) RenameBranch(from, to string) error {
+	if skipDryRun(repo.Ctx, "rename branch %s to %s [repo_path: %s]", from, to, repo.Path) {
+		return nil
+	}
 	_, _, err := NewCommand(repo.Ctx, "branch", "-m").AddDynamicArguments(from, to).RunStdString(&RunOpts{Dir: repo.Path})
 	return err
 }
 
+// BranchTracking is the upstream a branch is tracking, as configured by branch.<name>.remote and branch.<name>.merge
+type BranchTracking struct {
+	// Remote is the name of the remote, e.g. origin
+	Remote string
+	// RemoteRef is the reference on the remote, e.g. refs/heads/main
+	RemoteRef string
+	// Upstream is the local remote-tracking reference, e.g. refs/remotes/origin/main
+	Upstream string
+	// Gone is true if the upstream reference does not exist (anymore), Ahead and Behind are 0 then
+	Gone bool
+	// Ahead and Behind are the number of commits the branch is ahead or behind its upstream
+	Ahead  int
+	Behind int
+}
+
+// GetBranchTracking returns the upstream the branch is tracking and its divergence from it.
+// It returns nil if no upstream is configured for the branch.
+func (repo *Repository) GetBranchTracking(branch string) (*BranchTracking, error) {
+	stdout, stderr, err := NewCommand(repo.Ctx, "for-each-ref",
+		"--format=%(refname)%00%(upstream:remotename)%00%(upstream:remoteref)%00%(upstream)%00%(upstream:track,nobracket)").
+		AddDynamicArguments(BranchPrefix + branch).RunStdString(&RunOpts{Dir: repo.Path})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get tracking of branch %s: %w", branch, ConcatenateError(err, stderr))
+	}
+
+	for _, line := range strings.Split(stdout, "\n") {
+		fields := strings.Split(line, "\x00")
+		// the pattern also matches branches below branch, e.g. refs/heads/feature/x for feature
+		if len(fields) != 5 || fields[0] != BranchPrefix+branch {
+			continue
+		}
+		if fields[1] == "" || fields[2] == "" {
+			return nil, nil
+		}
+		tracking := &BranchTracking{Remote: fields[1], RemoteRef: fields[2], Upstream: fields[3]}
+		if err := parseUpstreamTrack(fields[4], tracking); err != nil {
+			return nil, err
+		}
+		return tracking, nil
+	}
+	return nil, ErrBranchNotExist{branch}
+}
+
+// parseUpstreamTrack parses %(upstream:track,nobracket), e.g. "ahead 1, behind 2" or "gone"
+func parseUpstreamTrack(track string, tracking *BranchTracking) error {
+	if track == "gone" {
+		tracking.Gone = true
+		return nil
+	}
+	for _, part := range strings.Split(track, ", ") {
+		if part == "" {
+			continue
+		}
+		kind, count, _ := strings.Cut(part, " ")
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return fmt.Errorf("invalid upstream track %q: %w", track, err)
+		}
+		switch kind {
+		case "ahead":
+			tracking.Ahead = n
+		case "behind":
+			tracking.Behind = n
+		default:
+			return fmt.Errorf("invalid upstream track %q", track)
+		}
+	}
+	return nil
+}
+
 // IsObjectExist returns true if given reference exists in the repository.
 func (repo *Repository) IsObjectExist(name string) bool {
 	if name == "" {
 		return false
 	}
 
+	if repo.backendFor(OperationObjects, BackendGoGit, BackendCLI) == BackendCLI {
+		_, _, err := NewCommand(repo.Ctx, "rev-parse", "--verify", "--quiet").AddDynamicArguments(name).RunStdString(&RunOpts{Dir: repo.Path})
+		return err == nil
+	}
+
 	_, err := repo.gogit.ResolveRevision(plumbing.Revision(name))
 
 	return err == nil
@@ -204,6 +488,11 @@ func (repo *Repository) IsReferenceExist(name string) bool {
 		return false
 	}
 
+	if repo.backendFor(OperationReferences, BackendGoGit, BackendCLI) == BackendCLI {
+		_, err := repo.showRef(name)
+		return err == nil
+	}
+
 	reference, err := repo.gogit.Reference(plumbing.ReferenceName(name), true)
 	if err != nil {
 		return false
@@ -216,40 +505,27 @@ func (repo *Repository) IsBranchExist(name string) bool {
 	if name == "" {
 		return false
 	}
-	reference, err := repo.gogit.Reference(plumbing.ReferenceName(BranchPrefix+name), true)
-	if err != nil {
-		return false
-	}
-	return reference.Type() != plumbing.InvalidReference
+	return repo.IsReferenceExist(BranchPrefix + name)
 }
 
-// GetBranches returns branches from the repository, skipping skip initial branches and
+// GetBranchNames returns the names of the branches sorted by name, skipping skip initial branches and
 // returning at most limit branches, or all branches if limit is 0.
 func (repo *Repository) GetBranchNames(skip, limit int) ([]string, int, error) {
-	var branchNames []string
+	return repo.GetSortedBranchNames(BranchSortName, skip, limit)
+}
 
-	branches, err := repo.gogit.Branches()
+// GetSortedBranchNames is like GetBranchNames but sorts the branches by sortKey, e.g. BranchSortNameDesc
+// or BranchSortCommitterDate. The sorting is done by git for-each-ref without loading the commits.
+func (repo *Repository) GetSortedBranchNames(sortKey string, skip, limit int) ([]string, int, error) {
+	refs, count, err := repo.ListRefNames(ListRefsOptions{Prefix: BranchPrefix, Sort: sortKey, Skip: skip, Limit: limit})
 	if err != nil {
 		return nil, 0, err
 	}
 
-	i := 0
-	count := 0
-	_ = branches.ForEach(func(branch *plumbing.Reference) error {
-		count++
-		if i < skip {
-			i++
-			return nil
-		} else if limit != 0 && count > skip+limit {
-			return nil
-		}
-
-		branchNames = append(branchNames, strings.TrimPrefix(branch.Name().String(), BranchPrefix))
-		return nil
-	})
-
-	// TODO: Sort?
-
+	branchNames := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		branchNames = append(branchNames, strings.TrimPrefix(ref, BranchPrefix))
+	}
 	return branchNames, count, nil
 }
 
@@ -266,24 +542,38 @@ func WalkReferences(ctx context.Context, repoPath string, walkfn func(sha1, refn
 		defer repo.Close()
 	}
 
-	i := 0
-	iter, err := repo.gogit.References()
-	if err != nil {
-		return i, err
-	}
-	defer iter.Close()
-
-	err = iter.ForEach(func(ref *plumbing.Reference) error {
-		err := walkfn(ref.Hash().String(), string(ref.Name()))
-		i++
-		return err
-	})
-	return i, err
+	return repo.WalkReferences("", 0, 0, walkfn)
 }
 
 // WalkReferences walks all the references from the repository
 func (repo *Repository) WalkReferences(arg ObjectType, skip, limit int, walkfn func(sha1, refname string) error) (int, error) {
 	i := 0
+	if repo.backendFor(OperationReferences, BackendGoGit, BackendCLI) == BackendCLI {
+		var dirs []string
+		switch arg {
+		case ObjectTag:
+			dirs = []string{TagPrefix}
+		case ObjectBranch:
+			dirs = []string{BranchPrefix}
+		}
+		err := repo.walkRefsWithGit(func(id, _, name string) error {
+			if i < skip {
+				i++
+				return nil
+			}
+			err := walkfn(id, name)
+			i++
+			if err != nil {
+				return err
+			}
+			if limit != 0 && i >= skip+limit {
+				return storer.ErrStop
+			}
+			return nil
+		}, dirs...)
+		return i, err
+	}
+
 	var iter storer.ReferenceIter
 	var err error
 	switch arg {
@@ -320,6 +610,15 @@ func (repo *Repository) WalkReferences(arg ObjectType, skip, limit int, walkfn f
 // GetRefsBySha returns all references filtered with prefix that belong to a sha commit hash
 func (repo *Repository) GetRefsBySha(sha, prefix string) ([]string, error) {
 	var revList []string
+	if repo.backendFor(OperationReferences, BackendGoGit, BackendCLI) == BackendCLI {
+		err := repo.walkRefsWithGit(func(id, _, name string) error {
+			if id == sha && strings.HasPrefix(name, prefix) {
+				revList = append(revList, name)
+			}
+			return nil
+		})
+		return revList, err
+	}
 	iter, err := repo.gogit.References()
 	if err != nil {
 		return nil, err
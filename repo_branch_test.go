@@ -5,8 +5,10 @@
 package git
 
 import (
+	"errors"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -39,6 +41,153 @@ func TestRepository_GetBranches(t *testing.T) {
 	assert.ElementsMatch(t, []string{}, branches)
 }
 
+func TestRepository_GetSortedBranchNames(t *testing.T) {
+	bareRepo1Path := filepath.Join(testReposDir, "repo1_bare")
+	bareRepo1, err := openRepositoryWithDefaultContext(bareRepo1Path)
+	assert.NoError(t, err)
+	defer bareRepo1.Close()
+
+	branches, countAll, err := bareRepo1.GetSortedBranchNames(BranchSortNameDesc, 0, 0)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, countAll)
+	assert.Equal(t, []string{"master", "branch2", "branch1"}, branches)
+
+	branches, countAll, err = bareRepo1.GetSortedBranchNames(BranchSortCommitterDate, 1, 1)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, countAll)
+	assert.Equal(t, []string{"branch2"}, branches)
+}
+
+func TestRepository_ListBranches(t *testing.T) {
+	bareRepo1Path := filepath.Join(testReposDir, "repo1_bare")
+	bareRepo1, err := openRepositoryWithDefaultContext(bareRepo1Path)
+	assert.NoError(t, err)
+	defer bareRepo1.Close()
+
+	branches, countAll, err := bareRepo1.ListBranches(ListBranchesOptions{Sort: BranchSortCommitterDate, WithCommit: true})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, countAll)
+	if assert.Len(t, branches, 3) {
+		assert.Equal(t, "master", branches[0].Name)
+		assert.Equal(t, "branch2", branches[1].Name)
+		assert.Equal(t, "branch1", branches[2].Name)
+
+		commit := branches[2].Commit
+		if assert.NotNil(t, commit) {
+			assert.Equal(t, "2839944139e0de9737a044f78b0e4b40d989a9e3", commit.ID.String())
+			assert.Equal(t, "Edit file1.txt", commit.Summary)
+			assert.NotEmpty(t, commit.Author.Name)
+			assert.False(t, commit.Committer.When.IsZero())
+		}
+	}
+
+	branches, countAll, err = bareRepo1.ListBranches(ListBranchesOptions{Patterns: []string{"branch*"}, Skip: 1})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, countAll)
+	if assert.Len(t, branches, 1) {
+		assert.Equal(t, "branch2", branches[0].Name)
+		assert.Nil(t, branches[0].Commit)
+	}
+}
+
+func TestRepository_IterateBranches(t *testing.T) {
+	bareRepo1Path := filepath.Join(testReposDir, "repo1_bare")
+	bareRepo1, err := openRepositoryWithDefaultContext(bareRepo1Path)
+	assert.NoError(t, err)
+	defer bareRepo1.Close()
+
+	var names []string
+	err = bareRepo1.IterateBranches("branch*", func(branch Branch) error {
+		names = append(names, branch.Name)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"branch1", "branch2"}, names)
+
+	errStop := errors.New("stop")
+	names = nil
+	err = bareRepo1.IterateBranches("", func(branch Branch) error {
+		names = append(names, branch.Name)
+		return errStop
+	})
+	assert.ErrorIs(t, err, errStop)
+	assert.Equal(t, []string{"branch1"}, names)
+}
+
+func TestRepository_GetMergedBranches(t *testing.T) {
+	clonedPath, err := cloneRepo(t, filepath.Join(testReposDir, "repo1_bare"))
+	assert.NoError(t, err)
+	repo, err := openRepositoryWithDefaultContext(clonedPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	assert.NoError(t, repo.updateRef(BranchPrefix+"merged", "37991dec2c8e592043f47155ce4808d4580f9123", "", "test"))
+	assert.NoError(t, repo.updateRef(BranchPrefix+"branch1", "2839944139e0de9737a044f78b0e4b40d989a9e3", "", "test"))
+
+	branches, err := repo.GetMergedBranches("master")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"merged"}, branches)
+
+	_, err = repo.GetMergedBranches("no-such-branch")
+	assert.True(t, IsErrNotExist(err))
+}
+
+func TestRepository_GetStaleBranches(t *testing.T) {
+	bareRepo1Path := filepath.Join(testReposDir, "repo1_bare")
+	bareRepo1, err := openRepositoryWithDefaultContext(bareRepo1Path)
+	assert.NoError(t, err)
+	defer bareRepo1.Close()
+
+	branches, err := bareRepo1.GetStaleBranches(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	if assert.Len(t, branches, 2) {
+		assert.Equal(t, "branch1", branches[0].Name)
+		assert.Equal(t, "branch2", branches[1].Name)
+		assert.NotNil(t, branches[0].Commit)
+	}
+
+	branches, err = bareRepo1.GetStaleBranches(time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.Empty(t, branches)
+}
+
+func TestRepository_GetBranchTracking(t *testing.T) {
+	clonedPath, err := cloneRepo(t, filepath.Join(testReposDir, "repo1_bare"))
+	assert.NoError(t, err)
+	repo, err := openRepositoryWithDefaultContext(clonedPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	// move master one commit behind origin/master
+	assert.NoError(t, repo.updateRef(BranchPrefix+"master", "37991dec2c8e592043f47155ce4808d4580f9123", "feaf4ba6bc635fec442f46ddd4512416ec43c2c2", "test"))
+	tracking, err := repo.GetBranchTracking("master")
+	assert.NoError(t, err)
+	assert.Equal(t, &BranchTracking{
+		Remote:    "origin",
+		RemoteRef: "refs/heads/master",
+		Upstream:  "refs/remotes/origin/master",
+		Behind:    1,
+	}, tracking)
+
+	_, _, err = NewCommand(DefaultContext, "config", "branch.master.merge", "refs/heads/gone").RunStdString(&RunOpts{Dir: clonedPath})
+	assert.NoError(t, err)
+	tracking, err = repo.GetBranchTracking("master")
+	assert.NoError(t, err)
+	if assert.NotNil(t, tracking) {
+		assert.True(t, tracking.Gone)
+		assert.Equal(t, "refs/remotes/origin/gone", tracking.Upstream)
+	}
+
+	_, _, err = NewCommand(DefaultContext, "branch", "local", "master").RunStdString(&RunOpts{Dir: clonedPath})
+	assert.NoError(t, err)
+	tracking, err = repo.GetBranchTracking("local")
+	assert.NoError(t, err)
+	assert.Nil(t, tracking)
+
+	_, err = repo.GetBranchTracking("no-such-branch")
+	assert.True(t, IsErrBranchNotExist(err))
+}
+
 func BenchmarkRepository_GetBranches(b *testing.B) {
 	bareRepo1Path := filepath.Join(testReposDir, "repo1_bare")
 	bareRepo1, err := openRepositoryWithDefaultContext(bareRepo1Path)
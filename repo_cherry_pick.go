@@ -0,0 +1,167 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrEmptyCherryPick is returned if the changes of the commit already exist on the target
+var ErrEmptyCherryPick = errors.New("cherry-pick results in an empty commit")
+
+// CherryPickOptions options for CherryPick
+type CherryPickOptions struct {
+	// Mainline is the 1-based parent of a merge commit whose changes are picked
+	Mainline int
+	// Message replaces the message of the picked commit
+	Message string
+	// AppendSource appends "(cherry picked from commit <id>)" to the message
+	AppendSource bool
+	AllowEmpty   bool
+}
+
+// CherryPick applies the changes of commitID onto ontoRef using a three-way merge without a worktree,
+// and creates a new commit with the author of the picked commit. If ontoRef is a full ref name like
+// "refs/heads/main" the ref is updated to the new commit, as long as it was not changed in the meantime.
+// A cherry-pick which does not apply cleanly returns ErrCherryPickConflict.
+func (repo *Repository) CherryPick(commitID, ontoRef string, committer *Signature, opts CherryPickOptions) (ObjectID, error) {
+	commit, err := repo.GetCommit(commitID)
+	if err != nil {
+		return nil, err
+	}
+	onto, err := repo.resolveCommitID(ontoRef)
+	if err != nil {
+		return nil, err
+	}
+
+	newID, err := repo.cherryPick(commit, onto, committer, opts)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(ontoRef, "refs/") {
+		if err := repo.updateRef(ontoRef, newID.String(), onto, "cherry-pick: "+commit.Summary()); err != nil {
+			return nil, err
+		}
+	}
+	return newID, nil
+}
+
+// CherryCommit is a commit of head as reported by Cherry
+type CherryCommit struct {
+	ID ObjectID
+	// Applied is true if a commit with the same changes (by patch id) already exists in upstream
+	Applied bool
+}
+
+// Cherry returns the commits of head which are not in upstream, oldest first, and whether an equivalent
+// commit has already been applied to upstream, e.g. by a cherry-pick or rebase.
+func (repo *Repository) Cherry(upstream, head string) ([]*CherryCommit, error) {
+	stdout, stderr, err := NewCommand(repo.Ctx, "cherry").AddDynamicArguments(upstream, head).RunStdString(&RunOpts{Dir: repo.Path})
+	if err != nil {
+		if _, rev, ok := strings.Cut(strings.ToLower(stderr), "unknown commit "); ok {
+			return nil, ErrNotExist{ID: strings.TrimSpace(rev)}
+		}
+		return nil, fmt.Errorf("unable to compare %s with %s: %w", head, upstream, ConcatenateError(err, stderr))
+	}
+
+	var commits []*CherryCommit
+	for _, line := range strings.Split(strings.TrimSpace(stdout), "\n") {
+		if line == "" {
+			continue
+		}
+		// "+ <id>" is missing in upstream, "- <id>" has an equivalent in upstream
+		sign, id, ok := strings.Cut(line, " ")
+		if !ok || (sign != "+" && sign != "-") {
+			return nil, fmt.Errorf("invalid cherry output: %s", line)
+		}
+		commitID, err := repo.ObjectFormat().NewIDFromString(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cherry output: %w", err)
+		}
+		commits = append(commits, &CherryCommit{ID: commitID, Applied: sign == "-"})
+	}
+	return commits, nil
+}
+
+// resolveCommitID returns the full id of the commit a revision points to
+func (repo *Repository) resolveCommitID(rev string) (string, error) {
+	stdout, _, err := NewCommand(repo.Ctx, "rev-parse", "--verify", "--end-of-options").AddDynamicArguments(rev + "^{commit}").
+		RunStdString(&RunOpts{Dir: repo.Path})
+	if err != nil {
+		return "", ErrNotExist{ID: rev}
+	}
+	return strings.TrimSpace(stdout), nil
+}
+
+// updateRef sets ref to newID if it still points to oldID
+func (repo *Repository) updateRef(ref, newID, oldID, reason string) error {
+	if skipDryRun(repo.Ctx, "update %s to %s (%s) [repo_path: %s]", ref, newID, reason, repo.Path) {
+		return nil
+	}
+	if _, stderr, err := NewCommand(repo.Ctx, "update-ref", "-m").AddDynamicArguments(reason, ref, newID, oldID).
+		RunStdString(&RunOpts{Dir: repo.Path, Retry: lockRetry()}); err != nil {
+		return fmt.Errorf("unable to update %s: %w", ref, ConcatenateError(err, stderr))
+	}
+	return nil
+}
+
+// cherryPick commits the changes of commit on top of the commit onto without updating any ref.
+// A nil committer keeps the committer identity of commit.
+func (repo *Repository) cherryPick(commit *Commit, onto string, committer *Signature, opts CherryPickOptions) (ObjectID, error) {
+	var base string
+	switch {
+	case len(commit.Parents) == 0:
+		// picking a root commit, git merges it against the empty tree
+		base = repo.ObjectFormat().EmptyTree().String()
+	case len(commit.Parents) > 1 && opts.Mainline == 0:
+		return nil, fmt.Errorf("commit %s is a merge but no mainline was given", commit.ID)
+	case opts.Mainline > len(commit.Parents):
+		return nil, fmt.Errorf("commit %s does not have parent %d", commit.ID, opts.Mainline)
+	case opts.Mainline > 0:
+		base = commit.Parents[opts.Mainline-1].String()
+	default:
+		base = commit.Parents[0].String()
+	}
+
+	result, err := repo.MergeTree(base, onto, commit.ID.String())
+	if err != nil {
+		return nil, err
+	}
+	if result.HasConflicts() {
+		return nil, &ErrCherryPickConflict{CommitID: commit.ID.String(), Onto: onto, Conflicts: result.Conflicts}
+	}
+
+	if !opts.AllowEmpty {
+		ontoTree, stderr, err := NewCommand(repo.Ctx, "rev-parse", "--verify").AddDynamicArguments(onto + "^{tree}").RunStdString(&RunOpts{Dir: repo.Path})
+		if err != nil {
+			return nil, ConcatenateError(err, stderr)
+		}
+		if strings.TrimSpace(ontoTree) == result.TreeID {
+			return nil, ErrEmptyCherryPick
+		}
+	}
+
+	message := opts.Message
+	if message == "" {
+		message = commit.CommitMessage
+	}
+	if opts.AppendSource {
+		message = strings.TrimRight(message, "\n") + "\n\n(cherry picked from commit " + commit.ID.String() + ")"
+	}
+	if committer == nil {
+		committer = &Signature{Name: commit.Committer.Name, Email: commit.Committer.Email}
+	}
+
+	newID, err := repo.commitTreeID(commit.Author, committer, result.TreeID, CommitTreeOpts{
+		Parents: []string{onto},
+		Message: message,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to commit cherry-pick of %s: %w", commit.ID, err)
+	}
+	return newID, nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository_CherryPick(t *testing.T) {
+	repoPath := filepath.Join(t.TempDir(), "repo.git")
+	assert.NoError(t, Clone(DefaultContext, filepath.Join(testReposDir, "repo1_bare"), repoPath, CloneRepoOptions{Bare: true}))
+	repo, err := openRepositoryWithDefaultContext(repoPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	committer := &Signature{Name: "Picker", Email: "picker@example.com", When: time.Unix(1700000000, 0).UTC()}
+
+	// "Add branch1.txt" from branch1
+	id, err := repo.CherryPick("9c9aef8dd84e02bc7ec12641deb4c930a7c30185", "refs/heads/master", committer, CherryPickOptions{AppendSource: true})
+	assert.NoError(t, err)
+
+	commit, err := repo.GetCommit(id.String())
+	assert.NoError(t, err)
+	assert.Equal(t, "feaf4ba6bc635fec442f46ddd4512416ec43c2c2", commit.Parents[0].String())
+	assert.Equal(t, "Example User", commit.Author.Name)
+	assert.Equal(t, "Picker", commit.Committer.Name)
+	assert.Equal(t, committer.When.Unix(), commit.Committer.When.Unix())
+	assert.Equal(t, "Add branch1.txt\n\n(cherry picked from commit 9c9aef8dd84e02bc7ec12641deb4c930a7c30185)\n", commit.CommitMessage)
+	_, err = commit.GetTreeEntryByPath("branch1.txt")
+	assert.NoError(t, err)
+	stdout, _, err := NewCommand(DefaultContext, "rev-parse", "refs/heads/master").RunStdString(&RunOpts{Dir: repoPath})
+	assert.NoError(t, err)
+	assert.Equal(t, id.String(), strings.TrimSpace(stdout))
+
+	_, err = repo.CherryPick("9c9aef8dd84e02bc7ec12641deb4c930a7c30185", "refs/heads/master", committer, CherryPickOptions{})
+	assert.ErrorIs(t, err, ErrEmptyCherryPick)
+
+	// a commit id as target only creates the commit
+	id, err = repo.CherryPick("9c9aef8dd84e02bc7ec12641deb4c930a7c30185", "8d92fc957a4d7cfd98bc375f0b7bb189a0d6c9f2", committer, CherryPickOptions{Message: "picked"})
+	assert.NoError(t, err)
+	commit, err = repo.GetCommit(id.String())
+	assert.NoError(t, err)
+	assert.Equal(t, "picked\n", commit.CommitMessage)
+
+	_, err = repo.CherryPick("2839944139e0de9737a044f78b0e4b40d989a9e3", "refs/heads/unknown", committer, CherryPickOptions{})
+	assert.True(t, IsErrNotExist(err))
+}
+
+func TestRepository_CherryPickConflict(t *testing.T) {
+	repoPath := t.TempDir()
+	repo, err := InitRepository(DefaultContext, repoPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+	run := func(args ...CmdArg) string {
+		stdout, stderr, err := NewCommand(DefaultContext, "-c", "user.name=Test", "-c", "user.email=test@example.com").AddArguments(args...).
+			RunStdString(&RunOpts{Dir: repoPath})
+		assert.NoError(t, err, stderr)
+		return strings.TrimSpace(stdout)
+	}
+	commit := func(content string) string {
+		assert.NoError(t, os.WriteFile(filepath.Join(repoPath, "file.txt"), []byte(content), 0o644))
+		run("add", "file.txt")
+		run("commit", "-m", CmdArg(content))
+		return run("rev-parse", "HEAD")
+	}
+	base := commit("base\n")
+	commit("ours\n")
+	run("checkout", "-b", "other", CmdArg(base))
+	theirs := commit("theirs\n")
+
+	_, err = repo.CherryPick(theirs, "refs/heads/main", &Signature{Name: "Test", Email: "test@example.com"}, CherryPickOptions{})
+	if assert.True(t, IsErrCherryPickConflict(err), "%v", err) {
+		conflicts := err.(*ErrCherryPickConflict).Conflicts
+		assert.Len(t, conflicts, 1)
+		assert.Equal(t, "file.txt", conflicts[0].Path)
+	}
+}
+
+func TestRepository_Cherry(t *testing.T) {
+	repoPath := filepath.Join(t.TempDir(), "repo.git")
+	assert.NoError(t, Clone(DefaultContext, filepath.Join(testReposDir, "repo1_bare"), repoPath, CloneRepoOptions{Bare: true}))
+	repo, err := openRepositoryWithDefaultContext(repoPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	commits, err := repo.Cherry("master", "branch1")
+	assert.NoError(t, err)
+	assert.Equal(t, []*CherryCommit{
+		{ID: MustIDFromString("9c9aef8dd84e02bc7ec12641deb4c930a7c30185")},
+		{ID: MustIDFromString("2839944139e0de9737a044f78b0e4b40d989a9e3")},
+	}, commits)
+
+	// "Add branch1.txt" from branch1
+	committer := &Signature{Name: "Picker", Email: "picker@example.com", When: time.Unix(1700000000, 0).UTC()}
+	_, err = repo.CherryPick("9c9aef8dd84e02bc7ec12641deb4c930a7c30185", "refs/heads/master", committer, CherryPickOptions{})
+	assert.NoError(t, err)
+
+	commits, err = repo.Cherry("master", "branch1")
+	assert.NoError(t, err)
+	if assert.Len(t, commits, 2) {
+		assert.True(t, commits[0].Applied)
+		assert.False(t, commits[1].Applied)
+	}
+
+	_, err = repo.Cherry("master", "unknown")
+	assert.True(t, IsErrNotExist(err))
+}
@@ -7,13 +7,18 @@ package git
 
 import (
 	"bytes"
-	"encoding/hex"
+	"errors"
 	"fmt"
-	"io"
+	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/enverbisevac/gitlib/util"
+	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	format "github.com/go-git/go-git/v5/plumbing/format/config"
 	"github.com/go-git/go-git/v5/plumbing/object"
 )
 
@@ -29,7 +34,7 @@ func (repo *Repository) GetTagCommitID(name string) (string, error) {
 
 // GetCommit returns commit object of by ID string.
 func (repo *Repository) GetCommit(commitID string) (*Commit, error) {
-	id, err := repo.ConvertToSHA1(commitID)
+	id, err := repo.ConvertToObjectID(commitID)
 	if err != nil {
 		return nil, err
 	}
@@ -39,12 +44,15 @@ func (repo *Repository) GetCommit(commitID string) (*Commit, error) {
 
 // GetFullCommitID returns full length (40) of commit ID by given short SHA in a repository.
 func (repo *Repository) GetFullCommitID(ref string) (string, error) {
-	revspec, err := repo.git2go.RevparseSingle(ref)
+	if repo.useGit2Go(OperationRevParse) {
+		return repo.getFullCommitIDWithGit2Go(ref)
+	}
+	stdout, _, err := NewCommand(repo.Ctx, "rev-parse", "--verify", "--end-of-options").AddDynamicArguments(ref).RunStdString(&RunOpts{Dir: repo.Path})
 	if err != nil {
-		return "", fmt.Errorf("failed to get full commit id: %w", err)
+		// same error as libgit2
+		return "", fmt.Errorf("failed to get full commit id: revspec '%s' not found", ref)
 	}
-
-	return revspec.Id().String(), nil
+	return strings.TrimSpace(stdout), nil
 }
 
 // GetBranchCommit returns the last commit of given branch.
@@ -65,7 +73,7 @@ func (repo *Repository) GetTagCommit(name string) (*Commit, error) {
 	return repo.GetCommit(commitID)
 }
 
-func (repo *Repository) getCommitByPathWithID(id SHA1, relpath string) (*Commit, error) {
+func (repo *Repository) getCommitByPathWithID(id ObjectID, relpath string) (*Commit, error) {
 	// File name starts with ':' must be escaped.
 	if relpath[0] == ':' {
 		relpath = `\` + relpath
@@ -76,7 +84,7 @@ func (repo *Repository) getCommitByPathWithID(id SHA1, relpath string) (*Commit,
 		return nil, runErr
 	}
 
-	id, err := NewIDFromString(stdout)
+	id, err := repo.ObjectFormat().NewIDFromString(stdout)
 	if err != nil {
 		return nil, err
 	}
@@ -98,7 +106,7 @@ func (repo *Repository) GetCommitByPath(relpath string) (*Commit, error) {
 	return commits[0], nil
 }
 
-func (repo *Repository) commitsByRange(id SHA1, page, pageSize int) ([]*Commit, error) {
+func (repo *Repository) commitsByRange(id ObjectID, page, pageSize int) ([]*Commit, error) {
 	stdout, _, err := NewCommand(repo.Ctx, "log").
 		AddArguments(CmdArg("--skip="+strconv.Itoa((page-1)*pageSize)), CmdArg("--max-count="+strconv.Itoa(pageSize)), prettyLogFormat).
 		AddDynamicArguments(id.String()).
@@ -109,12 +117,18 @@ func (repo *Repository) commitsByRange(id SHA1, page, pageSize int) ([]*Commit,
 	return repo.parsePrettyFormatLogToList(stdout)
 }
 
-func (repo *Repository) searchCommits(id SHA1, opts SearchCommitsOptions) ([]*Commit, error) {
-	// create new git log command with limit of 100 commis
-	cmd := NewCommand(repo.Ctx, "log", "-100", prettyLogFormat).AddDynamicArguments(id.String())
+func (repo *Repository) searchCommits(id ObjectID, opts SearchCommitsOptions) ([]*Commit, int, error) {
 	// ignore case
 	args := []CmdArg{"-i"}
 
+	// keywords and author/committer patterns are basic regexes unless extended regexes or fixed strings are chosen
+	switch {
+	case opts.RegexKeywords:
+		args = append(args, "--extended-regexp")
+	case opts.FixedStrings:
+		args = append(args, "--fixed-strings")
+	}
+
 	// add authors if present in search query
 	if len(opts.Authors) > 0 {
 		for _, v := range opts.Authors {
@@ -137,64 +151,252 @@ func (repo *Repository) searchCommits(id SHA1, opts SearchCommitsOptions) ([]*Co
 		args = append(args, CmdArg("--before="+opts.Before))
 	}
 
-	// pretend that all refs along with HEAD were listed on command line as <commis>
-	// https://git-scm.com/docs/git-log#Documentation/git-log.txt---all
-	// note this is done only for command created above
-	if opts.All {
-		cmd.AddArguments("--all")
+	// add pickaxe constraints on the changes of the commits
+	pickaxe := len(opts.DiffContains) > 0 || len(opts.DiffMatchesRegex) > 0
+	if len(opts.DiffContains) > 0 {
+		args = append(args, CmdArg("-S"+opts.DiffContains))
+	}
+	if len(opts.DiffMatchesRegex) > 0 {
+		args = append(args, CmdArg("-G"+opts.DiffMatchesRegex))
+	}
+
+	// keywords from search string are matched in the commit message
+	greps := make([]CmdArg, 0, len(opts.Keywords))
+	for _, v := range opts.Keywords {
+		greps = append(greps, CmdArg("--grep="+v))
+	}
+
+	// searchCommand creates a command listing the matching commits
+	searchCommand := func(cmdArgs ...CmdArg) *Command {
+		cmd := NewCommand(repo.Ctx, cmdArgs...).AddDynamicArguments(id.String())
+		// pretend that all refs along with HEAD were listed on command line as <commis>
+		// https://git-scm.com/docs/git-log#Documentation/git-log.txt---all
+		if opts.All {
+			cmd.AddArguments("--all")
+		}
+		return cmd.AddArguments(greps...).AddArguments(args...)
+	}
+
+	// count the matching commits, rev-list doesn't support the pickaxe options and git log lists them instead
+	var count int
+	if pickaxe {
+		stdout, _, err := searchCommand("log", prettyLogFormat).RunStdString(&RunOpts{Dir: repo.Path})
+		if err != nil {
+			return nil, 0, err
+		}
+		count = len(strings.Fields(stdout))
+	} else {
+		stdout, _, runErr := searchCommand("rev-list", "--count").RunStdString(&RunOpts{Dir: repo.Path})
+		if runErr != nil {
+			return nil, 0, runErr
+		}
+		var err error
+		if count, err = strconv.Atoi(strings.TrimSpace(stdout)); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	// keywords which are commit ids find the commit itself, listed after the commits found by the log
+	var hashMatches []string
+	for _, v := range opts.Keywords {
+		// ignore anything not matching a valid sha pattern of the object format of the repository
+		if len(v) < 4 || len(v) > repo.ObjectFormat().FullLength() || !isLowerHex(v) {
+			continue
+		}
+		// create new git log command with 1 commit limit
+		hashCmd := NewCommand(repo.Ctx, "log", "-1", prettyLogFormat)
+		// add previous arguments except for --grep and --all
+		hashCmd.AddArguments(args...)
+		// add keyword as <commit>
+		hashCmd.AddDynamicArguments(v)
+
+		// search with given constraints for commit matching sha hash of v
+		hashMatching, _, err := hashCmd.RunStdString(&RunOpts{Dir: repo.Path})
+		hashMatching = strings.TrimSpace(hashMatching)
+		if err != nil || hashMatching == "" || util.IsStringInSlice(hashMatching, hashMatches) || repo.isSearchResult(id, hashMatching, opts.All, greps, args) {
+			continue
+		}
+		hashMatches = append(hashMatches, hashMatching)
+	}
+
+	// only load the commits of the requested page
+	pageSize := opts.PageSize
+	if pageSize <= 0 {
+		pageSize = 100
 	}
+	page := opts.Page
+	if page <= 0 {
+		page = 1
+	}
+	skip := (page - 1) * pageSize
+	var commits []*Commit
+	if skip < count {
+		stdout, _, runErr := searchCommand("log", prettyLogFormat, CmdArg("--skip="+strconv.Itoa(skip)), CmdArg("--max-count="+strconv.Itoa(pageSize))).
+			RunStdBytes(&RunOpts{Dir: repo.Path})
+		if runErr != nil {
+			return nil, 0, runErr
+		}
+		var err error
+		if commits, err = repo.parsePrettyFormatLogToList(stdout); err != nil {
+			return nil, 0, err
+		}
+	}
+	for i, commitID := range hashMatches {
+		if idx := count + i; idx < skip || idx >= skip+pageSize {
+			continue
+		}
+		commit, err := repo.GetCommit(commitID)
+		if err != nil {
+			return nil, 0, err
+		}
+		commits = append(commits, commit)
+	}
+	return commits, count + len(hashMatches), nil
+}
 
-	// add remaining keywords from search string
-	// note this is done only for command created above
-	if len(opts.Keywords) > 0 {
-		for _, v := range opts.Keywords {
-			cmd.AddArguments(CmdArg("--grep=" + v))
+// isSearchResult reports whether the commit commitID is listed by the log of a search from id
+func (repo *Repository) isSearchResult(id ObjectID, commitID string, all bool, greps, args []CmdArg) bool {
+	stdout, _, err := NewCommand(repo.Ctx, "log", "--no-walk", prettyLogFormat).AddArguments(greps...).AddArguments(args...).
+		AddDynamicArguments(commitID).RunStdString(&RunOpts{Dir: repo.Path})
+	if err != nil || strings.TrimSpace(stdout) == "" {
+		return false
+	}
+	if all {
+		stdout, _, err = NewCommand(repo.Ctx, "for-each-ref", "--count=1", "--contains").AddDynamicArguments(commitID).RunStdString(&RunOpts{Dir: repo.Path})
+		return err == nil && strings.TrimSpace(stdout) != ""
+	}
+	_, _, err = NewCommand(repo.Ctx, "merge-base", "--is-ancestor").AddDynamicArguments(commitID, id.String()).RunStdString(&RunOpts{Dir: repo.Path})
+	return err == nil
+}
+
+func (repo *Repository) getFilesChanged(id1, id2 string) ([]string, error) {
+	switch repo.backendFor(OperationFilesChanged, BackendGoGit, BackendCLI) {
+	case BackendGoGit:
+		return repo.getFilesChangedInProcess(id1, id2)
+	case BackendDefault:
+		paths, err := repo.getFilesChangedInProcess(id1, id2)
+		if !errors.Is(err, errNotInProcess) {
+			return paths, err
 		}
 	}
 
-	// search for commits matching given constraints and keywords in commit msg
-	cmd.AddArguments(args...)
-	stdout, _, err := cmd.RunStdBytes(&RunOpts{Dir: repo.Path})
+	stdout, _, err := NewCommand(repo.Ctx, "diff", "--name-only", "-z").AddDynamicArguments(id1, id2).RunStdBytes(&RunOpts{Dir: repo.Path})
 	if err != nil {
 		return nil, err
 	}
-	if len(stdout) != 0 {
-		stdout = append(stdout, '\n')
-	}
-
-	// if there are any keywords (ie not committer:, author:, time:)
-	// then let's iterate over them
-	if len(opts.Keywords) > 0 {
-		for _, v := range opts.Keywords {
-			// ignore anything not matching a valid sha pattern
-			if IsValidSHAPattern(v) {
-				// create new git log command with 1 commit limit
-				hashCmd := NewCommand(repo.Ctx, "log", "-1", prettyLogFormat)
-				// add previous arguments except for --grep and --all
-				hashCmd.AddArguments(args...)
-				// add keyword as <commit>
-				hashCmd.AddDynamicArguments(v)
-
-				// search with given constraints for commit matching sha hash of v
-				hashMatching, _, err := hashCmd.RunStdBytes(&RunOpts{Dir: repo.Path})
-				if err != nil || bytes.Contains(stdout, hashMatching) {
-					continue
-				}
-				stdout = append(stdout, hashMatching...)
-				stdout = append(stdout, '\n')
-			}
+	if len(stdout) == 0 {
+		return []string{}, nil
+	}
+	return strings.Split(strings.TrimSuffix(string(stdout), "\x00"), "\x00"), nil
+}
+
+func (repo *Repository) getFilesChangedInProcess(id1, id2 string) ([]string, error) {
+	from, err := repo.gogitCommit(id1)
+	if err != nil {
+		return nil, err
+	}
+	to, err := repo.gogitCommit(id2)
+	if err != nil {
+		return nil, err
+	}
+	return repo.changedPathsBetween(from, to)
+}
+
+// errNotInProcess is returned by the in-process implementations for what only git can do, the caller falls back to git
+var errNotInProcess = errors.New("not supported in-process")
+
+// gogitCommit resolves the revision to a commit object in-process,
+// only sha1 repositories and the revision syntax go-git understands are supported
+func (repo *Repository) gogitCommit(rev string) (*object.Commit, error) {
+	if repo.ObjectFormat() != Sha1ObjectFormat {
+		return nil, fmt.Errorf("%w: unable to read %s objects", errNotInProcess, repo.ObjectFormat().Name())
+	}
+	hash, err := repo.gogit.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, fmt.Errorf("%w: unable to resolve %s: %v", errNotInProcess, rev, err)
+	}
+	return repo.gogit.CommitObject(*hash)
+}
+
+// diffRenames reports whether git diff detects renames, as configured by diff.renames.
+// The config is read in-process like git reads it for the commands of this package, the config of the repository
+// takes precedence over the global config in Git.HomePath and the system config. Includes are not followed.
+func (repo *Repository) diffRenames() (bool, error) {
+	configs := make([]*format.Config, 0, 3)
+	system, err := config.LoadConfig(config.SystemScope)
+	if err != nil {
+		return false, err
+	}
+	configs = append(configs, system.Raw)
+	if Git.HomePath != "" {
+		global, err := os.ReadFile(filepath.Join(Git.HomePath, ".gitconfig"))
+		if err != nil && !os.IsNotExist(err) {
+			return false, err
 		}
+		raw := format.New()
+		if err := format.NewDecoder(bytes.NewReader(global)).Decode(raw); err != nil {
+			return false, fmt.Errorf("unable to read global config: %w", err)
+		}
+		configs = append(configs, raw)
 	}
+	local, err := repo.gogit.Storer.Config()
+	if err != nil {
+		return false, err
+	}
+	configs = append(configs, local.Raw)
 
-	return repo.parsePrettyFormatLogToList(bytes.TrimSuffix(stdout, []byte{'\n'}))
+	// git detects renames by default since 2.9
+	renames := true
+	for _, raw := range configs {
+		section := raw.Section("diff")
+		if !section.HasOption("renames") {
+			continue
+		}
+		value := section.Option("renames")
+		switch {
+		case value == "", strings.HasPrefix(strings.ToLower(value), "cop"):
+			// a variable without value is true, copies are detected together with renames
+			renames = true
+		default:
+			var valid bool
+			if renames, valid = ParseBool(value); !valid {
+				return false, fmt.Errorf("bad boolean config value %q for diff.renames", value)
+			}
+		}
+	}
+	return renames, nil
 }
 
-func (repo *Repository) getFilesChanged(id1, id2 string) ([]string, error) {
-	stdout, _, err := NewCommand(repo.Ctx, "diff", "--name-only").AddDynamicArguments(id1, id2).RunStdBytes(&RunOpts{Dir: repo.Path})
+// changedPathsBetween lists the paths changed between the trees of two commits like git diff --name-only,
+// a renamed file is listed by its new path if diff.renames is enabled. The paths are sorted.
+func (repo *Repository) changedPathsBetween(from, to *object.Commit) ([]string, error) {
+	renames, err := repo.diffRenames()
+	if err != nil {
+		return nil, err
+	}
+	fromTree, err := from.Tree()
 	if err != nil {
 		return nil, err
 	}
-	return strings.Split(string(stdout), "\n"), nil
+	toTree, err := to.Tree()
+	if err != nil {
+		return nil, err
+	}
+	// same rename threshold as git
+	changes, err := object.DiffTreeWithOptions(repo.Ctx, fromTree, toTree, &object.DiffTreeOptions{DetectRenames: renames, RenameScore: 50})
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(changes))
+	for _, change := range changes {
+		if change.To.Name != "" {
+			paths = append(paths, change.To.Name)
+		} else {
+			paths = append(paths, change.From.Name)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
 }
 
 // FileChangedBetweenCommits Returns true if the file changed between commit IDs id1 and id2
@@ -216,70 +418,145 @@ func (repo *Repository) FileCommitsCount(revision, file string) (int64, error) {
 func (repo *Repository) CommitsByFileAndRange(revision, file string, page int) ([]*Commit, error) {
 	skip := (page - 1) * Git.CommitsRangeSize
 
-	stdoutReader, stdoutWriter := io.Pipe()
-	defer func() {
-		_ = stdoutReader.Close()
-		_ = stdoutWriter.Close()
-	}()
-	go func() {
-		stderr := strings.Builder{}
-		gitCmd := NewCommand(repo.Ctx, "rev-list").
-			AddArguments(CmdArg("--max-count=" + strconv.Itoa(Git.CommitsRangeSize*page))).
-			AddArguments(CmdArg("--skip=" + strconv.Itoa(skip)))
-		gitCmd.AddDynamicArguments(revision)
-		gitCmd.AddDashesAndList(file)
-		err := gitCmd.Run(&RunOpts{
-			Dir:    repo.Path,
-			Stdout: stdoutWriter,
-			Stderr: &stderr,
-		})
-		if err != nil {
-			_ = stdoutWriter.CloseWithError(ConcatenateError(err, (&stderr).String()))
-		} else {
-			_ = stdoutWriter.Close()
-		}
-	}()
-
 	commits := []*Commit{}
-	shaline := [41]byte{}
-	var sha1 SHA1
-	for {
-		n, err := io.ReadFull(stdoutReader, shaline[:])
-		if err != nil || n < 40 {
-			if err == io.EOF {
-				err = nil
-			}
-			return commits, err
-		}
-		n, err = hex.Decode(sha1[:], shaline[0:40])
-		if n != 20 {
-			err = fmt.Errorf("invalid sha %q", string(shaline[:40]))
-		}
-		if err != nil {
-			return nil, err
-		}
-		commit, err := repo.getCommit(sha1)
+	err := repo.RevListIterator(RevListOptions{
+		Revisions: []string{revision},
+		Paths:     []string{file},
+		Skip:      skip,
+		MaxCount:  Git.CommitsRangeSize * page,
+	}, func(entry *RevListEntry) error {
+		commit, err := repo.getCommit(entry.ID)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		commits = append(commits, commit)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return commits, nil
 }
 
 // FilesCountBetween return the number of files changed between two commits
 func (repo *Repository) FilesCountBetween(startCommitID, endCommitID string) (int, error) {
-	stdout, _, err := NewCommand(repo.Ctx, "diff", "--name-only").AddDynamicArguments(startCommitID + "..." + endCommitID).RunStdString(&RunOpts{Dir: repo.Path})
-	if err != nil && strings.Contains(err.Error(), "no merge base") {
+	switch repo.backendFor(OperationFilesChanged, BackendGoGit, BackendCLI) {
+	case BackendGoGit:
+		return repo.filesCountBetweenInProcess(startCommitID, endCommitID)
+	case BackendDefault:
+		count, err := repo.filesCountBetweenInProcess(startCommitID, endCommitID)
+		if !errors.Is(err, errNotInProcess) {
+			return count, err
+		}
+	}
+	return repo.filesCountBetween(startCommitID, endCommitID, "--name-only")
+}
+
+// filesCountBetweenInProcess counts the files changed since the merge base like git diff start...end
+// without running git. It returns errNotInProcess for anything but a single merge base, e.g. unrelated histories,
+// or if the objects can't be read in-process, so the caller can fall back to git.
+func (repo *Repository) filesCountBetweenInProcess(startCommitID, endCommitID string) (int, error) {
+	start, err := repo.gogitCommit(startCommitID)
+	if err != nil {
+		return 0, err
+	}
+	end, err := repo.gogitCommit(endCommitID)
+	if err != nil {
+		return 0, err
+	}
+	bases, err := start.MergeBase(end)
+	if err != nil {
+		return 0, err
+	}
+	if len(bases) != 1 {
+		return 0, fmt.Errorf("%w: %d merge bases of %s and %s", errNotInProcess, len(bases), startCommitID, endCommitID)
+	}
+	paths, err := repo.changedPathsBetween(bases[0], end)
+	if err != nil {
+		return 0, err
+	}
+	return len(paths), nil
+}
+
+// FileStatusOptions options for the changed files between two commits
+type FileStatusOptions struct {
+	RenameDetection
+	// WhitespaceOptions omit modified files whose changes are all ignored
+	WhitespaceOptions
+}
+
+// FilesCountBetweenWithOptions return the number of files changed between two commits,
+// a detected rename or copy counts as a single file and files whose changes are all ignored by the WhitespaceOptions are not counted
+func (repo *Repository) FilesCountBetweenWithOptions(startCommitID, endCommitID string, opts FileStatusOptions) (int, error) {
+	args := opts.RenameDetection.args()
+	if !opts.WhitespaceOptions.isSet() {
+		return repo.filesCountBetween(startCommitID, endCommitID, append(args, "--name-only")...)
+	}
+	// --name-only lists files with ignored changes too, --numstat omits them
+	args = append(args, opts.WhitespaceOptions.args()...)
+	return repo.filesCountBetween(startCommitID, endCommitID, append(args, "--numstat", "-z")...)
+}
+
+func (repo *Repository) filesCountBetween(startCommitID, endCommitID string, args ...CmdArg) (int, error) {
+	stdout, _, err := NewCommand(repo.Ctx, "diff").AddArguments(args...).AddDynamicArguments(startCommitID + "..." + endCommitID).RunStdString(&RunOpts{Dir: repo.Path})
+	if errors.Is(err, ErrNoMergeBase) {
 		// git >= 2.28 now returns an error if startCommitID and endCommitID have become unrelated.
 		// previously it would return the results of git diff --name-only startCommitID endCommitID so let's try that...
-		stdout, _, err = NewCommand(repo.Ctx, "diff", "--name-only").AddDynamicArguments(startCommitID, endCommitID).RunStdString(&RunOpts{Dir: repo.Path})
+		stdout, _, err = NewCommand(repo.Ctx, "diff").AddArguments(args...).AddDynamicArguments(startCommitID, endCommitID).RunStdString(&RunOpts{Dir: repo.Path})
 	}
 	if err != nil {
 		return 0, err
 	}
+	for _, arg := range args {
+		if arg == "--numstat" {
+			stats, err := parseDiffNumstat(stdout)
+			if err != nil {
+				return 0, err
+			}
+			return stats.NumFiles, nil
+		}
+	}
 	return len(strings.Split(stdout, "\n")) - 1, nil
 }
 
+// GetFileStatusBetween returns the status of the files changed between two commits, detecting renamed
+// and copied files as configured. Modified files whose changes are all ignored by the WhitespaceOptions are omitted.
+func (repo *Repository) GetFileStatusBetween(id1, id2 string, opts FileStatusOptions) (*CommitFileStatus, error) {
+	stdout, stderr, runErr := NewCommand(repo.Ctx, "diff", "--name-status", "-z").AddArguments(opts.RenameDetection.args()...).
+		AddDynamicArguments(id1, id2).RunStdString(&RunOpts{Dir: repo.Path})
+	if runErr != nil {
+		return nil, ConcatenateError(runErr, stderr)
+	}
+	fileStatus := NewCommitFileStatus()
+	parseCommitFileStatus(fileStatus, strings.NewReader(stdout))
+	if !opts.WhitespaceOptions.isSet() {
+		return fileStatus, nil
+	}
+
+	// --name-status lists files with ignored changes too, --numstat omits them
+	stdout, stderr, runErr = NewCommand(repo.Ctx, "diff", "--numstat", "-z").AddArguments(opts.RenameDetection.args()...).
+		AddArguments(opts.WhitespaceOptions.args()...).AddDynamicArguments(id1, id2).RunStdString(&RunOpts{Dir: repo.Path})
+	if runErr != nil {
+		return nil, ConcatenateError(runErr, stderr)
+	}
+	stats, err := parseDiffNumstat(stdout)
+	if err != nil {
+		return nil, err
+	}
+	changed := make(map[string]bool, len(stats.Files))
+	for _, file := range stats.Files {
+		changed[file.Path] = true
+	}
+	modified := fileStatus.Modified[:0]
+	for _, file := range fileStatus.Modified {
+		if changed[file] {
+			modified = append(modified, file)
+		}
+	}
+	fileStatus.Modified = modified
+	return fileStatus, nil
+}
+
 // CommitsBetween returns a list that contains commits between [before, last).
 // If before is detached (removed by reset + push) it is not included.
 func (repo *Repository) CommitsBetween(last, before *Commit) ([]*Commit, error) {
@@ -289,7 +566,7 @@ func (repo *Repository) CommitsBetween(last, before *Commit) ([]*Commit, error)
 		stdout, _, err = NewCommand(repo.Ctx, "rev-list").AddDynamicArguments(last.ID.String()).RunStdBytes(&RunOpts{Dir: repo.Path})
 	} else {
 		stdout, _, err = NewCommand(repo.Ctx, "rev-list").AddDynamicArguments(before.ID.String() + ".." + last.ID.String()).RunStdBytes(&RunOpts{Dir: repo.Path})
-		if err != nil && strings.Contains(err.Error(), "no merge base") {
+		if errors.Is(err, ErrNoMergeBase) {
 			// future versions of git >= 2.28 are likely to return an error if before and last have become unrelated.
 			// previously it would return the results of git rev-list before last so let's try that...
 			stdout, _, err = NewCommand(repo.Ctx, "rev-list").AddDynamicArguments(before.ID.String(), last.ID.String()).RunStdBytes(&RunOpts{Dir: repo.Path})
@@ -315,7 +592,7 @@ func (repo *Repository) CommitsBetweenLimit(last, before *Commit, limit, skip in
 			"--max-count", CmdArg(strconv.Itoa(limit)),
 			"--skip", CmdArg(strconv.Itoa(skip))).
 			AddDynamicArguments(before.ID.String() + ".." + last.ID.String()).RunStdBytes(&RunOpts{Dir: repo.Path})
-		if err != nil && strings.Contains(err.Error(), "no merge base") {
+		if errors.Is(err, ErrNoMergeBase) {
 			// future versions of git >= 2.28 are likely to return an error if before and last have become unrelated.
 			// previously it would return the results of git rev-list --max-count n before last so let's try that...
 			stdout, _, err = NewCommand(repo.Ctx, "rev-list",
@@ -349,7 +626,7 @@ func (repo *Repository) CommitsBetweenIDs(last, before string) ([]*Commit, error
 // CommitsCountBetween return numbers of commits between two commits
 func (repo *Repository) CommitsCountBetween(start, end string) (int64, error) {
 	count, err := CommitsCountFiles(repo.Ctx, repo.Path, []string{start + ".." + end}, []string{})
-	if err != nil && strings.Contains(err.Error(), "no merge base") {
+	if errors.Is(err, ErrNoMergeBase) {
 		// future versions of git >= 2.28 are likely to return an error if before and last have become unrelated.
 		// previously it would return the results of git rev-list before last so let's try that...
 		return CommitsCountFiles(repo.Ctx, repo.Path, []string{start, end}, []string{})
@@ -359,7 +636,7 @@ func (repo *Repository) CommitsCountBetween(start, end string) (int64, error) {
 }
 
 // commitsBefore the limit is depth, not total number of returned commits.
-func (repo *Repository) commitsBefore(id SHA1, limit int) ([]*Commit, error) {
+func (repo *Repository) commitsBefore(id ObjectID, limit int) ([]*Commit, error) {
 	cmd := NewCommand(repo.Ctx, "log")
 	if limit > 0 {
 		cmd.AddArguments(CmdArg("-"+strconv.Itoa(limit)), prettyLogFormat).AddDynamicArguments(id.String())
@@ -394,11 +671,11 @@ func (repo *Repository) commitsBefore(id SHA1, limit int) ([]*Commit, error) {
 	return commits, nil
 }
 
-func (repo *Repository) getCommitsBefore(id SHA1) ([]*Commit, error) {
+func (repo *Repository) getCommitsBefore(id ObjectID) ([]*Commit, error) {
 	return repo.commitsBefore(id, 0)
 }
 
-func (repo *Repository) getCommitsBeforeLimit(id SHA1, num int) ([]*Commit, error) {
+func (repo *Repository) getCommitsBeforeLimit(id ObjectID, num int) ([]*Commit, error) {
 	return repo.commitsBefore(id, num)
 }
 
@@ -475,13 +752,17 @@ func (repo *Repository) AddLastCommitCache(cacheKey, fullName, sha string) error
 		if err != nil {
 			return err
 		}
-		repo.LastCommitCache = NewLastCommitCache(commitsCount, fullName, repo, GetCache())
+		repo.LastCommitCache = NewLastCommitCache(commitsCount, fullName, repo, clientFromContext(repo.Ctx).cache())
 	}
 	return nil
 }
 
 // GetRefCommitID returns the last commit ID string of given reference (branch or tag).
 func (repo *Repository) GetRefCommitID(name string) (string, error) {
+	// gogit truncates the ids of the references of sha256 repositories
+	if repo.backendFor(OperationReferences, BackendGoGit, BackendCLI) == BackendCLI {
+		return repo.showRef(name)
+	}
 	ref, err := repo.gogit.Reference(plumbing.ReferenceName(name), true)
 	if err != nil {
 		if err == plumbing.ErrReferenceNotFound {
@@ -497,37 +778,84 @@ func (repo *Repository) GetRefCommitID(name string) (string, error) {
 
 // SetReference sets the commit ID string of given reference (e.g. branch or tag).
 func (repo *Repository) SetReference(name, commitID string) error {
+	if skipDryRun(repo.Ctx, "set reference %s to %s [repo_path: %s]", name, commitID, repo.Path) {
+		return nil
+	}
+	if repo.backendFor(OperationReferences, BackendGoGit, BackendCLI) == BackendCLI {
+		var cmd *Command
+		if target := strings.TrimPrefix(commitID, "ref: "); target != commitID {
+			cmd = NewCommand(repo.Ctx, "symbolic-ref").AddDynamicArguments(name, target)
+		} else {
+			cmd = NewCommand(repo.Ctx, "update-ref").AddDynamicArguments(name, commitID)
+		}
+		if _, stderr, err := cmd.RunStdString(&RunOpts{Dir: repo.Path, Retry: lockRetry()}); err != nil {
+			return fmt.Errorf("unable to set %s: %w", name, ConcatenateError(err, stderr))
+		}
+		return nil
+	}
 	return repo.gogit.Storer.SetReference(plumbing.NewReferenceFromStrings(name, commitID))
 }
 
 // RemoveReference removes the given reference (e.g. branch or tag).
 func (repo *Repository) RemoveReference(name string) error {
+	if skipDryRun(repo.Ctx, "remove reference %s [repo_path: %s]", name, repo.Path) {
+		return nil
+	}
+	if repo.backendFor(OperationReferences, BackendGoGit, BackendCLI) == BackendCLI {
+		if _, stderr, err := NewCommand(repo.Ctx, "update-ref", "-d").AddDynamicArguments(name).
+			RunStdString(&RunOpts{Dir: repo.Path, Retry: lockRetry()}); err != nil {
+			return fmt.Errorf("unable to remove %s: %w", name, ConcatenateError(err, stderr))
+		}
+		return nil
+	}
 	return repo.gogit.Storer.RemoveReference(plumbing.ReferenceName(name))
 }
 
-// ConvertToSHA1 returns a Hash object from a potential ID string
-func (repo *Repository) ConvertToSHA1(commitID string) (SHA1, error) {
-	if len(commitID) == 40 {
-		sha1, err := NewIDFromString(commitID)
+// ConvertToObjectID returns the ID of the object format of the repository from a potential ID string
+func (repo *Repository) ConvertToObjectID(commitID string) (ObjectID, error) {
+	objectFormat := repo.ObjectFormat()
+	if len(commitID) == objectFormat.FullLength() {
+		id, err := objectFormat.NewIDFromString(commitID)
 		if err == nil {
-			return sha1, nil
+			return id, nil
 		}
 	}
 
 	actualCommitID, _, err := NewCommand(repo.Ctx, "rev-parse", "--verify").AddDynamicArguments(commitID).RunStdString(&RunOpts{Dir: repo.Path})
 	if err != nil {
-		if strings.Contains(err.Error(), "unknown revision or path") ||
-			strings.Contains(err.Error(), "fatal: Needed a single revision") {
-			return SHA1{}, ErrNotExist{commitID, ""}
+		if errors.Is(err, ErrUnknownRevision) {
+			return nil, ErrNotExist{commitID, ""}
 		}
-		return SHA1{}, err
+		return nil, err
 	}
 
-	return NewIDFromString(actualCommitID)
+	return objectFormat.NewIDFromString(actualCommitID)
+}
+
+// ConvertToSHA1 returns a Hash object from a potential ID string.
+// It fails in sha256 repositories, use ConvertToObjectID instead.
+func (repo *Repository) ConvertToSHA1(commitID string) (SHA1, error) {
+	id, err := repo.ConvertToObjectID(commitID)
+	if err != nil {
+		return SHA1{}, err
+	}
+	sha1, ok := id.(SHA1)
+	if !ok {
+		return SHA1{}, fmt.Errorf("%s is not a sha1 object id", id)
+	}
+	return sha1, nil
 }
 
 // IsCommitExist returns true if given commit exists in current repository.
 func (repo *Repository) IsCommitExist(name string) bool {
+	if repo.backendFor(OperationObjects, BackendGoGit, BackendCLI) == BackendCLI {
+		id, err := repo.ObjectFormat().NewIDFromString(name)
+		if err != nil {
+			return false
+		}
+		typ, _, err := repo.statObject(id)
+		return err == nil && ObjectType(typ) == ObjectCommit
+	}
 	hash := plumbing.NewHash(name)
 	_, err := repo.gogit.CommitObject(hash)
 	return err == nil
@@ -565,42 +893,32 @@ func convertPGPSignatureForTag(t *object.Tag) *CommitGPGSignature {
 	}
 }
 
-func (repo *Repository) getCommit(id SHA1) (*Commit, error) {
-	var tagObject *object.Tag
-
-	gogitCommit, err := repo.gogit.CommitObject(id)
-	if err == plumbing.ErrObjectNotFound {
-		tagObject, err = repo.gogit.TagObject(id)
-		if err == plumbing.ErrObjectNotFound {
-			return nil, ErrNotExist{
-				ID: id.String(),
-			}
+func (repo *Repository) getCommit(id ObjectID) (*Commit, error) {
+	var commit *Commit
+	if _, err := gogitHash(id); err != nil {
+		if commit, err = repo.readCommit(id); err != nil {
+			return nil, err
 		}
-		if err == nil {
-			gogitCommit, err = repo.gogit.CommitObject(tagObject.Target)
+	} else {
+		gogitCommit, tagObject, err := repo.readCommitObject(id)
+		if err != nil {
+			return nil, err
 		}
-		// if we get a plumbing.ErrObjectNotFound here then the repository is broken and it should be 500
-	}
-	if err != nil {
-		return nil, err
-	}
 
-	commit := convertCommit(gogitCommit)
-	commit.repo = repo
+		commit = convertCommit(gogitCommit)
+		commit.repo = repo
+		commit.Tree.ID = gogitCommit.TreeHash
 
-	if tagObject != nil {
-		commit.CommitMessage = strings.TrimSpace(tagObject.Message)
-		commit.Author = &tagObject.Tagger
-		commit.Signature = convertPGPSignatureForTag(tagObject)
+		if tagObject != nil {
+			commit.CommitMessage = strings.TrimSpace(tagObject.Message)
+			commit.Author = &tagObject.Tagger
+			commit.Signature = convertPGPSignatureForTag(tagObject)
+		}
 	}
 
-	tree, err := gogitCommit.Tree()
-	if err != nil {
+	if err := commit.Tree.loadTreeObject(); err != nil {
 		return nil, err
 	}
 
-	commit.Tree.ID = tree.Hash
-	commit.Tree.gogitTree = tree
-
 	return commit, nil
 }
@@ -5,7 +5,9 @@
 package git
 
 import (
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -124,3 +126,97 @@ func TestGetFullCommitIDError(t *testing.T) {
 		assert.EqualError(t, err, "failed to get full commit id: revspec 'unknown' not found")
 	}
 }
+
+func TestRepository_FilesChangedInProcess(t *testing.T) {
+	bareRepo1Path := filepath.Join(testReposDir, "repo1_bare")
+	bareRepo1, err := openRepositoryWithDefaultContext(bareRepo1Path)
+	assert.NoError(t, err)
+	defer bareRepo1.Close()
+
+	cases := []struct {
+		base string
+		head string
+	}{
+		{"95bb4d3", "master"},
+		{"8d92fc9", "feaf4ba"},
+		{"branch1", "branch2"},
+		{"master", "95bb4d3"},
+	}
+	for _, c := range cases {
+		from, err := bareRepo1.gogitCommit(c.base)
+		assert.NoError(t, err)
+		to, err := bareRepo1.gogitCommit(c.head)
+		assert.NoError(t, err)
+		paths, err := bareRepo1.changedPathsBetween(from, to)
+		assert.NoError(t, err)
+
+		stdout, _, runErr := NewCommand(DefaultContext, "diff", "--name-only").AddDynamicArguments(c.base, c.head).RunStdString(&RunOpts{Dir: bareRepo1Path})
+		assert.NoError(t, runErr)
+		assert.Equal(t, strings.Fields(stdout), paths, "%s..%s", c.base, c.head)
+
+		count, err := bareRepo1.filesCountBetweenInProcess(c.base, c.head)
+		assert.NoError(t, err)
+		cliCount, err := bareRepo1.filesCountBetween(c.base, c.head, "--name-only")
+		assert.NoError(t, err)
+		assert.Equal(t, cliCount, count, "%s...%s", c.base, c.head)
+	}
+
+	commit, err := bareRepo1.GetBranchCommit("master")
+	assert.NoError(t, err)
+	paths, err := commit.GetFilesChangedSinceCommit("95bb4d3")
+	assert.NoError(t, err)
+	assert.Contains(t, paths, "file2.txt")
+
+	paths, err = commit.GetFilesChangedSinceCommit("master")
+	assert.NoError(t, err)
+	assert.Empty(t, paths)
+
+	// the notes commit has an unrelated history, the count falls back to git comparing the commits directly
+	_, err = bareRepo1.filesCountBetweenInProcess("ca6b5dd", "master")
+	assert.ErrorIs(t, err, errNotInProcess)
+	count, err := bareRepo1.FilesCountBetween("ca6b5dd", "master")
+	assert.NoError(t, err)
+	assert.Positive(t, count)
+}
+
+func TestRepository_FilesChangedInProcessRenamesConfig(t *testing.T) {
+	repoPath := t.TempDir()
+	repo, err := InitRepository(DefaultContext, repoPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	sig := &Signature{Name: "Test", Email: "test@example.com"}
+	assert.NoError(t, os.WriteFile(filepath.Join(repoPath, "a.txt"), []byte("a rename keeps this content\n"), 0o644))
+	assert.NoError(t, AddChanges(repoPath, true))
+	assert.NoError(t, CommitChanges(repoPath, CommitChangesOptions{Committer: sig, Message: "add"}))
+	assert.NoError(t, os.Rename(filepath.Join(repoPath, "a.txt"), filepath.Join(repoPath, "b.txt")))
+	assert.NoError(t, AddChanges(repoPath, true))
+	assert.NoError(t, CommitChanges(repoPath, CommitChangesOptions{Committer: sig, Message: "rename"}))
+
+	for _, c := range []struct {
+		renames string
+		paths   []string
+	}{
+		{"", []string{"b.txt"}},
+		{"false", []string{"a.txt", "b.txt"}},
+		{"copies", []string{"b.txt"}},
+	} {
+		if c.renames != "" {
+			_, _, err = NewCommand(DefaultContext, "config", "diff.renames").AddDynamicArguments(c.renames).RunStdString(&RunOpts{Dir: repoPath})
+			assert.NoError(t, err)
+		}
+		stdout, _, err := NewCommand(DefaultContext, "diff", "--name-only").AddDynamicArguments("HEAD~1", "HEAD").RunStdString(&RunOpts{Dir: repoPath})
+		assert.NoError(t, err)
+		assert.Equal(t, c.paths, strings.Fields(stdout), "diff.renames=%s", c.renames)
+
+		paths, inProcessErr := repo.getFilesChangedInProcess("HEAD~1", "HEAD")
+		assert.NoError(t, inProcessErr)
+		assert.Equal(t, c.paths, paths, "diff.renames=%s", c.renames)
+	}
+
+	_, _, err = NewCommand(DefaultContext, "config", "diff.renames", "maybe").RunStdString(&RunOpts{Dir: repoPath})
+	assert.NoError(t, err)
+	_, inProcessErr := repo.getFilesChangedInProcess("HEAD~1", "HEAD")
+	assert.Error(t, inProcessErr)
+	assert.NotErrorIs(t, inProcessErr, errNotInProcess)
+}
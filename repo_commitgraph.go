@@ -18,6 +18,9 @@ import (
 // WriteCommitGraph write commit graph to speed up repo access
 // this requires git v2.18 to be installed
 func WriteCommitGraph(ctx context.Context, repoPath string) error {
+	if skipDryRun(ctx, "write commit-graph [repo_path: %s]", repoPath) {
+		return nil
+	}
 	if CheckGitVersionAtLeast("2.18") == nil {
 		if _, _, err := NewCommand(ctx, "commit-graph", "write").RunStdString(&RunOpts{Dir: repoPath}); err != nil {
 			return fmt.Errorf("unable to write commit-graph for '%s' : %w", repoPath, err)
@@ -20,7 +20,6 @@ import (
 	"time"
 
 	logger "github.com/enverbisevac/gitlib/log"
-	git2go "github.com/libgit2/git2go/v34"
 )
 
 // CompareInfo represents needed information for comparing references.
@@ -33,21 +32,48 @@ type CompareInfo struct {
 }
 
 // GetMergeBase checks and returns merge base of two branches and the reference used as base.
+// The implementation is selected by OperationMergeBase, the default libgit2 one needs full commit ids.
 func (repo *Repository) GetMergeBase(tmpRemote, base, head string) (string, error) {
-	baseOid, err := git2go.NewOid(base)
+	switch repo.backendFor(OperationMergeBase, BackendGit2Go, BackendGoGit, BackendCLI) {
+	case BackendGoGit:
+		return repo.getMergeBaseInProcess(base, head)
+	case BackendCLI:
+		return repo.getMergeBaseWithGit(base, head)
+	}
+	if !hasGit2Go {
+		return repo.getMergeBaseWithGit(base, head)
+	}
+	return repo.getMergeBaseWithGit2Go(base, head)
+}
+
+func (repo *Repository) getMergeBaseInProcess(base, head string) (string, error) {
+	baseCommit, err := repo.gogitCommit(base)
 	if err != nil {
 		return "", err
 	}
-	headOid, err := git2go.NewOid(head)
+	headCommit, err := repo.gogitCommit(head)
 	if err != nil {
 		return "", err
 	}
-	commit, err := repo.git2go.MergeBase(baseOid, headOid)
+	bases, err := baseCommit.MergeBase(headCommit)
 	if err != nil {
 		return "", err
 	}
+	if len(bases) == 0 {
+		return "", fmt.Errorf("%s and %s: %w", base, head, ErrNoMergeBase)
+	}
+	return bases[0].Hash.String(), nil
+}
 
-	return commit.String(), nil
+func (repo *Repository) getMergeBaseWithGit(base, head string) (string, error) {
+	stdout, stderr, err := NewCommand(repo.Ctx, "merge-base").AddDynamicArguments(base, head).RunStdString(&RunOpts{Dir: repo.Path})
+	if err != nil {
+		if err.IsExitCode(1) && stderr == "" {
+			return "", fmt.Errorf("%s and %s: %w", base, head, ErrNoMergeBase)
+		}
+		return "", fmt.Errorf("unable to get merge base of %s and %s: %w", base, head, ConcatenateError(err, stderr))
+	}
+	return strings.TrimSpace(stdout), nil
 }
 
 // GetCompareInfo generates and returns compare information between base and head branches of repositories.
@@ -154,7 +180,7 @@ func (repo *Repository) GetDiffNumChangedFiles(base, head string, directComparis
 			Stdout: w,
 			Stderr: stderr,
 		}); err != nil {
-		if strings.Contains(stderr.String(), "no merge base") {
+		if errors.Is(err, ErrNoMergeBase) {
 			// git >= 2.28 now returns an error if base and head have become unrelated.
 			// previously it would return the results of git diff -z --name-only base head so let's try that...
 			w = &lineCountWriter{}
@@ -175,7 +201,7 @@ func (repo *Repository) GetDiffNumChangedFiles(base, head string, directComparis
 // GetDiffShortStat counts number of changed files, number of additions and deletions
 func (repo *Repository) GetDiffShortStat(base, head string) (numFiles, totalAdditions, totalDeletions int, err error) {
 	numFiles, totalAdditions, totalDeletions, err = GetDiffShortStat(repo.Ctx, repo.Path, CmdArgCheck(base+"..."+head))
-	if err != nil && strings.Contains(err.Error(), "no merge base") {
+	if errors.Is(err, ErrNoMergeBase) {
 		return GetDiffShortStat(repo.Ctx, repo.Path, CmdArgCheck(base), CmdArgCheck(head))
 	}
 	return numFiles, totalAdditions, totalDeletions, err
@@ -235,6 +261,97 @@ func parseDiffStat(stdout string) (numFiles, totalAdditions, totalDeletions int,
 	return numFiles, totalAdditions, totalDeletions, err
 }
 
+// DiffStatsOptions options for DiffStats
+type DiffStatsOptions struct {
+	// DirectComparison compares base with head (..) instead of the merge base of both with head (...)
+	DirectComparison bool
+	// Paths limits the stats to the given paths
+	Paths []string
+	// WhitespaceOptions omit the ignored changes and the files only having ignored changes
+	WhitespaceOptions
+}
+
+// DiffFileStat represents the changed lines of a file
+type DiffFileStat struct {
+	Path string
+	// OldPath is the path before the file was renamed, it is empty if the file was not renamed
+	OldPath   string
+	Additions int
+	Deletions int
+	// IsBinary files have no line counts
+	IsBinary bool
+}
+
+// DiffStats represents the changed files, additions and deletions between two revisions
+type DiffStats struct {
+	NumFiles       int
+	TotalAdditions int
+	TotalDeletions int
+	Files          []*DiffFileStat
+}
+
+// DiffStats returns the total and per file number of additions and deletions between base and head.
+// Unrelated revisions are compared directly.
+func (repo *Repository) DiffStats(base, head string, opts DiffStatsOptions) (*DiffStats, error) {
+	separator := "..."
+	if opts.DirectComparison {
+		separator = ".."
+	}
+	stdout, stderr, err := NewCommand(repo.Ctx, "diff", "--numstat", "-z").AddArguments(opts.WhitespaceOptions.args()...).
+		AddDynamicArguments(base + separator + head).AddDashesAndList(opts.Paths...).RunStdString(&RunOpts{Dir: repo.Path})
+	if errors.Is(err, ErrNoMergeBase) {
+		// git >= 2.28 returns an error if base and head are unrelated, compare them directly like before
+		stdout, stderr, err = NewCommand(repo.Ctx, "diff", "--numstat", "-z").AddArguments(opts.WhitespaceOptions.args()...).
+			AddDynamicArguments(base, head).AddDashesAndList(opts.Paths...).RunStdString(&RunOpts{Dir: repo.Path})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to get diff stats of %s%s%s: %w", base, separator, head, ConcatenateError(err, stderr))
+	}
+	return parseDiffNumstat(stdout)
+}
+
+// parseDiffNumstat parses the output of git diff --numstat -z, which has entries of
+// "<additions> TAB <deletions> TAB <path> NUL", or for renames
+// "<additions> TAB <deletions> TAB NUL <old path> NUL <new path> NUL".
+// Binary files have "-" as additions and deletions.
+func parseDiffNumstat(stdout string) (*DiffStats, error) {
+	stats := &DiffStats{}
+	fields := strings.Split(strings.TrimSuffix(stdout, "\x00"), "\x00")
+	for i := 0; i < len(fields); i++ {
+		if fields[i] == "" {
+			continue
+		}
+		parts := strings.SplitN(fields[i], "\t", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("unable to parse numstat: %q", fields[i])
+		}
+		file := &DiffFileStat{Path: parts[2]}
+		if file.Path == "" {
+			if i+2 >= len(fields) {
+				return nil, fmt.Errorf("unable to parse numstat: %q is missing the paths of the rename", fields[i])
+			}
+			file.OldPath, file.Path = fields[i+1], fields[i+2]
+			i += 2
+		}
+		if parts[0] == "-" && parts[1] == "-" {
+			file.IsBinary = true
+		} else {
+			var err error
+			if file.Additions, err = strconv.Atoi(parts[0]); err != nil {
+				return nil, fmt.Errorf("unable to parse numstat: %q. Error parsing additions %w", fields[i], err)
+			}
+			if file.Deletions, err = strconv.Atoi(parts[1]); err != nil {
+				return nil, fmt.Errorf("unable to parse numstat: %q. Error parsing deletions %w", fields[i], err)
+			}
+		}
+		stats.NumFiles++
+		stats.TotalAdditions += file.Additions
+		stats.TotalDeletions += file.Deletions
+		stats.Files = append(stats.Files, file)
+	}
+	return stats, nil
+}
+
 // GetDiffOrPatch generates either diff or formatted patch data between given revisions
 func (repo *Repository) GetDiffOrPatch(base, head string, w io.Writer, patch, binary bool) error {
 	if patch {
@@ -271,7 +388,7 @@ func (repo *Repository) GetPatch(base, head string, w io.Writer) error {
 			Stdout: w,
 			Stderr: stderr,
 		})
-	if err != nil && bytes.Contains(stderr.Bytes(), []byte("no merge base")) {
+	if errors.Is(err, ErrNoMergeBase) {
 		return NewCommand(repo.Ctx, "format-patch", "--binary", "--stdout").AddDynamicArguments(base, head).
 			Run(&RunOpts{
 				Dir:    repo.Path,
@@ -299,7 +416,7 @@ func (repo *Repository) GetDiffFromMergeBase(base, head string, w io.Writer) err
 			Stdout: w,
 			Stderr: stderr,
 		})
-	if err != nil && bytes.Contains(stderr.Bytes(), []byte("no merge base")) {
+	if errors.Is(err, ErrNoMergeBase) {
 		return repo.GetDiffBinary(base, head, w)
 	}
 	return err
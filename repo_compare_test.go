@@ -120,3 +120,63 @@ func TestReadWritePullHead(t *testing.T) {
 	err = repo.RemoveReference(PullPrefix + "1/head")
 	assert.NoError(t, err)
 }
+
+func TestRepository_DiffStats(t *testing.T) {
+	bareRepo1Path := filepath.Join(testReposDir, "repo1_bare")
+	bareRepo1, err := openRepositoryWithDefaultContext(bareRepo1Path)
+	assert.NoError(t, err)
+	defer bareRepo1.Close()
+
+	stats, err := bareRepo1.DiffStats("branch2", "branch1", DiffStatsOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, &DiffStats{
+		NumFiles:       2,
+		TotalAdditions: 2,
+		TotalDeletions: 1,
+		Files: []*DiffFileStat{
+			{Path: "branch1.txt", Additions: 1},
+			{Path: "file1.txt", Additions: 1, Deletions: 1},
+		},
+	}, stats)
+
+	stats, err = bareRepo1.DiffStats("branch2", "branch1", DiffStatsOptions{DirectComparison: true})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, stats.NumFiles)
+	assert.Equal(t, 3, stats.TotalDeletions)
+
+	stats, err = bareRepo1.DiffStats("branch2", "branch1", DiffStatsOptions{DirectComparison: true, Paths: []string{"branch2"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []*DiffFileStat{{Path: "branch2/branch2.txt", Deletions: 1}}, stats.Files)
+
+	// unrelated revisions are compared directly
+	stats, err = bareRepo1.DiffStats("ca6b5ddf303169a72d2a2971acde4f6eea194e5c", "95bb4d39648ee7e325106df01a621c530863a653", DiffStatsOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, stats.NumFiles)
+
+	_, err = bareRepo1.DiffStats("branch2", "unknown", DiffStatsOptions{})
+	assert.Error(t, err)
+}
+
+func TestParseDiffNumstat(t *testing.T) {
+	stats, err := parseDiffNumstat("3\t1\tREADME.md\x00-\t-\timage.png\x002\t0\t\x00old.go\x00new.go\x00")
+	assert.NoError(t, err)
+	assert.Equal(t, &DiffStats{
+		NumFiles:       3,
+		TotalAdditions: 5,
+		TotalDeletions: 1,
+		Files: []*DiffFileStat{
+			{Path: "README.md", Additions: 3, Deletions: 1},
+			{Path: "image.png", IsBinary: true},
+			{Path: "new.go", OldPath: "old.go", Additions: 2},
+		},
+	}, stats)
+
+	stats, err = parseDiffNumstat("")
+	assert.NoError(t, err)
+	assert.Equal(t, &DiffStats{}, stats)
+
+	_, err = parseDiffNumstat("x\t1\tfile\x00")
+	assert.Error(t, err)
+	_, err = parseDiffNumstat("1\t1\t\x00old\x00")
+	assert.Error(t, err)
+}
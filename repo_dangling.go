@@ -0,0 +1,97 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DanglingObject is an object which is not referenced by any ref or other object
+type DanglingObject struct {
+	Type ObjectType
+	ID   ObjectID
+}
+
+// DanglingObjectsOptions options for GetDanglingObjects
+type DanglingObjectsOptions struct {
+	// IncludeReflogs treats the commits only reachable from reflog entries as reachable, like git fsck does by default.
+	// Otherwise the old tip of a force-pushed or deleted branch is dangling even if it is still in its reflog.
+	IncludeReflogs bool
+}
+
+// GetDanglingObjects lists the dangling objects of the repository like git fsck --dangling.
+// Only the tips of unreachable history are dangling, the commits and trees they reference are not listed.
+func (repo *Repository) GetDanglingObjects(opts DanglingObjectsOptions) ([]*DanglingObject, error) {
+	cmd := NewCommand(repo.Ctx, "fsck", "--dangling", "--connectivity-only", "--no-progress")
+	if !opts.IncludeReflogs {
+		cmd.AddArguments("--no-reflogs")
+	}
+	stdout, stderr, err := cmd.RunStdString(&RunOpts{Dir: repo.Path})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list dangling objects: %w", ConcatenateError(err, stderr))
+	}
+
+	var objects []*DanglingObject
+	for _, line := range strings.Split(stdout, "\n") {
+		// dangling <type> <id>
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] != "dangling" {
+			continue
+		}
+		id, err := repo.ObjectFormat().NewIDFromString(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid fsck output %q: %w", line, err)
+		}
+		objects = append(objects, &DanglingObject{Type: ObjectType(fields[1]), ID: id})
+	}
+	return objects, nil
+}
+
+// GetDanglingCommits returns the dangling commits, the most recently committed first.
+// These are e.g. the old tips of force-pushed or deleted branches which can be restored with RecoverDanglingCommit.
+func (repo *Repository) GetDanglingCommits(opts DanglingObjectsOptions) ([]*Commit, error) {
+	objects, err := repo.GetDanglingObjects(opts)
+	if err != nil {
+		return nil, err
+	}
+	var commits []*Commit
+	for _, object := range objects {
+		if object.Type != ObjectCommit {
+			continue
+		}
+		commit, err := repo.getCommit(object.ID)
+		if err != nil {
+			return nil, err
+		}
+		commits = append(commits, commit)
+	}
+	sort.SliceStable(commits, func(i, j int) bool {
+		return commits[i].Committer.When.After(commits[j].Committer.When)
+	})
+	return commits, nil
+}
+
+// RecoverDanglingCommit creates the ref pointing to the commit, e.g. to restore a force-pushed branch tip.
+// It fails if the ref already exists or the object is not a commit.
+func (repo *Repository) RecoverDanglingCommit(commitID, refName string) error {
+	typ, err := repo.objectType(commitID)
+	if err != nil {
+		return err
+	}
+	if typ != ObjectCommit {
+		return fmt.Errorf("%s is a %s, not a commit", commitID, typ)
+	}
+	return repo.UpdateRefs([]RefUpdate{{Action: RefActionCreate, Name: refName, NewValue: commitID}})
+}
+
+func (repo *Repository) objectType(id string) (ObjectType, error) {
+	stdout, _, err := NewCommand(repo.Ctx, "cat-file", "-t").AddDynamicArguments(id).RunStdString(&RunOpts{Dir: repo.Path})
+	if err != nil {
+		return "", ErrNotExist{ID: id}
+	}
+	return ObjectType(strings.TrimSpace(stdout)), nil
+}
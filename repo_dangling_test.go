@@ -0,0 +1,55 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository_DanglingObjects(t *testing.T) {
+	repoPath := filepath.Join(t.TempDir(), "repo.git")
+	assert.NoError(t, Clone(DefaultContext, filepath.Join(testReposDir, "repo1_bare"), repoPath, CloneRepoOptions{Bare: true}))
+	repo, err := openRepositoryWithDefaultContext(repoPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	sig := &Signature{Name: "Author", Email: "author@example.com", When: time.Now()}
+	// a force-pushed tip with a parent commit, only the tip is dangling
+	parent, err := repo.commitTreeID(sig, sig, "f1a6cb52b2d16773290cefe49ad0684b50a4f930", CommitTreeOpts{Parents: []string{"master"}, Message: "parent", NoGPGSign: true})
+	assert.NoError(t, err)
+	tip, err := repo.commitTreeID(sig, sig, "f1a6cb52b2d16773290cefe49ad0684b50a4f930", CommitTreeOpts{Parents: []string{parent.String()}, Message: "tip", NoGPGSign: true})
+	assert.NoError(t, err)
+	blob, err := repo.HashObject(strings.NewReader("dangling blob\n"))
+	assert.NoError(t, err)
+
+	objects, err := repo.GetDanglingObjects(DanglingObjectsOptions{})
+	assert.NoError(t, err)
+	assert.Contains(t, objects, &DanglingObject{Type: ObjectCommit, ID: tip})
+	assert.Contains(t, objects, &DanglingObject{Type: ObjectBlob, ID: blob})
+	assert.NotContains(t, objects, &DanglingObject{Type: ObjectCommit, ID: parent})
+
+	commits, err := repo.GetDanglingCommits(DanglingObjectsOptions{})
+	assert.NoError(t, err)
+	if assert.NotEmpty(t, commits) {
+		assert.Equal(t, tip, commits[0].ID)
+	}
+
+	assert.Error(t, repo.RecoverDanglingCommit(blob.String(), "refs/heads/blob"))
+	assert.True(t, IsErrNotExist(repo.RecoverDanglingCommit("0000000000000000000000000000000000000001", "refs/heads/missing")))
+	assert.Error(t, repo.RecoverDanglingCommit(tip.String(), "refs/heads/master"))
+	assert.NoError(t, repo.RecoverDanglingCommit(tip.String(), "refs/heads/restored"))
+	id, err := repo.GetRefCommitID("refs/heads/restored")
+	assert.NoError(t, err)
+	assert.Equal(t, tip.String(), id)
+
+	objects, err = repo.GetDanglingObjects(DanglingObjectsOptions{})
+	assert.NoError(t, err)
+	assert.NotContains(t, objects, &DanglingObject{Type: ObjectCommit, ID: tip})
+}
@@ -0,0 +1,101 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrNoTagFound is returned by Describe if no tag is reachable from the commit and Always is not set
+var ErrNoTagFound = errors.New("no tag found to describe the commit")
+
+// DescribeOptions options for describing a commit with git describe
+type DescribeOptions struct {
+	// Tags also uses lightweight tags, otherwise only annotated tags are used
+	Tags bool
+	// Long formats exact matches as <tag>-0-g<id> as well
+	Long bool
+	// Match only uses tags matching one of the glob patterns
+	Match []string
+	// Abbrev is the length of the abbreviated commit id, git picks the length if zero
+	Abbrev int
+	// Always describes the commit by its abbreviated id if no tag is found
+	Always bool
+}
+
+// DescribeResult is a commit described relative to the closest tag
+type DescribeResult struct {
+	// Tag is the closest tag, it is empty if no tag was found and Always was set
+	Tag string
+	// Distance is the number of commits since Tag
+	Distance int
+	// ShortID is the abbreviated commit id
+	ShortID string
+
+	long bool
+}
+
+// String formats the result like git describe
+func (r *DescribeResult) String() string {
+	switch {
+	case r.Tag == "":
+		return r.ShortID
+	case r.Distance == 0 && !r.long:
+		return r.Tag
+	default:
+		return fmt.Sprintf("%s-%d-g%s", r.Tag, r.Distance, r.ShortID)
+	}
+}
+
+var describeLongPattern = regexp.MustCompile(`^(.+)-(\d+)-g([0-9a-f]+)$`)
+
+// Describe describes the commit by the closest tag reachable from it
+func (repo *Repository) Describe(commitish string, opts DescribeOptions) (*DescribeResult, error) {
+	// always ask for the long format, tags containing dashes could be mistaken for it otherwise
+	cmd := NewCommand(repo.Ctx, "describe", "--long")
+	if opts.Tags {
+		cmd.AddArguments("--tags")
+	}
+	for _, pattern := range opts.Match {
+		cmd.AddArguments("--match").AddDynamicArguments(pattern)
+	}
+	if opts.Abbrev > 0 {
+		cmd.AddOptionFormat("--abbrev=%d", opts.Abbrev)
+	}
+	if opts.Always {
+		cmd.AddArguments("--always")
+	}
+	cmd.AddDynamicArguments(commitish)
+
+	stdout, stderr, err := cmd.RunStdString(&RunOpts{Dir: repo.Path})
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrUnknownRevision):
+			return nil, ErrNotExist{ID: commitish}
+		case strings.Contains(stderr, "No names found") || strings.Contains(stderr, "No tags can describe") ||
+			strings.Contains(stderr, "No annotated tags can describe"):
+			return nil, ErrNoTagFound
+		}
+		return nil, fmt.Errorf("unable to describe %s: %w", commitish, ConcatenateError(err, stderr))
+	}
+	return parseDescribe(strings.TrimSpace(stdout), opts.Long)
+}
+
+func parseDescribe(output string, long bool) (*DescribeResult, error) {
+	matches := describeLongPattern.FindStringSubmatch(output)
+	if matches == nil {
+		// --always without a tag only prints the abbreviated id
+		return &DescribeResult{ShortID: output, long: long}, nil
+	}
+	distance, err := strconv.Atoi(matches[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid describe output: %s", output)
+	}
+	return &DescribeResult{Tag: matches[1], Distance: distance, ShortID: matches[3], long: long}, nil
+}
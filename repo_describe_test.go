@@ -0,0 +1,59 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository_Describe(t *testing.T) {
+	repo, err := openRepositoryWithDefaultContext(filepath.Join(testReposDir, "repo1_bare"))
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	result, err := repo.Describe("master", DescribeOptions{Abbrev: 7})
+	assert.NoError(t, err)
+	assert.Equal(t, "test", result.Tag)
+	assert.Equal(t, 1, result.Distance)
+	assert.Equal(t, "feaf4ba", result.ShortID)
+	assert.Equal(t, "test-1-gfeaf4ba", result.String())
+
+	// the commit of the tag
+	result, err = repo.Describe("37991dec2c8e592043f47155ce4808d4580f9123", DescribeOptions{Abbrev: 7})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, result.Distance)
+	assert.Equal(t, "test", result.String())
+	result, err = repo.Describe("37991dec2c8e592043f47155ce4808d4580f9123", DescribeOptions{Abbrev: 7, Long: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "test-0-g37991de", result.String())
+
+	_, err = repo.Describe("branch1", DescribeOptions{})
+	assert.ErrorIs(t, err, ErrNoTagFound)
+	result, err = repo.Describe("branch1", DescribeOptions{Abbrev: 7, Always: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "", result.Tag)
+	assert.Equal(t, "2839944", result.ShortID)
+	assert.Equal(t, "2839944", result.String())
+
+	_, err = repo.Describe("master", DescribeOptions{Match: []string{"v*"}})
+	assert.ErrorIs(t, err, ErrNoTagFound)
+
+	_, err = repo.Describe("unknown", DescribeOptions{})
+	assert.True(t, IsErrNotExist(err))
+}
+
+func TestParseDescribe(t *testing.T) {
+	result, err := parseDescribe("v1-2-gabc-3-g1234567", false)
+	assert.NoError(t, err)
+	assert.Equal(t, &DescribeResult{Tag: "v1-2-gabc", Distance: 3, ShortID: "1234567"}, result)
+
+	result, err = parseDescribe("1234567", true)
+	assert.NoError(t, err)
+	assert.Equal(t, "", result.Tag)
+	assert.Equal(t, "1234567", result.ShortID)
+}
@@ -0,0 +1,213 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// WhitespaceOptions configures which whitespace changes are ignored when comparing files
+type WhitespaceOptions struct {
+	// IgnoreWhitespace ignores all whitespace like -w
+	IgnoreWhitespace bool
+	// IgnoreWhitespaceChange ignores changes in the amount of whitespace like -b
+	IgnoreWhitespaceChange bool
+	// IgnoreWhitespaceAtEOL ignores whitespace changes at the end of lines like --ignore-space-at-eol
+	IgnoreWhitespaceAtEOL bool
+	// IgnoreBlankLines ignores added and removed blank lines like --ignore-blank-lines
+	IgnoreBlankLines bool
+}
+
+func (o WhitespaceOptions) isSet() bool {
+	return o.IgnoreWhitespace || o.IgnoreWhitespaceChange || o.IgnoreWhitespaceAtEOL || o.IgnoreBlankLines
+}
+
+func (o WhitespaceOptions) args() []CmdArg {
+	var args []CmdArg
+	if o.IgnoreWhitespace {
+		args = append(args, "-w")
+	}
+	if o.IgnoreWhitespaceChange {
+		args = append(args, "-b")
+	}
+	if o.IgnoreWhitespaceAtEOL {
+		args = append(args, "--ignore-space-at-eol")
+	}
+	if o.IgnoreBlankLines {
+		args = append(args, "--ignore-blank-lines")
+	}
+	return args
+}
+
+// DiffOptions represents the possible options to GetParsedDiff
+type DiffOptions struct {
+	// ContextLines is passed to git as -U<n> when greater than zero
+	ContextLines int
+	// MaxFiles and MaxLines limit the parsed result, the diff is marked as incomplete when they are reached
+	MaxFiles int
+	MaxLines int
+	// Paths limits the diff to the given paths
+	Paths []string
+	// WhitespaceOptions configure which whitespace changes are ignored
+	WhitespaceOptions
+	// RenameDetection configures the detection of renamed and copied files, diff.renames of the git config is used if nil
+	RenameDetection *RenameDetection
+	// Intraline marks the changed words of changed lines, see Diff.RefineIntraline
+	Intraline bool
+	// Binary includes the content of binary files as "GIT binary patch", so the diff can be applied
+	Binary bool
+}
+
+// GetParsedDiff parses the diff between the given revisions.
+// An empty base compares head against its first parent, or the empty tree for a root commit.
+// Changed gitlinks are reported as DiffFile.Submodule with the URL of their submodule.
+func (repo *Repository) GetParsedDiff(base, head string, opts DiffOptions) (*Diff, error) {
+	cmd, base, err := repo.diffCommand(base, head, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	stdoutReader, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = stdoutReader.Close()
+		_ = stdoutWriter.Close()
+	}()
+
+	var diff *Diff
+	stderr := new(strings.Builder)
+	err = cmd.Run(&RunOpts{
+		Dir:    repo.Path,
+		Stdout: stdoutWriter,
+		Stderr: stderr,
+		PipelineFunc: func(ctx context.Context, cancel context.CancelFunc) error {
+			_ = stdoutWriter.Close()
+			rd := bufio.NewReader(stdoutReader)
+			var err error
+			diff, err = ParseDiff(rd, ParseDiffOptions{
+				MaxFiles: opts.MaxFiles,
+				MaxLines: opts.MaxLines,
+			})
+			if err != nil {
+				return err
+			}
+			if opts.Intraline {
+				diff.RefineIntraline()
+			}
+			if diff.IsIncomplete {
+				// the rest of the diff isn't needed, stop git instead of reading it
+				cancel()
+			}
+			return nil
+		},
+	})
+	if err != nil && !(diff != nil && diff.IsIncomplete && errors.Is(err, context.Canceled)) {
+		return nil, fmt.Errorf("unable to get diff between %s and %s: %w", base, head, ConcatenateError(err, stderr.String()))
+	}
+
+	var submodules []*SubmoduleChange
+	for _, file := range diff.Files {
+		if file.Submodule != nil {
+			submodules = append(submodules, file.Submodule)
+		}
+	}
+	if err := repo.resolveSubmoduleURLs(base, head, submodules); err != nil {
+		return nil, err
+	}
+	return diff, nil
+}
+
+// WriteDiff writes the unified diff between the given revisions to w, see GetParsedDiff for an empty base.
+// With opts.Binary the diff can be applied with git apply, including the changes of binary files.
+func (repo *Repository) WriteDiff(base, head string, w io.Writer, opts DiffOptions) error {
+	cmd, base, err := repo.diffCommand(base, head, opts)
+	if err != nil {
+		return err
+	}
+	stderr := new(strings.Builder)
+	if err := cmd.Run(&RunOpts{Dir: repo.Path, Stdout: w, Stderr: stderr}); err != nil {
+		return fmt.Errorf("unable to get diff between %s and %s: %w", base, head, ConcatenateError(err, stderr.String()))
+	}
+	return nil
+}
+
+// GetFileDiff writes the unified diff of a single path between the given revisions to w while git produces it,
+// see GetParsedDiff for an empty base. The paths of opts are ignored.
+func (repo *Repository) GetFileDiff(base, head, path string, w io.Writer, opts DiffOptions) error {
+	opts.Paths = []string{path}
+	return repo.WriteDiff(base, head, w, opts)
+}
+
+// GetBinaryChangedFiles returns the paths of the changed binary files between the given revisions,
+// see GetParsedDiff for an empty base. Files are binary by their content or by the binary and -diff attributes.
+func (repo *Repository) GetBinaryChangedFiles(base, head string, paths ...string) ([]string, error) {
+	base, err := repo.diffBase(base, head)
+	if err != nil {
+		return nil, err
+	}
+	stdout, stderr, runErr := NewCommand(repo.Ctx, "diff", "--numstat", "-z", "--no-ext-diff").AddDynamicArguments(base, head).
+		AddDashesAndList(paths...).RunStdString(&RunOpts{Dir: repo.Path})
+	if runErr != nil {
+		return nil, fmt.Errorf("unable to get diff stats between %s and %s: %w", base, head, ConcatenateError(runErr, stderr))
+	}
+	stats, err := parseDiffNumstat(stdout)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, file := range stats.Files {
+		if file.IsBinary {
+			files = append(files, file.Path)
+		}
+	}
+	return files, nil
+}
+
+// diffCommand returns the git diff command for the options and the base it compares with
+func (repo *Repository) diffCommand(base, head string, opts DiffOptions) (*Command, string, error) {
+	base, err := repo.diffBase(base, head)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// gitlinks are always shown as "Subproject commit" lines, whatever diff.submodule is configured to
+	cmd := NewCommand(repo.Ctx, "diff", "-p", "--no-color", "--no-ext-diff", "--submodule=short")
+	if opts.ContextLines > 0 {
+		cmd.AddArguments(CmdArg("-U" + strconv.Itoa(opts.ContextLines)))
+	}
+	cmd.AddArguments(opts.WhitespaceOptions.args()...)
+	if opts.RenameDetection != nil {
+		cmd.AddArguments(opts.RenameDetection.args()...)
+	}
+	if opts.Binary {
+		cmd.AddArguments("--binary")
+	}
+	cmd.AddDynamicArguments(base, head).AddDashesAndList(opts.Paths...)
+	return cmd, base, nil
+}
+
+// diffBase returns the first parent of head if base is empty, or the empty tree for a root commit
+func (repo *Repository) diffBase(base, head string) (string, error) {
+	if base != "" {
+		return base, nil
+	}
+	commit, err := repo.GetCommit(head)
+	if err != nil {
+		return "", err
+	}
+	if commit.ParentCount() == 0 {
+		return repo.ObjectFormat().EmptyTree().String(), nil
+	}
+	return commit.Parents[0].String(), nil
+}
@@ -0,0 +1,183 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/enverbisevac/gitlib/util"
+)
+
+// FetchTagsMode controls which tags are fetched
+type FetchTagsMode int
+
+const (
+	// FetchTagsDefault fetches the tags pointing into the fetched history
+	FetchTagsDefault FetchTagsMode = iota
+	// FetchTagsAll fetches all tags, git fetch --tags
+	FetchTagsAll
+	// FetchTagsNone does not fetch tags, git fetch --no-tags
+	FetchTagsNone
+)
+
+// FetchOptions options when fetching from a remote
+type FetchOptions struct {
+	// Remote is the name or the URL of the remote, "origin" if empty
+	Remote string
+	// Refspecs to fetch, the configured refspecs of the remote are used if empty
+	Refspecs []string
+	Prune    bool
+	Depth    int
+	// Deepen fetches the given number of additional commits of the history of a shallow repository
+	Deepen int
+	// ShallowSince and ShallowExclude limit the fetched history by commit date or by excluding the history of the given refs
+	ShallowSince   time.Time
+	ShallowExclude []string
+	// Unshallow fetches the complete history of a shallow repository
+	Unshallow bool
+	Tags      FetchTagsMode
+	// Force allows non-fast-forward updates of all refspecs
+	Force bool
+	// Credentials authenticate against the remote
+	Credentials *Credentials
+	Env         []string
+	Timeout     time.Duration
+}
+
+// Fetch fetches from a remote into the repository.
+// Failures are reported as ErrAuthenticationFailed, ErrRemoteNotFound or ErrFetchRejected if they can be detected.
+func Fetch(ctx context.Context, repoPath string, opts FetchOptions) error {
+	if opts.Remote == "" {
+		opts.Remote = "origin"
+	}
+	if skipDryRun(ctx, "fetch %s %v (prune: %t) [repo_path: %s]", util.SanitizeCredentialURLs(opts.Remote), opts.Refspecs, opts.Prune, repoPath) {
+		return nil
+	}
+
+	cmd := NewCommand(ctx, "fetch")
+	if opts.Prune {
+		cmd.AddArguments("--prune")
+	}
+	if opts.Depth > 0 {
+		cmd.AddArguments("--depth").AddDynamicArguments(strconv.Itoa(opts.Depth))
+	}
+	if opts.Deepen > 0 {
+		cmd.AddOptionFormat("--deepen=%d", opts.Deepen)
+	}
+	addShallowArguments(cmd, opts.ShallowSince, opts.ShallowExclude)
+	if opts.Unshallow {
+		cmd.AddArguments("--unshallow")
+	}
+	switch opts.Tags {
+	case FetchTagsAll:
+		cmd.AddArguments("--tags")
+	case FetchTagsNone:
+		cmd.AddArguments("--no-tags")
+	}
+	if opts.Force {
+		cmd.AddArguments("--force")
+	}
+	cmd.AddDashesAndList(append([]string{opts.Remote}, opts.Refspecs...)...)
+	cmd.SetDescription(fmt.Sprintf("fetch %s from %s into %s", strings.Join(opts.Refspecs, " "), util.SanitizeCredentialURLs(opts.Remote), repoPath))
+
+	// never wait for credentials on a terminal, a missing credential is reported as ErrAuthenticationFailed
+	envs := append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	u, err := url.Parse(opts.Remote)
+	if err == nil && (strings.EqualFold(u.Scheme, "http") || strings.EqualFold(u.Scheme, "https")) {
+		if Match(u.Host) {
+			envs = append(envs, fmt.Sprintf("https_proxy=%s", GetProxyURL()))
+		}
+	}
+	envs, cleanup, err := opts.Credentials.env(append(envs, opts.Env...))
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	stderr := new(bytes.Buffer)
+	if err := cmd.Run(&RunOpts{
+		Timeout: opts.Timeout,
+		Dir:     repoPath,
+		Env:     envs,
+		Stdout:  io.Discard,
+		Stderr:  stderr,
+	}); err != nil {
+		return parseFetchError(util.SanitizeCredentialURLs(opts.Remote), stderr.String(), err)
+	}
+	return nil
+}
+
+var (
+	fetchAuthFailedMessages = []string{
+		"Authentication failed",
+		"could not read Username",
+		"could not read Password",
+		"terminal prompts disabled",
+		"Permission denied (publickey",
+		"HTTP Basic: Access denied",
+		"The requested URL returned error: 401",
+		"The requested URL returned error: 403",
+	}
+	fetchNotFoundMessages = []string{
+		"does not appear to be a git repository",
+		"Repository not found",
+		"repository not found",
+		"does not exist",
+		"couldn't find remote ref",
+		"The requested URL returned error: 404",
+	}
+)
+
+// addShallowArguments adds the --shallow-since and --shallow-exclude options shared by clone and fetch
+func addShallowArguments(cmd *Command, since time.Time, exclude []string) {
+	if !since.IsZero() {
+		cmd.AddOptionFormat("--shallow-since=%s", since.Format(time.RFC3339))
+	}
+	for _, ref := range exclude {
+		cmd.AddOptionFormat("--shallow-exclude=%s", ref)
+	}
+}
+
+func parseFetchError(remote, stderr string, err error) error {
+	stderr = util.SanitizeCredentialURLs(stderr)
+	for _, msg := range fetchAuthFailedMessages {
+		if strings.Contains(stderr, msg) {
+			return &ErrAuthenticationFailed{Remote: remote, StdErr: stderr, Err: err}
+		}
+	}
+
+	// e.g. " ! [rejected]        main       -> origin/main  (non-fast-forward)"
+	var rejected []string
+	for _, line := range strings.Split(stderr, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "! [rejected]") || !strings.Contains(line, "(non-fast-forward)") {
+			continue
+		}
+		_, dst, ok := strings.Cut(line, "->")
+		if !ok {
+			continue
+		}
+		dst = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(dst), "(non-fast-forward)"))
+		rejected = append(rejected, dst)
+	}
+	if len(rejected) > 0 {
+		return &ErrFetchRejected{Refs: rejected, StdErr: stderr, Err: err}
+	}
+
+	for _, msg := range fetchNotFoundMessages {
+		if strings.Contains(stderr, msg) {
+			return &ErrRemoteNotFound{Remote: remote, StdErr: stderr, Err: err}
+		}
+	}
+	return fmt.Errorf("unable to fetch from %s: %w", remote, ConcatenateError(err, stderr))
+}
@@ -0,0 +1,75 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/enverbisevac/gitlib/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetch(t *testing.T) {
+	bareRepo1Path, err := filepath.Abs(filepath.Join(testReposDir, "repo1_bare"))
+	assert.NoError(t, err)
+
+	repoPath := t.TempDir()
+	repo, err := InitRepository(DefaultContext, repoPath, InitWithBare(true))
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	assert.NoError(t, Fetch(DefaultContext, repoPath, FetchOptions{
+		Remote:   bareRepo1Path,
+		Refspecs: []string{"refs/heads/master:refs/heads/master"},
+		Tags:     FetchTagsNone,
+	}))
+	stdout, _, err := NewCommand(DefaultContext, "rev-parse", "refs/heads/master").RunStdString(&RunOpts{Dir: repoPath})
+	assert.NoError(t, err)
+	assert.Equal(t, "feaf4ba6bc635fec442f46ddd4512416ec43c2c2", strings.TrimSpace(stdout))
+	stdout, _, err = NewCommand(DefaultContext, "tag").RunStdString(&RunOpts{Dir: repoPath})
+	assert.NoError(t, err)
+	assert.Empty(t, stdout)
+
+	// branch1 does not contain master
+	err = Fetch(DefaultContext, repoPath, FetchOptions{
+		Remote:   bareRepo1Path,
+		Refspecs: []string{"refs/heads/branch1:refs/heads/master"},
+	})
+	if assert.True(t, IsErrFetchRejected(err), "%v", err) {
+		assert.Equal(t, []string{"master"}, err.(*ErrFetchRejected).Refs)
+	}
+
+	assert.NoError(t, Fetch(DefaultContext, repoPath, FetchOptions{
+		Remote:   bareRepo1Path,
+		Refspecs: []string{"refs/heads/branch1:refs/heads/master"},
+		Force:    true,
+	}))
+
+	err = Fetch(DefaultContext, repoPath, FetchOptions{
+		Remote:   bareRepo1Path,
+		Refspecs: []string{"refs/heads/missing"},
+	})
+	assert.True(t, IsErrRemoteNotFound(err), "%v", err)
+
+	err = Fetch(DefaultContext, repoPath, FetchOptions{Remote: filepath.Join(t.TempDir(), "missing")})
+	assert.True(t, IsErrRemoteNotFound(err), "%v", err)
+	// both the not exist error and the error of the command are kept
+	assert.ErrorIs(t, err, util.ErrNotExist)
+	var exitErr *exec.ExitError
+	assert.ErrorAs(t, err, &exitErr)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="git"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+	err = Fetch(DefaultContext, repoPath, FetchOptions{Remote: server.URL + "/repo.git"})
+	assert.True(t, IsErrAuthenticationFailed(err), "%v", err)
+}
@@ -6,54 +6,164 @@
 package git
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
 	"strings"
 
 	"github.com/enverbisevac/gitlib/process"
 )
 
-// LoadPublicKeyContent will load the key from gpg
-func (gpgSettings *GPGSettings) LoadPublicKeyContent() error {
-	content, stderr, err := process.GetManager().Exec(
-		"gpg -a --export",
-		"gpg", "-a", "--export", gpgSettings.KeyID)
+// PublicKey returns the armored public key from gpg, or the ssh public keys if the format is ssh.
+// The key is loaded once for the settings returned by GetDefaultPublicGPGKey, and by each call for other settings.
+func (gpgSettings *GPGSettings) PublicKey() (string, error) {
+	if gpgSettings.publicKey == nil {
+		return gpgSettings.exportPublicKey()
+	}
+	gpgSettings.publicKey.once.Do(func() {
+		gpgSettings.publicKey.content, gpgSettings.publicKey.err = gpgSettings.exportPublicKey()
+	})
+	return gpgSettings.publicKey.content, gpgSettings.publicKey.err
+}
+
+func (gpgSettings *GPGSettings) exportPublicKey() (string, error) {
+	if gpgSettings.KeyID == "" {
+		return "", errors.New("no signing key configured")
+	}
+	ctx := gpgSettings.ctx
+	if ctx == nil {
+		ctx = DefaultContext
+	}
+
+	if gpgSettings.Format == SigningFormatSSH {
+		key, err := sshPublicKey(ctx, gpgSettings.Program, gpgSettings.KeyID)
+		if err != nil {
+			return "", err
+		}
+		return key + "\n", nil
+	}
+
+	program := gpgSettings.Program
+	if program == "" {
+		program = "gpg"
+	}
+	content, stderr, err := process.GetManager().ExecDir(ctx, -1, "", "gpg -a --export", program, "-a", "--export", gpgSettings.KeyID)
 	if err != nil {
-		return fmt.Errorf("Unable to get default signing key: %s, %s, %w", gpgSettings.KeyID, stderr, err)
+		return "", fmt.Errorf("Unable to get default signing key: %s, %s, %w", gpgSettings.KeyID, stderr, err)
 	}
-	gpgSettings.PublicKeyContent = content
-	return nil
+	return content, nil
 }
 
-// GetDefaultPublicGPGKey will return and cache the default public GPG settings for this repository
+// sshPublicKey returns the public key of a user.signingkey, which is either a public key, possibly
+// prefixed with "key::", or the path to a public or private key
+func sshPublicKey(ctx context.Context, program, keyID string) (string, error) {
+	if literal := strings.TrimPrefix(keyID, "key::"); literal != keyID || strings.HasPrefix(keyID, "ssh-") {
+		return strings.TrimSpace(literal), nil
+	}
+
+	for _, path := range []string{keyID + ".pub", keyID} {
+		content, err := os.ReadFile(path)
+		if err == nil && strings.HasPrefix(string(content), "ssh-") {
+			return strings.TrimSpace(string(content)), nil
+		} else if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+
+	// a private key without its public key next to it
+	if program == "" {
+		program = "ssh-keygen"
+	}
+	content, stderr, err := process.GetManager().ExecDir(ctx, -1, "", "ssh-keygen -y", program, "-y", "-f", keyID)
+	if err != nil {
+		return "", fmt.Errorf("unable to get public key of ssh signing key %s: %w", keyID, ConcatenateError(err, stderr))
+	}
+	return strings.TrimSpace(content), nil
+}
+
+// GetDefaultPublicGPGKey will return and cache the default public GPG settings for this repository.
+// The settings merge the config of the repository with the global one. The public key is not loaded,
+// call PublicKey to load it.
 func (repo *Repository) GetDefaultPublicGPGKey(forceUpdate bool) (*GPGSettings, error) {
 	if repo.gpgSettings != nil && !forceUpdate {
 		return repo.gpgSettings, nil
 	}
 
+	config, err := repo.configList()
+	if err != nil {
+		return nil, err
+	}
+
 	gpgSettings := &GPGSettings{
-		Sign: true,
+		Sign:      true,
+		ctx:       repo.Ctx,
+		publicKey: &publicKey{},
 	}
 
-	value, _, _ := NewCommand(repo.Ctx, "config", "--get", "commit.gpgsign").RunStdString(&RunOpts{Dir: repo.Path})
-	sign, valid := ParseBool(strings.TrimSpace(value))
+	sign, valid := ParseBool(config.get("commit.gpgsign"))
 	if !sign || !valid {
 		gpgSettings.Sign = false
 		repo.gpgSettings = gpgSettings
 		return gpgSettings, nil
 	}
 
-	signingKey, _, _ := NewCommand(repo.Ctx, "config", "--get", "user.signingkey").RunStdString(&RunOpts{Dir: repo.Path})
-	gpgSettings.KeyID = strings.TrimSpace(signingKey)
-
-	defaultEmail, _, _ := NewCommand(repo.Ctx, "config", "--get", "user.email").RunStdString(&RunOpts{Dir: repo.Path})
-	gpgSettings.Email = strings.TrimSpace(defaultEmail)
+	gpgSettings.Format = config.get("gpg.format")
+	if gpgSettings.Format == "" {
+		gpgSettings.Format = SigningFormatOpenPGP
+	}
+	switch gpgSettings.Format {
+	case SigningFormatOpenPGP:
+		gpgSettings.Program = config.get("gpg.program")
+		if gpgSettings.Program == "" {
+			gpgSettings.Program = config.get("gpg.openpgp.program")
+		}
+	case SigningFormatSSH:
+		gpgSettings.Program = config.get("gpg.ssh.program")
+	default:
+		return nil, fmt.Errorf("unsupported signing format: %s", gpgSettings.Format)
+	}
 
-	defaultName, _, _ := NewCommand(repo.Ctx, "config", "--get", "user.name").RunStdString(&RunOpts{Dir: repo.Path})
-	gpgSettings.Name = strings.TrimSpace(defaultName)
+	// like git, the value of the most specific config level is used
+	gpgSettings.KeyID = config.get("user.signingkey")
+	gpgSettings.Email = config.get("user.email")
+	gpgSettings.Name = config.get("user.name")
 
-	if err := gpgSettings.LoadPublicKeyContent(); err != nil {
-		return nil, err
-	}
 	repo.gpgSettings = gpgSettings
 	return repo.gpgSettings, nil
 }
+
+// gitConfig are the values of the config variables, keyed by the name of the variable whose section and key git lower cases
+type gitConfig map[string][]string
+
+// get returns the last value of key, which takes precedence
+func (c gitConfig) get(key string) string {
+	values := c[key]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[len(values)-1]
+}
+
+// configList reads the config of the repository merged with the system and global config, in that order
+func (repo *Repository) configList() (gitConfig, error) {
+	stdout, _, err := NewCommand(repo.Ctx, "config", "-z", "--list").RunStdString(&RunOpts{Dir: repo.Path})
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config: %w", err)
+	}
+	return parseConfigList(stdout), nil
+}
+
+// parseConfigList parses the output of git config -z --list, the variables are separated by NUL and
+// the value follows the name after a newline, the newline is omitted for a variable without value
+func parseConfigList(data string) gitConfig {
+	config := gitConfig{}
+	for _, entry := range strings.Split(data, "\x00") {
+		if entry == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(entry, "\n")
+		config[key] = append(config[key], value)
+	}
+	return config
+}
@@ -0,0 +1,150 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CommitGraphOptions options for GetCommitGraph
+type CommitGraphOptions struct {
+	// Revisions to draw, all refs are used if empty
+	Revisions []string
+	// Skip the first commits and return at most MaxCount commits, all commits are returned if MaxCount is 0.
+	// The lanes are assigned within the returned page.
+	Skip     int
+	MaxCount int
+}
+
+// GraphEdge is the line from a commit to one of its parents
+type GraphEdge struct {
+	Parent ObjectID
+	// Column is the lane the line continues in below the commit, until it reaches the row of the parent
+	Column int
+}
+
+// GraphCommit is a commit placed in the commit graph
+type GraphCommit struct {
+	ID      ObjectID
+	Parents []ObjectID
+	// Children are the commits of the graph having this commit as parent
+	Children []ObjectID
+	// Row is the position of the commit in the graph, Column the lane it is drawn in
+	Row    int
+	Column int
+	// Edges to the parents, in the order of Parents
+	Edges []GraphEdge
+}
+
+// GetCommitGraph returns the commits in date order with their position in the commit graph,
+// which is the data git log --graph draws, so the graph can be rendered without parsing it.
+func (repo *Repository) GetCommitGraph(opts CommitGraphOptions) ([]*GraphCommit, error) {
+	cmd := NewCommand(repo.Ctx, "log", "--date-order", "--format=%H %P")
+	if opts.Skip > 0 {
+		cmd.AddArguments(CmdArg("--skip=" + strconv.Itoa(opts.Skip)))
+	}
+	if opts.MaxCount > 0 {
+		cmd.AddArguments(CmdArg("--max-count=" + strconv.Itoa(opts.MaxCount)))
+	}
+	if len(opts.Revisions) == 0 {
+		cmd.AddArguments("--all")
+	}
+	cmd.AddDynamicArguments(opts.Revisions...)
+	cmd.AddArguments("--")
+
+	stdout, stderr, err := cmd.RunStdString(&RunOpts{Dir: repo.Path})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get commit graph: %w", ConcatenateError(err, stderr))
+	}
+
+	var commits []*GraphCommit
+	byID := make(map[ObjectID]*GraphCommit)
+	for _, line := range strings.Split(strings.TrimSpace(stdout), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		commit := &GraphCommit{Row: len(commits)}
+		for i, field := range fields {
+			id, err := repo.ObjectFormat().NewIDFromString(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid log output %q: %w", line, err)
+			}
+			if i == 0 {
+				commit.ID = id
+			} else {
+				commit.Parents = append(commit.Parents, id)
+			}
+		}
+		commits = append(commits, commit)
+		byID[commit.ID] = commit
+	}
+
+	for _, commit := range commits {
+		for _, parent := range commit.Parents {
+			if p, ok := byID[parent]; ok {
+				p.Children = append(p.Children, commit.ID)
+			}
+		}
+	}
+	assignGraphLanes(commits)
+	return commits, nil
+}
+
+// assignGraphLanes places the commits in lanes, each lane holding the commit expected next in it.
+// A commit takes the leftmost lane expecting it, its first parent always continues in the same lane
+// and the other parents join a lane already expecting them or open a new one.
+func assignGraphLanes(commits []*GraphCommit) {
+	var lanes []ObjectID
+	freeLane := func() int {
+		for i, lane := range lanes {
+			if lane == nil {
+				return i
+			}
+		}
+		lanes = append(lanes, nil)
+		return len(lanes) - 1
+	}
+	laneOf := func(id ObjectID) int {
+		for i, lane := range lanes {
+			if lane != nil && lane == id {
+				return i
+			}
+		}
+		return -1
+	}
+
+	for _, commit := range commits {
+		column := laneOf(commit.ID)
+		if column < 0 {
+			column = freeLane()
+		}
+		// all lines leading to this commit end here
+		for i, lane := range lanes {
+			if lane != nil && lane == commit.ID {
+				lanes[i] = nil
+			}
+		}
+		commit.Column = column
+
+		for i, parent := range commit.Parents {
+			parentColumn := column
+			if i > 0 {
+				if parentColumn = laneOf(parent); parentColumn < 0 {
+					parentColumn = freeLane()
+				}
+			}
+			lanes[parentColumn] = parent
+			commit.Edges = append(commit.Edges, GraphEdge{Parent: parent, Column: parentColumn})
+		}
+
+		// drop free lanes at the right edge to keep the graph narrow
+		for len(lanes) > 0 && lanes[len(lanes)-1] == nil {
+			lanes = lanes[:len(lanes)-1]
+		}
+	}
+}
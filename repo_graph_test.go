@@ -0,0 +1,82 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository_GetCommitGraph(t *testing.T) {
+	bareRepo1Path := filepath.Join(testReposDir, "repo1_bare")
+	bareRepo1, err := openRepositoryWithDefaultContext(bareRepo1Path)
+	assert.NoError(t, err)
+	defer bareRepo1.Close()
+
+	commits, err := bareRepo1.GetCommitGraph(CommitGraphOptions{})
+	assert.NoError(t, err)
+
+	// * feaf4ba
+	// | * ca6b5dd
+	// * 37991de
+	// * 6fbd69e
+	// * 8006ff9
+	// | * 5c80b02
+	// |/
+	// * 8d92fc9
+	// | * 2839944
+	// | * 9c9aef8
+	// |/
+	// * 95bb4d3
+	type position struct {
+		id     string
+		column int
+	}
+	var positions []position
+	for i, commit := range commits {
+		assert.Equal(t, i, commit.Row)
+		positions = append(positions, position{commit.ID.String()[:7], commit.Column})
+	}
+	assert.Equal(t, []position{
+		{"feaf4ba", 0}, {"ca6b5dd", 1}, {"37991de", 0}, {"6fbd69e", 0}, {"8006ff9", 0},
+		{"5c80b02", 1}, {"8d92fc9", 0}, {"2839944", 1}, {"9c9aef8", 1}, {"95bb4d3", 0},
+	}, positions)
+
+	assert.Equal(t, []GraphEdge{{Parent: MustIDFromString("8d92fc957a4d7cfd98bc375f0b7bb189a0d6c9f2"), Column: 1}}, commits[5].Edges)
+	assert.Equal(t, []ObjectID{
+		MustIDFromString("8006ff9adbf0cb94da7dad9e537e53817f9fa5c0"),
+		MustIDFromString("5c80b0245c1c6f8343fa418ec374b13b5d4ee658"),
+	}, commits[6].Children)
+	assert.Empty(t, commits[9].Parents)
+
+	commits, err = bareRepo1.GetCommitGraph(CommitGraphOptions{Revisions: []string{"branch1"}, Skip: 1, MaxCount: 1})
+	assert.NoError(t, err)
+	if assert.Len(t, commits, 1) {
+		assert.Equal(t, "9c9aef8dd84e02bc7ec12641deb4c930a7c30185", commits[0].ID.String())
+		assert.Equal(t, 0, commits[0].Column)
+	}
+}
+
+func TestAssignGraphLanesMerge(t *testing.T) {
+	id := func(s string) SHA1 {
+		return MustIDFromString(strings.Repeat(s, 40))
+	}
+	// a merges b into c, both having d as parent
+	commits := []*GraphCommit{
+		{ID: id("a"), Parents: []ObjectID{id("c"), id("b")}},
+		{ID: id("b"), Parents: []ObjectID{id("d")}},
+		{ID: id("c"), Parents: []ObjectID{id("d")}},
+		{ID: id("d")},
+	}
+	assignGraphLanes(commits)
+	assert.Equal(t, []GraphEdge{{Parent: id("c"), Column: 0}, {Parent: id("b"), Column: 1}}, commits[0].Edges)
+	assert.Equal(t, 1, commits[1].Column)
+	assert.Equal(t, 0, commits[2].Column)
+	assert.Equal(t, []GraphEdge{{Parent: id("d"), Column: 0}}, commits[2].Edges)
+	assert.Equal(t, 0, commits[3].Column)
+}
@@ -5,6 +5,7 @@
 package git
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"os"
@@ -13,71 +14,35 @@ import (
 
 	"github.com/enverbisevac/gitlib/log"
 	"github.com/enverbisevac/gitlib/util"
-	"github.com/go-git/go-git/v5/plumbing"
-	git2go "github.com/libgit2/git2go/v34"
 	"golang.org/x/exp/slices"
 )
 
 // ReadTreeToIndex reads a treeish to the index
 func (repo *Repository) ReadTreeToIndex(treeish string, indexFilename string) (err error) {
-	if len(treeish) != 40 {
+	if len(treeish) != repo.ObjectFormat().FullLength() {
 		treeish, err = repo.GetFullCommitID(treeish)
 		if err != nil {
 			return err
 		}
 	}
-	id, err := NewIDFromString(treeish)
+	id, err := repo.ObjectFormat().NewIDFromString(treeish)
 	if err != nil {
 		return err
 	}
 	return repo.readTreeToIndex(id, indexFilename)
 }
 
-func (repo *Repository) readTreeToIndex(id SHA1, indexFilename string) error {
-	var (
-		index *git2go.Index
-		err   error
-	)
-
-	if indexFilename != "" {
-		index, err = git2go.OpenIndex(indexFilename)
-	} else {
-		index, err = git2go.NewIndex()
-	}
-	if err != nil {
-		return err
-	}
-
-	oid, err := git2go.NewOid(id.String())
-	if err != nil {
-		return err
+func (repo *Repository) readTreeToIndex(id ObjectID, indexFilename string) error {
+	if repo.useGit2Go(OperationIndex) {
+		return repo.readTreeToIndexWithGit2Go(id, indexFilename)
 	}
-
-	ref, err := repo.git2go.LookupCommit(oid)
-	if err != nil {
-		return err
-	}
-
-	obj, err := ref.Peel(git2go.ObjectTree)
-	if err != nil {
-		return err
+	var env []string
+	if indexFilename != "" {
+		env = append(os.Environ(), "GIT_INDEX_FILE="+indexFilename)
 	}
-
-	tree, err := obj.AsTree()
-	if err != nil {
-		return err
+	if _, stderr, err := NewCommand(repo.Ctx, "read-tree").AddDynamicArguments(id.String()).RunStdString(&RunOpts{Dir: repo.Path, Env: env, Retry: lockRetry()}); err != nil {
+		return fmt.Errorf("unable to read tree %s to the index: %w", id, ConcatenateError(err, stderr))
 	}
-
-	err = index.ReadTree(tree)
-	if err != nil {
-		return err
-	}
-
-	err = index.Write()
-	if err != nil {
-		return err
-	}
-
 	return nil
 }
 
@@ -105,12 +70,28 @@ func (repo *Repository) ReadTreeToTemporaryIndex(treeish string) (filename, tmpD
 
 // EmptyIndex empties the index
 func (repo *Repository) EmptyIndex() error {
-	_, _, err := NewCommand(repo.Ctx, "read-tree", "--empty").RunStdString(&RunOpts{Dir: repo.Path})
+	_, _, err := NewCommand(repo.Ctx, "read-tree", "--empty").RunStdString(&RunOpts{Dir: repo.Path, Retry: lockRetry()})
 	return err
 }
 
 // LsFiles checks if the given filenames are in the index
 func (repo *Repository) LsFiles(filenames ...string) ([]string, error) {
+	if repo.backendFor(OperationObjects, BackendGoGit, BackendCLI) == BackendCLI {
+		if empty, err := repo.IsEmpty(); err != nil || empty {
+			return []string{}, err
+		}
+		stdout, stderr, err := NewCommand(repo.Ctx, "ls-tree", "-z", "--name-only", "HEAD").RunStdString(&RunOpts{Dir: repo.Path})
+		if err != nil {
+			return nil, fmt.Errorf("unable to list the files of HEAD: %w", ConcatenateError(err, stderr))
+		}
+		paths := make([]string, 0, len(filenames))
+		for _, name := range strings.Split(strings.TrimSuffix(stdout, "\x00"), "\x00") {
+			if slices.Contains(filenames, name) {
+				paths = append(paths, name)
+			}
+		}
+		return paths, nil
+	}
 
 	ref, err := repo.gogit.Head()
 	if err != nil {
@@ -142,56 +123,45 @@ func (repo *Repository) LsFiles(filenames ...string) ([]string, error) {
 
 // RemoveFilesFromIndex removes given filenames from the index - it does not check whether they are present.
 func (repo *Repository) RemoveFilesFromIndex(filenames ...string) error {
-	ndx, err := repo.git2go.Index()
-	if err != nil {
-		return err
+	if repo.useGit2Go(OperationIndex) {
+		return repo.removeFilesFromIndexWithGit2Go(filenames...)
 	}
-
+	// a zero mode entry removes the path
+	buffer := new(bytes.Buffer)
 	for _, file := range filenames {
 		if file != "" {
-			err = ndx.RemoveByPath(file)
-			if err != nil {
-				return err
-			}
+			buffer.WriteString("0 " + repo.ObjectFormat().EmptyObjectID().String() + "\t" + file + "\x00")
 		}
 	}
+	if _, stderr, err := NewCommand(repo.Ctx, "update-index", "--remove", "-z", "--index-info").RunStdString(&RunOpts{Dir: repo.Path, Stdin: buffer, Retry: lockRetry()}); err != nil {
+		return fmt.Errorf("unable to remove files from index in repo %s: %w", repo.Path, ConcatenateError(err, stderr))
+	}
 	return nil
 }
 
 // AddObjectToIndex adds the provided object hash to the index at the provided filename
-func (repo *Repository) AddObjectToIndex(mode string, object SHA1, filename string) error {
-	ndx, err := repo.git2go.Index()
-	if err != nil {
-		return err
+func (repo *Repository) AddObjectToIndex(mode string, object ObjectID, filename string) error {
+	if repo.useGit2Go(OperationIndex) {
+		return repo.addObjectToIndexWithGit2Go(object, filename)
 	}
-
-	oid, err := git2go.NewOid(object.String())
-	if err != nil {
-		return err
+	if _, stderr, err := NewCommand(repo.Ctx, "update-index", "--add", "--replace", "--cacheinfo").AddDynamicArguments(mode + "," + object.String() + "," + filename).RunStdString(&RunOpts{Dir: repo.Path, Retry: lockRetry()}); err != nil {
+		return fmt.Errorf("unable to add object to index at %s in repo %s: %w", object, repo.Path, ConcatenateError(err, stderr))
 	}
-
-	err = ndx.Add(&git2go.IndexEntry{
-		Mode: git2go.FilemodeBlob,
-		Id:   oid,
-		Path: filename,
-	})
-	if err != nil {
-		return fmt.Errorf("unable to add object to index at %s in repo %s: %w", object, repo.Path, err)
-	}
-
 	return nil
 }
 
 // WriteTree writes the current index as a tree to the object db and returns its hash
 func (repo *Repository) WriteTree() (*Tree, error) {
-	ndx, err := repo.git2go.Index()
-	if err != nil {
-		return nil, err
+	if repo.useGit2Go(OperationIndex) {
+		return repo.writeTreeWithGit2Go()
+	}
+	stdout, stderr, runErr := NewCommand(repo.Ctx, "write-tree").RunStdString(&RunOpts{Dir: repo.Path})
+	if runErr != nil {
+		return nil, fmt.Errorf("unable to write tree in repo %s: %w", repo.Path, ConcatenateError(runErr, stderr))
 	}
-	oid, err := ndx.WriteTree()
+	id, err := repo.ObjectFormat().NewIDFromString(strings.TrimSpace(stdout))
 	if err != nil {
 		return nil, err
 	}
-
-	return NewTree(repo, plumbing.NewHash(oid.String())), nil
+	return NewTree(repo, id), nil
 }
@@ -5,7 +5,9 @@
 package git
 
 import (
+	"bufio"
 	"bytes"
+	"fmt"
 	"io"
 	"path/filepath"
 	"strings"
@@ -21,130 +23,370 @@ const (
 	bigFileSize   int64 = 1024 * 1024 // 1 MiB
 )
 
+// LanguageLines represents the lines of the files of a language
+type LanguageLines struct {
+	Files int64
+	Code  int64
+	Blank int64
+}
+
 // GetLanguageStats calculates language stats for git repository at specified commit
 func (repo *Repository) GetLanguageStats(commitID string) (map[string]int64, error) {
-	r, err := git.PlainOpen(repo.Path)
+	snapshot, err := repo.GetLanguageStatsSnapshot(commitID)
 	if err != nil {
 		return nil, err
 	}
+	return snapshot.Stats(), nil
+}
 
-	rev, err := r.ResolveRevision(plumbing.Revision(commitID))
-	if err != nil {
-		return nil, err
+// LanguageStatsSnapshot holds the language sizes of a commit before special languages are filtered,
+// so they can be updated to another commit with UpdateLanguageStats
+type LanguageStatsSnapshot struct {
+	CommitID string
+	Sizes    map[string]int64
+}
+
+// Stats returns the language stats like GetLanguageStats
+func (s *LanguageStatsSnapshot) Stats() map[string]int64 {
+	sizes := make(map[string]int64, len(s.Sizes))
+	for language, size := range s.Sizes {
+		sizes[language] = size
 	}
+	filterSpecialLanguages(sizes)
+	return sizes
+}
 
-	commit, err := r.CommitObject(*rev)
+// GetLanguageStatsSnapshot calculates the language sizes at the specified commit
+func (repo *Repository) GetLanguageStatsSnapshot(commitID string) (*LanguageStatsSnapshot, error) {
+	r, err := git.PlainOpen(repo.Path)
 	if err != nil {
 		return nil, err
 	}
-
-	tree, err := commit.Tree()
+	id, tree, err := languageStatsTree(r, commitID)
 	if err != nil {
 		return nil, err
 	}
 
-	checker, deferable := repo.CheckAttributeReader(commitID)
+	checker, deferable := repo.CheckAttributeReader(id)
 	defer deferable()
 
-	sizes := make(map[string]int64)
+	snapshot := &LanguageStatsSnapshot{CommitID: id, Sizes: make(map[string]int64)}
 	err = tree.Files().ForEach(func(f *object.File) error {
-		if f.Size == 0 {
-			return nil
+		if language := fileLanguage(checker, f); language != "" {
+			snapshot.Sizes[language] += f.Size
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
 
-		notVendored := false
-		notGenerated := false
+// UpdateLanguageStats calculates the language sizes at the specified commit from the snapshot of
+// another commit, only examining the files changed between both commits. All files are examined
+// if a .gitattributes file changed, since it can change the language of any file.
+func (repo *Repository) UpdateLanguageStats(prev *LanguageStatsSnapshot, commitID string) (*LanguageStatsSnapshot, error) {
+	r, err := git.PlainOpen(repo.Path)
+	if err != nil {
+		return nil, err
+	}
+	oldID, oldTree, err := languageStatsTree(r, prev.CommitID)
+	if err != nil {
+		return nil, err
+	}
+	id, tree, err := languageStatsTree(r, commitID)
+	if err != nil {
+		return nil, err
+	}
 
-		if checker != nil {
-			attrs, err := checker.CheckPath(f.Name)
-			if err == nil {
-				if vendored, has := attrs["linguist-vendored"]; has {
-					if vendored == "set" || vendored == "true" {
-						return nil
-					}
-					notVendored = vendored == "false"
-				}
-				if generated, has := attrs["linguist-generated"]; has {
-					if generated == "set" || generated == "true" {
-						return nil
-					}
-					notGenerated = generated == "false"
-				}
-				if language, has := attrs["linguist-language"]; has && language != "unspecified" && language != "" {
-					// group languages, such as Pug -> HTML; SCSS -> CSS
-					group := enry.GetLanguageGroup(language)
-					if len(group) != 0 {
-						language = group
-					}
-
-					sizes[language] += f.Size
-
-					return nil
-				} else if language, has := attrs["gitlab-language"]; has && language != "unspecified" && language != "" {
-					// strip off a ? if present
-					if idx := strings.IndexByte(language, '?'); idx >= 0 {
-						language = language[:idx]
-					}
-					if len(language) != 0 {
-						// group languages, such as Pug -> HTML; SCSS -> CSS
-						group := enry.GetLanguageGroup(language)
-						if len(group) != 0 {
-							language = group
-						}
-
-						sizes[language] += f.Size
-						return nil
-					}
-				}
-			}
+	stdout, stderr, runErr := NewCommand(repo.Ctx, "diff-tree", "-r", "-z", "--no-renames", "--name-only").
+		AddDynamicArguments(oldID, id).RunStdString(&RunOpts{Dir: repo.Path})
+	if runErr != nil {
+		return nil, fmt.Errorf("unable to list changed files between %s and %s: %w", oldID, id, ConcatenateError(runErr, stderr))
+	}
+	var changed []string
+	for _, path := range strings.Split(stdout, "\x00") {
+		if path == "" {
+			continue
 		}
-
-		if (!notVendored && enry.IsVendor(f.Name)) || enry.IsDotFile(f.Name) ||
-			enry.IsDocumentation(f.Name) || enry.IsConfiguration(f.Name) {
-			return nil
+		if path == ".gitattributes" || strings.HasSuffix(path, "/.gitattributes") {
+			return repo.GetLanguageStatsSnapshot(id)
 		}
+		changed = append(changed, path)
+	}
+
+	snapshot := &LanguageStatsSnapshot{CommitID: id, Sizes: make(map[string]int64, len(prev.Sizes))}
+	for language, size := range prev.Sizes {
+		snapshot.Sizes[language] = size
+	}
+	if len(changed) == 0 {
+		return snapshot, nil
+	}
+
+	// the attributes are the same in both commits
+	checker, deferable := repo.CheckAttributeReader(id)
+	defer deferable()
 
-		// If content can not be read or file is too big just do detection by filename
-		var content []byte
-		if f.Size <= bigFileSize {
-			content, _ = readFile(f, fileSizeLimit)
+	for _, path := range changed {
+		for _, side := range []struct {
+			tree *object.Tree
+			sign int64
+		}{{oldTree, -1}, {tree, 1}} {
+			f, err := side.tree.File(path)
+			if err == object.ErrFileNotFound || err == plumbing.ErrObjectNotFound {
+				// added, deleted or a submodule
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			if language := fileLanguage(checker, f); language != "" {
+				snapshot.Sizes[language] += side.sign * f.Size
+			}
 		}
-		if !notGenerated && enry.IsGenerated(f.Name, content) {
-			return nil
+	}
+	for language, size := range snapshot.Sizes {
+		if size <= 0 {
+			delete(snapshot.Sizes, language)
 		}
+	}
+	return snapshot, nil
+}
+
+// languageStatsTree returns the full ID and the tree of the commit
+func languageStatsTree(r *git.Repository, commitID string) (string, *object.Tree, error) {
+	rev, err := r.ResolveRevision(plumbing.Revision(commitID))
+	if err != nil {
+		return "", nil, err
+	}
 
-		// TODO: Use .gitattributes file for linguist overrides
+	commit, err := r.CommitObject(*rev)
+	if err != nil {
+		return "", nil, err
+	}
 
-		language := GetCodeLanguage(f.Name, content)
-		if language == enry.OtherLanguage || language == "" {
-			return nil
-		}
+	tree, err := commit.Tree()
+	if err != nil {
+		return "", nil, err
+	}
+	return commit.Hash.String(), tree, nil
+}
 
-		// group languages, such as Pug -> HTML; SCSS -> CSS
-		group := enry.GetLanguageGroup(language)
-		if group != "" {
-			language = group
+// GetLanguageLineStats counts the code and blank lines per language at the specified commit,
+// applying the same linguist overrides and exclusions as GetLanguageStats. Binary files are skipped.
+func (repo *Repository) GetLanguageLineStats(commitID string) (map[string]*LanguageLines, error) {
+	lines := make(map[string]*LanguageLines)
+	err := repo.walkLanguageFiles(commitID, func(f *object.File, language string) error {
+		isBinary, err := f.IsBinary()
+		if err != nil || isBinary {
+			return err
+		}
+		r, err := f.Reader()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		code, blank, err := countLines(r)
+		if err != nil {
+			return err
 		}
 
-		sizes[language] += f.Size
-
+		stats, ok := lines[language]
+		if !ok {
+			stats = &LanguageLines{}
+			lines[language] = stats
+		}
+		stats.Files++
+		stats.Code += code
+		stats.Blank += blank
 		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
+	filterSpecialLanguages(lines)
+	return lines, nil
+}
 
-	// filter special languages unless they are the only language
-	if len(sizes) > 1 {
-		for language := range sizes {
+// filterSpecialLanguages removes languages which are neither programming nor markup languages,
+// unless they are the only language
+func filterSpecialLanguages[V any](stats map[string]V) {
+	if len(stats) > 1 {
+		for language := range stats {
 			langtype := enry.GetLanguageType(language)
 			if langtype != enry.Programming && langtype != enry.Markup {
-				delete(sizes, language)
+				delete(stats, language)
 			}
 		}
 	}
+}
 
-	return sizes, nil
+// countLines counts the lines with content and the blank lines
+func countLines(r io.Reader) (code, blank int64, err error) {
+	rd := bufio.NewReader(r)
+	inLine, isBlank := false, true
+	for {
+		b, err := rd.ReadSlice('\n')
+		if len(b) > 0 {
+			inLine = true
+			if isBlank && len(bytes.TrimSpace(b)) > 0 {
+				isBlank = false
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			// the line continues
+			continue
+		}
+		if inLine {
+			if isBlank {
+				blank++
+			} else {
+				code++
+			}
+			inLine, isBlank = false, true
+		}
+		if err == io.EOF {
+			return code, blank, nil
+		} else if err != nil {
+			return 0, 0, err
+		}
+	}
+}
+
+// walkLanguageFiles calls fn with the grouped language of every file at the commit which counts
+// for the language stats
+func (repo *Repository) walkLanguageFiles(commitID string, fn func(f *object.File, language string) error) error {
+	r, err := git.PlainOpen(repo.Path)
+	if err != nil {
+		return err
+	}
+	id, tree, err := languageStatsTree(r, commitID)
+	if err != nil {
+		return err
+	}
+
+	checker, deferable := repo.CheckAttributeReader(id)
+	defer deferable()
+
+	return tree.Files().ForEach(func(f *object.File) error {
+		if language := fileLanguage(checker, f); language != "" {
+			return fn(f, language)
+		}
+		return nil
+	})
+}
+
+// fileLanguage returns the grouped language the file counts for in the language stats,
+// or an empty string if it does not count
+func fileLanguage(checker *CheckAttributeReader, f *object.File) string {
+	if f.Size == 0 {
+		return ""
+	}
+
+	notVendored := false
+	notGenerated := false
+
+	if checker != nil {
+		attrs, err := checker.CheckPath(f.Name)
+		if err == nil {
+			if attrs.IsSet("linguist-vendored") || attrs.IsSet("linguist-generated") {
+				return ""
+			}
+			notVendored = attrs["linguist-vendored"] == "false"
+			notGenerated = attrs["linguist-generated"] == "false"
+			if language := attributeLanguage(attrs); language != "" {
+				// group languages, such as Pug -> HTML; SCSS -> CSS
+				group := enry.GetLanguageGroup(language)
+				if len(group) != 0 {
+					language = group
+				}
+
+				return language
+			}
+		}
+	}
+
+	if (!notVendored && enry.IsVendor(f.Name)) || enry.IsDotFile(f.Name) ||
+		enry.IsDocumentation(f.Name) || enry.IsConfiguration(f.Name) {
+		return ""
+	}
+
+	// If content can not be read or file is too big just do detection by filename
+	var content []byte
+	if f.Size <= bigFileSize {
+		content, _ = readFile(f, fileSizeLimit)
+	}
+	if !notGenerated && enry.IsGenerated(f.Name, content) {
+		return ""
+	}
+
+	language := GetCodeLanguage(f.Name, content)
+	if language == enry.OtherLanguage || language == "" {
+		return ""
+	}
+
+	// group languages, such as Pug -> HTML; SCSS -> CSS
+	group := enry.GetLanguageGroup(language)
+	if group != "" {
+		language = group
+	}
+
+	return language
+}
+
+// attributeLanguage returns the language set by the linguist-language or gitlab-language attribute
+func attributeLanguage(attrs Attributes) string {
+	if language, has := attrs["linguist-language"]; has && language != "unspecified" && language != "" {
+		return language
+	}
+	if language, has := attrs["gitlab-language"]; has && language != "unspecified" && language != "" {
+		// strip off a ? if present
+		if idx := strings.IndexByte(language, '?'); idx >= 0 {
+			language = language[:idx]
+		}
+		return language
+	}
+	return ""
+}
+
+// GetFileLanguage returns the language of the file at the specified commit, set by its linguist-language or
+// gitlab-language attribute or detected from its name and content. An empty string is returned if the
+// language is unknown. Unlike the language stats, vendored, generated and documentation files are detected too.
+func (repo *Repository) GetFileLanguage(commitID, path string) (string, error) {
+	r, err := git.PlainOpen(repo.Path)
+	if err != nil {
+		return "", err
+	}
+	id, tree, err := languageStatsTree(r, commitID)
+	if err != nil {
+		return "", err
+	}
+	f, err := tree.File(path)
+	if err == object.ErrFileNotFound || err == plumbing.ErrObjectNotFound {
+		return "", ErrNotExist{ID: commitID, RelPath: path}
+	} else if err != nil {
+		return "", err
+	}
+
+	checker, deferable := repo.CheckAttributeReader(id)
+	defer deferable()
+	if checker != nil {
+		if attrs, err := checker.CheckPath(f.Name); err == nil {
+			if language := attributeLanguage(attrs); language != "" {
+				return language, nil
+			}
+		}
+	}
+
+	var content []byte
+	if f.Size <= bigFileSize {
+		content, _ = readFile(f, fileSizeLimit)
+	}
+	language := GetCodeLanguage(f.Name, content)
+	if language == enry.OtherLanguage {
+		return "", nil
+	}
+	return language, nil
 }
 
 func readFile(f *object.File, limit int64) ([]byte, error) {
@@ -5,7 +5,9 @@
 package git
 
 import (
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -29,3 +31,114 @@ func TestRepository_GetLanguageStats(t *testing.T) {
 		"Java":   112,
 	}, stats)
 }
+
+func TestRepository_GetLanguageLineStats(t *testing.T) {
+	repoPath := filepath.Join(testReposDir, "language_stats_repo")
+	gitRepo, err := openRepositoryWithDefaultContext(repoPath)
+	if !assert.NoError(t, err) {
+		t.Fatal()
+	}
+	defer gitRepo.Close()
+
+	stats, err := gitRepo.GetLanguageLineStats("8fee858da5796dfb37704761701bb8e800ad9ef3")
+	if !assert.NoError(t, err) {
+		t.Fatal()
+	}
+
+	assert.EqualValues(t, map[string]*LanguageLines{
+		"Python": {Files: 2, Code: 4, Blank: 2},
+		"Java":   {Files: 1, Code: 7},
+	}, stats)
+}
+
+func TestCountLines(t *testing.T) {
+	for _, c := range []struct {
+		content     string
+		code, blank int64
+	}{
+		{"", 0, 0},
+		{"a", 1, 0},
+		{"a\n\n  \t\nb\n", 2, 2},
+		{"\n" + strings.Repeat("x", 5000) + "\n" + strings.Repeat(" ", 5000), 1, 2},
+	} {
+		code, blank, err := countLines(strings.NewReader(c.content))
+		assert.NoError(t, err)
+		assert.Equal(t, c.code, code)
+		assert.Equal(t, c.blank, blank)
+	}
+}
+
+func TestRepository_UpdateLanguageStats(t *testing.T) {
+	clonedPath, err := cloneRepo(t, filepath.Join(testReposDir, "language_stats_repo"))
+	assert.NoError(t, err)
+	repo, err := openRepositoryWithDefaultContext(clonedPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	prev, err := repo.GetLanguageStatsSnapshot("8fee858da5796dfb37704761701bb8e800ad9ef3")
+	assert.NoError(t, err)
+	assert.Equal(t, "8fee858da5796dfb37704761701bb8e800ad9ef3", prev.CommitID)
+
+	committer := &Signature{Name: "Test", Email: "test@example.com"}
+	commit := func(message string) string {
+		assert.NoError(t, AddChanges(clonedPath, true))
+		assert.NoError(t, CommitChanges(clonedPath, CommitChangesOptions{Committer: committer, Message: message}))
+		id, err := repo.GetRefCommitID("HEAD")
+		assert.NoError(t, err)
+		return id
+	}
+
+	assert.NoError(t, os.WriteFile(filepath.Join(clonedPath, "python-hello", "hello.py"), []byte("print(\"Hello World\")\n"), 0o644))
+	assert.NoError(t, os.Remove(filepath.Join(clonedPath, "java-hello", "main.java")))
+	assert.NoError(t, os.WriteFile(filepath.Join(clonedPath, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0o644))
+	changed := commit("change files")
+
+	updated, err := repo.UpdateLanguageStats(prev, changed)
+	assert.NoError(t, err)
+	full, err := repo.GetLanguageStatsSnapshot(changed)
+	assert.NoError(t, err)
+	assert.Equal(t, full, updated)
+	assert.EqualValues(t, 29, updated.Sizes["Go"])
+	assert.Equal(t, prev.Sizes["Java"]-112, updated.Sizes["Java"])
+	assert.Equal(t, full.Stats(), updated.Stats())
+
+	// a changed .gitattributes file examines all files
+	assert.NoError(t, os.WriteFile(filepath.Join(clonedPath, ".gitattributes"), []byte("*.go linguist-language=Python\n"), 0o644))
+	attributes := commit("change attributes")
+	updated, err = repo.UpdateLanguageStats(prev, attributes)
+	assert.NoError(t, err)
+	full, err = repo.GetLanguageStatsSnapshot(attributes)
+	assert.NoError(t, err)
+	assert.Equal(t, full, updated)
+
+	// nothing changed
+	updated, err = repo.UpdateLanguageStats(full, attributes)
+	assert.NoError(t, err)
+	assert.Equal(t, full, updated)
+
+	_, err = repo.UpdateLanguageStats(prev, "unknown")
+	assert.Error(t, err)
+}
+
+func TestRepository_GetFileLanguage(t *testing.T) {
+	repoPath := filepath.Join(testReposDir, "language_stats_repo")
+	gitRepo, err := openRepositoryWithDefaultContext(repoPath)
+	assert.NoError(t, err)
+	defer gitRepo.Close()
+
+	for path, expected := range map[string]string{
+		"python-hello/hello.py": "Python",
+		"i-am-a-python.p":       "Python",
+		"main.vendor.java":      "Java",
+		".gitattributes":        "Git Attributes",
+	} {
+		language, err := gitRepo.GetFileLanguage("8fee858da5796dfb37704761701bb8e800ad9ef3", path)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, language, path)
+	}
+
+	_, err = gitRepo.GetFileLanguage("8fee858da5796dfb37704761701bb8e800ad9ef3", "unknown.go")
+	assert.True(t, IsErrNotExist(err))
+	_, err = gitRepo.GetFileLanguage("8fee858da5796dfb37704761701bb8e800ad9ef3", "java-hello")
+	assert.True(t, IsErrNotExist(err))
+}
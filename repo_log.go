@@ -0,0 +1,252 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// LogConfig holds the options of Repository.Log
+type LogConfig struct {
+	revisions   []string
+	paths       []string
+	author      string
+	since       time.Time
+	until       time.Time
+	maxCount    int
+	skip        int
+	firstParent bool
+	noMerges    bool
+	reverse     bool
+	follow      bool
+	mailmap     *Mailmap
+}
+
+// LogFunc configures the commits listed by Repository.Log
+type LogFunc func(c *LogConfig)
+
+func (f LogFunc) Apply(c *LogConfig) {
+	f(c)
+}
+
+// LogRevisions lists the commits reachable from the revisions, e.g. "main", "^v1.0" or "v1.0..main",
+// instead of HEAD
+func LogRevisions(revisions ...string) LogFunc {
+	return func(c *LogConfig) {
+		c.revisions = append(c.revisions, revisions...)
+	}
+}
+
+// LogPaths only lists the commits changing one of the paths
+func LogPaths(paths ...string) LogFunc {
+	return func(c *LogConfig) {
+		c.paths = append(c.paths, paths...)
+	}
+}
+
+// LogAuthor only lists the commits whose author matches the regular expression
+func LogAuthor(pattern string) LogFunc {
+	return func(c *LogConfig) {
+		c.author = pattern
+	}
+}
+
+// LogSince only lists the commits committed at or after since
+func LogSince(since time.Time) LogFunc {
+	return func(c *LogConfig) {
+		c.since = since
+	}
+}
+
+// LogUntil only lists the commits committed at or before until
+func LogUntil(until time.Time) LogFunc {
+	return func(c *LogConfig) {
+		c.until = until
+	}
+}
+
+// LogMaxCount lists at most n commits
+func LogMaxCount(n int) LogFunc {
+	return func(c *LogConfig) {
+		c.maxCount = n
+	}
+}
+
+// LogSkip skips the first n commits
+func LogSkip(n int) LogFunc {
+	return func(c *LogConfig) {
+		c.skip = n
+	}
+}
+
+// LogFirstParent only follows the first parent of merge commits
+func LogFirstParent() LogFunc {
+	return func(c *LogConfig) {
+		c.firstParent = true
+	}
+}
+
+// LogNoMerges omits merge commits
+func LogNoMerges() LogFunc {
+	return func(c *LogConfig) {
+		c.noMerges = true
+	}
+}
+
+// LogReverse lists the oldest commits first
+func LogReverse() LogFunc {
+	return func(c *LogConfig) {
+		c.reverse = true
+	}
+}
+
+// LogFollow continues listing the history of a single path beyond renames, it requires exactly one path
+func LogFollow() LogFunc {
+	return func(c *LogConfig) {
+		c.follow = true
+	}
+}
+
+// LogMailmap maps the authors and committers of the listed commits to their canonical identities,
+// e.g. with the mailmap returned by GetMailmap("HEAD")
+func LogMailmap(mailmap *Mailmap) LogFunc {
+	return func(c *LogConfig) {
+		c.mailmap = mailmap
+	}
+}
+
+// LogOption configures the commits listed by Repository.Log
+type LogOption interface {
+	Apply(c *LogConfig)
+}
+
+// CommitIterator streams the commits listed by Repository.Log.
+// It must be closed if it is not read until the end.
+type CommitIterator struct {
+	repo    *Repository
+	reader  io.ReadCloser
+	scanner *bufio.Scanner
+	cancel  context.CancelFunc
+	mailmap *Mailmap
+	err     error
+}
+
+// Log lists the commits of HEAD or the configured revisions like git log, without reading them upfront
+func (repo *Repository) Log(opts ...LogOption) (*CommitIterator, error) {
+	c := &LogConfig{}
+	for _, opt := range opts {
+		opt.Apply(c)
+	}
+	if c.follow && len(c.paths) != 1 {
+		return nil, errors.New("log can only follow a single path")
+	}
+
+	ctx, cancel := context.WithCancel(repo.Ctx)
+	cmd := NewCommand(ctx, "log", "--format=%H")
+	if c.author != "" {
+		cmd.AddOptionFormat("--author=%s", c.author)
+	}
+	if !c.since.IsZero() {
+		cmd.AddOptionFormat("--since=%s", c.since.Format(time.RFC3339))
+	}
+	if !c.until.IsZero() {
+		cmd.AddOptionFormat("--until=%s", c.until.Format(time.RFC3339))
+	}
+	if c.maxCount > 0 {
+		cmd.AddArguments(CmdArg("--max-count=" + strconv.Itoa(c.maxCount)))
+	}
+	if c.skip > 0 {
+		cmd.AddArguments(CmdArg("--skip=" + strconv.Itoa(c.skip)))
+	}
+	if c.firstParent {
+		cmd.AddArguments("--first-parent")
+	}
+	if c.noMerges {
+		cmd.AddArguments("--no-merges")
+	}
+	if c.reverse {
+		cmd.AddArguments("--reverse")
+	}
+	if c.follow {
+		cmd.AddArguments("--follow")
+	}
+	if len(c.revisions) == 0 {
+		cmd.AddArguments("HEAD")
+	}
+	cmd.AddDynamicArguments(c.revisions...)
+	cmd.AddDashesAndList(c.paths...)
+
+	stdoutReader, err := cmd.RunWithStdoutReader(&RunOpts{Dir: repo.Path})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return &CommitIterator{
+		repo:    repo,
+		reader:  stdoutReader,
+		scanner: bufio.NewScanner(stdoutReader),
+		cancel:  cancel,
+		mailmap: c.mailmap,
+	}, nil
+}
+
+// Next returns the next commit, or nil if there are no more commits or an error occurred.
+// Use Err to check for an error after Next returned nil.
+func (it *CommitIterator) Next() *Commit {
+	if it.err != nil {
+		return nil
+	}
+	for it.scanner.Scan() {
+		line := it.scanner.Text()
+		if line == "" {
+			continue
+		}
+		id, err := it.repo.ObjectFormat().NewIDFromString(line)
+		if err != nil {
+			it.stop(fmt.Errorf("invalid log output %q: %w", line, err))
+			return nil
+		}
+		commit, err := it.repo.getCommit(id)
+		if err != nil {
+			it.stop(err)
+			return nil
+		}
+		if it.mailmap != nil {
+			// the commit may be shared, e.g. with the last commit cache, the identities are mapped on a copy
+			mapped := *commit
+			mapped.Author = it.mailmap.ResolveSignature(commit.Author)
+			mapped.Committer = it.mailmap.ResolveSignature(commit.Committer)
+			commit = &mapped
+		}
+		return commit
+	}
+	it.stop(it.scanner.Err())
+	return nil
+}
+
+// stop ends the iteration with err, the git process is stopped and its context released
+// as soon as the iteration ends, without waiting for Close
+func (it *CommitIterator) stop(err error) {
+	it.err = err
+	_ = it.Close()
+}
+
+// Err returns the error which stopped the iteration, if any
+func (it *CommitIterator) Err() error {
+	return it.err
+}
+
+// Close stops the git process listing the commits, it is safe to call after the iteration ended
+func (it *CommitIterator) Close() error {
+	it.cancel()
+	return it.reader.Close()
+}
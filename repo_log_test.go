@@ -0,0 +1,87 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func collectLog(t *testing.T, repo *Repository, opts ...LogOption) []string {
+	iter, err := repo.Log(opts...)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	defer iter.Close()
+
+	var ids []string
+	for commit := iter.Next(); commit != nil; commit = iter.Next() {
+		ids = append(ids, commit.ID.String())
+	}
+	assert.NoError(t, iter.Err())
+	return ids
+}
+
+func TestRepository_Log(t *testing.T) {
+	bareRepo1Path := filepath.Join(testReposDir, "repo1_bare")
+	bareRepo1, err := openRepositoryWithDefaultContext(bareRepo1Path)
+	assert.NoError(t, err)
+	defer bareRepo1.Close()
+
+	assert.Equal(t, []string{
+		"feaf4ba6bc635fec442f46ddd4512416ec43c2c2",
+		"37991dec2c8e592043f47155ce4808d4580f9123",
+		"6fbd69e9823458e6c4a2fc5c0f6bc022b2f2acd1",
+		"8006ff9adbf0cb94da7dad9e537e53817f9fa5c0",
+		"8d92fc957a4d7cfd98bc375f0b7bb189a0d6c9f2",
+		"95bb4d39648ee7e325106df01a621c530863a653",
+	}, collectLog(t, bareRepo1))
+
+	assert.Equal(t, []string{
+		"37991dec2c8e592043f47155ce4808d4580f9123",
+		"feaf4ba6bc635fec442f46ddd4512416ec43c2c2",
+	}, collectLog(t, bareRepo1, LogMaxCount(2), LogReverse()))
+
+	assert.Equal(t, []string{"37991dec2c8e592043f47155ce4808d4580f9123"}, collectLog(t, bareRepo1, LogSkip(1), LogMaxCount(1)))
+
+	assert.Len(t, collectLog(t, bareRepo1, LogAuthor("Tris")), 3)
+	assert.Equal(t, []string{"37991dec2c8e592043f47155ce4808d4580f9123"}, collectLog(t, bareRepo1,
+		LogSince(time.Date(2018, 4, 19, 0, 0, 0, 0, time.UTC)), LogUntil(time.Date(2018, 12, 31, 0, 0, 0, 0, time.UTC))))
+
+	assert.Equal(t, []string{
+		"2839944139e0de9737a044f78b0e4b40d989a9e3",
+		"95bb4d39648ee7e325106df01a621c530863a653",
+	}, collectLog(t, bareRepo1, LogRevisions("branch1"), LogPaths("file1.txt"), LogFollow()))
+
+	_, err = bareRepo1.Log(LogPaths("file1.txt", "branch1.txt"), LogFollow())
+	assert.Error(t, err)
+
+	// closing before reading all commits stops git
+	iter, err := bareRepo1.Log()
+	assert.NoError(t, err)
+	assert.NotNil(t, iter.Next())
+	assert.NoError(t, iter.Close())
+
+	// reading all commits stops git without Close
+	iter, err = bareRepo1.Log(LogMaxCount(1))
+	assert.NoError(t, err)
+	assert.NotNil(t, iter.Next())
+	assert.Nil(t, iter.Next())
+	assert.NoError(t, iter.Err())
+	_, err = iter.reader.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.ErrClosedPipe)
+	assert.Nil(t, iter.Next())
+	assert.NoError(t, iter.Close())
+
+	iter, err = bareRepo1.Log(LogRevisions("unknown"))
+	assert.NoError(t, err)
+	assert.Nil(t, iter.Next())
+	assert.Error(t, iter.Err())
+	iter.Close()
+}
@@ -0,0 +1,472 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/enverbisevac/gitlib/log"
+	"github.com/enverbisevac/gitlib/util"
+)
+
+// MergeTreeConflict represents a path which could not be merged cleanly.
+// The IDs are empty when the path does not exist on that side.
+type MergeTreeConflict struct {
+	Path     string
+	BaseID   string
+	OursID   string
+	TheirsID string
+
+	// modes of the base, ours and theirs entries
+	modes [3]string
+}
+
+// MergeTreeResult represents the result of MergeTree
+type MergeTreeResult struct {
+	// TreeID is the ID of the merged tree. When there are conflicts it is only set
+	// by git >= 2.38 and the conflicted files contain conflict markers.
+	TreeID    string
+	Conflicts []*MergeTreeConflict
+}
+
+// HasConflicts returns true if the merge is not clean
+func (r *MergeTreeResult) HasConflicts() bool {
+	return len(r.Conflicts) > 0
+}
+
+// MergeTree merges theirs into ours without touching a worktree or the index of the repository.
+// An empty base uses the merge base of ours and theirs.
+// Git >= 2.38 uses `git merge-tree --write-tree`, older versions and git < 2.40 with an explicit base fall back
+// to a three-way read-tree into a temporary index. The files changed on both sides are merged with git merge-file,
+// only renames aren't detected by the fallback.
+func (repo *Repository) MergeTree(base, ours, theirs string) (*MergeTreeResult, error) {
+	// --merge-base was added in git 2.40
+	if CheckGitVersionAtLeast("2.38") == nil && (base == "" || CheckGitVersionAtLeast("2.40") == nil) {
+		return repo.mergeTreeWriteTree(base, ours, theirs)
+	}
+	return repo.mergeTreeReadTree(base, ours, theirs)
+}
+
+func (repo *Repository) mergeTreeWriteTree(base, ours, theirs string) (*MergeTreeResult, error) {
+	cmd := NewCommand(repo.Ctx, "merge-tree", "--write-tree", "-z")
+	if base != "" {
+		cmd.AddOptionFormat("--merge-base=%s", base)
+	}
+	cmd.AddDynamicArguments(ours, theirs)
+
+	// RunStdString drops stdout on errors but the conflicts are written with exit code 1
+	stdout := new(strings.Builder)
+	stderr := new(strings.Builder)
+	err := cmd.Run(&RunOpts{Dir: repo.Path, Stdout: stdout, Stderr: stderr})
+	conflicted := false
+	if err != nil {
+		var exitError *exec.ExitError
+		if !errors.As(err, &exitError) || exitError.ExitCode() != 1 {
+			return nil, fmt.Errorf("unable to merge %s into %s: %w", theirs, ours, ConcatenateError(err, stderr.String()))
+		}
+		conflicted = true
+	}
+
+	// <tree>NUL<conflicted file info>NUL...NUL<informational messages>
+	treeID, rest, _ := strings.Cut(stdout.String(), "\x00")
+	result := &MergeTreeResult{TreeID: treeID}
+	if conflicted {
+		if i := strings.Index(rest, "\x00\x00"); i >= 0 {
+			rest = rest[:i+1]
+		}
+		if result.Conflicts, err = parseUnmergedEntries(rest); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (repo *Repository) mergeTreeReadTree(base, ours, theirs string) (*MergeTreeResult, error) {
+	if base == "" {
+		stdout, stderr, err := NewCommand(repo.Ctx, "merge-base").AddDynamicArguments(ours, theirs).RunStdString(&RunOpts{Dir: repo.Path})
+		if err != nil {
+			return nil, fmt.Errorf("unable to get merge base of %s and %s: %w", ours, theirs, ConcatenateError(err, stderr))
+		}
+		base = strings.TrimSpace(stdout)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "merge-tree")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := util.RemoveAll(tmpDir); err != nil {
+			log.Error("failed to remove tmp index file: %v", err)
+		}
+	}()
+	env := append(os.Environ(), "GIT_INDEX_FILE="+filepath.Join(tmpDir, ".tmp-index"))
+
+	if _, stderr, err := NewCommand(repo.Ctx, "read-tree", "-i", "-m", "--aggressive").AddDynamicArguments(base, ours, theirs).RunStdString(&RunOpts{Dir: repo.Path, Env: env}); err != nil {
+		return nil, fmt.Errorf("unable to merge %s into %s: %w", theirs, ours, ConcatenateError(err, stderr))
+	}
+
+	stdout, stderr, err := NewCommand(repo.Ctx, "ls-files", "-u", "-z").RunStdString(&RunOpts{Dir: repo.Path, Env: env})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list unmerged files: %w", ConcatenateError(err, stderr))
+	}
+	unmerged, err := parseUnmergedEntries(stdout)
+	if err != nil {
+		return nil, err
+	}
+	// read-tree only resolves trivial merges, the files changed on both sides are merged like merge-tree does
+	result := &MergeTreeResult{}
+	for _, conflict := range unmerged {
+		merged, err := repo.mergeUnmergedFile(conflict, tmpDir, env)
+		if err != nil {
+			return nil, err
+		}
+		if !merged {
+			result.Conflicts = append(result.Conflicts, conflict)
+		}
+	}
+	if result.HasConflicts() {
+		return result, nil
+	}
+
+	stdout, stderr, err = NewCommand(repo.Ctx, "write-tree").RunStdString(&RunOpts{Dir: repo.Path, Env: env})
+	if err != nil {
+		return nil, fmt.Errorf("unable to write merged tree: %w", ConcatenateError(err, stderr))
+	}
+	result.TreeID = strings.TrimSpace(stdout)
+	return result, nil
+}
+
+// mergeUnmergedFile merges a file changed on both sides with git merge-file and adds the result to the index of env.
+// It returns false if the contents conflict, or if the path is not a file with the same mode on all sides.
+func (repo *Repository) mergeUnmergedFile(conflict *MergeTreeConflict, tmpDir string, env []string) (bool, error) {
+	mode := conflict.modes[0]
+	if conflict.BaseID == "" || conflict.OursID == "" || conflict.TheirsID == "" ||
+		(mode != "100644" && mode != "100755") || conflict.modes[1] != mode || conflict.modes[2] != mode {
+		return false, nil
+	}
+
+	files := make([]string, 0, 3)
+	for _, id := range []string{conflict.OursID, conflict.BaseID, conflict.TheirsID} {
+		file := filepath.Join(tmpDir, fmt.Sprintf("merge-file-%d", len(files)))
+		if err := repo.writeBlobToFile(id, file); err != nil {
+			return false, err
+		}
+		files = append(files, file)
+	}
+
+	// the exit code is the number of conflicts, or 255 e.g. for binary files
+	merged, stderr, err := NewCommand(repo.Ctx, "merge-file", "-p").AddDashesAndList(files...).RunStdBytes(&RunOpts{Dir: repo.Path})
+	if err != nil {
+		var exitError *exec.ExitError
+		if errors.As(err, &exitError) {
+			return false, nil
+		}
+		return false, fmt.Errorf("unable to merge %s: %w", conflict.Path, ConcatenateError(err, string(stderr)))
+	}
+
+	stdout, stderrStr, err := NewCommand(repo.Ctx, "hash-object", "-w", "--stdin").RunStdString(&RunOpts{Dir: repo.Path, Stdin: bytes.NewReader(merged)})
+	if err != nil {
+		return false, fmt.Errorf("unable to write merged %s: %w", conflict.Path, ConcatenateError(err, stderrStr))
+	}
+	if _, stderrStr, err := NewCommand(repo.Ctx, "update-index", "--cacheinfo").AddDynamicArguments(mode + "," + strings.TrimSpace(stdout) + "," + conflict.Path).
+		RunStdString(&RunOpts{Dir: repo.Path, Env: env}); err != nil {
+		return false, fmt.Errorf("unable to add merged %s to the index: %w", conflict.Path, ConcatenateError(err, stderrStr))
+	}
+	return true, nil
+}
+
+// writeBlobToFile writes the content of the blob id to the file
+func (repo *Repository) writeBlobToFile(id, file string) error {
+	blob, err := repo.GetBlob(id)
+	if err != nil {
+		return err
+	}
+	rd, err := blob.DataAsync()
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, rd); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// parseUnmergedEntries parses NUL terminated "<mode> <object> <stage>\t<path>" entries as written by
+// `git ls-files -u -z` and `git merge-tree -z` into one conflict per path
+func parseUnmergedEntries(out string) ([]*MergeTreeConflict, error) {
+	var conflicts []*MergeTreeConflict
+	for _, entry := range strings.Split(out, "\x00") {
+		if entry == "" {
+			continue
+		}
+		info, path, ok := strings.Cut(entry, "\t")
+		fields := strings.Fields(info)
+		if !ok || len(fields) != 3 {
+			return nil, fmt.Errorf("invalid unmerged entry: %q", entry)
+		}
+
+		var conflict *MergeTreeConflict
+		if len(conflicts) > 0 && conflicts[len(conflicts)-1].Path == path {
+			conflict = conflicts[len(conflicts)-1]
+		} else {
+			conflict = &MergeTreeConflict{Path: path}
+			conflicts = append(conflicts, conflict)
+		}
+
+		switch fields[2] {
+		case "1":
+			conflict.BaseID = fields[1]
+			conflict.modes[0] = fields[0]
+		case "2":
+			conflict.OursID = fields[1]
+			conflict.modes[1] = fields[0]
+		case "3":
+			conflict.TheirsID = fields[1]
+			conflict.modes[2] = fields[0]
+		default:
+			return nil, fmt.Errorf("invalid unmerged entry stage: %q", entry)
+		}
+	}
+	return conflicts, nil
+}
+
+// MergeStyle represents the approach to merge commits into a base branch
+type MergeStyle string
+
+const (
+	// MergeStyleMerge creates a merge commit
+	MergeStyleMerge MergeStyle = "merge"
+	// MergeStyleSquash creates one commit with all changes of head on top of base
+	MergeStyleSquash MergeStyle = "squash"
+	// MergeStyleFastForwardOnly moves base to head, it fails if base is not an ancestor of head
+	MergeStyleFastForwardOnly MergeStyle = "fast-forward-only"
+)
+
+// ErrNotFastForward is returned by Merge with MergeStyleFastForwardOnly if base has diverged from head
+var ErrNotFastForward = errors.New("base can not be fast-forwarded to head")
+
+// MergeOptions options for Merge
+type MergeOptions struct {
+	Style MergeStyle
+	// Message of the new commit, a default message is generated if empty
+	Message   string
+	Committer *Signature
+	// Author of a squash commit, Committer is used if nil
+	Author *Signature
+	// Sign signs the new commit with SigningKey or the configured user.signingkey
+	Sign       bool
+	SigningKey string
+}
+
+// Merge merges head into base without a worktree and returns the new head of base.
+// If base is a full ref name like "refs/heads/main" the ref is updated, as long as it was not changed in the meantime.
+// Nothing is done if head is already contained in base. Conflicts are returned as ErrMergeConflict.
+func (repo *Repository) Merge(base, head string, opts MergeOptions) (ObjectID, error) {
+	baseID, err := repo.resolveCommitID(base)
+	if err != nil {
+		return nil, err
+	}
+	headID, err := repo.resolveCommitID(head)
+	if err != nil {
+		return nil, err
+	}
+	isAncestor := func(a, b string) bool {
+		_, _, err := NewCommand(repo.Ctx, "merge-base", "--is-ancestor").AddDynamicArguments(a, b).RunStdString(&RunOpts{Dir: repo.Path})
+		return err == nil
+	}
+
+	if isAncestor(headID, baseID) {
+		return repo.ObjectFormat().NewIDFromString(baseID)
+	}
+
+	var newID ObjectID
+	switch opts.Style {
+	case MergeStyleFastForwardOnly:
+		if !isAncestor(baseID, headID) {
+			return nil, ErrNotFastForward
+		}
+		if newID, err = repo.ObjectFormat().NewIDFromString(headID); err != nil {
+			return nil, err
+		}
+	case MergeStyleMerge, MergeStyleSquash, "":
+		if opts.Committer == nil {
+			return nil, errors.New("merge requires a committer")
+		}
+		result, err := repo.MergeTree("", baseID, headID)
+		if err != nil {
+			return nil, err
+		}
+		if result.HasConflicts() {
+			return nil, &ErrMergeConflict{Base: base, Head: head, Conflicts: result.Conflicts}
+		}
+
+		commitOpts := CommitTreeOpts{
+			Message:    opts.Message,
+			KeyID:      opts.SigningKey,
+			AlwaysSign: opts.Sign,
+			NoGPGSign:  !opts.Sign,
+		}
+		author := opts.Committer
+		if opts.Style == MergeStyleSquash {
+			if opts.Author != nil {
+				author = opts.Author
+			}
+			commitOpts.Parents = []string{baseID}
+			if commitOpts.Message == "" {
+				if commitOpts.Message, err = repo.squashMessage(baseID, headID); err != nil {
+					return nil, err
+				}
+			}
+		} else {
+			commitOpts.Parents = []string{baseID, headID}
+			if commitOpts.Message == "" {
+				commitOpts.Message = fmt.Sprintf("Merge %s into %s", head, base)
+			}
+		}
+		if newID, err = repo.commitTreeID(author, opts.Committer, result.TreeID, commitOpts); err != nil {
+			return nil, fmt.Errorf("unable to commit merge of %s into %s: %w", head, base, err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown merge style: %s", opts.Style)
+	}
+
+	if strings.HasPrefix(base, "refs/") {
+		if err := repo.updateRef(base, newID.String(), baseID, fmt.Sprintf("merge %s (%s)", head, opts.Style)); err != nil {
+			return nil, err
+		}
+	}
+	return newID, nil
+}
+
+// squashMessage lists the messages of the commits of head which are not in base like git merge --squash
+func (repo *Repository) squashMessage(baseID, headID string) (string, error) {
+	stdout, stderr, err := NewCommand(repo.Ctx, "log", "--reverse", "--format=* %s").AddDynamicArguments(baseID + ".." + headID).
+		RunStdString(&RunOpts{Dir: repo.Path})
+	if err != nil {
+		return "", ConcatenateError(err, stderr)
+	}
+	return "Squashed commit of the following:\n\n" + strings.TrimSpace(stdout), nil
+}
+
+// MergeConflictHunk is a conflicting region of a file, StartLine is the 1-based line of the "<<<<<<<" marker in the merged content
+type MergeConflictHunk struct {
+	StartLine int
+	Ours      []string
+	Theirs    []string
+}
+
+// MergeConflictFile is a file which can not be merged cleanly.
+// Content holds the merged file with conflict markers, it is empty if the file was deleted on one side or is binary.
+type MergeConflictFile struct {
+	MergeTreeConflict
+	Binary  bool
+	Content string
+	Hunks   []*MergeConflictHunk
+}
+
+// GetMergeConflicts returns the files which conflict when head is merged into base and their conflicting hunks.
+// No ref, index or worktree of the repository is changed.
+func (repo *Repository) GetMergeConflicts(base, head string) ([]*MergeConflictFile, error) {
+	result, err := repo.MergeTree("", base, head)
+	if err != nil {
+		return nil, err
+	}
+	if !result.HasConflicts() {
+		return nil, nil
+	}
+
+	tmpDir, err := os.MkdirTemp(os.TempDir(), "gitlib-merge-conflicts")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := util.RemoveAll(tmpDir); err != nil {
+			log.Error("failed to remove temporary directory %s: %v", tmpDir, err)
+		}
+	}()
+
+	files := make([]*MergeConflictFile, 0, len(result.Conflicts))
+	for _, conflict := range result.Conflicts {
+		file := &MergeConflictFile{MergeTreeConflict: *conflict}
+		files = append(files, file)
+		if conflict.OursID == "" || conflict.TheirsID == "" {
+			continue
+		}
+
+		paths := make([]string, 3)
+		for i, id := range []string{conflict.OursID, conflict.BaseID, conflict.TheirsID} {
+			paths[i] = filepath.Join(tmpDir, strconv.Itoa(i))
+			var content []byte
+			if id != "" {
+				stdout, stderr, err := NewCommand(repo.Ctx, "cat-file", "blob").AddDynamicArguments(id).RunStdBytes(&RunOpts{Dir: repo.Path})
+				if err != nil {
+					return nil, ConcatenateError(err, string(stderr))
+				}
+				content = stdout
+			}
+			if err := os.WriteFile(paths[i], content, 0o600); err != nil {
+				return nil, err
+			}
+		}
+
+		// merge-file exits with the number of conflicts, or a negative value for errors like binary files
+		stdout := new(strings.Builder)
+		stderr := new(strings.Builder)
+		err := NewCommand(repo.Ctx, "merge-file", "-p", "-L").AddDynamicArguments(base).AddArguments("-L", "base", "-L").AddDynamicArguments(head).
+			AddDashesAndList(paths...).Run(&RunOpts{Dir: tmpDir, Stdout: stdout, Stderr: stderr})
+		if err != nil {
+			var exitError *exec.ExitError
+			if !errors.As(err, &exitError) {
+				return nil, ConcatenateError(err, stderr.String())
+			}
+			if exitError.ExitCode() > 127 {
+				file.Binary = true
+				continue
+			}
+		}
+		file.Content = stdout.String()
+		file.Hunks = parseConflictHunks(file.Content)
+	}
+	return files, nil
+}
+
+// parseConflictHunks finds the regions between conflict markers, the base section of diff3 style markers is skipped
+func parseConflictHunks(content string) []*MergeConflictHunk {
+	var hunks []*MergeConflictHunk
+	var hunk *MergeConflictHunk
+	var section *[]string
+	for i, line := range strings.Split(content, "\n") {
+		switch {
+		case strings.HasPrefix(line, "<<<<<<<"):
+			hunk = &MergeConflictHunk{StartLine: i + 1}
+			section = &hunk.Ours
+		case hunk == nil:
+		case strings.HasPrefix(line, "|||||||"):
+			section = nil
+		case line == "=======":
+			section = &hunk.Theirs
+		case strings.HasPrefix(line, ">>>>>>>"):
+			hunks = append(hunks, hunk)
+			hunk, section = nil, nil
+		case section != nil:
+			*section = append(*section, line)
+		}
+	}
+	return hunks
+}
@@ -0,0 +1,271 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository_MergeTree(t *testing.T) {
+	// the merged tree is written to the repository, so it must not be the fixture
+	bareRepo1Path := filepath.Join(t.TempDir(), "repo.git")
+	assert.NoError(t, Clone(DefaultContext, filepath.Join(testReposDir, "repo1_bare"), bareRepo1Path, CloneRepoOptions{Bare: true}))
+	bareRepo1, err := openRepositoryWithDefaultContext(bareRepo1Path)
+	assert.NoError(t, err)
+	defer bareRepo1.Close()
+
+	result, err := bareRepo1.MergeTree("", "2839944139e0de9737a044f78b0e4b40d989a9e3", "37991dec2c8e592043f47155ce4808d4580f9123")
+	assert.NoError(t, err)
+	assert.False(t, result.HasConflicts())
+	assert.Equal(t, "93ff41c2966cf4a97c57d6e2ee4d18a0beda1b58", result.TreeID)
+
+	// the read-tree fallback has to produce the same tree for a clean merge
+	result, err = bareRepo1.mergeTreeReadTree("", "2839944139e0de9737a044f78b0e4b40d989a9e3", "37991dec2c8e592043f47155ce4808d4580f9123")
+	assert.NoError(t, err)
+	assert.False(t, result.HasConflicts())
+	assert.Equal(t, "93ff41c2966cf4a97c57d6e2ee4d18a0beda1b58", result.TreeID)
+}
+
+func TestRepository_MergeTreeConflict(t *testing.T) {
+	repoPath := t.TempDir()
+	repo, err := InitRepository(DefaultContext, repoPath, InitWithBare(false))
+	assert.NoError(t, err)
+	defer repo.Close()
+	run := func(args ...string) string {
+		cmdArgs := []CmdArg{"-c", "user.name=Test", "-c", "user.email=test@example.com"}
+		for _, arg := range args {
+			cmdArgs = append(cmdArgs, CmdArg(arg))
+		}
+		stdout, _, err := NewCommand(DefaultContext, cmdArgs...).RunStdString(&RunOpts{Dir: repoPath})
+		assert.NoError(t, err)
+		return strings.TrimSpace(stdout)
+	}
+	commit := func(content string) string {
+		assert.NoError(t, os.WriteFile(filepath.Join(repoPath, "file.txt"), []byte(content), 0o644))
+		run("add", "file.txt")
+		run("commit", "-m", content)
+		return run("rev-parse", "HEAD")
+	}
+	base := commit("base\n")
+	ours := commit("ours\n")
+	run("checkout", "-b", "other", base)
+	theirs := commit("theirs\n")
+
+	for _, merge := range []func(base, ours, theirs string) (*MergeTreeResult, error){repo.MergeTree, repo.mergeTreeReadTree} {
+		result, err := merge(base, ours, theirs)
+		assert.NoError(t, err)
+		assert.True(t, result.HasConflicts())
+		assert.Len(t, result.Conflicts, 1)
+		assert.Equal(t, "file.txt", result.Conflicts[0].Path)
+		assert.NotEmpty(t, result.Conflicts[0].BaseID)
+		assert.NotEmpty(t, result.Conflicts[0].OursID)
+		assert.NotEmpty(t, result.Conflicts[0].TheirsID)
+	}
+
+	result, err := repo.mergeTreeWriteTree("", ours, theirs)
+	assert.NoError(t, err)
+	assert.True(t, result.HasConflicts())
+	assert.NotEmpty(t, result.TreeID)
+}
+
+func TestRepository_MergeTreeChangedOnBothSides(t *testing.T) {
+	repoPath := t.TempDir()
+	repo, err := InitRepository(DefaultContext, repoPath, InitWithBare(false))
+	assert.NoError(t, err)
+	defer repo.Close()
+	run := func(args ...string) string {
+		cmdArgs := []CmdArg{"-c", "user.name=Test", "-c", "user.email=test@example.com"}
+		for _, arg := range args {
+			cmdArgs = append(cmdArgs, CmdArg(arg))
+		}
+		stdout, _, err := NewCommand(DefaultContext, cmdArgs...).RunStdString(&RunOpts{Dir: repoPath})
+		assert.NoError(t, err)
+		return strings.TrimSpace(stdout)
+	}
+	commit := func(content string) string {
+		assert.NoError(t, os.WriteFile(filepath.Join(repoPath, "file.txt"), []byte(content), 0o644))
+		run("add", "file.txt")
+		run("commit", "-m", content)
+		return run("rev-parse", "HEAD")
+	}
+	base := commit("1\n2\n3\n4\n5\n")
+	ours := commit("one\n2\n3\n4\n5\n")
+	run("checkout", "-b", "other", base)
+	theirs := commit("1\n2\n3\n4\nfive\n")
+	merged := commit("one\n2\n3\n4\nfive\n")
+	expected := run("rev-parse", merged+"^{tree}")
+
+	// git < 2.40 merges with read-tree when the base is given, the fallback merges the file changed on both sides
+	for _, merge := range []func(base, ours, theirs string) (*MergeTreeResult, error){repo.MergeTree, repo.mergeTreeReadTree} {
+		result, err := merge(base, ours, theirs)
+		assert.NoError(t, err)
+		assert.False(t, result.HasConflicts())
+		assert.Equal(t, expected, result.TreeID)
+	}
+	if CheckGitVersionAtLeast("2.38") == nil {
+		result, err := repo.mergeTreeWriteTree("", ours, theirs)
+		assert.NoError(t, err)
+		assert.False(t, result.HasConflicts())
+		assert.Equal(t, expected, result.TreeID)
+	}
+}
+
+func TestRepository_Merge(t *testing.T) {
+	repoPath := filepath.Join(t.TempDir(), "repo.git")
+	assert.NoError(t, Clone(DefaultContext, filepath.Join(testReposDir, "repo1_bare"), repoPath, CloneRepoOptions{Bare: true}))
+	repo, err := openRepositoryWithDefaultContext(repoPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+	revParse := func(rev string) string {
+		stdout, _, err := NewCommand(DefaultContext, "rev-parse").AddDynamicArguments(rev).RunStdString(&RunOpts{Dir: repoPath})
+		assert.NoError(t, err)
+		return strings.TrimSpace(stdout)
+	}
+	committer := &Signature{Name: "Merger", Email: "merger@example.com"}
+	const master = "feaf4ba6bc635fec442f46ddd4512416ec43c2c2"
+
+	_, err = repo.Merge("refs/heads/master", "refs/heads/branch1", MergeOptions{Style: MergeStyleFastForwardOnly})
+	assert.ErrorIs(t, err, ErrNotFastForward)
+
+	run := func(args ...string) {
+		cmdArgs := make([]CmdArg, 0, len(args))
+		for _, arg := range args {
+			cmdArgs = append(cmdArgs, CmdArg(arg))
+		}
+		_, _, err := NewCommand(DefaultContext, cmdArgs...).RunStdString(&RunOpts{Dir: repoPath})
+		assert.NoError(t, err)
+	}
+	run("branch", "squash", "master")
+	run("branch", "ff", "master~1")
+
+	id, err := repo.Merge("refs/heads/master", "refs/heads/branch1", MergeOptions{Style: MergeStyleMerge, Committer: committer})
+	assert.NoError(t, err)
+	assert.Equal(t, id.String(), revParse("refs/heads/master"))
+	commit, err := repo.GetCommit(id.String())
+	assert.NoError(t, err)
+	assert.Len(t, commit.Parents, 2)
+	assert.Equal(t, master, commit.Parents[0].String())
+	assert.Equal(t, "Merge refs/heads/branch1 into refs/heads/master\n", commit.CommitMessage)
+	_, err = commit.GetTreeEntryByPath("branch1.txt")
+	assert.NoError(t, err)
+
+	// merging again does nothing
+	again, err := repo.Merge("refs/heads/master", "refs/heads/branch1", MergeOptions{Style: MergeStyleMerge, Committer: committer})
+	assert.NoError(t, err)
+	assert.Equal(t, id, again)
+
+	squashID, err := repo.Merge("refs/heads/squash", "refs/heads/branch1", MergeOptions{
+		Style:     MergeStyleSquash,
+		Committer: committer,
+		Author:    &Signature{Name: "Author", Email: "author@example.com"},
+	})
+	assert.NoError(t, err)
+	squash, err := repo.GetCommit(squashID.String())
+	assert.NoError(t, err)
+	assert.Equal(t, []ObjectID{MustIDFromString(master)}, squash.Parents)
+	assert.Equal(t, "Author", squash.Author.Name)
+	assert.Equal(t, "Merger", squash.Committer.Name)
+	assert.Equal(t, "Squashed commit of the following:\n\n* Add branch1.txt\n* Edit file1.txt\n", squash.CommitMessage)
+	assert.Equal(t, commit.Tree.ID, squash.Tree.ID)
+
+	ffID, err := repo.Merge("refs/heads/ff", master, MergeOptions{Style: MergeStyleFastForwardOnly})
+	assert.NoError(t, err)
+	assert.Equal(t, master, ffID.String())
+	assert.Equal(t, master, revParse("refs/heads/ff"))
+
+	_, err = repo.Merge("refs/heads/master", "refs/heads/branch2", MergeOptions{Style: MergeStyle("octopus"), Committer: committer})
+	assert.Error(t, err)
+	_, err = repo.Merge("refs/heads/master", "refs/heads/branch2", MergeOptions{Style: MergeStyleMerge, Committer: committer, Sign: true, SigningKey: "unknown-key"})
+	assert.Error(t, err)
+}
+
+func TestRepository_MergeConflict(t *testing.T) {
+	repoPath := t.TempDir()
+	repo, err := InitRepository(DefaultContext, repoPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+	run := func(args ...CmdArg) string {
+		stdout, _, err := NewCommand(DefaultContext, "-c", "user.name=Test", "-c", "user.email=test@example.com").AddArguments(args...).RunStdString(&RunOpts{Dir: repoPath})
+		assert.NoError(t, err)
+		return strings.TrimSpace(stdout)
+	}
+	commit := func(content string) {
+		assert.NoError(t, os.WriteFile(filepath.Join(repoPath, "file.txt"), []byte(content), 0o644))
+		run("add", "file.txt")
+		run("commit", "-m", CmdArg(content))
+	}
+	commit("base\n")
+	run("branch", "other")
+	commit("ours\n")
+	run("checkout", "other")
+	commit("theirs\n")
+	head := run("rev-parse", "refs/heads/main")
+
+	_, err = repo.Merge("refs/heads/main", "refs/heads/other", MergeOptions{Style: MergeStyleMerge, Committer: &Signature{Name: "Test", Email: "test@example.com"}})
+	if assert.True(t, IsErrMergeConflict(err), "%v", err) {
+		assert.Equal(t, "file.txt", err.(*ErrMergeConflict).Conflicts[0].Path)
+	}
+	assert.Equal(t, head, run("rev-parse", "refs/heads/main"))
+}
+
+func TestRepository_GetMergeConflicts(t *testing.T) {
+	repoPath := t.TempDir()
+	repo, err := InitRepository(DefaultContext, repoPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+	run := func(args ...CmdArg) {
+		_, stderr, err := NewCommand(DefaultContext, "-c", "user.name=Test", "-c", "user.email=test@example.com").AddArguments(args...).RunStdString(&RunOpts{Dir: repoPath})
+		assert.NoError(t, err, stderr)
+	}
+	commit := func(files map[string]string) {
+		for name, content := range files {
+			if content == "" {
+				run("rm", "-q", CmdArg(name))
+				continue
+			}
+			assert.NoError(t, os.WriteFile(filepath.Join(repoPath, name), []byte(content), 0o644))
+		}
+		run("add", "--all")
+		run("commit", "-m", "commit")
+	}
+	commit(map[string]string{"text.txt": "a\nb\nc\nd\ne\n", "binary.bin": "\x00base", "deleted.txt": "deleted\n", "clean.txt": "clean\n"})
+	run("branch", "other")
+	commit(map[string]string{"text.txt": "a\nours\nc\nd\ne\n", "binary.bin": "\x00ours", "deleted.txt": "changed\n"})
+	run("checkout", "-q", "other")
+	commit(map[string]string{"text.txt": "a\ntheirs\nc\nd\ne\n", "binary.bin": "\x00theirs", "deleted.txt": "", "clean.txt": "changed\n"})
+
+	conflicts, err := repo.GetMergeConflicts("main", "other")
+	assert.NoError(t, err)
+	if assert.Len(t, conflicts, 3) {
+		assert.Equal(t, "binary.bin", conflicts[0].Path)
+		assert.True(t, conflicts[0].Binary)
+		assert.Empty(t, conflicts[0].Hunks)
+
+		assert.Equal(t, "deleted.txt", conflicts[1].Path)
+		assert.Empty(t, conflicts[1].TheirsID)
+		assert.Empty(t, conflicts[1].Content)
+
+		assert.Equal(t, "text.txt", conflicts[2].Path)
+		assert.Equal(t, "a\n<<<<<<< main\nours\n=======\ntheirs\n>>>>>>> other\nc\nd\ne\n", conflicts[2].Content)
+		assert.Equal(t, []*MergeConflictHunk{{StartLine: 2, Ours: []string{"ours"}, Theirs: []string{"theirs"}}}, conflicts[2].Hunks)
+	}
+
+	conflicts, err = repo.GetMergeConflicts("main", "main~1")
+	assert.NoError(t, err)
+	assert.Empty(t, conflicts)
+}
+
+func TestParseConflictHunks(t *testing.T) {
+	hunks := parseConflictHunks("<<<<<<< ours\na\n||||||| base\nb\n=======\n>>>>>>> theirs\nx\n<<<<<<< ours\n=======\nc\nd\n>>>>>>> theirs\n")
+	assert.Equal(t, []*MergeConflictHunk{
+		{StartLine: 1, Ours: []string{"a"}},
+		{StartLine: 8, Theirs: []string{"c", "d"}},
+	}, hunks)
+}
@@ -0,0 +1,147 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// NoteOptions represents the possible options to the notes methods
+type NoteOptions struct {
+	// Ref is the notes ref to use, NotesRef when empty.
+	// A short name like "ci" is expanded to "refs/notes/ci".
+	Ref string
+	// Committer is used as author and committer of the notes commit created by SetNote and RemoveNote
+	Committer *Signature
+}
+
+func (opts NoteOptions) notesRef() string {
+	if opts.Ref == "" {
+		return NotesRef
+	}
+	if strings.HasPrefix(opts.Ref, "refs/") {
+		return opts.Ref
+	}
+	return NotesPrefix + opts.Ref
+}
+
+func (opts NoteOptions) env() []string {
+	if opts.Committer == nil {
+		return nil
+	}
+	return append(os.Environ(), SignatureEnv(opts.Committer, opts.Committer)...)
+}
+
+// NoteEntry represents a note listed from a notes ref
+type NoteEntry struct {
+	// ID is the ID of the blob holding the note message
+	ID ObjectID
+	// CommitID is the ID of the object the note is attached to
+	CommitID ObjectID
+}
+
+// GetNote returns the note attached to the given commit
+func (repo *Repository) GetNote(commitID string, opts NoteOptions) (*Note, error) {
+	note := &Note{}
+	if err := getNote(repo.Ctx, repo, opts.notesRef(), commitID, note); err != nil {
+		return nil, err
+	}
+	return note, nil
+}
+
+// SetNote attaches the message as note to the given commit, an existing note is replaced
+func (repo *Repository) SetNote(commitID string, message []byte, opts NoteOptions) error {
+	if skipDryRun(repo.Ctx, "set note %s of %s [repo_path: %s]", opts.notesRef(), commitID, repo.Path) {
+		return nil
+	}
+	_, stderr, err := NewCommand(repo.Ctx, "notes").
+		AddOptionFormat("--ref=%s", opts.notesRef()).
+		AddArguments("add", "-f", "--allow-empty", "-F", "-").
+		AddDynamicArguments(commitID).
+		RunStdString(&RunOpts{
+			Dir:   repo.Path,
+			Env:   opts.env(),
+			Stdin: strings.NewReader(string(message)),
+		})
+	if err != nil {
+		return fmt.Errorf("unable to set note for %s: %w", commitID, ConcatenateError(err, stderr))
+	}
+	return nil
+}
+
+// RemoveNote removes the note attached to the given commit, ErrNotExist is returned if there is no note
+func (repo *Repository) RemoveNote(commitID string, opts NoteOptions) error {
+	notesRef := opts.notesRef()
+	if !repo.IsReferenceExist(notesRef) {
+		return ErrNotExist{ID: commitID, RelPath: notesRef}
+	}
+	if skipDryRun(repo.Ctx, "remove note %s of %s [repo_path: %s]", notesRef, commitID, repo.Path) {
+		return nil
+	}
+	_, stderr, err := NewCommand(repo.Ctx, "notes").
+		AddOptionFormat("--ref=%s", notesRef).
+		AddArguments("remove").
+		AddDynamicArguments(commitID).
+		RunStdString(&RunOpts{Dir: repo.Path, Env: opts.env()})
+	if err != nil {
+		if strings.Contains(stderr, "has no note") {
+			return ErrNotExist{ID: commitID, RelPath: notesRef}
+		}
+		return fmt.Errorf("unable to remove note for %s: %w", commitID, ConcatenateError(err, stderr))
+	}
+	return nil
+}
+
+// ListNotes returns all notes of the notes ref, ErrNotExist is returned if the ref does not exist
+func (repo *Repository) ListNotes(opts NoteOptions) ([]*NoteEntry, error) {
+	notesRef := opts.notesRef()
+	if !repo.IsReferenceExist(notesRef) {
+		return nil, ErrNotExist{ID: notesRef}
+	}
+
+	stdout, stderr, err := NewCommand(repo.Ctx, "notes").
+		AddOptionFormat("--ref=%s", notesRef).
+		AddArguments("list").
+		RunStdString(&RunOpts{Dir: repo.Path})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list notes of %s: %w", notesRef, ConcatenateError(err, stderr))
+	}
+
+	var entries []*NoteEntry
+	scanner := bufio.NewScanner(strings.NewReader(stdout))
+	for scanner.Scan() {
+		// <note blob> <annotated object>
+		noteID, commitID, ok := strings.Cut(scanner.Text(), " ")
+		if !ok {
+			continue
+		}
+		id, err := repo.ObjectFormat().NewIDFromString(noteID)
+		if err != nil {
+			return nil, err
+		}
+		objectID, err := repo.ObjectFormat().NewIDFromString(commitID)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &NoteEntry{ID: id, CommitID: objectID})
+	}
+	return entries, scanner.Err()
+}
+
+// ListNotesRefs returns the names of all notes refs of the repository
+func (repo *Repository) ListNotesRefs() ([]string, error) {
+	refs, err := repo.GetRefsFiltered(NotesPrefix)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		names = append(names, ref.Name)
+	}
+	return names, nil
+}
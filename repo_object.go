@@ -1,7 +1,9 @@
 package git
 
 import (
+	"fmt"
 	"io"
+	"strings"
 
 	"github.com/go-git/go-git/v5/plumbing"
 )
@@ -28,15 +30,23 @@ func (o ObjectType) Bytes() []byte {
 }
 
 // HashObject takes a reader and returns SHA1 hash for that reader
-func (repo *Repository) HashObject(reader io.Reader) (SHA1, error) {
+func (repo *Repository) HashObject(reader io.Reader) (ObjectID, error) {
 	idStr, err := repo.hashObject(reader)
 	if err != nil {
-		return SHA1{}, err
+		return nil, err
 	}
-	return NewIDFromString(idStr)
+	return repo.ObjectFormat().NewIDFromString(idStr)
 }
 
 func (repo *Repository) hashObject(reader io.Reader) (string, error) {
+	// gogit only writes sha1 objects
+	if repo.backendFor(OperationObjects, BackendGoGit, BackendCLI) == BackendCLI {
+		stdout, stderr, err := NewCommand(repo.Ctx, "hash-object", "-w", "--stdin").RunStdString(&RunOpts{Dir: repo.Path, Stdin: reader})
+		if err != nil {
+			return "", fmt.Errorf("unable to hash object in repo %s: %w", repo.Path, ConcatenateError(err, stderr))
+		}
+		return strings.TrimSpace(stdout), nil
+	}
 	obj := repo.gogit.Storer.NewEncodedObject()
 	obj.SetType(plumbing.BlobObject)
 
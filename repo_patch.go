@@ -0,0 +1,224 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/enverbisevac/gitlib/log"
+	"github.com/enverbisevac/gitlib/util"
+)
+
+// FormatPatchOptions options for generating mbox formatted patches
+type FormatPatchOptions struct {
+	// Combined generates a single patch with all changes from the merge base of base and head to head,
+	// it uses the author and message of head. Otherwise one patch per commit is generated.
+	Combined bool
+	// Numbered adds [PATCH n/m] to the subjects even for a single patch
+	Numbered bool
+	// CoverLetter adds a cover letter in front of the patches, it is ignored for combined patches
+	CoverLetter bool
+	// Signature replaces the git version at the end of each patch
+	Signature   string
+	NoSignature bool
+}
+
+// FormatPatch generates mbox formatted patches of the commits reachable from head but not from base, able to be used with `git am`.
+func (repo *Repository) FormatPatch(base, head string, opts FormatPatchOptions) (io.Reader, error) {
+	if opts.Combined {
+		from := base
+		if mergeBase, _, err := NewCommand(repo.Ctx, "merge-base").AddDynamicArguments(base, head).RunStdString(&RunOpts{Dir: repo.Path}); err == nil {
+			from = strings.TrimSpace(mergeBase)
+		}
+		return repo.formatCombinedPatch(from, head, opts)
+	}
+
+	cmd := NewCommand(repo.Ctx, "format-patch", "--binary", "--stdout")
+	if opts.Numbered {
+		cmd.AddArguments("--numbered")
+	}
+	if opts.CoverLetter {
+		cmd.AddArguments("--cover-letter")
+	}
+	if opts.NoSignature {
+		cmd.AddArguments("--no-signature")
+	} else if opts.Signature != "" {
+		cmd.AddOptionFormat("--signature=%s", opts.Signature)
+	}
+	cmd.AddDynamicArguments(base + ".." + head)
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	if err := cmd.Run(&RunOpts{Dir: repo.Path, Stdout: stdout, Stderr: stderr}); err != nil {
+		return nil, fmt.Errorf("unable to format patches between %s and %s: %w", base, head, ConcatenateError(err, stderr.String()))
+	}
+	return stdout, nil
+}
+
+// formatCombinedPatch writes the diff between from and head as a single patch in the format of git format-patch
+func (repo *Repository) formatCombinedPatch(from, head string, opts FormatPatchOptions) (io.Reader, error) {
+	commit, err := repo.GetCommit(head)
+	if err != nil {
+		return nil, err
+	}
+
+	subject := "[PATCH] "
+	if opts.Numbered {
+		subject = "[PATCH 1/1] "
+	}
+	summary, body, _ := strings.Cut(strings.TrimSpace(commit.CommitMessage), "\n")
+
+	patch := new(bytes.Buffer)
+	fmt.Fprintf(patch, "From %s Mon Sep 17 00:00:00 2001\n", commit.ID.String())
+	fmt.Fprintf(patch, "From: %s <%s>\n", mime.QEncoding.Encode("utf-8", commit.Author.Name), commit.Author.Email)
+	fmt.Fprintf(patch, "Date: %s\n", commit.Author.When.Format(time.RFC1123Z))
+	fmt.Fprintf(patch, "Subject: %s\n\n", mime.QEncoding.Encode("utf-8", subject+summary))
+	if body = strings.TrimSpace(body); body != "" {
+		fmt.Fprintf(patch, "%s\n\n", body)
+	}
+	patch.WriteString("---\n")
+
+	stderr := new(bytes.Buffer)
+	if err := NewCommand(repo.Ctx, "diff", "--stat", "--summary", "-p", "--binary").AddDynamicArguments(from, head).
+		Run(&RunOpts{Dir: repo.Path, Stdout: patch, Stderr: stderr}); err != nil {
+		return nil, fmt.Errorf("unable to diff %s and %s: %w", from, head, ConcatenateError(err, stderr.String()))
+	}
+
+	if !opts.NoSignature {
+		signature := opts.Signature
+		if signature == "" && gitVersion != nil {
+			signature = gitVersion.Original()
+		}
+		fmt.Fprintf(patch, "-- \n%s\n\n", signature)
+	}
+	return patch, nil
+}
+
+// PatchApplyFailure describes a file of a patch which does not apply.
+// Line is the start line of the first failing hunk in the original file, 0 if the whole file failed.
+type PatchApplyFailure struct {
+	Path   string
+	Line   int
+	Reason string
+}
+
+// CheckPatchApplies checks if the patch applies to the tree of base using a temporary index.
+// A patch which does not apply returns ErrPatchDoesNotApply listing the failing files.
+func (repo *Repository) CheckPatchApplies(base string, patch io.Reader) error {
+	tmpDir, err := os.MkdirTemp("", "check-patch")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := util.RemoveAll(tmpDir); err != nil {
+			log.Error("failed to remove tmp index file: %v", err)
+		}
+	}()
+	env := append(os.Environ(), "GIT_INDEX_FILE="+filepath.Join(tmpDir, ".tmp-index"))
+
+	if _, stderr, err := NewCommand(repo.Ctx, "read-tree").AddDynamicArguments(base).RunStdString(&RunOpts{Dir: repo.Path, Env: env}); err != nil {
+		return fmt.Errorf("unable to read tree of %s: %w", base, ConcatenateError(err, stderr))
+	}
+
+	stderr := new(strings.Builder)
+	err = NewCommand(repo.Ctx, "apply", "--check", "--cached").Run(&RunOpts{
+		Dir:    repo.Path,
+		Env:    env,
+		Stdin:  patch,
+		Stderr: stderr,
+	})
+	if err == nil {
+		return nil
+	}
+	var exitError *exec.ExitError
+	if !errors.As(err, &exitError) || exitError.ExitCode() != 1 {
+		return fmt.Errorf("unable to check patch: %w", ConcatenateError(err, stderr.String()))
+	}
+	return &ErrPatchDoesNotApply{Failures: parseApplyErrors(stderr.String()), StdErr: stderr.String()}
+}
+
+// ApplyPatchAndCommit applies the unified diff to the tree of the base commit and commits the result
+// without touching a worktree. If no parents are given in opts, base is the only parent.
+// It returns ErrPatchDoesNotApply if the patch does not apply cleanly.
+func (repo *Repository) ApplyPatchAndCommit(base string, patch io.Reader, author, committer *Signature, opts CommitTreeOpts) (ObjectID, error) {
+	baseID, err := repo.resolveCommitID(base)
+	if err != nil {
+		return nil, err
+	}
+
+	indexFilename, _, cancel, err := repo.ReadTreeToTemporaryIndex(baseID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read tree of %s: %w", base, err)
+	}
+	defer cancel()
+	env := append(os.Environ(), "GIT_INDEX_FILE="+indexFilename)
+
+	stderr := new(strings.Builder)
+	err = NewCommand(repo.Ctx, "apply", "--cached").Run(&RunOpts{
+		Dir:    repo.Path,
+		Env:    env,
+		Stdin:  patch,
+		Stderr: stderr,
+	})
+	if err != nil {
+		var exitError *exec.ExitError
+		if !errors.As(err, &exitError) || exitError.ExitCode() != 1 {
+			return nil, fmt.Errorf("unable to apply patch: %w", ConcatenateError(err, stderr.String()))
+		}
+		return nil, &ErrPatchDoesNotApply{Failures: parseApplyErrors(stderr.String()), StdErr: stderr.String()}
+	}
+
+	treeID, stderrStr, runErr := NewCommand(repo.Ctx, "write-tree").RunStdString(&RunOpts{Dir: repo.Path, Env: env})
+	if runErr != nil {
+		return nil, fmt.Errorf("unable to write tree: %w", ConcatenateError(runErr, stderrStr))
+	}
+
+	if len(opts.Parents) == 0 {
+		opts.Parents = []string{baseID}
+	}
+	return repo.commitTreeID(author, committer, strings.TrimSpace(treeID), opts)
+}
+
+// parseApplyErrors parses the errors of git apply, e.g.
+//
+//	error: patch failed: file.txt:1
+//	error: file.txt: patch does not apply
+//	error: other.txt: does not exist in index
+func parseApplyErrors(stderr string) []*PatchApplyFailure {
+	var failures []*PatchApplyFailure
+	lines := make(map[string]int)
+	for _, line := range strings.Split(stderr, "\n") {
+		msg := strings.TrimPrefix(line, "error: ")
+		if msg == line {
+			continue
+		}
+		if location := strings.TrimPrefix(msg, "patch failed: "); location != msg {
+			if i := strings.LastIndexByte(location, ':'); i > 0 {
+				if n, err := strconv.Atoi(location[i+1:]); err == nil {
+					if _, ok := lines[location[:i]]; !ok {
+						lines[location[:i]] = n
+					}
+				}
+			}
+			continue
+		}
+		path, reason, ok := strings.Cut(msg, ": ")
+		if !ok {
+			continue
+		}
+		failures = append(failures, &PatchApplyFailure{Path: path, Line: lines[path], Reason: reason})
+	}
+	return failures
+}
@@ -0,0 +1,120 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository_FormatPatch(t *testing.T) {
+	repo, err := openRepositoryWithDefaultContext(filepath.Join(testReposDir, "repo1_bare"))
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	// applies the patches on master and returns the resulting tree
+	apply := func(patch io.Reader) string {
+		clonePath, err := cloneRepo(t, filepath.Join(testReposDir, "repo1_bare"))
+		assert.NoError(t, err)
+		_, stderr, err := NewCommand(DefaultContext, "-c", "user.name=test", "-c", "user.email=test@example.com", "am").
+			RunStdString(&RunOpts{Dir: clonePath, Stdin: patch})
+		assert.NoError(t, err, stderr)
+		stdout, _, err := NewCommand(DefaultContext, "rev-parse", "HEAD^{tree}").RunStdString(&RunOpts{Dir: clonePath})
+		assert.NoError(t, err)
+		return strings.TrimSpace(stdout)
+	}
+
+	patch, err := repo.FormatPatch("master", "branch1", FormatPatchOptions{Numbered: true, CoverLetter: true, Signature: "gitlib"})
+	assert.NoError(t, err)
+	content, err := io.ReadAll(patch)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "Subject: [PATCH 0/2] *** SUBJECT HERE ***")
+	assert.Contains(t, string(content), "Subject: [PATCH 1/2] Add branch1.txt")
+	assert.Contains(t, string(content), "Subject: [PATCH 2/2] Edit file1.txt")
+	assert.Contains(t, string(content), "-- \ngitlib\n")
+
+	patch, err = repo.FormatPatch("master", "branch1", FormatPatchOptions{NoSignature: true})
+	assert.NoError(t, err)
+	separate := apply(patch)
+
+	patch, err = repo.FormatPatch("master", "branch1", FormatPatchOptions{Combined: true})
+	assert.NoError(t, err)
+	content, err = io.ReadAll(patch)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(content), "From 2839944139e0de9737a044f78b0e4b40d989a9e3 Mon Sep 17 00:00:00 2001\n"), string(content))
+	assert.Contains(t, string(content), "Subject: [PATCH] Edit file1.txt\n")
+	assert.Contains(t, string(content), "2 files changed")
+	assert.Equal(t, separate, apply(strings.NewReader(string(content))))
+
+	_, err = repo.FormatPatch("master", "unknown", FormatPatchOptions{})
+	assert.Error(t, err)
+	_, err = repo.FormatPatch("master", "unknown", FormatPatchOptions{Combined: true})
+	assert.Error(t, err)
+}
+
+func TestRepository_CheckPatchApplies(t *testing.T) {
+	repo, err := openRepositoryWithDefaultContext(filepath.Join(testReposDir, "repo1_bare"))
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	patch, err := repo.FormatPatch("master", "branch1", FormatPatchOptions{})
+	assert.NoError(t, err)
+	content, err := io.ReadAll(patch)
+	assert.NoError(t, err)
+	assert.NoError(t, repo.CheckPatchApplies("master", strings.NewReader(string(content))))
+
+	// branch1.txt already exists on branch1
+	err = repo.CheckPatchApplies("branch1", strings.NewReader(string(content)))
+	if assert.True(t, IsErrPatchDoesNotApply(err), "%v", err) {
+		assert.Equal(t, []*PatchApplyFailure{
+			{Path: "branch1.txt", Reason: "already exists in index"},
+			{Path: "file1.txt", Line: 1, Reason: "patch does not apply"},
+		}, err.(*ErrPatchDoesNotApply).Failures)
+	}
+
+	err = repo.CheckPatchApplies("master", strings.NewReader("garbage"))
+	assert.Error(t, err)
+	assert.False(t, IsErrPatchDoesNotApply(err))
+	assert.Error(t, repo.CheckPatchApplies("unknown", strings.NewReader(string(content))))
+}
+
+func TestParseApplyErrors(t *testing.T) {
+	assert.Equal(t, []*PatchApplyFailure{
+		{Path: "f", Line: 1, Reason: "patch does not apply"},
+		{Path: "h", Reason: "does not exist in index"},
+	}, parseApplyErrors("error: patch failed: f:1\nerror: f: patch does not apply\nerror: h: does not exist in index\n"))
+}
+
+func TestRepository_ApplyPatchAndCommit(t *testing.T) {
+	clonePath, err := cloneRepo(t, filepath.Join(testReposDir, "repo1_bare"))
+	assert.NoError(t, err)
+	repo, err := openRepositoryWithDefaultContext(clonePath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	patch := "diff --git a/patched.txt b/patched.txt\nnew file mode 100644\n--- /dev/null\n+++ b/patched.txt\n@@ -0,0 +1 @@\n+patched\n"
+	author := &Signature{Name: "Author", Email: "author@example.com"}
+	id, err := repo.ApplyPatchAndCommit("master", strings.NewReader(patch), author, author, CommitTreeOpts{Message: "Apply patch\n", NoGPGSign: true})
+	assert.NoError(t, err)
+
+	commit, err := repo.GetCommit(id.String())
+	assert.NoError(t, err)
+	assert.Equal(t, "Apply patch\n", commit.Message())
+	assert.Equal(t, 1, commit.ParentCount())
+	parent, err := commit.ParentID(0)
+	assert.NoError(t, err)
+	assert.Equal(t, "feaf4ba6bc635fec442f46ddd4512416ec43c2c2", parent.String())
+	content, err := commit.GetFileContent("patched.txt", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "patched\n", content)
+
+	conflicting := "diff --git a/patched.txt b/patched.txt\n--- a/patched.txt\n+++ b/patched.txt\n@@ -1 +1 @@\n-other\n+changed\n"
+	_, err = repo.ApplyPatchAndCommit("master", strings.NewReader(conflicting), author, author, CommitTreeOpts{Message: "Conflict\n", NoGPGSign: true})
+	assert.True(t, IsErrPatchDoesNotApply(err), "%v", err)
+}
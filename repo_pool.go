@@ -0,0 +1,177 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultRepositoryIdleTimeout is the time an unused repository is kept open by GetRepository
+const DefaultRepositoryIdleTimeout = 5 * time.Minute
+
+// ErrRepositoryPoolClosed is returned by RepositoryPool.Get once the pool is closed
+var ErrRepositoryPoolClosed = errors.New("repository pool is closed")
+
+type pooledRepository struct {
+	// ready is closed once the repository is opened, repo and err are set then
+	ready chan struct{}
+	repo  *Repository
+	err   error
+	refs  int
+	// idle closes the repository once it is unused for the idle timeout
+	idle *time.Timer
+}
+
+// RepositoryPool shares opened repositories between their users, a repository is closed
+// once it has not been used for the idle timeout of the pool.
+type RepositoryPool struct {
+	ctx         context.Context
+	idleTimeout time.Duration
+
+	mu     sync.Mutex
+	repos  map[string]*pooledRepository
+	closed bool
+}
+
+// NewRepositoryPool creates a pool whose repositories run their commands within ctx
+// and are closed after being unused for idleTimeout.
+func NewRepositoryPool(ctx context.Context, idleTimeout time.Duration) *RepositoryPool {
+	return &RepositoryPool{
+		ctx:         ctx,
+		idleTimeout: idleTimeout,
+		repos:       make(map[string]*pooledRepository),
+	}
+}
+
+var (
+	defaultRepositoryPool     *RepositoryPool
+	defaultRepositoryPoolOnce sync.Once
+)
+
+// GetRepository returns the repository at the given path from a process-wide pool, see RepositoryPool.Get
+func GetRepository(ctx context.Context, path string) (*Repository, io.Closer, error) {
+	defaultRepositoryPoolOnce.Do(func() {
+		defaultRepositoryPool = NewRepositoryPool(DefaultContext, DefaultRepositoryIdleTimeout)
+	})
+	return defaultRepositoryPool.Get(ctx, path)
+}
+
+type repositoryRelease struct {
+	once    sync.Once
+	release func()
+}
+
+func (r *repositoryRelease) Close() error {
+	r.once.Do(r.release)
+	return nil
+}
+
+// Get returns the shared repository at the given path, opening it if it isn't open yet.
+// The returned closer releases the repository and must be called once it is not used anymore,
+// the repository itself must not be closed. Commands of the repository run within the context of the pool,
+// ctx only bounds waiting for the repository to be opened.
+func (p *RepositoryPool) Get(ctx context.Context, path string) (*Repository, io.Closer, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, nil, ErrRepositoryPoolClosed
+	}
+	entry, ok := p.repos[path]
+	if !ok {
+		entry = &pooledRepository{ready: make(chan struct{})}
+		p.repos[path] = entry
+		go p.open(path, entry)
+	}
+	entry.refs++
+	if entry.idle != nil {
+		entry.idle.Stop()
+		entry.idle = nil
+	}
+	p.mu.Unlock()
+
+	release := &repositoryRelease{release: func() {
+		p.release(path, entry)
+	}}
+	select {
+	case <-entry.ready:
+	case <-ctx.Done():
+		_ = release.Close()
+		return nil, nil, ctx.Err()
+	}
+	if entry.err != nil {
+		_ = release.Close()
+		return nil, nil, entry.err
+	}
+	return entry.repo, release, nil
+}
+
+func (p *RepositoryPool) open(path string, entry *pooledRepository) {
+	entry.repo, entry.err = OpenRepository(p.ctx, path)
+	if entry.err != nil {
+		// the next Get tries again
+		p.mu.Lock()
+		if p.repos[path] == entry {
+			delete(p.repos, path)
+		}
+		p.mu.Unlock()
+	}
+	close(entry.ready)
+}
+
+func (p *RepositoryPool) release(path string, entry *pooledRepository) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entry.refs--
+	if entry.refs > 0 || p.repos[path] != entry {
+		return
+	}
+	var idle *time.Timer
+	idle = time.AfterFunc(p.idleTimeout, func() {
+		p.mu.Lock()
+		// the repository may have been used again meanwhile
+		if p.repos[path] != entry || entry.idle != idle {
+			p.mu.Unlock()
+			return
+		}
+		delete(p.repos, path)
+		p.mu.Unlock()
+		<-entry.ready
+		_ = entry.repo.Close()
+	})
+	entry.idle = idle
+}
+
+// Close closes the repositories of the pool, it must only be called once they are not used anymore
+func (p *RepositoryPool) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	repos := p.repos
+	p.repos = make(map[string]*pooledRepository)
+	for _, entry := range repos {
+		if entry.idle != nil {
+			entry.idle.Stop()
+			entry.idle = nil
+		}
+	}
+	p.mu.Unlock()
+
+	for _, entry := range repos {
+		<-entry.ready
+		if entry.err == nil {
+			_ = entry.repo.Close()
+		}
+	}
+	return nil
+}
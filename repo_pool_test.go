@@ -0,0 +1,71 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepositoryPool(t *testing.T) {
+	pool := NewRepositoryPool(DefaultContext, 20*time.Millisecond)
+	defer pool.Close()
+	path := filepath.Join(testReposDir, "repo1_bare")
+
+	var wg sync.WaitGroup
+	repos := make([]*Repository, 5)
+	for i := range repos {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			repo, closer, err := pool.Get(DefaultContext, path)
+			if assert.NoError(t, err) {
+				repos[i] = repo
+				defer closer.Close()
+				_, err = repo.GetBranchCommitID("master")
+				assert.NoError(t, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, repo := range repos {
+		assert.Same(t, repos[0], repo)
+	}
+
+	// reused while it is in use or within the idle timeout
+	repo, closer, err := pool.Get(DefaultContext, path)
+	assert.NoError(t, err)
+	assert.Same(t, repos[0], repo)
+	time.Sleep(40 * time.Millisecond)
+	assert.NoError(t, closer.Close())
+	// releasing twice has no effect
+	assert.NoError(t, closer.Close())
+	repo, closer, err = pool.Get(DefaultContext, path)
+	assert.NoError(t, err)
+	assert.Same(t, repos[0], repo)
+	assert.NoError(t, closer.Close())
+
+	// closed once idle
+	assert.Eventually(t, func() bool {
+		pool.mu.Lock()
+		defer pool.mu.Unlock()
+		return len(pool.repos) == 0
+	}, time.Second, 10*time.Millisecond)
+	repo, closer, err = pool.Get(DefaultContext, path)
+	assert.NoError(t, err)
+	assert.NotSame(t, repos[0], repo)
+	assert.NoError(t, closer.Close())
+
+	_, _, err = pool.Get(DefaultContext, filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+
+	assert.NoError(t, pool.Close())
+	_, _, err = pool.Get(DefaultContext, path)
+	assert.ErrorIs(t, err, ErrRepositoryPoolClosed)
+}
@@ -0,0 +1,131 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/enverbisevac/gitlib/hooks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository_Push(t *testing.T) {
+	clonePath, err := cloneRepo(t, filepath.Join(testReposDir, "repo1_bare"))
+	assert.NoError(t, err)
+	repo, err := openRepositoryWithDefaultContext(clonePath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	remotePath := t.TempDir()
+	remote, err := InitRepository(DefaultContext, remotePath, InitWithBare(true), InitWithHooks(map[string]string{
+		"pre-receive": "#!/bin/sh\nwhile read old new ref; do\n  if [ \"$ref\" = refs/heads/protected ]; then echo protected branch >&2; exit 1; fi\ndone\n",
+	}))
+	assert.NoError(t, err)
+	defer remote.Close()
+
+	remoteRef := func(ref string) string {
+		stdout, _, _ := NewCommand(DefaultContext, "rev-parse", "--verify", "--quiet").AddDynamicArguments(ref).RunStdString(&RunOpts{Dir: remotePath})
+		return strings.TrimSpace(stdout)
+	}
+
+	const master = "feaf4ba6bc635fec442f46ddd4512416ec43c2c2"
+	assert.NoError(t, repo.Push(DefaultContext, master, PushOptions{
+		Remote:   remotePath,
+		Branch:   "master",
+		Refspecs: []string{"origin/branch1:refs/heads/branch1"},
+	}))
+	assert.Equal(t, master, remoteRef("refs/heads/master"))
+	branch1 := remoteRef("refs/heads/branch1")
+	assert.Len(t, branch1, 40)
+
+	// branch1 does not contain master
+	err = repo.Push(DefaultContext, "origin/branch1", PushOptions{Remote: remotePath, Branch: "master"})
+	assert.True(t, IsErrPushOutOfDate(err), "%v", err)
+
+	// a lease with the wrong value is rejected
+	err = repo.Push(DefaultContext, "origin/branch1", PushOptions{
+		Remote:         remotePath,
+		Branch:         "master",
+		ForceWithLease: map[string]string{"refs/heads/master": branch1},
+	})
+	assert.True(t, IsErrPushOutOfDate(err), "%v", err)
+	assert.Equal(t, master, remoteRef("refs/heads/master"))
+
+	// atomic pushes update no ref if one of them fails
+	err = repo.Push(DefaultContext, "origin/branch1", PushOptions{
+		Remote:         remotePath,
+		Branch:         "master",
+		Refspecs:       []string{"origin/branch2:refs/heads/branch1"},
+		ForceWithLease: map[string]string{"refs/heads/master": master, "refs/heads/branch1": master},
+		Atomic:         true,
+	})
+	assert.Error(t, err)
+	assert.Equal(t, master, remoteRef("refs/heads/master"))
+	assert.Equal(t, branch1, remoteRef("refs/heads/branch1"))
+
+	assert.NoError(t, repo.Push(DefaultContext, "origin/branch1", PushOptions{
+		Remote:         remotePath,
+		Branch:         "master",
+		ForceWithLease: map[string]string{"refs/heads/master": master, "refs/heads/new": ""},
+		Refspecs:       []string{"origin/branch2:refs/heads/new"},
+		Atomic:         true,
+	}))
+	assert.Equal(t, branch1, remoteRef("refs/heads/master"))
+	assert.Len(t, remoteRef("refs/heads/new"), 40)
+
+	// push options are passed to the hooks of the remote
+	assert.NoError(t, hooks.WriteScript(remotePath, "pre-receive", "options", []byte("#!/bin/sh\necho \"$GIT_PUSH_OPTION_COUNT $GIT_PUSH_OPTION_0 $GIT_PUSH_OPTION_1\" > \"$GIT_DIR/push-options\"\n")))
+	assert.NoError(t, repo.Push(DefaultContext, master, PushOptions{
+		Remote:      remotePath,
+		Branch:      "options",
+		PushOptions: []string{"ci.skip", "merge-on-push=true"},
+	}))
+	content, err := os.ReadFile(filepath.Join(remotePath, "push-options"))
+	assert.NoError(t, err)
+	assert.Equal(t, "2 ci.skip merge-on-push=true\n", string(content))
+
+	err = repo.Push(DefaultContext, master, PushOptions{Remote: remotePath, Branch: "protected"})
+	if assert.True(t, IsErrPushRejected(err), "%v", err) {
+		assert.Equal(t, "protected branch", err.(*ErrPushRejected).Message)
+	}
+
+	// without a remote origin is pushed to
+	_, _, err = NewCommand(DefaultContext, "remote", "set-url", "origin").AddDynamicArguments(remotePath).RunStdString(&RunOpts{Dir: clonePath})
+	assert.NoError(t, err)
+	assert.NoError(t, repo.Push(DefaultContext, master, PushOptions{Branch: "default"}))
+	assert.Equal(t, master, remoteRef("refs/heads/default"))
+}
+
+func TestRepository_PushTags(t *testing.T) {
+	clonePath, err := cloneRepo(t, filepath.Join(testReposDir, "repo1_bare"))
+	assert.NoError(t, err)
+	repo, err := openRepositoryWithDefaultContext(clonePath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	remotePath := t.TempDir()
+	remote, err := InitRepository(DefaultContext, remotePath, InitWithBare(true))
+	assert.NoError(t, err)
+	defer remote.Close()
+
+	remoteTags := func() []string {
+		stdout, _, _ := NewCommand(DefaultContext, "tag", "--list").RunStdString(&RunOpts{Dir: remotePath})
+		return strings.Fields(stdout)
+	}
+
+	const master = "feaf4ba6bc635fec442f46ddd4512416ec43c2c2"
+	assert.NoError(t, repo.CreateTag("v1.0.0", master))
+	assert.NoError(t, repo.Push(DefaultContext, master, PushOptions{Remote: remotePath, Branch: "master", Tags: []string{"v1.0.0"}}))
+	assert.Equal(t, []string{"v1.0.0"}, remoteTags())
+
+	assert.NoError(t, repo.Push(DefaultContext, master, PushOptions{Remote: remotePath, TagsMode: PushTagsAll}))
+	assert.Equal(t, []string{"test", "v1.0.0"}, remoteTags())
+
+	assert.NoError(t, repo.Push(DefaultContext, master, PushOptions{Remote: remotePath, DeleteTags: []string{"test", "v1.0.0"}}))
+	assert.Empty(t, remoteTags())
+}
@@ -0,0 +1,96 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RangeDiffStatus describes how a commit of the first range relates to a commit of the second range
+type RangeDiffStatus string
+
+const (
+	// RangeDiffEqual the commits have the same patch
+	RangeDiffEqual RangeDiffStatus = "="
+	// RangeDiffModified the patch of the commit was changed
+	RangeDiffModified RangeDiffStatus = "!"
+	// RangeDiffRemoved the commit exists only in the first range
+	RangeDiffRemoved RangeDiffStatus = "<"
+	// RangeDiffAdded the commit exists only in the second range
+	RangeDiffAdded RangeDiffStatus = ">"
+)
+
+// RangeDiffPair is a line of git range-diff, positions are 1-based and 0 if the commit does not exist in a range
+type RangeDiffPair struct {
+	Status   RangeDiffStatus
+	OldIndex int
+	OldID    string
+	NewIndex int
+	NewID    string
+	Subject  string
+	// Diff is the difference between the two patches of a modified pair
+	Diff string
+}
+
+// e.g. "1:  a177315 ! 1:  3035bd7 add b" or "-:  ------- > 3:  1d8c12d add d"
+var rangeDiffPairPattern = regexp.MustCompile(`^(-|\d+):\s+(-+|[0-9a-f]+) ([=!<>]) (-|\d+):\s+(-+|[0-9a-f]+) (.*)$`)
+
+// RangeDiff compares two commit ranges, e.g. the old and the new version of a force pushed branch as "base..old" and "base..new".
+func (repo *Repository) RangeDiff(range1, range2 string) ([]*RangeDiffPair, error) {
+	stdout, stderr, err := NewCommand(repo.Ctx, "-c").AddDynamicArguments("core.abbrev="+strconv.Itoa(repo.ObjectFormat().FullLength())).
+		AddArguments("range-diff", "--no-color").AddDynamicArguments(range1, range2).
+		RunStdString(&RunOpts{Dir: repo.Path})
+	if err != nil {
+		return nil, fmt.Errorf("unable to compare ranges %s and %s: %w", range1, range2, ConcatenateError(err, stderr))
+	}
+	return parseRangeDiff(stdout)
+}
+
+func parseRangeDiff(output string) ([]*RangeDiffPair, error) {
+	var pairs []*RangeDiffPair
+	var diff strings.Builder
+	flushDiff := func() {
+		if len(pairs) > 0 {
+			pairs[len(pairs)-1].Diff = diff.String()
+		}
+		diff.Reset()
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "    ") && len(pairs) > 0 {
+			diff.WriteString(line[4:])
+			diff.WriteByte('\n')
+			continue
+		}
+		if line == "" && len(pairs) > 0 {
+			diff.WriteByte('\n')
+			continue
+		}
+
+		match := rangeDiffPairPattern.FindStringSubmatch(line)
+		if match == nil {
+			return nil, fmt.Errorf("unexpected range-diff line: %q", line)
+		}
+		flushDiff()
+		pair := &RangeDiffPair{Status: RangeDiffStatus(match[3]), Subject: match[6]}
+		if match[1] != "-" {
+			pair.OldIndex, _ = strconv.Atoi(match[1])
+			pair.OldID = match[2]
+		}
+		if match[4] != "-" {
+			pair.NewIndex, _ = strconv.Atoi(match[4])
+			pair.NewID = match[5]
+		}
+		pairs = append(pairs, pair)
+	}
+	flushDiff()
+	return pairs, scanner.Err()
+}
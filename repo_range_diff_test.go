@@ -0,0 +1,84 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRangeDiff(t *testing.T) {
+	pairs, err := parseRangeDiff(`1:  a177315 ! 1:  3035bd7 add b
+    @@ Commit message
+      ## b (new) ##
+     @@
+     +
+    ++x
+2:  b96b29a = 2:  f60c705 add c
+3:  c96b29a < -:  ------- add e
+-:  ------- > 3:  1d8c12d add d
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, []*RangeDiffPair{
+		{Status: RangeDiffModified, OldIndex: 1, OldID: "a177315", NewIndex: 1, NewID: "3035bd7", Subject: "add b", Diff: "@@ Commit message\n  ## b (new) ##\n @@\n +\n++x\n"},
+		{Status: RangeDiffEqual, OldIndex: 2, OldID: "b96b29a", NewIndex: 2, NewID: "f60c705", Subject: "add c"},
+		{Status: RangeDiffRemoved, OldIndex: 3, OldID: "c96b29a", Subject: "add e"},
+		{Status: RangeDiffAdded, NewIndex: 3, NewID: "1d8c12d", Subject: "add d"},
+	}, pairs)
+
+	_, err = parseRangeDiff("garbage\n")
+	assert.Error(t, err)
+}
+
+func TestRepository_RangeDiff(t *testing.T) {
+	repoPath := t.TempDir()
+	repo, err := InitRepository(DefaultContext, repoPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	run := func(args ...CmdArg) string {
+		stdout, stderr, err := NewCommand(DefaultContext, "-c", "user.name=test", "-c", "user.email=test@example.com").AddArguments(args...).
+			RunStdString(&RunOpts{Dir: repoPath})
+		assert.NoError(t, err, stderr)
+		return strings.TrimSpace(stdout)
+	}
+	commit := func(name, content string) {
+		assert.NoError(t, os.WriteFile(filepath.Join(repoPath, name), []byte(content), 0o644))
+		run("add", "--all")
+		run("commit", "-m", CmdArg("change "+name))
+	}
+
+	long := strings.Repeat("line\n", 20)
+	commit("a", "a\n")
+	run("branch", "base")
+	commit("b", long)
+	commit("c", "c\n")
+	run("branch", "v1")
+	run("reset", "--hard", "base")
+	commit("b", long+"more\n")
+	commit("c", "c\n")
+	commit("d", "d\n")
+
+	pairs, err := repo.RangeDiff("base..v1", "base..HEAD")
+	assert.NoError(t, err)
+	if assert.Len(t, pairs, 3) {
+		assert.Equal(t, RangeDiffModified, pairs[0].Status)
+		assert.Equal(t, run("rev-parse", "v1~1"), pairs[0].OldID)
+		assert.Equal(t, run("rev-parse", "HEAD~2"), pairs[0].NewID)
+		assert.Contains(t, pairs[0].Diff, "++more")
+		assert.Equal(t, RangeDiffEqual, pairs[1].Status)
+		assert.Equal(t, "change c", pairs[1].Subject)
+		assert.Equal(t, RangeDiffAdded, pairs[2].Status)
+		assert.Equal(t, 3, pairs[2].NewIndex)
+		assert.Empty(t, pairs[2].OldID)
+	}
+
+	_, err = repo.RangeDiff("base..v1", "base..unknown")
+	assert.Error(t, err)
+}
@@ -0,0 +1,90 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// RebaseOptions options for Rebase
+type RebaseOptions struct {
+	// Committer of the rebased commits, the committer identity of every commit is kept if nil
+	Committer *Signature
+	// KeepEmpty keeps commits whose changes already exist in onto, they are dropped by default
+	KeepEmpty bool
+}
+
+// RebasedCommit maps a commit of the branch to its rebased version
+type RebasedCommit struct {
+	OldID ObjectID
+	// NewID is empty if the commit was dropped because its changes already exist in onto
+	NewID ObjectID
+}
+
+// RebaseResult represents the result of Rebase
+type RebaseResult struct {
+	HeadID  ObjectID
+	Commits []*RebasedCommit
+}
+
+// Rebase replays the commits of branch which are not in onto on top of onto without a worktree, like a
+// non-interactive `git rebase`: merge commits and commits already applied upstream are skipped.
+// If branch is a full ref name like "refs/heads/feature" it is updated to the new head, as long as it was
+// not changed in the meantime. A branch which already contains onto is left unchanged. The first commit which does not apply cleanly returns ErrCherryPickConflict.
+func (repo *Repository) Rebase(branch, onto string, opts RebaseOptions) (*RebaseResult, error) {
+	head, err := repo.resolveCommitID(branch)
+	if err != nil {
+		return nil, err
+	}
+	ontoID, err := repo.resolveCommitID(onto)
+	if err != nil {
+		return nil, err
+	}
+
+	// nothing to do if the branch is already based on onto
+	if _, _, err := NewCommand(repo.Ctx, "merge-base", "--is-ancestor").AddDynamicArguments(ontoID, head).RunStdString(&RunOpts{Dir: repo.Path}); err == nil {
+		headID, err := repo.ObjectFormat().NewIDFromString(head)
+		if err != nil {
+			return nil, err
+		}
+		return &RebaseResult{HeadID: headID}, nil
+	}
+
+	stdout, stderr, runErr := NewCommand(repo.Ctx, "rev-list", "--reverse", "--topo-order", "--no-merges", "--right-only", "--cherry-pick").
+		AddDynamicArguments(ontoID + "..." + head).RunStdString(&RunOpts{Dir: repo.Path})
+	if runErr != nil {
+		return nil, fmt.Errorf("unable to list commits of %s not in %s: %w", branch, onto, ConcatenateError(runErr, stderr))
+	}
+
+	result := &RebaseResult{}
+	current := ontoID
+	for _, id := range strings.Fields(stdout) {
+		commit, err := repo.GetCommit(id)
+		if err != nil {
+			return nil, err
+		}
+		newID, err := repo.cherryPick(commit, current, opts.Committer, CherryPickOptions{AllowEmpty: opts.KeepEmpty})
+		if errors.Is(err, ErrEmptyCherryPick) {
+			result.Commits = append(result.Commits, &RebasedCommit{OldID: commit.ID})
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		result.Commits = append(result.Commits, &RebasedCommit{OldID: commit.ID, NewID: newID})
+		current = newID.String()
+	}
+
+	if result.HeadID, err = repo.ObjectFormat().NewIDFromString(current); err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(branch, "refs/") && current != head {
+		if err := repo.updateRef(branch, current, head, "rebase onto "+onto); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
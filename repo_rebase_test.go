@@ -0,0 +1,80 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository_Rebase(t *testing.T) {
+	repoPath := t.TempDir()
+	repo, err := InitRepository(DefaultContext, repoPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+	run := func(args ...CmdArg) string {
+		stdout, stderr, err := NewCommand(DefaultContext, "-c", "user.name=Test", "-c", "user.email=test@example.com").AddArguments(args...).
+			RunStdString(&RunOpts{Dir: repoPath})
+		assert.NoError(t, err, stderr)
+		return strings.TrimSpace(stdout)
+	}
+	commit := func(name, content string) string {
+		assert.NoError(t, os.WriteFile(filepath.Join(repoPath, name), []byte(content), 0o644))
+		run("add", "--all")
+		run("commit", "-m", CmdArg("change "+name))
+		return run("rev-parse", "HEAD")
+	}
+
+	base := commit("a", "a\n")
+	commit("b", "b\n")
+	commit("shared", "shared\n")
+	main := commit("c", "main\n")
+	run("checkout", "-b", "feature", CmdArg(base))
+	feature1 := commit("d", "d\n")
+	commit("shared", "shared\n")
+	feature3 := commit("e", "e\n")
+
+	committer := &Signature{Name: "Rebaser", Email: "rebaser@example.com"}
+	result, err := repo.Rebase("refs/heads/feature", "main", RebaseOptions{Committer: committer})
+	assert.NoError(t, err)
+	// the change of "shared" is already in main
+	if assert.Len(t, result.Commits, 2) {
+		assert.Equal(t, feature1, result.Commits[0].OldID.String())
+		assert.Equal(t, feature3, result.Commits[1].OldID.String())
+		assert.Equal(t, result.HeadID, result.Commits[1].NewID)
+	}
+	assert.Equal(t, result.HeadID.String(), run("rev-parse", "refs/heads/feature"))
+	assert.Equal(t, main, run("rev-parse", "feature~2"))
+
+	rebased, err := repo.GetCommit(result.HeadID.String())
+	assert.NoError(t, err)
+	assert.Equal(t, "change e", rebased.Summary())
+	assert.Equal(t, "Test", rebased.Author.Name)
+	assert.Equal(t, "Rebaser", rebased.Committer.Name)
+
+	// rebasing again is a no-op
+	again, err := repo.Rebase("refs/heads/feature", "main", RebaseOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, result.HeadID, again.HeadID)
+	assert.Empty(t, again.Commits)
+
+	// conflicting changes stop the rebase without touching the branch
+	run("checkout", "-b", "conflict", CmdArg(base))
+	commit("c", "conflict\n")
+	head := run("rev-parse", "HEAD")
+	_, err = repo.Rebase("refs/heads/conflict", "main", RebaseOptions{})
+	if assert.True(t, IsErrCherryPickConflict(err), "%v", err) {
+		assert.Equal(t, head, err.(*ErrCherryPickConflict).CommitID)
+		assert.Equal(t, "c", err.(*ErrCherryPickConflict).Conflicts[0].Path)
+	}
+	assert.Equal(t, head, run("rev-parse", "refs/heads/conflict"))
+
+	_, err = repo.Rebase("refs/heads/feature", "unknown", RebaseOptions{})
+	assert.True(t, IsErrNotExist(err))
+}
@@ -5,10 +5,16 @@
 package git
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
 	"strings"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/storer"
 )
 
 // GetRefs returns all references of the repository.
@@ -18,6 +24,26 @@ func (repo *Repository) GetRefs() ([]*Reference, error) {
 
 // GetRefsFiltered returns all references of the repository that matches patterm exactly or starting with.
 func (repo *Repository) GetRefsFiltered(pattern string) ([]*Reference, error) {
+	if repo.backendFor(OperationReferences, BackendGoGit, BackendCLI) == BackendCLI {
+		refs := make([]*Reference, 0)
+		err := repo.walkRefsWithGit(func(id, typ, name string) error {
+			if strings.HasPrefix(name, RemotePrefix) || !strings.HasPrefix(name, pattern) {
+				return nil
+			}
+			objectID, err := repo.ObjectFormat().NewIDFromString(id)
+			if err != nil {
+				return err
+			}
+			// tags can be of type `commit` (lightweight) or `tag` (annotated)
+			if !strings.HasPrefix(name, TagPrefix) {
+				typ = string(ObjectCommit)
+			}
+			refs = append(refs, &Reference{Name: name, Object: objectID, Type: typ, repo: repo})
+			return nil
+		})
+		return refs, err
+	}
+
 	r, err := git.PlainOpen(repo.Path)
 	if err != nil {
 		return nil, err
@@ -53,3 +79,211 @@ func (repo *Repository) GetRefsFiltered(pattern string) ([]*Reference, error) {
 
 	return refs, nil
 }
+
+// walkRefsWithGit calls fn with the id, the object type and the full name of the references in the directories,
+// or of all references, sorted by name like gogit iterates them. fn can return storer.ErrStop to end the walk.
+func (repo *Repository) walkRefsWithGit(fn func(id, typ, name string) error, dirs ...string) error {
+	stdoutReader, err := NewCommand(repo.Ctx, "for-each-ref", "--format=%(objectname) %(objecttype) %(refname)").
+		AddDynamicArguments(dirs...).RunWithStdoutReader(&RunOpts{Dir: repo.Path})
+	if err != nil {
+		return err
+	}
+	defer stdoutReader.Close()
+
+	scanner := bufio.NewScanner(stdoutReader)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), " ", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if err := fn(fields[0], fields[1], fields[2]); err != nil {
+			if err == storer.ErrStop {
+				return nil
+			}
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("unable to list refs: %w", err)
+	}
+	return nil
+}
+
+// showRef returns the id of the reference name like gogit resolves it, name must be the full name or e.g. HEAD.
+// It returns ErrNotExist if the reference does not exist.
+func (repo *Repository) showRef(name string) (string, error) {
+	if !strings.HasPrefix(name, "refs/") {
+		stdout, stderr, err := NewCommand(repo.Ctx, "rev-parse", "--verify", "--quiet", "--end-of-options").AddDynamicArguments(name).RunStdString(&RunOpts{Dir: repo.Path})
+		if err != nil {
+			if err.IsExitCode(1) {
+				return "", ErrNotExist{ID: name}
+			}
+			return "", fmt.Errorf("unable to read ref %s: %w", name, ConcatenateError(err, stderr))
+		}
+		return strings.TrimSpace(stdout), nil
+	}
+
+	// the pattern also matches the refs below name, which can only exist if name doesn't
+	id := ""
+	if err := repo.walkRefsWithGit(func(refID, _, refName string) error {
+		if refName == name {
+			id = refID
+			return storer.ErrStop
+		}
+		return nil
+	}, name); err != nil {
+		return "", err
+	}
+	if id == "" {
+		return "", ErrNotExist{ID: name}
+	}
+	return id, nil
+}
+
+// GetSymbolicRef returns the name of the ref the symbolic ref name points to, e.g. "refs/heads/main" for HEAD.
+// It returns ErrNotExist if name does not exist or is not a symbolic ref.
+func (repo *Repository) GetSymbolicRef(name string) (string, error) {
+	stdout, stderr, err := NewCommand(repo.Ctx, "symbolic-ref", "--quiet").AddDynamicArguments(name).RunStdString(&RunOpts{Dir: repo.Path})
+	if err != nil {
+		if err.IsExitCode(1) {
+			return "", ErrNotExist{ID: name}
+		}
+		return "", fmt.Errorf("unable to read symbolic ref %s: %w", name, ConcatenateError(err, stderr))
+	}
+	return strings.TrimSpace(stdout), nil
+}
+
+// SetSymbolicRef creates or changes the symbolic ref name to point to target, which must start with "refs/".
+// The target does not need to exist yet.
+func (repo *Repository) SetSymbolicRef(name, target string) error {
+	if !strings.HasPrefix(target, "refs/") {
+		return fmt.Errorf("invalid target of symbolic ref %s: %s", name, target)
+	}
+	if skipDryRun(repo.Ctx, "set symbolic ref %s to %s [repo_path: %s]", name, target, repo.Path) {
+		return nil
+	}
+	_, stderr, err := NewCommand(repo.Ctx, "symbolic-ref").AddDynamicArguments(name, target).RunStdString(&RunOpts{Dir: repo.Path, Retry: lockRetry()})
+	if err != nil {
+		return fmt.Errorf("unable to set symbolic ref %s: %w", name, ConcatenateError(err, stderr))
+	}
+	return nil
+}
+
+// ListRefsOptions options for listing reference names with ListRefNames
+type ListRefsOptions struct {
+	// Prefix only lists refs starting with it, e.g. "refs/heads/"
+	Prefix string
+	// Sort is a for-each-ref sort key like "refname" or "-committerdate", refname is used if empty
+	Sort string
+	// Skip and Limit paginate the sorted refs, a zero Limit returns all remaining refs
+	Skip  int
+	Limit int
+}
+
+// ListRefNames returns the full names of the references matching opts and the total count of matching refs.
+// The refs are streamed from git for-each-ref, which reads packed-refs and loose refs directly,
+// so only the requested page is kept in memory.
+func (repo *Repository) ListRefNames(opts ListRefsOptions) ([]string, int, error) {
+	sortKey := opts.Sort
+	if sortKey == "" {
+		sortKey = "refname"
+	}
+	cmd := NewCommand(repo.Ctx, "for-each-ref", "--format=%(refname)").AddOptionFormat("--sort=%s", sortKey)
+	// for-each-ref patterns match whole path components, so only the directory of the prefix is passed
+	if dir := opts.Prefix[:strings.LastIndex(opts.Prefix, "/")+1]; dir != "" {
+		cmd.AddDynamicArguments(dir)
+	}
+
+	stdoutReader, err := cmd.RunWithStdoutReader(&RunOpts{Dir: repo.Path})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer stdoutReader.Close()
+
+	var names []string
+	count := 0
+	scanner := bufio.NewScanner(stdoutReader)
+	for scanner.Scan() {
+		name := scanner.Text()
+		if name == "" || !strings.HasPrefix(name, opts.Prefix) {
+			continue
+		}
+		count++
+		if count > opts.Skip && (opts.Limit == 0 || count <= opts.Skip+opts.Limit) {
+			names = append(names, name)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, fmt.Errorf("unable to list refs: %w", err)
+	}
+	return names, count, nil
+}
+
+// RefAction is the command of a RefUpdate as understood by git update-ref --stdin
+type RefAction string
+
+// RefAction possible values
+const (
+	// RefActionUpdate sets the ref to NewValue, if OldValue is set the ref must have this value
+	RefActionUpdate RefAction = "update"
+	// RefActionCreate creates the ref with NewValue, the ref must not exist
+	RefActionCreate RefAction = "create"
+	// RefActionDelete deletes the ref, if OldValue is set the ref must have this value
+	RefActionDelete RefAction = "delete"
+	// RefActionVerify checks that the ref has OldValue, an empty OldValue checks that it does not exist
+	RefActionVerify RefAction = "verify"
+)
+
+// RefUpdate is a single change of a reference transaction
+type RefUpdate struct {
+	Action   RefAction
+	Name     string
+	NewValue string
+	// OldValue is compared with the current value of the ref, EmptySHA requires the ref to not exist
+	OldValue string
+}
+
+var refLockErrorPattern = regexp.MustCompile(`cannot lock ref '([^']+)'`)
+
+// UpdateRefs applies all updates in a single transaction, either all of them succeed or none.
+// A ref not having the expected old value returns ErrRefUpdateConflict, a ref locked by another process
+// returns an error matching ErrLockedRef, which may succeed if retried.
+func (repo *Repository) UpdateRefs(updates []RefUpdate) error {
+	if len(updates) == 0 {
+		return nil
+	}
+
+	stdin := new(bytes.Buffer)
+	for _, update := range updates {
+		if strings.ContainsRune(update.Name+update.NewValue+update.OldValue, 0) {
+			return fmt.Errorf("invalid update of ref %q", update.Name)
+		}
+		switch update.Action {
+		case RefActionUpdate:
+			fmt.Fprintf(stdin, "update %s\x00%s\x00%s\x00", update.Name, update.NewValue, update.OldValue)
+		case RefActionCreate:
+			fmt.Fprintf(stdin, "create %s\x00%s\x00", update.Name, update.NewValue)
+		case RefActionDelete:
+			fmt.Fprintf(stdin, "delete %s\x00%s\x00", update.Name, update.OldValue)
+		case RefActionVerify:
+			fmt.Fprintf(stdin, "verify %s\x00%s\x00", update.Name, update.OldValue)
+		default:
+			return fmt.Errorf("unknown action %q for ref %s", update.Action, update.Name)
+		}
+	}
+	if skipDryRun(repo.Ctx, "update refs %+v [repo_path: %s]", updates, repo.Path) {
+		return nil
+	}
+
+	_, stderr, err := NewCommand(repo.Ctx, "update-ref", "--stdin", "-z").RunStdString(&RunOpts{Dir: repo.Path, Stdin: stdin, Retry: lockRetry()})
+	if err != nil {
+		if errors.Is(err, ErrLockedRef) {
+			return fmt.Errorf("unable to update refs: %w", ConcatenateError(err, stderr))
+		}
+		if matches := refLockErrorPattern.FindStringSubmatch(stderr); matches != nil {
+			return &ErrRefUpdateConflict{Ref: matches[1], StdErr: stderr}
+		}
+		return fmt.Errorf("unable to update refs: %w", ConcatenateError(err, stderr))
+	}
+	return nil
+}
@@ -5,7 +5,9 @@
 package git
 
 import (
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -50,3 +52,120 @@ func TestRepository_GetRefsFiltered(t *testing.T) {
 		assert.Equal(t, "3ad28a9149a2864384548f3d17ed7f38014c9e8a", refs[0].Object.String())
 	}
 }
+
+func TestRepository_UpdateRefs(t *testing.T) {
+	repoPath := filepath.Join(t.TempDir(), "repo.git")
+	assert.NoError(t, Clone(DefaultContext, filepath.Join(testReposDir, "repo1_bare"), repoPath, CloneRepoOptions{Bare: true}))
+	repo, err := openRepositoryWithDefaultContext(repoPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	const (
+		master  = "feaf4ba6bc635fec442f46ddd4512416ec43c2c2"
+		branch1 = "2839944139e0de9737a044f78b0e4b40d989a9e3"
+	)
+	refValue := func(ref string) string {
+		stdout, _, _ := NewCommand(DefaultContext, "rev-parse", "--verify", "--quiet").AddDynamicArguments(ref).RunStdString(&RunOpts{Dir: repoPath})
+		return strings.TrimSpace(stdout)
+	}
+
+	assert.NoError(t, repo.UpdateRefs([]RefUpdate{
+		{Action: RefActionCreate, Name: "refs/heads/new", NewValue: master},
+		{Action: RefActionUpdate, Name: "refs/heads/master", NewValue: branch1, OldValue: master},
+		{Action: RefActionDelete, Name: "refs/heads/branch2"},
+		{Action: RefActionVerify, Name: "refs/heads/branch1", OldValue: branch1},
+		{Action: RefActionVerify, Name: "refs/heads/missing"},
+	}))
+	assert.Equal(t, master, refValue("refs/heads/new"))
+	assert.Equal(t, branch1, refValue("refs/heads/master"))
+	assert.Empty(t, refValue("refs/heads/branch2"))
+
+	// the stale old value of master fails the whole transaction
+	err = repo.UpdateRefs([]RefUpdate{
+		{Action: RefActionDelete, Name: "refs/heads/new", OldValue: master},
+		{Action: RefActionUpdate, Name: "refs/heads/master", NewValue: master, OldValue: master},
+	})
+	if assert.True(t, IsErrRefUpdateConflict(err), "%v", err) {
+		assert.Equal(t, "refs/heads/master", err.(*ErrRefUpdateConflict).Ref)
+	}
+	assert.Equal(t, master, refValue("refs/heads/new"))
+	assert.Equal(t, branch1, refValue("refs/heads/master"))
+
+	err = repo.UpdateRefs([]RefUpdate{{Action: RefActionCreate, Name: "refs/heads/new", NewValue: branch1}})
+	assert.True(t, IsErrRefUpdateConflict(err), "%v", err)
+
+	// a ref locked by another process is not a conflict, the update may be retried
+	lockPath := filepath.Join(repoPath, "refs", "heads", "new.lock")
+	assert.NoError(t, os.WriteFile(lockPath, nil, 0o644))
+	err = repo.UpdateRefs([]RefUpdate{{Action: RefActionUpdate, Name: "refs/heads/new", NewValue: branch1, OldValue: master}})
+	assert.ErrorIs(t, err, ErrLockedRef)
+	assert.False(t, IsErrRefUpdateConflict(err), "%v", err)
+	assert.NoError(t, os.Remove(lockPath))
+	assert.NoError(t, repo.UpdateRefs([]RefUpdate{{Action: RefActionUpdate, Name: "refs/heads/new", NewValue: branch1, OldValue: master}}))
+	assert.Equal(t, branch1, refValue("refs/heads/new"))
+
+	assert.Error(t, repo.UpdateRefs([]RefUpdate{{Action: "move", Name: "refs/heads/new"}}))
+	assert.Error(t, repo.UpdateRefs([]RefUpdate{{Action: RefActionDelete, Name: "refs/heads/new\x00delete refs/heads/master"}}))
+	assert.NoError(t, repo.UpdateRefs(nil))
+}
+
+func TestRepository_ListRefNames(t *testing.T) {
+	repo, err := openRepositoryWithDefaultContext(filepath.Join(testReposDir, "repo1_bare"))
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	refs, count, err := repo.ListRefNames(ListRefsOptions{Prefix: BranchPrefix})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+	assert.Equal(t, []string{"refs/heads/branch1", "refs/heads/branch2", "refs/heads/master"}, refs)
+
+	refs, count, err = repo.ListRefNames(ListRefsOptions{Prefix: BranchPrefix, Sort: "-refname", Skip: 1, Limit: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+	assert.Equal(t, []string{"refs/heads/branch2"}, refs)
+
+	// prefixes do not need to end at a path component
+	refs, count, err = repo.ListRefNames(ListRefsOptions{Prefix: "refs/heads/bra"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, []string{"refs/heads/branch1", "refs/heads/branch2"}, refs)
+
+	_, count, err = repo.ListRefNames(ListRefsOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 5, count)
+
+	_, _, err = repo.ListRefNames(ListRefsOptions{Sort: "unknown"})
+	assert.Error(t, err)
+}
+
+func TestRepository_SymbolicRef(t *testing.T) {
+	repoPath := filepath.Join(t.TempDir(), "repo.git")
+	assert.NoError(t, Clone(DefaultContext, filepath.Join(testReposDir, "repo1_bare"), repoPath, CloneRepoOptions{Bare: true}))
+	repo, err := openRepositoryWithDefaultContext(repoPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	target, err := repo.GetSymbolicRef("HEAD")
+	assert.NoError(t, err)
+	assert.Equal(t, "refs/heads/master", target)
+
+	assert.NoError(t, repo.SetSymbolicRef("refs/meta/config", "refs/heads/branch1"))
+	target, err = repo.GetSymbolicRef("refs/meta/config")
+	assert.NoError(t, err)
+	assert.Equal(t, "refs/heads/branch1", target)
+	id, err := repo.GetRefCommitID("refs/meta/config")
+	assert.NoError(t, err)
+	assert.Equal(t, "2839944139e0de9737a044f78b0e4b40d989a9e3", id)
+
+	// dangling targets are allowed, e.g. for an unborn default branch
+	assert.NoError(t, repo.SetSymbolicRef("HEAD", "refs/heads/unborn"))
+	target, err = repo.GetSymbolicRef("HEAD")
+	assert.NoError(t, err)
+	assert.Equal(t, "refs/heads/unborn", target)
+
+	_, err = repo.GetSymbolicRef("refs/heads/master")
+	assert.True(t, IsErrNotExist(err))
+	_, err = repo.GetSymbolicRef("refs/meta/missing")
+	assert.True(t, IsErrNotExist(err))
+	assert.Error(t, repo.SetSymbolicRef("refs/meta/config", "master"))
+}
@@ -0,0 +1,29 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+// IsShallow returns true if the repository is a shallow clone with an incomplete history
+func (repo *Repository) IsShallow() (bool, error) {
+	stdout, stderr, err := NewCommand(repo.Ctx, "rev-parse", "--is-shallow-repository").RunStdString(&RunOpts{Dir: repo.Path})
+	if err != nil {
+		return false, fmt.Errorf("unable to check if the repository is shallow: %w", ConcatenateError(err, stderr))
+	}
+	return strings.TrimSpace(stdout) == "true", nil
+}
+
+// Deepen fetches depth more commits of the history of the shallow repository from its origin remote
+func (repo *Repository) Deepen(depth int) error {
+	return Fetch(repo.Ctx, repo.Path, FetchOptions{Deepen: depth})
+}
+
+// Unshallow fetches the complete history of the shallow repository from its origin remote
+func (repo *Repository) Unshallow() error {
+	return Fetch(repo.Ctx, repo.Path, FetchOptions{Unshallow: true})
+}
@@ -0,0 +1,65 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository_Shallow(t *testing.T) {
+	bareRepo1Path, err := filepath.Abs(filepath.Join(testReposDir, "repo1_bare"))
+	assert.NoError(t, err)
+	// local clones ignore the depth, the file protocol is required for a shallow clone
+	remote := "file://" + filepath.ToSlash(bareRepo1Path)
+
+	countCommits := func(repo *Repository) int64 {
+		count, err := CommitsCountFiles(DefaultContext, repo.Path, []string{"master"}, nil)
+		assert.NoError(t, err)
+		return count
+	}
+
+	clonePath := filepath.Join(t.TempDir(), "repo.git")
+	assert.NoError(t, Clone(DefaultContext, remote, clonePath, CloneRepoOptions{Bare: true, Depth: 1, Branch: "master"}))
+	repo, err := openRepositoryWithDefaultContext(clonePath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	shallow, err := repo.IsShallow()
+	assert.NoError(t, err)
+	assert.True(t, shallow)
+	assert.EqualValues(t, 1, countCommits(repo))
+
+	assert.NoError(t, repo.Deepen(2))
+	assert.EqualValues(t, 3, countCommits(repo))
+
+	assert.NoError(t, repo.Unshallow())
+	shallow, err = repo.IsShallow()
+	assert.NoError(t, err)
+	assert.False(t, shallow)
+	assert.EqualValues(t, 6, countCommits(repo))
+
+	// 37991de and feaf4ba are the only commits of master committed after 2018-04-19
+	clonePath = filepath.Join(t.TempDir(), "since.git")
+	assert.NoError(t, Clone(DefaultContext, remote, clonePath, CloneRepoOptions{
+		Bare:         true,
+		Branch:       "master",
+		ShallowSince: time.Date(2018, 4, 19, 0, 0, 0, 0, time.UTC),
+	}))
+	since, err := openRepositoryWithDefaultContext(clonePath)
+	assert.NoError(t, err)
+	defer since.Close()
+	assert.EqualValues(t, 2, countCommits(since))
+
+	clonePath = filepath.Join(t.TempDir(), "exclude.git")
+	assert.NoError(t, Clone(DefaultContext, remote, clonePath, CloneRepoOptions{Bare: true, Branch: "master", ShallowExclude: []string{"branch2"}}))
+	exclude, err := openRepositoryWithDefaultContext(clonePath)
+	assert.NoError(t, err)
+	defer exclude.Close()
+	assert.EqualValues(t, 4, countCommits(exclude))
+}
@@ -0,0 +1,57 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SparseCheckoutInit enables sparse checkout in the working tree, which then only contains the files in the root directory.
+// In cone mode the patterns are directories, otherwise they are gitignore like patterns.
+func (repo *Repository) SparseCheckoutInit(cone bool) error {
+	if skipDryRun(repo.Ctx, "init sparse checkout (cone: %t) [repo_path: %s]", cone, repo.Path) {
+		return nil
+	}
+	cmd := NewCommand(repo.Ctx, "sparse-checkout", "init")
+	if cone {
+		cmd.AddArguments("--cone")
+	} else {
+		cmd.AddArguments("--no-cone")
+	}
+	if _, stderr, err := cmd.RunStdString(&RunOpts{Dir: repo.Path}); err != nil {
+		return fmt.Errorf("unable to init sparse checkout: %w", ConcatenateError(err, stderr))
+	}
+	return nil
+}
+
+// SparseCheckoutSet replaces the patterns of the sparse checkout and updates the working tree to contain only the matching files.
+// Sparse checkout is enabled if it isn't yet, in cone mode unless SparseCheckoutInit was called with cone disabled.
+func (repo *Repository) SparseCheckoutSet(paths []string) error {
+	if skipDryRun(repo.Ctx, "set sparse checkout paths %v [repo_path: %s]", paths, repo.Path) {
+		return nil
+	}
+	// patterns are passed on stdin, so they can't be mistaken for options
+	stdin := strings.NewReader(strings.Join(paths, "\n"))
+	if _, stderr, err := NewCommand(repo.Ctx, "sparse-checkout", "set", "--stdin").RunStdString(&RunOpts{Dir: repo.Path, Stdin: stdin}); err != nil {
+		return fmt.Errorf("unable to set sparse checkout paths: %w", ConcatenateError(err, stderr))
+	}
+	return nil
+}
+
+// SparseCheckoutList returns the patterns of the sparse checkout, in cone mode these are the checked out directories
+func (repo *Repository) SparseCheckoutList() ([]string, error) {
+	stdout, stderr, err := NewCommand(repo.Ctx, "sparse-checkout", "list").RunStdString(&RunOpts{Dir: repo.Path})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list sparse checkout paths: %w", ConcatenateError(err, stderr))
+	}
+	paths := []string{}
+	for _, line := range strings.Split(stdout, "\n") {
+		if line != "" {
+			paths = append(paths, line)
+		}
+	}
+	return paths, nil
+}
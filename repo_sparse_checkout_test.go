@@ -0,0 +1,49 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository_SparseCheckout(t *testing.T) {
+	clonePath := filepath.Join(t.TempDir(), "repo")
+	assert.NoError(t, Clone(DefaultContext, filepath.Join(testReposDir, "repo1_bare"), clonePath, CloneRepoOptions{Sparse: true}))
+	repo, err := openRepositoryWithDefaultContext(clonePath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	exists := func(name string) bool {
+		_, err := os.Lstat(filepath.Join(clonePath, name))
+		return err == nil
+	}
+	assert.True(t, exists("file1.txt"))
+	assert.False(t, exists("foo"))
+	paths, err := repo.SparseCheckoutList()
+	assert.NoError(t, err)
+	assert.Empty(t, paths)
+
+	assert.NoError(t, repo.SparseCheckoutSet([]string{"foo/bar"}))
+	assert.True(t, exists("foo/bar/link_to_hello"))
+	// cone mode includes the files of the parent directories
+	assert.True(t, exists("foo/link_short"))
+	assert.False(t, exists("foo/nar/hello"))
+	paths, err = repo.SparseCheckoutList()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo/bar"}, paths)
+
+	assert.NoError(t, repo.SparseCheckoutInit(false))
+	assert.NoError(t, repo.SparseCheckoutSet([]string{"/foo/link_short"}))
+	assert.True(t, exists("foo/link_short"))
+	assert.False(t, exists("foo/bar/link_to_hello"))
+	assert.False(t, exists("file1.txt"))
+	paths, err = repo.SparseCheckoutList()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/foo/link_short"}, paths)
+}
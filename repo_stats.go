@@ -146,3 +146,248 @@ func (repo *Repository) GetCodeActivityStats(fromTime time.Time, branch string)
 
 	return stats, nil
 }
+
+// ActivityBucket is the period commits are counted in by GetCommitActivity
+type ActivityBucket int
+
+// ActivityBucket possible values
+const (
+	ActivityBucketDay ActivityBucket = iota
+	// ActivityBucketWeek counts commits per week, weeks start on Sunday
+	ActivityBucketWeek
+)
+
+// start returns the start of the bucket containing when in loc
+func (b ActivityBucket) start(when time.Time, loc *time.Location) time.Time {
+	when = when.In(loc)
+	start := time.Date(when.Year(), when.Month(), when.Day(), 0, 0, 0, 0, loc)
+	if b == ActivityBucketWeek {
+		start = start.AddDate(0, 0, -int(start.Weekday()))
+	}
+	return start
+}
+
+// CommitActivityOptions options for GetCommitActivity
+type CommitActivityOptions struct {
+	// Revisions to count the commits of, HEAD is used if empty
+	Revisions []string
+	Since     time.Time
+	Until     time.Time
+	NoMerges  bool
+	Bucket    ActivityBucket
+	// Location the days start in, UTC is used if nil
+	Location *time.Location
+	// PerAuthor counts the commits of every author email in each bucket
+	PerAuthor bool
+}
+
+// CommitActivity is the number of commits authored in a day or week
+type CommitActivity struct {
+	Start   time.Time
+	Commits int64
+	// Authors maps the lower case author emails to their commits in the bucket, it is only set with PerAuthor
+	Authors map[string]int64
+}
+
+// GetCommitActivity counts the commits by author date in day or week buckets, which are returned in
+// chronological order. Buckets without commits are omitted. The commits are not loaded, only their
+// timestamps are read from a single git log.
+func (repo *Repository) GetCommitActivity(opts CommitActivityOptions) ([]*CommitActivity, error) {
+	loc := opts.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	cmd := NewCommand(repo.Ctx, "log", "--format=%at %aE")
+	if !opts.Since.IsZero() {
+		cmd.AddOptionFormat("--since=%s", opts.Since.Format(time.RFC3339))
+	}
+	if !opts.Until.IsZero() {
+		cmd.AddOptionFormat("--until=%s", opts.Until.Format(time.RFC3339))
+	}
+	if opts.NoMerges {
+		cmd.AddArguments("--no-merges")
+	}
+	if len(opts.Revisions) == 0 {
+		cmd.AddArguments("HEAD")
+	}
+	cmd.AddDynamicArguments(opts.Revisions...).AddArguments("--")
+
+	stdoutReader, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = stdoutReader.Close()
+		_ = stdoutWriter.Close()
+	}()
+
+	buckets := make(map[time.Time]*CommitActivity)
+	stderr := new(strings.Builder)
+	err = cmd.Run(&RunOpts{
+		Dir:    repo.Path,
+		Stdout: stdoutWriter,
+		Stderr: stderr,
+		PipelineFunc: func(ctx context.Context, cancel context.CancelFunc) error {
+			_ = stdoutWriter.Close()
+			defer stdoutReader.Close()
+			scanner := bufio.NewScanner(stdoutReader)
+			for scanner.Scan() {
+				timestamp, email, _ := strings.Cut(scanner.Text(), " ")
+				seconds, err := strconv.ParseInt(timestamp, 10, 64)
+				if err != nil {
+					cancel()
+					return fmt.Errorf("invalid log output %q: %w", scanner.Text(), err)
+				}
+
+				start := opts.Bucket.start(time.Unix(seconds, 0), loc)
+				bucket, ok := buckets[start]
+				if !ok {
+					bucket = &CommitActivity{Start: start}
+					if opts.PerAuthor {
+						bucket.Authors = make(map[string]int64)
+					}
+					buckets[start] = bucket
+				}
+				bucket.Commits++
+				if opts.PerAuthor {
+					bucket.Authors[strings.ToLower(email)]++
+				}
+			}
+			return scanner.Err()
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get commit activity: %w", ConcatenateError(err, stderr.String()))
+	}
+
+	activity := make([]*CommitActivity, 0, len(buckets))
+	for _, bucket := range buckets {
+		activity = append(activity, bucket)
+	}
+	sort.Slice(activity, func(i, j int) bool {
+		return activity[i].Start.Before(activity[j].Start)
+	})
+	return activity, nil
+}
+
+// CodeFrequency is the number of lines added and deleted in a day or week
+type CodeFrequency struct {
+	Start     time.Time
+	Additions int64
+	Deletions int64
+}
+
+// FileChurn is the number of commits and lines changed of a file
+type FileChurn struct {
+	Path      string
+	Commits   int64
+	Additions int64
+	Deletions int64
+}
+
+// CodeFrequencyStats represents the changes of the history of a revision
+type CodeFrequencyStats struct {
+	// Periods in chronological order, periods without commits are omitted
+	Periods []*CodeFrequency
+	// Files ranked by the lines changed, the most changed file first
+	Files []*FileChurn
+}
+
+// GetCodeFrequency returns the lines added and deleted per interval in UTC by author date, and the churn of
+// every file changed in the history of rev, from a single git log --numstat. Merge commits are skipped and
+// binary files only count as commits.
+func (repo *Repository) GetCodeFrequency(rev string, interval ActivityBucket) (*CodeFrequencyStats, error) {
+	stdoutReader, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = stdoutReader.Close()
+		_ = stdoutWriter.Close()
+	}()
+
+	periods := make(map[time.Time]*CodeFrequency)
+	files := make(map[string]*FileChurn)
+	stderr := new(strings.Builder)
+	err = NewCommand(repo.Ctx, "log", "--numstat", "--no-merges", "--no-renames", "--format=---%n%at").
+		AddDynamicArguments(rev).AddArguments("--").
+		Run(&RunOpts{
+			Dir:    repo.Path,
+			Stdout: stdoutWriter,
+			Stderr: stderr,
+			PipelineFunc: func(ctx context.Context, cancel context.CancelFunc) error {
+				_ = stdoutWriter.Close()
+				defer stdoutReader.Close()
+				scanner := bufio.NewScanner(stdoutReader)
+				var period *CodeFrequency
+				header := false
+				for scanner.Scan() {
+					line := scanner.Text()
+					switch {
+					case line == "---":
+						header = true
+					case header:
+						header = false
+						seconds, err := strconv.ParseInt(line, 10, 64)
+						if err != nil {
+							cancel()
+							return fmt.Errorf("invalid log output %q: %w", line, err)
+						}
+						start := interval.start(time.Unix(seconds, 0), time.UTC)
+						if period = periods[start]; period == nil {
+							period = &CodeFrequency{Start: start}
+							periods[start] = period
+						}
+					case line != "" && period != nil:
+						// <additions> TAB <deletions> TAB <path>, binary files have "-" as numbers
+						fields := strings.SplitN(line, "\t", 3)
+						if len(fields) != 3 {
+							continue
+						}
+						file := files[fields[2]]
+						if file == nil {
+							file = &FileChurn{Path: fields[2]}
+							files[fields[2]] = file
+						}
+						file.Commits++
+						if additions, err := strconv.ParseInt(fields[0], 10, 64); err == nil {
+							file.Additions += additions
+							period.Additions += additions
+						}
+						if deletions, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+							file.Deletions += deletions
+							period.Deletions += deletions
+						}
+					}
+				}
+				return scanner.Err()
+			},
+		})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get code frequency of %s: %w", rev, ConcatenateError(err, stderr.String()))
+	}
+
+	stats := &CodeFrequencyStats{
+		Periods: make([]*CodeFrequency, 0, len(periods)),
+		Files:   make([]*FileChurn, 0, len(files)),
+	}
+	for _, period := range periods {
+		stats.Periods = append(stats.Periods, period)
+	}
+	sort.Slice(stats.Periods, func(i, j int) bool {
+		return stats.Periods[i].Start.Before(stats.Periods[j].Start)
+	})
+	for _, file := range files {
+		stats.Files = append(stats.Files, file)
+	}
+	sort.Slice(stats.Files, func(i, j int) bool {
+		ci := stats.Files[i].Additions + stats.Files[i].Deletions
+		cj := stats.Files[j].Additions + stats.Files[j].Deletions
+		if ci != cj {
+			return ci > cj
+		}
+		return stats.Files[i].Path < stats.Files[j].Path
+	})
+	return stats, nil
+}
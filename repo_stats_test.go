@@ -5,6 +5,8 @@
 package git
 
 import (
+	"fmt"
+	"os"
 	"path/filepath"
 	"testing"
 	"time"
@@ -35,3 +37,102 @@ func TestRepository_GetCodeActivityStats(t *testing.T) {
 	assert.EqualValues(t, 3, code.Authors[1].Commits)
 	assert.EqualValues(t, 5, code.Authors[0].Commits)
 }
+
+func TestRepository_GetCommitActivity(t *testing.T) {
+	bareRepo1Path := filepath.Join(testReposDir, "repo1_bare")
+	bareRepo1, err := openRepositoryWithDefaultContext(bareRepo1Path)
+	assert.NoError(t, err)
+	defer bareRepo1.Close()
+
+	day := func(year int, month time.Month, d int) time.Time {
+		return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	activity, err := bareRepo1.GetCommitActivity(CommitActivityOptions{Revisions: []string{"master"}})
+	assert.NoError(t, err)
+	if assert.Len(t, activity, 4) {
+		assert.Equal(t, day(2017, time.December, 20), activity[0].Start)
+		assert.EqualValues(t, 2, activity[0].Commits)
+		assert.Equal(t, day(2018, time.April, 18), activity[1].Start)
+		assert.EqualValues(t, 2, activity[1].Commits)
+		assert.Equal(t, day(2018, time.April, 20), activity[2].Start)
+		assert.Equal(t, day(2019, time.July, 21), activity[3].Start)
+		assert.Nil(t, activity[3].Authors)
+	}
+
+	activity, err = bareRepo1.GetCommitActivity(CommitActivityOptions{
+		Revisions: []string{"master"},
+		Since:     day(2018, time.January, 1),
+		Bucket:    ActivityBucketWeek,
+		PerAuthor: true,
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, activity, 2) {
+		assert.Equal(t, day(2018, time.April, 15), activity[0].Start)
+		assert.EqualValues(t, 3, activity[0].Commits)
+		assert.Equal(t, map[string]int64{"tris.git@shoddynet.org": 3}, activity[0].Authors)
+		assert.Equal(t, day(2019, time.July, 21), activity[1].Start)
+		assert.Equal(t, map[string]int64{"me@silverwind.io": 1}, activity[1].Authors)
+	}
+
+	// the days start in the given location
+	activity, err = bareRepo1.GetCommitActivity(CommitActivityOptions{Revisions: []string{"master"}, Location: time.FixedZone("UTC+10", 10*60*60)})
+	assert.NoError(t, err)
+	if assert.Len(t, activity, 4) {
+		assert.Equal(t, 20, activity[2].Start.Day())
+		assert.Equal(t, 22, activity[3].Start.Day())
+	}
+
+	_, err = bareRepo1.GetCommitActivity(CommitActivityOptions{Revisions: []string{"unknown"}})
+	assert.Error(t, err)
+}
+
+func TestRepository_GetCodeFrequency(t *testing.T) {
+	bareRepo1Path := filepath.Join(testReposDir, "repo1_bare")
+	bareRepo1, err := openRepositoryWithDefaultContext(bareRepo1Path)
+	assert.NoError(t, err)
+	defer bareRepo1.Close()
+
+	stats, err := bareRepo1.GetCodeFrequency("master", ActivityBucketWeek)
+	assert.NoError(t, err)
+	if assert.Len(t, stats.Periods, 3) {
+		assert.Equal(t, &CodeFrequency{Start: time.Date(2017, time.December, 17, 0, 0, 0, 0, time.UTC), Additions: 2}, stats.Periods[0])
+		assert.Equal(t, &CodeFrequency{Start: time.Date(2018, time.April, 15, 0, 0, 0, 0, time.UTC), Additions: 5}, stats.Periods[1])
+		assert.Equal(t, &CodeFrequency{Start: time.Date(2019, time.July, 21, 0, 0, 0, 0, time.UTC)}, stats.Periods[2])
+	}
+	assert.Len(t, stats.Files, 7)
+
+	repoPath := t.TempDir()
+	repo, err := InitRepository(DefaultContext, repoPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+	committer := &Signature{Name: "Test", Email: "test@example.com"}
+	for i, content := range []map[string]string{
+		{"a.txt": "1\n", "b.txt": "1\n2\n3\n"},
+		{"a.txt": "1\n2\n"},
+		{"a.txt": "2\n3\n", "b.txt": "1\n"},
+	} {
+		for name, data := range content {
+			assert.NoError(t, os.WriteFile(filepath.Join(repoPath, name), []byte(data), 0o644))
+		}
+		assert.NoError(t, AddChanges(repoPath, false, "a.txt", "b.txt"))
+		assert.NoError(t, CommitChanges(repoPath, CommitChangesOptions{Committer: committer, Message: fmt.Sprintf("commit %d", i)}))
+	}
+
+	stats, err = repo.GetCodeFrequency("HEAD", ActivityBucketDay)
+	assert.NoError(t, err)
+	assert.Equal(t, []*FileChurn{
+		{Path: "b.txt", Commits: 2, Additions: 3, Deletions: 2},
+		{Path: "a.txt", Commits: 3, Additions: 3, Deletions: 1},
+	}, stats.Files)
+	var additions, deletions int64
+	for _, period := range stats.Periods {
+		additions += period.Additions
+		deletions += period.Deletions
+	}
+	assert.EqualValues(t, 6, additions)
+	assert.EqualValues(t, 3, deletions)
+
+	_, err = repo.GetCodeFrequency("unknown", ActivityBucketDay)
+	assert.Error(t, err)
+}
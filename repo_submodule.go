@@ -0,0 +1,209 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SubmoduleState is the state of a submodule in the working tree
+type SubmoduleState int
+
+const (
+	// SubmoduleUpToDate the submodule has the commit recorded in the superproject checked out
+	SubmoduleUpToDate SubmoduleState = iota
+	// SubmoduleNotInitialized the submodule is not initialized
+	SubmoduleNotInitialized
+	// SubmoduleModified the submodule has another commit checked out than recorded in the superproject
+	SubmoduleModified
+	// SubmoduleConflict the submodule has merge conflicts
+	SubmoduleConflict
+)
+
+// SubmoduleStatusEntry is a submodule of the working tree as listed by git submodule status
+type SubmoduleStatusEntry struct {
+	Path string
+	// CommitID is the commit checked out in the submodule, or the recorded commit if it is not initialized
+	CommitID string
+	State    SubmoduleState
+	// Describe is the git describe output of the checked out commit, it is empty if the submodule is not initialized
+	Describe string
+	// URL is the url of the submodule in .gitmodules, a relative url is resolved against the superproject remote
+	URL string
+}
+
+// SubmoduleStatus lists the submodules of the working tree, it can't be used with bare repositories
+func (repo *Repository) SubmoduleStatus() ([]*SubmoduleStatusEntry, error) {
+	stdout, stderr, runErr := NewCommand(repo.Ctx, "submodule", "status").RunStdString(&RunOpts{Dir: repo.Path})
+	if runErr != nil {
+		return nil, fmt.Errorf("unable to get submodule status: %w", ConcatenateError(runErr, stderr))
+	}
+
+	var modules map[string]*SubModule
+	f, err := os.Open(filepath.Join(repo.Path, ".gitmodules"))
+	if err == nil {
+		modules, err = ParseGitModules(f)
+		_ = f.Close()
+		if err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	var entries []*SubmoduleStatusEntry
+	for _, line := range strings.Split(stdout, "\n") {
+		if len(line) < 2 {
+			continue
+		}
+		entry, err := parseSubmoduleStatusLine(line)
+		if err != nil {
+			return nil, err
+		}
+		if module, ok := modules[entry.Path]; ok {
+			entry.URL = repo.resolveSubmoduleURL(module.URL)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// parseSubmoduleStatusLine parses a "<state><commit id> <path>[ (<describe>)]" line of git submodule status
+func parseSubmoduleStatusLine(line string) (*SubmoduleStatusEntry, error) {
+	entry := &SubmoduleStatusEntry{}
+	switch line[0] {
+	case ' ':
+		entry.State = SubmoduleUpToDate
+	case '-':
+		entry.State = SubmoduleNotInitialized
+	case '+':
+		entry.State = SubmoduleModified
+	case 'U':
+		entry.State = SubmoduleConflict
+	default:
+		return nil, fmt.Errorf("invalid submodule status %q", line)
+	}
+	id, rest, ok := strings.Cut(line[1:], " ")
+	if !ok {
+		return nil, fmt.Errorf("invalid submodule status %q", line)
+	}
+	entry.CommitID = id
+	entry.Path = rest
+	if i := strings.LastIndex(rest, " ("); i >= 0 && strings.HasSuffix(rest, ")") {
+		entry.Path, entry.Describe = rest[:i], rest[i+2:len(rest)-1]
+	}
+	return entry, nil
+}
+
+// SubmoduleUpdateOptions options for SubmoduleUpdate
+type SubmoduleUpdateOptions struct {
+	// Init initializes the submodules which are not initialized yet
+	Init bool
+	// Recursive updates the submodules of the submodules too
+	Recursive bool
+	// Depth creates shallow clones of the submodules with the given number of commits
+	Depth int
+	// Paths limits the update to the given submodules
+	Paths   []string
+	Env     []string
+	Timeout time.Duration
+}
+
+// SubmoduleUpdate checks out the commits recorded in the superproject in the submodules of the working tree,
+// cloning missing submodules. It can't be used with bare repositories.
+func (repo *Repository) SubmoduleUpdate(opts SubmoduleUpdateOptions) error {
+	if skipDryRun(repo.Ctx, "update submodules %v (init: %t, recursive: %t) [repo_path: %s]", opts.Paths, opts.Init, opts.Recursive, repo.Path) {
+		return nil
+	}
+	cmd := NewCommand(repo.Ctx, "submodule", "update")
+	if opts.Init {
+		cmd.AddArguments("--init")
+	}
+	if opts.Recursive {
+		cmd.AddArguments("--recursive")
+	}
+	if opts.Depth > 0 {
+		cmd.AddArguments("--depth").AddDynamicArguments(strconv.Itoa(opts.Depth))
+	}
+	cmd.AddDashesAndList(opts.Paths...)
+
+	// never wait for credentials on a terminal
+	envs := append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	envs = append(envs, opts.Env...)
+
+	stderr := new(bytes.Buffer)
+	if err := cmd.Run(&RunOpts{
+		Timeout: opts.Timeout,
+		Dir:     repo.Path,
+		Env:     envs,
+		Stdout:  io.Discard,
+		Stderr:  stderr,
+	}); err != nil {
+		return fmt.Errorf("unable to update submodules: %w", ConcatenateError(err, stderr.String()))
+	}
+	return nil
+}
+
+// resolveSubmoduleURL resolves a relative submodule url against the origin remote of the repository,
+// or against the repository itself if it has no origin remote like git does
+func (repo *Repository) resolveSubmoduleURL(url string) string {
+	if !isRelativeSubmoduleURL(url) {
+		return url
+	}
+	remote, err := GetRemoteAddress(repo.Ctx, repo.Path, "origin")
+	if err != nil || remote == "" {
+		remote = repo.Path
+	}
+	return ResolveSubmoduleURL(remote, url)
+}
+
+func isRelativeSubmoduleURL(url string) bool {
+	return strings.HasPrefix(url, "./") || strings.HasPrefix(url, "../")
+}
+
+// ResolveSubmoduleURL resolves a submodule url starting with "./" or "../" against the url of the superproject,
+// e.g. "../lib.git" against "https://example.com/owner/repo.git" is "https://example.com/owner/lib.git".
+// Other urls are returned unchanged.
+func ResolveSubmoduleURL(superprojectURL, submoduleURL string) string {
+	if !isRelativeSubmoduleURL(submoduleURL) {
+		return submoduleURL
+	}
+	base := strings.TrimSuffix(superprojectURL, "/")
+	rel := submoduleURL
+	sep := "/"
+	for {
+		if strings.HasPrefix(rel, "./") {
+			rel = rel[2:]
+			continue
+		}
+		if !strings.HasPrefix(rel, "../") {
+			break
+		}
+		rel = rel[3:]
+		// the last path component of a scp-like url is separated by ":" if it has no "/"
+		i := strings.LastIndexByte(base, '/')
+		if j := strings.LastIndexByte(base, ':'); j > i {
+			i = j
+		}
+		if i < 0 {
+			base = ""
+			break
+		}
+		sep = base[i : i+1]
+		base = base[:i]
+	}
+	if base == "" {
+		return rel
+	}
+	return base + sep + rel
+}
@@ -0,0 +1,95 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveSubmoduleURL(t *testing.T) {
+	cases := []struct {
+		superproject string
+		submodule    string
+		expected     string
+	}{
+		{"https://example.com/owner/repo.git", "../lib.git", "https://example.com/owner/lib.git"},
+		{"https://example.com/owner/repo.git/", "./lib", "https://example.com/owner/repo.git/lib"},
+		{"https://example.com/owner/repo.git", "../../other/lib.git", "https://example.com/other/lib.git"},
+		{"git@example.com:owner/repo.git", "../lib.git", "git@example.com:owner/lib.git"},
+		{"git@example.com:repo.git", "../lib.git", "git@example.com:lib.git"},
+		{"/srv/git/repo", "../lib", "/srv/git/lib"},
+		{"https://example.com/owner/repo.git", "https://example.org/lib.git", "https://example.org/lib.git"},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.expected, ResolveSubmoduleURL(c.superproject, c.submodule), "%s %s", c.superproject, c.submodule)
+	}
+}
+
+func TestRepository_SubmoduleStatus(t *testing.T) {
+	tmpDir := t.TempDir()
+	committer := &Signature{Name: "Test", Email: "test@example.com"}
+	// local submodules are only cloned if the file protocol is allowed
+	allowFile := []string{"GIT_CONFIG_COUNT=1", "GIT_CONFIG_KEY_0=protocol.file.allow", "GIT_CONFIG_VALUE_0=always"}
+
+	subPath := filepath.Join(tmpDir, "sub")
+	sub, err := InitRepository(DefaultContext, subPath)
+	assert.NoError(t, err)
+	defer sub.Close()
+	assert.NoError(t, os.WriteFile(filepath.Join(subPath, "lib.txt"), []byte("lib\n"), 0o644))
+	assert.NoError(t, AddChanges(subPath, false, "lib.txt"))
+	assert.NoError(t, CommitChanges(subPath, CommitChangesOptions{Committer: committer, Message: "lib"}))
+	subCommitID, err := sub.GetRefCommitID("HEAD")
+	assert.NoError(t, err)
+
+	superPath := filepath.Join(tmpDir, "super")
+	super, err := InitRepository(DefaultContext, superPath)
+	assert.NoError(t, err)
+	defer super.Close()
+	_, stderr, runErr := NewCommand(DefaultContext, "submodule", "add", "../sub", "vendor/sub").
+		RunStdString(&RunOpts{Dir: superPath, Env: append(os.Environ(), allowFile...)})
+	assert.NoError(t, runErr, stderr)
+	assert.NoError(t, CommitChanges(superPath, CommitChangesOptions{Committer: committer, Message: "add submodule"}))
+
+	clonePath := filepath.Join(tmpDir, "clone")
+	assert.NoError(t, Clone(DefaultContext, superPath, clonePath, CloneRepoOptions{}))
+	clone, err := openRepositoryWithDefaultContext(clonePath)
+	assert.NoError(t, err)
+	defer clone.Close()
+
+	entries, err := clone.SubmoduleStatus()
+	assert.NoError(t, err)
+	assert.Equal(t, []*SubmoduleStatusEntry{{
+		Path:     "vendor/sub",
+		CommitID: subCommitID,
+		State:    SubmoduleNotInitialized,
+		URL:      subPath,
+	}}, entries)
+
+	assert.NoError(t, clone.SubmoduleUpdate(SubmoduleUpdateOptions{Init: true, Recursive: true, Env: allowFile}))
+	content, err := os.ReadFile(filepath.Join(clonePath, "vendor", "sub", "lib.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "lib\n", string(content))
+
+	entries, err = clone.SubmoduleStatus()
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, SubmoduleUpToDate, entries[0].State)
+		assert.Equal(t, subCommitID, entries[0].CommitID)
+		assert.NotEmpty(t, entries[0].Describe)
+	}
+
+	assert.Equal(t, &SubmoduleStatusEntry{Path: "dir with space/sub", CommitID: subCommitID, State: SubmoduleModified, Describe: "heads/main"},
+		mustParseSubmoduleStatusLine(t, "+"+subCommitID+" dir with space/sub (heads/main)"))
+}
+
+func mustParseSubmoduleStatusLine(t *testing.T, line string) *SubmoduleStatusEntry {
+	entry, err := parseSubmoduleStatusLine(line)
+	assert.NoError(t, err)
+	return entry
+}
@@ -8,13 +8,16 @@ package git
 import (
 	"fmt"
 	"io"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/enverbisevac/gitlib/foreachref"
 	"github.com/enverbisevac/gitlib/log"
 	"github.com/enverbisevac/gitlib/util"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 )
 
 // TagPrefix tags prefix path on the repository
@@ -22,14 +25,186 @@ const TagPrefix = "refs/tags/"
 
 // CreateTag create one tag in the repository
 func (repo *Repository) CreateTag(name, revision string) error {
+	if skipDryRun(repo.Ctx, "create tag %s at %s [repo_path: %s]", name, revision, repo.Path) {
+		return nil
+	}
+	if repo.backendFor(OperationReferences, BackendGoGit, BackendCLI) == BackendCLI {
+		if _, stderr, err := NewCommand(repo.Ctx, "tag").AddDashesAndList(name, revision).RunStdString(&RunOpts{Dir: repo.Path}); err != nil {
+			return fmt.Errorf("unable to create tag %s: %w", name, ConcatenateError(err, stderr))
+		}
+		return nil
+	}
 	_, err := repo.gogit.CreateTag(name, plumbing.NewHash(revision), nil)
 	return err
 }
 
+type annotatedTagConfig struct {
+	tagger        *Signature
+	sign          bool
+	keyID         string
+	signingFormat string
+	signer        Signer
+}
+
+// AnnotatedTagOption changes how CreateAnnotatedTag creates the tag
+type AnnotatedTagOption func(c *annotatedTagConfig)
+
+// TagWithTagger sets the tagger, user.name and user.email with the current time are used by default
+func TagWithTagger(tagger *Signature) AnnotatedTagOption {
+	return func(c *annotatedTagConfig) {
+		c.tagger = tagger
+	}
+}
+
+// TagWithSigning signs the tag like git tag -u with keyID, or like git tag -s with user.signingkey if keyID is empty.
+// The signing format is taken from gpg.format unless one is given.
+func TagWithSigning(keyID, format string) AnnotatedTagOption {
+	return func(c *annotatedTagConfig) {
+		c.sign = true
+		c.keyID = keyID
+		c.signingFormat = format
+	}
+}
+
+// TagWithSigner signs the tag with signer
+func TagWithSigner(signer Signer) AnnotatedTagOption {
+	return func(c *annotatedTagConfig) {
+		c.sign = true
+		c.signer = signer
+	}
+}
+
 // CreateAnnotatedTag create one annotated tag in the repository
-func (repo *Repository) CreateAnnotatedTag(name, message, revision string) error {
-	_, err := repo.gogit.CreateTag(name, plumbing.NewHash(revision), &git.CreateTagOptions{Message: message})
-	return err
+func (repo *Repository) CreateAnnotatedTag(name, message, revision string, opts ...AnnotatedTagOption) error {
+	c := annotatedTagConfig{}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	if skipDryRun(repo.Ctx, "create annotated tag %s at %s (signed: %t) [repo_path: %s]", name, revision, c.sign, repo.Path) {
+		return nil
+	}
+	// gogit only writes sha1 objects, but git can't sign with a Signer
+	if repo.ObjectFormat() != Sha1ObjectFormat ||
+		repo.backendFor(OperationReferences, BackendGoGit, BackendCLI) == BackendCLI && (!c.sign || repo.injectedSigner(c.signer) == nil) {
+		return repo.createAnnotatedTagWithGit(name, message, revision, c)
+	}
+	if !c.sign {
+		_, err := repo.gogit.CreateTag(name, plumbing.NewHash(revision), &git.CreateTagOptions{Message: message, Tagger: c.tagger})
+		return err
+	}
+	return repo.createSignedTag(name, message, revision, c)
+}
+
+func (repo *Repository) createSignedTag(name, message, revision string, c annotatedTagConfig) error {
+	refName := plumbing.NewTagReferenceName(name)
+	if _, err := repo.gogit.Storer.Reference(refName); err == nil {
+		return git.ErrTagExists
+	}
+
+	target, err := repo.gogit.Object(plumbing.AnyObject, plumbing.NewHash(revision))
+	if err != nil {
+		if err == plumbing.ErrObjectNotFound {
+			return ErrNotExist{ID: revision}
+		}
+		return err
+	}
+
+	tagger := c.tagger
+	if tagger == nil {
+		tagger = &Signature{
+			Name:  repo.signingConfig("user.name"),
+			Email: repo.signingConfig("user.email"),
+			When:  time.Now(),
+		}
+	}
+	signer := repo.injectedSigner(c.signer)
+	if signer == nil {
+		if signer, err = repo.Signer(c.signingFormat, c.keyID); err != nil {
+			return err
+		}
+	}
+	if !strings.HasSuffix(message, "\n") {
+		message += "\n"
+	}
+
+	tag := &object.Tag{
+		Name:       name,
+		Tagger:     *tagger,
+		Message:    message,
+		TargetType: target.Type(),
+		Target:     target.ID(),
+	}
+	unsigned := repo.gogit.Storer.NewEncodedObject()
+	if err := tag.EncodeWithoutSignature(unsigned); err != nil {
+		return err
+	}
+	reader, err := unsigned.Reader()
+	if err != nil {
+		return err
+	}
+	payload, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	if tag.PGPSignature, err = signer(payload); err != nil {
+		return err
+	}
+
+	signed := repo.gogit.Storer.NewEncodedObject()
+	if err := tag.Encode(signed); err != nil {
+		return err
+	}
+	id, err := repo.gogit.Storer.SetEncodedObject(signed)
+	if err != nil {
+		return err
+	}
+	return repo.gogit.Storer.SetReference(plumbing.NewHashReference(refName, id))
+}
+
+// createAnnotatedTagWithGit creates the annotated tag with git tag, a Signer can't be used as git signs the tag itself
+func (repo *Repository) createAnnotatedTagWithGit(name, message, revision string, c annotatedTagConfig) error {
+	if c.sign && repo.injectedSigner(c.signer) != nil {
+		return fmt.Errorf("unable to sign tag %s with a Signer in a %s repository", name, repo.ObjectFormat().Name())
+	}
+	cmd := addSigningPrograms(repo.Ctx, NewCommand(repo.Ctx))
+	if c.signingFormat != "" {
+		cmd.AddArguments("-c").AddDynamicArguments("gpg.format=" + c.signingFormat)
+	}
+	cmd.AddArguments("tag", "-a", "-F", "-")
+	switch {
+	case c.keyID != "":
+		cmd.AddOptionFormat("--local-user=%s", c.keyID)
+	case c.sign:
+		cmd.AddArguments("--sign")
+	}
+	cmd.AddDashesAndList(name, revision)
+
+	var env []string
+	if c.tagger != nil {
+		env = append(os.Environ(), SignatureEnv(nil, c.tagger)...)
+	}
+	if _, stderr, err := cmd.RunStdString(&RunOpts{Dir: repo.Path, Env: env, Stdin: strings.NewReader(message)}); err != nil {
+		if strings.Contains(stderr, "already exists") {
+			return git.ErrTagExists
+		}
+		return fmt.Errorf("unable to create tag %s: %w", name, ConcatenateError(err, stderr))
+	}
+	return nil
+}
+
+// DeleteTag deletes the tag from the repository, it returns ErrNotExist if there is no such tag
+func (repo *Repository) DeleteTag(name string) error {
+	if skipDryRun(repo.Ctx, "delete tag %s [repo_path: %s]", name, repo.Path) {
+		return nil
+	}
+	_, stderr, err := NewCommand(repo.Ctx, "tag", "-d").AddDashesAndList(name).RunStdString(&RunOpts{Dir: repo.Path})
+	if err != nil {
+		if strings.Contains(stderr, "not found") {
+			return ErrNotExist{ID: name}
+		}
+		return fmt.Errorf("unable to delete tag %s: %w", name, ConcatenateError(err, stderr))
+	}
+	return nil
 }
 
 // GetTagNameBySHA returns the name of a tag from its tag object SHA or commit SHA
@@ -38,6 +213,23 @@ func (repo *Repository) GetTagNameBySHA(sha string) (s string, err error) {
 		return "", fmt.Errorf("SHA is too short: %s", sha)
 	}
 
+	if repo.backendFor(OperationObjects, BackendGoGit, BackendCLI) == BackendCLI {
+		stdout, _, runErr := NewCommand(repo.Ctx, "cat-file", "tag").AddDynamicArguments(sha).RunStdBytes(&RunOpts{Dir: repo.Path})
+		if runErr != nil {
+			return "", ErrNotExist{ID: sha}
+		}
+		// the name is in the tag header, which parseTagData skips
+		for _, line := range strings.Split(string(stdout), "\n") {
+			if line == "" {
+				break
+			}
+			if strings.HasPrefix(line, "tag ") {
+				return strings.TrimPrefix(line, "tag "), nil
+			}
+		}
+		return "", ErrNotExist{ID: sha}
+	}
+
 	iter, err := repo.gogit.Tags()
 	if err != nil {
 		return "", err
@@ -62,6 +254,9 @@ func (repo *Repository) GetTagNameBySHA(sha string) (s string, err error) {
 
 // GetTagID returns the object ID for a tag (annotated tags have both an object SHA AND a commit SHA)
 func (repo *Repository) GetTagID(name string) (string, error) {
+	if repo.backendFor(OperationReferences, BackendGoGit, BackendCLI) == BackendCLI {
+		return repo.GetRefCommitID(TagPrefix + name)
+	}
 	ref, err := repo.gogit.Tag(name)
 	if err != nil {
 		return "", err
@@ -76,7 +271,7 @@ func (repo *Repository) GetTag(name string) (*Tag, error) {
 		return nil, err
 	}
 
-	id, err := NewIDFromString(idStr)
+	id, err := repo.ObjectFormat().NewIDFromString(idStr)
 	if err != nil {
 		return nil, err
 	}
@@ -90,7 +285,7 @@ func (repo *Repository) GetTag(name string) (*Tag, error) {
 
 // GetTagWithID returns a Git tag by given name and ID
 func (repo *Repository) GetTagWithID(idStr, name string) (*Tag, error) {
-	id, err := NewIDFromString(idStr)
+	id, err := repo.ObjectFormat().NewIDFromString(idStr)
 	if err != nil {
 		return nil, err
 	}
@@ -106,20 +301,12 @@ func (repo *Repository) GetTagWithID(idStr, name string) (*Tag, error) {
 func (repo *Repository) GetTagInfos(page, pageSize int) ([]*Tag, int, error) {
 	forEachRefFmt := foreachref.NewFormat("objecttype", "refname:short", "object", "objectname", "creator", "contents", "contents:signature")
 
-	stdoutReader, stdoutWriter := io.Pipe()
+	stdoutReader, err := NewCommand(repo.Ctx, "for-each-ref", CmdArg("--format="+forEachRefFmt.Flag()), "--sort", "-*creatordate", "refs/tags").
+		RunWithStdoutReader(&RunOpts{Dir: repo.Path})
+	if err != nil {
+		return nil, 0, err
+	}
 	defer stdoutReader.Close()
-	defer stdoutWriter.Close()
-	stderr := strings.Builder{}
-	rc := &RunOpts{Dir: repo.Path, Stdout: stdoutWriter, Stderr: &stderr}
-
-	go func() {
-		err := NewCommand(repo.Ctx, "for-each-ref", CmdArg("--format="+forEachRefFmt.Flag()), "--sort", "-*creatordate", "refs/tags").Run(rc)
-		if err != nil {
-			_ = stdoutWriter.CloseWithError(ConcatenateError(err, stderr.String()))
-		} else {
-			_ = stdoutWriter.Close()
-		}
-	}()
 
 	var tags []*Tag
 	parser := forEachRefFmt.Parser(stdoutReader)
@@ -155,7 +342,7 @@ func parseTagRef(ref map[string]string) (tag *Tag, err error) {
 		Name: ref["refname:short"],
 	}
 
-	tag.ID, err = NewIDFromString(ref["objectname"])
+	tag.ID, err = NewObjectIDFromString(ref["objectname"])
 	if err != nil {
 		return nil, fmt.Errorf("parse objectname '%s': %w", ref["objectname"], err)
 	}
@@ -165,7 +352,7 @@ func parseTagRef(ref map[string]string) (tag *Tag, err error) {
 		tag.Object = tag.ID
 	} else {
 		// annotated tag
-		tag.Object, err = NewIDFromString(ref["object"])
+		tag.Object, err = NewObjectIDFromString(ref["object"])
 		if err != nil {
 			return nil, fmt.Errorf("parse object '%s': %w", ref["object"], err)
 		}
@@ -198,7 +385,7 @@ func parseTagRef(ref map[string]string) (tag *Tag, err error) {
 
 // GetAnnotatedTag returns a Git tag by its SHA, must be an annotated tag
 func (repo *Repository) GetAnnotatedTag(sha string) (*Tag, error) {
-	id, err := NewIDFromString(sha)
+	id, err := repo.ObjectFormat().NewIDFromString(sha)
 	if err != nil {
 		return nil, err
 	}
@@ -226,6 +413,9 @@ func (repo *Repository) GetAnnotatedTag(sha string) (*Tag, error) {
 
 // IsTagExist returns true if given tag exists in the repository.
 func (repo *Repository) IsTagExist(name string) bool {
+	if repo.backendFor(OperationReferences, BackendGoGit, BackendCLI) == BackendCLI {
+		return repo.IsReferenceExist(TagPrefix + name)
+	}
 	_, err := repo.gogit.Reference(plumbing.ReferenceName(TagPrefix+name), true)
 	return err == nil
 }
@@ -235,15 +425,24 @@ func (repo *Repository) IsTagExist(name string) bool {
 func (repo *Repository) GetTags(skip, limit int) ([]string, error) {
 	var tagNames []string
 
-	tags, err := repo.gogit.Tags()
-	if err != nil {
-		return nil, err
-	}
+	if repo.backendFor(OperationReferences, BackendGoGit, BackendCLI) == BackendCLI {
+		if err := repo.walkRefsWithGit(func(_, _, name string) error {
+			tagNames = append(tagNames, strings.TrimPrefix(name, TagPrefix))
+			return nil
+		}, TagPrefix); err != nil {
+			return nil, err
+		}
+	} else {
+		tags, err := repo.gogit.Tags()
+		if err != nil {
+			return nil, err
+		}
 
-	_ = tags.ForEach(func(tag *plumbing.Reference) error {
-		tagNames = append(tagNames, strings.TrimPrefix(tag.Name().String(), TagPrefix))
-		return nil
-	})
+		_ = tags.ForEach(func(tag *plumbing.Reference) error {
+			tagNames = append(tagNames, strings.TrimPrefix(tag.Name().String(), TagPrefix))
+			return nil
+		})
+	}
 
 	// Reverse order
 	for i := 0; i < len(tagNames)/2; i++ {
@@ -265,20 +464,16 @@ func (repo *Repository) GetTags(skip, limit int) ([]string, error) {
 }
 
 // GetTagType gets the type of the tag, either commit (simple) or tag (annotated)
-func (repo *Repository) GetTagType(id SHA1) (string, error) {
+func (repo *Repository) GetTagType(id ObjectID) (string, error) {
 	// Get tag type
-	obj, err := repo.gogit.Object(plumbing.AnyObject, id)
+	typ, _, err := repo.statObject(id)
 	if err != nil {
-		if err == plumbing.ErrReferenceNotFound {
-			return "", &ErrNotExist{ID: id.String()}
-		}
 		return "", err
 	}
-
-	return obj.Type().String(), nil
+	return typ, nil
 }
 
-func (repo *Repository) getTag(tagID SHA1, name string) (*Tag, error) {
+func (repo *Repository) getTag(tagID ObjectID, name string) (*Tag, error) {
 	t, ok := repo.tagCache.Get(tagID.String())
 	if ok {
 		log.Info("Hit cache: %s", tagID)
@@ -298,7 +493,7 @@ func (repo *Repository) getTag(tagID SHA1, name string) (*Tag, error) {
 		// every tag should have a commit ID so return all errors
 		return nil, err
 	}
-	commitID, err := NewIDFromString(commitIDStr)
+	commitID, err := repo.ObjectFormat().NewIDFromString(commitIDStr)
 	if err != nil {
 		return nil, err
 	}
@@ -322,7 +517,32 @@ func (repo *Repository) getTag(tagID SHA1, name string) (*Tag, error) {
 		return tag, nil
 	}
 
-	gogitTag, err := repo.gogit.TagObject(tagID)
+	if repo.backendFor(OperationObjects, BackendGoGit, BackendCLI) == BackendCLI {
+		obj, err := repo.readObject(tagID)
+		if err != nil {
+			return nil, err
+		}
+		data, err := readEncodedObject(obj)
+		if err != nil {
+			return nil, err
+		}
+		tag, err := parseTagData(data)
+		if err != nil {
+			return nil, err
+		}
+		tag.Name = name
+		tag.ID = tagID
+		tag.Type = tp
+
+		repo.tagCache.Set(tagID.String(), tag)
+		return tag, nil
+	}
+
+	hash, err := gogitHash(tagID)
+	if err != nil {
+		return nil, err
+	}
+	gogitTag, err := repo.gogit.TagObject(hash)
 	if err != nil {
 		if err == plumbing.ErrReferenceNotFound {
 			return nil, &ErrNotExist{ID: tagID.String()}
@@ -332,12 +552,13 @@ func (repo *Repository) getTag(tagID SHA1, name string) (*Tag, error) {
 	}
 
 	tag := &Tag{
-		Name:    name,
-		ID:      tagID,
-		Object:  gogitTag.Target,
-		Type:    tp,
-		Tagger:  &gogitTag.Tagger,
-		Message: gogitTag.Message,
+		Name:      name,
+		ID:        tagID,
+		Object:    gogitTag.Target,
+		Type:      tp,
+		Tagger:    &gogitTag.Tagger,
+		Message:   gogitTag.Message,
+		Signature: convertPGPSignatureForTag(gogitTag),
 	}
 
 	repo.tagCache.Set(tagID.String(), tag)
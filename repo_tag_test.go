@@ -5,8 +5,10 @@
 package git
 
 import (
+	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -375,3 +377,61 @@ func parseAuthorLine(t *testing.T, committer string) *Signature {
 
 	return sig
 }
+
+func TestRepository_CreateSignedAnnotatedTag(t *testing.T) {
+	keyPath, allowedSigners := generateSSHSigningKey(t, "tagger@example.com")
+
+	repoPath := filepath.Join(t.TempDir(), "repo.git")
+	assert.NoError(t, Clone(DefaultContext, filepath.Join(testReposDir, "repo1_bare"), repoPath, CloneRepoOptions{Bare: true}))
+	repo, err := openRepositoryWithDefaultContext(repoPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	tagger := &Signature{Name: "Tagger", Email: "tagger@example.com", When: time.Unix(1700000000, 0).UTC()}
+	err = repo.CreateAnnotatedTag("v9.0.0", "release v9.0.0", "feaf4ba6bc635fec442f46ddd4512416ec43c2c2",
+		TagWithTagger(tagger), TagWithSigning(keyPath, SigningFormatSSH))
+	assert.NoError(t, err)
+
+	tag, err := repo.GetTag("v9.0.0")
+	assert.NoError(t, err)
+	assert.Equal(t, "feaf4ba6bc635fec442f46ddd4512416ec43c2c2", tag.Object.String())
+	assert.Equal(t, "Tagger", tag.Tagger.Name)
+	assert.Equal(t, "release v9.0.0\n", tag.Message)
+	result, err := tag.VerifySignature(VerifyOptions{AllowedSigners: allowedSigners})
+	assert.NoError(t, err)
+	assert.Equal(t, TrustStatusTrusted, result.Status)
+
+	// git agrees with the signature
+	_, _, err = NewCommand(DefaultContext, "-c").AddDynamicArguments("gpg.ssh.allowedSignersFile="+keyPath+".allowed").
+		AddArguments("verify-tag", "v9.0.0").RunStdString(&RunOpts{Dir: repoPath})
+	assert.Error(t, err)
+	assert.NoError(t, os.WriteFile(keyPath+".allowed", allowedSigners, 0o644))
+	_, _, err = NewCommand(DefaultContext, "-c").AddDynamicArguments("gpg.ssh.allowedSignersFile="+keyPath+".allowed").
+		AddArguments("verify-tag", "v9.0.0").RunStdString(&RunOpts{Dir: repoPath})
+	assert.NoError(t, err)
+
+	err = repo.CreateAnnotatedTag("v9.0.0", "again", "feaf4ba6bc635fec442f46ddd4512416ec43c2c2", TagWithSigning(keyPath, SigningFormatSSH))
+	assert.Error(t, err)
+
+	err = repo.CreateAnnotatedTag("v9.0.1", "custom", "feaf4ba6bc635fec442f46ddd4512416ec43c2c2",
+		TagWithTagger(tagger), TagWithSigner(SSHSigner(DefaultContext, "", keyPath)))
+	assert.NoError(t, err)
+	tag, err = repo.GetTag("v9.0.1")
+	assert.NoError(t, err)
+	result, err = tag.VerifySignature(VerifyOptions{AllowedSigners: allowedSigners})
+	assert.NoError(t, err)
+	assert.Equal(t, TrustStatusTrusted, result.Status)
+}
+
+func TestRepository_DeleteTag(t *testing.T) {
+	repoPath := filepath.Join(t.TempDir(), "repo.git")
+	assert.NoError(t, Clone(DefaultContext, filepath.Join(testReposDir, "repo1_bare"), repoPath, CloneRepoOptions{Bare: true}))
+	repo, err := openRepositoryWithDefaultContext(repoPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	assert.True(t, repo.IsTagExist("test"))
+	assert.NoError(t, repo.DeleteTag("test"))
+	assert.False(t, repo.IsTagExist("test"))
+	assert.True(t, IsErrNotExist(repo.DeleteTag("test")))
+}
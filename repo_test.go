@@ -5,9 +5,14 @@
 package git
 
 import (
+	"bytes"
+	"context"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/enverbisevac/gitlib/hooks"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -30,3 +35,179 @@ func TestRepoIsEmpty(t *testing.T) {
 	assert.NoError(t, err)
 	assert.True(t, isEmpty)
 }
+
+func TestInitRepositoryObjectFormat(t *testing.T) {
+	repo, err := InitRepository(DefaultContext, t.TempDir(), InitWithBare(true))
+	assert.NoError(t, err)
+	assert.Equal(t, Sha1ObjectFormat, repo.ObjectFormat())
+	repo.Close()
+
+	repoPath := t.TempDir()
+	repo, err = InitRepository(DefaultContext, repoPath, InitWithBare(true), InitWithObjectFormat("sha256"), InitWithDefaultBranch("trunk"))
+	assert.NoError(t, err)
+	assert.Equal(t, Sha256ObjectFormat, repo.ObjectFormat())
+	head, _, err := NewCommand(DefaultContext, "symbolic-ref", "HEAD").RunStdString(&RunOpts{Dir: repoPath})
+	assert.NoError(t, err)
+	assert.Equal(t, "refs/heads/trunk\n", head)
+	repo.Close()
+
+	// the object format is detected when the repository is opened again
+	repo, err = openRepositoryWithDefaultContext(repoPath)
+	assert.NoError(t, err)
+	assert.Equal(t, Sha256ObjectFormat, repo.ObjectFormat())
+	repo.Close()
+
+	_, err = InitRepository(DefaultContext, t.TempDir(), InitWithObjectFormat("md5"))
+	assert.Error(t, err)
+}
+
+func TestInitRepositoryHooks(t *testing.T) {
+	repoPath := t.TempDir()
+	repo, err := InitRepository(DefaultContext, repoPath, InitWithBare(true), InitWithHooks(map[string]string{
+		"pre-receive": "#!/bin/sh\necho rejected >&2\nexit 1\n",
+	}))
+	assert.NoError(t, err)
+	repo.Close()
+
+	h, err := hooks.Get(repoPath, "pre-receive")
+	assert.NoError(t, err)
+	assert.True(t, h.Installed)
+	assert.Len(t, h.Scripts, 1)
+
+	// the installed hook is run by git
+	clonePath, err := cloneRepo(t, filepath.Join(testReposDir, "repo1_bare"))
+	assert.NoError(t, err)
+	_, stderr, err := NewCommand(DefaultContext, "push").AddDynamicArguments(repoPath, "master").RunStdString(&RunOpts{Dir: clonePath})
+	assert.Error(t, err)
+	assert.Contains(t, stderr, "rejected")
+}
+
+func TestGetDivergingCommitsForBranches(t *testing.T) {
+	bareRepo1Path := filepath.Join(testReposDir, "repo1_bare")
+
+	result, err := GetDivergingCommitsForBranches(DefaultContext, bareRepo1Path, "master", []string{"branch1", "branch2"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]DivergeObject{
+		"branch1": {Ahead: 2, Behind: 5},
+		"branch2": {Ahead: 1, Behind: 4},
+	}, result)
+
+	single, err := GetDivergingCommits(DefaultContext, bareRepo1Path, "master", "branch1")
+	assert.NoError(t, err)
+	assert.Equal(t, single, result["branch1"])
+
+	result, err = getDivergingCommitsByRevList(DefaultContext, bareRepo1Path, "master", []string{"branch2"})
+	assert.NoError(t, err)
+	assert.Equal(t, DivergeObject{Ahead: 1, Behind: 4}, result["branch2"])
+
+	_, err = GetDivergingCommitsForBranches(DefaultContext, bareRepo1Path, "master", []string{"no-such-branch"})
+	assert.True(t, IsErrNotExist(err))
+}
+
+func TestRepository_CreateBundleWithOptions(t *testing.T) {
+	bareRepo1Path := filepath.Join(testReposDir, "repo1_bare")
+	repo, err := openRepositoryWithDefaultContext(bareRepo1Path)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	// bundleHeader returns the prerequisites and the refs of the bundle header
+	bundleHeader := func(bundle []byte) (prerequisites, refs []string) {
+		header, _, _ := strings.Cut(string(bundle), "\n\n")
+		for _, line := range strings.Split(header, "\n")[1:] {
+			if strings.HasPrefix(line, "-") {
+				prerequisites = append(prerequisites, strings.Fields(line[1:])[0])
+			} else {
+				refs = append(refs, line)
+			}
+		}
+		return prerequisites, refs
+	}
+
+	var bundle bytes.Buffer
+	assert.NoError(t, repo.CreateBundleWithOptions(DefaultContext, &bundle, BundleOptions{All: true}))
+	prerequisites, refs := bundleHeader(bundle.Bytes())
+	assert.Empty(t, prerequisites)
+	assert.Contains(t, refs, "feaf4ba6bc635fec442f46ddd4512416ec43c2c2 refs/heads/master")
+	assert.Contains(t, refs, "5c80b0245c1c6f8343fa418ec374b13b5d4ee658 refs/heads/branch2")
+
+	bundle.Reset()
+	assert.NoError(t, repo.CreateBundleWithOptions(DefaultContext, &bundle, BundleOptions{
+		Revisions: []string{"refs/heads/master", "refs/heads/branch2"},
+		Basis:     []string{"8006ff9adbf0cb94da7dad9e537e53817f9fa5c0"},
+	}))
+	prerequisites, refs = bundleHeader(bundle.Bytes())
+	assert.Equal(t, []string{"8006ff9adbf0cb94da7dad9e537e53817f9fa5c0", "8d92fc957a4d7cfd98bc375f0b7bb189a0d6c9f2"}, prerequisites)
+	assert.Equal(t, []string{
+		"feaf4ba6bc635fec442f46ddd4512416ec43c2c2 refs/heads/master",
+		"5c80b0245c1c6f8343fa418ec374b13b5d4ee658 refs/heads/branch2",
+	}, refs)
+
+	// the incremental bundle can be fetched into a clone having the basis
+	bundlePath := filepath.Join(t.TempDir(), "incremental.bundle")
+	assert.NoError(t, os.WriteFile(bundlePath, bundle.Bytes(), 0o644))
+	clonePath := filepath.Join(t.TempDir(), "clone.git")
+	assert.NoError(t, Clone(DefaultContext, bareRepo1Path, clonePath, CloneRepoOptions{Bare: true}))
+	_, stderr, runErr := NewCommand(DefaultContext, "bundle", "verify").AddDynamicArguments(bundlePath).RunStdString(&RunOpts{Dir: clonePath})
+	assert.NoError(t, runErr, stderr)
+
+	err = repo.CreateBundleWithOptions(DefaultContext, &bundle, BundleOptions{Revisions: []string{"master"}, Basis: []string{"master"}})
+	assert.Error(t, err)
+	assert.Error(t, repo.CreateBundleWithOptions(DefaultContext, &bundle, BundleOptions{}))
+}
+
+func TestOpenRepositoryOptions(t *testing.T) {
+	bareRepo1Path := filepath.Join(testReposDir, "repo1_bare")
+	lastCommitCache := &LastCommitCache{}
+	repo, err := OpenRepository(DefaultContext, bareRepo1Path,
+		OpenWithObjectCacheSize(1024),
+		OpenWithLargeObjectThreshold(1),
+		OpenWithKeepDescriptors(false),
+		OpenWithLastCommitCache(lastCommitCache),
+	)
+	assert.NoError(t, err)
+	defer repo.Close()
+	assert.Same(t, lastCommitCache, repo.LastCommitCache)
+	assert.Same(t, repo, lastCommitCache.repo)
+
+	commit, err := repo.GetCommit("master")
+	assert.NoError(t, err)
+	assert.Equal(t, "feaf4ba6bc635fec442f46ddd4512416ec43c2c2", commit.ID.String())
+
+	// a bare repository has no .git directory
+	_, err = OpenRepository(DefaultContext, bareRepo1Path, OpenWithBare(false))
+	assert.Error(t, err)
+
+	clonedPath, err := cloneRepo(t, bareRepo1Path)
+	assert.NoError(t, err)
+	cloned, err := OpenRepository(DefaultContext, filepath.Join(clonedPath, ".git"), OpenWithBare(true))
+	assert.NoError(t, err)
+	defer cloned.Close()
+	id, err := cloned.GetRefCommitID("refs/heads/master")
+	assert.NoError(t, err)
+	assert.Equal(t, "feaf4ba6bc635fec442f46ddd4512416ec43c2c2", id)
+}
+
+func TestRepository_WithContext(t *testing.T) {
+	repo, err := openRepositoryWithDefaultContext(filepath.Join(testReposDir, "repo1_bare"))
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	ctx, cancel := context.WithCancel(DefaultContext)
+	cancel()
+	view := repo.WithContext(ctx)
+
+	commit, err := view.GetCommit("feaf4ba6bc635fec442f46ddd4512416ec43c2c2")
+	assert.NoError(t, err)
+	_, err = commit.CommitsCount()
+	assert.Error(t, err)
+
+	// the repository itself and the cat-file processes are not affected by the canceled view
+	count, err := commit.WithContext(DefaultContext).CommitsCount()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 6, count)
+	_, err = repo.GetCommit("branch1")
+	assert.NoError(t, err)
+	_, _, cancelBatch, err := view.CatFileBatch(DefaultContext)
+	assert.NoError(t, err)
+	cancelBatch()
+}
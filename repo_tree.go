@@ -2,8 +2,11 @@ package git
 
 import (
 	"bytes"
-
-	git2go "github.com/libgit2/git2go/v34"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
 )
 
 // CommitTreeOpts represents the possible options to CommitTree
@@ -13,22 +16,37 @@ type CommitTreeOpts struct {
 	KeyID      string
 	NoGPGSign  bool
 	AlwaysSign bool
+	// Ref is the reference CommitTree updates to the new commit, HEAD if empty
+	Ref string
+	// AllowEmpty allows a commit with a single parent having the same tree
+	AllowEmpty bool
+	// Orphan creates a commit without parents on Ref, which must not exist yet
+	Orphan bool
+	// SigningFormat is SigningFormatOpenPGP or SigningFormatSSH, gpg.format is used if empty
+	SigningFormat string
+	// Signer signs the commit instead of the program configured for the SigningFormat,
+	// the Signer of the client the repository was opened with is used if nil and signing is enabled
+	Signer Signer
 }
 
-func (repo *Repository) getTree(id SHA1) (*Tree, error) {
-	gogitTree, err := repo.gogit.TreeObject(id)
-	if err != nil {
-		return nil, err
-	}
+func (opts CommitTreeOpts) sign() bool {
+	return !opts.NoGPGSign && (opts.Signer != nil || opts.KeyID != "" || opts.AlwaysSign)
+}
+
+// ErrEmptyCommit is returned if a commit would not change the tree of its parent
+var ErrEmptyCommit = errors.New("commit does not change the tree of its parent")
 
+func (repo *Repository) getTree(id ObjectID) (*Tree, error) {
 	tree := NewTree(repo, id)
-	tree.gogitTree = gogitTree
+	if err := tree.loadTreeObject(); err != nil {
+		return nil, err
+	}
 	return tree, nil
 }
 
 // GetTree find the tree object in the repository.
 func (repo *Repository) GetTree(idStr string) (*Tree, error) {
-	if len(idStr) != 40 {
+	if len(idStr) != repo.ObjectFormat().FullLength() {
 		res, _, err := NewCommand(repo.Ctx, "rev-parse", "--verify").AddDynamicArguments(idStr).RunStdString(&RunOpts{Dir: repo.Path})
 		if err != nil {
 			return nil, err
@@ -37,14 +55,17 @@ func (repo *Repository) GetTree(idStr string) (*Tree, error) {
 			idStr = res[:len(res)-1]
 		}
 	}
-	id, err := NewIDFromString(idStr)
+	id, err := repo.ObjectFormat().NewIDFromString(idStr)
 	if err != nil {
 		return nil, err
 	}
 	resolvedID := id
-	commitObject, err := repo.gogit.CommitObject(id)
-	if err == nil {
-		id = SHA1(commitObject.TreeHash)
+	if typ, _, err := repo.statObject(id); err == nil && typ == "commit" {
+		commitObject, _, err := repo.readCommitObject(id)
+		if err != nil {
+			return nil, err
+		}
+		id = commitObject.TreeHash
 	}
 	treeObject, err := repo.getTree(id)
 	if err != nil {
@@ -54,46 +75,54 @@ func (repo *Repository) GetTree(idStr string) (*Tree, error) {
 	return treeObject, nil
 }
 
-// CommitTree creates a commit from a given tree id for the user with provided message
-func (repo *Repository) CommitTree(author, committer *Signature, tree *Tree, opts CommitTreeOpts) (SHA1, error) {
-	oid, err := git2go.NewOid(tree.ID.String())
-	if err != nil {
-		return SHA1{}, err
+// CommitTree creates a commit from a given tree id for the user with provided message.
+// The parents must exist, the first one has to be the current commit of the updated reference.
+func (repo *Repository) CommitTree(author, committer *Signature, tree *Tree, opts CommitTreeOpts) (ObjectID, error) {
+	ref := opts.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if opts.Orphan {
+		if len(opts.Parents) > 0 {
+			return nil, errors.New("orphan commit cannot have parents")
+		}
+		if repo.IsReferenceExist(ref) {
+			return nil, fmt.Errorf("unable to create orphan commit: reference %s already exists", ref)
+		}
 	}
 
-	t, err := repo.git2go.LookupTree(oid)
-	if err != nil {
-		return SHA1{}, err
+	// resolve the parents first, a missing parent returns ErrNotExist
+	parentIDs := make([]string, 0, len(opts.Parents))
+	for _, parent := range opts.Parents {
+		id, err := repo.resolveCommitID(parent)
+		if err != nil {
+			return nil, err
+		}
+		parentIDs = append(parentIDs, id)
 	}
 
-	parents := make([]*git2go.Commit, 0, len(opts.Parents))
-	// for i, parent := range opts.Parents {
-	// 	oidf, err := git2go
-	// 	parents[i] =
-	// }
+	if !opts.AllowEmpty && len(parentIDs) == 1 {
+		parent, err := repo.GetCommit(parentIDs[0])
+		if err != nil {
+			return nil, err
+		}
+		if parent.Tree.ID == tree.ID {
+			return nil, ErrEmptyCommit
+		}
+	}
 
-	oid, err = repo.git2go.CreateCommit("HEAD",
-		&git2go.Signature{
-			Name:  author.Name,
-			Email: author.Email,
-			When:  author.When,
-		}, &git2go.Signature{
-			Name:  committer.Name,
-			Email: committer.Email,
-			When:  committer.When,
-		},
-		opts.Message,
-		t,
-		parents...,
-	)
-	if err != nil {
-		return SHA1{}, err
+	if repo.useGit2Go(OperationCommitTree) {
+		return repo.commitTreeWithGit2Go(ref, author, committer, tree, parentIDs, opts)
 	}
-	sha1, err := NewIDFromString(oid.String())
+	opts.Parents = parentIDs
+	id, err := repo.commitTreeID(author, committer, tree.ID.String(), opts)
 	if err != nil {
-		return SHA1{}, err
+		return nil, err
+	}
+	if err := repo.updateCommitRef(ref, id, parentIDs, opts.Message); err != nil {
+		return nil, err
 	}
-	return sha1, nil
+	return id, nil
 
 	// commitTimeStr := time.Now().Format(time.RFC3339)
 
@@ -134,11 +163,102 @@ func (repo *Repository) CommitTree(author, committer *Signature, tree *Tree, opt
 	// 	Stderr: stderr,
 	// })
 	// if err != nil {
-	// 	return SHA1{}, ConcatenateError(err, stderr.String())
+	// 	return nil, ConcatenateError(err, stderr.String())
 	// }
 	// return NewIDFromString(strings.TrimSpace(stdout.String()))
 }
 
+// updateCommitRef moves ref to the new commit, which must still point to its first parent
+func (repo *Repository) updateCommitRef(ref string, id ObjectID, parentIDs []string, message string) error {
+	oldID := repo.ObjectFormat().EmptyObjectID().String()
+	if len(parentIDs) > 0 {
+		oldID = parentIDs[0]
+	}
+	return repo.updateRef(ref, id.String(), oldID, "commit: "+strings.SplitN(message, "\n", 2)[0])
+}
+
+// commitTreeID creates a commit of the tree treeID with git commit-tree, without updating any ref.
+// A zero When of author or committer uses the current time. Ref, AllowEmpty and Orphan of opts are ignored.
+func (repo *Repository) commitTreeID(author, committer *Signature, treeID string, opts CommitTreeOpts) (ObjectID, error) {
+	env := append(os.Environ(), SignatureEnv(author, committer)...)
+
+	var signer Signer
+	if opts.sign() {
+		signer = repo.injectedSigner(opts.Signer)
+	}
+
+	cmd := addSigningPrograms(repo.Ctx, NewCommand(repo.Ctx))
+	if opts.SigningFormat != "" {
+		cmd.AddArguments("-c").AddDynamicArguments("gpg.format=" + opts.SigningFormat)
+	}
+	cmd.AddArguments("commit-tree").AddDynamicArguments(treeID)
+	for _, parent := range opts.Parents {
+		cmd.AddArguments("-p").AddDynamicArguments(parent)
+	}
+	switch {
+	case signer != nil || opts.NoGPGSign:
+		// an injected signer signs the unsigned commit afterwards
+		cmd.AddArguments("--no-gpg-sign")
+	case opts.KeyID != "" || opts.AlwaysSign:
+		cmd.AddArguments(CmdArg(fmt.Sprintf("-S%s", opts.KeyID)))
+	}
+
+	stdout, stderr, runErr := cmd.RunStdString(&RunOpts{
+		Env:   env,
+		Dir:   repo.Path,
+		Stdin: strings.NewReader(strings.TrimRight(opts.Message, "\n") + "\n"),
+	})
+	if runErr != nil {
+		return nil, ConcatenateError(runErr, stderr)
+	}
+	id, err := repo.ObjectFormat().NewIDFromString(strings.TrimSpace(stdout))
+	if err != nil || signer == nil {
+		return id, err
+	}
+	return signCommit(repo.Ctx, repo.Path, id, signer)
+}
+
+// signCommit writes a copy of the unsigned commit id with the signature of signer added
+func signCommit(ctx context.Context, repoPath string, id ObjectID, signer Signer) (ObjectID, error) {
+	format, err := ObjectFormatFromID(id.String())
+	if err != nil {
+		return nil, err
+	}
+	content, stderr, runErr := NewCommand(ctx, "cat-file", "commit").AddDynamicArguments(id.String()).RunStdBytes(&RunOpts{Dir: repoPath})
+	if runErr != nil {
+		return nil, ConcatenateError(runErr, string(stderr))
+	}
+	signature, signErr := signer(content)
+	if signErr != nil {
+		return nil, signErr
+	}
+
+	// the signature header is added after the committer, continuation lines start with a space
+	headers, message, _ := bytes.Cut(content, []byte("\n\n"))
+	signed := new(bytes.Buffer)
+	signed.Write(headers)
+	signed.WriteString("\n" + signatureHeader(format) + " ")
+	signed.WriteString(strings.ReplaceAll(strings.TrimRight(signature, "\n"), "\n", "\n "))
+	signed.WriteString("\n\n")
+	signed.Write(message)
+
+	stdout, stderrStr, runErr := NewCommand(ctx, "hash-object", "-t", "commit", "-w", "--stdin").
+		RunStdString(&RunOpts{Dir: repoPath, Stdin: signed})
+	if runErr != nil {
+		return nil, fmt.Errorf("unable to write signed commit: %w", ConcatenateError(runErr, stderrStr))
+	}
+	return NewObjectIDFromString(strings.TrimSpace(stdout))
+}
+
+// signatureHeader returns the commit header holding the signature, git names it after the object format
+// for object formats other than sha1
+func signatureHeader(format ObjectFormat) string {
+	if format == Sha1ObjectFormat {
+		return "gpgsig"
+	}
+	return "gpgsig-" + format.Name()
+}
+
 // LsTree checks if the given filenames are in the tree
 func (repo *Repository) LsTree(ref string, filenames ...string) ([]string, error) {
 	cmd := NewCommand(repo.Ctx, "ls-tree", "-z", "--name-only").
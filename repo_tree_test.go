@@ -0,0 +1,140 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository_CommitTreeValidation(t *testing.T) {
+	repo, err := openRepositoryWithDefaultContext(filepath.Join(testReposDir, "repo1_bare"))
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	sig := &Signature{Name: "Test", Email: "test@example.com"}
+	tree, err := repo.GetTree("master")
+	assert.NoError(t, err)
+
+	_, err = repo.CommitTree(sig, sig, tree, CommitTreeOpts{Parents: []string{"feaf4ba6bc635fec442f46ddd4512416ec43c2c2"}, Message: "empty"})
+	assert.ErrorIs(t, err, ErrEmptyCommit)
+
+	_, err = repo.CommitTree(sig, sig, tree, CommitTreeOpts{Ref: "refs/heads/master", Orphan: true, Message: "orphan"})
+	assert.Error(t, err)
+	_, err = repo.CommitTree(sig, sig, tree, CommitTreeOpts{Ref: "refs/heads/new", Orphan: true, Parents: []string{"feaf4ba6bc635fec442f46ddd4512416ec43c2c2"}, Message: "orphan"})
+	assert.Error(t, err)
+}
+
+func TestRepository_CommitTreeEmpty(t *testing.T) {
+	setBackends(t, BackendCLI, nil)
+
+	clonedPath, err := cloneRepo(t, filepath.Join(testReposDir, "repo1_bare"))
+	assert.NoError(t, err)
+	repo, err := openRepositoryWithDefaultContext(clonedPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	sig := &Signature{Name: "Test", Email: "test@example.com"}
+	tree, err := repo.GetTree("master")
+	assert.NoError(t, err)
+
+	// commits without changes are created with AllowEmpty
+	id, err := repo.CommitTree(sig, sig, tree, CommitTreeOpts{Parents: []string{"master"}, Message: "empty", Ref: "refs/heads/master", NoGPGSign: true, AllowEmpty: true})
+	assert.NoError(t, err)
+	head, err := repo.GetRefCommitID("refs/heads/master")
+	assert.NoError(t, err)
+	assert.Equal(t, id.String(), head)
+}
+
+func TestRepository_CommitTreeUnknownParent(t *testing.T) {
+	repo, err := openRepositoryWithDefaultContext(filepath.Join(testReposDir, "repo1_bare"))
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	sig := &Signature{Name: "Test", Email: "test@example.com"}
+	tree, err := repo.GetTree("master")
+	assert.NoError(t, err)
+
+	_, err = repo.CommitTree(sig, sig, tree, CommitTreeOpts{
+		Parents: []string{"feaf4ba6bc635fec442f46ddd4512416ec43c2c2", "0000000000000000000000000000000000000001"},
+		Message: "merge",
+	})
+	assert.True(t, IsErrNotExist(err))
+}
+
+func TestRepository_CommitTreeSha256(t *testing.T) {
+	repo, err := InitRepository(DefaultContext, t.TempDir(), InitWithBare(true), InitWithObjectFormat("sha256"))
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	blobID, err := repo.HashObject(strings.NewReader("hello sha256\n"))
+	assert.NoError(t, err)
+	assert.Len(t, blobID.String(), 64)
+
+	builder, err := repo.NewTreeBuilder("")
+	assert.NoError(t, err)
+	assert.NoError(t, builder.Insert("dir/file.txt", EntryModeBlob, blobID))
+	tree, err := builder.Write()
+	assert.NoError(t, err)
+
+	sig := &Signature{Name: "Test", Email: "test@example.com", When: time.Unix(1700000000, 0)}
+	id, err := repo.CommitTree(sig, sig, tree, CommitTreeOpts{Ref: "refs/heads/main", Orphan: true, Message: "initial", NoGPGSign: true})
+	assert.NoError(t, err)
+	assert.Len(t, id.String(), 64)
+
+	head, err := repo.GetRefCommitID("refs/heads/main")
+	assert.NoError(t, err)
+	assert.Equal(t, id.String(), head)
+
+	commit, err := repo.GetCommit("main")
+	assert.NoError(t, err)
+	assert.Equal(t, id.String(), commit.ID.String())
+	assert.Equal(t, "initial", strings.TrimSpace(commit.Message()))
+	assert.Equal(t, tree.ID.String(), commit.Tree.ID.String())
+	assert.Empty(t, commit.Parents)
+
+	entry, err := commit.GetTreeEntryByPath("dir/file.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, blobID.String(), entry.ID.String())
+	content, err := entry.Blob().GetBlobContent()
+	assert.NoError(t, err)
+	assert.Equal(t, "hello sha256\n", content)
+
+	entries, err := commit.Tree.ListEntriesRecursiveWithSize()
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, "dir", entries[0].Name())
+		assert.True(t, entries[0].IsDir())
+		assert.Equal(t, "dir/file.txt", entries[1].Name())
+		assert.EqualValues(t, 13, entries[1].Size())
+	}
+
+	childID, err := repo.CommitTree(sig, sig, tree, CommitTreeOpts{Ref: "refs/heads/main", Parents: []string{"main"}, Message: "child", NoGPGSign: true, AllowEmpty: true})
+	assert.NoError(t, err)
+	child, err := repo.GetCommit(childID.String())
+	assert.NoError(t, err)
+	if assert.Len(t, child.Parents, 1) {
+		assert.Equal(t, id.String(), child.Parents[0].String())
+	}
+
+	// the signature header of sha256 commits is gpgsig-sha256
+	signedID, err := repo.CommitTree(sig, sig, tree, CommitTreeOpts{Ref: "refs/heads/main", Parents: []string{"main"}, Message: "signed", AllowEmpty: true,
+		Signer: func(payload []byte) (string, error) {
+			return "-----BEGIN SSH SIGNATURE-----\nc2lnbmF0dXJl\n-----END SSH SIGNATURE-----\n", nil
+		}})
+	assert.NoError(t, err)
+	raw, _, err := NewCommand(DefaultContext, "cat-file", "commit").AddDynamicArguments(signedID.String()).RunStdString(&RunOpts{Dir: repo.Path})
+	assert.NoError(t, err)
+	assert.Contains(t, raw, "\ngpgsig-sha256 -----BEGIN SSH SIGNATURE-----\n")
+	signed, err := repo.GetCommit(signedID.String())
+	assert.NoError(t, err)
+	if assert.NotNil(t, signed.Signature) {
+		assert.NotContains(t, signed.SignaturePayload(), "gpgsig")
+	}
+}
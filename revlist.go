@@ -10,6 +10,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -81,3 +82,105 @@ func BlobsFromRevListObjects(revListReader *io.PipeReader, shasToCheckWriter *io
 		}
 	}
 }
+
+// RevListOrder is the order of the commits listed by RevListIterator
+type RevListOrder string
+
+// RevListOrder possible values
+const (
+	// RevListOrderDefault lists the commits in reverse chronological order
+	RevListOrderDefault    RevListOrder = ""
+	RevListOrderTopo       RevListOrder = "topo"
+	RevListOrderDate       RevListOrder = "date"
+	RevListOrderAuthorDate RevListOrder = "author-date"
+)
+
+// RevListOptions options for RevListIterator
+type RevListOptions struct {
+	// Revisions to list, e.g. "main", "^v1.0" or "v1.0..main"
+	Revisions []string
+	// Paths only lists the commits changing one of the paths
+	Paths []string
+	// Objects also lists the trees and blobs reachable from the commits
+	Objects bool
+	// Boundary also lists the excluded commits at the boundary of the range
+	Boundary    bool
+	Order       RevListOrder
+	Reverse     bool
+	FirstParent bool
+	// Skip the first commits and list at most MaxCount commits, all commits are listed if MaxCount is 0
+	Skip     int
+	MaxCount int
+}
+
+// RevListEntry is an object listed by RevListIterator
+type RevListEntry struct {
+	ID ObjectID
+	// Path of a tree or blob listed with Objects, empty for commits and root trees
+	Path string
+	// Boundary is true for excluded commits listed with Boundary
+	Boundary bool
+}
+
+// RevListIterator calls fn for each object listed by git rev-list while streaming its output.
+// Iteration stops at the first error returned by fn, which is returned by RevListIterator.
+func (repo *Repository) RevListIterator(opts RevListOptions, fn func(*RevListEntry) error) error {
+	cmd := NewCommand(repo.Ctx, "rev-list")
+	if opts.Objects {
+		cmd.AddArguments("--objects")
+	}
+	if opts.Boundary {
+		cmd.AddArguments("--boundary")
+	}
+	switch opts.Order {
+	case RevListOrderDefault:
+	case RevListOrderTopo, RevListOrderDate, RevListOrderAuthorDate:
+		cmd.AddOptionFormat("--%s-order", string(opts.Order))
+	default:
+		return fmt.Errorf("invalid rev-list order: %s", opts.Order)
+	}
+	if opts.Reverse {
+		cmd.AddArguments("--reverse")
+	}
+	if opts.FirstParent {
+		cmd.AddArguments("--first-parent")
+	}
+	if opts.Skip > 0 {
+		cmd.AddArguments(CmdArg("--skip=" + strconv.Itoa(opts.Skip)))
+	}
+	if opts.MaxCount > 0 {
+		cmd.AddArguments(CmdArg("--max-count=" + strconv.Itoa(opts.MaxCount)))
+	}
+	cmd.AddDynamicArguments(opts.Revisions...)
+	cmd.AddDashesAndList(opts.Paths...)
+
+	stdoutReader, err := cmd.RunWithStdoutReader(&RunOpts{Dir: repo.Path})
+	if err != nil {
+		return err
+	}
+	defer stdoutReader.Close()
+
+	scanner := bufio.NewScanner(stdoutReader)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		entry := &RevListEntry{}
+		if line[0] == '-' {
+			entry.Boundary = true
+			line = line[1:]
+		}
+		id, path, _ := strings.Cut(line, " ")
+		sha, err := repo.ObjectFormat().NewIDFromString(id)
+		if err != nil {
+			return fmt.Errorf("invalid rev-list output %q: %w", line, err)
+		}
+		entry.ID = sha
+		entry.Path = path
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
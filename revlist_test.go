@@ -0,0 +1,57 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository_RevListIterator(t *testing.T) {
+	bareRepo1Path := filepath.Join(testReposDir, "repo1_bare")
+	bareRepo1, err := openRepositoryWithDefaultContext(bareRepo1Path)
+	assert.NoError(t, err)
+	defer bareRepo1.Close()
+
+	var entries []RevListEntry
+	collect := func(entry *RevListEntry) error {
+		entries = append(entries, *entry)
+		return nil
+	}
+
+	assert.NoError(t, bareRepo1.RevListIterator(RevListOptions{Revisions: []string{"master..branch1"}, Boundary: true}, collect))
+	assert.Equal(t, []RevListEntry{
+		{ID: MustIDFromString("2839944139e0de9737a044f78b0e4b40d989a9e3")},
+		{ID: MustIDFromString("9c9aef8dd84e02bc7ec12641deb4c930a7c30185")},
+		{ID: MustIDFromString("95bb4d39648ee7e325106df01a621c530863a653"), Boundary: true},
+	}, entries)
+
+	entries = nil
+	assert.NoError(t, bareRepo1.RevListIterator(RevListOptions{Revisions: []string{"master..branch1"}, Objects: true, Reverse: true}, collect))
+	if assert.Len(t, entries, 6) {
+		assert.Equal(t, "9c9aef8dd84e02bc7ec12641deb4c930a7c30185", entries[0].ID.String())
+		assert.Equal(t, "branch1.txt", entries[3].Path)
+		assert.Equal(t, "file1.txt", entries[5].Path)
+	}
+
+	entries = nil
+	assert.NoError(t, bareRepo1.RevListIterator(RevListOptions{Revisions: []string{"branch1"}, Paths: []string{"file1.txt"}, Skip: 1}, collect))
+	assert.Equal(t, []RevListEntry{{ID: MustIDFromString("95bb4d39648ee7e325106df01a621c530863a653")}}, entries)
+
+	errStop := errors.New("stop")
+	count := 0
+	err = bareRepo1.RevListIterator(RevListOptions{Revisions: []string{"master"}, Order: RevListOrderTopo}, func(*RevListEntry) error {
+		count++
+		return errStop
+	})
+	assert.ErrorIs(t, err, errStop)
+	assert.Equal(t, 1, count)
+
+	err = bareRepo1.RevListIterator(RevListOptions{Revisions: []string{"unknown"}}, collect)
+	assert.Error(t, err)
+}
@@ -13,6 +13,8 @@ var (
 	CacheService = struct {
 		Cache struct {
 			TTL time.Duration
+			// Prefix namespaces the cache keys, e.g. "myapp:" for applications sharing a cache server
+			Prefix string
 		}
 		LastCommit struct {
 			Enabled      bool
@@ -42,6 +44,28 @@ var (
 			Default int
 		}
 		LargeObjectThreshold int64
+		CatFileBatch         struct {
+			MaxIdle     int
+			IdleTimeout time.Duration
+			// MaxLifetime recycles the processes once they ran this long, they are kept as long as they are used if zero
+			MaxLifetime time.Duration
+		}
+		// CheckAttribute limits the git check-attr processes of the readers created by NewCheckAttributeReader,
+		// a stopped process is restarted once the reader is used again
+		CheckAttribute struct {
+			IdleTimeout time.Duration
+			// MaxLifetime recycles the processes once they ran this long, they are kept as long as they are used if zero
+			MaxLifetime time.Duration
+		}
+		// Backend forces the implementation of the operations supporting it, e.g. BackendCLI runs everything
+		// with the git binary if gogit misbehaves. Operations not supported by the backend keep their default
+		Backend Backend
+		// Backends selects the implementation per operation, overriding Backend
+		Backends map[Operation]Backend
+		// LockRetry retries ref updates and index writes failing on a lock file held by a concurrent process, disabled if empty
+		LockRetry RetryPolicy
+		// DryRun makes mutating operations like pushes and ref updates only log what they would do and succeed
+		DryRun bool
 	}{}
 	LFS = struct {
 		StartServer bool
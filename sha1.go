@@ -22,7 +22,7 @@ func ComputeBlobHash(content []byte) SHA1 {
 	return plumbing.ComputeHash(plumbing.BlobObject, content)
 }
 
-// EmptySHA defines empty git SHA
+// EmptySHA defines empty git SHA of sha1 repositories, see ObjectFormat.EmptyObjectID
 const EmptySHA = "0000000000000000000000000000000000000000"
 
 // EmptyTreeSHA is the SHA of an empty tree
@@ -31,9 +31,10 @@ const EmptyTreeSHA = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
 // SHAPattern can be used to determine if a string is an valid sha
 var shaPattern = regexp.MustCompile(`^[0-9a-f]{4,40}$`)
 
-// IsValidSHAPattern will check if the provided string matches the SHA Pattern
+// IsValidSHAPattern will check if the provided string matches the SHA Pattern,
+// or is the full ID of a sha256 repository
 func IsValidSHAPattern(sha string) bool {
-	return shaPattern.MatchString(sha)
+	return shaPattern.MatchString(sha) || Sha256ObjectFormat.IsValid(sha)
 }
 
 // MustID always creates a new SHA1 from a [20]byte array with no validation of input.
@@ -52,6 +53,7 @@ func NewID(b []byte) (SHA1, error) {
 }
 
 // MustIDFromString always creates a new sha from a ID with no validation of input.
+// Use MustObjectIDFromString for the IDs of repositories which may use another object format than sha1.
 func MustIDFromString(s string) SHA1 {
 	b, _ := hex.DecodeString(s)
 	return MustID(b)
@@ -5,6 +5,7 @@
 package git
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -16,6 +17,8 @@ func TestIsValidSHAPattern(t *testing.T) {
 	assert.True(t, IsValidSHAPattern("9023902390239023902390239023902390239023"))
 	assert.False(t, IsValidSHAPattern("90239023902390239023902390239023902390239023"))
 	assert.False(t, IsValidSHAPattern("abc"))
+	assert.True(t, IsValidSHAPattern(EmptyTreeSHA256))
+	assert.False(t, IsValidSHAPattern(strings.ToUpper(EmptyTreeSHA256)))
 	assert.False(t, IsValidSHAPattern("123g"))
 	assert.False(t, IsValidSHAPattern("some random text"))
 }
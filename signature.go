@@ -7,6 +7,7 @@ package git
 
 import (
 	"bytes"
+	"fmt"
 	"strconv"
 	"time"
 
@@ -57,3 +58,27 @@ func newSignatureFromCommitline(line []byte) (_ *Signature, err error) {
 	}
 	return sig, nil
 }
+
+// SignatureEnv returns the GIT_AUTHOR_* and GIT_COMMITTER_* environment variables git creates commits with.
+// A nil signature is omitted, and a zero When lets git use the current time.
+func SignatureEnv(author, committer *Signature) []string {
+	env := make([]string, 0, 6)
+	if author != nil {
+		env = append(env, "GIT_AUTHOR_NAME="+author.Name, "GIT_AUTHOR_EMAIL="+author.Email)
+		if !author.When.IsZero() {
+			env = append(env, "GIT_AUTHOR_DATE="+formatSignatureDate(author.When))
+		}
+	}
+	if committer != nil {
+		env = append(env, "GIT_COMMITTER_NAME="+committer.Name, "GIT_COMMITTER_EMAIL="+committer.Email)
+		if !committer.When.IsZero() {
+			env = append(env, "GIT_COMMITTER_DATE="+formatSignatureDate(committer.When))
+		}
+	}
+	return env
+}
+
+// formatSignatureDate formats t in the internal date format of git, which keeps the time zone offset of t
+func formatSignatureDate(t time.Time) string {
+	return fmt.Sprintf("@%d %s", t.Unix(), t.Format("-0700"))
+}
@@ -0,0 +1,32 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignatureEnv(t *testing.T) {
+	author := &Signature{Name: "Author", Email: "author@example.com", When: time.Unix(1378823654, 0).In(time.FixedZone("", 2*60*60))}
+	committer := &Signature{Name: "Committer", Email: "committer@example.com"}
+
+	assert.Equal(t, []string{
+		"GIT_AUTHOR_NAME=Author",
+		"GIT_AUTHOR_EMAIL=author@example.com",
+		"GIT_AUTHOR_DATE=@1378823654 +0200",
+		"GIT_COMMITTER_NAME=Committer",
+		"GIT_COMMITTER_EMAIL=committer@example.com",
+	}, SignatureEnv(author, committer))
+
+	committer.When = time.Unix(1378823654, 0).In(time.FixedZone("IST", -(5*60+30)*60))
+	assert.Equal(t, []string{
+		"GIT_COMMITTER_NAME=Committer",
+		"GIT_COMMITTER_EMAIL=committer@example.com",
+		"GIT_COMMITTER_DATE=@1378823654 -0530",
+	}, SignatureEnv(nil, committer))
+}
@@ -0,0 +1,141 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/enverbisevac/gitlib/process"
+	"github.com/enverbisevac/gitlib/util"
+)
+
+// Signing formats as used by the gpg.format config
+const (
+	SigningFormatOpenPGP = "openpgp"
+	SigningFormatSSH     = "ssh"
+)
+
+// Signer signs the raw payload of a commit or tag and returns the armored signature
+type Signer func(payload []byte) (string, error)
+
+// GPGSigner returns a Signer creating detached signatures with gpg like git does.
+// An empty program uses "gpg", an empty keyID uses the default key of gpg.
+func GPGSigner(ctx context.Context, program, keyID string) Signer {
+	if program == "" {
+		program = "gpg"
+	}
+	return func(payload []byte) (string, error) {
+		args := []string{"--status-fd=2", "-bsa"}
+		if keyID != "" {
+			args = append(args, "-u", keyID)
+		}
+		stdout, stderr, err := process.GetManager().ExecDirEnvStdIn(ctx, -1, "", "gpg sign", nil, bytes.NewReader(payload), program, args...)
+		if err != nil {
+			return "", fmt.Errorf("unable to sign with gpg key %s: %w", keyID, ConcatenateError(err, stderr))
+		}
+		if !strings.Contains(stderr, "[GNUPG:] SIG_CREATED ") {
+			return "", fmt.Errorf("gpg failed to sign with key %s: %s", keyID, stderr)
+		}
+		return stdout, nil
+	}
+}
+
+// SSHSigner returns a Signer creating SSHSIG signatures in the git namespace with ssh-keygen.
+// The key is either the path to a private key or a public key, prefixed with "key::" like
+// in user.signingkey, whose private key is held by the ssh-agent. An empty program uses "ssh-keygen".
+func SSHSigner(ctx context.Context, program, key string) Signer {
+	if program == "" {
+		program = "ssh-keygen"
+	}
+	return func(payload []byte) (string, error) {
+		if key == "" {
+			return "", errors.New("no ssh signing key given")
+		}
+		keyFile := key
+		args := []string{"-Y", "sign", "-n", "git"}
+		if literal := strings.TrimPrefix(key, "key::"); literal != key || strings.HasPrefix(key, "ssh-") {
+			tmp, err := os.CreateTemp("", "signing-key")
+			if err != nil {
+				return "", err
+			}
+			defer func() {
+				_ = util.Remove(tmp.Name())
+			}()
+			if _, err := tmp.WriteString(literal + "\n"); err != nil {
+				tmp.Close()
+				return "", err
+			}
+			if err := tmp.Close(); err != nil {
+				return "", err
+			}
+			keyFile = tmp.Name()
+			args = append(args, "-U")
+		}
+		args = append(args, "-f", keyFile)
+
+		stdout, stderr, err := process.GetManager().ExecDirEnvStdIn(ctx, -1, "", "ssh sign", nil, bytes.NewReader(payload), program, args...)
+		if err != nil {
+			return "", fmt.Errorf("unable to sign with ssh key: %w", ConcatenateError(err, stderr))
+		}
+		return stdout, nil
+	}
+}
+
+// Signer returns the Signer configured for the repository by gpg.format, gpg.program,
+// gpg.ssh.program and user.signingkey. Non-empty format or keyID override the config,
+// the programs of the client the repository was opened with override the configured ones.
+func (repo *Repository) Signer(format, keyID string) (Signer, error) {
+	if format == "" {
+		format = repo.signingConfig("gpg.format")
+	}
+	if keyID == "" {
+		keyID = repo.signingConfig("user.signingkey")
+	}
+	program := clientFromContext(repo.Ctx).signingProgram(format)
+	switch format {
+	case "", SigningFormatOpenPGP:
+		if program == "" {
+			program = repo.signingConfig("gpg.program")
+		}
+		return GPGSigner(repo.Ctx, program, keyID), nil
+	case SigningFormatSSH:
+		if program == "" {
+			program = repo.signingConfig("gpg.ssh.program")
+		}
+		return SSHSigner(repo.Ctx, program, keyID), nil
+	default:
+		return nil, fmt.Errorf("unsupported signing format: %s", format)
+	}
+}
+
+// injectedSigner returns signer, or the Signer of the client the repository was opened with if nil
+func (repo *Repository) injectedSigner(signer Signer) Signer {
+	if signer != nil {
+		return signer
+	}
+	return clientFromContext(repo.Ctx).signer()
+}
+
+// addSigningPrograms makes cmd sign with the programs of the client of ctx instead of the configured ones
+func addSigningPrograms(ctx context.Context, cmd *Command) *Command {
+	client := clientFromContext(ctx)
+	if program := client.signingProgram(SigningFormatOpenPGP); program != "" {
+		cmd.AddArguments("-c").AddDynamicArguments("gpg.program=" + program)
+	}
+	if program := client.signingProgram(SigningFormatSSH); program != "" {
+		cmd.AddArguments("-c").AddDynamicArguments("gpg.ssh.program=" + program)
+	}
+	return cmd
+}
+
+func (repo *Repository) signingConfig(key string) string {
+	value, _, _ := NewCommand(repo.Ctx, "config", "--get").AddDynamicArguments(key).RunStdString(&RunOpts{Dir: repo.Path})
+	return strings.TrimSpace(value)
+}
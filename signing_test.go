@@ -0,0 +1,263 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// generateSSHSigningKey creates an ed25519 key with ssh-keygen and returns the path to the private key
+// and the allowed signers content for email
+func generateSSHSigningKey(t *testing.T, email string) (string, []byte) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not available")
+	}
+	keyPath := filepath.Join(t.TempDir(), "id_ed25519")
+	assert.NoError(t, exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-f", keyPath).Run())
+	publicKey, err := os.ReadFile(keyPath + ".pub")
+	assert.NoError(t, err)
+	return keyPath, []byte(email + " " + strings.TrimSpace(string(publicKey)) + "\n")
+}
+
+func TestSSHSigner(t *testing.T) {
+	keyPath, allowedSigners := generateSSHSigningKey(t, "test@example.com")
+
+	signature, err := SSHSigner(DefaultContext, "", keyPath)([]byte(verifyTestPayload))
+	assert.NoError(t, err)
+	result, err := VerifyCommitSignature(&CommitGPGSignature{Signature: signature, Payload: verifyTestPayload}, "test@example.com", VerifyOptions{AllowedSigners: allowedSigners})
+	assert.NoError(t, err)
+	assert.Equal(t, TrustStatusTrusted, result.Status)
+
+	_, err = SSHSigner(DefaultContext, "", filepath.Join(t.TempDir(), "missing"))([]byte(verifyTestPayload))
+	assert.Error(t, err)
+}
+
+func TestRepository_CommitTreeIDSigned(t *testing.T) {
+	repoPath := filepath.Join(t.TempDir(), "repo.git")
+	assert.NoError(t, Clone(DefaultContext, filepath.Join(testReposDir, "repo1_bare"), repoPath, CloneRepoOptions{Bare: true}))
+	repo, err := openRepositoryWithDefaultContext(repoPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	sig := &Signature{Name: "Test", Email: "test@example.com"}
+	opts := CommitTreeOpts{
+		Parents: []string{"feaf4ba6bc635fec442f46ddd4512416ec43c2c2"},
+		Message: "signed",
+		Signer: func(payload []byte) (string, error) {
+			return "-----BEGIN SSH SIGNATURE-----\nc2lnbmF0dXJl\n-----END SSH SIGNATURE-----\n", nil
+		},
+	}
+	id, err := repo.commitTreeID(sig, sig, "f1a6cb52b2d16773290cefe49ad0684b50a4f930", opts)
+	assert.NoError(t, err)
+	commit, err := repo.GetCommit(id.String())
+	assert.NoError(t, err)
+	if assert.NotNil(t, commit.Signature) {
+		assert.Equal(t, "-----BEGIN SSH SIGNATURE-----\nc2lnbmF0dXJl\n-----END SSH SIGNATURE-----\n", commit.Signature.Signature)
+		assert.NotContains(t, commit.SignaturePayload(), "gpgsig")
+	}
+	assert.Equal(t, "signed\n", commit.CommitMessage)
+
+	keyPath, allowedSigners := generateSSHSigningKey(t, "test@example.com")
+	opts.Signer = SSHSigner(DefaultContext, "", keyPath)
+	id, err = repo.commitTreeID(sig, sig, "f1a6cb52b2d16773290cefe49ad0684b50a4f930", opts)
+	assert.NoError(t, err)
+	commit, err = repo.GetCommit(id.String())
+	assert.NoError(t, err)
+	result, err := commit.VerifySignature(VerifyOptions{AllowedSigners: allowedSigners})
+	assert.NoError(t, err)
+	assert.Equal(t, TrustStatusTrusted, result.Status)
+
+	opts.NoGPGSign = true
+	id, err = repo.commitTreeID(sig, sig, "f1a6cb52b2d16773290cefe49ad0684b50a4f930", opts)
+	assert.NoError(t, err)
+	commit, err = repo.GetCommit(id.String())
+	assert.NoError(t, err)
+	assert.Nil(t, commit.Signature)
+}
+
+func TestCommitChangesSigned(t *testing.T) {
+	keyPath, allowedSigners := generateSSHSigningKey(t, "test@example.com")
+
+	repoPath := t.TempDir()
+	repo, err := InitRepository(DefaultContext, repoPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	committer := &Signature{Name: "Test", Email: "test@example.com"}
+	assert.NoError(t, os.WriteFile(filepath.Join(repoPath, "README.md"), []byte("readme\n"), 0o644))
+	assert.NoError(t, AddChanges(repoPath, true))
+	assert.NoError(t, CommitChanges(repoPath, CommitChangesOptions{
+		Committer:     committer,
+		Message:       "signed",
+		Sign:          true,
+		KeyID:         keyPath,
+		SigningFormat: SigningFormatSSH,
+	}))
+
+	commit, err := repo.GetBranchCommit("main")
+	assert.NoError(t, err)
+	result, err := commit.VerifySignature(VerifyOptions{AllowedSigners: allowedSigners})
+	assert.NoError(t, err)
+	assert.Equal(t, TrustStatusTrusted, result.Status)
+
+	assert.NoError(t, CommitChanges(repoPath, CommitChangesOptions{
+		Committer:  committer,
+		Message:    "injected",
+		AllowEmpty: true,
+		Signer:     SSHSigner(DefaultContext, "", keyPath),
+	}))
+	signed, err := repo.GetBranchCommit("main")
+	assert.NoError(t, err)
+	assert.Equal(t, "injected\n", signed.CommitMessage)
+	parentID, err := signed.ParentID(0)
+	assert.NoError(t, err)
+	assert.Equal(t, commit.ID, parentID)
+	result, err = signed.VerifySignature(VerifyOptions{AllowedSigners: allowedSigners})
+	assert.NoError(t, err)
+	assert.Equal(t, TrustStatusTrusted, result.Status)
+}
+
+func TestClientSigning(t *testing.T) {
+	keyPath, allowedSigners := generateSSHSigningKey(t, "test@example.com")
+	repoPath := filepath.Join(t.TempDir(), "repo.git")
+	assert.NoError(t, Clone(DefaultContext, filepath.Join(testReposDir, "repo1_bare"), repoPath, CloneRepoOptions{Bare: true}))
+
+	// the program of the client is used instead of ssh-keygen
+	program := filepath.Join(t.TempDir(), "sign.sh")
+	assert.NoError(t, os.WriteFile(program, []byte("#!/bin/sh\ntouch \"$0.called\"\nexec ssh-keygen \"$@\"\n"), 0o755))
+	client := &Client{SSHProgram: program}
+	repo, err := client.OpenRepository(DefaultContext, repoPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	sig := &Signature{Name: "Test", Email: "test@example.com"}
+	opts := CommitTreeOpts{
+		Parents:       []string{"feaf4ba6bc635fec442f46ddd4512416ec43c2c2"},
+		Message:       "signed",
+		KeyID:         keyPath,
+		SigningFormat: SigningFormatSSH,
+	}
+	id, err := repo.commitTreeID(sig, sig, "f1a6cb52b2d16773290cefe49ad0684b50a4f930", opts)
+	assert.NoError(t, err)
+	assert.FileExists(t, program+".called")
+	commit, err := repo.GetCommit(id.String())
+	assert.NoError(t, err)
+	result, err := commit.VerifySignature(VerifyOptions{AllowedSigners: allowedSigners})
+	assert.NoError(t, err)
+	assert.Equal(t, TrustStatusTrusted, result.Status)
+
+	// the signer of the client signs when signing is enabled without a signer of its own
+	const signature = "-----BEGIN SSH SIGNATURE-----\nc2lnbmF0dXJl\n-----END SSH SIGNATURE-----\n"
+	client.Signer = func(payload []byte) (string, error) {
+		return signature, nil
+	}
+	id, err = repo.commitTreeID(sig, sig, "f1a6cb52b2d16773290cefe49ad0684b50a4f930", CommitTreeOpts{Message: "signed", AlwaysSign: true})
+	assert.NoError(t, err)
+	commit, err = repo.GetCommit(id.String())
+	assert.NoError(t, err)
+	if assert.NotNil(t, commit.Signature) {
+		assert.Equal(t, signature, commit.Signature.Signature)
+	}
+
+	id, err = repo.commitTreeID(sig, sig, "f1a6cb52b2d16773290cefe49ad0684b50a4f930", CommitTreeOpts{Message: "unsigned"})
+	assert.NoError(t, err)
+	commit, err = repo.GetCommit(id.String())
+	assert.NoError(t, err)
+	assert.Nil(t, commit.Signature)
+
+	assert.NoError(t, repo.CreateAnnotatedTag("v1", "signed", "feaf4ba6bc635fec442f46ddd4512416ec43c2c2", TagWithTagger(sig), TagWithSigning("", "")))
+	tag, err := repo.GetTag("v1")
+	assert.NoError(t, err)
+	if assert.NotNil(t, tag.Signature) {
+		assert.Equal(t, signature, tag.Signature.Signature)
+	}
+}
+
+func TestParseConfigList(t *testing.T) {
+	config := parseConfigList("user.name\nglobal\x00commit.gpgsign\ntrue\x00user.signingkey\nkey1\x00core.bare\x00user.name\nlocal\x00user.signingkey\nkey2\x00")
+	assert.Equal(t, "local", config.get("user.name"))
+	assert.Equal(t, "true", config.get("commit.gpgsign"))
+	assert.Equal(t, []string{"key1", "key2"}, config["user.signingkey"])
+	assert.Equal(t, []string{""}, config["core.bare"])
+	assert.Equal(t, "", config.get("gpg.format"))
+}
+
+func TestRepository_GetDefaultPublicGPGKey(t *testing.T) {
+	repoPath := filepath.Join(t.TempDir(), "repo.git")
+	assert.NoError(t, Clone(DefaultContext, filepath.Join(testReposDir, "repo1_bare"), repoPath, CloneRepoOptions{Bare: true}))
+	repo, err := openRepositoryWithDefaultContext(repoPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	setConfig := func(key, value string) {
+		_, _, err := NewCommand(DefaultContext, "config").AddDynamicArguments(key, value).RunStdString(&RunOpts{Dir: repoPath})
+		assert.NoError(t, err)
+	}
+
+	settings, err := repo.GetDefaultPublicGPGKey(false)
+	assert.NoError(t, err)
+	assert.False(t, settings.Sign)
+
+	keyPath, _ := generateSSHSigningKey(t, "test@example.com")
+	publicKey, err := os.ReadFile(keyPath + ".pub")
+	assert.NoError(t, err)
+	const globalKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIGlobalKeyOfTheInstance"
+
+	_, _, err = NewCommand(DefaultContext, "config", "--global").AddDynamicArguments("user.signingkey", "key::"+globalKey).RunStdString(nil)
+	assert.NoError(t, err)
+	defer func() {
+		_, _, _ = NewCommand(DefaultContext, "config", "--global", "--unset", "user.signingkey").RunStdString(nil)
+	}()
+	setConfig("commit.gpgsign", "true")
+	setConfig("gpg.format", "ssh")
+	setConfig("user.signingkey", keyPath)
+	setConfig("user.name", "Signer")
+
+	// cached until forced
+	settings, err = repo.GetDefaultPublicGPGKey(false)
+	assert.NoError(t, err)
+	assert.False(t, settings.Sign)
+
+	settings, err = repo.GetDefaultPublicGPGKey(true)
+	assert.NoError(t, err)
+	assert.True(t, settings.Sign)
+	assert.Equal(t, SigningFormatSSH, settings.Format)
+	assert.Equal(t, keyPath, settings.KeyID)
+	assert.Equal(t, "Signer", settings.Name)
+
+	content, err := settings.PublicKey()
+	assert.NoError(t, err)
+	assert.Equal(t, strings.TrimSpace(string(publicKey))+"\n", content)
+
+	// copies of the settings share the loaded key
+	copied := *settings
+	copiedContent, err := copied.PublicKey()
+	assert.NoError(t, err)
+	assert.Equal(t, content, copiedContent)
+
+	// the public key is derived from the private key with ssh-keygen
+	assert.NoError(t, os.Remove(keyPath+".pub"))
+	settings, err = repo.GetDefaultPublicGPGKey(true)
+	assert.NoError(t, err)
+	content, err = settings.PublicKey()
+	assert.NoError(t, err)
+	assert.Contains(t, content, strings.Join(strings.Fields(string(publicKey))[:2], " "))
+
+	// the global key is used without a key of the repository
+	_, _, err = NewCommand(DefaultContext, "config", "--unset", "user.signingkey").RunStdString(&RunOpts{Dir: repoPath})
+	assert.NoError(t, err)
+	settings, err = repo.GetDefaultPublicGPGKey(true)
+	assert.NoError(t, err)
+	assert.Equal(t, "key::"+globalKey, settings.KeyID)
+	content, err = settings.PublicKey()
+	assert.NoError(t, err)
+	assert.Equal(t, globalKey+"\n", content)
+}
@@ -6,7 +6,10 @@
 package git
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/url"
 	"path"
@@ -22,6 +25,149 @@ type SubModule struct {
 	URL  string
 }
 
+// ParseGitModules parses the content of a .gitmodules file and returns its submodules keyed by path.
+// Like the SubModules of a commit their Name is the path, sections without path or url are skipped.
+func ParseGitModules(r io.Reader) (map[string]*SubModule, error) {
+	modules := make(map[string]*SubModule)
+	var path, url string
+	flush := func() {
+		if path != "" && url != "" {
+			modules[path] = &SubModule{Name: path, URL: url}
+		}
+		path, url = "", ""
+	}
+
+	scanner := bufio.NewScanner(r)
+	inModule := false
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' {
+			flush()
+			inModule = strings.HasPrefix(line, "[submodule")
+			continue
+		}
+		if !inModule {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "path":
+			path = strings.TrimSpace(value)
+		case "url":
+			url = strings.TrimSpace(value)
+		}
+	}
+	flush()
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read .gitmodules: %w", err)
+	}
+	return modules, nil
+}
+
+// SubmoduleChange is a changed gitlink entry, i.e. a change of the commit a submodule is pinned to
+type SubmoduleChange struct {
+	Path string
+	// OldCommitID is empty if the submodule was added, NewCommitID if it was removed
+	OldCommitID string
+	NewCommitID string
+	// URL is the url of the submodule in the .gitmodules file of the new revision,
+	// or of the old revision if the submodule was removed. It is empty if the submodule is not listed there.
+	URL string
+}
+
+// RefURL guesses and returns the reference URL of the submodule, see SubModuleFile.RefURL
+func (sc *SubmoduleChange) RefURL(urlPrefix, repoFullName, sshDomain string) string {
+	return getRefURL(sc.URL, urlPrefix, repoFullName, sshDomain)
+}
+
+// getSubmodules returns the submodules of the .gitmodules file at the given revision keyed by path,
+// it is empty if the revision has no .gitmodules file.
+func (repo *Repository) getSubmodules(rev string) (map[string]*SubModule, error) {
+	stdout, stderr, err := NewCommand(repo.Ctx, "cat-file", "blob").AddDynamicArguments(rev + ":.gitmodules").RunStdString(&RunOpts{Dir: repo.Path})
+	if err != nil {
+		if strings.Contains(stderr, "does not exist") || errors.Is(err, ErrUnknownRevision) {
+			return map[string]*SubModule{}, nil
+		}
+		return nil, fmt.Errorf("unable to read .gitmodules of %s: %w", rev, ConcatenateError(err, stderr))
+	}
+	return ParseGitModules(strings.NewReader(stdout))
+}
+
+// resolveSubmoduleURLs sets the URL of the changes from the .gitmodules file of head,
+// or of base for removed submodules
+func (repo *Repository) resolveSubmoduleURLs(base, head string, changes []*SubmoduleChange) error {
+	var baseModules, headModules map[string]*SubModule
+	for _, change := range changes {
+		var err error
+		if change.NewCommitID != "" {
+			if headModules == nil {
+				if headModules, err = repo.getSubmodules(head); err != nil {
+					return err
+				}
+			}
+			if module, ok := headModules[change.Path]; ok {
+				change.URL = module.URL
+				continue
+			}
+		}
+		if baseModules == nil {
+			if baseModules, err = repo.getSubmodules(base); err != nil {
+				return err
+			}
+		}
+		if module, ok := baseModules[change.Path]; ok {
+			change.URL = module.URL
+		}
+	}
+	return nil
+}
+
+// GetSubmoduleChanges returns the changed gitlink entries between the given revisions with the URLs of their submodules.
+// An empty base compares head against its first parent, or the empty tree for a root commit.
+func (repo *Repository) GetSubmoduleChanges(base, head string) ([]*SubmoduleChange, error) {
+	base, err := repo.diffBase(base, head)
+	if err != nil {
+		return nil, err
+	}
+	stdout, stderr, runErr := NewCommand(repo.Ctx, "diff", "--raw", "-z", "--no-renames", "--no-abbrev").
+		AddDynamicArguments(base, head).RunStdString(&RunOpts{Dir: repo.Path})
+	if runErr != nil {
+		return nil, fmt.Errorf("unable to get submodule changes between %s and %s: %w", base, head, ConcatenateError(runErr, stderr))
+	}
+
+	var changes []*SubmoduleChange
+	// :<old mode> <new mode> <old id> <new id> <status>\0<path>\0
+	fields := strings.Split(strings.TrimSuffix(stdout, "\x00"), "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		raw := strings.Fields(strings.TrimPrefix(fields[i], ":"))
+		if len(raw) < 5 {
+			return nil, fmt.Errorf("invalid diff output %q", fields[i])
+		}
+		oldIsSubmodule, newIsSubmodule := ToEntryMode(raw[0]) == EntryModeCommit, ToEntryMode(raw[1]) == EntryModeCommit
+		if !oldIsSubmodule && !newIsSubmodule {
+			continue
+		}
+		change := &SubmoduleChange{Path: fields[i+1]}
+		if oldIsSubmodule {
+			change.OldCommitID = raw[2]
+		}
+		if newIsSubmodule {
+			change.NewCommitID = raw[3]
+		}
+		changes = append(changes, change)
+	}
+	if err := repo.resolveSubmoduleURLs(base, head, changes); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
 // SubModuleFile represents a file with submodule type.
 type SubModuleFile struct {
 	*Commit
@@ -5,7 +5,10 @@
 package git
 
 import (
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -41,3 +44,101 @@ func TestGetRefURL(t *testing.T) {
 		assert.EqualValues(t, kase.expect, getRefURL(kase.refURL, kase.prefixURL, kase.parentPath, kase.SSHDomain))
 	}
 }
+
+func TestParseGitModules(t *testing.T) {
+	modules, err := ParseGitModules(strings.NewReader(`# comment
+[submodule "lib"]
+	path = vendor/lib
+	url = https://example.com/lib.git
+[core]
+	url = https://example.com/ignored.git
+[submodule "reversed"]
+	URL = ../reversed.git
+	path = reversed
+[submodule "no-url"]
+	path = no-url
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]*SubModule{
+		"vendor/lib": {Name: "vendor/lib", URL: "https://example.com/lib.git"},
+		"reversed":   {Name: "reversed", URL: "../reversed.git"},
+	}, modules)
+}
+
+func TestRepository_GetSubmoduleChanges(t *testing.T) {
+	repoPath := filepath.Join(t.TempDir(), "repo.git")
+	assert.NoError(t, Clone(DefaultContext, filepath.Join(testReposDir, "repo1_bare"), repoPath, CloneRepoOptions{Bare: true}))
+	repo, err := openRepositoryWithDefaultContext(repoPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	sig := &Signature{Name: "Author", Email: "author@example.com", When: time.Now()}
+	commit := func(parent string, fn func(builder *TreeBuilder)) string {
+		builder, err := repo.NewTreeBuilder(parent)
+		assert.NoError(t, err)
+		fn(builder)
+		tree, err := builder.Write()
+		assert.NoError(t, err)
+		id, err := repo.commitTreeID(sig, sig, tree.ID.String(), CommitTreeOpts{Parents: []string{parent}, Message: "submodule", NoGPGSign: true})
+		assert.NoError(t, err)
+		return id.String()
+	}
+	gitmodules, err := repo.HashObject(strings.NewReader("[submodule \"sub\"]\n\tpath = sub\n\turl = ../sub.git\n"))
+	assert.NoError(t, err)
+
+	added := commit("master", func(builder *TreeBuilder) {
+		assert.NoError(t, builder.Insert(".gitmodules", EntryModeBlob, gitmodules))
+		assert.NoError(t, builder.Insert("sub", EntryModeCommit, MustIDFromString("95bb4d39648ee7e325106df01a621c530863a653")))
+	})
+	updated := commit(added, func(builder *TreeBuilder) {
+		assert.NoError(t, builder.Insert("sub", EntryModeCommit, MustIDFromString("8d92fc957a4d7cfd98bc375f0b7bb189a0d6c9f2")))
+	})
+	removed := commit(updated, func(builder *TreeBuilder) {
+		assert.NoError(t, builder.Remove(".gitmodules"))
+		assert.NoError(t, builder.Remove("sub"))
+	})
+
+	changes, err := repo.GetSubmoduleChanges("", added)
+	assert.NoError(t, err)
+	assert.Equal(t, []*SubmoduleChange{{Path: "sub", NewCommitID: "95bb4d39648ee7e325106df01a621c530863a653", URL: "../sub.git"}}, changes)
+	assert.Equal(t, "https://try.gitea.io/user/sub", changes[0].RefURL("https://try.gitea.io", "user/repo", ""))
+
+	changes, err = repo.GetSubmoduleChanges(added, updated)
+	assert.NoError(t, err)
+	assert.Equal(t, []*SubmoduleChange{{
+		Path:        "sub",
+		OldCommitID: "95bb4d39648ee7e325106df01a621c530863a653",
+		NewCommitID: "8d92fc957a4d7cfd98bc375f0b7bb189a0d6c9f2",
+		URL:         "../sub.git",
+	}}, changes)
+
+	// the url of a removed submodule is taken from the old revision
+	changes, err = repo.GetSubmoduleChanges("", removed)
+	assert.NoError(t, err)
+	assert.Equal(t, []*SubmoduleChange{{Path: "sub", OldCommitID: "8d92fc957a4d7cfd98bc375f0b7bb189a0d6c9f2", URL: "../sub.git"}}, changes)
+
+	changes, err = repo.GetSubmoduleChanges("master", "feaf4ba6bc635fec442f46ddd4512416ec43c2c2")
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+
+	diff, err := repo.GetParsedDiff(added, updated, DiffOptions{})
+	assert.NoError(t, err)
+	if assert.Len(t, diff.Files, 1) {
+		assert.Equal(t, &SubmoduleChange{
+			Path:        "sub",
+			OldCommitID: "95bb4d39648ee7e325106df01a621c530863a653",
+			NewCommitID: "8d92fc957a4d7cfd98bc375f0b7bb189a0d6c9f2",
+			URL:         "../sub.git",
+		}, diff.Files[0].Submodule)
+	}
+
+	diff, err = repo.GetParsedDiff("", removed, DiffOptions{})
+	assert.NoError(t, err)
+	for _, file := range diff.Files {
+		if file.Name == "sub" {
+			assert.Equal(t, &SubmoduleChange{Path: "sub", OldCommitID: "8d92fc957a4d7cfd98bc375f0b7bb189a0d6c9f2", URL: "../sub.git"}, file.Submodule)
+		} else {
+			assert.Nil(t, file.Submodule)
+		}
+	}
+}
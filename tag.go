@@ -15,11 +15,18 @@ const (
 	endpgp   = "\n-----END PGP SIGNATURE-----"
 )
 
+// tagSignatureArmors are the beginnings and ends of the OpenPGP, SSH and X.509 signatures git appends to the message of a tag
+var tagSignatureArmors = [][2]string{
+	{beginpgp, endpgp},
+	{"\n" + sshSignatureArmorStart + "\n", "\n" + sshSignatureArmorEnd},
+	{"\n" + x509SignatureArmorStart + "\n", "\n-----END SIGNED MESSAGE-----"},
+}
+
 // Tag represents a Git tag.
 type Tag struct {
 	Name      string
-	ID        SHA1
-	Object    SHA1 // The id of this commit object
+	ID        ObjectID
+	Object    ObjectID // The id of this commit object
 	Type      string
 	Tagger    *Signature
 	Message   string
@@ -49,7 +56,7 @@ l:
 			reftype := line[:spacepos]
 			switch string(reftype) {
 			case "object":
-				id, err := NewIDFromString(string(line[spacepos+1:]))
+				id, err := NewObjectIDFromString(string(line[spacepos+1:]))
 				if err != nil {
 					return nil, err
 				}
@@ -72,16 +79,26 @@ l:
 			break l
 		}
 	}
-	idx := strings.LastIndex(tag.Message, beginpgp)
-	if idx > 0 {
-		endSigIdx := strings.Index(tag.Message[idx:], endpgp)
+	for _, armor := range tagSignatureArmors {
+		begin, end := armor[0], armor[1]
+		idx := strings.LastIndex(tag.Message, begin)
+		if idx <= 0 {
+			continue
+		}
+		endSigIdx := strings.Index(tag.Message[idx:], end)
 		if endSigIdx > 0 {
+			// the signature ends with a LF like the ones of commits
+			sigEnd := idx + endSigIdx + len(end)
+			if sigEnd < len(tag.Message) && tag.Message[sigEnd] == '\n' {
+				sigEnd++
+			}
 			tag.Signature = &CommitGPGSignature{
-				Signature: tag.Message[idx+1 : idx+endSigIdx+len(endpgp)],
-				Payload:   string(data[:bytes.LastIndex(data, []byte(beginpgp))+1]),
+				Signature: tag.Message[idx+1 : sigEnd],
+				Payload:   string(data[:bytes.LastIndex(data, []byte(begin))+1]),
 			}
 			tag.Message = tag.Message[:idx+1]
 		}
+		break
 	}
 	return tag, nil
 }
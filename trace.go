@@ -0,0 +1,47 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"context"
+	"time"
+)
+
+// Tracer starts a span for every git command run, e.g. by adapting an OpenTelemetry tracer.
+// Tracing is disabled unless a tracer is set with SetTracer or Client.Tracer.
+type Tracer interface {
+	// StartCommand starts the span of a command, the returned context carrying the span is the parent of the command context
+	StartCommand(ctx context.Context, command CommandTrace) (context.Context, CommandSpan)
+}
+
+// CommandSpan is the span of a running git command
+type CommandSpan interface {
+	// End ends the span once the command exited or failed to start
+	End(result CommandResult)
+}
+
+// CommandTrace describes a traced git command
+type CommandTrace struct {
+	// Command is the command line, credentials in urls are removed
+	Command string
+	// Dir is the directory the command runs in, usually the repository path
+	Dir string
+}
+
+// CommandResult is the outcome of a traced git command
+type CommandResult struct {
+	Duration time.Duration
+	// ExitCode is the exit status of git, -1 if it didn't exit, e.g. failed to start or was killed
+	ExitCode int
+	// Err is the error Command.Run returns
+	Err error
+}
+
+var tracer Tracer
+
+// SetTracer sets the tracer of the commands not created within the context of a Client with a Tracer, nil disables tracing
+func SetTracer(t Tracer) {
+	tracer = t
+}
@@ -0,0 +1,159 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Trailer is a key/value line at the end of a commit message, e.g. "Signed-off-by: Name <email>"
+type Trailer struct {
+	Key   string
+	Value string
+}
+
+// String formats the trailer as a line of a commit message
+func (t Trailer) String() string {
+	return t.Key + ": " + t.Value
+}
+
+var trailerPattern = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9-]*)[ \t]*:[ \t]*(.*)$`)
+
+// trailer lines git generates itself, a trailer block containing one of them may also contain other lines
+var gitGeneratedTrailerPrefixes = []string{"Signed-off-by: ", "(cherry picked from commit "}
+
+type trailerLine struct {
+	// raw is the line including its continuation lines
+	raw     string
+	trailer *Trailer
+}
+
+// splitTrailerBlock splits the message into the body and the trailer block, using the rules of
+// git interpret-trailers: the trailer block is the last paragraph of the message, but never the first,
+// and it consists only of trailers, or of at least 25% trailers if it has a line git generates itself.
+func splitTrailerBlock(message string) (string, []*trailerLine) {
+	message = strings.TrimRight(message, " \t\r\n")
+	lines := strings.Split(message, "\n")
+
+	start := -1
+	for i := len(lines) - 1; i >= 0; i-- {
+		if strings.TrimSpace(lines[i]) == "" {
+			start = i + 1
+			break
+		}
+	}
+	if start < 0 || strings.TrimSpace(strings.Join(lines[:start], "")) == "" {
+		return message, nil
+	}
+
+	var block []*trailerLine
+	trailers, others, recognized := 0, 0, false
+	for _, line := range lines[start:] {
+		line = strings.TrimRight(line, "\r")
+		if (line[0] == ' ' || line[0] == '\t') && len(block) > 0 {
+			// continuation of the previous line
+			last := block[len(block)-1]
+			last.raw += "\n" + line
+			if last.trailer != nil {
+				last.trailer.Value = strings.TrimSpace(last.trailer.Value + " " + strings.TrimSpace(line))
+			}
+			continue
+		}
+
+		for _, prefix := range gitGeneratedTrailerPrefixes {
+			if strings.HasPrefix(line, prefix) {
+				recognized = true
+			}
+		}
+		if matches := trailerPattern.FindStringSubmatch(line); matches != nil {
+			block = append(block, &trailerLine{raw: line, trailer: &Trailer{Key: matches[1], Value: strings.TrimSpace(matches[2])}})
+			trailers++
+		} else {
+			block = append(block, &trailerLine{raw: line})
+			if strings.HasPrefix(line, gitGeneratedTrailerPrefixes[1]) {
+				trailers++
+			} else {
+				others++
+			}
+		}
+	}
+	if trailers == 0 || (others > 0 && (!recognized || trailers*3 < others)) {
+		return message, nil
+	}
+	return strings.TrimRight(strings.Join(lines[:start], "\n"), " \t\r\n"), block
+}
+
+// ParseTrailers returns the trailers at the end of the commit message
+func ParseTrailers(message string) []Trailer {
+	_, block := splitTrailerBlock(message)
+	var trailers []Trailer
+	for _, line := range block {
+		if line.trailer != nil {
+			trailers = append(trailers, *line.trailer)
+		}
+	}
+	return trailers
+}
+
+// Trailers returns the trailers of the commit message, like Signed-off-by or Co-authored-by
+func (c *Commit) Trailers() []Trailer {
+	return ParseTrailers(c.CommitMessage)
+}
+
+func joinTrailerBlock(body string, block []*trailerLine) string {
+	lines := make([]string, 0, len(block))
+	for _, line := range block {
+		lines = append(lines, line.raw)
+	}
+	return body + "\n\n" + strings.Join(lines, "\n") + "\n"
+}
+
+// AddTrailers appends the trailers to the trailer block of the message, or adds a trailer block.
+// Trailers which already exist with the same key and value are not added again.
+func AddTrailers(message string, trailers ...Trailer) string {
+	body, block := splitTrailerBlock(message)
+	for _, trailer := range trailers {
+		exists := false
+		for _, line := range block {
+			if line.trailer != nil && strings.EqualFold(line.trailer.Key, trailer.Key) && line.trailer.Value == trailer.Value {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			t := trailer
+			block = append(block, &trailerLine{raw: t.String(), trailer: &t})
+		}
+	}
+	if len(block) == 0 {
+		return message
+	}
+	return joinTrailerBlock(body, block)
+}
+
+// SetTrailer replaces all trailers of the message having the key of trailer with trailer,
+// or appends it if there is no trailer with the key.
+func SetTrailer(message string, trailer Trailer) string {
+	body, block := splitTrailerBlock(message)
+	replaced := false
+	kept := block[:0]
+	for _, line := range block {
+		if line.trailer != nil && strings.EqualFold(line.trailer.Key, trailer.Key) {
+			if replaced {
+				continue
+			}
+			t := trailer
+			line = &trailerLine{raw: t.String(), trailer: &t}
+			replaced = true
+		}
+		kept = append(kept, line)
+	}
+	if !replaced {
+		t := trailer
+		kept = append(kept, &trailerLine{raw: t.String(), trailer: &t})
+	}
+	return joinTrailerBlock(body, kept)
+}
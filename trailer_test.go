@@ -0,0 +1,51 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTrailers(t *testing.T) {
+	for _, c := range []struct {
+		message  string
+		trailers []Trailer
+	}{
+		{"Subject\n\nBody text\n\nSigned-off-by: A <a@example.com>\nsome text\nReviewed-by: B\n  continued\n", []Trailer{
+			{Key: "Signed-off-by", Value: "A <a@example.com>"},
+			{Key: "Reviewed-by", Value: "B continued"},
+		}},
+		{"Subject\n\nCo-authored-by: C <c@example.com>\nChange-Id : I123\n\n", []Trailer{
+			{Key: "Co-authored-by", Value: "C <c@example.com>"},
+			{Key: "Change-Id", Value: "I123"},
+		}},
+		// not all lines are trailers and none is generated by git
+		{"Subject\n\nBody\n\nnot a trailer\nChange-Id: I123\n", nil},
+		// the subject is never a trailer
+		{"Change-Id: I123\n", nil},
+		{"Subject\n\nBody: with colon but a paragraph\nof text", nil},
+	} {
+		assert.Equal(t, c.trailers, ParseTrailers(c.message), c.message)
+	}
+}
+
+func TestAddTrailers(t *testing.T) {
+	assert.Equal(t, "Subject\n\nBody\n\nSigned-off-by: A <a@example.com>\n",
+		AddTrailers("Subject\n\nBody\n", Trailer{Key: "Signed-off-by", Value: "A <a@example.com>"}))
+
+	message := "Subject\n\nSigned-off-by: A <a@example.com>\n"
+	assert.Equal(t, "Subject\n\nSigned-off-by: A <a@example.com>\nCo-authored-by: B <b@example.com>\n",
+		AddTrailers(message, Trailer{Key: "signed-off-by", Value: "A <a@example.com>"}, Trailer{Key: "Co-authored-by", Value: "B <b@example.com>"}))
+
+	assert.Equal(t, "Subject\n", AddTrailers("Subject\n"))
+}
+
+func TestSetTrailer(t *testing.T) {
+	message := "Subject\n\nChange-Id: I1\nSigned-off-by: A <a@example.com>\nChange-Id: I2\n"
+	assert.Equal(t, "Subject\n\nChange-Id: I3\nSigned-off-by: A <a@example.com>\n", SetTrailer(message, Trailer{Key: "Change-Id", Value: "I3"}))
+	assert.Equal(t, "Subject\n\nChange-Id: I1\n", SetTrailer("Subject", Trailer{Key: "Change-Id", Value: "I1"}))
+}
@@ -1,11 +1,11 @@
 package git
 
 import (
-	"io"
 	"path"
 	"strconv"
 	"strings"
 
+	"github.com/enverbisevac/gitlib/log"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/filemode"
 	"github.com/go-git/go-git/v5/plumbing/object"
@@ -42,81 +42,78 @@ func ToEntryMode(value string) EntryMode {
 
 // Tree represents a flat directory listing.
 type Tree struct {
-	ID         SHA1
-	ResolvedID SHA1
+	ID         ObjectID
+	ResolvedID ObjectID
 	repo       *Repository
 
-	gogitTree *object.Tree
+	// entries are decoded from the tree object once it is read
+	entries []TreeEntry
+	loaded  bool
+	// sizes of the blobs of the entries, read together when the first size is needed
+	sizes map[string]int64
 
 	// parent tree
 	ptree *Tree
 }
 
 func (t *Tree) loadTreeObject() error {
-	gogitTree, err := t.repo.gogit.TreeObject(t.ID)
+	entries, err := t.repo.readTreeEntries(t.ID)
 	if err != nil {
 		return err
 	}
 
-	t.gogitTree = gogitTree
+	t.entries = entries
+	t.loaded = true
 	return nil
 }
 
+// entrySize returns the size of the blob of an entry of the tree. The sizes of all blobs of the tree
+// are read with a single cat-file --batch-check session instead of a round trip per entry.
+func (t *Tree) entrySize(id ObjectID) (int64, bool) {
+	if t.sizes == nil {
+		if !t.loaded {
+			if err := t.loadTreeObject(); err != nil {
+				return 0, false
+			}
+		}
+		sizes, err := t.repo.statBlobs(t.entries)
+		if err != nil {
+			log.Error("Unable to read the sizes of the entries of tree %s in %s: %v", t.ID, t.repo.Path, err)
+			return 0, false
+		}
+		t.sizes = sizes
+	}
+	size, ok := t.sizes[id.String()]
+	return size, ok
+}
+
 // ListEntries returns all entries of current tree.
 func (t *Tree) ListEntries() (Entries, error) {
-	if t.gogitTree == nil {
+	if !t.loaded {
 		err := t.loadTreeObject()
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	entries := make([]*TreeEntry, len(t.gogitTree.Entries))
-	for i, entry := range t.gogitTree.Entries {
-		entries[i] = &TreeEntry{
-			ID:    entry.Hash,
-			entry: &t.gogitTree.Entries[i],
-			ptree: t,
-		}
+	entries := make([]*TreeEntry, len(t.entries))
+	for i := range t.entries {
+		entry := t.entries[i]
+		entry.ptree = t
+		entries[i] = &entry
 	}
 
 	return entries, nil
 }
 
-// ListEntriesRecursiveWithSize returns all entries of current tree recursively including all subtrees
+// ListEntriesRecursiveWithSize returns all entries of current tree recursively including all subtrees,
+// each directory is followed by its own entries. The entries and their sizes are listed by a single ls-tree.
 func (t *Tree) ListEntriesRecursiveWithSize() (Entries, error) {
-	if t.gogitTree == nil {
-		err := t.loadTreeObject()
-		if err != nil {
-			return nil, err
-		}
+	stdout, _, runErr := NewCommand(t.repo.Ctx, "ls-tree", "-t", "-r", "-l").AddDynamicArguments(t.ID.String()).RunStdBytes(&RunOpts{Dir: t.repo.Path})
+	if runErr != nil {
+		return nil, runErr
 	}
-
-	var entries []*TreeEntry
-	seen := map[plumbing.Hash]bool{}
-	walker := object.NewTreeWalker(t.gogitTree, true, seen)
-	for {
-		fullName, entry, err := walker.Next()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return nil, err
-		}
-		if seen[entry.Hash] {
-			continue
-		}
-
-		convertedEntry := &TreeEntry{
-			ID:       entry.Hash,
-			entry:    &entry,
-			ptree:    t,
-			fullName: fullName,
-		}
-		entries = append(entries, convertedEntry)
-	}
-
-	return entries, nil
+	return parseTreeEntries(stdout, t)
 }
 
 // ListEntriesRecursiveFast is the alias of ListEntriesRecursiveWithSize for the gogit version
@@ -125,7 +122,7 @@ func (t *Tree) ListEntriesRecursiveFast() (Entries, error) {
 }
 
 // NewTree create a new tree according the repository and tree id
-func NewTree(repo *Repository, id SHA1) *Tree {
+func NewTree(repo *Repository, id ObjectID) *Tree {
 	return &Tree{
 		ID:   id,
 		repo: repo,
@@ -170,7 +167,6 @@ func (t *Tree) GetTreeEntryByPath(relpath string) (*TreeEntry, error) {
 			entry: &object.TreeEntry{
 				Name: "",
 				Mode: filemode.Dir,
-				Hash: t.ID,
 			},
 		}, nil
 	}
@@ -0,0 +1,184 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+type treeBuilderEntry struct {
+	mode EntryMode
+	id   ObjectID
+}
+
+// TreeBuilder builds a tree object from a set of entries without a worktree or index.
+// Paths are relative to the root of the tree and may contain directories, the trees of
+// the directories are created when the tree is written.
+type TreeBuilder struct {
+	repo    *Repository
+	entries map[string]treeBuilderEntry
+}
+
+// NewTreeBuilder creates a TreeBuilder starting with the entries of the tree of treeish,
+// an empty treeish starts with an empty tree.
+func (repo *Repository) NewTreeBuilder(treeish string) (*TreeBuilder, error) {
+	b := &TreeBuilder{
+		repo:    repo,
+		entries: make(map[string]treeBuilderEntry),
+	}
+	if treeish == "" {
+		return b, nil
+	}
+
+	stdout, stderr, err := NewCommand(repo.Ctx, "ls-tree", "-r", "-z", "--full-tree", "--end-of-options").
+		AddDynamicArguments(treeish).RunStdBytes(&RunOpts{Dir: repo.Path})
+	if err != nil {
+		if errors.Is(err, ErrUnknownRevision) {
+			return nil, ErrNotExist{ID: treeish}
+		}
+		return nil, fmt.Errorf("unable to list tree of %s: %w", treeish, ConcatenateError(err, string(stderr)))
+	}
+	for _, line := range bytes.Split(stdout, []byte{0}) {
+		if len(line) == 0 {
+			continue
+		}
+		// <mode> SP <type> SP <sha> TAB <path>
+		info, name, ok := bytes.Cut(line, []byte{'\t'})
+		fields := strings.Fields(string(info))
+		if !ok || len(fields) != 3 {
+			return nil, fmt.Errorf("invalid ls-tree output: %s", line)
+		}
+		id, err := repo.ObjectFormat().NewIDFromString(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid ls-tree output: %w", err)
+		}
+		b.entries[string(name)] = treeBuilderEntry{mode: ToEntryMode(fields[0]), id: id}
+	}
+	return b, nil
+}
+
+func cleanTreePath(treePath string) (string, error) {
+	cleaned := path.Clean(strings.Trim(treePath, "/"))
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("invalid tree path: %q", treePath)
+	}
+	for _, name := range strings.Split(cleaned, "/") {
+		if strings.EqualFold(name, ".git") {
+			return "", fmt.Errorf("invalid tree path: %q", treePath)
+		}
+	}
+	return cleaned, nil
+}
+
+// Insert adds or replaces the entry at treePath. Missing parent directories are created,
+// files in the way of the path and entries below treePath are replaced.
+// The mode must be one of EntryModeBlob, EntryModeExec, EntryModeSymlink or EntryModeCommit.
+func (b *TreeBuilder) Insert(treePath string, mode EntryMode, id ObjectID) error {
+	switch mode {
+	case EntryModeBlob, EntryModeExec, EntryModeSymlink, EntryModeCommit:
+	default:
+		return fmt.Errorf("invalid mode %s for tree entry %s", mode, treePath)
+	}
+	cleaned, err := cleanTreePath(treePath)
+	if err != nil {
+		return err
+	}
+
+	for dir := path.Dir(cleaned); dir != "."; dir = path.Dir(dir) {
+		delete(b.entries, dir)
+	}
+	b.removeDir(cleaned)
+	b.entries[cleaned] = treeBuilderEntry{mode: mode, id: id}
+	return nil
+}
+
+// Remove removes the entry at treePath, if it is a directory all entries below it are removed.
+// It returns ErrNotExist if there is nothing at treePath.
+func (b *TreeBuilder) Remove(treePath string) error {
+	cleaned, err := cleanTreePath(treePath)
+	if err != nil {
+		return err
+	}
+	if _, ok := b.entries[cleaned]; ok {
+		delete(b.entries, cleaned)
+		return nil
+	}
+	if !b.removeDir(cleaned) {
+		return ErrNotExist{RelPath: treePath}
+	}
+	return nil
+}
+
+func (b *TreeBuilder) removeDir(dir string) bool {
+	removed := false
+	for name := range b.entries {
+		if strings.HasPrefix(name, dir+"/") {
+			delete(b.entries, name)
+			removed = true
+		}
+	}
+	return removed
+}
+
+// Write writes the tree objects for all entries and returns the root tree
+func (b *TreeBuilder) Write() (*Tree, error) {
+	children := make(map[string][]string)
+	for name := range b.entries {
+		for {
+			dir := path.Dir(name)
+			if dir == "." {
+				dir = ""
+			}
+			_, seen := children[dir]
+			children[dir] = append(children[dir], name)
+			if seen || dir == "" {
+				break
+			}
+			name = dir
+		}
+	}
+
+	id, err := b.writeTree("", children)
+	if err != nil {
+		return nil, err
+	}
+	return NewTree(b.repo, id), nil
+}
+
+func (b *TreeBuilder) writeTree(dir string, children map[string][]string) (ObjectID, error) {
+	names := children[dir]
+	sort.Strings(names)
+
+	input := new(bytes.Buffer)
+	for _, name := range names {
+		entry, ok := b.entries[name]
+		typ := "blob"
+		if !ok {
+			id, err := b.writeTree(name, children)
+			if err != nil {
+				return nil, err
+			}
+			entry = treeBuilderEntry{mode: EntryModeTree, id: id}
+			typ = "tree"
+		} else if entry.mode == EntryModeCommit {
+			typ = "commit"
+		}
+		fmt.Fprintf(input, "%06o %s %s\t%s\x00", int(entry.mode), typ, entry.id, path.Base(name))
+	}
+
+	stdout, stderr, err := NewCommand(b.repo.Ctx, "mktree", "-z").RunStdString(&RunOpts{
+		Dir:   b.repo.Path,
+		Stdin: input,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to write tree %q: %w", dir, ConcatenateError(err, stderr))
+	}
+	return b.repo.ObjectFormat().NewIDFromString(strings.TrimSpace(stdout))
+}
@@ -0,0 +1,65 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTreeBuilder(t *testing.T) {
+	clonePath, err := cloneRepo(t, filepath.Join(testReposDir, "repo1_bare"))
+	assert.NoError(t, err)
+	repo, err := openRepositoryWithDefaultContext(clonePath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	builder, err := repo.NewTreeBuilder("master")
+	assert.NoError(t, err)
+	tree, err := builder.Write()
+	assert.NoError(t, err)
+	assert.Equal(t, "f1a6cb52b2d16773290cefe49ad0684b50a4f930", tree.ID.String())
+
+	blobID := MustIDFromString("e2129701f1a4d54dc44f03c93bca0a2aec7c5449")
+	assert.NoError(t, builder.Insert("foo/new/deep.txt", EntryModeBlob, blobID))
+	assert.NoError(t, builder.Insert("file2.txt", EntryModeExec, MustIDFromString("6c493ff740f9380390d5c9ddef4af18697ac9375")))
+	// replaces the file with a directory
+	assert.NoError(t, builder.Insert("file1.txt/nested", EntryModeBlob, blobID))
+	assert.NoError(t, builder.Remove("foo/nar"))
+	assert.NoError(t, builder.Remove("foo/broken_link"))
+	assert.True(t, IsErrNotExist(builder.Remove("foo/nar/hello")))
+	assert.Error(t, builder.Insert("../escape", EntryModeBlob, blobID))
+	assert.Error(t, builder.Insert(".git/config", EntryModeBlob, blobID))
+	assert.Error(t, builder.Insert("dir", EntryModeTree, blobID))
+
+	tree, err = builder.Write()
+	assert.NoError(t, err)
+	stdout, _, err := NewCommand(repo.Ctx, "ls-tree", "-r").AddDynamicArguments(tree.ID.String()).RunStdString(&RunOpts{Dir: repo.Path})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"100644 blob e2129701f1a4d54dc44f03c93bca0a2aec7c5449\tfile1.txt/nested",
+		"100755 blob 6c493ff740f9380390d5c9ddef4af18697ac9375\tfile2.txt",
+		"120000 blob 216bf54c2f2e2916b830ebe09e8c58a6ed52d86b\tfoo/bar/link_to_hello",
+		"120000 blob 2e65efe2a145dda7ee51d1741299f848e5bf752e\tfoo/link_short",
+		"100644 blob e2129701f1a4d54dc44f03c93bca0a2aec7c5449\tfoo/new/deep.txt",
+		"120000 blob 643a35374408002fcf2f0e8d42d262a1e0e2f80e\tfoo/outside_repo",
+	}, strings.Split(strings.TrimSpace(stdout), "\n"))
+
+	empty, err := repo.NewTreeBuilder("")
+	assert.NoError(t, err)
+	tree, err = empty.Write()
+	assert.NoError(t, err)
+	assert.Equal(t, EmptyTreeSHA, tree.ID.String())
+
+	assert.NoError(t, empty.Insert("missing.txt", EntryModeBlob, MustIDFromString("0000000000000000000000000000000000000001")))
+	_, err = empty.Write()
+	assert.Error(t, err)
+
+	_, err = repo.NewTreeBuilder("unknown")
+	assert.True(t, IsErrNotExist(err))
+}
@@ -10,14 +10,13 @@ import (
 	"sort"
 	"strings"
 
-	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/filemode"
 	"github.com/go-git/go-git/v5/plumbing/object"
 )
 
 // TreeEntry the leaf in the git tree
 type TreeEntry struct {
-	ID SHA1
+	ID ObjectID
 
 	entry *object.TreeEntry
 	ptree *Tree
@@ -48,13 +47,21 @@ func (te *TreeEntry) Size() int64 {
 		return te.size
 	}
 
-	file, err := te.ptree.gogitTree.TreeEntryFile(te.entry)
-	if err != nil {
+	if te.ptree != nil {
+		if size, ok := te.ptree.entrySize(te.ID); ok {
+			te.sized = true
+			te.size = size
+			return te.size
+		}
+	}
+
+	blob := te.Blob()
+	if blob == nil {
 		return 0
 	}
 
 	te.sized = true
-	te.size = file.Size
+	te.size = blob.Size()
 	return te.size
 }
 
@@ -85,16 +92,12 @@ func (te *TreeEntry) IsExecutable() bool {
 
 // Blob returns the blob object the entry
 func (te *TreeEntry) Blob() *Blob {
-	encodedObj, err := te.ptree.repo.gogit.Storer.EncodedObject(plumbing.AnyObject, te.entry.Hash)
+	blob, err := te.ptree.repo.getBlob(te.ID)
 	if err != nil {
 		return nil
 	}
-
-	return &Blob{
-		ID:   te.entry.Hash,
-		obj:  encodedObj,
-		name: te.Name(),
-	}
+	blob.name = te.Name()
+	return blob
 }
 
 // Type returns the type of the entry (commit, tree, blob)
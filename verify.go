@@ -0,0 +1,576 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"golang.org/x/crypto/ssh"
+)
+
+// SignatureType represents the kind of a commit or tag signature
+type SignatureType string
+
+// SignatureType possible values
+const (
+	SignatureTypeGPG SignatureType = "gpg"
+	SignatureTypeSSH SignatureType = "ssh"
+	// SignatureTypeX509 are S/MIME signatures, e.g. of gpgsm, the sigstore signatures of gitsign can't be verified
+	SignatureTypeX509 SignatureType = "x509"
+)
+
+// TrustStatus represents the result of a signature verification
+type TrustStatus string
+
+// TrustStatus possible values
+const (
+	// TrustStatusTrusted is a valid signature of a known key whose identity matches the committer
+	TrustStatusTrusted TrustStatus = "trusted"
+	// TrustStatusUnmatched is a valid signature of a known key whose identity does not match the committer
+	TrustStatusUnmatched TrustStatus = "unmatched"
+	// TrustStatusUnknownKey is a signature made by a key which is not in the keyring or allowed signers,
+	// or by a certificate which is not issued by a trusted root
+	TrustStatusUnknownKey TrustStatus = "unknown_key"
+	// TrustStatusInvalid is a malformed signature or one which does not match the payload
+	TrustStatusInvalid TrustStatus = "invalid"
+	// TrustStatusExpired is a signature of a key which expired, or a signature which expired itself
+	TrustStatusExpired TrustStatus = "expired"
+	// TrustStatusRevoked is a signature of a key, or of an identity, which was revoked
+	TrustStatusRevoked TrustStatus = "revoked"
+	// TrustStatusUnsigned means there is no signature
+	TrustStatusUnsigned TrustStatus = "unsigned"
+	// TrustStatusNotFound means there is no commit to verify, see Repository.GetCommitsVerificationStatus
+	TrustStatusNotFound TrustStatus = "not_found"
+)
+
+// SignatureVerification represents the result of verifying a commit or tag signature, see VerifyCommitSignature
+type SignatureVerification struct {
+	Type   SignatureType
+	Status TrustStatus
+	// Signer is the identity of the key, the user id for GPG keys, the principal for SSH keys
+	// and the email, or else the URI, of X.509 certificates
+	Signer string
+	// Fingerprint is the SHA256 fingerprint of the certificate for X.509 signatures
+	Fingerprint string
+	// KeyID is the ID of the key which made a GPG signature as 16 hex digits, also if the key is unknown
+	KeyID string
+	// SignedAt is the time the signature claims to be made at, the committer or tagger time for SSH signatures
+	SignedAt time.Time
+	// VerifiedAt is the time the signature, and the validity of its key, was checked at
+	VerifiedAt time.Time
+	// Certificate are the identity claims of the certificate of X.509 signatures
+	Certificate *CertificateIdentity
+	// Reason describes why the signature could not be verified
+	Reason string
+}
+
+// Verified returns true if the signature was made by a known key, regardless of its identity
+func (v *SignatureVerification) Verified() bool {
+	return v.Status == TrustStatusTrusted || v.Status == TrustStatusUnmatched
+}
+
+// VerifyOptions contains the keys signatures are verified against
+type VerifyOptions struct {
+	// GPGKeyRing contains armored or binary OpenPGP public keys
+	GPGKeyRing []byte
+	// GPGKeys are parsed OpenPGP public keys, they are used together with the ones of GPGKeyRing
+	GPGKeys openpgp.EntityList
+	// AllowedSigners is the content of an allowed_signers file as described in ssh-keygen(1)
+	AllowedSigners []byte
+	// X509Roots are the certificate authorities X.509 signatures are trusted for, the signing certificate has to be valid now
+	X509Roots *x509.CertPool
+}
+
+const (
+	sshSignatureArmorStart = "-----BEGIN SSH SIGNATURE-----"
+	sshSignatureArmorEnd   = "-----END SSH SIGNATURE-----"
+	sshSignatureMagic      = "SSHSIG"
+	sshSignatureNamespace  = "git"
+)
+
+// VerifyCommitSignature verifies the signature of a commit or tag, the signer is trusted if one of its identities matches email.
+// It is the entry point for all signature types. An error is only returned if the keys in opts can not be parsed.
+func VerifyCommitSignature(sig *CommitGPGSignature, email string, opts VerifyOptions) (*SignatureVerification, error) {
+	keys, err := opts.parse()
+	if err != nil {
+		return nil, err
+	}
+	return keys.verify(sig, email), nil
+}
+
+// verifyKeys are the keys of VerifyOptions parsed once to verify many signatures
+type verifyKeys struct {
+	gpg            openpgp.EntityList
+	allowedSigners []*allowedSigner
+	x509Roots      *x509.CertPool
+}
+
+// parse parses the GPG key ring and the allowed signers
+func (opts VerifyOptions) parse() (*verifyKeys, error) {
+	keys := &verifyKeys{gpg: opts.GPGKeys, x509Roots: opts.X509Roots}
+	if keyRing := opts.GPGKeyRing; len(keyRing) > 0 {
+		var (
+			ringKeys openpgp.EntityList
+			err      error
+		)
+		if bytes.Contains(keyRing, []byte("-----BEGIN PGP")) {
+			ringKeys, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(keyRing))
+		} else {
+			ringKeys, err = openpgp.ReadKeyRing(bytes.NewReader(keyRing))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read gpg key ring: %w", err)
+		}
+		keys.gpg = append(append(openpgp.EntityList{}, keys.gpg...), ringKeys...)
+	}
+	var err error
+	if keys.allowedSigners, err = parseAllowedSigners(opts.AllowedSigners); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// verify verifies the signature with the keys of its type, see VerifyCommitSignature
+func (keys *verifyKeys) verify(sig *CommitGPGSignature, email string) *SignatureVerification {
+	if sig == nil || sig.Signature == "" {
+		return &SignatureVerification{Status: TrustStatusUnsigned}
+	}
+	if strings.HasPrefix(strings.TrimSpace(sig.Signature), sshSignatureArmorStart) {
+		return verifySSHSignature(sig, email, keys.allowedSigners)
+	}
+	if strings.HasPrefix(strings.TrimSpace(sig.Signature), x509SignatureArmorStart) {
+		return verifyX509Signature(sig, email, keys.x509Roots)
+	}
+	return checkGPGSignature(sig.Payload, sig.Signature, email, keys.gpg)
+}
+
+// VerifySignature verifies the signature of the commit against the committer
+func (c *Commit) VerifySignature(opts VerifyOptions) (*SignatureVerification, error) {
+	return VerifyCommitSignature(c.signature(), c.committerEmail(), opts)
+}
+
+func (c *Commit) committerEmail() string {
+	if c.Committer == nil {
+		return ""
+	}
+	return c.Committer.Email
+}
+
+// VerifySignature verifies the signature of the tag against the tagger
+func (tag *Tag) VerifySignature(opts VerifyOptions) (*SignatureVerification, error) {
+	var email string
+	if tag.Tagger != nil {
+		email = tag.Tagger.Email
+	}
+	return VerifyCommitSignature(tag.Signature, email, opts)
+}
+
+// VerifySignature verifies the armored detached OpenPGP signature of payload, like the ones of commits and tags,
+// against keyring regardless of the identities of the signer. A valid signature has the status TrustStatusUnmatched,
+// KeyID and SignedAt are read from the signature and also set if it fails to verify.
+func VerifySignature(payload, signature string, keyring openpgp.EntityList) *SignatureVerification {
+	return checkGPGSignature(payload, signature, "", keyring)
+}
+
+// Verify verifies the GPG signature of the commit against keyring regardless of the committer, see VerifySignature
+func (c *Commit) Verify(keyring openpgp.EntityList) *SignatureVerification {
+	sig := c.signature()
+	if sig == nil {
+		return VerifySignature("", "", keyring)
+	}
+	return VerifySignature(sig.Payload, sig.Signature, keyring)
+}
+
+// checkGPGSignature verifies an armored detached OpenPGP signature of payload against keyring,
+// the signer is trusted if one of its identities matches email
+func checkGPGSignature(payload, signature, email string, keyring openpgp.EntityList) *SignatureVerification {
+	result := &SignatureVerification{Type: SignatureTypeGPG, VerifiedAt: time.Now()}
+	if signature == "" {
+		result.Status = TrustStatusUnsigned
+		return result
+	}
+	fail := func(status TrustStatus, err error) *SignatureVerification {
+		result.Status, result.Reason = status, err.Error()
+		return result
+	}
+
+	block, err := armor.Decode(strings.NewReader(signature))
+	if err != nil {
+		return fail(TrustStatusInvalid, fmt.Errorf("invalid gpg signature armor: %w", err))
+	}
+	if block.Type != openpgp.SignatureType {
+		return fail(TrustStatusInvalid, fmt.Errorf("unexpected gpg armor type %q", block.Type))
+	}
+	body, err := io.ReadAll(block.Body)
+	if err != nil {
+		return fail(TrustStatusInvalid, fmt.Errorf("invalid gpg signature armor: %w", err))
+	}
+	// read the key ID and time from the signature itself, they are unknown if the verification fails
+	if p, err := packet.Read(bytes.NewReader(body)); err == nil {
+		if sig, ok := p.(*packet.Signature); ok {
+			result.SignedAt = sig.CreationTime
+			if sig.IssuerKeyId != nil {
+				result.KeyID = fmt.Sprintf("%016X", *sig.IssuerKeyId)
+			}
+		}
+	}
+
+	config := &packet.Config{Time: func() time.Time { return result.VerifiedAt }}
+	_, signer, err := openpgp.VerifyDetachedSignature(keyring, strings.NewReader(payload), bytes.NewReader(body), config)
+	switch {
+	case err == nil:
+		result.Status = TrustStatusUnmatched
+	case errors.Is(err, pgperrors.ErrUnknownIssuer):
+		result.Status = TrustStatusUnknownKey
+	case errors.Is(err, pgperrors.ErrKeyExpired), errors.Is(err, pgperrors.ErrSignatureExpired):
+		result.Status = TrustStatusExpired
+	case errors.Is(err, pgperrors.ErrKeyRevoked):
+		result.Status = TrustStatusRevoked
+	default:
+		result.Status = TrustStatusInvalid
+	}
+	if err != nil {
+		result.Reason = err.Error()
+	}
+	if signer == nil {
+		return result
+	}
+
+	result.Fingerprint = fmt.Sprintf("%X", signer.PrimaryKey.Fingerprint)
+	for _, identity := range signer.Identities {
+		if result.Signer == "" || (identity.SelfSignature != nil && identity.SelfSignature.IsPrimaryId != nil && *identity.SelfSignature.IsPrimaryId) {
+			result.Signer = identity.Name
+		}
+		if email != "" && identity.UserId != nil && strings.EqualFold(identity.UserId.Email, email) {
+			result.Signer = identity.Name
+			if result.Verified() {
+				result.Status = TrustStatusTrusted
+			}
+			break
+		}
+	}
+	return result
+}
+
+// allowedSigner is an entry of an allowed_signers file
+type allowedSigner struct {
+	principals []string
+	key        ssh.PublicKey
+	// validAfter and validBefore limit when the key signed, they are zero if not restricted
+	validAfter  time.Time
+	validBefore time.Time
+}
+
+// validAt reports whether the key of the signer was valid at signing time t
+func (s *allowedSigner) validAt(t time.Time) bool {
+	return (s.validAfter.IsZero() || !t.Before(s.validAfter)) && (s.validBefore.IsZero() || t.Before(s.validBefore))
+}
+
+// matches reports whether email matches the principals, a pattern-list as described in ssh_config(5)
+// whose negated patterns exclude what they match
+func (s *allowedSigner) matches(email string) bool {
+	if email == "" {
+		return false
+	}
+	matched := false
+	for _, principal := range s.principals {
+		negated := strings.HasPrefix(principal, "!")
+		if ok, _ := path.Match(strings.TrimPrefix(principal, "!"), email); !ok {
+			continue
+		}
+		if negated {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+// parseAllowedSigners parses lines of "principals [options] keytype base64-key [comment]",
+// entries restricted to namespaces other than git are skipped
+func parseAllowedSigners(content []byte) ([]*allowedSigner, error) {
+	var signers []*allowedSigner
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		principals, rest, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("invalid allowed signers line %d", lineNum)
+		}
+		key, _, options, _, err := ssh.ParseAuthorizedKey([]byte(rest))
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed signers line %d: %w", lineNum, err)
+		}
+		if !allowsNamespace(options, sshSignatureNamespace) {
+			continue
+		}
+		signer := &allowedSigner{
+			principals: strings.Split(principals, ","),
+			key:        key,
+		}
+		for _, option := range options {
+			name, value, _ := strings.Cut(option, "=")
+			var validity *time.Time
+			switch strings.ToLower(name) {
+			case "valid-after":
+				validity = &signer.validAfter
+			case "valid-before":
+				validity = &signer.validBefore
+			default:
+				continue
+			}
+			if *validity, err = parseAllowedSignerTime(strings.Trim(value, `"`)); err != nil {
+				return nil, fmt.Errorf("invalid allowed signers line %d: %w", lineNum, err)
+			}
+		}
+		signers = append(signers, signer)
+	}
+	return signers, scanner.Err()
+}
+
+// parseAllowedSignerTime parses the YYYYMMDD[HHMM[SS]] times of the valid-after and valid-before options,
+// they are in local time unless suffixed by Z
+func parseAllowedSignerTime(value string) (time.Time, error) {
+	location := time.Local
+	if strings.HasSuffix(value, "Z") {
+		value, location = value[:len(value)-1], time.UTC
+	}
+	layout := map[int]string{8: "20060102", 12: "200601021504", 14: "20060102150405"}[len(value)]
+	if layout == "" {
+		return time.Time{}, fmt.Errorf("invalid time %q", value)
+	}
+	return time.ParseInLocation(layout, value, location)
+}
+
+// signingTime returns the time of the committer or tagger of the payload, which git verifies the key validity at,
+// or the current time if the payload has none
+func signingTime(payload string) time.Time {
+	for _, line := range strings.Split(payload, "\n") {
+		if line == "" {
+			break
+		}
+		if !strings.HasPrefix(line, "committer ") && !strings.HasPrefix(line, "tagger ") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			break
+		}
+		if seconds, err := strconv.ParseInt(fields[len(fields)-2], 10, 64); err == nil {
+			return time.Unix(seconds, 0)
+		}
+		break
+	}
+	return time.Now()
+}
+
+func allowsNamespace(options []string, namespace string) bool {
+	for _, option := range options {
+		if strings.HasPrefix(option, "namespaces=") {
+			value := option[len("namespaces="):]
+			for _, ns := range strings.Split(strings.Trim(value, `"`), ",") {
+				if matched, _ := path.Match(ns, namespace); matched {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return true
+}
+
+func verifySSHSignature(sig *CommitGPGSignature, email string, signers []*allowedSigner) *SignatureVerification {
+	result := &SignatureVerification{Type: SignatureTypeSSH, VerifiedAt: time.Now()}
+
+	key, err := checkSSHSignature(sig)
+	if err != nil {
+		result.Status = TrustStatusInvalid
+		result.Reason = err.Error()
+		return result
+	}
+	result.Fingerprint = ssh.FingerprintSHA256(key)
+
+	result.Status = TrustStatusUnknownKey
+	result.Reason = "key is not in the allowed signers"
+	signedAt := signingTime(sig.Payload)
+	result.SignedAt = signedAt
+	for _, signer := range signers {
+		if !bytes.Equal(signer.key.Marshal(), key.Marshal()) {
+			continue
+		}
+		if !signer.validAt(signedAt) {
+			result.Reason = "key is not valid at " + signedAt.UTC().Format(time.RFC3339)
+			continue
+		}
+		if result.Signer == "" {
+			result.Signer = signer.principals[0]
+			result.Status = TrustStatusUnmatched
+			result.Reason = ""
+		}
+		if signer.matches(email) {
+			result.Signer = email
+			result.Status = TrustStatusTrusted
+			return result
+		}
+	}
+	return result
+}
+
+// checkSSHSignature verifies an armored SSHSIG signature of the payload and returns the key which made it
+func checkSSHSignature(sig *CommitGPGSignature) (ssh.PublicKey, error) {
+	armored := strings.TrimSpace(sig.Signature)
+	armored = strings.TrimPrefix(armored, sshSignatureArmorStart)
+	armored = strings.TrimSuffix(armored, sshSignatureArmorEnd)
+	blob, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(armored), ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ssh signature encoding: %w", err)
+	}
+	if !bytes.HasPrefix(blob, []byte(sshSignatureMagic)) {
+		return nil, errors.New("invalid ssh signature preamble")
+	}
+
+	var envelope struct {
+		Version       uint32
+		PublicKey     []byte
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Signature     []byte
+	}
+	if err := ssh.Unmarshal(blob[len(sshSignatureMagic):], &envelope); err != nil {
+		return nil, fmt.Errorf("invalid ssh signature: %w", err)
+	}
+	if envelope.Version != 1 {
+		return nil, fmt.Errorf("unsupported ssh signature version %d", envelope.Version)
+	}
+	if envelope.Namespace != sshSignatureNamespace {
+		return nil, fmt.Errorf("unexpected ssh signature namespace %q", envelope.Namespace)
+	}
+
+	key, err := ssh.ParsePublicKey(envelope.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ssh signature key: %w", err)
+	}
+	signature := &ssh.Signature{}
+	if err := ssh.Unmarshal(envelope.Signature, signature); err != nil {
+		return nil, fmt.Errorf("invalid ssh signature: %w", err)
+	}
+
+	var h hash.Hash
+	switch envelope.HashAlgorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return nil, fmt.Errorf("unsupported ssh signature hash algorithm %q", envelope.HashAlgorithm)
+	}
+	_, _ = h.Write([]byte(sig.Payload))
+
+	signed := append([]byte(sshSignatureMagic), ssh.Marshal(struct {
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          []byte
+	}{envelope.Namespace, envelope.Reserved, envelope.HashAlgorithm, h.Sum(nil)})...)
+	if err := key.Verify(signed, signature); err != nil {
+		return nil, fmt.Errorf("ssh signature does not match: %w", err)
+	}
+	return key, nil
+}
+
+// GetTagSignatureStatus verifies the signature of the annotated tag name against its tagger.
+// Lightweight tags have no signature of their own and are reported as unsigned.
+func (repo *Repository) GetTagSignatureStatus(name string, opts VerifyOptions) (*SignatureVerification, error) {
+	tag, err := repo.GetTag(name)
+	if err != nil {
+		return nil, err
+	}
+	return tag.VerifySignature(opts)
+}
+
+// GetCommitsVerificationStatus verifies the signatures of many commits against their committers,
+// reading all of them in one cat-file --batch pass. The results are keyed by the given ids,
+// ids which do not name a commit have the status TrustStatusNotFound.
+func (repo *Repository) GetCommitsVerificationStatus(ids []string, opts VerifyOptions) (map[string]*SignatureVerification, error) {
+	results := make(map[string]*SignatureVerification, len(ids))
+	if len(ids) == 0 {
+		return results, nil
+	}
+	keys, err := opts.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	batchWriter, batchReader, cancel, err := repo.CatFileBatch(repo.Ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	for _, id := range ids {
+		if _, ok := results[id]; ok {
+			continue
+		}
+		// an empty id or one spanning lines would break the batch protocol
+		if id == "" || strings.ContainsAny(id, "\r\n") {
+			results[id] = &SignatureVerification{Status: TrustStatusNotFound}
+			continue
+		}
+		if _, err := batchWriter.Write([]byte(id + "\n")); err != nil {
+			return nil, err
+		}
+		sha, typ, size, err := ReadBatchLine(batchReader)
+		if err != nil {
+			if IsErrNotExist(err) {
+				results[id] = &SignatureVerification{Status: TrustStatusNotFound, Reason: "no such commit"}
+				continue
+			}
+			return nil, err
+		}
+		if typ != "commit" {
+			if _, err := batchReader.Discard(int(size) + 1); err != nil {
+				return nil, err
+			}
+			results[id] = &SignatureVerification{Status: TrustStatusNotFound, Reason: "not a commit but a " + typ}
+			continue
+		}
+
+		commitID, err := repo.ObjectFormat().NewIDFromString(string(sha))
+		if err != nil {
+			return nil, err
+		}
+		commit, err := CommitFromReader(repo, commitID, io.LimitReader(batchReader, size))
+		if err != nil {
+			return nil, err
+		}
+		// the object is followed by a LF
+		if _, err := batchReader.Discard(1); err != nil {
+			return nil, err
+		}
+		results[id] = keys.verify(commit.signature(), commit.committerEmail())
+	}
+	return results, nil
+}
@@ -0,0 +1,392 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+const verifyTestPayload = "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\nauthor A <a@example.com> 1 +0000\ncommitter A <a@example.com> 1 +0000\n\nsigned\n"
+
+func TestVerifyGPGSignature(t *testing.T) {
+	entity, err := openpgp.NewEntity("Alice", "", "alice@example.com", nil)
+	assert.NoError(t, err)
+	other, err := openpgp.NewEntity("Bob", "", "bob@example.com", nil)
+	assert.NoError(t, err)
+
+	signature := new(strings.Builder)
+	assert.NoError(t, openpgp.ArmoredDetachSign(signature, entity, strings.NewReader(verifyTestPayload), nil))
+	sig := &CommitGPGSignature{Signature: signature.String(), Payload: verifyTestPayload}
+
+	keyRing := new(bytes.Buffer)
+	w, err := armor.Encode(keyRing, openpgp.PublicKeyType, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, entity.Serialize(w))
+	assert.NoError(t, w.Close())
+	opts := VerifyOptions{GPGKeyRing: keyRing.Bytes()}
+
+	commit := &Commit{Committer: &Signature{Email: "alice@example.com"}, Signature: sig}
+	result, err := commit.VerifySignature(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, SignatureTypeGPG, result.Type)
+	assert.Equal(t, TrustStatusTrusted, result.Status)
+	assert.True(t, result.Verified())
+	assert.Equal(t, "Alice <alice@example.com>", result.Signer)
+	assert.Len(t, result.Fingerprint, 40)
+
+	result, err = VerifyCommitSignature(sig, "mallory@example.com", opts)
+	assert.NoError(t, err)
+	assert.Equal(t, TrustStatusUnmatched, result.Status)
+	assert.True(t, result.Verified())
+
+	result, err = VerifyCommitSignature(&CommitGPGSignature{Signature: sig.Signature, Payload: verifyTestPayload + "x"}, "alice@example.com", opts)
+	assert.NoError(t, err)
+	assert.Equal(t, TrustStatusInvalid, result.Status)
+	assert.False(t, result.Verified())
+
+	otherKeyRing := new(bytes.Buffer)
+	assert.NoError(t, other.Serialize(otherKeyRing))
+	result, err = VerifyCommitSignature(sig, "alice@example.com", VerifyOptions{GPGKeyRing: otherKeyRing.Bytes()})
+	assert.NoError(t, err)
+	assert.Equal(t, TrustStatusUnknownKey, result.Status)
+
+	_, err = VerifyCommitSignature(sig, "alice@example.com", VerifyOptions{GPGKeyRing: []byte("-----BEGIN PGP PUBLIC KEY BLOCK-----\ngarbage")})
+	assert.Error(t, err)
+}
+
+// signSSH creates an armored SSHSIG signature of the payload in the git namespace
+func signSSH(t *testing.T, key ed25519.PrivateKey, payload string) string {
+	signer, err := ssh.NewSignerFromKey(key)
+	assert.NoError(t, err)
+	h := sha512.Sum512([]byte(payload))
+	signed := append([]byte(sshSignatureMagic), ssh.Marshal(struct {
+		Namespace, Reserved, HashAlgorithm string
+		Hash                               []byte
+	}{"git", "", "sha512", h[:]})...)
+	signature, err := signer.Sign(rand.Reader, signed)
+	assert.NoError(t, err)
+
+	blob := append([]byte(sshSignatureMagic), ssh.Marshal(struct {
+		Version                            uint32
+		PublicKey                          []byte
+		Namespace, Reserved, HashAlgorithm string
+		Signature                          []byte
+	}{1, signer.PublicKey().Marshal(), "git", "", "sha512", ssh.Marshal(signature)})...)
+	return sshSignatureArmorStart + "\n" + base64.StdEncoding.EncodeToString(blob) + "\n" + sshSignatureArmorEnd + "\n"
+}
+
+func TestVerifyGPGSignatureWithKeyring(t *testing.T) {
+	entity, err := openpgp.NewEntity("Alice", "", "alice@example.com", nil)
+	assert.NoError(t, err)
+	other, err := openpgp.NewEntity("Bob", "", "bob@example.com", nil)
+	assert.NoError(t, err)
+
+	sign := func(entity *openpgp.Entity, config *packet.Config) string {
+		signature := new(strings.Builder)
+		assert.NoError(t, openpgp.ArmoredDetachSign(signature, entity, strings.NewReader(verifyTestPayload), config))
+		return signature.String()
+	}
+	signature := sign(entity, nil)
+
+	commit := &Commit{Signature: &CommitGPGSignature{Signature: signature, Payload: verifyTestPayload}}
+	result := commit.Verify(openpgp.EntityList{other, entity})
+	assert.True(t, result.Verified())
+	assert.Equal(t, TrustStatusUnmatched, result.Status)
+	assert.Empty(t, result.Reason)
+	assert.Equal(t, "Alice <alice@example.com>", result.Signer)
+	assert.Len(t, result.KeyID, 16)
+	assert.NotEmpty(t, openpgp.EntityList{entity}.KeysById(parseKeyID(t, result.KeyID)))
+	assert.WithinDuration(t, time.Now(), result.SignedAt, time.Minute)
+	assert.False(t, result.VerifiedAt.Before(result.SignedAt))
+
+	// the committer is trusted with parsed keys
+	commit.Committer = &Signature{Email: "alice@example.com"}
+	verification, err := commit.VerifySignature(VerifyOptions{GPGKeys: openpgp.EntityList{other, entity}})
+	assert.NoError(t, err)
+	assert.Equal(t, TrustStatusTrusted, verification.Status, verification.Reason)
+	assert.Equal(t, "Alice <alice@example.com>", verification.Signer)
+	assert.Equal(t, result.KeyID, verification.KeyID)
+	assert.Equal(t, result.SignedAt, verification.SignedAt)
+
+	result = VerifySignature(verifyTestPayload, signature, openpgp.EntityList{other})
+	assert.Equal(t, TrustStatusUnknownKey, result.Status)
+	assert.False(t, result.Verified())
+	assert.Empty(t, result.Signer)
+	assert.Len(t, result.KeyID, 16)
+
+	result = VerifySignature(verifyTestPayload+"x", signature, openpgp.EntityList{entity})
+	assert.Equal(t, TrustStatusInvalid, result.Status)
+	assert.NotEmpty(t, result.Reason)
+
+	result = (&Commit{}).Verify(openpgp.EntityList{entity})
+	assert.Equal(t, TrustStatusUnsigned, result.Status)
+
+	result = VerifySignature(verifyTestPayload, "-----BEGIN SSH SIGNATURE-----\nc2lnbmF0dXJl\n-----END SSH SIGNATURE-----\n", openpgp.EntityList{entity})
+	assert.Equal(t, TrustStatusInvalid, result.Status)
+
+	// a key which expired after it signed
+	past := &packet.Config{Time: func() time.Time { return time.Now().Add(-time.Hour) }, KeyLifetimeSecs: 60}
+	expiring, err := openpgp.NewEntity("Carol", "", "carol@example.com", past)
+	assert.NoError(t, err)
+	result = VerifySignature(verifyTestPayload, sign(expiring, past), openpgp.EntityList{expiring})
+	assert.Equal(t, TrustStatusExpired, result.Status)
+	assert.Equal(t, "Carol <carol@example.com>", result.Signer)
+
+	revoked, err := openpgp.NewEntity("Dave", "", "dave@example.com", nil)
+	assert.NoError(t, err)
+	signature = sign(revoked, nil)
+	assert.NoError(t, revoked.RevokeKey(packet.KeyCompromised, "", nil))
+	result = VerifySignature(verifyTestPayload, signature, openpgp.EntityList{revoked})
+	assert.Equal(t, TrustStatusRevoked, result.Status)
+
+	// VerifyCommitSignature classifies the failures the same way with a key ring
+	for _, tc := range []struct {
+		entity    *openpgp.Entity
+		signature string
+		status    TrustStatus
+	}{
+		{expiring, sign(expiring, past), TrustStatusExpired},
+		{revoked, signature, TrustStatusRevoked},
+	} {
+		keyRing := new(bytes.Buffer)
+		assert.NoError(t, tc.entity.Serialize(keyRing))
+		verification, err := VerifyCommitSignature(&CommitGPGSignature{Signature: tc.signature, Payload: verifyTestPayload}, "", VerifyOptions{GPGKeyRing: keyRing.Bytes()})
+		assert.NoError(t, err)
+		assert.Equal(t, tc.status, verification.Status)
+		assert.False(t, verification.Verified())
+		assert.NotEmpty(t, verification.Reason)
+		assert.Len(t, verification.Fingerprint, 40)
+	}
+}
+
+// parseKeyID parses the hex key ID of a SignatureVerification
+func parseKeyID(t *testing.T, keyID string) uint64 {
+	id, err := strconv.ParseUint(keyID, 16, 64)
+	assert.NoError(t, err)
+	return id
+}
+
+func TestVerifySSHSignature(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	publicKey, err := ssh.NewPublicKey(key.Public())
+	assert.NoError(t, err)
+	authorizedKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey)))
+
+	sig := &CommitGPGSignature{Signature: signSSH(t, key, verifyTestPayload), Payload: verifyTestPayload}
+	opts := VerifyOptions{AllowedSigners: []byte("# comment\n*@example.com,alice@example.org namespaces=\"git\" " + authorizedKey + " alice\n")}
+
+	tag := &Tag{Tagger: &Signature{Email: "alice@example.org"}, Signature: sig}
+	result, err := tag.VerifySignature(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, SignatureTypeSSH, result.Type)
+	assert.Equal(t, TrustStatusTrusted, result.Status)
+	assert.Equal(t, "alice@example.org", result.Signer)
+	assert.Equal(t, ssh.FingerprintSHA256(publicKey), result.Fingerprint)
+
+	// principals can be patterns
+	result, err = VerifyCommitSignature(sig, "bob@example.com", opts)
+	assert.NoError(t, err)
+	assert.Equal(t, TrustStatusTrusted, result.Status)
+
+	result, err = VerifyCommitSignature(sig, "bob@example.net", opts)
+	assert.NoError(t, err)
+	assert.Equal(t, TrustStatusUnmatched, result.Status)
+	assert.Equal(t, "*@example.com", result.Signer)
+
+	result, err = VerifyCommitSignature(&CommitGPGSignature{Signature: sig.Signature, Payload: verifyTestPayload + "x"}, "alice@example.org", opts)
+	assert.NoError(t, err)
+	assert.Equal(t, TrustStatusInvalid, result.Status)
+
+	result, err = VerifyCommitSignature(sig, "alice@example.org", VerifyOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, TrustStatusUnknownKey, result.Status)
+
+	// keys restricted to other namespaces are ignored
+	result, err = VerifyCommitSignature(sig, "alice@example.org", VerifyOptions{AllowedSigners: []byte("alice@example.org namespaces=\"file\" " + authorizedKey + "\n")})
+	assert.NoError(t, err)
+	assert.Equal(t, TrustStatusUnknownKey, result.Status)
+
+	// negated principals exclude what they match
+	result, err = VerifyCommitSignature(sig, "mallory@example.com", VerifyOptions{AllowedSigners: []byte("*@example.com,!mallory@* " + authorizedKey + "\n")})
+	assert.NoError(t, err)
+	assert.Equal(t, TrustStatusUnmatched, result.Status)
+
+	// the key must be valid when the committer signed, at 1970-01-01T00:00:01Z
+	result, err = VerifyCommitSignature(sig, "alice@example.org", VerifyOptions{AllowedSigners: []byte("alice@example.org valid-after=\"20200101\" " + authorizedKey + "\n")})
+	assert.NoError(t, err)
+	assert.Equal(t, TrustStatusUnknownKey, result.Status)
+	assert.Contains(t, result.Reason, "1970-01-01T00:00:01Z")
+
+	result, err = VerifyCommitSignature(sig, "alice@example.org", VerifyOptions{AllowedSigners: []byte("alice@example.org valid-after=\"19700101Z\",valid-before=\"197001010001Z\" " + authorizedKey + "\n")})
+	assert.NoError(t, err)
+	assert.Equal(t, TrustStatusTrusted, result.Status)
+
+	_, err = VerifyCommitSignature(sig, "alice@example.org", VerifyOptions{AllowedSigners: []byte("alice@example.org not-a-key\n")})
+	assert.Error(t, err)
+	_, err = VerifyCommitSignature(sig, "alice@example.org", VerifyOptions{AllowedSigners: []byte("alice@example.org valid-before=\"2020\" " + authorizedKey + "\n")})
+	assert.Error(t, err)
+}
+
+func TestParseAllowedSignerTime(t *testing.T) {
+	for value, expected := range map[string]time.Time{
+		"20230102Z":       time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC),
+		"202301021504Z":   time.Date(2023, 1, 2, 15, 4, 0, 0, time.UTC),
+		"20230102150405Z": time.Date(2023, 1, 2, 15, 4, 5, 0, time.UTC),
+		"20230102":        time.Date(2023, 1, 2, 0, 0, 0, 0, time.Local),
+	} {
+		parsed, err := parseAllowedSignerTime(value)
+		assert.NoError(t, err)
+		assert.True(t, expected.Equal(parsed), value)
+	}
+	_, err := parseAllowedSignerTime("2023-01-02")
+	assert.Error(t, err)
+
+	assert.Equal(t, int64(1), signingTime(verifyTestPayload).Unix())
+	assert.WithinDuration(t, time.Now(), signingTime("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n"), time.Minute)
+}
+
+func TestVerifyUnsigned(t *testing.T) {
+	result, err := (&Commit{}).VerifySignature(VerifyOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, TrustStatusUnsigned, result.Status)
+	assert.False(t, result.Verified())
+}
+
+func TestRepository_GetTagSignatureStatus(t *testing.T) {
+	keyPath, allowedSigners := generateSSHSigningKey(t, "tagger@example.com")
+
+	repoPath := filepath.Join(t.TempDir(), "repo.git")
+	assert.NoError(t, Clone(DefaultContext, filepath.Join(testReposDir, "repo1_bare"), repoPath, CloneRepoOptions{Bare: true}))
+	repo, err := openRepositoryWithDefaultContext(repoPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	tagger := &Signature{Name: "Tagger", Email: "tagger@example.com", When: time.Unix(1700000000, 0).UTC()}
+	assert.NoError(t, repo.CreateAnnotatedTag("signed", "signed", "feaf4ba6bc635fec442f46ddd4512416ec43c2c2",
+		TagWithTagger(tagger), TagWithSigning(keyPath, SigningFormatSSH)))
+	assert.NoError(t, repo.CreateTag("lightweight", "feaf4ba6bc635fec442f46ddd4512416ec43c2c2"))
+
+	result, err := repo.GetTagSignatureStatus("signed", VerifyOptions{AllowedSigners: allowedSigners})
+	assert.NoError(t, err)
+	assert.Equal(t, SignatureTypeSSH, result.Type)
+	assert.Equal(t, TrustStatusTrusted, result.Status)
+	assert.Equal(t, "tagger@example.com", result.Signer)
+
+	result, err = repo.GetTagSignatureStatus("signed", VerifyOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, TrustStatusUnknownKey, result.Status)
+
+	result, err = repo.GetTagSignatureStatus("lightweight", VerifyOptions{AllowedSigners: allowedSigners})
+	assert.NoError(t, err)
+	assert.Equal(t, TrustStatusUnsigned, result.Status)
+
+	_, err = repo.GetTagSignatureStatus("unknown", VerifyOptions{})
+	assert.Error(t, err)
+}
+
+func TestTag_VerifySignatureWithKeys(t *testing.T) {
+	entity, err := openpgp.NewEntity("Tagger", "", "tagger@example.com", nil)
+	assert.NoError(t, err)
+	other, err := openpgp.NewEntity("Other", "", "other@example.com", nil)
+	assert.NoError(t, err)
+
+	repoPath := filepath.Join(t.TempDir(), "repo.git")
+	assert.NoError(t, Clone(DefaultContext, filepath.Join(testReposDir, "repo1_bare"), repoPath, CloneRepoOptions{Bare: true}))
+	repo, err := openRepositoryWithDefaultContext(repoPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	tagger := &Signature{Name: "Tagger", Email: "tagger@example.com", When: time.Unix(1700000000, 0).UTC()}
+	assert.NoError(t, repo.CreateAnnotatedTag("signed", "signed", "feaf4ba6bc635fec442f46ddd4512416ec43c2c2", TagWithTagger(tagger),
+		TagWithSigner(func(payload []byte) (string, error) {
+			signature := new(strings.Builder)
+			err := openpgp.ArmoredDetachSign(signature, entity, bytes.NewReader(payload), nil)
+			return signature.String(), err
+		})))
+	assert.NoError(t, repo.CreateAnnotatedTag("unsigned", "unsigned", "feaf4ba6bc635fec442f46ddd4512416ec43c2c2", TagWithTagger(tagger)))
+
+	tag, err := repo.GetTag("signed")
+	assert.NoError(t, err)
+	verification, err := tag.VerifySignature(VerifyOptions{GPGKeys: openpgp.EntityList{other, entity}})
+	assert.NoError(t, err)
+	assert.Equal(t, TrustStatusTrusted, verification.Status, verification.Reason)
+	verification, err = tag.VerifySignature(VerifyOptions{GPGKeys: openpgp.EntityList{other}})
+	assert.NoError(t, err)
+	assert.Equal(t, TrustStatusUnknownKey, verification.Status)
+	assert.Len(t, verification.KeyID, 16)
+
+	tag, err = repo.GetTag("unsigned")
+	assert.NoError(t, err)
+	verification, err = tag.VerifySignature(VerifyOptions{GPGKeys: openpgp.EntityList{entity}})
+	assert.NoError(t, err)
+	assert.Equal(t, TrustStatusUnsigned, verification.Status)
+}
+
+func TestRepository_GetCommitsVerificationStatus(t *testing.T) {
+	keyPath, allowedSigners := generateSSHSigningKey(t, "test@example.com")
+
+	repoPath := filepath.Join(t.TempDir(), "repo.git")
+	assert.NoError(t, Clone(DefaultContext, filepath.Join(testReposDir, "repo1_bare"), repoPath, CloneRepoOptions{Bare: true}))
+	repo, err := openRepositoryWithDefaultContext(repoPath)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	sig := &Signature{Name: "Test", Email: "test@example.com", When: time.Unix(1700000000, 0).UTC()}
+	opts := CommitTreeOpts{
+		Parents: []string{"feaf4ba6bc635fec442f46ddd4512416ec43c2c2"},
+		Message: "signed",
+		Signer:  SSHSigner(DefaultContext, "", keyPath),
+	}
+	signed, err := repo.commitTreeID(sig, sig, "f1a6cb52b2d16773290cefe49ad0684b50a4f930", opts)
+	assert.NoError(t, err)
+	other := &Signature{Name: "Other", Email: "other@example.com", When: sig.When}
+	unmatched, err := repo.commitTreeID(other, other, "f1a6cb52b2d16773290cefe49ad0684b50a4f930", opts)
+	assert.NoError(t, err)
+
+	// feaf4ba is signed with a gpg key which is not in the key ring
+	ids := []string{signed.String(), unmatched.String(), "feaf4ba6bc635fec442f46ddd4512416ec43c2c2", "37991dec2c8e592043f47155ce4808d4580f9123", signed.String()}
+	results, err := repo.GetCommitsVerificationStatus(ids, VerifyOptions{AllowedSigners: allowedSigners})
+	assert.NoError(t, err)
+	assert.Len(t, results, 4)
+	assert.Equal(t, TrustStatusTrusted, results[signed.String()].Status)
+	assert.Equal(t, TrustStatusUnmatched, results[unmatched.String()].Status)
+	assert.Equal(t, TrustStatusUnknownKey, results["feaf4ba6bc635fec442f46ddd4512416ec43c2c2"].Status)
+	assert.Equal(t, TrustStatusUnsigned, results["37991dec2c8e592043f47155ce4808d4580f9123"].Status)
+
+	results, err = repo.GetCommitsVerificationStatus(ids[:1], VerifyOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, TrustStatusUnknownKey, results[signed.String()].Status)
+
+	// ids which are missing or not commits don't stop the batch
+	missing := []string{"0000000000000000000000000000000000000001", "f1a6cb52b2d16773290cefe49ad0684b50a4f930", "", signed.String()}
+	results, err = repo.GetCommitsVerificationStatus(missing, VerifyOptions{AllowedSigners: allowedSigners})
+	assert.NoError(t, err)
+	assert.Len(t, results, 4)
+	for _, id := range missing[:3] {
+		assert.Equal(t, TrustStatusNotFound, results[id].Status, id)
+		assert.False(t, results[id].Verified())
+	}
+	assert.Equal(t, TrustStatusTrusted, results[signed.String()].Status)
+
+	// the keys are parsed once before the commits are read
+	_, err = repo.GetCommitsVerificationStatus(ids, VerifyOptions{GPGKeyRing: []byte("not a key ring")})
+	assert.Error(t, err)
+}
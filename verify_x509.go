@@ -0,0 +1,300 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// x509SignatureArmorStart is how S/MIME signatures of gpgsm and smimesign start
+const x509SignatureArmorStart = "-----BEGIN SIGNED MESSAGE-----"
+
+var (
+	oidSignedData        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidAttrMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidAttrSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidDigestSHA1        = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidDigestSHA256      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidDigestSHA384      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidDigestSHA512      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+)
+
+// CertificateIdentity are the identity claims of the certificate which made an X.509 signature
+type CertificateIdentity struct {
+	Subject   string
+	Issuer    string
+	Emails    []string
+	URIs      []string
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+type cmsContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type cmsSignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo cmsEncapContentInfo
+	Certificates     asn1.RawValue   `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue   `asn1:"optional,tag:1"`
+	SignerInfos      []cmsSignerInfo `asn1:"set"`
+}
+
+type cmsEncapContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     asn1.RawValue `asn1:"optional,explicit,tag:0"`
+}
+
+type cmsSignerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type cmsIssuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type cmsAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+func verifyX509Signature(sig *CommitGPGSignature, email string, roots *x509.CertPool) *SignatureVerification {
+	result := &SignatureVerification{Type: SignatureTypeX509, VerifiedAt: time.Now()}
+
+	cert, signedAt, certs, err := checkX509Signature(sig)
+	if err != nil {
+		result.Status = TrustStatusInvalid
+		result.Reason = err.Error()
+		return result
+	}
+	result.Fingerprint = fmt.Sprintf("%X", sha256.Sum256(cert.Raw))
+	result.Certificate = certificateIdentity(cert)
+	result.SignedAt = signedAt
+
+	intermediates := x509.NewCertPool()
+	for _, c := range certs {
+		if c != cert {
+			intermediates.AddCert(c)
+		}
+	}
+	if roots == nil {
+		result.Status = TrustStatusUnknownKey
+		result.Reason = "no trusted x509 roots"
+		return result
+	}
+	// the chain is checked now, the signing time in the signature is claimed by the signer.
+	// Short-lived certificates proven by a transparency log or timestamp authority, like the sigstore ones of gitsign,
+	// are therefore not supported. The certificate must be issued for signing mails or code.
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection, x509.ExtKeyUsageCodeSigning},
+	}); err != nil {
+		var invalidErr x509.CertificateInvalidError
+		switch {
+		case errors.As(err, &invalidErr) && invalidErr.Reason == x509.IncompatibleUsage:
+			result.Status = TrustStatusUnknownKey
+			result.Reason = "certificate is not issued for email protection or code signing: " + err.Error()
+		case errors.As(err, &invalidErr) && invalidErr.Reason == x509.Expired:
+			result.Status = TrustStatusExpired
+			result.Reason = err.Error()
+		default:
+			result.Status = TrustStatusUnknownKey
+			result.Reason = "certificate is not issued by a trusted root: " + err.Error()
+		}
+		return result
+	}
+	result.Status = TrustStatusUnmatched
+	if len(result.Certificate.Emails) > 0 {
+		result.Signer = result.Certificate.Emails[0]
+	} else if len(result.Certificate.URIs) > 0 {
+		result.Signer = result.Certificate.URIs[0]
+	} else {
+		result.Signer = result.Certificate.Subject
+	}
+	for _, certEmail := range result.Certificate.Emails {
+		if email != "" && strings.EqualFold(certEmail, email) {
+			result.Signer = certEmail
+			result.Status = TrustStatusTrusted
+			break
+		}
+	}
+	return result
+}
+
+// checkX509Signature verifies the detached CMS signature of the payload and returns the certificate which made it,
+// the time it signed at and all the certificates the signature carries
+func checkX509Signature(sig *CommitGPGSignature) (*x509.Certificate, time.Time, []*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(strings.TrimSpace(sig.Signature)))
+	if block == nil {
+		return nil, time.Time{}, nil, errors.New("invalid x509 signature encoding")
+	}
+
+	var contentInfo cmsContentInfo
+	if _, err := asn1.Unmarshal(block.Bytes, &contentInfo); err != nil {
+		return nil, time.Time{}, nil, fmt.Errorf("invalid x509 signature: %w", err)
+	}
+	if !contentInfo.ContentType.Equal(oidSignedData) {
+		return nil, time.Time{}, nil, fmt.Errorf("unexpected x509 signature content type %v", contentInfo.ContentType)
+	}
+	var signedData cmsSignedData
+	if _, err := asn1.Unmarshal(contentInfo.Content.Bytes, &signedData); err != nil {
+		return nil, time.Time{}, nil, fmt.Errorf("invalid x509 signature: %w", err)
+	}
+	if len(signedData.EncapContentInfo.EContent.Bytes) > 0 {
+		return nil, time.Time{}, nil, errors.New("x509 signature is not detached")
+	}
+	certs, err := x509.ParseCertificates(signedData.Certificates.Bytes)
+	if err != nil {
+		return nil, time.Time{}, nil, fmt.Errorf("invalid x509 signature certificates: %w", err)
+	}
+	if len(signedData.SignerInfos) != 1 {
+		return nil, time.Time{}, nil, fmt.Errorf("unexpected number of x509 signers: %d", len(signedData.SignerInfos))
+	}
+	signer := signedData.SignerInfos[0]
+
+	cert, err := findSignerCertificate(signer.SID, certs)
+	if err != nil {
+		return nil, time.Time{}, nil, err
+	}
+	hash, err := cmsDigestHash(signer.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return nil, time.Time{}, nil, err
+	}
+
+	signed := []byte(sig.Payload)
+	signedAt := signingTime(sig.Payload)
+	if len(signer.SignedAttrs.Bytes) > 0 {
+		// the signature is made over the DER encoding of the attributes as SET OF
+		signed = append([]byte{0x31}, signer.SignedAttrs.FullBytes[1:]...)
+		var attrs []cmsAttribute
+		if _, err := asn1.UnmarshalWithParams(signed, &attrs, "set"); err != nil {
+			return nil, time.Time{}, nil, fmt.Errorf("invalid x509 signature attributes: %w", err)
+		}
+
+		var digest []byte
+		for _, attr := range attrs {
+			switch {
+			case attr.Type.Equal(oidAttrMessageDigest):
+				_, err = asn1.Unmarshal(attr.Values.Bytes, &digest)
+			case attr.Type.Equal(oidAttrSigningTime):
+				_, err = asn1.Unmarshal(attr.Values.Bytes, &signedAt)
+			}
+			if err != nil {
+				return nil, time.Time{}, nil, fmt.Errorf("invalid x509 signature attribute %v: %w", attr.Type, err)
+			}
+		}
+		h := hash.New()
+		_, _ = h.Write([]byte(sig.Payload))
+		if !bytes.Equal(digest, h.Sum(nil)) {
+			return nil, time.Time{}, nil, errors.New("x509 signature does not match: message digest differs")
+		}
+	}
+
+	algorithm, err := x509SignatureAlgorithm(cert, hash)
+	if err != nil {
+		return nil, time.Time{}, nil, err
+	}
+	if err := cert.CheckSignature(algorithm, signed, signer.Signature); err != nil {
+		return nil, time.Time{}, nil, fmt.Errorf("x509 signature does not match: %w", err)
+	}
+	return cert, signedAt, certs, nil
+}
+
+// findSignerCertificate returns the certificate a SignerIdentifier, either the issuer and serial number
+// or the subject key identifier, refers to
+func findSignerCertificate(sid asn1.RawValue, certs []*x509.Certificate) (*x509.Certificate, error) {
+	if sid.Class == asn1.ClassContextSpecific && sid.Tag == 0 {
+		for _, cert := range certs {
+			if bytes.Equal(cert.SubjectKeyId, sid.Bytes) {
+				return cert, nil
+			}
+		}
+		return nil, errors.New("x509 signature certificate is missing")
+	}
+
+	var issuerAndSerial cmsIssuerAndSerial
+	if _, err := asn1.Unmarshal(sid.FullBytes, &issuerAndSerial); err != nil {
+		return nil, fmt.Errorf("invalid x509 signer identifier: %w", err)
+	}
+	for _, cert := range certs {
+		if cert.SerialNumber.Cmp(issuerAndSerial.Serial) == 0 && bytes.Equal(cert.RawIssuer, issuerAndSerial.Issuer.FullBytes) {
+			return cert, nil
+		}
+	}
+	return nil, errors.New("x509 signature certificate is missing")
+}
+
+func cmsDigestHash(algorithm asn1.ObjectIdentifier) (crypto.Hash, error) {
+	switch {
+	case algorithm.Equal(oidDigestSHA1):
+		return crypto.SHA1, nil
+	case algorithm.Equal(oidDigestSHA256):
+		return crypto.SHA256, nil
+	case algorithm.Equal(oidDigestSHA384):
+		return crypto.SHA384, nil
+	case algorithm.Equal(oidDigestSHA512):
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("unsupported x509 signature digest algorithm %v", algorithm)
+}
+
+// x509SignatureAlgorithm derives the signature algorithm from the key of the certificate and the digest,
+// as the signature algorithm of a signer is commonly given by the key type alone
+func x509SignatureAlgorithm(cert *x509.Certificate, hash crypto.Hash) (x509.SignatureAlgorithm, error) {
+	algorithms := map[crypto.Hash][2]x509.SignatureAlgorithm{
+		crypto.SHA1:   {x509.SHA1WithRSA, x509.ECDSAWithSHA1},
+		crypto.SHA256: {x509.SHA256WithRSA, x509.ECDSAWithSHA256},
+		crypto.SHA384: {x509.SHA384WithRSA, x509.ECDSAWithSHA384},
+		crypto.SHA512: {x509.SHA512WithRSA, x509.ECDSAWithSHA512},
+	}[hash]
+	switch cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return algorithms[0], nil
+	case *ecdsa.PublicKey:
+		return algorithms[1], nil
+	case ed25519.PublicKey:
+		return x509.PureEd25519, nil
+	}
+	return x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported x509 signature key %T", cert.PublicKey)
+}
+
+func certificateIdentity(cert *x509.Certificate) *CertificateIdentity {
+	identity := &CertificateIdentity{
+		Subject:   cert.Subject.String(),
+		Issuer:    cert.Issuer.String(),
+		Emails:    cert.EmailAddresses,
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+	}
+	for _, uri := range cert.URIs {
+		identity.URIs = append(identity.URIs, uri.String())
+	}
+	return identity
+}
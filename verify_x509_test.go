@@ -0,0 +1,199 @@
+// Copyright 2023 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// x509TestPayload is committed at 2023-11-14T22:13:20Z
+const x509TestPayload = "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\nauthor A <alice@example.com> 1700000000 +0000\ncommitter A <alice@example.com> 1700000000 +0000\n\nsigned\n"
+
+// newTestCertificate creates a certificate valid for minutes around validAt unless the template sets the validity,
+// it is self-signed if parent is nil
+func newTestCertificate(t *testing.T, template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, validAt time.Time) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	if template.NotAfter.IsZero() {
+		template.NotBefore, template.NotAfter = validAt.Add(-5*time.Minute), validAt.Add(5*time.Minute)
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	raw, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(raw)
+	assert.NoError(t, err)
+	return cert, key
+}
+
+// signX509 creates a detached CMS signature of payload like gpgsm does, signed at signedAt
+func signX509(t *testing.T, cert *x509.Certificate, key *ecdsa.PrivateKey, payload string, signedAt time.Time, certs ...*x509.Certificate) string {
+	attribute := func(oid asn1.ObjectIdentifier, value any) cmsAttribute {
+		der, err := asn1.Marshal(value)
+		assert.NoError(t, err)
+		return cmsAttribute{Type: oid, Values: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: der}}
+	}
+	digest := sha256.Sum256([]byte(payload))
+	attrs, err := asn1.MarshalWithParams([]cmsAttribute{
+		attribute(asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}, asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}),
+		attribute(oidAttrSigningTime, signedAt.UTC()),
+		attribute(oidAttrMessageDigest, digest[:]),
+	}, "set")
+	assert.NoError(t, err)
+	attrsDigest := sha256.Sum256(attrs)
+	signature, err := ecdsa.SignASN1(rand.Reader, key, attrsDigest[:])
+	assert.NoError(t, err)
+
+	sid, err := asn1.Marshal(cmsIssuerAndSerial{Issuer: asn1.RawValue{FullBytes: cert.RawIssuer}, Serial: cert.SerialNumber})
+	assert.NoError(t, err)
+	var rawCerts []byte
+	for _, c := range append([]*x509.Certificate{cert}, certs...) {
+		rawCerts = append(rawCerts, c.Raw...)
+	}
+	sha256Algorithm := []pkix.AlgorithmIdentifier{{Algorithm: oidDigestSHA256}}
+	signedData, err := asn1.Marshal(cmsSignedData{
+		Version:          1,
+		DigestAlgorithms: sha256Algorithm,
+		EncapContentInfo: cmsEncapContentInfo{EContentType: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: rawCerts},
+		SignerInfos: []cmsSignerInfo{{
+			Version:            1,
+			SID:                asn1.RawValue{FullBytes: sid},
+			DigestAlgorithm:    sha256Algorithm[0],
+			SignedAttrs:        asn1.RawValue{FullBytes: append([]byte{0xa0}, attrs[1:]...)},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}},
+			Signature:          signature,
+		}},
+	})
+	assert.NoError(t, err)
+	contentInfo, err := asn1.Marshal(cmsContentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedData},
+	})
+	assert.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "SIGNED MESSAGE", Bytes: contentInfo}))
+}
+
+func TestVerifyX509Signature(t *testing.T) {
+	now := time.Now()
+	// the authorities are valid since the test payload is committed
+	root, rootKey := newTestCertificate(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "root"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		NotBefore:             time.Unix(1700000000, 0).Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+	}, nil, nil, now)
+	intermediate, intermediateKey := newTestCertificate(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "intermediate"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		NotBefore:             time.Unix(1700000000, 0).Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+	}, root, rootKey, now)
+	workflow, err := url.Parse("https://github.com/org/repo/.github/workflows/ci.yml@refs/heads/main")
+	assert.NoError(t, err)
+	leaf, leafKey := newTestCertificate(t, &x509.Certificate{
+		EmailAddresses: []string{"alice@example.com"},
+		URIs:           []*url.URL{workflow},
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}, intermediate, intermediateKey, now)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	opts := VerifyOptions{X509Roots: roots}
+	signature := signX509(t, leaf, leafKey, x509TestPayload, now, intermediate)
+
+	commit := &Commit{Committer: &Signature{Email: "alice@example.com"}, Signature: &CommitGPGSignature{Signature: signature, Payload: x509TestPayload}}
+	result, err := commit.VerifySignature(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, SignatureTypeX509, result.Type)
+	assert.Equal(t, TrustStatusTrusted, result.Status, result.Reason)
+	assert.Equal(t, "alice@example.com", result.Signer)
+	assert.Len(t, result.Fingerprint, 64)
+	assert.WithinDuration(t, now, result.SignedAt, time.Second)
+	if assert.NotNil(t, result.Certificate) {
+		assert.Equal(t, []string{"alice@example.com"}, result.Certificate.Emails)
+		assert.Equal(t, []string{workflow.String()}, result.Certificate.URIs)
+		assert.Equal(t, "CN=intermediate", result.Certificate.Issuer)
+	}
+
+	result, err = VerifyCommitSignature(commit.Signature, "bob@example.com", opts)
+	assert.NoError(t, err)
+	assert.Equal(t, TrustStatusUnmatched, result.Status)
+	assert.Equal(t, "alice@example.com", result.Signer)
+
+	result, err = VerifyCommitSignature(&CommitGPGSignature{Signature: signature, Payload: x509TestPayload + "x"}, "alice@example.com", opts)
+	assert.NoError(t, err)
+	assert.Equal(t, TrustStatusInvalid, result.Status)
+
+	// the certificate chain must lead to a trusted root
+	result, err = VerifyCommitSignature(commit.Signature, "alice@example.com", VerifyOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, TrustStatusUnknownKey, result.Status)
+	assert.NotNil(t, result.Certificate)
+
+	other, _ := newTestCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "other"}, IsCA: true, BasicConstraintsValid: true}, nil, nil, now)
+	otherRoots := x509.NewCertPool()
+	otherRoots.AddCert(other)
+	result, err = VerifyCommitSignature(commit.Signature, "alice@example.com", VerifyOptions{X509Roots: otherRoots})
+	assert.NoError(t, err)
+	assert.Equal(t, TrustStatusUnknownKey, result.Status)
+
+	// the certificate must be issued for signing
+	serverLeaf, serverLeafKey := newTestCertificate(t, &x509.Certificate{
+		EmailAddresses: []string{"alice@example.com"},
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, intermediate, intermediateKey, now)
+	server := signX509(t, serverLeaf, serverLeafKey, x509TestPayload, now, intermediate)
+	result, err = VerifyCommitSignature(&CommitGPGSignature{Signature: server, Payload: x509TestPayload}, "alice@example.com", opts)
+	assert.NoError(t, err)
+	assert.Equal(t, TrustStatusUnknownKey, result.Status)
+	assert.Contains(t, result.Reason, "code signing")
+
+	smimeLeaf, smimeLeafKey := newTestCertificate(t, &x509.Certificate{
+		EmailAddresses: []string{"alice@example.com"},
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+	}, intermediate, intermediateKey, now)
+	smime := signX509(t, smimeLeaf, smimeLeafKey, x509TestPayload, now, intermediate)
+	result, err = VerifyCommitSignature(&CommitGPGSignature{Signature: smime, Payload: x509TestPayload}, "alice@example.com", opts)
+	assert.NoError(t, err)
+	assert.Equal(t, TrustStatusTrusted, result.Status, result.Reason)
+
+	// the certificate must be valid now, the signing time it claims isn't trusted
+	expiredLeaf, expiredLeafKey := newTestCertificate(t, &x509.Certificate{
+		EmailAddresses: []string{"alice@example.com"},
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+	}, intermediate, intermediateKey, time.Unix(1700000000, 0))
+	expired := signX509(t, expiredLeaf, expiredLeafKey, x509TestPayload, time.Unix(1700000000, 0), intermediate)
+	result, err = VerifyCommitSignature(&CommitGPGSignature{Signature: expired, Payload: x509TestPayload}, "alice@example.com", opts)
+	assert.NoError(t, err)
+	assert.Equal(t, TrustStatusExpired, result.Status)
+	assert.Contains(t, result.Reason, "expired")
+
+	result, err = VerifyCommitSignature(&CommitGPGSignature{Signature: "-----BEGIN SIGNED MESSAGE-----\nc2lnbmF0dXJl\n-----END SIGNED MESSAGE-----\n", Payload: x509TestPayload}, "alice@example.com", opts)
+	assert.NoError(t, err)
+	assert.Equal(t, TrustStatusInvalid, result.Status)
+}